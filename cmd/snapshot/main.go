@@ -0,0 +1,309 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/soderasen-au/go-common/loggers"
+	"github.com/soderasen-au/go-common/util"
+	"gopkg.in/yaml.v3"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+	"github.com/soderasen-au/go-qlik/qlik/snapshot"
+)
+
+// exit codes
+const (
+	EXIT_OK    = 0
+	EXIT_DIFF  = 1
+	EXIT_ERROR = 2
+)
+
+// Config is the yaml file of `-config`.
+type Config struct {
+	Store  string              `json:"store" yaml:"store"`
+	Engine engine.MixedConfig  `json:"engine" yaml:"engine"`
+	Walk   *engine.WalkOptions `json:"walk,omitempty" yaml:"walk,omitempty"`
+	Diff   *engine.DiffOptions `json:"diff,omitempty" yaml:"diff,omitempty"`
+}
+
+func usage(w io.Writer) {
+	prog := filepath.Base(os.Args[0])
+	fmt.Fprintf(w, "Usage:\n")
+	fmt.Fprintf(w, "  %s take   -config <file> [-store <dir>] [-app-id <id>] [-bm-id <id> | -bm-title <title>]\n", prog)
+	fmt.Fprintf(w, "  %s diff   [-config <file>] [-store <dir>] [diff flags] <a> <b>\n", prog)
+	fmt.Fprintf(w, "  %s verify -config <file> [-store <dir>] [-baseline <ref>] [-save] [diff flags]\n", prog)
+	fmt.Fprintf(w, "\nSnapshots are referred to by file path or <app id>[/<bookmark id>][@<timestamp prefix>].\n")
+	fmt.Fprintf(w, "Exit code is %d if snapshots are equal, %d if they differ and %d on errors.\n", EXIT_OK, EXIT_DIFF, EXIT_ERROR)
+}
+
+type options struct {
+	flags    *flag.FlagSet
+	stdout   io.Writer
+	config   string
+	store    string
+	appId    string
+	bmId     string
+	bmTitle  string
+	baseline string
+	save     bool
+	jsonOut  string
+	htmlOut  string
+	absTol   float64
+	relTol   float64
+	ignore   string
+	verbose  bool
+}
+
+func newOptions(cmd string, stdout, stderr io.Writer) *options {
+	o := &options{flags: flag.NewFlagSet(cmd, flag.ContinueOnError), stdout: stdout}
+	f := o.flags
+	f.SetOutput(stderr)
+	f.StringVar(&o.config, "config", "", "yaml config with `store`, `engine` (MixedConfig), `walk` and `diff` options")
+	f.StringVar(&o.store, "store", "", "snapshot store directory, overrides `store` of config")
+	f.BoolVar(&o.verbose, "v", false, "log to stderr")
+	if cmd != "diff" {
+		f.StringVar(&o.appId, "app-id", "", "app id, overrides `engine.app_id` of config")
+		f.StringVar(&o.bmId, "bm-id", "", "bookmark id to apply before snapshotting")
+		f.StringVar(&o.bmTitle, "bm-title", "", "bookmark title to apply before snapshotting")
+	}
+	if cmd != "take" {
+		f.StringVar(&o.jsonOut, "json", "", "write diff as json to file")
+		f.StringVar(&o.htmlOut, "html", "", "write diff as html report to file")
+		f.Float64Var(&o.absTol, "abs-tol", -1, "absolute tolerance of numbers")
+		f.Float64Var(&o.relTol, "rel-tol", -1, "relative tolerance of numbers")
+		f.StringVar(&o.ignore, "ignore", "", "comma separated property paths to ignore in addition to defaults")
+	}
+	if cmd == "verify" {
+		f.StringVar(&o.baseline, "baseline", "", "baseline snapshot, defaults to the latest of the app and bookmark")
+		f.BoolVar(&o.save, "save", false, "save the new snapshot into the store if it matches the baseline")
+	}
+	return o
+}
+
+func (o *options) load() (*Config, error) {
+	cfg := &Config{}
+	if o.config != "" {
+		buf, err := os.ReadFile(o.config)
+		if err != nil {
+			return nil, fmt.Errorf("read config: %v", err)
+		}
+		if err := yaml.Unmarshal(buf, cfg); err != nil {
+			return nil, fmt.Errorf("parse config: %v", err)
+		}
+	}
+	if o.store != "" {
+		cfg.Store = o.store
+	}
+	if cfg.Store == "" {
+		cfg.Store = "snapshots"
+	}
+	if o.appId != "" {
+		cfg.Engine.AppId = o.appId
+	}
+	if o.bmId != "" {
+		cfg.Engine.BmId = util.Ptr(o.bmId)
+	}
+	if o.bmTitle != "" {
+		cfg.Engine.BmTitle = util.Ptr(o.bmTitle)
+	}
+	if cfg.Diff == nil {
+		cfg.Diff = engine.DefaultDiffOptions()
+	}
+	if o.absTol >= 0 {
+		cfg.Diff.AbsTolerance = o.absTol
+	}
+	if o.relTol >= 0 {
+		cfg.Diff.RelTolerance = o.relTol
+	}
+	for _, p := range strings.Split(o.ignore, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			cfg.Diff.IgnorePaths = append(cfg.Diff.IgnorePaths, p)
+		}
+	}
+	return cfg, nil
+}
+
+func (o *options) logger() *zerolog.Logger {
+	if o.verbose {
+		return loggers.CoreDebugLogger
+	}
+	return loggers.NullLogger
+}
+
+func (o *options) take(cfg *Config) (*snapshot.Snapshot, error) {
+	if cfg.Engine.AppId == "" {
+		return nil, fmt.Errorf("app id is required")
+	}
+	s, res := snapshot.Take(engine.ConnCtx, cfg.Engine, cfg.Walk, o.logger())
+	if res != nil {
+		return nil, fmt.Errorf("take snapshot: %v", res)
+	}
+	return s, nil
+}
+
+// report writes and prints d, it returns the exit code.
+func (o *options) report(d *engine.AppDiff) (int, error) {
+	if o.jsonOut != "" {
+		if err := writeFile(o.jsonOut, d.WriteJSON); err != nil {
+			return EXIT_ERROR, err
+		}
+	}
+	if o.htmlOut != "" {
+		if err := writeFile(o.htmlOut, func(w io.Writer) *util.Result { return d.WriteHTML(w, "Snapshot diff") }); err != nil {
+			return EXIT_ERROR, err
+		}
+	}
+	for _, obj := range d.Objects {
+		s := obj.Summary
+		fmt.Fprintf(o.stdout, "[%s] %s %s/%s %s: %d properties, rows +%d -%d ~%d\n",
+			obj.Change, obj.List, obj.Type, obj.Id, obj.Title, s.Properties, s.RowsAdded, s.RowsDeleted, s.RowsModified)
+	}
+	fmt.Fprintf(o.stdout, "added: %d, deleted: %d, modified: %d, unchanged: %d\n",
+		d.Summary.Added, d.Summary.Deleted, d.Summary.Modified, d.Summary.Unchanged)
+	if len(d.Objects) > 0 {
+		return EXIT_DIFF, nil
+	}
+	return EXIT_OK, nil
+}
+
+func writeFile(path string, write func(w io.Writer) *util.Result) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create %s: %v", path, err)
+	}
+	if res := write(f); res != nil {
+		f.Close()
+		return fmt.Errorf("write %s: %v", path, res)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close %s: %v", path, err)
+	}
+	return nil
+}
+
+// run runs command `cmd` of o, it returns the exit code.
+func (o *options) run(cmd string, cfg *Config) (int, error) {
+	store := snapshot.NewStore(cfg.Store)
+
+	switch cmd {
+	case "take":
+		s, err := o.take(cfg)
+		if err != nil {
+			return EXIT_ERROR, err
+		}
+		e, res := store.Save(s)
+		if res != nil {
+			return EXIT_ERROR, fmt.Errorf("save snapshot: %v", res)
+		}
+		fmt.Fprintln(o.stdout, e.Path)
+		return EXIT_OK, nil
+
+	case "diff":
+		if o.flags.NArg() != 2 {
+			return EXIT_ERROR, fmt.Errorf("diff requires 2 snapshots")
+		}
+		from, res := store.Load(o.flags.Arg(0))
+		if res != nil {
+			return EXIT_ERROR, fmt.Errorf("load %s: %v", o.flags.Arg(0), res)
+		}
+		to, res := store.Load(o.flags.Arg(1))
+		if res != nil {
+			return EXIT_ERROR, fmt.Errorf("load %s: %v", o.flags.Arg(1), res)
+		}
+		d, res := from.Diff(to, cfg.Diff)
+		if res != nil {
+			return EXIT_ERROR, fmt.Errorf("diff: %v", res)
+		}
+		return o.report(d)
+
+	case "verify":
+		current, err := o.take(cfg)
+		if err != nil {
+			return EXIT_ERROR, err
+		}
+		var baseline *snapshot.Snapshot
+		if o.baseline != "" {
+			var res *util.Result
+			if baseline, res = store.Load(o.baseline); res != nil {
+				return EXIT_ERROR, fmt.Errorf("load baseline %s: %v", o.baseline, res)
+			}
+		} else {
+			e, res := store.Latest(current.AppId, current.BookmarkId)
+			if res != nil {
+				return EXIT_ERROR, fmt.Errorf("find baseline: %v", res)
+			}
+			if e != nil {
+				if baseline, res = snapshot.Load(e.Path); res != nil {
+					return EXIT_ERROR, fmt.Errorf("load baseline %s: %v", e.Path, res)
+				}
+			}
+		}
+		if baseline == nil {
+			if !o.save {
+				return EXIT_ERROR, fmt.Errorf("no baseline of %s in %s", current.AppId, cfg.Store)
+			}
+			fmt.Fprintln(o.stdout, "no baseline to verify against")
+			return o.saveVerified(store, current)
+		}
+		d, res := baseline.Diff(current, cfg.Diff)
+		if res != nil {
+			return EXIT_ERROR, fmt.Errorf("diff: %v", res)
+		}
+		code, err := o.report(d)
+		if code != EXIT_OK || !o.save {
+			return code, err
+		}
+		return o.saveVerified(store, current)
+	}
+	return EXIT_ERROR, fmt.Errorf("invalid command '%s': must be 'take', 'diff' or 'verify'", cmd)
+}
+
+// saveVerified saves a snapshot which passed verification, a drifted one is never saved
+// so that it doesn't become the baseline of the next verify.
+func (o *options) saveVerified(store *snapshot.Store, s *snapshot.Snapshot) (int, error) {
+	e, res := store.Save(s)
+	if res != nil {
+		return EXIT_ERROR, fmt.Errorf("save snapshot: %v", res)
+	}
+	fmt.Fprintln(o.stdout, "saved", e.Path)
+	return EXIT_OK, nil
+}
+
+// run runs the command of args, which exclude the program name, it returns the exit code.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) < 1 {
+		usage(stderr)
+		return EXIT_ERROR
+	}
+
+	cmd := strings.ToLower(args[0])
+	if cmd != "take" && cmd != "diff" && cmd != "verify" {
+		usage(stderr)
+		fmt.Fprintf(stderr, "Error: invalid command '%s': must be 'take', 'diff' or 'verify'\n", cmd)
+		return EXIT_ERROR
+	}
+	o := newOptions(cmd, stdout, stderr)
+	if err := o.flags.Parse(args[1:]); err != nil {
+		return EXIT_ERROR
+	}
+	cfg, err := o.load()
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return EXIT_ERROR
+	}
+	code, err := o.run(cmd, cfg)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+	}
+	return code
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/soderasen-au/go-common/util"
+	"gopkg.in/yaml.v3"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+	"github.com/soderasen-au/go-qlik/qlik/engine/enginetest"
+)
+
+func TestRun(t *testing.T) {
+	srv := enginetest.NewServer(enginetest.SalesFixture())
+	t.Cleanup(srv.Close)
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config.yaml")
+	buf, err := yaml.Marshal(Config{Store: filepath.Join(dir, "store"), Engine: srv.Config("sales")})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if err := os.WriteFile(config, buf, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	cli := func(wantCode int, args ...string) string {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		if code := run(args, &stdout, &stderr); code != wantCode {
+			t.Fatalf("run(%v) = %d, want %d\nstdout: %s\nstderr: %s", args, code, wantCode, stdout.String(), stderr.String())
+		}
+		return stdout.String() + stderr.String()
+	}
+
+	out := cli(EXIT_ERROR, "verify", "-config", config)
+	if !strings.Contains(out, "no baseline of sales") {
+		t.Errorf("verify without baseline = %s", out)
+	}
+	first := strings.TrimSpace(cli(EXIT_OK, "take", "-config", config))
+	if !strings.HasSuffix(first, ".json.gz") || !strings.Contains(first, filepath.Join("store", "sales", "_")) {
+		t.Errorf("take = %s", first)
+	}
+	if out := cli(EXIT_OK, "verify", "-config", config); !strings.Contains(out, "added: 0, deleted: 0, modified: 0") {
+		t.Errorf("verify = %s", out)
+	}
+
+	doc := enginetest.ConnectDoc(t, *srv.Config("sales").OnPrem)
+	res := engine.UpdateObject(doc, "tbl-sales", func(p engine.VizProperties) *util.Result {
+		p.(*engine.TableProperties).Title = engine.NewStringOrExpr("Sales by Product")
+		return nil
+	})
+	if res != nil {
+		t.Fatalf("UpdateObject: %v", res)
+	}
+
+	report := filepath.Join(dir, "diff.json")
+	out = cli(EXIT_DIFF, "verify", "-config", config, "-save", "-json", report)
+	if !strings.Contains(out, "[modify] AppObjectList table/tbl-sales Sales by Product: 2 properties") || strings.Contains(out, "saved ") {
+		t.Errorf("verify = %s", out)
+	}
+	if buf, err := os.ReadFile(report); err != nil || !strings.Contains(string(buf), `"tbl-sales"`) {
+		t.Errorf("json report = %s, %v", buf, err)
+	}
+	// the drifted snapshot isn't saved, so it's still detected
+	cli(EXIT_DIFF, "verify", "-config", config, "-save")
+	cli(EXIT_OK, "take", "-config", config)
+	if out := cli(EXIT_OK, "verify", "-config", config, "-save"); !strings.Contains(out, "saved ") {
+		t.Errorf("verify -save = %s", out)
+	}
+	if out := cli(EXIT_DIFF, "diff", "-config", config, first, "sales"); !strings.Contains(out, "modified: 1") {
+		t.Errorf("diff = %s", out)
+	}
+	cli(EXIT_OK, "diff", "-config", config, "sales", "sales")
+	if out := cli(EXIT_DIFF, "diff", "-config", config, "-ignore", "/title", first, "sales"); !strings.Contains(out, "tbl-sales Sales by Product: 1 properties") {
+		t.Errorf("diff -ignore = %s", out)
+	}
+
+	for _, args := range [][]string{
+		{},
+		{"list"},
+		{"take", "-unknown"},
+		{"take", "-config", filepath.Join(dir, "missing.yaml")},
+		{"diff", "-config", config, "sales"},
+		{"diff", "-config", config, "sales", "sales@1999"},
+		{"verify", "-config", config, "-app-id", "missing"},
+	} {
+		cli(EXIT_ERROR, args...)
+	}
+}
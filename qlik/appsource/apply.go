@@ -0,0 +1,191 @@
+package appsource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"slices"
+	"sort"
+
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/soderasen-au/go-common/util"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+)
+
+const (
+	ACTION_CREATE = "create"
+	ACTION_UPDATE = "update"
+	ACTION_DELETE = "delete"
+	ACTION_SKIP   = "skip"
+
+	TYPE_APP    = "app"
+	TYPE_SCRIPT = "script"
+)
+
+type ImportOptions struct {
+	KeepExtra  bool `json:"keep_extra" yaml:"keep_extra"`   // don't delete objects which are not in source
+	SkipApp    bool `json:"skip_app" yaml:"skip_app"`       // don't update app properties
+	SkipScript bool `json:"skip_script" yaml:"skip_script"` // don't update the load script
+	DryRun     bool `json:"dry_run" yaml:"dry_run"`         // only return changes
+	Save       bool `json:"save" yaml:"save"`               // save the app after changes
+}
+
+func DefaultImportOptions() *ImportOptions {
+	return &ImportOptions{Save: true}
+}
+
+// Change is a change made, or to be made with DryRun, by Apply.
+type Change struct {
+	Action string `json:"action" yaml:"action"`
+	Type   string `json:"type" yaml:"type"`
+	Id     string `json:"id,omitempty" yaml:"id,omitempty"`
+	// Warning tells why a change is skipped.
+	Warning string `json:"warning,omitempty" yaml:"warning,omitempty"`
+}
+
+// Apply reconciles app of doc with s: objects are created, updated or deleted, so that
+// reading the app again results in s. Objects are compared by properties and children, not meta.
+// Objects of Export kinds which would be created or updated are skipped with a warning.
+// The script and app properties are kept if s has none.
+func (s *Source) Apply(ctx context.Context, doc *enigma.Doc, opts *ImportOptions) ([]*Change, *util.Result) {
+	if opts == nil {
+		opts = DefaultImportOptions()
+	}
+	current, res := Read(ctx, doc)
+	if res != nil {
+		return nil, res.With("Read")
+	}
+
+	changes := make([]*Change, 0)
+	if !opts.SkipApp && len(s.App) > 0 && !bytes.Equal(s.App, current.App) {
+		changes = append(changes, &Change{Action: ACTION_UPDATE, Type: TYPE_APP})
+		if !opts.DryRun {
+			if err := doc.SetAppPropertiesRaw(ctx, s.App); err != nil {
+				return changes, util.Error("SetAppProperties", err)
+			}
+		}
+	}
+	if !opts.SkipScript && s.Script != nil && *s.Script != util.MaybeNil(current.Script) {
+		changes = append(changes, &Change{Action: ACTION_UPDATE, Type: TYPE_SCRIPT})
+		if !opts.DryRun {
+			if err := doc.SetScript(ctx, *s.Script); err != nil {
+				return changes, util.Error("SetScript", err)
+			}
+		}
+	}
+
+	for _, k := range Kinds {
+		want, have := s.Objects[k.Type], current.Objects[k.Type]
+		for _, id := range sortedIds(want) {
+			obj, action := want[id], ACTION_CREATE
+			if old, ok := have[id]; ok {
+				if equalTree(obj, old) {
+					continue
+				}
+				action = ACTION_UPDATE
+			}
+			if k.Export {
+				changes = append(changes, &Change{Action: ACTION_SKIP, Type: k.Type, Id: id,
+					Warning: "can't " + action + " " + k.Type + " with its selections"})
+				continue
+			}
+			changes = append(changes, &Change{Action: action, Type: k.Type, Id: id})
+			if opts.DryRun {
+				continue
+			}
+			if res := apply(ctx, doc, k, obj, action); res != nil {
+				return changes, res.With(action + " " + k.Type + " " + id)
+			}
+		}
+	}
+
+	if !opts.KeepExtra {
+		for i := len(Kinds) - 1; i >= 0; i-- {
+			k := Kinds[i]
+			for _, id := range sortedIds(current.Objects[k.Type]) {
+				if _, ok := s.Objects[k.Type][id]; ok {
+					continue
+				}
+				changes = append(changes, &Change{Action: ACTION_DELETE, Type: k.Type, Id: id})
+				if opts.DryRun {
+					continue
+				}
+				if _, err := engine.DestroyObjectContext(ctx, doc, k.Type, id); err != nil {
+					return changes, util.Error("delete "+k.Type+" "+id, err)
+				}
+			}
+		}
+	}
+
+	if opts.Save && !opts.DryRun && slices.ContainsFunc(changes, func(c *Change) bool { return c.Action != ACTION_SKIP }) {
+		if err := doc.DoSave(ctx, ""); err != nil {
+			return changes, util.Error("DoSave", err)
+		}
+	}
+	return changes, nil
+}
+
+func apply(ctx context.Context, doc *enigma.Doc, k Kind, obj *engine.ObjectPropeties, action string) *util.Result {
+	if action == ACTION_CREATE {
+		if k.Generic {
+			_, res := engine.RecursiveCreateObjectContext(ctx, doc, *obj, nil)
+			return res
+		}
+		if _, err := engine.CreateObjectContext(ctx, doc, k.Type, obj.Properties); err != nil {
+			return util.Error("CreateObject", err)
+		}
+		return nil
+	}
+
+	if k.Generic {
+		o, err := doc.GetObject(ctx, obj.Info.Id)
+		if err != nil {
+			return util.Error("GetObject", err)
+		}
+		if err := o.SetFullPropertyTreeRaw(ctx, propertyTree(obj)); err != nil {
+			return util.Error("SetFullPropertyTree", err)
+		}
+		return nil
+	}
+	o, err := engine.GetObjectContext(ctx, doc, k.Type, obj.Info.Id)
+	if err != nil {
+		return util.Error("GetObject", err)
+	}
+	if err := engine.Invoke1ErrOn(o, "SetPropertiesRaw", ctx, obj.Properties); err != nil {
+		return util.Error("SetProperties", err)
+	}
+	return nil
+}
+
+// propertyTree returns p as GenericObjectEntry without meta, as used by SetFullPropertyTree.
+func propertyTree(p *engine.ObjectPropeties) map[string]any {
+	children := make([]any, 0, len(p.ChildInfos))
+	for _, c := range p.ChildInfos {
+		if c != nil {
+			children = append(children, propertyTree(c))
+		}
+	}
+	return map[string]any{"qProperty": p.Properties, "qChildren": children}
+}
+
+func equalTree(a, b *engine.ObjectPropeties) bool {
+	ja, err := json.Marshal(propertyTree(a))
+	if err != nil {
+		return false
+	}
+	jb, err := json.Marshal(propertyTree(b))
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(ja, jb)
+}
+
+func sortedIds(objects map[string]*engine.ObjectPropeties) []string {
+	ids := make([]string, 0, len(objects))
+	for id := range objects {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
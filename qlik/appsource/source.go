@@ -0,0 +1,383 @@
+// Package appsource exports metadata and the load script of an app as a directory of files,
+// so that apps can be kept in git, and imports it back by reconciling an app with the files.
+//
+//	<dir>/app.json          app properties
+//	<dir>/script.qvs        load script
+//	<dir>/<kind>/<id>.json  an object of Kinds, generic objects include their children
+//
+// Files are YAML with FORMAT_YAML. Volatile fields are removed and keys are sorted,
+// so exporting an unchanged app produces the same files.
+//
+// Bookmarks are exported with their properties only. Their selections can't be restored,
+// so Import doesn't create or update bookmarks, it reports them as ACTION_SKIP with a warning.
+package appsource
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/soderasen-au/go-common/util"
+	"gopkg.in/yaml.v3"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+)
+
+const (
+	FORMAT_JSON = "json"
+	FORMAT_YAML = "yaml"
+
+	APP_FILE    = "app"
+	SCRIPT_FILE = "script.qvs"
+)
+
+// Kind is a type of objects kept in Dir.
+type Kind struct {
+	Dir     string
+	Type    string
+	Generic bool // generic objects may have children
+	Export  bool // objects are exported only, Apply skips them instead of creating or updating them
+}
+
+// Kinds in import order, master items come before objects using them.
+var Kinds = []Kind{
+	{Dir: "variables", Type: "variable"},
+	{Dir: "dimensions", Type: "dimension"},
+	{Dir: "measures", Type: "measure"},
+	{Dir: "masterobjects", Type: engine.MASTER_OBJECT, Generic: true},
+	{Dir: "sheets", Type: "sheet", Generic: true},
+	{Dir: "stories", Type: engine.STORY, Generic: true},
+	{Dir: "bookmarks", Type: "bookmark", Export: true},
+}
+
+// Source is the exported content of an app.
+type Source struct {
+	App     json.RawMessage                               `json:"app,omitempty" yaml:"app,omitempty"`       // app properties
+	Script  *string                                       `json:"script,omitempty" yaml:"script,omitempty"` // nil keeps the script of the app
+	Objects map[string]map[string]*engine.ObjectPropeties `json:"objects" yaml:"objects"`                   // type => id => object
+}
+
+func NewSource() *Source {
+	return &Source{Objects: make(map[string]map[string]*engine.ObjectPropeties)}
+}
+
+// Read reads app properties, the load script and objects of Kinds from doc,
+// variables created by the script are skipped.
+func Read(ctx context.Context, doc *enigma.Doc) (*Source, *util.Result) {
+	s := NewSource()
+	appProp, err := doc.GetAppPropertiesRaw(ctx)
+	if err != nil {
+		return nil, util.Error("GetAppProperties", err)
+	}
+	var res *util.Result
+	if s.App, res = engine.RemoveVolatileProperties(appProp); res != nil {
+		return nil, res.With("RemoveVolatileProperties")
+	}
+	script, err := doc.GetScript(ctx)
+	if err != nil {
+		return nil, util.Error("GetScript", err)
+	}
+	s.Script = &script
+
+	layout, res := engine.GetSessionObjectLayoutContext(ctx, doc)
+	if res != nil {
+		return nil, res.With("GetSessionObjectLayout")
+	}
+	lists := make(map[string][]*engine.NxContainerEntry)
+	if layout.DimensionList != nil {
+		lists["dimension"] = layout.DimensionList.Items
+	}
+	if layout.MeasureList != nil {
+		lists["measure"] = layout.MeasureList.Items
+	}
+	if layout.VariableList != nil {
+		lists["variable"] = layout.VariableList.Items
+	}
+	if layout.BookmarkList != nil {
+		lists["bookmark"] = layout.BookmarkList.Items
+	}
+
+	for _, k := range Kinds {
+		entries := lists[k.Type]
+		if k.Generic {
+			if entries, err = engine.GetObjectList(doc, ctx, k.Type); err != nil {
+				return nil, util.Error("GetObjectList "+k.Type, err)
+			}
+		}
+		objects := make(map[string]*engine.ObjectPropeties, len(entries))
+		for _, e := range entries {
+			if e == nil || e.Info == nil {
+				continue
+			}
+			if k.Type == "variable" {
+				scripted, res := isScriptVariable(ctx, doc, e.Info.Id)
+				if res != nil {
+					return nil, res.With("Variable " + e.Info.Id)
+				}
+				if scripted {
+					continue
+				}
+			}
+			if e.Meta == nil {
+				e.Meta = &engine.NxMeta{}
+			}
+			prop, err := engine.RecursiveGetPropertiesContext(ctx, doc, *e)
+			if err != nil {
+				return nil, util.Error("GetProperties "+e.Info.Id, err)
+			}
+			if res := normalize(prop); res != nil {
+				return nil, res.With("Normalize " + e.Info.Id)
+			}
+			objects[e.Info.Id] = prop
+		}
+		s.Objects[k.Type] = objects
+	}
+	return s, nil
+}
+
+func isScriptVariable(ctx context.Context, doc *enigma.Doc, id string) (bool, *util.Result) {
+	v, err := doc.GetVariableById(ctx, id)
+	if err != nil {
+		return false, util.Error("GetVariableById", err)
+	}
+	layout, err := v.GetLayout(ctx)
+	if err != nil {
+		return false, util.Error("GetLayout", err)
+	}
+	return layout.IsScriptCreated, nil
+}
+
+// normalize removes volatile fields and sorts children of p, so that it can be compared.
+func normalize(p *engine.ObjectPropeties) *util.Result {
+	if res := engine.RemoveVolatileObjectProperties(p); res != nil {
+		return res
+	}
+	sortChildren(p)
+	return nil
+}
+
+func sortChildren(p *engine.ObjectPropeties) {
+	children := make([]*engine.ObjectPropeties, 0, len(p.ChildInfos))
+	for _, c := range p.ChildInfos {
+		if c != nil && c.Info != nil {
+			sortChildren(c)
+			children = append(children, c)
+		}
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].Info.Id < children[j].Info.Id })
+	p.ChildInfos = children
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+func fileName(id, format string) string {
+	return unsafeFileChars.ReplaceAllString(id, "_") + "." + format
+}
+
+func isSourceFile(name string) bool {
+	ext := filepath.Ext(name)
+	return ext == ".json" || ext == ".yaml" || ext == ".yml"
+}
+
+// Write writes s into dir in format, files of objects not in s are removed.
+func (s *Source) Write(dir, format string) *util.Result {
+	if format != FORMAT_JSON && format != FORMAT_YAML {
+		return util.MsgError("Write", "invalid format "+format)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return util.Error("MkdirAll", err)
+	}
+	if res := removeSourceFiles(dir, func(name string) bool { return strings.TrimSuffix(name, filepath.Ext(name)) == APP_FILE }); res != nil {
+		return res
+	}
+	if len(s.App) > 0 {
+		if res := writeFile(filepath.Join(dir, APP_FILE+"."+format), s.App, format); res != nil {
+			return res.With("WriteApp")
+		}
+	}
+	if s.Script != nil {
+		if err := os.WriteFile(filepath.Join(dir, SCRIPT_FILE), []byte(*s.Script), 0644); err != nil {
+			return util.Error("WriteScript", err)
+		}
+	} else if err := os.Remove(filepath.Join(dir, SCRIPT_FILE)); err != nil && !os.IsNotExist(err) {
+		return util.Error("RemoveScript", err)
+	}
+
+	for _, k := range Kinds {
+		objects := s.Objects[k.Type]
+		kindDir := filepath.Join(dir, k.Dir)
+		if res := removeSourceFiles(kindDir, func(string) bool { return true }); res != nil {
+			return res
+		}
+		if len(objects) == 0 {
+			continue
+		}
+		if err := os.MkdirAll(kindDir, 0755); err != nil {
+			return util.Error("MkdirAll", err)
+		}
+		for id, obj := range objects {
+			if res := writeFile(filepath.Join(kindDir, fileName(id, format)), obj, format); res != nil {
+				return res.With("Write " + id)
+			}
+		}
+	}
+	return nil
+}
+
+func removeSourceFiles(dir string, match func(name string) bool) *util.Result {
+	files, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return util.Error("ReadDir", err)
+	}
+	for _, f := range files {
+		if !f.IsDir() && isSourceFile(f.Name()) && match(f.Name()) {
+			if err := os.Remove(filepath.Join(dir, f.Name())); err != nil {
+				return util.Error("Remove", err)
+			}
+		}
+	}
+	return nil
+}
+
+func writeFile(path string, v any, format string) *util.Result {
+	buf, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return util.Error("EncodeJson", err)
+	}
+	if format == FORMAT_YAML {
+		var doc any
+		if err := json.Unmarshal(buf, &doc); err != nil {
+			return util.Error("ParseJson", err)
+		}
+		if buf, err = yaml.Marshal(doc); err != nil {
+			return util.Error("EncodeYaml", err)
+		}
+	} else {
+		buf = append(buf, '\n')
+	}
+	if err := os.WriteFile(path, buf, 0644); err != nil {
+		return util.Error("WriteFile", err)
+	}
+	return nil
+}
+
+// readFile reads a JSON or YAML file as JSON.
+func readFile(path string) (json.RawMessage, *util.Result) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, util.Error("ReadFile", err)
+	}
+	if filepath.Ext(path) == ".json" {
+		return buf, nil
+	}
+	var doc any
+	if err := yaml.Unmarshal(buf, &doc); err != nil {
+		return nil, util.Error("ParseYaml", err)
+	}
+	if buf, err = json.Marshal(doc); err != nil {
+		return nil, util.Error("EncodeJson", err)
+	}
+	return buf, nil
+}
+
+// Load reads a source directory written by Write, it fails if dir doesn't exist or has no source file,
+// so that a wrong dir isn't imported as an empty app.
+func Load(dir string) (*Source, *util.Result) {
+	if fi, err := os.Stat(dir); err != nil {
+		return nil, util.Error("Stat", err)
+	} else if !fi.IsDir() {
+		return nil, util.MsgError("Load", dir+" is not a directory")
+	}
+	s := NewSource()
+	found := 0
+	for _, ext := range []string{".json", ".yaml", ".yml"} {
+		path := filepath.Join(dir, APP_FILE+ext)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		buf, res := readFile(path)
+		if res != nil {
+			return nil, res.With("ReadApp")
+		}
+		if s.App, res = engine.RemoveVolatileProperties(buf); res != nil {
+			return nil, res.With("ReadApp")
+		}
+		found++
+		break
+	}
+	script, err := os.ReadFile(filepath.Join(dir, SCRIPT_FILE))
+	if err == nil {
+		s.Script = util.Ptr(string(script))
+		found++
+	} else if !os.IsNotExist(err) {
+		return nil, util.Error("ReadScript", err)
+	}
+
+	for _, k := range Kinds {
+		objects := make(map[string]*engine.ObjectPropeties)
+		s.Objects[k.Type] = objects
+		files, err := os.ReadDir(filepath.Join(dir, k.Dir))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, util.Error("ReadDir", err)
+		}
+		for _, f := range files {
+			if f.IsDir() || !isSourceFile(f.Name()) {
+				continue
+			}
+			path := filepath.Join(dir, k.Dir, f.Name())
+			buf, res := readFile(path)
+			if res != nil {
+				return nil, res.With(path)
+			}
+			var obj engine.ObjectPropeties
+			if err := json.Unmarshal(buf, &obj); err != nil {
+				return nil, util.Error("Parse "+path, err)
+			}
+			if obj.Info == nil || obj.Info.Id == "" {
+				return nil, util.MsgError("Load", path+" has no qInfo.qId")
+			}
+			obj.Info.Type = k.Type
+			if res := normalize(&obj); res != nil {
+				return nil, res.With(path)
+			}
+			objects[obj.Info.Id] = &obj
+			found++
+		}
+	}
+	if found == 0 {
+		return nil, util.MsgError("Load", "no source file in "+dir)
+	}
+	return s, nil
+}
+
+// Export writes app of doc into dir.
+func Export(ctx context.Context, doc *enigma.Doc, dir, format string) (*Source, *util.Result) {
+	s, res := Read(ctx, doc)
+	if res != nil {
+		return nil, res.With("Read")
+	}
+	if res := s.Write(dir, format); res != nil {
+		return nil, res.With("Write")
+	}
+	return s, nil
+}
+
+// Import reconciles app of doc with files in dir, see Source.Apply.
+func Import(ctx context.Context, doc *enigma.Doc, dir string, opts *ImportOptions) ([]*Change, *util.Result) {
+	s, res := Load(dir)
+	if res != nil {
+		return nil, res.With("Load")
+	}
+	return s.Apply(ctx, doc, opts)
+}
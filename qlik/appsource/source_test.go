@@ -0,0 +1,224 @@
+package appsource
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/soderasen-au/go-common/util"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+	"github.com/soderasen-au/go-qlik/qlik/engine/enginetest"
+)
+
+func readDir(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		buf, err := os.ReadFile(path)
+		rel, _ := filepath.Rel(dir, path)
+		files[rel] = string(buf)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WalkDir: %v", err)
+	}
+	return files
+}
+
+func replaceInFile(t *testing.T, path, old, new string) {
+	t.Helper()
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !strings.Contains(string(buf), old) {
+		t.Fatalf("%s doesn't contain %s", path, old)
+	}
+	if err := os.WriteFile(path, []byte(strings.ReplaceAll(string(buf), old, new)), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+}
+
+func TestExport(t *testing.T) {
+	_, doc := enginetest.OpenDoc(t, enginetest.SalesFixture())
+	for _, format := range []string{FORMAT_JSON, FORMAT_YAML} {
+		dir1, dir2 := t.TempDir(), t.TempDir()
+		if _, res := Export(engine.ConnCtx, doc, dir1, format); res != nil {
+			t.Fatalf("Export(%s): %v", format, res)
+		}
+		if _, res := Export(engine.ConnCtx, doc, dir2, format); res != nil {
+			t.Fatalf("Export(%s): %v", format, res)
+		}
+		files1, files2 := readDir(t, dir1), readDir(t, dir2)
+		for _, f := range []string{
+			APP_FILE + "." + format, SCRIPT_FILE,
+			"sheets/sheet-overview." + format, "dimensions/dim-region." + format,
+			"measures/msr-margin." + format, "variables/var-vMarginRate." + format, "bookmarks/bm-east." + format,
+		} {
+			if _, ok := files1[f]; !ok {
+				t.Errorf("Export(%s) has no %s: %v", format, f, util.JsonStr(files1))
+			}
+		}
+		if util.JsonStr(files1) != util.JsonStr(files2) {
+			t.Errorf("Export(%s) is not deterministic", format)
+		}
+		if strings.Contains(files1["sheets/sheet-overview."+format], "modifiedDate") {
+			t.Errorf("Export(%s) has volatile fields", format)
+		}
+
+		s, res := Load(dir1)
+		if res != nil {
+			t.Fatalf("Load(%s): %v", format, res)
+		}
+		if changes, res := s.Apply(engine.ConnCtx, doc, &ImportOptions{DryRun: true}); res != nil || len(changes) != 0 {
+			t.Errorf("Apply(%s) unchanged = %s, %v", format, util.JsonStr(changes), res)
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	_, doc := enginetest.OpenDoc(t, enginetest.SalesFixture())
+	dir := t.TempDir()
+	if _, res := Export(engine.ConnCtx, doc, dir, FORMAT_JSON); res != nil {
+		t.Fatalf("Export: %v", res)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "measures", "msr-margin.json")); err != nil {
+		t.Fatal(err)
+	}
+	replaceInFile(t, filepath.Join(dir, "sheets", "sheet-overview.json"), "Sales by Region", "Revenue by Region")
+	buf, err := os.ReadFile(filepath.Join(dir, "variables", "var-vTitle.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newVar := strings.ReplaceAll(string(buf), "vTitle", "vSubtitle")
+	if err := os.WriteFile(filepath.Join(dir, "variables", "var-vSubtitle.json"), []byte(newVar), 0644); err != nil {
+		t.Fatal(err)
+	}
+	replaceInFile(t, filepath.Join(dir, SCRIPT_FILE), "ThousandSep=','", "ThousandSep=' '")
+
+	want := []Change{
+		{Action: ACTION_UPDATE, Type: TYPE_SCRIPT},
+		{Action: ACTION_CREATE, Type: "variable", Id: "var-vSubtitle"},
+		{Action: ACTION_UPDATE, Type: "sheet", Id: "sheet-overview"},
+		{Action: ACTION_DELETE, Type: "measure", Id: "msr-margin"},
+	}
+	check := func(name string, changes []*Change, res *util.Result) {
+		t.Helper()
+		if res != nil {
+			t.Fatalf("%s: %v", name, res)
+		}
+		if len(changes) != len(want) {
+			t.Fatalf("%s = %s", name, util.JsonStr(changes))
+		}
+		for i, c := range changes {
+			if *c != want[i] {
+				t.Errorf("%s[%d] = %s, want %s", name, i, util.JsonStr(c), util.JsonStr(want[i]))
+			}
+		}
+	}
+
+	opts := DefaultImportOptions()
+	opts.DryRun = true
+	changes, res := Import(engine.ConnCtx, doc, dir, opts)
+	check("Import(dry run)", changes, res)
+	changes, res = Import(engine.ConnCtx, doc, dir, opts)
+	check("Import(dry run) again", changes, res)
+
+	changes, res = Import(engine.ConnCtx, doc, dir, DefaultImportOptions())
+	check("Import", changes, res)
+	if changes, res = Import(engine.ConnCtx, doc, dir, DefaultImportOptions()); res != nil || len(changes) != 0 {
+		t.Errorf("Import() again = %s, %v", util.JsonStr(changes), res)
+	}
+
+	s, res := Read(engine.ConnCtx, doc)
+	if res != nil {
+		t.Fatalf("Read: %v", res)
+	}
+	if _, ok := s.Objects["measure"]["msr-margin"]; ok {
+		t.Errorf("msr-margin is not deleted")
+	}
+	if _, ok := s.Objects["variable"]["var-vSubtitle"]; !ok {
+		t.Errorf("var-vSubtitle is not created")
+	}
+	if !strings.Contains(util.JsonStr(s.Objects["sheet"]["sheet-overview"]), "Revenue by Region") {
+		t.Errorf("sheet-overview is not updated: %s", util.JsonStr(s.Objects["sheet"]["sheet-overview"]))
+	}
+}
+
+func TestImport_WrongDir(t *testing.T) {
+	_, doc := enginetest.OpenDoc(t, enginetest.SalesFixture())
+	for _, dir := range []string{filepath.Join(t.TempDir(), "missing"), t.TempDir()} {
+		if changes, res := Import(engine.ConnCtx, doc, dir, DefaultImportOptions()); res == nil {
+			t.Errorf("Import(%s) = %s, want error", dir, util.JsonStr(changes))
+		}
+	}
+
+	dir := t.TempDir()
+	if _, res := Export(engine.ConnCtx, doc, dir, FORMAT_JSON); res != nil {
+		t.Fatalf("Export: %v", res)
+	}
+	if err := os.Remove(filepath.Join(dir, SCRIPT_FILE)); err != nil {
+		t.Fatal(err)
+	}
+	if changes, res := Import(engine.ConnCtx, doc, dir, DefaultImportOptions()); res != nil || len(changes) != 0 {
+		t.Errorf("Import() without script = %s, %v", util.JsonStr(changes), res)
+	}
+	if script, err := doc.GetScript(engine.ConnCtx); err != nil || script == "" {
+		t.Errorf("script is removed: %q, %v", script, err)
+	}
+}
+
+func TestImport_Bookmarks(t *testing.T) {
+	_, doc := enginetest.OpenDoc(t, enginetest.SalesFixture())
+	dir := t.TempDir()
+	if _, res := Export(engine.ConnCtx, doc, dir, FORMAT_JSON); res != nil {
+		t.Fatalf("Export: %v", res)
+	}
+	replaceInFile(t, filepath.Join(dir, "bookmarks", "bm-east.json"), "East region only", "Eastern region")
+	buf, err := os.ReadFile(filepath.Join(dir, "bookmarks", "bm-east.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "bookmarks", "bm-west.json"), []byte(strings.ReplaceAll(string(buf), "bm-east", "bm-west")), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, res := Import(engine.ConnCtx, doc, dir, DefaultImportOptions())
+	if res != nil {
+		t.Fatalf("Import: %v", res)
+	}
+	want := []Change{
+		{Action: ACTION_SKIP, Type: "bookmark", Id: "bm-east", Warning: "can't update bookmark with its selections"},
+		{Action: ACTION_SKIP, Type: "bookmark", Id: "bm-west", Warning: "can't create bookmark with its selections"},
+	}
+	if len(changes) != len(want) || *changes[0] != want[0] || *changes[1] != want[1] {
+		t.Fatalf("Import() = %s", util.JsonStr(changes))
+	}
+
+	s, res := Read(engine.ConnCtx, doc)
+	if res != nil {
+		t.Fatalf("Read: %v", res)
+	}
+	if _, ok := s.Objects["bookmark"]["bm-west"]; ok {
+		t.Errorf("bm-west is created")
+	}
+	if strings.Contains(util.JsonStr(s.Objects["bookmark"]["bm-east"]), "Eastern region") {
+		t.Errorf("bm-east is updated")
+	}
+
+	if err := os.Remove(filepath.Join(dir, "bookmarks", "bm-east.json")); err != nil {
+		t.Fatal(err)
+	}
+	opts := DefaultImportOptions()
+	opts.DryRun = true
+	changes, _ = Import(engine.ConnCtx, doc, dir, opts)
+	if len(changes) != 2 || *changes[1] != (Change{Action: ACTION_DELETE, Type: "bookmark", Id: "bm-east"}) {
+		t.Errorf("Import() = %s", util.JsonStr(changes))
+	}
+}
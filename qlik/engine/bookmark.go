@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 
@@ -43,10 +44,14 @@ type BookmarkEntry struct {
 }
 
 func GetBookmarks(doc *enigma.Doc) ([]*BookmarkEntry, *util.Result) {
+	return GetBookmarksContext(ConnCtx, doc)
+}
+
+func GetBookmarksContext(ctx context.Context, doc *enigma.Doc) ([]*BookmarkEntry, *util.Result) {
 	opt := &enigma.NxGetBookmarkOptions{
 		Types: []string{"bookmark"},
 	}
-	bmData, err := doc.GetBookmarksRaw(ConnCtx, opt)
+	bmData, err := doc.GetBookmarksRaw(ctx, opt)
 	if err != nil {
 		return nil, util.Error("GetBookmarks", err)
 	}
@@ -60,18 +65,57 @@ func GetBookmarks(doc *enigma.Doc) ([]*BookmarkEntry, *util.Result) {
 	return bms, nil
 }
 
+func ApplyBookmark(doc *enigma.Doc, id, title string) (string, *util.Result) {
+	return ApplyBookmarkContext(ConnCtx, doc, id, title)
+}
+
+// ApplyBookmarkContext applies bookmark `id`, or the bookmark titled `title` if id is empty,
+// it returns id of the applied bookmark or "" if both are empty.
+func ApplyBookmarkContext(ctx context.Context, doc *enigma.Doc, id, title string) (string, *util.Result) {
+	if id == "" && title != "" {
+		bms, res := GetBookmarksContext(ctx, doc)
+		if res != nil {
+			return "", res.With("GetBookmarks")
+		}
+		for _, bm := range bms {
+			if bm.Meta != nil && bm.Info != nil && bm.Meta.Title == title {
+				id = bm.Info.Id
+				break
+			}
+		}
+		if id == "" {
+			return "", util.MsgError("ApplyBookmark", "can't find bookmark "+title)
+		}
+	}
+	if id == "" {
+		return "", nil
+	}
+	ok, err := doc.ApplyBookmark(ctx, id)
+	if err != nil {
+		return "", util.Error("ApplyBookmark", err)
+	}
+	if !ok {
+		return "", util.MsgError("ApplyBookmark", "engine returned `Fail`")
+	}
+	return id, nil
+}
+
 func GetSessionBookmarks(doc *enigma.Doc) ([]SessionBookmark, *util.Result) {
+	return GetSessionBookmarksContext(ConnCtx, doc)
+}
+
+func GetSessionBookmarksContext(ctx context.Context, doc *enigma.Doc) ([]SessionBookmark, *util.Result) {
 	var prop enigma.GenericObjectProperties
 	if err := json.Unmarshal(SessionBookmarkListDef, &prop); err != nil {
 		return nil, util.Error("cretae session bookmark list definition", err)
 	}
 
-	obj, err := doc.CreateSessionObject(ConnCtx, &prop)
+	obj, err := doc.CreateSessionObject(ctx, &prop)
 	if err != nil {
 		return nil, util.Error("cretae session bookmark list", err)
 	}
 
-	layoutBuf, err := obj.GetLayoutRaw(ConnCtx)
+	layoutBuf, err := obj.GetLayoutRaw(ctx)
 	if err != nil {
 		return nil, util.Error("get session object", err)
 	}
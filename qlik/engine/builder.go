@@ -0,0 +1,436 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/soderasen-au/go-common/util"
+)
+
+const (
+	DEFAULT_SHEET_COLUMNS = 24
+	DEFAULT_SHEET_ROWS    = 12
+)
+
+// VizBuilder builds properties of a visualization from fields, expressions and master items,
+// see `NewTableBuilder`, `NewKpiBuilder`, `NewChartBuilder` and `NewFilterPaneBuilder`.
+type VizBuilder struct {
+	Type  string
+	Id    string
+	Title string
+
+	query *Query
+	extra map[string]any
+}
+
+func newVizBuilder(qtype, title string) *VizBuilder {
+	return &VizBuilder{Type: qtype, Title: title, query: NewQuery(title)}
+}
+
+func NewTableBuilder(title string) *VizBuilder {
+	return newVizBuilder("table", title)
+}
+
+func NewKpiBuilder(title string) *VizBuilder {
+	return newVizBuilder("kpi", title)
+}
+
+// NewChartBuilder builds a chart of qtype, e.g. `barchart`, `linechart` or `combochart`.
+func NewChartBuilder(qtype, title string) *VizBuilder {
+	return newVizBuilder(qtype, title)
+}
+
+// NewFilterPaneBuilder builds a filter pane with a listbox of each field or master dimension.
+func NewFilterPaneBuilder(title string, fields ...string) *VizBuilder {
+	b := newVizBuilder("filterpane", title)
+	for _, f := range fields {
+		b.Dimension(f)
+	}
+	return b
+}
+
+// WithId sets the id of the object, the engine generates one if it's empty.
+func (b *VizBuilder) WithId(id string) *VizBuilder {
+	b.Id = id
+	return b
+}
+
+func (b *VizBuilder) Dimension(field string) *VizBuilder {
+	b.query.Dimension(field)
+	return b
+}
+
+func (b *VizBuilder) MasterDimension(title string) *VizBuilder {
+	b.query.MasterDimension(title)
+	return b
+}
+
+func (b *VizBuilder) Measure(expr, label string) *VizBuilder {
+	b.query.Measure(expr, label)
+	return b
+}
+
+func (b *VizBuilder) MasterMeasure(title string) *VizBuilder {
+	b.query.MasterMeasure(title)
+	return b
+}
+
+func (b *VizBuilder) OrderBy(labels ...string) *VizBuilder {
+	b.query.OrderBy(labels...)
+	return b
+}
+
+// Set sets property key to value, overriding what the builder generates, e.g. `orientation`.
+func (b *VizBuilder) Set(key string, value any) *VizBuilder {
+	if b.extra == nil {
+		b.extra = make(map[string]any)
+	}
+	b.extra[key] = value
+	return b
+}
+
+// titleProperty returns an expression for titles starting with `=`.
+func titleProperty(title string) *StringOrExpr {
+	if title == "" {
+		return nil
+	}
+	if strings.HasPrefix(title, "=") {
+		return &StringOrExpr{Expr: title}
+	}
+	return NewStringOrExpr(title)
+}
+
+func (b *VizBuilder) vizProperties(qtype, id, title string) VisualizationProperties {
+	return VisualizationProperties{
+		Info:          &enigma.NxInfo{Id: id, Type: qtype},
+		Visualization: qtype,
+		Title:         titleProperty(title),
+	}
+}
+
+// Properties returns properties of the visualization with master items resolved in doc.
+// Listboxes of a filter pane are its children and not included, see `ListboxProperties`.
+func (b *VizBuilder) Properties(ctx context.Context, doc *enigma.Doc) (VizProperties, *util.Result) {
+	if b.Type == "kpi" && len(b.query.Measures) == 0 {
+		return nil, util.MsgError("Properties", fmt.Sprintf("kpi `%s` has no measure", b.Title))
+	}
+	def, res := b.query.HyperCubeDef(ctx, doc)
+	if res != nil {
+		return nil, res.With("HyperCubeDef")
+	}
+
+	viz := b.vizProperties(b.Type, b.Id, b.Title)
+	var props VizProperties
+	switch b.Type {
+	case "filterpane":
+		props = &FilterPaneProperties{VisualizationProperties: viz}
+	case "table":
+		viz.HyperCubeDef = def
+		props = &TableProperties{VisualizationProperties: viz}
+	case "kpi":
+		viz.HyperCubeDef = def
+		props = &KpiProperties{VisualizationProperties: viz, ShowMeasureTitle: util.Ptr(true)}
+	default:
+		viz.HyperCubeDef = def
+		props = &ChartProperties{VisualizationProperties: viz}
+	}
+	if len(b.extra) == 0 {
+		return props, nil
+	}
+
+	raw, err := json.Marshal(props)
+	if err != nil {
+		return nil, util.Error("EncodeProperties", err)
+	}
+	merged := make(map[string]any)
+	if err = json.Unmarshal(raw, &merged); err != nil {
+		return nil, util.Error("DecodeProperties", err)
+	}
+	for k, v := range b.extra {
+		merged[k] = v
+	}
+	if raw, err = json.Marshal(merged); err != nil {
+		return nil, util.Error("EncodeProperties", err)
+	}
+	return ParseVizProperties(raw)
+}
+
+// ListboxProperties returns properties of listboxes of a filter pane.
+func (b *VizBuilder) ListboxProperties(ctx context.Context, doc *enigma.Doc) ([]*ListboxProperties, *util.Result) {
+	if b.Type != "filterpane" {
+		return nil, nil
+	}
+	def, res := b.query.HyperCubeDef(ctx, doc)
+	if res != nil {
+		return nil, res.With("HyperCubeDef")
+	}
+	ret := make([]*ListboxProperties, 0, len(def.Dimensions))
+	for i, d := range def.Dimensions {
+		dim := b.query.Dimensions[i]
+		ret = append(ret, &ListboxProperties{
+			VisualizationProperties: b.vizProperties("listbox", "", dim.label()),
+			ListObjectDef: &enigma.ListObjectDef{
+				LibraryId:        d.LibraryId,
+				Def:              d.Def,
+				ShowAlternatives: true,
+			},
+		})
+	}
+	return ret, nil
+}
+
+type sheetBuilderCell struct {
+	viz                        *VizBuilder
+	col, row, colSpan, rowSpan int
+}
+
+// SheetBuilder builds a sheet and its visualizations laid out on a grid of Columns x Rows.
+type SheetBuilder struct {
+	Id          string
+	Title       string
+	Description string
+	Columns     int
+	Rows        int
+
+	cells   []*sheetBuilderCell
+	publish bool
+	approve bool
+}
+
+// SheetBuildResult has ids of the created sheet and its visualizations in the order they were added.
+type SheetBuildResult struct {
+	SheetId   string   `json:"sheet_id" yaml:"sheet_id"`
+	ObjectIds []string `json:"object_ids" yaml:"object_ids"`
+}
+
+func NewSheetBuilder(title string) *SheetBuilder {
+	return &SheetBuilder{Title: title, Columns: DEFAULT_SHEET_COLUMNS, Rows: DEFAULT_SHEET_ROWS}
+}
+
+func (b *SheetBuilder) WithId(id string) *SheetBuilder {
+	b.Id = id
+	return b
+}
+
+func (b *SheetBuilder) WithDescription(description string) *SheetBuilder {
+	b.Description = description
+	return b
+}
+
+func (b *SheetBuilder) Grid(columns, rows int) *SheetBuilder {
+	b.Columns, b.Rows = columns, rows
+	return b
+}
+
+// Add places viz at col, row of the grid, spanning colSpan columns and rowSpan rows.
+func (b *SheetBuilder) Add(viz *VizBuilder, col, row, colSpan, rowSpan int) *SheetBuilder {
+	b.cells = append(b.cells, &sheetBuilderCell{viz: viz, col: col, row: row, colSpan: colSpan, rowSpan: rowSpan})
+	return b
+}
+
+// AddRow places vizs side by side below the placed cells, sharing the width of the grid.
+func (b *SheetBuilder) AddRow(rowSpan int, vizs ...*VizBuilder) *SheetBuilder {
+	if len(vizs) == 0 {
+		return b
+	}
+	row := 0
+	for _, c := range b.cells {
+		row = max(row, c.row+c.rowSpan)
+	}
+	width := b.Columns / len(vizs)
+	for i, viz := range vizs {
+		colSpan := width
+		if i == len(vizs)-1 {
+			colSpan = b.Columns - width*i
+		}
+		b.Add(viz, width*i, row, colSpan, rowSpan)
+	}
+	return b
+}
+
+// Publish publishes the sheet once it's built.
+func (b *SheetBuilder) Publish() *SheetBuilder {
+	b.publish = true
+	return b
+}
+
+// Approve publishes and approves the sheet once it's built.
+func (b *SheetBuilder) Approve() *SheetBuilder {
+	b.publish, b.approve = true, true
+	return b
+}
+
+func (b *SheetBuilder) validate() *util.Result {
+	if b.Columns <= 0 || b.Rows <= 0 {
+		return util.MsgError("Validate", fmt.Sprintf("invalid grid %dx%d", b.Columns, b.Rows))
+	}
+	for i, c := range b.cells {
+		if c.viz == nil {
+			return util.MsgError("Validate", fmt.Sprintf("cell[%d] has no visualization", i))
+		}
+		if c.col < 0 || c.row < 0 || c.colSpan <= 0 || c.rowSpan <= 0 || c.col+c.colSpan > b.Columns || c.row+c.rowSpan > b.Rows {
+			return util.MsgError("Validate", fmt.Sprintf("cell[%d] %s is out of the %dx%d grid", i, c.viz.Title, b.Columns, b.Rows))
+		}
+	}
+	return nil
+}
+
+func (b *SheetBuilder) sheetCell(c *sheetBuilderCell, id string) *SheetCell {
+	return &SheetCell{
+		Name:    id,
+		Type:    c.viz.Type,
+		Col:     util.Ptr(c.col),
+		Row:     util.Ptr(c.row),
+		ColSpan: util.Ptr(c.colSpan),
+		RowSpan: util.Ptr(c.rowSpan),
+		Bounds: &SheetCellBounds{
+			X:      float64(c.col) * 100 / float64(b.Columns),
+			Y:      float64(c.row) * 100 / float64(b.Rows),
+			Width:  float64(c.colSpan) * 100 / float64(b.Columns),
+			Height: float64(c.rowSpan) * 100 / float64(b.Rows),
+		},
+	}
+}
+
+// Build creates the sheet and its visualizations in doc, a half built sheet is destroyed on failure.
+func (b *SheetBuilder) Build(doc *enigma.Doc) (*SheetBuildResult, *util.Result) {
+	return b.BuildContext(ConnCtx, doc)
+}
+
+func (b *SheetBuilder) BuildContext(ctx context.Context, doc *enigma.Doc) (ret *SheetBuildResult, res *util.Result) {
+	if res = b.validate(); res != nil {
+		return nil, res
+	}
+	// resolve master items before creating anything
+	props := make([]VizProperties, len(b.cells))
+	listboxes := make([][]*ListboxProperties, len(b.cells))
+	for i, c := range b.cells {
+		if props[i], res = c.viz.Properties(ctx, doc); res != nil {
+			return nil, res.With(fmt.Sprintf("cell[%d]: %s", i, c.viz.Title))
+		}
+		if listboxes[i], res = c.viz.ListboxProperties(ctx, doc); res != nil {
+			return nil, res.With(fmt.Sprintf("cell[%d]: %s", i, c.viz.Title))
+		}
+	}
+
+	sheetProps := &SheetProperties{
+		VisualizationProperties: VisualizationProperties{
+			Info:    &enigma.NxInfo{Id: b.Id, Type: "sheet"},
+			MetaDef: &MetaDef{Title: b.Title, Description: b.Description},
+			Title:   titleProperty(b.Title),
+		},
+		Columns: util.Ptr(b.Columns),
+		Rows:    util.Ptr(b.Rows),
+	}
+	sheetProps.SetRaw("qChildListDef", json.RawMessage(`{"qData":{"title":"/title"}}`))
+	sheet, err := doc.CreateObjectRaw(ctx, sheetProps)
+	if err != nil {
+		return nil, util.Error("CreateSheet", err)
+	}
+	// the half-built sheet is removed even if ctx is canceled
+	defer func() {
+		if res != nil {
+			_, _ = doc.DestroyObject(context.WithoutCancel(ctx), sheet.GenericId)
+		}
+	}()
+
+	ret = &SheetBuildResult{SheetId: sheet.GenericId, ObjectIds: make([]string, 0, len(b.cells))}
+	for i, c := range b.cells {
+		child, err := sheet.CreateChildRaw(ctx, props[i], nil)
+		if err != nil {
+			return nil, util.Error(fmt.Sprintf("CreateChild[%d]: %s", i, c.viz.Title), err)
+		}
+		for j, lb := range listboxes[i] {
+			if _, err := child.CreateChildRaw(ctx, lb, nil); err != nil {
+				return nil, util.Error(fmt.Sprintf("CreateChild[%d]: listbox[%d]", i, j), err)
+			}
+		}
+		ret.ObjectIds = append(ret.ObjectIds, child.GenericId)
+		sheetProps.Cells = append(sheetProps.Cells, b.sheetCell(c, child.GenericId))
+	}
+
+	sheetProps.Info.Id = sheet.GenericId
+	if res = SetVizPropertiesContext(ctx, sheet, sheetProps); res != nil {
+		return nil, res.With("SetSheetCells")
+	}
+	if b.publish {
+		if err = sheet.Publish(ctx); err != nil {
+			return nil, util.Error("Publish", err)
+		}
+	}
+	if b.approve {
+		if err = sheet.Approve(ctx); err != nil {
+			return nil, util.Error("Approve", err)
+		}
+	}
+	return ret, nil
+}
+
+// getObject returns object id, or an error if doc has no such object.
+func getObject(ctx context.Context, doc *enigma.Doc, id string) (*enigma.GenericObject, *util.Result) {
+	obj, err := doc.GetObject(ctx, id)
+	if err != nil {
+		return nil, util.Error("GetObject", err)
+	}
+	if obj.RemoteObject == nil || obj.Handle == 0 {
+		return nil, util.MsgError("GetObject", fmt.Sprintf("object %s not found", id))
+	}
+	return obj, nil
+}
+
+// UpdateObject calls update with typed properties of object id and sets them back if it succeeds.
+func UpdateObject(doc *enigma.Doc, id string, update func(VizProperties) *util.Result) *util.Result {
+	return UpdateObjectContext(ConnCtx, doc, id, update)
+}
+
+func UpdateObjectContext(ctx context.Context, doc *enigma.Doc, id string, update func(VizProperties) *util.Result) *util.Result {
+	obj, res := getObject(ctx, doc, id)
+	if res != nil {
+		return res
+	}
+	props, res := GetVizPropertiesContext(ctx, obj)
+	if res != nil {
+		return res.With("GetVizProperties")
+	}
+	if res = update(props); res != nil {
+		return res.With("Update")
+	}
+	if res = SetVizPropertiesContext(ctx, obj, props); res != nil {
+		return res.With("SetVizProperties")
+	}
+	return nil
+}
+
+func PublishSheet(doc *enigma.Doc, id string) *util.Result {
+	return PublishSheetContext(ConnCtx, doc, id)
+}
+
+func PublishSheetContext(ctx context.Context, doc *enigma.Doc, id string) *util.Result {
+	obj, res := getObject(ctx, doc, id)
+	if res != nil {
+		return res
+	}
+	if err := obj.Publish(ctx); err != nil {
+		return util.Error("Publish", err)
+	}
+	return nil
+}
+
+// ApproveSheet approves sheet id, which has to be published.
+func ApproveSheet(doc *enigma.Doc, id string) *util.Result {
+	return ApproveSheetContext(ConnCtx, doc, id)
+}
+
+func ApproveSheetContext(ctx context.Context, doc *enigma.Doc, id string) *util.Result {
+	obj, res := getObject(ctx, doc, id)
+	if res != nil {
+		return res
+	}
+	if err := obj.Approve(ctx); err != nil {
+		return util.Error("Approve", err)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package engine_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/soderasen-au/go-common/util"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+	"github.com/soderasen-au/go-qlik/qlik/engine/enginetest"
+)
+
+func TestFake_SheetBuilder(t *testing.T) {
+	_, doc := enginetest.OpenDoc(t, enginetest.SalesFixture())
+	ctx := engine.ConnCtx
+
+	sheet := engine.NewSheetBuilder("Data Quality").
+		WithDescription("generated").
+		AddRow(4,
+			engine.NewKpiBuilder("Sales").MasterMeasure("Total Sales"),
+			engine.NewKpiBuilder("='Rows ' & Count(Region)").Measure("Count(Region)", "Rows"),
+			engine.NewFilterPaneBuilder("Filters", "Region").MasterDimension("dim-product"),
+		).
+		AddRow(8,
+			engine.NewTableBuilder("Sales by Region").WithId("dq-table").Dimension("Region").MasterMeasure("Total Sales").OrderBy("-Total Sales"),
+			engine.NewChartBuilder("barchart", "Margin").MasterDimension("dim-product").MasterMeasure("msr-margin").Set("orientation", "horizontal"),
+		).
+		Approve()
+	ret, res := sheet.Build(doc)
+	if res != nil {
+		t.Fatalf("Build: %v", res)
+	}
+	if len(ret.ObjectIds) != 5 || ret.ObjectIds[3] != "dq-table" {
+		t.Fatalf("result = %s", util.JsonStr(ret))
+	}
+
+	obj, err := doc.GetObject(ctx, ret.SheetId)
+	if err != nil {
+		t.Fatalf("GetObject: %v", err)
+	}
+	props, res := engine.GetVizProperties(obj)
+	if res != nil {
+		t.Fatalf("GetVizProperties: %v", res)
+	}
+	sp := props.(*engine.SheetProperties)
+	if sp.GetTitle() != "Data Quality" || sp.GetDescription() != "generated" ||
+		strings.Join(sp.CellIds(), ",") != strings.Join(ret.ObjectIds, ",") {
+		t.Errorf("sheet = %s", util.JsonStr(sp))
+	}
+	if c := sp.Cells[2]; *c.Col != 16 || *c.ColSpan != 8 || *c.Row != 0 || c.Bounds.Height != 100.0/3 {
+		t.Errorf("filter pane cell = %s", util.JsonStr(c))
+	}
+	if c := sp.Cells[4]; *c.Col != 12 || *c.Row != 4 || *c.RowSpan != 8 || c.Bounds.Width != 50 {
+		t.Errorf("chart cell = %s", util.JsonStr(c))
+	}
+
+	layout, err := obj.GetLayoutRaw(ctx)
+	if err != nil {
+		t.Fatalf("GetLayout: %v", err)
+	}
+	var meta struct {
+		Meta struct {
+			Published bool `json:"published"`
+			Approved  bool `json:"approved"`
+		} `json:"qMeta"`
+	}
+	if err = json.Unmarshal(layout, &meta); err != nil || !meta.Meta.Published || !meta.Meta.Approved {
+		t.Errorf("meta = %s", layout)
+	}
+
+	children := make(map[string]engine.VizProperties)
+	for _, id := range ret.ObjectIds {
+		child, err := doc.GetObject(ctx, id)
+		if err != nil {
+			t.Fatalf("GetObject: %v", err)
+		}
+		if children[id], res = engine.GetVizProperties(child); res != nil {
+			t.Fatalf("GetVizProperties: %v", res)
+		}
+		if id == ret.ObjectIds[2] {
+			infos, err := child.GetChildInfos(ctx)
+			if err != nil || len(infos) != 2 {
+				t.Errorf("listboxes = %s, %v", util.JsonStr(infos), err)
+			}
+		}
+	}
+	if kpi := children[ret.ObjectIds[0]]; kpi.GetMeasures()[0].LibraryId == "" {
+		t.Errorf("kpi = %s", util.JsonStr(kpi))
+	}
+	if kpi := children[ret.ObjectIds[1]].(*engine.KpiProperties); kpi.Title.Expr != "='Rows ' & Count(Region)" {
+		t.Errorf("kpi title = %s", util.JsonStr(kpi.Title))
+	}
+	if table := children["dq-table"]; len(table.GetDimensions()) != 1 || table.GetMeasures()[0].SortBy.SortByNumeric != -1 {
+		t.Errorf("table = %s", util.JsonStr(table))
+	}
+	if chart := children[ret.ObjectIds[4]].(*engine.ChartProperties); chart.Orientation != "horizontal" ||
+		chart.GetDimensions()[0].LibraryId != "dim-product" || chart.GetMeasures()[0].LibraryId != "msr-margin" {
+		t.Errorf("chart = %s", util.JsonStr(chart))
+	}
+
+	res = engine.UpdateObject(doc, "dq-table", func(p engine.VizProperties) *util.Result {
+		p.(*engine.TableProperties).Title = engine.NewStringOrExpr("Sales")
+		return nil
+	})
+	if res != nil {
+		t.Fatalf("UpdateObject: %v", res)
+	}
+	table, _ := doc.GetObject(ctx, "dq-table")
+	if p, _ := engine.GetVizProperties(table); p.GetTitle() != "Sales" || len(p.GetMeasures()) != 1 {
+		t.Errorf("updated = %s", util.JsonStr(p))
+	}
+	if res := engine.UpdateObject(doc, "missing", func(engine.VizProperties) *util.Result { return nil }); res == nil {
+		t.Errorf("UpdateObject of missing object succeeded")
+	}
+}
+
+func TestFake_SheetBuilder_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		sheet *engine.SheetBuilder
+	}{
+		{"unknown master", engine.NewSheetBuilder("s").WithId("bad").AddRow(4, engine.NewTableBuilder("t").Dimension("Region").MasterMeasure("Unknown"))},
+		{"kpi without measure", engine.NewSheetBuilder("s").WithId("bad").AddRow(4, engine.NewKpiBuilder("k").Dimension("Region"))},
+		{"out of grid", engine.NewSheetBuilder("s").WithId("bad").Add(engine.NewTableBuilder("t").Dimension("Region"), 20, 0, 8, 4)},
+		{"failed child", engine.NewSheetBuilder("s").WithId("bad").
+			AddRow(4, engine.NewTableBuilder("t").WithId("tbl-sales").Dimension("Region"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, doc := enginetest.OpenDoc(t, enginetest.SalesFixture())
+			if _, res := tt.sheet.Build(doc); res == nil {
+				t.Fatalf("Build succeeded")
+			}
+			obj, err := doc.GetObject(engine.ConnCtx, "bad")
+			if err == nil && obj.RemoteObject != nil && obj.Handle != 0 {
+				t.Errorf("sheet wasn't destroyed")
+			}
+		})
+	}
+}
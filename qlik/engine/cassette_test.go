@@ -0,0 +1,55 @@
+package engine_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/soderasen-au/go-common/loggers"
+	"github.com/soderasen-au/go-common/util"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+	"github.com/soderasen-au/go-qlik/qlik/engine/enginetest"
+	"github.com/soderasen-au/go-qlik/qlik/replay"
+)
+
+// TestAppSnapshotDiff_Cassette replays a session recorded from the fake engine,
+// run with QLIK_REPLAY_RECORD=1 to record it again after changing the requests of the walk.
+func TestAppSnapshotDiff_Cassette(t *testing.T) {
+	doc := replay.OpenDoc(t, enginetest.SalesFixture(), filepath.Join("testdata", "cassettes", "snapshot_diff.json"))
+	cfg := engine.MixedConfig{AppId: "sales"}
+	opts := engine.DefaultWalkOptions()
+	opts.OpendocRetries = 0
+
+	from, res := engine.RecursiveGetSnapshots(doc, cfg, opts, loggers.NullLogger)
+	if res != nil {
+		t.Fatalf("RecursiveGetSnapshots: %v", res)
+	}
+	res = engine.UpdateObject(doc, "tbl-sales", func(p engine.VizProperties) *util.Result {
+		p.(*engine.TableProperties).Title = engine.NewStringOrExpr("Sales by Product")
+		return nil
+	})
+	if res != nil {
+		t.Fatalf("UpdateObject: %v", res)
+	}
+	to, res := engine.RecursiveGetSnapshots(doc, cfg, opts, loggers.NullLogger)
+	if res != nil {
+		t.Fatalf("RecursiveGetSnapshots: %v", res)
+	}
+
+	diff, res := engine.AppSnapshotDiff(from, to)
+	if res != nil {
+		t.Fatalf("AppSnapshotDiff: %v", res)
+	}
+	changed := make(map[string]*util.Diff)
+	for _, list := range diff {
+		for id, obj := range list {
+			changed[id] = obj.Result
+		}
+	}
+	if d := changed["tbl-sales"]; len(changed) != 1 || d == nil || d.Path != "Title" {
+		t.Errorf("diff = %s", util.JsonStr(diff))
+	}
+	if same, res := engine.AppSnapshotDiff(from, from); res != nil || len(engine.FlattenList(same[engine.SHEET_LIST])) != 0 {
+		t.Errorf("AppSnapshotDiff(from, from) = %s, %v", util.JsonStr(same), res)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/google/uuid"
+	"github.com/qlik-oss/enigma-go/v4"
 	"github.com/rs/zerolog"
 	"github.com/soderasen-au/go-common/crypto"
 	"github.com/soderasen-au/go-common/loggers"
@@ -48,8 +49,10 @@ type Config struct {
 	JWT                string              `json:"jwt,omitempty" yaml:"jwt,omitempty" bson:"jwt,omitempty"`
 	Certs              crypto.Certificates `json:"certs,omitempty" yaml:"certs,omitempty" bson:"certs,omitempty"`
 	RandomProxySession bool                `json:"random_proxy_session" yaml:"random_proxy_session" bson:"random_proxy_session"`
+	Weight             int                 `json:"weight,omitempty" yaml:"weight,omitempty" bson:"weight,omitempty"` // relative weight of the node in a Cluster, 0 means 1
 
-	Cookie http.CookieJar `json:"-" yaml:"-" bson:"-"` // used when connect to cloud
+	Cookie     http.CookieJar       `json:"-" yaml:"-" bson:"-"` // used when connect to cloud
+	DialerHook func(*enigma.Dialer) `json:"-" yaml:"-" bson:"-"` // adjusts the dialer of every connection, e.g. to record or replay traffic
 }
 
 func (cfg *Config) QCSEngineURIAppendAppID(appid string) *util.Result {
@@ -124,6 +127,10 @@ const (
 	HashAppMethod  string = "hash_app"
 	HashUserMethod string = "hash_user"
 	InMemAppMethod string = "in_mem_app"
+
+	// LeastLoadedMethod needs live health info, it's only supported by ClusterRouter,
+	// `Cluster.PickOneFor` picks a random node instead and NewConnFromCluster fails.
+	LeastLoadedMethod string = "least_loaded"
 )
 
 type Cluster struct {
@@ -150,7 +157,7 @@ func (c Cluster) PickOneFor(appid, uid string) *Config {
 	ret := c.Nodes[0]
 	hasher := fnv.New32a()
 	switch c.Method {
-	case RandomMethod:
+	case RandomMethod, LeastLoadedMethod:
 		ret = c.Nodes[rand.Intn(nodeLen)]
 	case HashAppMethod:
 		if len(appid) > 0 {
@@ -21,6 +21,7 @@ import (
 
 var (
 	// ConnCtx is used for Engine requests per session/connection;
+	// functions with `Context` suffix take their own context instead.
 	ConnCtx context.Context
 )
 
@@ -30,14 +31,21 @@ type Conn struct {
 	Cfg    Config         `json:"config"`
 }
 
-func newCertConn(cfg Config) (con *Conn, err error) {
+func (cfg Config) dialer(d enigma.Dialer) enigma.Dialer {
+	if cfg.DialerHook != nil {
+		cfg.DialerHook(&d)
+	}
+	return d
+}
+
+func newCertConn(ctx context.Context, cfg Config) (con *Conn, err error) {
 	headers := make(http.Header, 1)
 	headers.Set("X-Qlik-User", fmt.Sprintf("UserDirectory=%s; UserId=%s", cfg.UserDirectory, cfg.UserName))
 	tlsConfig, res := cfg.Certs.NewTlsConfig()
 	if res != nil {
 		return nil, res.With("NewTlsConfig")
 	}
-	global, err := enigma.Dialer{TLSClientConfig: tlsConfig}.Dial(ConnCtx, cfg.EngineURI, headers)
+	global, err := cfg.dialer(enigma.Dialer{TLSClientConfig: tlsConfig}).Dial(ctx, cfg.EngineURI, headers)
 	if err != nil {
 		return nil, errors.New(fmt.Sprintln("Could not connect", err))
 	}
@@ -48,7 +56,7 @@ func newCertConn(cfg Config) (con *Conn, err error) {
 	return &conn, nil
 }
 
-func newJwtConn(cfg Config) (con *Conn, err error) {
+func newJwtConn(ctx context.Context, cfg Config) (con *Conn, err error) {
 	if cfg.JWT == "" {
 		jwtPayload := qlik.JwtClaim{
 			UserID:        &cfg.UserName,
@@ -66,7 +74,7 @@ func newJwtConn(cfg Config) (con *Conn, err error) {
 	headers := make(http.Header, 1)
 	headers.Set("Authorization", fmt.Sprintf("Bearer %s", cfg.JWT))
 
-	global, err := enigma.Dialer{Jar: cfg.Cookie, TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}.Dial(ConnCtx, cfg.EngineURI, headers)
+	global, err := cfg.dialer(enigma.Dialer{Jar: cfg.Cookie, TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}).Dial(ctx, cfg.EngineURI, headers)
 	if err != nil {
 		return nil, errors.New(fmt.Sprintln("Could not connect", err))
 	}
@@ -77,8 +85,8 @@ func newJwtConn(cfg Config) (con *Conn, err error) {
 	return &conn, nil
 }
 
-func newDesktopConn(cfg Config) (con *Conn, err error) {
-	global, err := enigma.Dialer{}.Dial(ConnCtx, cfg.EngineURI, nil)
+func newDesktopConn(ctx context.Context, cfg Config) (con *Conn, err error) {
+	global, err := cfg.dialer(enigma.Dialer{}).Dial(ctx, cfg.EngineURI, nil)
 	if err != nil {
 		return nil, errors.New(fmt.Sprintln("Could not connect", err))
 	}
@@ -91,6 +99,11 @@ func newDesktopConn(cfg Config) (con *Conn, err error) {
 
 // NewConn creates a Engine wss according to cfg.
 func NewConn(cfg Config) (con *Conn, err error) {
+	return NewConnContext(ConnCtx, cfg)
+}
+
+// NewConnContext is NewConn with ctx bounding the dialing, requests of the connection are not bound to it.
+func NewConnContext(ctx context.Context, cfg Config) (con *Conn, err error) {
 	res := cfg.QCSEngineURIAppendAppID(cfg.AppID)
 	if res != nil {
 		return nil, res
@@ -98,17 +111,21 @@ func NewConn(cfg Config) (con *Conn, err error) {
 
 	switch authMode := strings.ToLower(string(cfg.AuthMode)); authMode {
 	case "cert":
-		return newCertConn(cfg)
+		return newCertConn(ctx, cfg)
 	case "jwt":
-		return newJwtConn(cfg)
+		return newJwtConn(ctx, cfg)
 	case "desktop":
-		return newDesktopConn(cfg)
+		return newDesktopConn(ctx, cfg)
 	}
 
 	return nil, errors.New("invalid auth mode in config")
 }
 
 func NewConnFromRAC(c *rac.RestApiClient, appId string) (*Conn, *util.Result) {
+	return NewConnFromRACContext(ConnCtx, c, appId)
+}
+
+func NewConnFromRACContext(ctx context.Context, c *rac.RestApiClient, appId string) (*Conn, *util.Result) {
 	config := Config{ServerType: ST_ON_PREM}
 	if c.IsCloud() {
 		config.ServerType = ST_CLOUD
@@ -175,7 +192,7 @@ func NewConnFromRAC(c *rac.RestApiClient, appId string) (*Conn, *util.Result) {
 		config.Certs = *c.Config.Auth.Certs
 	}
 
-	conn, err := NewConn(config)
+	conn, err := NewConnContext(ctx, config)
 	if err != nil {
 		return nil, util.Error("NewConn", err)
 	}
@@ -185,8 +202,20 @@ func NewConnFromRAC(c *rac.RestApiClient, appId string) (*Conn, *util.Result) {
 }
 
 func NewConnFromCluster(c *Cluster, appId string) (*Conn, *util.Result) {
+	return NewConnFromClusterContext(ConnCtx, c, appId)
+}
+
+// NewConnFromClusterContext connects to a node picked by `Cluster.PickOneFor`,
+// `least_loaded` is rejected as it needs a ClusterRouter.
+func NewConnFromClusterContext(ctx context.Context, c *Cluster, appId string) (*Conn, *util.Result) {
+	if c.Method == LeastLoadedMethod {
+		return nil, util.MsgError("PickNode", "method least_loaded is only supported by ClusterRouter")
+	}
 	cfg := c.PickOneFor(appId, "")
-	conn, err := NewConn(*cfg)
+	if cfg == nil {
+		return nil, util.MsgError("PickNode", "no node in cluster")
+	}
+	conn, err := NewConnContext(ctx, *cfg)
 	if err != nil {
 		return nil, util.Error("NewConn", err)
 	}
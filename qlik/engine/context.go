@@ -0,0 +1,41 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/soderasen-au/go-common/util"
+)
+
+// Functions with `Context` suffix send engine requests with ctx, so that callers can cancel them or set deadlines.
+// Their ctx-less versions use the package-level ConnCtx.
+
+// groupResult returns the *util.Result that failed an errgroup, or wraps err if it's not one.
+func groupResult(err error) *util.Result {
+	var res *util.Result
+	if errors.As(err, &res) {
+		return res
+	}
+	return util.Error("errgroup", err)
+}
+
+// ctxResult returns an error result if ctx is done.
+func ctxResult(ctx context.Context, key string) *util.Result {
+	if err := ctx.Err(); err != nil {
+		return util.Error(key, err)
+	}
+	return nil
+}
+
+// sleepContext sleeps d or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) *util.Result {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return util.Error("Sleep", ctx.Err())
+	case <-t.C:
+		return nil
+	}
+}
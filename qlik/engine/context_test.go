@@ -0,0 +1,76 @@
+package engine
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/soderasen-au/go-common/loggers"
+	"github.com/soderasen-au/go-common/util"
+)
+
+func TestGroupResult(t *testing.T) {
+	res := util.MsgError("page[3]", "engine closed")
+	if got := groupResult(res); got != res {
+		t.Errorf("groupResult should return the failed result, got %v", got)
+	}
+	if got := groupResult(context.Canceled); got == nil || !strings.Contains(got.Error(), "canceled") {
+		t.Errorf("groupResult(context.Canceled) = %v", got)
+	}
+}
+
+func TestSleepContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	started := time.Now()
+	if res := sleepContext(ctx, time.Minute); res == nil {
+		t.Error("sleep should fail when ctx is cancelled")
+	}
+	if time.Since(started) > 5*time.Second {
+		t.Error("sleep is not interrupted by ctx")
+	}
+	if res := sleepContext(context.Background(), time.Millisecond); res != nil {
+		t.Errorf("sleepContext: %s", res.Error())
+	}
+}
+
+func TestRecurWalkObject_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	called := false
+	walker := func(e ObjWalkEntry) (*ObjWalkResult[string], *util.Result) {
+		called = true
+		return &ObjWalkResult[string]{Info: e.Info}, nil
+	}
+	info := &enigma.NxInfo{Id: "obj1", Type: "table"}
+	opts := DefaultWalkOptions()
+	opts.IgnoreError = true
+	e := ObjWalkEntry{
+		Ctx:         ctx,
+		WalkOptions: opts,
+		Item:        &NxContainerEntry{Info: info},
+		Info:        info,
+		Logger:      loggers.NullLogger,
+	}
+
+	for name, walk := range map[string]ObjWalkFunc[string]{
+		"async": NewRecurObjWalkFunc[string](walker),
+		"sync":  NewRecurObjWalkFuncSync[string](walker),
+	} {
+		obj, res := walk(e)
+		if res == nil || obj != nil {
+			t.Errorf("%s: cancelled walk should fail even if errors are ignored", name)
+		} else if !strings.Contains(res.Error(), "canceled") {
+			t.Errorf("%s: unexpected error %s", name, res.Error())
+		}
+	}
+	if called {
+		t.Error("walker should not be called after ctx is cancelled")
+	}
+}
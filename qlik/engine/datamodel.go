@@ -0,0 +1,414 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/soderasen-au/go-common/util"
+)
+
+const (
+	DEFAULT_DATA_MODEL_SAMPLE_ROWS = 5
+
+	KEY_TYPE_NOT_KEY = "NOT_KEY"
+)
+
+type DataModelOptions struct {
+	SampleRows     int  `json:"sample_rows" yaml:"sample_rows"` // rows of each table by GetTableData, 0 for none
+	IncludeSysVars bool `json:"include_sys_vars" yaml:"include_sys_vars"`
+}
+
+func DefaultDataModelOptions() *DataModelOptions {
+	return &DataModelOptions{SampleRows: DEFAULT_DATA_MODEL_SAMPLE_ROWS}
+}
+
+// DataModelField is a field by GetFieldDescription.
+type DataModelField struct {
+	Name       string   `json:"name" yaml:"name"`
+	Tables     []string `json:"tables" yaml:"tables"`
+	Cardinal   int      `json:"cardinal" yaml:"cardinal"`
+	TotalCount int      `json:"total_count" yaml:"total_count"`
+	Tags       []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Comment    string   `json:"comment,omitempty" yaml:"comment,omitempty"`
+	ByteSize   int      `json:"byte_size" yaml:"byte_size"`
+	IsNumeric  bool     `json:"is_numeric" yaml:"is_numeric"`
+	IsHidden   bool     `json:"is_hidden,omitempty" yaml:"is_hidden,omitempty"`
+	IsSystem   bool     `json:"is_system,omitempty" yaml:"is_system,omitempty"`
+	IsKey      bool     `json:"is_key,omitempty" yaml:"is_key,omitempty"`
+}
+
+// DataModelTableField is a field in a table by GetTablesAndKeys.
+type DataModelTableField struct {
+	Name               string  `json:"name" yaml:"name"`
+	KeyType            string  `json:"key_type" yaml:"key_type"` // NOT_KEY, ANY_KEY, PRIMARY_KEY or PERFECT_KEY
+	NonNulls           int     `json:"non_nulls" yaml:"non_nulls"`
+	Rows               int     `json:"rows" yaml:"rows"`
+	DistinctValues     int     `json:"distinct_values" yaml:"distinct_values"`
+	HasNull            bool    `json:"has_null,omitempty" yaml:"has_null,omitempty"`
+	HasDuplicates      bool    `json:"has_duplicates,omitempty" yaml:"has_duplicates,omitempty"`
+	InformationDensity float64 `json:"information_density" yaml:"information_density"`
+	SubsetRatio        float64 `json:"subset_ratio" yaml:"subset_ratio"`
+}
+
+type DataModelTable struct {
+	Name      string                 `json:"name" yaml:"name"`
+	Rows      int                    `json:"rows" yaml:"rows"`
+	Comment   string                 `json:"comment,omitempty" yaml:"comment,omitempty"`
+	Tags      []string               `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Loose     bool                   `json:"loose,omitempty" yaml:"loose,omitempty"` // loosely coupled to break a circular reference
+	Synthetic bool                   `json:"synthetic,omitempty" yaml:"synthetic,omitempty"`
+	Fields    []*DataModelTableField `json:"fields" yaml:"fields"`
+	Sample    [][]string             `json:"sample,omitempty" yaml:"sample,omitempty"` // first rows in order of Fields
+}
+
+// DataModelKey links Tables by Fields, a key of more than one field is a synthetic key.
+type DataModelKey struct {
+	Fields    []string `json:"fields" yaml:"fields"`
+	Tables    []string `json:"tables" yaml:"tables"`
+	Synthetic bool     `json:"synthetic,omitempty" yaml:"synthetic,omitempty"`
+}
+
+// CircularReference is a set of tables linked by Keys in a loop.
+type CircularReference struct {
+	Tables []string `json:"tables" yaml:"tables"`
+	Keys   []string `json:"keys" yaml:"keys"` // key fields, `+` joins fields of a synthetic key
+}
+
+// DataModel is the source view of the data model of an app, where synthetic keys are not resolved into `$Syn` tables.
+type DataModel struct {
+	Tables             []*DataModelTable    `json:"tables" yaml:"tables"`
+	Fields             []*DataModelField    `json:"fields" yaml:"fields"`
+	Keys               []*DataModelKey      `json:"keys" yaml:"keys"`
+	CircularReferences []*CircularReference `json:"circular_references" yaml:"circular_references"`
+}
+
+func GetDataModel(doc *enigma.Doc, opts *DataModelOptions) (*DataModel, *util.Result) {
+	return GetDataModelContext(ConnCtx, doc, opts)
+}
+
+func GetDataModelContext(ctx context.Context, doc *enigma.Doc, opts *DataModelOptions) (*DataModel, *util.Result) {
+	if opts == nil {
+		opts = DefaultDataModelOptions()
+	}
+	window := &enigma.Size{Cx: 1000, Cy: 1000}
+	tables, keys, err := doc.GetTablesAndKeys(ctx, window, &enigma.Size{}, 0, false, opts.IncludeSysVars, false)
+	if err != nil {
+		return nil, util.Error("GetTablesAndKeys", err)
+	}
+
+	m := &DataModel{
+		Tables:             make([]*DataModelTable, 0, len(tables)),
+		Fields:             make([]*DataModelField, 0),
+		Keys:               make([]*DataModelKey, 0, len(keys)),
+		CircularReferences: make([]*CircularReference, 0),
+	}
+	keyFields := make(map[string]bool)
+	for _, k := range keys {
+		if k == nil {
+			continue
+		}
+		m.Keys = append(m.Keys, &DataModelKey{Fields: k.KeyFields, Tables: k.Tables, Synthetic: len(k.KeyFields) > 1})
+		for _, f := range k.KeyFields {
+			keyFields[f] = true
+		}
+	}
+
+	fieldNames := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, t := range tables {
+		if t == nil {
+			continue
+		}
+		tbl := &DataModelTable{
+			Name:      t.Name,
+			Rows:      t.NoOfRows,
+			Comment:   t.Comment,
+			Tags:      t.TableTags,
+			Loose:     t.Loose,
+			Synthetic: t.IsSynthetic,
+			Fields:    make([]*DataModelTableField, 0, len(t.Fields)),
+		}
+		for _, f := range t.Fields {
+			if f == nil {
+				continue
+			}
+			tbl.Fields = append(tbl.Fields, &DataModelTableField{
+				Name:               f.Name,
+				KeyType:            f.KeyType,
+				NonNulls:           f.NNonNulls,
+				Rows:               f.NRows,
+				DistinctValues:     f.NTotalDistinctValues,
+				HasNull:            f.HasNull,
+				HasDuplicates:      f.HasDuplicates,
+				InformationDensity: float64(f.InformationDensity),
+				SubsetRatio:        float64(f.SubsetRatio),
+			})
+			if f.KeyType != "" && f.KeyType != KEY_TYPE_NOT_KEY {
+				keyFields[f.Name] = true
+			}
+			if !seen[f.Name] {
+				seen[f.Name] = true
+				fieldNames = append(fieldNames, f.Name)
+			}
+		}
+		if opts.SampleRows > 0 {
+			rows, err := doc.GetTableData(ctx, 0, opts.SampleRows, false, t.Name)
+			if err != nil {
+				return nil, util.Error("GetTableData "+t.Name, err)
+			}
+			tbl.Sample = make([][]string, 0, len(rows))
+			for _, r := range rows {
+				row := make([]string, len(r.Value))
+				for i, v := range r.Value {
+					if v != nil {
+						row[i] = v.Text
+					}
+				}
+				tbl.Sample = append(tbl.Sample, row)
+			}
+		}
+		m.Tables = append(m.Tables, tbl)
+	}
+
+	sort.Strings(fieldNames)
+	for _, name := range fieldNames {
+		d, err := doc.GetFieldDescription(ctx, name)
+		if err != nil {
+			return nil, util.Error("GetFieldDescription "+name, err)
+		}
+		m.Fields = append(m.Fields, &DataModelField{
+			Name:       name,
+			Tables:     d.SrcTables,
+			Cardinal:   d.Cardinal,
+			TotalCount: d.TotalCount,
+			Tags:       d.Tags,
+			Comment:    d.Comment,
+			ByteSize:   d.ByteSize,
+			IsNumeric:  d.IsNumeric,
+			IsHidden:   d.IsHidden,
+			IsSystem:   d.IsSystem,
+			IsKey:      keyFields[name],
+		})
+	}
+	m.CircularReferences = m.findCircularReferences()
+	return m, nil
+}
+
+func (m *DataModel) Table(name string) *DataModelTable {
+	for _, t := range m.Tables {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+func (m *DataModel) Field(name string) *DataModelField {
+	for _, f := range m.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+func (m *DataModel) SyntheticKeys() []*DataModelKey {
+	ret := make([]*DataModelKey, 0)
+	for _, k := range m.Keys {
+		if k.Synthetic {
+			ret = append(ret, k)
+		}
+	}
+	return ret
+}
+
+func (k *DataModelKey) Name() string {
+	return strings.Join(k.Fields, "+")
+}
+
+// findCircularReferences returns loops of the graph of tables and keys: nodes linked to
+// at most one other node are removed until there's none, what's left is in loops.
+func (m *DataModel) findCircularReferences() []*CircularReference {
+	tableNode := func(t string) string { return "t:" + t }
+	keyIndex := make(map[string]int)
+	keyNode := func(i int) string {
+		n := fmt.Sprintf("k:%d", i)
+		keyIndex[n] = i
+		return n
+	}
+	edges := make(map[string]map[string]bool)
+	link := func(a, b string) {
+		if edges[a] == nil {
+			edges[a] = make(map[string]bool)
+		}
+		if edges[b] == nil {
+			edges[b] = make(map[string]bool)
+		}
+		edges[a][b], edges[b][a] = true, true
+	}
+	for i, k := range m.Keys {
+		for _, t := range k.Tables {
+			link(keyNode(i), tableNode(t))
+		}
+	}
+
+	for removed := true; removed; {
+		removed = false
+		for n, linked := range edges {
+			if len(linked) <= 1 {
+				for other := range linked {
+					delete(edges[other], n)
+				}
+				delete(edges, n)
+				removed = true
+			}
+		}
+	}
+
+	ret := make([]*CircularReference, 0)
+	visited := make(map[string]bool)
+	nodes := make([]string, 0, len(edges))
+	for n := range edges {
+		nodes = append(nodes, n)
+	}
+	sort.Strings(nodes)
+	for _, start := range nodes {
+		if visited[start] {
+			continue
+		}
+		ref := &CircularReference{Tables: make([]string, 0), Keys: make([]string, 0)}
+		stack := []string{start}
+		visited[start] = true
+		for len(stack) > 0 {
+			n := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if t, ok := strings.CutPrefix(n, "t:"); ok {
+				ref.Tables = append(ref.Tables, t)
+			} else {
+				ref.Keys = append(ref.Keys, m.Keys[keyIndex[n]].Name())
+			}
+			for other := range edges[n] {
+				if !visited[other] {
+					visited[other] = true
+					stack = append(stack, other)
+				}
+			}
+		}
+		sort.Strings(ref.Tables)
+		sort.Strings(ref.Keys)
+		ret = append(ret, ref)
+	}
+	return ret
+}
+
+// inCircularReference returns if key is in a loop.
+func (m *DataModel) inCircularReference(k *DataModelKey) bool {
+	for _, ref := range m.CircularReferences {
+		for _, name := range ref.Keys {
+			if name == k.Name() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (m *DataModel) WriteJSON(w io.Writer) *util.Result {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(m); err != nil {
+		return util.Error("EncodeDataModel", err)
+	}
+	return nil
+}
+
+var dotRecordEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "{", `\{`, "}", `\}`, "|", `\|`, "<", `\<`, ">", `\>`)
+
+// WriteDot writes m as a Graphviz graph, tables are records of their fields and keys are edges.
+// Synthetic keys are bold and keys in circular references are red.
+func (m *DataModel) WriteDot(w io.Writer) *util.Result {
+	var sb strings.Builder
+	sb.WriteString("graph datamodel {\n  rankdir=LR;\n  node [shape=record, fontname=\"Helvetica\"];\n")
+	for _, t := range m.Tables {
+		fields := make([]string, 0, len(t.Fields))
+		for _, f := range t.Fields {
+			fields = append(fields, dotRecordEscaper.Replace(f.Name)+`\l`)
+		}
+		label := fmt.Sprintf("{%s\\n%d rows|%s}", dotRecordEscaper.Replace(t.Name), t.Rows, strings.Join(fields, ""))
+		style := ""
+		if t.Loose {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(&sb, "  %q [label=\"%s\"%s];\n", t.Name, label, style)
+	}
+	for _, k := range m.Keys {
+		attrs := []string{fmt.Sprintf("label=%q", k.Name())}
+		if k.Synthetic {
+			attrs = append(attrs, "style=bold")
+		}
+		if m.inCircularReference(k) {
+			attrs = append(attrs, "color=red")
+		}
+		for i := 0; i < len(k.Tables); i++ {
+			for j := i + 1; j < len(k.Tables); j++ {
+				fmt.Fprintf(&sb, "  %q -- %q [%s];\n", k.Tables[i], k.Tables[j], strings.Join(attrs, ", "))
+			}
+		}
+	}
+	sb.WriteString("}\n")
+	if _, err := io.WriteString(w, sb.String()); err != nil {
+		return util.Error("WriteDot", err)
+	}
+	return nil
+}
+
+var mermaidUnsafeChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+func mermaidName(s string) string {
+	return mermaidUnsafeChars.ReplaceAllString(s, "_")
+}
+
+// WriteMermaid writes m as a Mermaid entity relationship diagram, names are made of word characters.
+func (m *DataModel) WriteMermaid(w io.Writer) *util.Result {
+	var sb strings.Builder
+	sb.WriteString("erDiagram\n")
+	for _, t := range m.Tables {
+		fmt.Fprintf(&sb, "    %s {\n", mermaidName(t.Name))
+		for _, f := range t.Fields {
+			typ := "text"
+			if field := m.Field(f.Name); field != nil && field.IsNumeric {
+				typ = "num"
+			}
+			comment := ""
+			if f.KeyType != "" && f.KeyType != KEY_TYPE_NOT_KEY {
+				comment = ` "key"`
+			}
+			fmt.Fprintf(&sb, "        %s %s%s\n", typ, mermaidName(f.Name), comment)
+		}
+		sb.WriteString("    }\n")
+	}
+	for _, k := range m.Keys {
+		label := k.Name()
+		if k.Synthetic {
+			label = "synthetic " + label
+		}
+		if m.inCircularReference(k) {
+			label = "circular " + label
+		}
+		for i := 0; i < len(k.Tables); i++ {
+			for j := i + 1; j < len(k.Tables); j++ {
+				fmt.Fprintf(&sb, "    %s }o--o{ %s : %q\n", mermaidName(k.Tables[i]), mermaidName(k.Tables[j]), label)
+			}
+		}
+	}
+	if _, err := io.WriteString(w, sb.String()); err != nil {
+		return util.Error("WriteMermaid", err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package engine_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/soderasen-au/go-common/util"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+	"github.com/soderasen-au/go-qlik/qlik/engine/enginetest"
+)
+
+const loopFixture = `
+apps:
+  - id: loop
+    fields:
+      - {name: X, values: [1, 2], tags: [$numeric]}
+      - {name: Y, values: [a, b]}
+      - {name: P, values: [p]}
+      - {name: Q, values: [q]}
+      - {name: R, values: [r]}
+    tables:
+      - {name: A, fields: [X, Y, P]}
+      - {name: B, fields: [X, Y]}
+      - {name: C, fields: [P, Q]}
+      - {name: D, fields: [Q, R]}
+      - {name: E, fields: [R, P]}
+`
+
+func TestFake_GetDataModel(t *testing.T) {
+	_, doc := enginetest.OpenDoc(t, enginetest.SalesFixture())
+	m, res := engine.GetDataModel(doc, nil)
+	if res != nil {
+		t.Fatalf("GetDataModel: %v", res)
+	}
+	sales := m.Table("Sales")
+	if sales == nil || sales.Rows != 5 || len(sales.Fields) != 4 || len(sales.Sample) != engine.DEFAULT_DATA_MODEL_SAMPLE_ROWS || sales.Sample[0][1] != "East" {
+		t.Errorf("Sales = %s", util.JsonStr(sales))
+	}
+	if len(m.Keys) != 1 || m.Keys[0].Name() != "SalesKey" || m.Keys[0].Synthetic {
+		t.Errorf("Keys = %s", util.JsonStr(m.Keys))
+	}
+	region := m.Field("Region")
+	if region == nil || region.Cardinal != 3 || region.IsNumeric || region.IsKey || len(region.Tables) != 1 {
+		t.Errorf("Region = %s", util.JsonStr(region))
+	}
+	if key := m.Field("SalesKey"); key == nil || !key.IsKey || !key.IsHidden || len(key.Tables) != 2 {
+		t.Errorf("SalesKey = %s", util.JsonStr(key))
+	}
+	if len(m.SyntheticKeys()) != 0 || len(m.CircularReferences) != 0 {
+		t.Errorf("model = %s", util.JsonStr(m))
+	}
+}
+
+func TestFake_DataModelLoops(t *testing.T) {
+	f, res := enginetest.ParseFixture([]byte(loopFixture), false)
+	if res != nil {
+		t.Fatalf("ParseFixture: %v", res)
+	}
+	_, doc := enginetest.OpenDoc(t, f)
+
+	m, res := engine.GetDataModel(doc, &engine.DataModelOptions{})
+	if res != nil {
+		t.Fatalf("GetDataModel: %v", res)
+	}
+	synthetic := m.SyntheticKeys()
+	if len(synthetic) != 1 || synthetic[0].Name() != "X+Y" {
+		t.Errorf("SyntheticKeys() = %s", util.JsonStr(synthetic))
+	}
+	if len(m.CircularReferences) != 1 || strings.Join(m.CircularReferences[0].Tables, ",") != "C,D,E" ||
+		strings.Join(m.CircularReferences[0].Keys, ",") != "P,Q,R" {
+		t.Errorf("CircularReferences = %s", util.JsonStr(m.CircularReferences))
+	}
+
+	tests := []struct {
+		name  string
+		write func(w *bytes.Buffer) *util.Result
+		want  []string
+	}{
+		{"dot", func(w *bytes.Buffer) *util.Result { return m.WriteDot(w) }, []string{
+			"graph datamodel {",
+			`"A" [label="{A\n0 rows|X\lY\lP\l}"];`,
+			`"A" -- "B" [label="X+Y", style=bold];`,
+			`"C" -- "D" [label="Q", color=red];`,
+		}},
+		{"mermaid", func(w *bytes.Buffer) *util.Result { return m.WriteMermaid(w) }, []string{
+			"erDiagram",
+			"        num X \"key\"",
+			`    A }o--o{ B : "synthetic X+Y"`,
+			`    C }o--o{ D : "circular Q"`,
+		}},
+		{"json", func(w *bytes.Buffer) *util.Result { return m.WriteJSON(w) }, []string{`"circular_references": [`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if res := tt.write(&buf); res != nil {
+				t.Fatalf("write: %v", res)
+			}
+			for _, line := range tt.want {
+				if !strings.Contains(buf.String(), line) {
+					t.Errorf("output has no %s:\n%s", line, buf.String())
+				}
+			}
+		})
+	}
+}
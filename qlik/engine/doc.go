@@ -6,25 +6,29 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
-	"sync"
 
 	"github.com/qlik-oss/enigma-go/v4"
 	"github.com/soderasen-au/go-common/loggers"
 	"github.com/soderasen-au/go-common/util"
+	"golang.org/x/sync/errgroup"
 )
 
 func GetCurrentSelection(doc *enigma.Doc, stateName string) (*enigma.SelectionObject, *util.Result) {
+	return GetCurrentSelectionContext(ConnCtx, doc, stateName)
+}
+
+func GetCurrentSelectionContext(ctx context.Context, doc *enigma.Doc, stateName string) (*enigma.SelectionObject, *util.Result) {
 	siProp := enigma.GenericObjectProperties{
 		Info: &enigma.NxInfo{Type: "SessionLists"},
 		SelectionObjectDef: &enigma.SelectionObjectDef{
 			StateName: stateName,
 		},
 	}
-	curSeleObj, err := doc.CreateSessionObject(ConnCtx, &siProp)
+	curSeleObj, err := doc.CreateSessionObject(ctx, &siProp)
 	if err != nil {
 		return nil, util.Error("CreateSessionObject", err)
 	}
-	curSeleObjLayoutBuf, err := curSeleObj.GetLayoutRaw(ConnCtx)
+	curSeleObjLayoutBuf, err := curSeleObj.GetLayoutRaw(ctx)
 	if err != nil {
 		return nil, util.Error("GetLayoutRaw", err)
 	}
@@ -39,6 +43,10 @@ func GetCurrentSelection(doc *enigma.Doc, stateName string) (*enigma.SelectionOb
 }
 
 func GetListObject(doc *enigma.Doc, stateName, fieldName string) (*enigma.ListObject, *util.Result) {
+	return GetListObjectContext(ConnCtx, doc, stateName, fieldName)
+}
+
+func GetListObjectContext(ctx context.Context, doc *enigma.Doc, stateName, fieldName string) (*enigma.ListObject, *util.Result) {
 	loProp := enigma.GenericObjectProperties{
 		Info: &enigma.NxInfo{Type: "ListObject"},
 		ListObjectDef: &enigma.ListObjectDef{
@@ -48,11 +56,11 @@ func GetListObject(doc *enigma.Doc, stateName, fieldName string) (*enigma.ListOb
 			},
 		},
 	}
-	listObj, err := doc.CreateSessionObject(ConnCtx, &loProp)
+	listObj, err := doc.CreateSessionObject(ctx, &loProp)
 	if err != nil {
 		return nil, util.Error("CreateSessionObject", err)
 	}
-	listObjLayoutBuf, err := listObj.GetLayoutRaw(ConnCtx)
+	listObjLayoutBuf, err := listObj.GetLayoutRaw(ctx)
 	if err != nil {
 		return nil, util.Error("GetLayoutRaw", err)
 	}
@@ -66,17 +74,73 @@ func GetListObject(doc *enigma.Doc, stateName, fieldName string) (*enigma.ListOb
 	return sessObjLayout.ListObject, nil
 }
 
+// GetFieldValues returns all values of field with their selection state (`qState`) in stateName,
+// e.g. `O` for possible, `S` for selected, `X` for excluded.
+func GetFieldValues(doc *enigma.Doc, stateName, fieldName string) ([]*enigma.NxCell, *util.Result) {
+	return GetFieldValuesContext(ConnCtx, doc, stateName, fieldName)
+}
+
+func GetFieldValuesContext(ctx context.Context, doc *enigma.Doc, stateName, fieldName string) ([]*enigma.NxCell, *util.Result) {
+	loProp := enigma.GenericObjectProperties{
+		Info: &enigma.NxInfo{Type: "ListObject"},
+		ListObjectDef: &enigma.ListObjectDef{
+			StateName: stateName,
+			Def: &enigma.NxInlineDimensionDef{
+				FieldDefs: []string{fieldName},
+			},
+			ShowAlternatives: true,
+		},
+	}
+	listObj, err := doc.CreateSessionObject(ctx, &loProp)
+	if err != nil {
+		return nil, util.Error("CreateSessionObject", err)
+	}
+	// the session object is destroyed even if ctx is canceled
+	defer doc.DestroySessionObject(context.WithoutCancel(ctx), listObj.GenericId)
+
+	layout, err := listObj.GetLayout(ctx)
+	if err != nil {
+		return nil, util.Error("GetLayout", err)
+	}
+	if layout.ListObject == nil || layout.ListObject.Size == nil {
+		return nil, util.MsgError("GetLayout", "invalid list object layout")
+	}
+
+	total := layout.ListObject.Size.Cy
+	values := make([]*enigma.NxCell, 0, total)
+	for top := 0; top < total; top += PAGE_MAX_CELLS {
+		page := &enigma.NxPage{Top: top, Left: 0, Height: util.Min(PAGE_MAX_CELLS, total-top), Width: 1}
+		dataPages, err := listObj.GetListObjectData(ctx, "/qListObjectDef", []*enigma.NxPage{page})
+		if err != nil {
+			return nil, util.Error("GetListObjectData", err)
+		}
+		for _, dp := range dataPages {
+			for _, row := range dp.Matrix {
+				if len(row) > 0 {
+					values = append(values, row[0])
+				}
+			}
+		}
+	}
+
+	return values, nil
+}
+
 func SetVariable(doc *enigma.Doc, name string, value string) error {
-	obj, err := doc.GetVariableByName(ConnCtx, name)
+	return SetVariableContext(ConnCtx, doc, name, value)
+}
+
+func SetVariableContext(ctx context.Context, doc *enigma.Doc, name string, value string) error {
+	obj, err := doc.GetVariableByName(ctx, name)
 	if err != nil {
 		return fmt.Errorf("get variable failed: %s", err.Error())
 	}
-	prop, err := obj.GetProperties(ConnCtx)
+	prop, err := obj.GetProperties(ctx)
 	if err != nil {
 		return fmt.Errorf("get var properties failed: %s", err.Error())
 	}
 	prop.Definition = value
-	err = obj.SetProperties(ConnCtx, prop)
+	err = obj.SetProperties(ctx, prop)
 	if err != nil {
 		return fmt.Errorf("set var properties failed: %s", err.Error())
 	}
@@ -84,11 +148,15 @@ func SetVariable(doc *enigma.Doc, name string, value string) error {
 }
 
 func SetStringVariable(doc *enigma.Doc, name string, value string) error {
-	obj, err := doc.GetVariableByName(ConnCtx, name)
+	return SetStringVariableContext(ConnCtx, doc, name, value)
+}
+
+func SetStringVariableContext(ctx context.Context, doc *enigma.Doc, name string, value string) error {
+	obj, err := doc.GetVariableByName(ctx, name)
 	if err != nil {
 		return fmt.Errorf("get variable failed: %s", err.Error())
 	}
-	err = obj.SetStringValue(ConnCtx, value)
+	err = obj.SetStringValue(ctx, value)
 	if err != nil {
 		return fmt.Errorf("SetStringValue: %s", err.Error())
 	}
@@ -97,13 +165,29 @@ func SetStringVariable(doc *enigma.Doc, name string, value string) error {
 }
 
 func GetObject(doc *enigma.Doc, qtype string, qid string) (reflect.Value, error) {
+	return GetObjectContext(ConnCtx, doc, qtype, qid)
+}
+
+func GetObjectContext(ctx context.Context, doc *enigma.Doc, qtype string, qid string) (reflect.Value, error) {
+	obj, exists, err := lookupObject(ctx, doc, qtype, qid)
+	if err != nil {
+		return reflect.ValueOf(nil), err
+	}
+	if !exists {
+		return reflect.ValueOf(nil), errors.New("doesn't have remote object")
+	}
+	return obj, nil
+}
+
+// lookupObject returns object qid of qtype, exists is false if the engine returned no object.
+func lookupObject(ctx context.Context, doc *enigma.Doc, qtype string, qid string) (obj reflect.Value, exists bool, err error) {
 	method, ok := GetObjMethods[qtype]
 	if !ok {
 		method = "GetObject"
 	}
-	obj, err := Invoke1Res1Err(doc, method, ConnCtx, qid)
+	obj, err = Invoke1Res1Err(doc, method, ctx, qid)
 	if err != nil {
-		return reflect.ValueOf(nil), errors.New("Invoke1Res1Err failed: " + err.Error())
+		return reflect.ValueOf(nil), false, errors.New("Invoke1Res1Err failed: " + err.Error())
 	}
 
 	objVal := obj
@@ -120,18 +204,22 @@ func GetObject(doc *enigma.Doc, qtype string, qid string) (reflect.Value, error)
 
 	remoteObject := objVal.FieldByName("RemoteObject").Interface().(*enigma.RemoteObject)
 	if remoteObject.Handle == 0 || len(remoteObject.Type) == 0 {
-		return reflect.ValueOf(nil), errors.New("doesn't have remote object")
+		return reflect.ValueOf(nil), false, nil
 	}
 
-	return obj, nil
+	return obj, true, nil
 }
 
 func DestroyObject(doc *enigma.Doc, qtype string, qid string) (reflect.Value, error) {
+	return DestroyObjectContext(ConnCtx, doc, qtype, qid)
+}
+
+func DestroyObjectContext(ctx context.Context, doc *enigma.Doc, qtype string, qid string) (reflect.Value, error) {
 	method, ok := DestroyObjMethods[qtype]
 	if !ok {
 		method = "DestroyObject"
 	}
-	success, err := Invoke1Res1Err(doc, method, ConnCtx, qid)
+	success, err := Invoke1Res1Err(doc, method, ctx, qid)
 	if err != nil {
 		return reflect.ValueOf(nil), errors.New("Invoke1Res1Err failed: " + err.Error())
 	}
@@ -155,12 +243,16 @@ func GetObjectList(doc *enigma.Doc, ctx context.Context, objType string) ([]*NxC
 }
 
 func CreateObject(doc *enigma.Doc, qtype string, prop json.RawMessage) (reflect.Value, error) {
+	return CreateObjectContext(ConnCtx, doc, qtype, prop)
+}
+
+func CreateObjectContext(ctx context.Context, doc *enigma.Doc, qtype string, prop json.RawMessage) (reflect.Value, error) {
 	method, ok := CreateObjMethods[qtype]
 	if !ok {
 		method = "CreateObjectRaw"
 	}
 
-	obj, err := Invoke1Res1Err(doc, method, ConnCtx, prop)
+	obj, err := Invoke1Res1Err(doc, method, ctx, prop)
 	if err != nil {
 		return reflect.ValueOf(nil), errors.New("Invoke1Res1Err failed: " + err.Error())
 	}
@@ -168,12 +260,16 @@ func CreateObject(doc *enigma.Doc, qtype string, prop json.RawMessage) (reflect.
 }
 
 func CreateChild(doc *enigma.Doc, parentInfo enigma.NxInfo, prop json.RawMessage) (reflect.Value, error) {
-	obj, err := GetObject(doc, parentInfo.Type, parentInfo.Id)
+	return CreateChildContext(ConnCtx, doc, parentInfo, prop)
+}
+
+func CreateChildContext(ctx context.Context, doc *enigma.Doc, parentInfo enigma.NxInfo, prop json.RawMessage) (reflect.Value, error) {
+	obj, err := GetObjectContext(ctx, doc, parentInfo.Type, parentInfo.Id)
 	if err != nil {
 		return reflect.ValueOf(nil), fmt.Errorf("get object failed: %s", err.Error())
 	}
 
-	child, err := Invoke1Res1ErrOn(obj, "CreateChildRaw", ConnCtx, prop, nil)
+	child, err := Invoke1Res1ErrOn(obj, "CreateChildRaw", ctx, prop, nil)
 	if err != nil {
 		return reflect.ValueOf(nil), fmt.Errorf("CreateChildRaw failed: %s", err.Error())
 	}
@@ -181,6 +277,10 @@ func CreateChild(doc *enigma.Doc, parentInfo enigma.NxInfo, prop json.RawMessage
 }
 
 func RecursiveGetProperties(doc *enigma.Doc, entry NxContainerEntry) (*ObjectPropeties, error) {
+	return RecursiveGetPropertiesContext(ConnCtx, doc, entry)
+}
+
+func RecursiveGetPropertiesContext(ctx context.Context, doc *enigma.Doc, entry NxContainerEntry) (*ObjectPropeties, error) {
 	qid := entry.Info.Id
 	qtype := entry.Info.Type
 	logger := loggers.CoreDebugLogger.With().
@@ -190,7 +290,7 @@ func RecursiveGetProperties(doc *enigma.Doc, entry NxContainerEntry) (*ObjectPro
 		Logger()
 
 	logger.Debug().Msg("get object")
-	obj, err := GetObject(doc, qtype, qid)
+	obj, err := GetObjectContext(ctx, doc, qtype, qid)
 	if err != nil {
 		return nil, errors.New("can't get obj " + qid + ": " + err.Error())
 	}
@@ -204,7 +304,7 @@ func RecursiveGetProperties(doc *enigma.Doc, entry NxContainerEntry) (*ObjectPro
 	}
 
 	logger.Debug().Msg("get properties")
-	prop, err := Invoke1Res1ErrOn(obj, "GetPropertiesRaw", ConnCtx)
+	prop, err := Invoke1Res1ErrOn(obj, "GetPropertiesRaw", ctx)
 	if err != nil {
 		return nil, errors.New("can't get obj properties " + qid + ": " + err.Error())
 	}
@@ -214,39 +314,34 @@ func RecursiveGetProperties(doc *enigma.Doc, entry NxContainerEntry) (*ObjectPro
 		return &objProp, nil
 	}
 	logger.Debug().Msg("get child infos")
-	ret, err := Invoke1Res1ErrOn(obj, "GetChildInfos", ConnCtx)
+	ret, err := Invoke1Res1ErrOn(obj, "GetChildInfos", ctx)
 	if err != nil {
 		return nil, errors.New("can't get obj children info " + qid + ": " + err.Error())
 	}
 
 	childrenInfos := ret.Interface().([]*enigma.NxInfo)
 	childArray := make([]*ObjectPropeties, len(childrenInfos))
-	errArray := make([]error, len(childrenInfos))
 
-	var wg sync.WaitGroup
+	// the first failed child cancels its siblings
+	g, gctx := errgroup.WithContext(ctx)
 	for i, child := range childrenInfos {
-		i := i
-		child := child
-		wg.Add(1)
-		go func(i int, child *enigma.NxInfo) {
-			defer wg.Done()
+		g.Go(func() error {
 			entry := NxContainerEntry{
 				Info: child,
 				Meta: &NxMeta{},
 			}
 			logger.Debug().Msgf("child[%d]: %s/%s start", i, child.Type, child.Id)
-			childObjProp, err := RecursiveGetProperties(doc, entry)
+			childObjProp, err := RecursiveGetPropertiesContext(gctx, doc, entry)
 			logger.Debug().Msgf("child[%d]: %s/%s finished", i, child.Type, child.Id)
-			errArray[i] = err
+			if err != nil {
+				return util.Error(fmt.Sprintf("child[%d]: (%s: %s)", i, child.Id, child.Type), err)
+			}
 			childArray[i] = childObjProp
-		}(i, child)
+			return nil
+		})
 	}
-	wg.Wait()
-
-	for i, err := range errArray {
-		if err != nil {
-			return nil, util.Error(fmt.Sprintf("child[%d]: (%s: %s)", i, childrenInfos[i].Id, childrenInfos[i].Type), err)
-		}
+	if err := g.Wait(); err != nil {
+		return nil, err
 	}
 
 	objProp.ChildInfos = childArray
@@ -254,7 +349,11 @@ func RecursiveGetProperties(doc *enigma.Doc, entry NxContainerEntry) (*ObjectPro
 }
 
 func GetSheetsObjectProperties(doc *enigma.Doc) ([]*ObjectPropeties, *util.Result) {
-	sessionObj, res := GetSessionObjectLayout(doc)
+	return GetSheetsObjectPropertiesContext(ConnCtx, doc)
+}
+
+func GetSheetsObjectPropertiesContext(ctx context.Context, doc *enigma.Doc) ([]*ObjectPropeties, *util.Result) {
+	sessionObj, res := GetSessionObjectLayoutContext(ctx, doc)
 	if res != nil {
 		return nil, res.With("GetSessionObjectLayout")
 	}
@@ -264,35 +363,32 @@ func GetSheetsObjectProperties(doc *enigma.Doc) ([]*ObjectPropeties, *util.Resul
 	items := sessionObj.AppObjectList.Items
 
 	sheetsProperties := make([]*ObjectPropeties, len(items))
-	errArray := make([]error, len(items))
-	var wg sync.WaitGroup
+	g, gctx := errgroup.WithContext(ctx)
 	for i, item := range items {
-		i := i
-		item := item
-		wg.Add(1)
-
-		go func() {
-			defer wg.Done()
+		g.Go(func() error {
 			if item.Meta == nil {
 				item.Meta = &NxMeta{}
 			}
-			prop, err := RecursiveGetProperties(doc, *item)
-			errArray[i] = err
+			prop, err := RecursiveGetPropertiesContext(gctx, doc, *item)
+			if err != nil {
+				return util.Error(fmt.Sprintf("sheet[%d]: %s", i, item.Info.Id), err)
+			}
 			sheetsProperties[i] = prop
-		}()
+			return nil
+		})
 	}
-	wg.Wait()
-
-	for i, err := range errArray {
-		if err != nil {
-			return nil, util.Error(fmt.Sprintf("sheet[%d]: %s", i, items[i].Info.Id), err)
-		}
+	if err := g.Wait(); err != nil {
+		return nil, groupResult(err)
 	}
 
 	return sheetsProperties, nil
 }
 
 func RecursiveCreateObject(doc *enigma.Doc, prop ObjectPropeties, parent *enigma.NxInfo) (*enigma.GenericObject, *util.Result) {
+	return RecursiveCreateObjectContext(ConnCtx, doc, prop, parent)
+}
+
+func RecursiveCreateObjectContext(ctx context.Context, doc *enigma.Doc, prop ObjectPropeties, parent *enigma.NxInfo) (*enigma.GenericObject, *util.Result) {
 	qid := prop.Info.Id
 	qtype := prop.Info.Type
 	logger := loggers.CoreDebugLogger.With().
@@ -304,14 +400,14 @@ func RecursiveCreateObject(doc *enigma.Doc, prop ObjectPropeties, parent *enigma
 	var objRet *enigma.GenericObject
 	if parent == nil {
 		logger.Debug().Msg("create object")
-		objVal, err := CreateObject(doc, qtype, prop.Properties)
+		objVal, err := CreateObjectContext(ctx, doc, qtype, prop.Properties)
 		if err != nil {
 			return nil, util.Error("CreateObject", err)
 		}
 		objRet = objVal.Interface().(*enigma.GenericObject)
 	} else {
 		logger.Debug().Msgf("create child object for %s-%s", parent.Type, parent.Id)
-		objVal, err := CreateChild(doc, *parent, prop.Properties)
+		objVal, err := CreateChildContext(ctx, doc, *parent, prop.Properties)
 		if err != nil {
 			return nil, util.Error("CreateChild", err)
 		}
@@ -326,7 +422,7 @@ func RecursiveCreateObject(doc *enigma.Doc, prop ObjectPropeties, parent *enigma
 
 	childrenInfos := prop.ChildInfos
 	for i, cp := range childrenInfos {
-		_, err := RecursiveCreateObject(doc, *cp, prop.Info)
+		_, err := RecursiveCreateObjectContext(ctx, doc, *cp, prop.Info)
 		if err != nil {
 			return nil, util.Error(fmt.Sprintf("child[%d]: (%s: %s)", i, childrenInfos[i].Info.Id, childrenInfos[i].Info.Type), err)
 		}
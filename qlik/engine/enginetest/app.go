@@ -0,0 +1,364 @@
+package enginetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	kindObject    = "GenericObject"
+	kindDimension = "GenericDimension"
+	kindMeasure   = "GenericMeasure"
+	kindVariable  = "GenericVariable"
+	kindBookmark  = "GenericBookmark"
+)
+
+// object is an entity of an app, its properties always contain `qInfo`.
+type object struct {
+	kind      string
+	id        string
+	typ       string
+	parent    string
+	props     map[string]any
+	meta      map[string]any
+	layout    map[string]any
+	data      [][]Cell
+	pivotPage map[string]any
+	children  []string
+
+	bookmark      map[string][]string // selections of a bookmark
+	scriptCreated bool                // variable set by the script
+}
+
+func (o *object) info() map[string]any {
+	return map[string]any{"qId": o.id, "qType": o.typ}
+}
+
+// app is shared by all sessions opening it, selections are kept by sessions.
+type app struct {
+	mu          sync.Mutex
+	id          string
+	title       string
+	props       map[string]any // app properties
+	script      string
+	fields      []*Field
+	tables      []*Table
+	objects     map[string]*object
+	order       []string
+	expressions map[string]Cell
+	states      []string
+	nextId      int
+}
+
+func newApp(f *App) *app {
+	a := &app{
+		id:          f.Id,
+		title:       f.Title,
+		props:       make(map[string]any),
+		script:      f.Script,
+		fields:      f.Fields,
+		tables:      f.Tables,
+		objects:     make(map[string]*object),
+		expressions: make(map[string]Cell),
+		states:      f.States,
+	}
+	if a.title == "" {
+		a.title = f.Id
+	}
+	for k, v := range f.Expressions {
+		a.expressions[normalizeExpr(k)] = v
+	}
+
+	for _, d := range f.Dimensions {
+		dim := map[string]any{
+			"qFieldDefs":       toAnySlice(d.FieldDefs),
+			"qFieldLabels":     toAnySlice(d.FieldLabels),
+			"qGrouping":        "N",
+			"qLabelExpression": d.LabelExpression,
+			"title":            d.Title,
+		}
+		a.add(&object{kind: kindDimension, id: d.Id, typ: "dimension", props: map[string]any{
+			"qDim":     dim,
+			"qMetaDef": map[string]any{"title": d.Title},
+		}})
+	}
+	for _, m := range f.Measures {
+		a.add(&object{kind: kindMeasure, id: m.Id, typ: "measure", props: map[string]any{
+			"qMeasure": map[string]any{"qDef": m.Def, "qLabel": m.Label},
+			"qMetaDef": map[string]any{"title": m.Title},
+		}})
+	}
+	for _, v := range f.Variables {
+		a.add(&object{kind: kindVariable, id: v.ID(), typ: "variable", props: map[string]any{
+			"qName":       v.Name,
+			"qDefinition": v.Definition,
+			"qComment":    v.Comment,
+		}})
+	}
+	for _, b := range f.Bookmarks {
+		a.add(&object{kind: kindBookmark, id: b.Id, typ: "bookmark", bookmark: b.Selections, props: map[string]any{
+			"qMetaDef": map[string]any{"title": b.Title, "description": b.Description},
+		}})
+	}
+	for _, o := range f.Objects {
+		a.add(&object{
+			kind:      kindObject,
+			id:        o.Id,
+			typ:       o.Type,
+			parent:    o.Parent,
+			props:     cloneMap(o.Properties),
+			meta:      cloneMap(o.Meta),
+			layout:    cloneMap(o.Layout),
+			data:      o.Data,
+			pivotPage: cloneMap(o.PivotPage),
+		})
+	}
+	for _, id := range a.order {
+		if o := a.objects[id]; o.parent != "" {
+			a.objects[o.parent].children = append(a.objects[o.parent].children, o.id)
+		}
+	}
+	return a
+}
+
+// add sets `qInfo` of o and adds it to a.
+func (a *app) add(o *object) {
+	if o.props == nil {
+		o.props = make(map[string]any)
+	}
+	if info, ok := o.props["qInfo"].(map[string]any); ok {
+		if o.id == "" {
+			o.id, _ = info["qId"].(string)
+		}
+		if o.typ == "" {
+			o.typ, _ = info["qType"].(string)
+		}
+	}
+	if o.id == "" {
+		a.nextId++
+		o.id = fmt.Sprintf("%s-%d", o.typ, a.nextId)
+	}
+	o.props["qInfo"] = o.info()
+	a.objects[o.id] = o
+	a.order = append(a.order, o.id)
+}
+
+func (a *app) remove(id string) bool {
+	o, ok := a.objects[id]
+	if !ok {
+		return false
+	}
+	for _, child := range append([]string{}, o.children...) {
+		a.remove(child)
+	}
+	if parent, ok := a.objects[o.parent]; ok {
+		parent.children = removeString(parent.children, id)
+	}
+	delete(a.objects, id)
+	a.order = removeString(a.order, id)
+	return true
+}
+
+func (a *app) get(kind, id string) *object {
+	if o, ok := a.objects[id]; ok && o.kind == kind {
+		return o
+	}
+	return nil
+}
+
+func (a *app) variableByName(name string) *object {
+	for _, id := range a.order {
+		o := a.objects[id]
+		if o.kind == kindVariable && strings.EqualFold(fmt.Sprint(o.props["qName"]), name) {
+			return o
+		}
+	}
+	return nil
+}
+
+func (a *app) field(name string) *Field {
+	for _, f := range a.fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// ofType returns objects of qType typ in the order of the fixture.
+func (a *app) ofType(typ string) []*object {
+	ret := make([]*object, 0)
+	for _, id := range a.order {
+		if o := a.objects[id]; o.typ == typ {
+			ret = append(ret, o)
+		}
+	}
+	return ret
+}
+
+func normalizeExpr(expr string) string {
+	return strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(expr), "="))
+}
+
+func cloneMap(m map[string]any) map[string]any {
+	if m == nil {
+		return nil
+	}
+	var ret map[string]any
+	buf, err := json.Marshal(m)
+	if err != nil {
+		panic(err)
+	}
+	if err := json.Unmarshal(buf, &ret); err != nil {
+		panic(err)
+	}
+	return ret
+}
+
+func toAnySlice(s []string) []any {
+	ret := make([]any, len(s))
+	for i, v := range s {
+		ret[i] = v
+	}
+	return ret
+}
+
+func removeString(s []string, v string) []string {
+	ret := s[:0]
+	for _, x := range s {
+		if x != v {
+			ret = append(ret, x)
+		}
+	}
+	return ret
+}
+
+func formatNum(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+var scriptVariable = regexp.MustCompile(`(?i)^(?:SET|LET)\s+(\w+)\s*=\s*(.*?);?$`)
+
+// reload pretends to run the script, statements starting with FAIL are script errors.
+// `SET|LET name = value;` statements create or set variables as script-created.
+func (a *app) reload() (bool, map[string]any) {
+	errs := make([]any, 0)
+	for _, line := range strings.Split(a.script, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(strings.ToUpper(line), "FAIL") {
+			errs = append(errs, map[string]any{"qErrorString": "Unknown statement", "qLine": line, "qErrorDataCode": "EDC_ERROR"})
+		}
+		if m := scriptVariable.FindStringSubmatch(line); m != nil {
+			v := a.variableByName(m[1])
+			if v == nil {
+				v = &object{kind: kindVariable, id: "var-" + m[1], typ: "variable", props: map[string]any{"qName": m[1]}}
+				a.add(v)
+			}
+			v.props["qDefinition"] = strings.Trim(m[2], `'"`)
+			v.scriptCreated = true
+		}
+	}
+	log := []string{"Started loading data", "Data has been loaded"}
+	if len(errs) > 0 {
+		log[1] = "Execution failed"
+	}
+	return len(errs) == 0, map[string]any{
+		"qStarted":            true,
+		"qFinished":           true,
+		"qPersistentProgress": strings.Join(log, "\n"),
+		"qErrorData":          errs,
+	}
+}
+
+// tablesOf returns names of tables having field.
+func (a *app) tablesOf(field string) []string {
+	ret := make([]string, 0)
+	for _, t := range a.tables {
+		if slices.Contains(t.Fields, field) {
+			ret = append(ret, t.Name)
+		}
+	}
+	return ret
+}
+
+// tablesAndKeys returns the result of GetTablesAndKeys, fields shared by the same tables
+// are grouped into a key, which is synthetic if it has more than one field.
+func (a *app) tablesAndKeys() map[string]any {
+	tables := make([]any, 0, len(a.tables))
+	keys := make([]any, 0)
+	keyIndex := make(map[string]int)
+	for _, t := range a.tables {
+		fields := make([]any, 0, len(t.Fields))
+		for _, name := range t.Fields {
+			keyType := "NOT_KEY"
+			if in := a.tablesOf(name); len(in) > 1 {
+				keyType = "ANY_KEY"
+				id := strings.Join(in, "\x00")
+				i, ok := keyIndex[id]
+				if !ok {
+					i = len(keys)
+					keyIndex[id] = i
+					keys = append(keys, map[string]any{"qKeyFields": []any{}, "qTables": toAnySlice(in)})
+				}
+				key := keys[i].(map[string]any)
+				if !slices.Contains(key["qKeyFields"].([]any), any(name)) {
+					key["qKeyFields"] = append(key["qKeyFields"].([]any), name)
+				}
+			}
+			var tags []any
+			if f := a.field(name); f != nil {
+				tags = toAnySlice(f.Tags)
+			}
+			fields = append(fields, map[string]any{"qName": name, "qKeyType": keyType, "qnRows": len(t.Rows), "qTags": tags})
+		}
+		tables = append(tables, map[string]any{"qName": t.Name, "qComment": t.Comment, "qNoOfRows": len(t.Rows), "qFields": fields})
+	}
+	return map[string]any{"qtr": tables, "qk": keys}
+}
+
+func (a *app) fieldDescription(name string) map[string]any {
+	f := a.field(name)
+	if f == nil {
+		return nil
+	}
+	size := 0
+	for _, v := range f.Values {
+		size += len(v.Text)
+	}
+	return map[string]any{
+		"qName":       f.Name,
+		"qSrcTables":  toAnySlice(a.tablesOf(name)),
+		"qCardinal":   len(f.Values),
+		"qTotalCount": len(f.Values),
+		"qTags":       toAnySlice(f.Tags),
+		"qIsNumeric":  slices.Contains(f.Tags, "$numeric"),
+		"qIsHidden":   slices.Contains(f.Tags, "$hidden"),
+		"qByteSize":   size,
+	}
+}
+
+func (a *app) tableData(name string, offset, rows int) []any {
+	ret := make([]any, 0)
+	for _, t := range a.tables {
+		if t.Name != name {
+			continue
+		}
+		for i := offset; i < len(t.Rows) && i < offset+rows; i++ {
+			values := make([]any, 0, len(t.Rows[i]))
+			for _, c := range t.Rows[i] {
+				v := map[string]any{"qText": c.Text, "qIsNumeric": c.IsNumeric()}
+				if c.Num != nil {
+					v["qNumber"] = *c.Num
+				}
+				values = append(values, v)
+			}
+			ret = append(ret, map[string]any{"qValue": values})
+		}
+	}
+	return ret
+}
@@ -0,0 +1,294 @@
+package enginetest
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var aggregation = regexp.MustCompile(`(?i)^\s*(sum|count|min|max|avg)\s*\(\s*(distinct\s+)?\[?([^\]\)]+?)\]?\s*\)\s*$`)
+
+// joined returns rows of the tables joined on shared fields, tables sharing no field are skipped.
+func (a *app) joined() []map[string]Cell {
+	if len(a.tables) == 0 {
+		return nil
+	}
+	rowsOf := func(t *Table) []map[string]Cell {
+		ret := make([]map[string]Cell, 0, len(t.Rows))
+		for _, r := range t.Rows {
+			m := make(map[string]Cell, len(t.Fields))
+			for i, f := range t.Fields {
+				m[f] = r[i]
+			}
+			ret = append(ret, m)
+		}
+		return ret
+	}
+
+	rows := rowsOf(a.tables[0])
+	fields := make(map[string]bool)
+	for _, f := range a.tables[0].Fields {
+		fields[f] = true
+	}
+	pending := a.tables[1:]
+	for joinedAny := true; joinedAny && len(pending) > 0; {
+		joinedAny = false
+		rest := make([]*Table, 0, len(pending))
+		for _, t := range pending {
+			shared := make([]string, 0)
+			for _, f := range t.Fields {
+				if fields[f] {
+					shared = append(shared, f)
+				}
+			}
+			if len(shared) == 0 {
+				rest = append(rest, t)
+				continue
+			}
+			next := make([]map[string]Cell, 0, len(rows))
+			for _, r := range rows {
+				for _, tr := range rowsOf(t) {
+					match := true
+					for _, f := range shared {
+						if r[f].Text != tr[f].Text {
+							match = false
+							break
+						}
+					}
+					if match {
+						m := cloneCells(r)
+						for k, v := range tr {
+							m[k] = v
+						}
+						next = append(next, m)
+					}
+				}
+			}
+			rows = next
+			for _, f := range t.Fields {
+				fields[f] = true
+			}
+			joinedAny = true
+		}
+		pending = rest
+	}
+	return rows
+}
+
+func cloneCells(m map[string]Cell) map[string]Cell {
+	ret := make(map[string]Cell, len(m))
+	for k, v := range m {
+		ret[k] = v
+	}
+	return ret
+}
+
+// dimensionField returns the field of a hypercube dimension, resolving master dimensions.
+func (d *docSession) dimensionField(v any) string {
+	_, defs := d.dimensionTitle(v)
+	if len(defs) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(defs[0], "=")
+}
+
+// measureExpr returns the expression of a hypercube measure, resolving master measures.
+func (d *docSession) measureExpr(v any) string {
+	m, _ := v.(map[string]any)
+	if libId, ok := m["qLibraryId"].(string); ok && libId != "" {
+		if lib := d.app.get(kindMeasure, libId); lib != nil {
+			lm, _ := lib.props["qMeasure"].(map[string]any)
+			expr, _ := lm["qDef"].(string)
+			return expr
+		}
+		return ""
+	}
+	def, _ := m["qDef"].(map[string]any)
+	expr, _ := def["qDef"].(string)
+	return expr
+}
+
+// aggregate computes a measure over rows, expressions other than Sum, Count, Min, Max and Avg
+// of a field are evaluated as in Evaluate.
+func (d *docSession) aggregate(expr string, rows []map[string]Cell) Cell {
+	g := aggregation.FindStringSubmatch(expr)
+	if g == nil {
+		return d.evaluate(expr)
+	}
+	fn, isDistinct, field := strings.ToLower(g[1]), g[2] != "", strings.TrimSpace(g[3])
+	seen := make(map[string]bool)
+	count, sum := 0, 0.0
+	minV, maxV := math.Inf(1), math.Inf(-1)
+	for _, r := range rows {
+		c, ok := r[field]
+		if !ok {
+			continue
+		}
+		if isDistinct {
+			if seen[c.Text] {
+				continue
+			}
+			seen[c.Text] = true
+		}
+		count++
+		if c.Num != nil {
+			sum += *c.Num
+			minV, maxV = math.Min(minV, *c.Num), math.Max(maxV, *c.Num)
+		}
+	}
+	switch fn {
+	case "count":
+		return NewNumCell(float64(count))
+	case "min":
+		if count == 0 {
+			return Cell{Text: "-"}
+		}
+		return NewNumCell(minV)
+	case "max":
+		if count == 0 {
+			return Cell{Text: "-"}
+		}
+		return NewNumCell(maxV)
+	case "avg":
+		if count == 0 {
+			return Cell{Text: "-"}
+		}
+		return NewNumCell(sum / float64(count))
+	}
+	return NewNumCell(sum)
+}
+
+// cubeRows computes rows of a straight hypercube from the tables of the app, filtered by selections
+// of its state, grouped by dimensions and sorted and suppressed as in def.
+func (d *docSession) cubeRows(def map[string]any) [][]Cell {
+	dims, _ := def["qDimensions"].([]any)
+	measures, _ := def["qMeasures"].([]any)
+	fields := make([]string, len(dims))
+	for i, dim := range dims {
+		fields[i] = d.dimensionField(dim)
+	}
+	stateName, _ := def["qStateName"].(string)
+	state := d.state(stateName)
+
+	groups := make(map[string][]map[string]Cell)
+	keys := make([]string, 0)
+	for _, r := range d.app.joined() {
+		if !state.matches(r) {
+			continue
+		}
+		parts := make([]string, len(fields))
+		skip := false
+		for i, f := range fields {
+			c, ok := r[f]
+			if !ok {
+				dim, _ := dims[i].(map[string]any)
+				if suppress, _ := dim["qNullSuppression"].(bool); suppress {
+					skip = true
+					break
+				}
+			}
+			parts[i] = c.Text
+		}
+		if skip {
+			continue
+		}
+		key := strings.Join(parts, "\x00")
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], r)
+	}
+
+	suppressZero, _ := def["qSuppressZero"].(bool)
+	rows := make([][]Cell, 0, len(keys))
+	for _, key := range keys {
+		group := groups[key]
+		row := make([]Cell, 0, len(dims)+len(measures))
+		for _, f := range fields {
+			c, ok := group[0][f]
+			if !ok {
+				c = Cell{Text: "-"}
+			}
+			row = append(row, c)
+		}
+		zero := len(measures) > 0
+		for _, m := range measures {
+			c := d.aggregate(d.measureExpr(m), group)
+			if c.Num == nil || *c.Num != 0 {
+				zero = false
+			}
+			row = append(row, c)
+		}
+		if suppressZero && zero {
+			continue
+		}
+		rows = append(rows, row)
+	}
+
+	order := make([]int, 0, len(dims)+len(measures))
+	if o, ok := def["qInterColumnSortOrder"].([]any); ok && len(o) > 0 {
+		for _, i := range o {
+			order = append(order, intOf(i))
+		}
+	} else {
+		for i := 0; i < len(dims)+len(measures); i++ {
+			order = append(order, i)
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, col := range order {
+			if col < 0 || col >= len(dims)+len(measures) {
+				continue
+			}
+			byNum, byText := sortDirections(dims, measures, col)
+			if c := compareCells(rows[i][col], rows[j][col], byNum, byText); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	return rows
+}
+
+// cubeData returns the declared data of o, or rows computed from the tables for objects without any.
+func (d *docSession) cubeData(o *object, def map[string]any) [][]Cell {
+	if o.data != nil || len(d.app.tables) == 0 {
+		return o.data
+	}
+	return d.cubeRows(def)
+}
+
+// sortDirections returns directions of sorting a column by number and by text, 0 means not sorted.
+func sortDirections(dims, measures []any, col int) (byNum, byText int) {
+	if col < len(dims) {
+		dim, _ := dims[col].(map[string]any)
+		def, _ := dim["qDef"].(map[string]any)
+		criterias, _ := def["qSortCriterias"].([]any)
+		if len(criterias) == 0 {
+			return 0, 1
+		}
+		c, _ := criterias[0].(map[string]any)
+		return intOf(c["qSortByNumeric"]), intOf(c["qSortByAscii"])
+	}
+	m, _ := measures[col-len(dims)].(map[string]any)
+	sortBy, _ := m["qSortBy"].(map[string]any)
+	return intOf(sortBy["qSortByNumeric"]), 0
+}
+
+// compareCells returns a negative number when a sorts before b, directions are 1 for ascending and -1 for descending.
+func compareCells(a, b Cell, byNum, byText int) int {
+	if byNum != 0 && a.Num != nil && b.Num != nil && *a.Num != *b.Num {
+		if *a.Num < *b.Num {
+			return -byNum
+		}
+		return byNum
+	}
+	if byText != 0 && a.Text != b.Text {
+		if a.Text < b.Text {
+			return -byText
+		}
+		return byText
+	}
+	return 0
+}
@@ -0,0 +1,281 @@
+// Package enginetest serves apps declared in a Fixture over the QIX JSON-RPC protocol,
+// so code using enigma-go can be tested without a Sense server.
+//
+// It implements the subset of the protocol used by this module: opening apps, objects and their
+// layouts, properties and hypercube/list object data, session objects, field selections and locks,
+// variables, bookmarks, master items and expression evaluation from a lookup table.
+// Data of hypercubes is declared per object or computed from tables of the app, selections filter
+// only the computed data, without associations between fields.
+// Reloads don't load data, script lines starting with FAIL are reported as script errors.
+package enginetest
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/soderasen-au/go-common/util"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed fixtures
+var fixtures embed.FS
+
+type Fixture struct {
+	Apps []*App `json:"apps" yaml:"apps"`
+}
+
+// App is a Sense app, objects are looked up by `Id`.
+type App struct {
+	Id          string          `json:"id" yaml:"id"`
+	Title       string          `json:"title,omitempty" yaml:"title,omitempty"`
+	Script      string          `json:"script,omitempty" yaml:"script,omitempty"`
+	Fields      []*Field        `json:"fields,omitempty" yaml:"fields,omitempty"`
+	Tables      []*Table        `json:"tables,omitempty" yaml:"tables,omitempty"` // data model, fields must be declared in `Fields`
+	Dimensions  []*Dimension    `json:"dimensions,omitempty" yaml:"dimensions,omitempty"`
+	Measures    []*Measure      `json:"measures,omitempty" yaml:"measures,omitempty"`
+	Variables   []*Variable     `json:"variables,omitempty" yaml:"variables,omitempty"`
+	Bookmarks   []*Bookmark     `json:"bookmarks,omitempty" yaml:"bookmarks,omitempty"`
+	Objects     []*Object       `json:"objects,omitempty" yaml:"objects,omitempty"`
+	Expressions map[string]Cell `json:"expressions,omitempty" yaml:"expressions,omitempty"` // results of Evaluate/EvaluateEx
+	States      []string        `json:"states,omitempty" yaml:"states,omitempty"`           // alternate states
+}
+
+type Field struct {
+	Name   string   `json:"name" yaml:"name"`
+	Values []Cell   `json:"values,omitempty" yaml:"values,omitempty"`
+	Tags   []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+}
+
+// Table is a table of the data model, fields shared by tables are keys.
+type Table struct {
+	Name    string   `json:"name" yaml:"name"`
+	Comment string   `json:"comment,omitempty" yaml:"comment,omitempty"`
+	Fields  []string `json:"fields" yaml:"fields"`
+	Rows    [][]Cell `json:"rows,omitempty" yaml:"rows,omitempty"`
+}
+
+// Dimension is a master dimension.
+type Dimension struct {
+	Id              string   `json:"id" yaml:"id"`
+	Title           string   `json:"title,omitempty" yaml:"title,omitempty"`
+	FieldDefs       []string `json:"field_defs" yaml:"field_defs"`
+	FieldLabels     []string `json:"field_labels,omitempty" yaml:"field_labels,omitempty"`
+	LabelExpression string   `json:"label_expression,omitempty" yaml:"label_expression,omitempty"`
+}
+
+// Measure is a master measure.
+type Measure struct {
+	Id    string `json:"id" yaml:"id"`
+	Title string `json:"title,omitempty" yaml:"title,omitempty"`
+	Def   string `json:"def" yaml:"def"`
+	Label string `json:"label,omitempty" yaml:"label,omitempty"`
+}
+
+// Variable is evaluated as its `Definition`, numeric definitions are numbers.
+type Variable struct {
+	Id         string `json:"id,omitempty" yaml:"id,omitempty"` // default `var-<Name>`
+	Name       string `json:"name" yaml:"name"`
+	Definition string `json:"definition" yaml:"definition"`
+	Comment    string `json:"comment,omitempty" yaml:"comment,omitempty"`
+}
+
+// Bookmark replaces selections of the default state with `Selections` when it's applied.
+type Bookmark struct {
+	Id          string              `json:"id" yaml:"id"`
+	Title       string              `json:"title,omitempty" yaml:"title,omitempty"`
+	Description string              `json:"description,omitempty" yaml:"description,omitempty"`
+	Selections  map[string][]string `json:"selections,omitempty" yaml:"selections,omitempty"` // field => values
+}
+
+// Object is a generic object. Its layout is derived from `Properties`, e.g. `qHyperCubeDef`
+// becomes `qHyperCube` with `Data` as its rows, then `Layout` is merged over it.
+type Object struct {
+	Id         string         `json:"id" yaml:"id"`
+	Type       string         `json:"type" yaml:"type"`
+	Parent     string         `json:"parent,omitempty" yaml:"parent,omitempty"`
+	Meta       map[string]any `json:"meta,omitempty" yaml:"meta,omitempty"` // `qMeta` in object lists, e.g. `published`
+	Properties map[string]any `json:"properties,omitempty" yaml:"properties,omitempty"`
+	Layout     map[string]any `json:"layout,omitempty" yaml:"layout,omitempty"`
+	Data       [][]Cell       `json:"data,omitempty" yaml:"data,omitempty"`
+	PivotPage  map[string]any `json:"pivot_page,omitempty" yaml:"pivot_page,omitempty"` // NxPivotPage returned by GetHyperCubePivotData
+}
+
+// Cell is a dual value, it can be declared as a plain string or number, or as `{text, num}`.
+type Cell struct {
+	Text string   `json:"text" yaml:"text"`
+	Num  *float64 `json:"num,omitempty" yaml:"num,omitempty"`
+}
+
+func NewTextCell(text string) Cell {
+	return Cell{Text: text}
+}
+
+func NewNumCell(num float64) Cell {
+	return Cell{Text: strconv.FormatFloat(num, 'f', -1, 64), Num: &num}
+}
+
+func (c Cell) IsNumeric() bool {
+	return c.Num != nil
+}
+
+func (c *Cell) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		if node.Tag == "!!int" || node.Tag == "!!float" {
+			num, err := strconv.ParseFloat(node.Value, 64)
+			if err != nil {
+				return err
+			}
+			*c = NewNumCell(num)
+			return nil
+		}
+		*c = NewTextCell(node.Value)
+		return nil
+	}
+	type plain Cell
+	return node.Decode((*plain)(c))
+}
+
+func (c *Cell) UnmarshalJSON(data []byte) error {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch val := v.(type) {
+	case float64:
+		*c = NewNumCell(val)
+		return nil
+	case string:
+		*c = NewTextCell(val)
+		return nil
+	}
+	type plain Cell
+	return json.Unmarshal(data, (*plain)(c))
+}
+
+// LoadFixture reads a fixture from a yaml or json file.
+func LoadFixture(path string) (*Fixture, *util.Result) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, util.Error("ReadFile", err)
+	}
+	return ParseFixture(buf, strings.ToLower(filepath.Ext(path)) == ".json")
+}
+
+func ParseFixture(buf []byte, isJson bool) (*Fixture, *util.Result) {
+	var f Fixture
+	if isJson {
+		if err := json.Unmarshal(buf, &f); err != nil {
+			return nil, util.Error("ParseJson", err)
+		}
+	} else {
+		if err := yaml.Unmarshal(buf, &f); err != nil {
+			return nil, util.Error("ParseYaml", err)
+		}
+	}
+	if res := f.Validate(); res != nil {
+		return nil, res
+	}
+	return &f, nil
+}
+
+// SalesFixture is a small app with two tables linked by a key, a sheet, a straight table,
+// a pivot table, a container, master items, variables and bookmarks, shared by tests of this module.
+func SalesFixture() *Fixture {
+	buf, err := fixtures.ReadFile("fixtures/sales.yaml")
+	if err != nil {
+		panic(err)
+	}
+	f, res := ParseFixture(buf, false)
+	if res != nil {
+		panic(res.Error())
+	}
+	return f
+}
+
+func (f *Fixture) Validate() *util.Result {
+	appIds := make(map[string]bool)
+	for i, app := range f.Apps {
+		if app == nil || app.Id == "" {
+			return util.MsgError("Validate", fmt.Sprintf("app[%d] has no id", i))
+		}
+		if appIds[app.Id] {
+			return util.MsgError("Validate", "duplicated app "+app.Id)
+		}
+		appIds[app.Id] = true
+
+		fields := make(map[string]bool)
+		for _, f := range app.Fields {
+			fields[f.Name] = true
+		}
+		for _, tbl := range app.Tables {
+			for _, f := range tbl.Fields {
+				if !fields[f] {
+					return util.MsgError("Validate", fmt.Sprintf("field %s of table %s doesn't exist in app %s", f, tbl.Name, app.Id))
+				}
+			}
+			for _, row := range tbl.Rows {
+				if len(row) != len(tbl.Fields) {
+					return util.MsgError("Validate", fmt.Sprintf("row of table %s has %d values, want %d", tbl.Name, len(row), len(tbl.Fields)))
+				}
+			}
+		}
+
+		ids := make(map[string]bool)
+		add := func(kind, id string) *util.Result {
+			if id == "" {
+				return util.MsgError("Validate", fmt.Sprintf("%s in app %s has no id", kind, app.Id))
+			}
+			if ids[id] {
+				return util.MsgError("Validate", fmt.Sprintf("duplicated id %s in app %s", id, app.Id))
+			}
+			ids[id] = true
+			return nil
+		}
+		for _, d := range app.Dimensions {
+			if res := add("dimension", d.Id); res != nil {
+				return res
+			}
+		}
+		for _, m := range app.Measures {
+			if res := add("measure", m.Id); res != nil {
+				return res
+			}
+		}
+		for _, v := range app.Variables {
+			if v.Name == "" {
+				return util.MsgError("Validate", "variable without name in app "+app.Id)
+			}
+			if res := add("variable", v.ID()); res != nil {
+				return res
+			}
+		}
+		for _, b := range app.Bookmarks {
+			if res := add("bookmark", b.Id); res != nil {
+				return res
+			}
+		}
+		for _, o := range app.Objects {
+			if res := add("object", o.Id); res != nil {
+				return res
+			}
+		}
+		for _, o := range app.Objects {
+			if o.Parent != "" && !ids[o.Parent] {
+				return util.MsgError("Validate", fmt.Sprintf("parent %s of %s doesn't exist in app %s", o.Parent, o.Id, app.Id))
+			}
+		}
+	}
+	return nil
+}
+
+func (v Variable) ID() string {
+	if v.Id != "" {
+		return v.Id
+	}
+	return "var-" + v.Name
+}
@@ -0,0 +1,823 @@
+package enginetest
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	DEFAULT_STATE      = "$"
+	MAX_VISIBLE_VALUES = 6
+)
+
+var dollarExpansion = regexp.MustCompile(`\$\(([^()]+)\)`)
+
+// docSession is an app opened by a session.
+type docSession struct {
+	app        *app
+	selections map[string]*stateSelections
+	sessionObj map[string]*object
+	nextId     int
+}
+
+// stateSelections keeps selected values of fields in a state in selection order.
+type stateSelections struct {
+	fields []string
+	values map[string][]string
+	locked map[string]bool
+}
+
+func newDocSession(a *app) *docSession {
+	return &docSession{app: a, selections: make(map[string]*stateSelections), sessionObj: make(map[string]*object)}
+}
+
+func stateOf(state string) string {
+	if state == "" {
+		return DEFAULT_STATE
+	}
+	return state
+}
+
+func (d *docSession) state(state string) *stateSelections {
+	state = stateOf(state)
+	s, ok := d.selections[state]
+	if !ok {
+		s = &stateSelections{values: make(map[string][]string), locked: make(map[string]bool)}
+		d.selections[state] = s
+	}
+	return s
+}
+
+func (s *stateSelections) set(field string, values []string) {
+	if len(values) == 0 {
+		s.clear(field)
+		return
+	}
+	if _, ok := s.values[field]; !ok {
+		s.fields = append(s.fields, field)
+	}
+	s.values[field] = values
+}
+
+func (s *stateSelections) clear(field string) {
+	delete(s.values, field)
+	s.fields = removeString(s.fields, field)
+}
+
+// clearAll clears all fields, locked fields only if lockedAlso is true.
+func (s *stateSelections) clearAll(lockedAlso bool) {
+	for _, field := range append([]string(nil), s.fields...) {
+		if lockedAlso || !s.locked[field] {
+			s.clear(field)
+			delete(s.locked, field)
+		}
+	}
+}
+
+func (s *stateSelections) isSelected(field, text string) (selected bool, hasSelection bool) {
+	values, ok := s.values[field]
+	if !ok {
+		return false, false
+	}
+	for _, v := range values {
+		if v == text {
+			return true, true
+		}
+	}
+	return false, true
+}
+
+// matches reports whether values of a row are selected in all fields having a selection.
+func (s *stateSelections) matches(row map[string]Cell) bool {
+	return s.matchesExcept(row, "")
+}
+
+// matchesExcept is matches ignoring selections of field `except`.
+func (s *stateSelections) matchesExcept(row map[string]Cell, except string) bool {
+	for _, field := range s.fields {
+		if field == except {
+			continue
+		}
+		c, ok := row[field]
+		if !ok {
+			continue
+		}
+		if selected, _ := s.isSelected(field, c.Text); !selected {
+			return false
+		}
+	}
+	return true
+}
+
+// excludes reports whether selections of other fields exclude all rows having value text of field,
+// which makes a selected value excluded.
+func (s *stateSelections) excludes(rows []map[string]Cell, field, text string) bool {
+	found := false
+	for _, r := range rows {
+		if c, ok := r[field]; !ok || c.Text != text {
+			continue
+		}
+		if s.matchesExcept(r, field) {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+// selectTexts selects texts of field in state, or toggles them if toggle is true.
+func (d *docSession) selectTexts(state string, f *Field, texts []string, toggle bool) {
+	s := d.state(state)
+	chosen := make(map[string]bool)
+	if toggle {
+		for _, v := range s.values[f.Name] {
+			chosen[v] = true
+		}
+	}
+	for _, t := range texts {
+		chosen[t] = !toggle || !chosen[t]
+	}
+	values := make([]string, 0)
+	for _, v := range f.Values {
+		if chosen[v.Text] {
+			values = append(values, v.Text)
+		}
+	}
+	s.set(f.Name, values)
+}
+
+// selectMatch selects values of f matching the search string, `*` and `?` are wildcards.
+func (d *docSession) selectMatch(state string, f *Field, match string) bool {
+	texts := make([]string, 0)
+	for _, v := range f.Values {
+		if ok, _ := path.Match(strings.ToLower(match), strings.ToLower(v.Text)); ok || v.Text == match {
+			texts = append(texts, v.Text)
+		}
+	}
+	if len(texts) == 0 {
+		return false
+	}
+	d.selectTexts(state, f, texts, false)
+	return true
+}
+
+func (d *docSession) applyBookmark(o *object) {
+	d.state(DEFAULT_STATE).clearAll(false)
+	for field, values := range o.bookmark {
+		if f := d.app.field(field); f != nil {
+			d.selectTexts(DEFAULT_STATE, f, values, false)
+		}
+	}
+}
+
+func (d *docSession) get(kind, id string) *object {
+	if o, ok := d.sessionObj[id]; ok && o.kind == kind {
+		return o
+	}
+	return d.app.get(kind, id)
+}
+
+// layout returns the layout of o according to its kind.
+func (d *docSession) layout(o *object) map[string]any {
+	var l map[string]any
+	switch o.kind {
+	case kindDimension:
+		l = map[string]any{"qDim": o.props["qDim"], "qDimInfos": d.dimInfos(o)}
+	case kindMeasure:
+		l = map[string]any{"qMeasure": o.props["qMeasure"]}
+	case kindVariable:
+		v := d.variableValue(o)
+		l = map[string]any{"qText": v.Text, "qNum": qNum(v), "qIsScriptCreated": o.scriptCreated}
+	case kindBookmark:
+		l = map[string]any{"qBookmark": d.bookmarkData(o)}
+	default:
+		l = d.evalProps(o, o.props, true)
+	}
+	l["qInfo"] = o.info()
+	l["qMeta"] = d.meta(o)
+	l["qSelectionInfo"] = map[string]any{}
+	if o.layout != nil {
+		mergeMap(l, cloneMap(o.layout))
+	}
+	return l
+}
+
+func (d *docSession) meta(o *object) map[string]any {
+	meta := map[string]any{}
+	if def, ok := o.props["qMetaDef"].(map[string]any); ok {
+		mergeMap(meta, cloneMap(def))
+	}
+	if o.meta != nil {
+		mergeMap(meta, cloneMap(o.meta))
+	}
+	return meta
+}
+
+func (d *docSession) dimInfos(o *object) []any {
+	ret := make([]any, 0)
+	dim, _ := o.props["qDim"].(map[string]any)
+	defs, _ := dim["qFieldDefs"].([]any)
+	for _, def := range defs {
+		info := map[string]any{"qApprMaxGlyphCount": 0, "qCardinal": 0, "qTags": []any{}, "qIsSemantic": false, "qAndMode": false}
+		if f := d.app.field(fmt.Sprint(def)); f != nil {
+			info["qCardinal"] = len(f.Values)
+			info["qApprMaxGlyphCount"] = maxGlyphs(f.Values)
+			info["qTags"] = toAnySlice(f.Tags)
+		}
+		ret = append(ret, info)
+	}
+	return ret
+}
+
+func (d *docSession) bookmarkData(o *object) map[string]any {
+	fields := make([]any, 0, len(o.bookmark))
+	for field, values := range o.bookmark {
+		fields = append(fields, map[string]any{"qDef": map[string]any{"qName": field}, "qSelectInfo": map[string]any{}, "qValues": toAnySlice(values)})
+	}
+	return map[string]any{
+		"qStateData": []any{map[string]any{"qStateName": DEFAULT_STATE, "qFieldItems": fields}},
+	}
+}
+
+// evalProps turns definitions in props into their layouts, like `qHyperCubeDef` into `qHyperCube`.
+func (d *docSession) evalProps(o *object, props map[string]any, top bool) map[string]any {
+	ret := make(map[string]any, len(props))
+	for k, v := range props {
+		def, _ := v.(map[string]any)
+		switch k {
+		case "qHyperCubeDef":
+			var rows [][]Cell
+			if top {
+				rows = d.cubeData(o, def)
+			}
+			ret["qHyperCube"] = d.hyperCube(o, def, rows, top)
+		case "qListObjectDef":
+			ret["qListObject"] = d.listObject(def)
+		case "qSelectionObjectDef":
+			state, _ := def["qStateName"].(string)
+			ret["qSelectionObject"] = d.selectionObject(state)
+		case "qAppObjectListDef":
+			ret["qAppObjectList"] = d.itemList(def, "")
+		case "qBookmarkListDef":
+			ret["qBookmarkList"] = d.itemList(def, "bookmark")
+		case "qDimensionListDef":
+			ret["qDimensionList"] = d.itemList(def, "dimension")
+		case "qMeasureListDef":
+			ret["qMeasureList"] = d.itemList(def, "measure")
+		case "qVariableListDef":
+			ret["qVariableList"] = d.itemList(def, "variable")
+		case "qFieldListDef":
+			ret["qFieldList"] = d.fieldList()
+		case "qChildListDef":
+			ret["qChildList"] = d.childList(o, def)
+		case "qMetaDef":
+		default:
+			ret[k] = d.evalValue(o, v)
+		}
+	}
+	return ret
+}
+
+func (d *docSession) evalValue(o *object, v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		if expr, ok := val["qStringExpression"]; ok && len(val) == 1 {
+			return d.evaluate(exprOf(expr)).Text
+		}
+		if expr, ok := val["qValueExpression"]; ok && len(val) == 1 {
+			return qNum(d.evaluate(exprOf(expr)))
+		}
+		return d.evalProps(o, val, false)
+	case []any:
+		ret := make([]any, len(val))
+		for i, x := range val {
+			ret[i] = d.evalValue(o, x)
+		}
+		return ret
+	}
+	return v
+}
+
+func exprOf(v any) string {
+	if m, ok := v.(map[string]any); ok {
+		expr, _ := m["qExpr"].(string)
+		return expr
+	}
+	expr, _ := v.(string)
+	return expr
+}
+
+// evaluate looks expr up in the fixture after dollar-sign expansion, it also
+// understands numbers, quoted strings and variable names.
+func (d *docSession) evaluate(expr string) Cell {
+	a := d.app
+	if c, ok := a.expressions[normalizeExpr(expr)]; ok {
+		return c
+	}
+	for i := 0; i < 10 && dollarExpansion.MatchString(expr); i++ {
+		expr = dollarExpansion.ReplaceAllStringFunc(expr, func(m string) string {
+			name := strings.TrimSpace(dollarExpansion.FindStringSubmatch(m)[1])
+			if v := a.variableByName(name); v != nil {
+				return d.variableValue(v).Text
+			}
+			return ""
+		})
+	}
+	e := normalizeExpr(expr)
+	if c, ok := a.expressions[e]; ok {
+		return c
+	}
+	if num, err := strconv.ParseFloat(e, 64); err == nil {
+		return NewNumCell(num)
+	}
+	if len(e) >= 2 && strings.HasPrefix(e, "'") && strings.HasSuffix(e, "'") {
+		return NewTextCell(strings.ReplaceAll(e[1:len(e)-1], "''", "'"))
+	}
+	if v := a.variableByName(e); v != nil {
+		return d.variableValue(v)
+	}
+	return NewTextCell("Error: unknown expression " + e)
+}
+
+func (d *docSession) variableValue(o *object) Cell {
+	def, _ := o.props["qDefinition"].(string)
+	if strings.HasPrefix(strings.TrimSpace(def), "=") {
+		return d.evaluate(def)
+	}
+	if num, err := strconv.ParseFloat(strings.TrimSpace(def), 64); err == nil {
+		return NewNumCell(num)
+	}
+	return NewTextCell(def)
+}
+
+func (d *docSession) hyperCube(o *object, def map[string]any, rows [][]Cell, top bool) map[string]any {
+	dims, _ := def["qDimensions"].([]any)
+	measures, _ := def["qMeasures"].([]any)
+	nd, nm := len(dims), len(measures)
+
+	dimInfos := make([]any, 0, nd)
+	for i, dim := range dims {
+		title, fieldDefs := d.dimensionTitle(dim)
+		col := column(rows, i)
+		dimInfos = append(dimInfos, map[string]any{
+			"qFallbackTitle":       title,
+			"qApprMaxGlyphCount":   maxGlyphs(col),
+			"qCardinal":            distinct(col),
+			"qSortIndicator":       "A",
+			"qGroupFallbackTitles": []any{title},
+			"qGroupPos":            0,
+			"qGroupFieldDefs":      toAnySlice(fieldDefs),
+			"qStateCounts":         map[string]any{},
+			"qTags":                []any{},
+			"qDimensionType":       "D",
+			"qGrouping":            "N",
+			"qNumFormat":           map[string]any{"qType": "U", "qnDec": 0, "qUseThou": 0},
+			"qIsAutoFormat":        true,
+			"qMin":                 "NaN",
+			"qMax":                 "NaN",
+			"qAttrExprInfo":        []any{},
+			"qAttrDimInfo":         []any{},
+		})
+	}
+	measureInfos := make([]any, 0, nm)
+	totals := make([]any, 0, nm)
+	for i, m := range measures {
+		col := column(rows, nd+i)
+		minV, maxV, sum, numeric := numStats(col)
+		info := map[string]any{
+			"qFallbackTitle":     d.measureTitle(m),
+			"qApprMaxGlyphCount": maxGlyphs(col),
+			"qCardinal":          0,
+			"qSortIndicator":     "N",
+			"qNumFormat":         map[string]any{"qType": "U", "qnDec": 0, "qUseThou": 0},
+			"qIsAutoFormat":      true,
+			"qMin":               "NaN",
+			"qMax":               "NaN",
+			"qAttrExprInfo":      []any{},
+			"qAttrDimInfo":       []any{},
+		}
+		total := map[string]any{"qText": "-", "qNum": "NaN", "qElemNumber": -1, "qState": "L"}
+		if numeric {
+			info["qMin"], info["qMax"] = minV, maxV
+			total["qText"], total["qNum"] = formatNum(sum), sum
+		}
+		measureInfos = append(measureInfos, info)
+		totals = append(totals, total)
+	}
+
+	mode, _ := def["qMode"].(string)
+	if mode == "" {
+		mode = "S"
+	}
+	size := map[string]any{"qcx": nd + nm, "qcy": len(rows)}
+	if top && (mode == "P" || mode == "K") && o.pivotPage != nil {
+		area, _ := o.pivotPage["qArea"].(map[string]any)
+		size = map[string]any{"qcx": area["qWidth"], "qcy": area["qHeight"]}
+	}
+	noOfLeftDims := nd
+	if n, ok := def["qNoOfLeftDims"].(float64); ok && n >= 0 {
+		noOfLeftDims = int(n)
+	}
+	sortOrder := make([]any, 0, nd+nm)
+	if order, ok := def["qInterColumnSortOrder"].([]any); ok && len(order) > 0 {
+		sortOrder = order
+	} else {
+		for i := 0; i < nd+nm; i++ {
+			sortOrder = append(sortOrder, i)
+		}
+	}
+
+	state, _ := def["qStateName"].(string)
+	dataPages := []any{}
+	if mode == "S" {
+		if fetch, ok := def["qInitialDataFetch"].([]any); ok {
+			dataPages = d.dataPages(rows, nd, fetch)
+		}
+	}
+
+	return map[string]any{
+		"qStateName":                     stateOf(state),
+		"qSize":                          size,
+		"qDimensionInfo":                 dimInfos,
+		"qMeasureInfo":                   measureInfos,
+		"qEffectiveInterColumnSortOrder": sortOrder,
+		"qGrandTotalRow":                 totals,
+		"qDataPages":                     dataPages,
+		"qPivotDataPages":                []any{},
+		"qStackedDataPages":              []any{},
+		"qMode":                          mode,
+		"qNoOfLeftDims":                  noOfLeftDims,
+		"qIndentMode":                    false,
+		"qLastExpandedPos":               map[string]any{"qx": 0, "qy": 0},
+		"qHasOtherValues":                false,
+		"qTitle":                         "",
+		"qColumnOrder":                   []any{},
+	}
+}
+
+func (d *docSession) dimensionTitle(v any) (string, []string) {
+	dim, _ := v.(map[string]any)
+	if libId, ok := dim["qLibraryId"].(string); ok && libId != "" {
+		if lib := d.app.get(kindDimension, libId); lib != nil {
+			ldim, _ := lib.props["qDim"].(map[string]any)
+			defs := stringsOf(ldim["qFieldDefs"])
+			if labels := stringsOf(ldim["qFieldLabels"]); len(labels) > 0 && labels[0] != "" {
+				return labels[0], defs
+			}
+			if title, _ := ldim["title"].(string); title != "" {
+				return title, defs
+			}
+			if len(defs) > 0 {
+				return defs[0], defs
+			}
+		}
+		return libId, nil
+	}
+	def, _ := dim["qDef"].(map[string]any)
+	defs := stringsOf(def["qFieldDefs"])
+	if labels := stringsOf(def["qFieldLabels"]); len(labels) > 0 && labels[0] != "" {
+		return labels[0], defs
+	}
+	if len(defs) > 0 {
+		return defs[0], defs
+	}
+	return "", defs
+}
+
+func (d *docSession) measureTitle(v any) string {
+	m, _ := v.(map[string]any)
+	if libId, ok := m["qLibraryId"].(string); ok && libId != "" {
+		if lib := d.app.get(kindMeasure, libId); lib != nil {
+			lm, _ := lib.props["qMeasure"].(map[string]any)
+			if label, _ := lm["qLabel"].(string); label != "" {
+				return label
+			}
+			meta, _ := lib.props["qMetaDef"].(map[string]any)
+			if title, _ := meta["title"].(string); title != "" {
+				return title
+			}
+			def, _ := lm["qDef"].(string)
+			return def
+		}
+		return libId
+	}
+	def, _ := m["qDef"].(map[string]any)
+	if label, _ := def["qLabel"].(string); label != "" {
+		return label
+	}
+	expr, _ := def["qDef"].(string)
+	return expr
+}
+
+// dataPages returns pages of rows clipped to the data, the first nd columns are dimensions.
+func (d *docSession) dataPages(rows [][]Cell, nd int, pages []any) []any {
+	ret := make([]any, 0, len(pages))
+	width := 0
+	if len(rows) > 0 {
+		width = len(rows[0])
+	}
+	for _, p := range pages {
+		page, _ := p.(map[string]any)
+		left, top := intOf(page["qLeft"]), intOf(page["qTop"])
+		right := min(left+intOf(page["qWidth"]), width)
+		bottom := min(top+intOf(page["qHeight"]), len(rows))
+		matrix := make([]any, 0)
+		for r := top; r < bottom; r++ {
+			row := make([]any, 0)
+			for c := left; c < right && c < len(rows[r]); c++ {
+				row = append(row, d.cell(rows[r][c], r, c < nd))
+			}
+			matrix = append(matrix, row)
+		}
+		area := map[string]any{"qLeft": left, "qTop": top, "qWidth": max(right-left, 0), "qHeight": max(bottom-top, 0)}
+		ret = append(ret, map[string]any{"qMatrix": matrix, "qTails": []any{}, "qArea": area, "qIsReduced": false})
+	}
+	return ret
+}
+
+func (d *docSession) cell(c Cell, row int, isDim bool) map[string]any {
+	ret := map[string]any{"qText": c.Text, "qNum": qNum(c), "qElemNumber": row, "qState": "O"}
+	if !isDim {
+		ret["qElemNumber"] = 0
+		ret["qState"] = "L"
+	}
+	return ret
+}
+
+func (d *docSession) listObject(def map[string]any) map[string]any {
+	inline, _ := def["qDef"].(map[string]any)
+	defs := stringsOf(inline["qFieldDefs"])
+	state, _ := def["qStateName"].(string)
+	name := ""
+	if len(defs) > 0 {
+		name = defs[0]
+	}
+	info := map[string]any{
+		"qFallbackTitle":  name,
+		"qGroupFieldDefs": toAnySlice(defs),
+		"qTags":           []any{},
+		"qCardinal":       0,
+		"qSortIndicator":  "A",
+		"qDimensionType":  "D",
+		"qGrouping":       "N",
+		"qNumFormat":      map[string]any{"qType": "U", "qnDec": 0, "qUseThou": 0},
+		"qStateCounts":    map[string]any{},
+	}
+	ret := map[string]any{
+		"qStateName":     stateOf(state),
+		"qSize":          map[string]any{"qcx": 1, "qcy": 0},
+		"qDimensionInfo": info,
+		"qDataPages":     []any{},
+	}
+	f := d.app.field(name)
+	if f == nil {
+		info["qError"] = map[string]any{"qErrorCode": 6}
+		return ret
+	}
+
+	selected := 0
+	for _, v := range f.Values {
+		if ok, _ := d.state(state).isSelected(f.Name, v.Text); ok {
+			selected++
+		}
+	}
+	info["qTags"] = toAnySlice(f.Tags)
+	info["qCardinal"] = len(f.Values)
+	info["qApprMaxGlyphCount"] = maxGlyphs(f.Values)
+	info["qStateCounts"] = map[string]any{"qSelected": selected, "qOption": len(f.Values) - selected}
+	ret["qSize"] = map[string]any{"qcx": 1, "qcy": len(f.Values)}
+	if fetch, ok := def["qInitialDataFetch"].([]any); ok {
+		ret["qDataPages"] = d.listPages(state, f, fetch)
+	}
+	return ret
+}
+
+func (d *docSession) listPages(state string, f *Field, pages []any) []any {
+	ret := make([]any, 0, len(pages))
+	rows := d.app.joined()
+	for _, p := range pages {
+		page, _ := p.(map[string]any)
+		top := intOf(page["qTop"])
+		bottom := min(top+intOf(page["qHeight"]), len(f.Values))
+		matrix := make([]any, 0)
+		for r := top; r < bottom; r++ {
+			v := f.Values[r]
+			cell := map[string]any{"qText": v.Text, "qNum": qNum(v), "qElemNumber": r, "qState": "O"}
+			s := d.state(state)
+			if selected, has := s.isSelected(f.Name, v.Text); selected {
+				cell["qState"] = "S"
+				if s.locked[f.Name] {
+					cell["qState"] = "L"
+				}
+				if s.excludes(rows, f.Name, v.Text) {
+					cell["qState"] = "X" + cell["qState"].(string)
+				}
+			} else if has {
+				cell["qState"] = "X"
+			}
+			matrix = append(matrix, []any{cell})
+		}
+		area := map[string]any{"qLeft": 0, "qTop": top, "qWidth": 1, "qHeight": max(bottom-top, 0)}
+		ret = append(ret, map[string]any{"qMatrix": matrix, "qTails": []any{}, "qArea": area, "qIsReduced": false})
+	}
+	return ret
+}
+
+func (d *docSession) selectionObject(state string) map[string]any {
+	s := d.state(state)
+	selections := make([]any, 0, len(s.fields))
+	for _, field := range s.fields {
+		values := s.values[field]
+		total := len(values)
+		if f := d.app.field(field); f != nil {
+			total = len(f.Values)
+		}
+		text := strings.Join(values, ", ")
+		if len(values) > MAX_VISIBLE_VALUES {
+			text = fmt.Sprintf("%d of %d", len(values), total)
+		}
+		infos := make([]any, len(values))
+		for i, v := range values {
+			infos[i] = map[string]any{"qName": v, "qFieldSelectionMode": "NORMAL"}
+		}
+		selections = append(selections, map[string]any{
+			"qField":                         field,
+			"qSelected":                      text,
+			"qSelectedCount":                 len(values),
+			"qTotal":                         total,
+			"qLocked":                        s.locked[field],
+			"qIsNum":                         false,
+			"qSelectedFieldSelectionInfo":    infos,
+			"qNotSelectedFieldSelectionInfo": []any{},
+			"qStateCounts":                   map[string]any{"qSelected": len(values), "qExcluded": total - len(values)},
+			"qRangeInfo":                     []any{},
+		})
+	}
+	return map[string]any{"qStateName": stateOf(state), "qBackCount": 0, "qForwardCount": 0, "qSelections": selections}
+}
+
+// itemList lists objects of `qType` in def, resolving paths in `qData` against their layouts.
+func (d *docSession) itemList(def map[string]any, typ string) map[string]any {
+	if t, ok := def["qType"].(string); ok && t != "" {
+		typ = t
+	}
+	data, _ := def["qData"].(map[string]any)
+	items := make([]any, 0)
+	for _, o := range d.app.ofType(typ) {
+		items = append(items, d.item(o, data))
+	}
+	return map[string]any{"qItems": items}
+}
+
+func (d *docSession) item(o *object, data map[string]any) map[string]any {
+	var layout map[string]any
+	resolved := make(map[string]any, len(data))
+	for k, v := range data {
+		p, ok := v.(string)
+		if !ok || !strings.HasPrefix(p, "/") {
+			resolved[k] = v
+			continue
+		}
+		if val, ok := pointer(o.props, p); ok {
+			resolved[k] = val
+			continue
+		}
+		if layout == nil {
+			layout = d.layout(o)
+		}
+		if val, ok := pointer(layout, p); ok {
+			resolved[k] = val
+		}
+	}
+	return map[string]any{"qInfo": o.info(), "qMeta": d.meta(o), "qData": resolved}
+}
+
+func (d *docSession) fieldList() map[string]any {
+	items := make([]any, 0, len(d.app.fields))
+	for _, f := range d.app.fields {
+		items = append(items, map[string]any{"qName": f.Name, "qCardinal": len(f.Values), "qTags": toAnySlice(f.Tags)})
+	}
+	return map[string]any{"qItems": items}
+}
+
+func (d *docSession) childList(o *object, def map[string]any) map[string]any {
+	data, _ := def["qData"].(map[string]any)
+	items := make([]any, 0, len(o.children))
+	for _, id := range o.children {
+		if child := d.app.objects[id]; child != nil {
+			items = append(items, d.item(child, data))
+		}
+	}
+	return map[string]any{"qItems": items}
+}
+
+// pointer resolves a json pointer like `/qMetaDef/title` in v.
+func pointer(v any, p string) (any, bool) {
+	if p == "" || p == "/" {
+		return v, true
+	}
+	for _, token := range strings.Split(strings.TrimPrefix(p, "/"), "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		switch val := v.(type) {
+		case map[string]any:
+			next, ok := val[token]
+			if !ok {
+				return nil, false
+			}
+			v = next
+		case []any:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(val) {
+				return nil, false
+			}
+			v = val[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// mergeMap merges src into dst recursively, values of src win.
+func mergeMap(dst, src map[string]any) {
+	for k, v := range src {
+		sv, ok1 := v.(map[string]any)
+		dv, ok2 := dst[k].(map[string]any)
+		if ok1 && ok2 {
+			mergeMap(dv, sv)
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+func qNum(c Cell) any {
+	if c.Num == nil || math.IsNaN(*c.Num) {
+		return "NaN"
+	}
+	return *c.Num
+}
+
+func column(rows [][]Cell, i int) []Cell {
+	ret := make([]Cell, 0, len(rows))
+	for _, row := range rows {
+		if i < len(row) {
+			ret = append(ret, row[i])
+		}
+	}
+	return ret
+}
+
+func maxGlyphs(cells []Cell) int {
+	ret := 0
+	for _, c := range cells {
+		ret = max(ret, len([]rune(c.Text)))
+	}
+	return ret
+}
+
+func distinct(cells []Cell) int {
+	seen := make(map[string]bool)
+	for _, c := range cells {
+		seen[c.Text] = true
+	}
+	return len(seen)
+}
+
+func numStats(cells []Cell) (minV, maxV, sum float64, numeric bool) {
+	minV, maxV = math.Inf(1), math.Inf(-1)
+	for _, c := range cells {
+		if c.Num == nil {
+			continue
+		}
+		numeric = true
+		minV, maxV = math.Min(minV, *c.Num), math.Max(maxV, *c.Num)
+		sum += *c.Num
+	}
+	return
+}
+
+func stringsOf(v any) []string {
+	arr, _ := v.([]any)
+	ret := make([]string, 0, len(arr))
+	for _, x := range arr {
+		if s, ok := x.(string); ok {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+func intOf(v any) int {
+	switch n := v.(type) {
+	case float64:
+		return int(n)
+	case int:
+		return n
+	}
+	return 0
+}
@@ -0,0 +1,169 @@
+package enginetest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// error codes of the engine
+const (
+	ERR_INVALID_PARAMS   int = -32602
+	ERR_METHOD_NOT_FOUND int = -32601
+	ERR_INVALID_HANDLE   int = -32000
+	ERR_NOT_FOUND        int = 2
+	ERR_ALREADY_EXISTS   int = 3
+	ERR_APP_ALREADY_OPEN int = 1002
+	ERR_APP_NOT_FOUND    int = 1003
+	ERR_NO_OPEN_APP      int = 1007
+
+	GLOBAL_HANDLE int = -1
+)
+
+// Call is a request received by Server.
+type Call struct {
+	Handle int             `json:"handle"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+// Server is a fake engine listening on a local port, connect to `URL` with desktop auth mode.
+type Server struct {
+	URL string // ws://127.0.0.1:<port>/app
+
+	http     *httptest.Server
+	upgrader websocket.Upgrader
+
+	mu    sync.Mutex
+	apps  map[string]*app
+	conns map[*websocket.Conn]struct{}
+	calls []Call
+}
+
+func NewServer(f *Fixture) *Server {
+	s := &Server{
+		upgrader: websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }},
+		apps:     make(map[string]*app),
+		conns:    make(map[*websocket.Conn]struct{}),
+	}
+	if f != nil {
+		for _, a := range f.Apps {
+			s.apps[a.Id] = newApp(a)
+		}
+	}
+	s.http = httptest.NewServer(http.HandlerFunc(s.serve))
+	s.URL = "ws" + strings.TrimPrefix(s.http.URL, "http") + "/app"
+	return s
+}
+
+// Close drops all connections and stops listening.
+func (s *Server) Close() {
+	s.DropConnections()
+	s.http.Close()
+}
+
+// DropConnections closes all websockets as if the engine restarted, apps are kept.
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	conns := make([]*websocket.Conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+	for _, c := range conns {
+		c.Close()
+	}
+}
+
+// Calls returns requests received so far from all connections.
+func (s *Server) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Call{}, s.calls...)
+}
+
+// Methods returns method names of `Calls`.
+func (s *Server) Methods() []string {
+	calls := s.Calls()
+	ret := make([]string, len(calls))
+	for i, c := range calls {
+		ret[i] = c.Method
+	}
+	return ret
+}
+
+func (s *Server) ResetCalls() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = nil
+}
+
+func (s *Server) app(id string) *app {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.apps[id]
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	s.conns[conn] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	sess := newSession(s)
+	if err := conn.WriteJSON(map[string]any{
+		"jsonrpc": "2.0",
+		"method":  "OnConnected",
+		"params":  map[string]any{"qSessionState": "SESSION_CREATED"},
+	}); err != nil {
+		return
+	}
+	for {
+		var req struct {
+			Id     int               `json:"id"`
+			Handle int               `json:"handle"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		_, buf, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		resp := map[string]any{"jsonrpc": "2.0"}
+		if err := json.Unmarshal(buf, &req); err != nil {
+			resp["error"] = rpcError{Code: ERR_INVALID_PARAMS, Message: err.Error()}
+		} else {
+			var raw struct {
+				Params json.RawMessage `json:"params"`
+			}
+			_ = json.Unmarshal(buf, &raw)
+			s.mu.Lock()
+			s.calls = append(s.calls, Call{Handle: req.Handle, Method: req.Method, Params: raw.Params})
+			s.mu.Unlock()
+
+			resp["id"] = req.Id
+			result, rerr := sess.call(req.Handle, req.Method, req.Params)
+			if rerr != nil {
+				resp["error"] = rerr
+			} else {
+				resp["result"] = result
+			}
+		}
+		if err := conn.WriteJSON(resp); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package enginetest
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/qlik-oss/enigma-go/v4"
+)
+
+func openSales(t *testing.T) (*Server, *enigma.Global, *enigma.Doc) {
+	t.Helper()
+	srv := NewServer(SalesFixture())
+	t.Cleanup(srv.Close)
+	global, err := enigma.Dialer{}.Dial(context.Background(), srv.URL+"/sales", nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { global.DisconnectFromServer() })
+	doc, err := global.OpenDoc(context.Background(), "sales", "", "", "", false)
+	if err != nil {
+		t.Fatalf("OpenDoc: %v", err)
+	}
+	return srv, global, doc
+}
+
+func TestParseFixture(t *testing.T) {
+	tests := []struct {
+		name    string
+		buf     string
+		isJson  bool
+		wantErr bool
+	}{
+		{"yaml", "apps: [{id: a, fields: [{name: F, values: [x, 1]}]}]", false, false},
+		{"json", `{"apps":[{"id":"a","objects":[{"id":"o1","type":"sheet"}]}]}`, true, false},
+		{"no app id", "apps: [{title: a}]", false, true},
+		{"duplicated id", "apps: [{id: a, objects: [{id: o, type: t}, {id: o, type: t}]}]", false, true},
+		{"missing parent", "apps: [{id: a, objects: [{id: o, type: t, parent: p}]}]", false, true},
+		{"table", "apps: [{id: a, fields: [{name: F}], tables: [{name: T, fields: [F], rows: [[1]]}]}]", false, false},
+		{"unknown table field", "apps: [{id: a, tables: [{name: T, fields: [F]}]}]", false, true},
+		{"invalid table row", "apps: [{id: a, fields: [{name: F}], tables: [{name: T, fields: [F], rows: [[1, 2]]}]}]", false, true},
+		{"invalid yaml", "apps: [", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, res := ParseFixture([]byte(tt.buf), tt.isJson)
+			if (res != nil) != tt.wantErr {
+				t.Errorf("ParseFixture() error = %v, wantErr %v", res, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCell_Unmarshal(t *testing.T) {
+	f, res := ParseFixture([]byte("apps: [{id: a, fields: [{name: F, values: [x, 1.5, {text: '2', num: 2}]}]}]"), false)
+	if res != nil {
+		t.Fatalf("ParseFixture: %v", res)
+	}
+	values := f.Apps[0].Fields[0].Values
+	if values[0].IsNumeric() || values[0].Text != "x" {
+		t.Errorf("values[0] = %+v", values[0])
+	}
+	if !values[1].IsNumeric() || *values[1].Num != 1.5 || values[1].Text != "1.5" {
+		t.Errorf("values[1] = %+v", values[1])
+	}
+	if !values[2].IsNumeric() || values[2].Text != "2" {
+		t.Errorf("values[2] = %+v", values[2])
+	}
+}
+
+func TestServer_OpenDoc(t *testing.T) {
+	srv := NewServer(SalesFixture())
+	defer srv.Close()
+	ctx := context.Background()
+	global, err := enigma.Dialer{}.Dial(ctx, srv.URL+"/unknown", nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer global.DisconnectFromServer()
+
+	if _, err := global.OpenDoc(ctx, "unknown", "", "", "", false); err == nil {
+		t.Errorf("OpenDoc(unknown) should fail")
+	}
+	if _, err := global.OpenDoc(ctx, "sales", "", "", "", false); err != nil {
+		t.Fatalf("OpenDoc: %v", err)
+	}
+	if _, err := global.OpenDoc(ctx, "sales", "", "", "", false); err == nil {
+		t.Errorf("OpenDoc twice should fail")
+	}
+	methods := srv.Methods()
+	if len(methods) != 3 || methods[0] != "OpenDoc" {
+		t.Errorf("Methods() = %v", methods)
+	}
+}
+
+func TestServer_HyperCube(t *testing.T) {
+	_, _, doc := openSales(t)
+	ctx := context.Background()
+	obj, err := doc.GetObject(ctx, "tbl-sales")
+	if err != nil || obj.Handle == 0 {
+		t.Fatalf("GetObject: %v", err)
+	}
+	layout, err := obj.GetLayout(ctx)
+	if err != nil {
+		t.Fatalf("GetLayout: %v", err)
+	}
+	hc := layout.HyperCube
+	if hc.Size.Cx != 4 || hc.Size.Cy != 5 {
+		t.Errorf("qSize = %+v", hc.Size)
+	}
+	if hc.DimensionInfo[1].FallbackTitle != "Product" || hc.MeasureInfo[1].FallbackTitle != "Margin" {
+		t.Errorf("titles = %s, %s", hc.DimensionInfo[1].FallbackTitle, hc.MeasureInfo[1].FallbackTitle)
+	}
+	if len(hc.DataPages) != 1 || len(hc.DataPages[0].Matrix) != 5 {
+		t.Fatalf("qDataPages = %v", hc.DataPages)
+	}
+	if cell := hc.DataPages[0].Matrix[3][2]; cell.Text != "150" || float64(cell.Num) != 150 {
+		t.Errorf("cell = %+v", cell)
+	}
+
+	pages, err := obj.GetHyperCubeData(ctx, "/qHyperCubeDef", []*enigma.NxPage{{Top: 2, Left: 0, Width: 4, Height: 10}})
+	if err != nil {
+		t.Fatalf("GetHyperCubeData: %v", err)
+	}
+	if len(pages[0].Matrix) != 3 || pages[0].Matrix[0][0].Text != "North" {
+		t.Errorf("GetHyperCubeData = %v", pages[0].Matrix)
+	}
+
+	if obj, _ := doc.GetObject(ctx, "missing"); obj.Handle != 0 {
+		t.Errorf("GetObject(missing) handle = %d", obj.Handle)
+	}
+}
+
+func TestServer_Selections(t *testing.T) {
+	_, _, doc := openSales(t)
+	ctx := context.Background()
+	field, err := doc.GetField(ctx, "Region", "")
+	if err != nil {
+		t.Fatalf("GetField: %v", err)
+	}
+	if ok, err := field.SelectValues(ctx, []*enigma.FieldValue{{Text: "West"}}, false, false); err != nil || !ok {
+		t.Fatalf("SelectValues: %v, %v", ok, err)
+	}
+	if ok, err := doc.ApplyBookmark(ctx, "bm-bikes-2024"); err != nil || !ok {
+		t.Fatalf("ApplyBookmark: %v, %v", ok, err)
+	}
+
+	obj, err := doc.CreateSessionObject(ctx, &enigma.GenericObjectProperties{
+		Info:               &enigma.NxInfo{Type: "CurrentSelections"},
+		SelectionObjectDef: &enigma.SelectionObjectDef{},
+	})
+	if err != nil {
+		t.Fatalf("CreateSessionObject: %v", err)
+	}
+	layout, err := obj.GetLayout(ctx)
+	if err != nil {
+		t.Fatalf("GetLayout: %v", err)
+	}
+	got := make(map[string]string)
+	for _, s := range layout.SelectionObject.Selections {
+		got[s.Field] = s.Selected
+	}
+	want := map[string]string{"Product": "Bikes", "Year": "2024"}
+	if len(got) != len(want) || got["Product"] != want["Product"] || got["Year"] != want["Year"] {
+		t.Errorf("selections = %v, want %v", got, want)
+	}
+
+	if err := doc.ClearAll(ctx, false, ""); err != nil {
+		t.Fatalf("ClearAll: %v", err)
+	}
+	layout, _ = obj.GetLayout(ctx)
+	if len(layout.SelectionObject.Selections) != 0 {
+		t.Errorf("selections after ClearAll = %v", layout.SelectionObject.Selections)
+	}
+}
+
+func TestServer_Evaluate(t *testing.T) {
+	_, _, doc := openSales(t)
+	ctx := context.Background()
+	tests := []struct {
+		expr    string
+		text    string
+		numeric bool
+	}{
+		{"=Sum(Sales)", "430", true},
+		{"Sum(Sales) * vMarginRate", "107.5", true},
+		{"$(vCurrentYear)", "2024", true},
+		{"vTitle", "Sales Overview", false},
+		{"'abc'", "abc", false},
+		{"42", "42", true},
+		{"Unknown()", "Error: unknown expression Unknown()", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			v, err := doc.EvaluateEx(ctx, tt.expr)
+			if err != nil {
+				t.Fatalf("EvaluateEx: %v", err)
+			}
+			if v.Text != tt.text || v.IsNumeric != tt.numeric {
+				t.Errorf("EvaluateEx(%s) = %s/%v, want %s/%v", tt.expr, v.Text, v.IsNumeric, tt.text, tt.numeric)
+			}
+		})
+	}
+}
+
+func TestServer_Variables(t *testing.T) {
+	_, _, doc := openSales(t)
+	ctx := context.Background()
+	v, err := doc.GetVariableByName(ctx, "vMarginRate")
+	if err != nil {
+		t.Fatalf("GetVariableByName: %v", err)
+	}
+	if err := v.SetNumValue(ctx, 0.5); err != nil {
+		t.Fatalf("SetNumValue: %v", err)
+	}
+	raw, err := v.GetLayoutRaw(ctx)
+	if err != nil {
+		t.Fatalf("GetLayoutRaw: %v", err)
+	}
+	var layout struct {
+		Text string  `json:"qText"`
+		Num  float64 `json:"qNum"`
+	}
+	if err := json.Unmarshal(raw, &layout); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if layout.Text != "0.5" || layout.Num != 0.5 {
+		t.Errorf("layout = %+v", layout)
+	}
+	if _, err := doc.GetVariableByName(ctx, "vMissing"); err == nil {
+		t.Errorf("GetVariableByName(vMissing) should fail")
+	}
+}
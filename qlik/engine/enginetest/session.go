@@ -0,0 +1,671 @@
+package enginetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+type rpcError struct {
+	Code      int    `json:"code"`
+	Parameter string `json:"parameter,omitempty"`
+	Message   string `json:"message"`
+}
+
+func errorf(code int, parameter string, format string, args ...any) *rpcError {
+	return &rpcError{Code: code, Parameter: parameter, Message: fmt.Sprintf(format, args...)}
+}
+
+// infoId returns `qInfo.qId` of props, or "" if the engine generates it.
+func infoId(props map[string]any) string {
+	info, _ := props["qInfo"].(map[string]any)
+	id, _ := info["qId"].(string)
+	return id
+}
+
+// handle is a remote object of a session.
+type handle struct {
+	kind  string // Doc, Field or kind of object
+	id    string // object id or field name
+	state string // state of a field
+}
+
+type session struct {
+	server  *Server
+	handles map[int]*handle
+	next    int
+	doc     *docSession
+
+	progress map[string]any // progress of the last reload not yet returned by GetProgress
+}
+
+func newSession(s *Server) *session {
+	return &session{server: s, handles: make(map[int]*handle)}
+}
+
+func (s *session) newHandle(h *handle, genericType string) map[string]any {
+	s.next++
+	s.handles[s.next] = h
+	return map[string]any{"qReturn": map[string]any{
+		"qType":        h.kind,
+		"qHandle":      s.next,
+		"qGenericType": genericType,
+		"qGenericId":   h.id,
+	}}
+}
+
+func (s *session) objectHandle(o *object) map[string]any {
+	if o == nil {
+		return map[string]any{"qReturn": map[string]any{"qType": kindObject, "qHandle": nil, "qGenericType": "", "qGenericId": ""}}
+	}
+	return s.newHandle(&handle{kind: o.kind, id: o.id}, o.typ)
+}
+
+// args decodes params in order into ptrs, missing params are left as zero values.
+func args(params []json.RawMessage, ptrs ...any) *rpcError {
+	for i, p := range ptrs {
+		if i >= len(params) {
+			break
+		}
+		if err := json.Unmarshal(params[i], p); err != nil {
+			return errorf(ERR_INVALID_PARAMS, fmt.Sprintf("param[%d]", i), "%s", err.Error())
+		}
+	}
+	return nil
+}
+
+func (s *session) call(h int, method string, params []json.RawMessage) (any, *rpcError) {
+	if h == GLOBAL_HANDLE {
+		return s.callGlobal(method, params)
+	}
+	hd, ok := s.handles[h]
+	if !ok {
+		return nil, errorf(ERR_INVALID_HANDLE, fmt.Sprint(h), "Invalid handle")
+	}
+
+	a := s.doc.app
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch hd.kind {
+	case "Doc":
+		return s.callDoc(method, params)
+	case "Field":
+		return s.callField(hd, method, params)
+	}
+	o := s.doc.get(hd.kind, hd.id)
+	if o == nil {
+		return nil, errorf(ERR_NOT_FOUND, hd.id, "Object not found")
+	}
+	return s.callObject(o, method, params)
+}
+
+func (s *session) callGlobal(method string, params []json.RawMessage) (any, *rpcError) {
+	switch method {
+	case "OpenDoc":
+		var appId string
+		if err := args(params, &appId); err != nil {
+			return nil, err
+		}
+		if s.doc != nil {
+			return nil, errorf(ERR_APP_ALREADY_OPEN, appId, "App already open")
+		}
+		a := s.server.app(appId)
+		if a == nil {
+			return nil, errorf(ERR_APP_NOT_FOUND, appId, "App not found")
+		}
+		s.doc = newDocSession(a)
+		return s.newHandle(&handle{kind: "Doc", id: appId}, ""), nil
+	case "GetActiveDoc":
+		if s.doc == nil {
+			return nil, errorf(ERR_NO_OPEN_APP, "", "No active document")
+		}
+		return s.newHandle(&handle{kind: "Doc", id: s.doc.app.id}, ""), nil
+	case "EngineVersion":
+		return map[string]any{"qVersion": map[string]any{"qComponentVersion": "enginetest"}}, nil
+	case "ProductVersion":
+		return map[string]any{"qReturn": "enginetest"}, nil
+	case "IsDesktopMode":
+		return map[string]any{"qReturn": true}, nil
+	case "GetProgress":
+		progress := s.progress
+		if progress == nil {
+			progress = map[string]any{}
+		}
+		s.progress = nil
+		return map[string]any{"qProgressData": progress}, nil
+	case "GetAuthenticatedUser":
+		return map[string]any{"qReturn": "UserDirectory=enginetest; UserId=tester"}, nil
+	case "GetDocList":
+		s.server.mu.Lock()
+		defer s.server.mu.Unlock()
+		docs := make([]any, 0, len(s.server.apps))
+		for _, a := range s.server.apps {
+			docs = append(docs, map[string]any{"qDocName": a.title, "qDocId": a.id, "qTitle": a.title})
+		}
+		return map[string]any{"qDocList": docs}, nil
+	}
+	return nil, errorf(ERR_METHOD_NOT_FOUND, method, "Method not found")
+}
+
+func (s *session) callDoc(method string, params []json.RawMessage) (any, *rpcError) {
+	d := s.doc
+	a := d.app
+	switch method {
+	case "GetAppLayout":
+		return map[string]any{"qLayout": map[string]any{
+			"qTitle":      a.title,
+			"qFileName":   a.id,
+			"qHasScript":  a.script != "",
+			"qHasData":    len(a.fields) > 0,
+			"qStateNames": toAnySlice(a.states),
+			"qMeta":       map[string]any{"qName": a.title},
+		}}, nil
+	case "GetAppProperties":
+		props := cloneMap(a.props)
+		props["qTitle"] = a.title
+		return map[string]any{"qProp": props}, nil
+	case "SetAppProperties":
+		var props map[string]any
+		if err := args(params, &props); err != nil {
+			return nil, err
+		}
+		if title, ok := props["qTitle"].(string); ok {
+			a.title = title
+		}
+		a.props = props
+		return map[string]any{}, nil
+	case "GetScript":
+		return map[string]any{"qScript": a.script}, nil
+	case "SetScript":
+		if err := args(params, &a.script); err != nil {
+			return nil, err
+		}
+		return map[string]any{}, nil
+	case "DoReload", "DoReloadEx":
+		success, progress := a.reload()
+		s.progress = progress
+		return map[string]any{"qReturn": success, "qResult": map[string]any{"qSuccess": success, "qScriptLogFile": a.id + ".log"}}, nil
+	case "GetTablesAndKeys":
+		return a.tablesAndKeys(), nil
+	case "GetFieldDescription":
+		var name string
+		if err := args(params, &name); err != nil {
+			return nil, err
+		}
+		desc := a.fieldDescription(name)
+		if desc == nil {
+			return nil, errorf(ERR_NOT_FOUND, name, "Field not found")
+		}
+		return map[string]any{"qReturn": desc}, nil
+	case "GetTableData":
+		var offset, rows int
+		var synthetic bool
+		var name string
+		if err := args(params, &offset, &rows, &synthetic, &name); err != nil {
+			return nil, err
+		}
+		return map[string]any{"qData": a.tableData(name, offset, rows)}, nil
+	case "CheckScriptSyntax":
+		return map[string]any{"qErrors": []any{}}, nil
+	case "DoSave":
+		return map[string]any{}, nil
+	case "Evaluate":
+		var expr string
+		if err := args(params, &expr); err != nil {
+			return nil, err
+		}
+		return map[string]any{"qReturn": d.evaluate(expr).Text}, nil
+	case "EvaluateEx":
+		var expr string
+		if err := args(params, &expr); err != nil {
+			return nil, err
+		}
+		v := d.evaluate(expr)
+		return map[string]any{"qValue": map[string]any{"qText": v.Text, "qIsNumeric": v.IsNumeric(), "qNumber": qNum(v)}}, nil
+
+	case "GetObjects":
+		var opts struct {
+			Types []string `json:"qTypes"`
+		}
+		if err := args(params, &opts); err != nil {
+			return nil, err
+		}
+		list := make([]any, 0)
+		for _, typ := range opts.Types {
+			for _, o := range a.ofType(typ) {
+				if o.kind == kindObject && o.parent == "" {
+					list = append(list, map[string]any{"qInfo": o.info(), "qMeta": d.meta(o), "qData": map[string]any{}})
+				}
+			}
+		}
+		return map[string]any{"qList": list}, nil
+	case "GetObject":
+		var id string
+		if err := args(params, &id); err != nil {
+			return nil, err
+		}
+		return s.objectHandle(d.get(kindObject, id)), nil
+	case "GetDimension":
+		return s.getById(kindDimension, params)
+	case "GetMeasure":
+		return s.getById(kindMeasure, params)
+	case "GetBookmark":
+		return s.getById(kindBookmark, params)
+	case "GetVariableById":
+		return s.getById(kindVariable, params)
+	case "GetVariableByName", "GetVariable":
+		var name string
+		if err := args(params, &name); err != nil {
+			return nil, err
+		}
+		v := a.variableByName(name)
+		if v == nil {
+			return nil, errorf(ERR_NOT_FOUND, name, "Variable not found")
+		}
+		return s.objectHandle(v), nil
+	case "GetField":
+		var name, state string
+		if err := args(params, &name, &state); err != nil {
+			return nil, err
+		}
+		if a.field(name) == nil {
+			return nil, errorf(ERR_NOT_FOUND, name, "Field not found")
+		}
+		return s.newHandle(&handle{kind: "Field", id: name, state: state}, ""), nil
+
+	case "CreateSessionObject", "CreateObject":
+		var props map[string]any
+		if err := args(params, &props); err != nil {
+			return nil, err
+		}
+		o := &object{kind: kindObject, props: props}
+		if method == "CreateSessionObject" {
+			d.addSessionObject(o)
+		} else {
+			if id := infoId(props); a.objects[id] != nil {
+				return nil, errorf(ERR_ALREADY_EXISTS, id, "Object already exists")
+			}
+			a.add(o)
+		}
+		ret := s.objectHandle(o)
+		ret["qInfo"] = o.info()
+		return ret, nil
+	case "DestroySessionObject":
+		var id string
+		if err := args(params, &id); err != nil {
+			return nil, err
+		}
+		_, ok := d.sessionObj[id]
+		delete(d.sessionObj, id)
+		return map[string]any{"qSuccess": ok}, nil
+	case "DestroyObject", "DestroyDimension", "DestroyMeasure", "DestroyBookmark", "DestroyVariableById":
+		var id string
+		if err := args(params, &id); err != nil {
+			return nil, err
+		}
+		return map[string]any{"qSuccess": a.remove(id)}, nil
+	case "CreateVariableEx", "CreateDimension", "CreateMeasure", "CreateBookmark":
+		var props map[string]any
+		if err := args(params, &props); err != nil {
+			return nil, err
+		}
+		o := &object{props: props}
+		switch method {
+		case "CreateVariableEx":
+			o.kind, o.typ = kindVariable, "variable"
+		case "CreateDimension":
+			o.kind, o.typ = kindDimension, "dimension"
+		case "CreateMeasure":
+			o.kind, o.typ = kindMeasure, "measure"
+		default:
+			o.kind, o.typ = kindBookmark, "bookmark"
+		}
+		a.add(o)
+		ret := s.objectHandle(o)
+		ret["qInfo"] = o.info()
+		return ret, nil
+
+	case "GetBookmarks":
+		list := make([]any, 0)
+		for _, bm := range a.ofType("bookmark") {
+			list = append(list, map[string]any{"qInfo": bm.info(), "qMeta": d.meta(bm), "qData": map[string]any{}})
+		}
+		return map[string]any{"qList": list}, nil
+	case "ApplyBookmark":
+		var id string
+		if err := args(params, &id); err != nil {
+			return nil, err
+		}
+		bm := a.get(kindBookmark, id)
+		if bm == nil {
+			return map[string]any{"qSuccess": false}, nil
+		}
+		d.applyBookmark(bm)
+		return map[string]any{"qSuccess": true}, nil
+	case "ClearAll":
+		var lockedAlso bool
+		var state string
+		if err := args(params, &lockedAlso, &state); err != nil {
+			return nil, err
+		}
+		d.state(state).clearAll(lockedAlso)
+		return map[string]any{}, nil
+	case "AddAlternateState":
+		var state string
+		if err := args(params, &state); err != nil {
+			return nil, err
+		}
+		if !slices.Contains(a.states, state) {
+			a.states = append(a.states, state)
+		}
+		return map[string]any{}, nil
+	case "LockAll", "UnlockAll":
+		var state string
+		if err := args(params, &state); err != nil {
+			return nil, err
+		}
+		st := d.state(state)
+		for _, field := range st.fields {
+			st.locked[field] = method == "LockAll"
+		}
+		return map[string]any{}, nil
+	}
+	return nil, errorf(ERR_METHOD_NOT_FOUND, method, "Method not found")
+}
+
+func (s *session) getById(kind string, params []json.RawMessage) (any, *rpcError) {
+	var id string
+	if err := args(params, &id); err != nil {
+		return nil, err
+	}
+	o := s.doc.get(kind, id)
+	if o == nil {
+		return map[string]any{"qReturn": map[string]any{"qType": kind, "qHandle": nil}}, nil
+	}
+	return s.objectHandle(o), nil
+}
+
+func (d *docSession) addSessionObject(o *object) {
+	if info, ok := o.props["qInfo"].(map[string]any); ok {
+		o.id, _ = info["qId"].(string)
+		o.typ, _ = info["qType"].(string)
+	}
+	if o.id == "" {
+		d.nextId++
+		o.id = fmt.Sprintf("session-%d", d.nextId)
+	}
+	o.props["qInfo"] = o.info()
+	d.sessionObj[o.id] = o
+}
+
+func (s *session) callField(h *handle, method string, params []json.RawMessage) (any, *rpcError) {
+	d := s.doc
+	f := d.app.field(h.id)
+	if f == nil {
+		return nil, errorf(ERR_NOT_FOUND, h.id, "Field not found")
+	}
+	st := d.state(h.state)
+	switch method {
+	case "SelectValues", "Select", "ToggleSelect", "SelectAll", "Clear":
+		if st.locked[f.Name] {
+			return map[string]any{"qReturn": false}, nil
+		}
+	}
+	switch method {
+	case "Lock", "Unlock":
+		_, selected := st.values[f.Name]
+		st.locked[f.Name] = method == "Lock" && selected
+		return map[string]any{"qReturn": selected}, nil
+	case "SelectValues":
+		var values []struct {
+			Text      string  `json:"qText"`
+			IsNumeric bool    `json:"qIsNumeric"`
+			Number    float64 `json:"qNumber"`
+		}
+		var toggle bool
+		if err := args(params, &values, &toggle); err != nil {
+			return nil, err
+		}
+		texts := make([]string, 0, len(values))
+		for _, fv := range values {
+			for _, v := range f.Values {
+				if (fv.IsNumeric && v.Num != nil && math.Abs(*v.Num-fv.Number) < 1e-9) || (!fv.IsNumeric && v.Text == fv.Text) {
+					texts = append(texts, v.Text)
+					break
+				}
+			}
+		}
+		if len(texts) == 0 && len(values) > 0 {
+			return map[string]any{"qReturn": false}, nil
+		}
+		d.selectTexts(h.state, f, texts, toggle)
+		return map[string]any{"qReturn": true}, nil
+	case "Select":
+		var match string
+		if err := args(params, &match); err != nil {
+			return nil, err
+		}
+		return map[string]any{"qReturn": d.selectMatch(h.state, f, match)}, nil
+	case "ToggleSelect":
+		var match string
+		if err := args(params, &match); err != nil {
+			return nil, err
+		}
+		d.selectTexts(h.state, f, []string{match}, true)
+		return map[string]any{"qReturn": true}, nil
+	case "SelectAll":
+		texts := make([]string, len(f.Values))
+		for i, v := range f.Values {
+			texts[i] = v.Text
+		}
+		d.selectTexts(h.state, f, texts, false)
+		return map[string]any{"qReturn": true}, nil
+	case "Clear":
+		st.clear(f.Name)
+		return map[string]any{"qReturn": true}, nil
+	case "GetCardinal":
+		return map[string]any{"qReturn": len(f.Values)}, nil
+	case "GetNxProperties":
+		return map[string]any{"qProperties": map[string]any{"qOneAndOnlyOne": false}}, nil
+	}
+	return nil, errorf(ERR_METHOD_NOT_FOUND, method, "Method not found")
+}
+
+func (s *session) callObject(o *object, method string, params []json.RawMessage) (any, *rpcError) {
+	d := s.doc
+	switch method {
+	case "GetLayout":
+		return map[string]any{"qLayout": d.layout(o)}, nil
+	case "GetProperties", "GetEffectiveProperties":
+		return map[string]any{"qProp": cloneMap(o.props)}, nil
+	case "GetInfo":
+		return map[string]any{"qInfo": o.info()}, nil
+	case "SetProperties":
+		var props map[string]any
+		if err := args(params, &props); err != nil {
+			return nil, err
+		}
+		props["qInfo"] = o.info()
+		o.props = props
+		return map[string]any{}, nil
+	case "Publish", "UnPublish", "Approve", "UnApprove":
+		if o.meta == nil {
+			o.meta = make(map[string]any)
+		}
+		key := "published"
+		if strings.HasSuffix(method, "Approve") {
+			key = "approved"
+		}
+		o.meta[key] = !strings.HasPrefix(method, "Un")
+		return map[string]any{}, nil
+	case "GetFullPropertyTree":
+		return map[string]any{"qPropEntry": d.propertyTree(o)}, nil
+	case "SetFullPropertyTree":
+		var entry map[string]any
+		if err := args(params, &entry); err != nil {
+			return nil, err
+		}
+		d.setPropertyTree(o, entry)
+		return map[string]any{}, nil
+	case "GetChildInfos":
+		infos := make([]any, 0, len(o.children))
+		for _, id := range o.children {
+			if child := d.app.objects[id]; child != nil {
+				infos = append(infos, child.info())
+			}
+		}
+		return map[string]any{"qInfos": infos}, nil
+	case "GetChild":
+		var id string
+		if err := args(params, &id); err != nil {
+			return nil, err
+		}
+		child := d.app.get(kindObject, id)
+		if child == nil || child.parent != o.id {
+			child = nil
+		}
+		return s.objectHandle(child), nil
+	case "CreateChild":
+		var props map[string]any
+		if err := args(params, &props); err != nil {
+			return nil, err
+		}
+		if id := infoId(props); d.app.objects[id] != nil {
+			return nil, errorf(ERR_ALREADY_EXISTS, id, "Object already exists")
+		}
+		child := &object{kind: kindObject, parent: o.id, props: props}
+		d.app.add(child)
+		o.children = append(o.children, child.id)
+		ret := s.objectHandle(child)
+		ret["qInfo"] = child.info()
+		return ret, nil
+	case "DestroyChild":
+		var id string
+		if err := args(params, &id); err != nil {
+			return nil, err
+		}
+		child := d.app.get(kindObject, id)
+		if child == nil || child.parent != o.id {
+			return map[string]any{"qSuccess": false}, nil
+		}
+		return map[string]any{"qSuccess": d.app.remove(id)}, nil
+
+	case "GetHyperCubeData":
+		var p string
+		var pages []any
+		if err := args(params, &p, &pages); err != nil {
+			return nil, err
+		}
+		def, _ := o.props["qHyperCubeDef"].(map[string]any)
+		dims, _ := def["qDimensions"].([]any)
+		return map[string]any{"qDataPages": d.dataPages(d.cubeData(o, def), len(dims), pages)}, nil
+	case "GetHyperCubePivotData":
+		pages := []any{}
+		if o.pivotPage != nil {
+			pages = append(pages, cloneMap(o.pivotPage))
+		}
+		return map[string]any{"qDataPages": pages}, nil
+	case "ExpandLeft", "ExpandTop", "CollapseLeft", "CollapseTop", "ClearSelections", "BeginSelections", "EndSelections", "ResetMadeSelections":
+		return map[string]any{}, nil
+	case "GetListObjectData":
+		var p string
+		var pages []any
+		if err := args(params, &p, &pages); err != nil {
+			return nil, err
+		}
+		def, _ := o.props["qListObjectDef"].(map[string]any)
+		inline, _ := def["qDef"].(map[string]any)
+		state, _ := def["qStateName"].(string)
+		defs := stringsOf(inline["qFieldDefs"])
+		if len(defs) == 0 || d.app.field(defs[0]) == nil {
+			return map[string]any{"qDataPages": []any{}}, nil
+		}
+		return map[string]any{"qDataPages": d.listPages(state, d.app.field(defs[0]), pages)}, nil
+	case "SelectListObjectValues":
+		var p string
+		var elems []int
+		var toggle bool
+		if err := args(params, &p, &elems, &toggle); err != nil {
+			return nil, err
+		}
+		def, _ := o.props["qListObjectDef"].(map[string]any)
+		inline, _ := def["qDef"].(map[string]any)
+		state, _ := def["qStateName"].(string)
+		defs := stringsOf(inline["qFieldDefs"])
+		if len(defs) == 0 || d.app.field(defs[0]) == nil {
+			return map[string]any{"qSuccess": false}, nil
+		}
+		f := d.app.field(defs[0])
+		if d.state(state).locked[f.Name] {
+			return map[string]any{"qSuccess": false}, nil
+		}
+		texts := make([]string, 0, len(elems))
+		for _, e := range elems {
+			if e >= 0 && e < len(f.Values) {
+				texts = append(texts, f.Values[e].Text)
+			}
+		}
+		d.selectTexts(state, f, texts, toggle)
+		return map[string]any{"qSuccess": true}, nil
+
+	case "GetDimension":
+		return map[string]any{"qDim": o.props["qDim"]}, nil
+	case "GetMeasure":
+		return map[string]any{"qMeasure": o.props["qMeasure"]}, nil
+	case "GetRawContent":
+		return map[string]any{"qReturn": d.variableValue(o).Text}, nil
+	case "SetStringValue":
+		var v string
+		if err := args(params, &v); err != nil {
+			return nil, err
+		}
+		o.props["qDefinition"] = v
+		return map[string]any{}, nil
+	case "SetNumValue":
+		var v float64
+		if err := args(params, &v); err != nil {
+			return nil, err
+		}
+		o.props["qDefinition"] = formatNum(v)
+		return map[string]any{}, nil
+	case "Apply":
+		if o.kind != kindBookmark {
+			break
+		}
+		d.applyBookmark(o)
+		return map[string]any{"qSuccess": true}, nil
+	}
+	return nil, errorf(ERR_METHOD_NOT_FOUND, method, "Method not found")
+}
+
+func (d *docSession) propertyTree(o *object) map[string]any {
+	children := make([]any, 0, len(o.children))
+	for _, id := range o.children {
+		if child := d.app.objects[id]; child != nil {
+			children = append(children, d.propertyTree(child))
+		}
+	}
+	return map[string]any{"qProperty": cloneMap(o.props), "qChildren": children, "qEmbeddedSnapshotRef": nil}
+}
+
+// setPropertyTree replaces properties and children of o with entry of GetFullPropertyTree.
+func (d *docSession) setPropertyTree(o *object, entry map[string]any) {
+	if props, ok := entry["qProperty"].(map[string]any); ok {
+		props["qInfo"] = o.info()
+		o.props = props
+	}
+	for _, id := range append([]string{}, o.children...) {
+		d.app.remove(id)
+	}
+	children, _ := entry["qChildren"].([]any)
+	for _, c := range children {
+		childEntry, _ := c.(map[string]any)
+		props, _ := childEntry["qProperty"].(map[string]any)
+		child := &object{kind: kindObject, parent: o.id, props: props}
+		d.app.add(child)
+		o.children = append(o.children, child.id)
+		d.setPropertyTree(child, childEntry)
+	}
+}
@@ -0,0 +1,49 @@
+package enginetest
+
+import (
+	"testing"
+
+	"github.com/qlik-oss/enigma-go/v4"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+)
+
+// Config returns a desktop connection config to app `appId` of s.
+func (s *Server) Config(appId string) engine.MixedConfig {
+	return engine.MixedConfig{
+		AppId: appId,
+		OnPrem: &engine.Config{
+			EngineURI:  s.URL,
+			AppID:      appId,
+			AuthMode:   engine.AUTH_MODE_DESKTOP,
+			ServerType: engine.ST_ON_PREM,
+		},
+	}
+}
+
+// OpenDoc starts a Server of fixture `f` and opens its first app in a new session,
+// both are closed when the test ends.
+func OpenDoc(t testing.TB, f *Fixture) (*Server, *enigma.Doc) {
+	t.Helper()
+	if f == nil || len(f.Apps) == 0 {
+		t.Fatalf("OpenDoc: fixture has no app")
+	}
+	srv := NewServer(f)
+	t.Cleanup(srv.Close)
+	return srv, ConnectDoc(t, *srv.Config(f.Apps[0].Id).OnPrem)
+}
+
+// ConnectDoc opens app `cfg.AppID` in a new session of cfg, the session is closed when the test ends.
+func ConnectDoc(t testing.TB, cfg engine.Config) *enigma.Doc {
+	t.Helper()
+	conn, err := engine.NewConn(cfg)
+	if err != nil {
+		t.Fatalf("NewConn: %v", err)
+	}
+	t.Cleanup(func() { conn.Global.DisconnectFromServer() })
+	doc, err := conn.Global.OpenDoc(engine.ConnCtx, cfg.AppID, "", "", "", false)
+	if err != nil {
+		t.Fatalf("OpenDoc: %v", err)
+	}
+	return doc
+}
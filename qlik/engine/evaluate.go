@@ -0,0 +1,280 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/soderasen-au/go-common/util"
+)
+
+const (
+	EVAL_OBJECT_TYPE = "EvaluateList"
+)
+
+// aggregations are functions which take a set expression as first argument.
+var aggregations = map[string]bool{
+	"sum": true, "count": true, "avg": true, "min": true, "max": true, "only": true, "mode": true, "median": true,
+	"concat": true, "minstring": true, "maxstring": true, "firstsortedvalue": true, "fractile": true, "stdev": true,
+	"nullcount": true, "numericcount": true, "textcount": true, "missingcount": true, "sterr": true, "skew": true, "kurtosis": true,
+}
+
+// EvalOptions evaluates expressions in State, with SetModifier like `<Year={2024}>` or `Year={2024}`
+// injected into every aggregation.
+type EvalOptions struct {
+	State       string `json:"state,omitempty" yaml:"state,omitempty"`
+	SetModifier string `json:"set_modifier,omitempty" yaml:"set_modifier,omitempty"`
+}
+
+type EvalResult struct {
+	Expr string   `json:"expr"`
+	Text string   `json:"text"`
+	Num  *float64 `json:"num,omitempty"`
+}
+
+func (r *EvalResult) IsNumeric() bool {
+	return r.Num != nil
+}
+
+// String returns the text of r, or its number if it has no text.
+func (r *EvalResult) String() string {
+	if r.Text == "" && r.Num != nil {
+		return fmt.Sprintf("%v", *r.Num)
+	}
+	return r.Text
+}
+
+func Evaluate(doc *enigma.Doc, expr string, opts *EvalOptions) (*EvalResult, *util.Result) {
+	return EvaluateContext(ConnCtx, doc, expr, opts)
+}
+
+// EvaluateContext evaluates expr with EvaluateEx, or in a session object when opts has a state.
+func EvaluateContext(ctx context.Context, doc *enigma.Doc, expr string, opts *EvalOptions) (*EvalResult, *util.Result) {
+	if opts != nil && opts.State != "" {
+		ret, res := EvaluateBatchContext(ctx, doc, []string{expr}, opts)
+		if res != nil {
+			return nil, res
+		}
+		return ret[0], nil
+	}
+	injected := expr
+	if opts != nil {
+		injected = InjectSetModifier(expr, opts.SetModifier)
+	}
+	dual, err := doc.EvaluateEx(ctx, injected)
+	if err != nil {
+		return nil, util.Error("EvaluateEx", err)
+	}
+	ret := &EvalResult{Expr: expr, Text: dual.Text}
+	if n := float64(dual.Number); dual.IsNumeric && !math.IsNaN(n) {
+		ret.Num = &n
+	}
+	return ret, nil
+}
+
+func EvaluateBatch(doc *enigma.Doc, exprs []string, opts *EvalOptions) ([]*EvalResult, *util.Result) {
+	return EvaluateBatchContext(ConnCtx, doc, exprs, opts)
+}
+
+// EvaluateBatchContext evaluates exprs as string and value expressions of one session object,
+// so that they are computed in one request.
+func EvaluateBatchContext(ctx context.Context, doc *enigma.Doc, exprs []string, opts *EvalOptions) ([]*EvalResult, *util.Result) {
+	if opts == nil {
+		opts = &EvalOptions{}
+	}
+	props := map[string]any{
+		"qInfo": map[string]any{"qType": EVAL_OBJECT_TYPE},
+	}
+	if opts.State != "" {
+		props["qStateName"] = opts.State
+	}
+	for i, expr := range exprs {
+		e := InjectSetModifier(expr, opts.SetModifier)
+		if !strings.HasPrefix(strings.TrimSpace(e), "=") {
+			e = "=" + e
+		}
+		props[fmt.Sprintf("text%d", i)] = map[string]any{"qStringExpression": map[string]any{"qExpr": e}}
+		props[fmt.Sprintf("num%d", i)] = map[string]any{"qValueExpression": map[string]any{"qExpr": e}}
+	}
+
+	obj, err := doc.CreateSessionObjectRaw(ctx, props)
+	if err != nil {
+		return nil, util.Error("CreateSessionObject", err)
+	}
+	// the session object is destroyed even if ctx is canceled
+	defer doc.DestroySessionObject(context.WithoutCancel(ctx), obj.GenericId)
+	buf, err := obj.GetLayoutRaw(ctx)
+	if err != nil {
+		return nil, util.Error("GetLayoutRaw", err)
+	}
+	var layout map[string]json.RawMessage
+	if err := json.Unmarshal(buf, &layout); err != nil {
+		return nil, util.Error("ParseLayout", err)
+	}
+
+	ret := make([]*EvalResult, len(exprs))
+	for i, expr := range exprs {
+		r := &EvalResult{Expr: expr}
+		if v, ok := layout[fmt.Sprintf("text%d", i)]; ok {
+			if err := json.Unmarshal(v, &r.Text); err != nil {
+				return nil, util.Error(fmt.Sprintf("ParseText[%d]", i), err)
+			}
+		}
+		if v, ok := layout[fmt.Sprintf("num%d", i)]; ok {
+			var n enigma.Float64
+			if err := json.Unmarshal(v, &n); err != nil {
+				return nil, util.Error(fmt.Sprintf("ParseNum[%d]", i), err)
+			}
+			if f := float64(n); !math.IsNaN(f) {
+				r.Num = &f
+			}
+		}
+		ret[i] = r
+	}
+	return ret, nil
+}
+
+func EvaluateTemplate(doc *enigma.Doc, text string, opts *EvalOptions) (string, *util.Result) {
+	return EvaluateTemplateContext(ConnCtx, doc, text, opts)
+}
+
+// EvaluateTemplateContext evaluates text as an expression if it starts with `=`,
+// otherwise it replaces every `$(=expr)` in text by the value of expr.
+func EvaluateTemplateContext(ctx context.Context, doc *enigma.Doc, text string, opts *EvalOptions) (string, *util.Result) {
+	if strings.HasPrefix(strings.TrimSpace(text), "=") {
+		r, res := EvaluateContext(ctx, doc, text, opts)
+		if res != nil {
+			return "", res
+		}
+		return r.String(), nil
+	}
+
+	s := []rune(text)
+	type span struct{ start, end int }
+	spans := make([]span, 0)
+	exprs := make([]string, 0)
+	for i := 0; i+2 < len(s); i++ {
+		if s[i] == '$' && s[i+1] == '(' && s[i+2] == '=' {
+			end := matchParen(s, i+1)
+			if end >= len(s) {
+				break
+			}
+			spans = append(spans, span{i, end + 1})
+			exprs = append(exprs, string(s[i+2:end]))
+			i = end
+		}
+	}
+	if len(exprs) == 0 {
+		return text, nil
+	}
+	values, res := EvaluateBatchContext(ctx, doc, exprs, opts)
+	if res != nil {
+		return "", res
+	}
+	var b strings.Builder
+	last := 0
+	for i, sp := range spans {
+		b.WriteString(string(s[last:sp.start]))
+		b.WriteString(values[i].String())
+		last = sp.end
+	}
+	b.WriteString(string(s[last:]))
+	return b.String(), nil
+}
+
+// InjectSetModifier adds modifier to the set expression of every aggregation in expr,
+// aggregations without one get `{<modifier>}`. Set identifiers of expr are kept.
+func InjectSetModifier(expr, modifier string) string {
+	modifier = strings.TrimSpace(modifier)
+	modifier = strings.TrimSuffix(strings.TrimPrefix(modifier, "<"), ">")
+	if modifier == "" {
+		return expr
+	}
+
+	s := []rune(expr)
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\'' || c == '"' || c == '[':
+			close := c
+			if c == '[' {
+				close = ']'
+			}
+			end := skipQuoted(s, i, close)
+			b.WriteString(string(s[i:end]))
+			i = end
+		case isIdentStart(c):
+			j := i
+			for j < len(s) && isIdentPart(s[j]) {
+				j++
+			}
+			k := j
+			for k < len(s) && unicode.IsSpace(s[k]) {
+				k++
+			}
+			name := strings.ToLower(string(s[i:j]))
+			b.WriteString(string(s[i:k]))
+			i = k
+			if !aggregations[name] || i >= len(s) || s[i] != '(' {
+				continue
+			}
+			b.WriteRune('(')
+			i++
+			for i < len(s) && unicode.IsSpace(s[i]) {
+				b.WriteRune(s[i])
+				i++
+			}
+			if i < len(s) && s[i] == '{' {
+				end := matchBrace(s, i)
+				b.WriteString(mergeSetExpression(string(s[i:end]), modifier))
+				i = end
+			} else {
+				b.WriteString("{<" + modifier + ">} ")
+			}
+		default:
+			b.WriteRune(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// matchBrace returns the index after the brace closing the one at i, or len(s).
+func matchBrace(s []rune, i int) int {
+	depth := 0
+	for ; i < len(s); i++ {
+		switch s[i] {
+		case '\'', '"', '[':
+			close := s[i]
+			if close == '[' {
+				close = ']'
+			}
+			i = skipQuoted(s, i, close) - 1
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(s)
+}
+
+// mergeSetExpression adds modifier to set like `{<A={1}>}`, `{$<A={1}>}` or `{1}`.
+func mergeSetExpression(set, modifier string) string {
+	if p := strings.Index(set, "<"); p >= 0 {
+		if strings.HasPrefix(strings.TrimSpace(set[p+1:]), ">") {
+			return set[:p+1] + modifier + set[p+1:]
+		}
+		return set[:p+1] + modifier + "," + set[p+1:]
+	}
+	inner := strings.TrimSuffix(strings.TrimPrefix(set, "{"), "}")
+	return "{" + inner + "<" + modifier + ">}"
+}
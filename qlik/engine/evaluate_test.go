@@ -0,0 +1,72 @@
+package engine_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/soderasen-au/go-common/util"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+	"github.com/soderasen-au/go-qlik/qlik/engine/enginetest"
+)
+
+func TestInjectSetModifier(t *testing.T) {
+	tests := []struct {
+		expr     string
+		modifier string
+		want     string
+	}{
+		{"Sum(Sales)", "", "Sum(Sales)"},
+		{"=Sum(Sales) / Count(distinct Region)", "<Year={2024}>", "=Sum({<Year={2024}>} Sales) / Count({<Year={2024}>} distinct Region)"},
+		{"Sum({<Region={'East'}>} Sales)", "Year={2024}", "Sum({<Year={2024},Region={'East'}>} Sales)"},
+		{"Sum({$<>} Sales) + Max({1} Year)", "Year={2024}", "Sum({$<Year={2024}>} Sales) + Max({1<Year={2024}>} Year)"},
+		{"RangeSum(Sum(Sales), 'Sum(x)', [Max(y)])", "Year={2024}", "RangeSum(Sum({<Year={2024}>} Sales), 'Sum(x)', [Max(y)])"},
+		{"SumSales + Year(Today())", "Year={2024}", "SumSales + Year(Today())"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			if got := engine.InjectSetModifier(tt.expr, tt.modifier); got != tt.want {
+				t.Errorf("InjectSetModifier() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFake_Evaluate(t *testing.T) {
+	srv, doc := enginetest.OpenDoc(t, enginetest.SalesFixture())
+
+	r, res := engine.Evaluate(doc, "=Sum(Sales)", nil)
+	if res != nil || r.String() != "430" || !r.IsNumeric() || *r.Num != 430 {
+		t.Errorf("Evaluate(Sum(Sales)) = %s, %v", util.JsonStr(r), res)
+	}
+	r, res = engine.Evaluate(doc, "vTitle", &engine.EvalOptions{State: "Compare"})
+	if res != nil || r.String() != "Sales Overview" || r.IsNumeric() {
+		t.Errorf("Evaluate(vTitle) = %s, %v", util.JsonStr(r), res)
+	}
+
+	rs, res := engine.EvaluateBatch(doc, []string{"Max(Year)", "=vMarginRate", "'Product'"}, nil)
+	if res != nil || len(rs) != 3 || rs[0].String() != "2024" || *rs[1].Num != 0.25 || rs[2].String() != "Product" || rs[2].IsNumeric() {
+		t.Errorf("EvaluateBatch() = %s, %v", util.JsonStr(rs), res)
+	}
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Sales by region", "Sales by region"},
+		{"=Sum(Sales)", "430"},
+		{"Total $(=Sum(Sales)) in $(=Max(Year)), margin $(=vMarginRate)", "Total 430 in 2024, margin 0.25"},
+		{"Unclosed $(=Sum(Sales)", "Unclosed $(=Sum(Sales)"},
+	}
+	for _, tt := range tests {
+		got, res := engine.EvaluateTemplate(doc, tt.text, nil)
+		if res != nil || got != tt.want {
+			t.Errorf("EvaluateTemplate(%s) = %s, %v, want %s", tt.text, got, res, tt.want)
+		}
+	}
+
+	methods := strings.Join(srv.Methods(), ",")
+	if created, destroyed := strings.Count(methods, "CreateSessionObject"), strings.Count(methods, "DestroySessionObject"); created != 3 || destroyed != 3 {
+		t.Errorf("methods = %s", methods)
+	}
+}
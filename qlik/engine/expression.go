@@ -0,0 +1,169 @@
+package engine
+
+import (
+	"strings"
+	"unicode"
+)
+
+var expressionKeywords = map[string]bool{
+	"and": true, "or": true, "not": true, "xor": true, "like": true, "precedes": true, "follows": true,
+	"distinct": true, "nodistinct": true, "total": true, "all": true, "bitand": true, "bitor": true, "bitnot": true, "bitxor": true,
+}
+
+// ExpressionRefs are names referenced by an expression.
+type ExpressionRefs struct {
+	// Expansions are names of dollar-sign expansions like `$(vName)` or `$(vName(1))`.
+	Expansions []string `json:"expansions,omitempty" yaml:"expansions,omitempty"`
+	// Identifiers are bare, bracketed or double-quoted names, which are fields or variables,
+	// names of functions and operator keywords are excluded.
+	Identifiers []string `json:"identifiers,omitempty" yaml:"identifiers,omitempty"`
+}
+
+func (r *ExpressionRefs) add(o *ExpressionRefs) {
+	r.Expansions = append(r.Expansions, o.Expansions...)
+	r.Identifiers = append(r.Identifiers, o.Identifiers...)
+}
+
+// ParseExpression returns names referenced by expr, a leading `=` is ignored.
+// Expressions in `$(=...)` are parsed recursively, string literals and comments are skipped.
+func ParseExpression(expr string) *ExpressionRefs {
+	ret := &ExpressionRefs{Expansions: make([]string, 0), Identifiers: make([]string, 0)}
+	s := []rune(strings.TrimPrefix(strings.TrimSpace(expr), "="))
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\'':
+			i = skipQuoted(s, i, '\'')
+		case c == '/' && i+1 < len(s) && s[i+1] == '/':
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(s) && s[i+1] == '*':
+			for i += 2; i < len(s) && !(s[i] == '*' && i+1 < len(s) && s[i+1] == '/'); i++ {
+			}
+			i += 2
+		case c == '$' && i+1 < len(s) && s[i+1] == '(':
+			end := matchParen(s, i+1)
+			inner := strings.TrimSpace(string(s[i+2 : end]))
+			if strings.HasPrefix(inner, "=") {
+				ret.add(ParseExpression(inner))
+			} else if inner != "" {
+				name := inner
+				if p := strings.IndexRune(inner, '('); p >= 0 {
+					name = strings.TrimSpace(inner[:p])
+					ret.add(ParseExpression(inner[p:]))
+				}
+				ret.Expansions = append(ret.Expansions, name)
+			}
+			i = end + 1
+		case c == '[' || c == '"':
+			close := ']'
+			if c == '"' {
+				close = '"'
+			}
+			end := skipQuoted(s, i, close)
+			name := string(s[i+1:])
+			if end > i+1 && s[end-1] == close {
+				name = string(s[i+1 : end-1])
+			}
+			ret.Identifiers = append(ret.Identifiers, strings.ReplaceAll(name, string(close)+string(close), string(close)))
+			i = end
+		case isIdentStart(c):
+			j := i
+			for j < len(s) && isIdentPart(s[j]) {
+				j++
+			}
+			k := j
+			for k < len(s) && unicode.IsSpace(s[k]) {
+				k++
+			}
+			if (k >= len(s) || s[k] != '(') && !expressionKeywords[strings.ToLower(string(s[i:j]))] {
+				ret.Identifiers = append(ret.Identifiers, string(s[i:j]))
+			}
+			i = j
+		case unicode.IsDigit(c):
+			for i < len(s) && (unicode.IsDigit(s[i]) || s[i] == '.') {
+				i++
+			}
+		default:
+			i++
+		}
+	}
+	return ret
+}
+
+// skipQuoted returns the index after the closing quote of the literal starting at i, doubled quotes are escapes.
+func skipQuoted(s []rune, i int, quote rune) int {
+	for i++; i < len(s); i++ {
+		if s[i] == quote {
+			if i+1 < len(s) && s[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+// matchParen returns the index of the parenthesis closing the one at i, or len(s).
+func matchParen(s []rune, i int) int {
+	depth := 0
+	for ; i < len(s); i++ {
+		switch s[i] {
+		case '\'':
+			i = skipQuoted(s, i, '\'') - 1
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(s)
+}
+
+func isIdentStart(c rune) bool {
+	return unicode.IsLetter(c) || c == '_' || c == '@' || c == '#' || c == '%'
+}
+
+func isIdentPart(c rune) bool {
+	return isIdentStart(c) || unicode.IsDigit(c) || c == '.' || c == '$'
+}
+
+// NormalizeExpression removes a leading `=` and whitespace outside of literals and quoted names,
+// except single spaces between names, so that equivalent expressions compare equal.
+func NormalizeExpression(expr string) string {
+	s := []rune(strings.TrimPrefix(strings.TrimSpace(expr), "="))
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == '\'' || c == '"' || c == '[':
+			close := c
+			if c == '[' {
+				close = ']'
+			}
+			end := skipQuoted(s, i, close)
+			b.WriteString(string(s[i:end]))
+			i = end
+		case unicode.IsSpace(c):
+			for i < len(s) && unicode.IsSpace(s[i]) {
+				i++
+			}
+			if b.Len() > 0 && i < len(s) && isIdentPart(lastRune(b.String())) && isIdentPart(s[i]) {
+				b.WriteRune(' ')
+			}
+		default:
+			b.WriteRune(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+func lastRune(s string) rune {
+	r := []rune(s)
+	return r[len(r)-1]
+}
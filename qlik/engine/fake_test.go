@@ -0,0 +1,164 @@
+package engine_test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/soderasen-au/go-common/loggers"
+	"github.com/soderasen-au/go-common/util"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+	"github.com/soderasen-au/go-qlik/qlik/engine/enginetest"
+)
+
+func TestFake_GetFieldValues(t *testing.T) {
+	_, doc := enginetest.OpenDoc(t, enginetest.SalesFixture())
+	field, err := doc.GetField(engine.ConnCtx, "Region", "")
+	if err != nil {
+		t.Fatalf("GetField: %v", err)
+	}
+	if _, err := field.SelectValues(engine.ConnCtx, []*enigma.FieldValue{{Text: "West"}}, false, false); err != nil {
+		t.Fatalf("SelectValues: %v", err)
+	}
+
+	values, res := engine.GetFieldValues(doc, "", "Region")
+	if res != nil {
+		t.Fatalf("GetFieldValues: %v", res)
+	}
+	got := make(map[string]string)
+	for _, v := range values {
+		got[v.Text] = v.State
+	}
+	want := map[string]string{"East": "X", "North": "X", "West": "S"}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("state of %s = %s, want %s", k, got[k], v)
+		}
+	}
+
+	sel, res := engine.GetCurrentSelection(doc, "")
+	if res != nil {
+		t.Fatalf("GetCurrentSelection: %v", res)
+	}
+	if len(sel.Selections) != 1 || sel.Selections[0].Field != "Region" || sel.Selections[0].Selected != "West" {
+		t.Errorf("GetCurrentSelection = %s", util.JsonStr(sel))
+	}
+}
+
+func TestFake_MasterItems(t *testing.T) {
+	_, doc := enginetest.OpenDoc(t, enginetest.SalesFixture())
+	dims, res := engine.GetDimensionList(doc)
+	if res != nil {
+		t.Fatalf("GetDimensionList: %v", res)
+	}
+	if len(dims) != 2 || dims[0].Info.Id != "dim-region" || dims[0].Dim == nil || dims[0].Dim.FieldDefs[0] != "Region" {
+		t.Errorf("GetDimensionList = %s", util.JsonStr(dims))
+	}
+	measures, res := engine.GetMeasureList(doc)
+	if res != nil {
+		t.Fatalf("GetMeasureList: %v", res)
+	}
+	if len(measures) != 2 || measures[1].Measure == nil || measures[1].Measure.Def != "Sum(Sales) * vMarginRate" {
+		t.Errorf("GetMeasureList = %s", util.JsonStr(measures))
+	}
+}
+
+func TestFake_GetHyperCubeData(t *testing.T) {
+	_, doc := enginetest.OpenDoc(t, enginetest.SalesFixture())
+	obj, err := doc.GetObject(engine.ConnCtx, "tbl-sales")
+	if err != nil {
+		t.Fatalf("GetObject: %v", err)
+	}
+	pages, res := engine.GetHyperCubeData(obj, enigma.Size{Cx: 4, Cy: 5})
+	if res != nil {
+		t.Fatalf("GetHyperCubeData: %v", res)
+	}
+	rows := 0
+	for _, p := range pages {
+		rows += len(p.Matrix)
+	}
+	if rows != 5 {
+		t.Errorf("GetHyperCubeData rows = %d, want 5", rows)
+	}
+}
+
+func TestFake_WalkApp(t *testing.T) {
+	srv, doc := enginetest.OpenDoc(t, enginetest.SalesFixture())
+	opts := engine.DefaultWalkOptions()
+	opts.SkipPrivateSheets = true
+	walker := engine.AppWalker[string]{Logger: loggers.NullLogger}
+	result, res := walker.WalkSheets(doc, srv.Config("sales"), opts,
+		func(e engine.ObjWalkEntry) (*engine.ObjWalkResult[string], *util.Result) {
+			return &engine.ObjWalkResult[string]{Info: e.Info, Result: util.Ptr(e.SheetName)}, nil
+		})
+	if res != nil {
+		t.Fatalf("WalkSheets: %v", res)
+	}
+
+	sheets := result[engine.SHEET_LIST]
+	if len(sheets) != 1 || sheets["sheet-overview"] == nil {
+		t.Fatalf("sheets = %s", util.JsonStr(sheets))
+	}
+	ids := make([]string, 0)
+	for _, o := range engine.FlattenList(sheets) {
+		ids = append(ids, o.Info.Id)
+	}
+	sort.Strings(ids)
+	want := []string{"ctn-kpis", "kpi-sales", "pvt-sales", "sheet-overview", "tbl-sales"}
+	if len(ids) != len(want) {
+		t.Fatalf("walked = %v, want %v", ids, want)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Errorf("walked = %v, want %v", ids, want)
+			break
+		}
+	}
+	if title := sheets["sheet-overview"].Result; title == nil || *title != "Overview" {
+		t.Errorf("sheet name = %v", util.MaybeNil(title))
+	}
+}
+
+func TestFake_RecursiveGetSnapshots(t *testing.T) {
+	srv, doc := enginetest.OpenDoc(t, enginetest.SalesFixture())
+	opts := engine.DefaultWalkOptions()
+	opts.OpendocRetries = 0
+	result, res := engine.RecursiveGetSnapshots(doc, srv.Config("sales"), opts, loggers.NullLogger)
+	if res != nil {
+		t.Fatalf("RecursiveGetSnapshots: %v", res)
+	}
+	objects := make(map[string]*engine.ObjectSnapshot)
+	for _, list := range result {
+		for id, obj := range engine.FlattenList(list) {
+			objects[id] = obj.Result
+		}
+	}
+	tests := []struct {
+		id        string
+		hyperCube bool
+	}{
+		{"tbl-sales", true},
+		{"dim-region", false},
+		{"msr-sales", false},
+		{"bm-east", false},
+		{"var-vTitle", false},
+	}
+	for _, tt := range tests {
+		s := objects[tt.id]
+		if s == nil || len(s.Properties) == 0 || s.Digest == "" || (s.HyperCube != nil) != tt.hyperCube {
+			t.Errorf("snapshot of %s = %s", tt.id, util.JsonStr(s))
+		}
+	}
+}
+
+func TestFake_ObjSnapshoter_MasterItem(t *testing.T) {
+	_, doc := enginetest.OpenDoc(t, enginetest.SalesFixture())
+	shot, res := engine.ObjSnapshoter(engine.ObjWalkEntry{Doc: doc, Info: &enigma.NxInfo{Id: "msr-sales", Type: "measure"}})
+	if res != nil {
+		t.Fatalf("ObjSnapshoter: %v", res)
+	}
+	if shot.Result == nil || len(shot.Result.Properties) == 0 || shot.Result.HyperCube != nil {
+		t.Errorf("snapshot of master measure = %s", util.JsonStr(shot))
+	}
+}
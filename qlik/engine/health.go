@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"context"
 	"encoding/json"
 
 	"github.com/soderasen-au/go-common/util"
@@ -55,7 +56,15 @@ type HealthInfo struct {
 }
 
 func (c *HttpClient) GetHealthInfo() (*HealthInfo, *util.Result) {
-	buf, res := c.Get("healthcheck", nil)
+	return c.GetHealthInfoContext(context.Background())
+}
+
+func (c *HttpClient) GetHealthInfoContext(ctx context.Context) (*HealthInfo, *util.Result) {
+	req, res := c.NewRequest("GET", "healthcheck", nil, nil)
+	if res != nil {
+		return nil, res.With("NewRequest")
+	}
+	buf, res := c.DoRequest(req.WithContext(ctx))
 	if res != nil {
 		return nil, res.With("Get")
 	}
@@ -0,0 +1,61 @@
+package engine
+
+import (
+	"github.com/soderasen-au/go-common/util"
+)
+
+const (
+	IMAGE_FORMAT_PNG  = "png"
+	IMAGE_FORMAT_JPEG = "jpeg"
+	IMAGE_FORMAT_PDF  = "pdf"
+
+	DEFAULT_IMAGE_WIDTH  = 800
+	DEFAULT_IMAGE_HEIGHT = 600
+	DEFAULT_IMAGE_DPI    = 96
+)
+
+// ObjectImageRequest requests an image or PDF of object ObjectId of app AppId in Selections,
+// zero sizes and an empty format use the defaults.
+type ObjectImageRequest struct {
+	AppId      string          `json:"app_id" yaml:"app_id"`
+	ObjectId   string          `json:"object_id" yaml:"object_id"`
+	Format     string          `json:"format,omitempty" yaml:"format,omitempty"` // IMAGE_FORMAT_*
+	Width      int             `json:"width,omitempty" yaml:"width,omitempty"`   // pixels
+	Height     int             `json:"height,omitempty" yaml:"height,omitempty"` // pixels
+	Dpi        int             `json:"dpi,omitempty" yaml:"dpi,omitempty"`
+	Selections *SelectionState `json:"selections,omitempty" yaml:"selections,omitempty"`
+}
+
+// ObjectImageExporter exports objects as images, it's implemented by `qrs.Client` with the printing service
+// of on-prem Sense and by `qcs.Client` with the reports API of Qlik Cloud.
+type ObjectImageExporter interface {
+	ExportObjectImage(req *ObjectImageRequest) ([]byte, *util.Result)
+}
+
+// WithDefaults returns a copy of r with defaults of unset options.
+func (r ObjectImageRequest) WithDefaults() *ObjectImageRequest {
+	if r.Format == "" {
+		r.Format = IMAGE_FORMAT_PNG
+	}
+	if r.Width <= 0 {
+		r.Width = DEFAULT_IMAGE_WIDTH
+	}
+	if r.Height <= 0 {
+		r.Height = DEFAULT_IMAGE_HEIGHT
+	}
+	if r.Dpi <= 0 {
+		r.Dpi = DEFAULT_IMAGE_DPI
+	}
+	return &r
+}
+
+func (r *ObjectImageRequest) Validate() *util.Result {
+	if r.AppId == "" || r.ObjectId == "" {
+		return util.MsgError("Validate", "app id and object id are required")
+	}
+	switch r.Format {
+	case "", IMAGE_FORMAT_PNG, IMAGE_FORMAT_JPEG, IMAGE_FORMAT_PDF:
+		return nil
+	}
+	return util.MsgError("Validate", "unsupported image format: "+r.Format)
+}
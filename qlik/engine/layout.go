@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"context"
 	"encoding/json"
 
 	"github.com/qlik-oss/enigma-go/v4"
@@ -167,7 +168,11 @@ type ObjectLayoutEx struct {
 }
 
 func GetObjectLayoutEx(obj *enigma.GenericObject) (*ObjectLayoutEx, *util.Result) {
-	rawLayout, err := obj.GetLayoutRaw(ConnCtx)
+	return GetObjectLayoutExContext(ConnCtx, obj)
+}
+
+func GetObjectLayoutExContext(ctx context.Context, obj *enigma.GenericObject) (*ObjectLayoutEx, *util.Result) {
+	rawLayout, err := obj.GetLayoutRaw(ctx)
 	if err != nil {
 		return nil, util.Error("GetLayoutRaw", err)
 	}
@@ -182,17 +187,21 @@ func GetObjectLayoutEx(obj *enigma.GenericObject) (*ObjectLayoutEx, *util.Result
 }
 
 func GetSessionObjectLayout(doc *enigma.Doc) (*SessionObjectLayout, *util.Result) {
+	return GetSessionObjectLayoutContext(ConnCtx, doc)
+}
+
+func GetSessionObjectLayoutContext(ctx context.Context, doc *enigma.Doc) (*SessionObjectLayout, *util.Result) {
 	var prop enigma.GenericObjectProperties
 	if err := json.Unmarshal(SessionObjDef, &prop); err != nil {
 		return nil, util.Error("cretae session object definition", err)
 	}
 
-	obj, err := doc.CreateSessionObject(ConnCtx, &prop)
+	obj, err := doc.CreateSessionObject(ctx, &prop)
 	if err != nil {
 		return nil, util.Error("cretae session object", err)
 	}
 
-	layoutBuf, err := obj.GetLayoutRaw(ConnCtx)
+	layoutBuf, err := obj.GetLayoutRaw(ctx)
 	if err != nil {
 		return nil, util.Error("get session object", err)
 	}
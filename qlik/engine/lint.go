@@ -0,0 +1,484 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/rs/zerolog"
+	"github.com/soderasen-au/go-common/loggers"
+	"github.com/soderasen-au/go-common/util"
+)
+
+const (
+	DEP_NODE_OBJECT    = "object"
+	DEP_NODE_DIMENSION = "dimension"
+	DEP_NODE_MEASURE   = "measure"
+	DEP_NODE_VARIABLE  = "variable"
+	DEP_NODE_FIELD     = "field"
+)
+
+// ObjectRefs are references found in the properties of an object, see ObjRefsWalker.
+type ObjectRefs struct {
+	LibraryIds     []string `json:"library_ids,omitempty" yaml:"library_ids,omitempty"`
+	FieldDefs      []string `json:"field_defs,omitempty" yaml:"field_defs,omitempty"`
+	Expressions    []string `json:"expressions,omitempty" yaml:"expressions,omitempty"`
+	InlineMeasures []string `json:"inline_measures,omitempty" yaml:"inline_measures,omitempty"`
+}
+
+type DependencyNode struct {
+	Type          string `json:"type" yaml:"type"`
+	Id            string `json:"id" yaml:"id"`
+	Title         string `json:"title,omitempty" yaml:"title,omitempty"`
+	ScriptCreated bool   `json:"script_created,omitempty" yaml:"script_created,omitempty"`
+}
+
+func (n DependencyNode) Key() string {
+	return n.Type + ":" + n.Id
+}
+
+// DependencyEdge means node From depends on node To, both are node keys.
+type DependencyEdge struct {
+	From string `json:"from" yaml:"from"`
+	To   string `json:"to" yaml:"to"`
+}
+
+// DependencyGraph links objects to the master items, variables and fields they use,
+// and master items and variables to the fields and variables they use.
+type DependencyGraph struct {
+	Nodes []*DependencyNode `json:"nodes" yaml:"nodes"`
+	Edges []*DependencyEdge `json:"edges" yaml:"edges"`
+
+	nodes map[string]*DependencyNode
+	edges map[DependencyEdge]bool
+}
+
+// DuplicateExpression is an expression inlined by objects or defined by master measures more than once.
+type DuplicateExpression struct {
+	Expression string   `json:"expression" yaml:"expression"`
+	Masters    []string `json:"masters,omitempty" yaml:"masters,omitempty"`
+	Objects    []string `json:"objects,omitempty" yaml:"objects,omitempty"`
+}
+
+type AppLint struct {
+	Graph *DependencyGraph `json:"graph" yaml:"graph"`
+	// Unused are master dimensions, master measures and variables no object, master item or variable depends on.
+	Unused     []*DependencyNode      `json:"unused" yaml:"unused"`
+	Duplicates []*DuplicateExpression `json:"duplicates" yaml:"duplicates"`
+}
+
+func NewDependencyGraph() *DependencyGraph {
+	return &DependencyGraph{
+		Nodes: make([]*DependencyNode, 0),
+		Edges: make([]*DependencyEdge, 0),
+		nodes: make(map[string]*DependencyNode),
+		edges: make(map[DependencyEdge]bool),
+	}
+}
+
+func (g *DependencyGraph) AddNode(n *DependencyNode) *DependencyNode {
+	if old, ok := g.nodes[n.Key()]; ok {
+		return old
+	}
+	g.nodes[n.Key()] = n
+	g.Nodes = append(g.Nodes, n)
+	return n
+}
+
+func (g *DependencyGraph) AddEdge(from, to string) {
+	e := DependencyEdge{From: from, To: to}
+	if from == to || g.edges[e] {
+		return
+	}
+	g.edges[e] = true
+	g.Edges = append(g.Edges, &e)
+}
+
+func (g *DependencyGraph) Node(typ, id string) *DependencyNode {
+	return g.nodes[typ+":"+id]
+}
+
+// DependsOn returns keys of nodes the node of key depends on.
+func (g *DependencyGraph) DependsOn(key string) []string {
+	ret := make([]string, 0)
+	for _, e := range g.Edges {
+		if e.From == key {
+			ret = append(ret, e.To)
+		}
+	}
+	return ret
+}
+
+// Dependents returns keys of nodes depending on the node of key.
+func (g *DependencyGraph) Dependents(key string) []string {
+	ret := make([]string, 0)
+	for _, e := range g.Edges {
+		if e.To == key {
+			ret = append(ret, e.From)
+		}
+	}
+	return ret
+}
+
+func (g *DependencyGraph) sort() {
+	sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].Key() < g.Nodes[j].Key() })
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		return g.Edges[i].To < g.Edges[j].To
+	})
+}
+
+// ObjRefsWalker collects references in the properties of an object, children are not included.
+func ObjRefsWalker(e ObjWalkEntry) (*ObjWalkResult[ObjectRefs], *util.Result) {
+	obj, err := GetObjectContext(e.Context(), e.Doc, e.Info.Type, e.Info.Id)
+	if err != nil {
+		return nil, util.Error("GetObject", err)
+	}
+	prop, err := Invoke1Res1ErrOn(obj, "GetPropertiesRaw", e.Context())
+	if err != nil {
+		return nil, util.Error("Invoke1Res1ErrOn::GetPropertiesRaw", err)
+	}
+	buf := prop.Interface().(json.RawMessage)
+	var props any
+	if err := json.Unmarshal(buf, &props); err != nil {
+		return nil, util.Error("ParseProperties", err)
+	}
+	refs := &ObjectRefs{}
+	collectRefs(props, "", refs)
+	title, _ := GetTitle(e.Parent, &ObjectPropeties{Info: e.Info, Properties: buf}, e.Logger)
+	return &ObjWalkResult[ObjectRefs]{
+		SheetId:      e.SheetId,
+		SheetName:    e.SheetName,
+		ObjectTitle:  title,
+		Info:         e.Info,
+		Parent:       e.Parent,
+		Result:       refs,
+		ChildResults: make([]*ObjWalkResult[ObjectRefs], 0),
+	}, nil
+}
+
+// collectRefs walks properties v found at key, where strings of `qDef`, `qExpr` and `qLabelExpression`
+// and any string starting with `=` are expressions.
+func collectRefs(v any, key string, refs *ObjectRefs) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, c := range v {
+			collectRefs(c, k, refs)
+		}
+	case []any:
+		for _, c := range v {
+			if key == "qMeasures" {
+				m, _ := c.(map[string]any)
+				if libId, _ := m["qLibraryId"].(string); libId == "" {
+					def, _ := m["qDef"].(map[string]any)
+					if expr, _ := def["qDef"].(string); expr != "" {
+						refs.InlineMeasures = append(refs.InlineMeasures, expr)
+					}
+				}
+				collectRefs(c, "", refs)
+				continue
+			}
+			if s, ok := c.(string); ok && key == "qFieldDefs" && !strings.HasPrefix(s, "=") {
+				refs.FieldDefs = append(refs.FieldDefs, s)
+				continue
+			}
+			collectRefs(c, key, refs)
+		}
+	case string:
+		switch {
+		case v == "":
+		case key == "qLibraryId":
+			refs.LibraryIds = append(refs.LibraryIds, v)
+		case key == "qDef" || key == "qExpr" || key == "qLabelExpression" || strings.HasPrefix(v, "="):
+			refs.Expressions = append(refs.Expressions, v)
+		}
+	}
+}
+
+func Lint(doc *enigma.Doc, cfg MixedConfig, opts *WalkOptions, _logger *zerolog.Logger) (*AppLint, *util.Result) {
+	return LintContext(ConnCtx, doc, cfg, opts, _logger)
+}
+
+// LintContext walks sheets and master visualizations of doc and analyses their dependencies
+// on master dimensions, master measures, variables and fields.
+func LintContext(ctx context.Context, doc *enigma.Doc, cfg MixedConfig, opts *WalkOptions, _logger *zerolog.Logger) (*AppLint, *util.Result) {
+	if _logger == nil {
+		_logger = loggers.CoreDebugLogger
+	}
+	if opts == nil {
+		opts = DefaultWalkOptions()
+	}
+	l := &linter{g: NewDependencyGraph(), variables: make(map[string]string), fields: make(map[string]bool),
+		measures: make(map[string]string), dimensions: make(map[string]string)}
+
+	model, res := GetDataModelContext(ctx, doc, &DataModelOptions{})
+	if res != nil {
+		return nil, res.With("GetDataModel")
+	}
+	for _, f := range model.Fields {
+		l.fields[f.Name] = true
+	}
+
+	dims, res := GetDimensionListContext(ctx, doc)
+	if res != nil {
+		return nil, res.With("GetDimensionList")
+	}
+	measures, res := GetMeasureListContext(ctx, doc)
+	if res != nil {
+		return nil, res.With("GetMeasureList")
+	}
+	layout, res := GetSessionObjectLayoutContext(ctx, doc)
+	if res != nil {
+		return nil, res.With("GetSessionObjectLayout")
+	}
+	varDefs := make(map[string]string)
+	if layout.VariableList != nil {
+		for _, item := range layout.VariableList.Items {
+			if item == nil || item.Info == nil {
+				continue
+			}
+			v, err := doc.GetVariableById(ctx, item.Info.Id)
+			if err != nil {
+				return nil, util.Error("GetVariableById "+item.Info.Id, err)
+			}
+			vl, err := v.GetLayout(ctx)
+			if err != nil {
+				return nil, util.Error("GetLayout "+item.Info.Id, err)
+			}
+			vp, err := v.GetProperties(ctx)
+			if err != nil {
+				return nil, util.Error("GetProperties "+item.Info.Id, err)
+			}
+			l.g.AddNode(&DependencyNode{Type: DEP_NODE_VARIABLE, Id: vp.Name, Title: vp.Name, ScriptCreated: vl.IsScriptCreated})
+			l.variables[vp.Name] = item.Info.Id
+			varDefs[vp.Name] = vp.Definition
+		}
+	}
+
+	// master items are added before parsing expressions, which may reference them by title
+	for _, d := range dims {
+		if d == nil || d.Info == nil {
+			continue
+		}
+		n := l.g.AddNode(&DependencyNode{Type: DEP_NODE_DIMENSION, Id: d.Info.Id, Title: metaTitle(d.Meta)})
+		l.addTitle(l.dimensions, n.Title, n.Key())
+	}
+	for _, m := range measures {
+		if m == nil || m.Info == nil {
+			continue
+		}
+		n := l.g.AddNode(&DependencyNode{Type: DEP_NODE_MEASURE, Id: m.Info.Id, Title: metaTitle(m.Meta)})
+		l.addTitle(l.measures, n.Title, n.Key())
+		if m.Measure != nil {
+			l.addTitle(l.measures, m.Measure.Label, n.Key())
+		}
+	}
+
+	masterDefs := make(map[string][]string) // normalized expression => master measure ids
+	for _, d := range dims {
+		if d == nil || d.Info == nil {
+			continue
+		}
+		n := l.g.Node(DEP_NODE_DIMENSION, d.Info.Id)
+		if d.Dim != nil {
+			for _, f := range d.Dim.FieldDefs {
+				l.addFieldDef(n.Key(), f)
+			}
+			l.addExpression(n.Key(), d.Dim.LabelExpression)
+		}
+	}
+	for _, m := range measures {
+		if m == nil || m.Info == nil {
+			continue
+		}
+		n := l.g.Node(DEP_NODE_MEASURE, m.Info.Id)
+		if m.Measure != nil {
+			l.addExpression(n.Key(), m.Measure.Def)
+			l.addExpression(n.Key(), m.Measure.LabelExpression)
+			for _, expr := range m.Measure.Expressions {
+				l.addExpression(n.Key(), expr)
+			}
+			if m.Measure.Def != "" {
+				norm := NormalizeExpression(m.Measure.Def)
+				masterDefs[norm] = append(masterDefs[norm], m.Info.Id)
+			}
+		}
+	}
+	for name, def := range varDefs {
+		l.addExpression(DependencyNode{Type: DEP_NODE_VARIABLE, Id: name}.Key(), def)
+	}
+
+	walkers := make(ListWalkFuncMap[ObjectRefs])
+	walkers[SHEET_LIST] = NewRecurObjWalkFunc(ObjRefsWalker)
+	walked, res := WalkAppContext(ctx, doc, cfg, opts, walkers, _logger)
+	if res != nil {
+		return nil, res.With("WalkApp")
+	}
+	objects := FlattenList(walked[SHEET_LIST])
+	masterObjects, err := GetObjectList(doc, ctx, "masterobject")
+	if err != nil {
+		return nil, util.Error("GetObjectList masterobject", err)
+	}
+	for _, item := range masterObjects {
+		if item == nil || item.Info == nil {
+			continue
+		}
+		e := ObjWalkEntry{Ctx: ctx, Config: &cfg, WalkOptions: opts, AppId: util.Ptr(cfg.AppId), Doc: doc, Item: item, Info: item.Info, Logger: _logger}
+		ret, res := RecurWalkObject(e, ObjRefsWalker)
+		if res != nil {
+			return nil, res.With("WalkMasterObject " + item.Info.Id)
+		}
+		FlattenObject(ret, objects)
+	}
+
+	inlined := make(map[string][]string) // normalized expression => object ids
+	for id, o := range objects {
+		if o == nil || o.Result == nil || o.Info == nil {
+			continue
+		}
+		n := l.g.AddNode(&DependencyNode{Type: DEP_NODE_OBJECT, Id: id, Title: util.MaybeNil(o.ObjectTitle)})
+		for _, libId := range o.Result.LibraryIds {
+			if l.g.Node(DEP_NODE_DIMENSION, libId) != nil {
+				l.g.AddEdge(n.Key(), DependencyNode{Type: DEP_NODE_DIMENSION, Id: libId}.Key())
+			} else if l.g.Node(DEP_NODE_MEASURE, libId) != nil {
+				l.g.AddEdge(n.Key(), DependencyNode{Type: DEP_NODE_MEASURE, Id: libId}.Key())
+			}
+		}
+		for _, f := range o.Result.FieldDefs {
+			l.addFieldDef(n.Key(), f)
+		}
+		for _, expr := range o.Result.Expressions {
+			l.addExpression(n.Key(), expr)
+		}
+		seen := make(map[string]bool)
+		for _, expr := range o.Result.InlineMeasures {
+			if norm := NormalizeExpression(expr); !seen[norm] {
+				seen[norm] = true
+				inlined[norm] = append(inlined[norm], id)
+			}
+		}
+	}
+
+	ret := &AppLint{Graph: l.g, Unused: make([]*DependencyNode, 0), Duplicates: make([]*DuplicateExpression, 0)}
+	l.g.sort()
+	used := make(map[string]bool)
+	for _, e := range l.g.Edges {
+		used[e.To] = true
+	}
+	for _, n := range l.g.Nodes {
+		if n.Type != DEP_NODE_OBJECT && n.Type != DEP_NODE_FIELD && !used[n.Key()] {
+			ret.Unused = append(ret.Unused, n)
+		}
+	}
+
+	exprs := make(map[string]bool)
+	for expr := range masterDefs {
+		exprs[expr] = true
+	}
+	for expr := range inlined {
+		exprs[expr] = true
+	}
+	for _, expr := range sortedKeys(exprs) {
+		masters, objs := masterDefs[expr], inlined[expr]
+		if len(masters)+len(objs) < 2 {
+			continue
+		}
+		sort.Strings(masters)
+		sort.Strings(objs)
+		ret.Duplicates = append(ret.Duplicates, &DuplicateExpression{Expression: expr, Masters: masters, Objects: objs})
+	}
+	return ret, nil
+}
+
+type linter struct {
+	g          *DependencyGraph
+	variables  map[string]string // name => id
+	fields     map[string]bool
+	measures   map[string]string // title or label => node key
+	dimensions map[string]string // title => node key
+}
+
+// addTitle keeps the first master item of a title, as the engine resolves a title to one item only.
+func (l *linter) addTitle(titles map[string]string, title, key string) {
+	if _, ok := titles[title]; title != "" && !ok {
+		titles[title] = key
+	}
+}
+
+func (l *linter) addFieldDef(from, def string) {
+	if strings.HasPrefix(def, "=") {
+		l.addExpression(from, def)
+		return
+	}
+	l.addName(from, strings.TrimSuffix(strings.TrimPrefix(def, "["), "]"))
+}
+
+// addExpression links from to names referenced by expr. Identifiers resolve to, in order,
+// variables, master measures by title or label, master dimensions by title unless a field has the name, and fields.
+func (l *linter) addExpression(from, expr string) {
+	if strings.TrimSpace(expr) == "" {
+		return
+	}
+	refs := ParseExpression(expr)
+	for _, name := range refs.Expansions {
+		if _, ok := l.variables[name]; ok {
+			l.g.AddEdge(from, DependencyNode{Type: DEP_NODE_VARIABLE, Id: name}.Key())
+		}
+	}
+	for _, name := range refs.Identifiers {
+		if _, ok := l.variables[name]; !ok {
+			if key, ok := l.measures[name]; ok {
+				l.g.AddEdge(from, key)
+				continue
+			}
+			if key, ok := l.dimensions[name]; ok && !l.fields[name] {
+				l.g.AddEdge(from, key)
+				continue
+			}
+		}
+		l.addName(from, name)
+	}
+}
+
+// addName links from to a variable or a field called name, variables shadow fields.
+func (l *linter) addName(from, name string) {
+	if _, ok := l.variables[name]; ok {
+		l.g.AddEdge(from, DependencyNode{Type: DEP_NODE_VARIABLE, Id: name}.Key())
+	} else if l.fields[name] {
+		to := l.g.AddNode(&DependencyNode{Type: DEP_NODE_FIELD, Id: name, Title: name})
+		l.g.AddEdge(from, to.Key())
+	}
+}
+
+func metaTitle(meta *NxMeta) string {
+	if meta == nil {
+		return ""
+	}
+	return util.MaybeNil(meta.Title)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// String returns a readable summary of unused items and duplicate expressions.
+func (a *AppLint) String() string {
+	var b strings.Builder
+	for _, n := range a.Unused {
+		fmt.Fprintf(&b, "unused %s %s %q\n", n.Type, n.Id, n.Title)
+	}
+	for _, d := range a.Duplicates {
+		fmt.Fprintf(&b, "duplicate %s: masters %v, objects %v\n", d.Expression, d.Masters, d.Objects)
+	}
+	return b.String()
+}
@@ -0,0 +1,121 @@
+package engine_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/soderasen-au/go-common/loggers"
+	"github.com/soderasen-au/go-common/util"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+	"github.com/soderasen-au/go-qlik/qlik/engine/enginetest"
+)
+
+func TestParseExpression(t *testing.T) {
+	tests := []struct {
+		expr        string
+		expansions  string
+		identifiers string
+	}{
+		{"Sum(Sales)", "", "Sales"},
+		{"=Sum([Sales Amount]) * vRate", "", "Sales Amount,vRate"},
+		{"Sum({<Year={$(vYear)}>} \"Net Sales\") / Count(distinct Region)", "vYear", "Year,Net Sales,Region"},
+		{"'Total: ' & Sum(Sales) // Sum(Ignored)", "", "Sales"},
+		{"/* Sum(A) */ $(=Max(Year)) + $(vFormat(Sales, 2))", "vFormat", "Year,Sales"},
+		{"If(Region = 'East''s', [a]]b], 0)", "", "Region,a]b"},
+		{"[Unterminated", "", "Unterminated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			refs := engine.ParseExpression(tt.expr)
+			if got := strings.Join(refs.Expansions, ","); got != tt.expansions {
+				t.Errorf("Expansions = %s, want %s", got, tt.expansions)
+			}
+			if got := strings.Join(refs.Identifiers, ","); got != tt.identifiers {
+				t.Errorf("Identifiers = %s, want %s", got, tt.identifiers)
+			}
+		})
+	}
+}
+
+func TestNormalizeExpression(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{" = Sum( Sales ) ", "Sum(Sales)"},
+		{"Count( distinct  Region )", "Count(distinct Region)"},
+		{"Sum([Sales  Amount]) & ' a  b'", "Sum([Sales  Amount])&' a  b'"},
+	}
+	for _, tt := range tests {
+		if got := engine.NormalizeExpression(tt.expr); got != tt.want {
+			t.Errorf("NormalizeExpression(%q) = %q, want %q", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestFake_Lint(t *testing.T) {
+	srv, doc := enginetest.OpenDoc(t, enginetest.SalesFixture())
+	lint, res := engine.Lint(doc, srv.Config("sales"), nil, loggers.NullLogger)
+	if res != nil {
+		t.Fatalf("Lint: %v", res)
+	}
+
+	unused := make([]string, 0)
+	for _, n := range lint.Unused {
+		unused = append(unused, n.Key())
+	}
+	if got := strings.Join(unused, ","); got != "dimension:dim-region,measure:msr-sales,variable:vCurrentYear,variable:vTitle" {
+		t.Errorf("Unused = %s", got)
+	}
+
+	if len(lint.Duplicates) != 1 || lint.Duplicates[0].Expression != "Sum(Sales)" ||
+		strings.Join(lint.Duplicates[0].Masters, ",") != "msr-sales" ||
+		strings.Join(lint.Duplicates[0].Objects, ",") != "kpi-sales,pvt-sales,tbl-sales" {
+		t.Errorf("Duplicates = %s", util.JsonStr(lint.Duplicates))
+	}
+
+	tests := []struct {
+		node string
+		want string
+	}{
+		{"object:tbl-sales", "dimension:dim-product,field:Region,field:Sales,measure:msr-margin"},
+		{"measure:msr-margin", "field:Sales,variable:vMarginRate"},
+		{"dimension:dim-product", "field:Product"},
+		{"variable:vCurrentYear", "field:Year"},
+		{"object:sheet-overview", ""},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(lint.Graph.DependsOn(tt.node), ","); got != tt.want {
+			t.Errorf("DependsOn(%s) = %s, want %s", tt.node, got, tt.want)
+		}
+	}
+	if got := strings.Join(lint.Graph.Dependents("field:Sales"), ","); !strings.Contains(got, "object:kpi-sales") {
+		t.Errorf("Dependents(field:Sales) = %s", got)
+	}
+}
+
+func TestFake_Lint_MasterItemTitles(t *testing.T) {
+	srv, doc := enginetest.OpenDoc(t, enginetest.SalesFixture())
+	_, err := doc.CreateMeasure(engine.ConnCtx, &enigma.GenericMeasureProperties{
+		Info:    &enigma.NxInfo{Id: "msr-share", Type: "measure"},
+		Measure: &enigma.NxLibraryMeasureDef{Def: "Sum(Sales)/[Total Sales]"},
+		MetaDef: &enigma.NxMetaDef{},
+	})
+	if err != nil {
+		t.Fatalf("CreateMeasure: %v", err)
+	}
+	lint, res := engine.Lint(doc, srv.Config("sales"), nil, loggers.NullLogger)
+	if res != nil {
+		t.Fatalf("Lint: %v", res)
+	}
+	if got := strings.Join(lint.Graph.DependsOn("measure:msr-share"), ","); got != "field:Sales,measure:msr-sales" {
+		t.Errorf("DependsOn(measure:msr-share) = %s", got)
+	}
+	for _, n := range lint.Unused {
+		if n.Key() == "measure:msr-sales" {
+			t.Errorf("msr-sales referenced by title is unused")
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package engine
 
 import (
+	"context"
+
+	"github.com/qlik-oss/enigma-go/v4"
 	"github.com/soderasen-au/go-common/util"
 
 	"github.com/soderasen-au/go-qlik/qlik/rac"
@@ -11,27 +14,38 @@ type MixedConfig struct {
 	BmId          *string     `json:"bm_id" yaml:"bm_id" bson:"bm_id"`
 	BmTitle       *string     `json:"bm_title" yaml:"bm_title" bson:"bm_title"`
 	OnPrem        *Config     `json:"on_prem,omitempty" yaml:"on_prem,omitempty" bson:"on_prem,omitempty"`
-	OnPremCluster *Cluster    `json:"on_prem_cluster,omitempty" yaml:"on_prem_cluster,omitempty" bson:"on_prem_cluster,omitempty"`
+	OnPremCluster *Cluster    `json:"on_prem_cluster,omitempty" yaml:"on_prem_cluster,omitempty" bson:"on_prem_cluster,omitempty"` // method `least_loaded` fails to connect, use a ClusterRouter for it
 	QCS           *rac.Config `json:"qcs,omitempty" yaml:"qcs,omitempty" bson:"qcs,omitempty"`
 }
 
 func (mc MixedConfig) Connect() (*Conn, *util.Result) {
+	return mc.ConnectContext(ConnCtx)
+}
+
+// ConnectContext connects to the engine of mc, ctx bounds only the dialing.
+func (mc MixedConfig) ConnectContext(ctx context.Context) (*Conn, *util.Result) {
 	if mc.OnPrem != nil {
 		cfg := *mc.OnPrem
 		cfg.AppID = mc.AppId
-		conn, err := NewConn(cfg)
+		conn, err := NewConnContext(ctx, cfg)
 		if err != nil {
 			return nil, util.Error("OnPrem.NewConn", err)
 		}
 		return conn, nil
 	} else if mc.OnPremCluster != nil {
-		return NewConnFromCluster(mc.OnPremCluster, mc.AppId)
+		return NewConnFromClusterContext(ctx, mc.OnPremCluster, mc.AppId)
 	} else if mc.QCS != nil {
 		rac, res := rac.New(*mc.QCS)
 		if res != nil {
 			return nil, res.With("rac.NewClient")
 		}
-		return NewConnFromRAC(rac, mc.AppId)
+		return NewConnFromRACContext(ctx, rac, mc.AppId)
 	}
 	return nil, util.MsgError("Dispatch", "empty engine config")
 }
+
+// ApplyBookmarkContext applies bookmark `BmId`, or the bookmark titled `BmTitle`,
+// it returns id of the applied bookmark or "" if neither is set.
+func (mc MixedConfig) ApplyBookmarkContext(ctx context.Context, doc *enigma.Doc) (string, *util.Result) {
+	return ApplyBookmarkContext(ctx, doc, util.MaybeNil(mc.BmId), util.MaybeNil(mc.BmTitle))
+}
@@ -1,11 +1,12 @@
 package engine
 
 import (
+	"context"
 	"fmt"
-	"sync"
 
 	"github.com/qlik-oss/enigma-go/v4"
 	"github.com/soderasen-au/go-common/util"
+	"golang.org/x/sync/errgroup"
 )
 
 var (
@@ -73,6 +74,11 @@ func PivotPaging(rect enigma.Rect) []*enigma.NxPage {
 }
 
 func GetHyperCubeData(obj *enigma.GenericObject, sz enigma.Size, pagingFuncs ...PagingMethod) ([]*enigma.NxDataPage, *util.Result) {
+	return GetHyperCubeDataContext(ConnCtx, obj, sz, pagingFuncs...)
+}
+
+// GetHyperCubeDataContext gets pages concurrently, the first failed page cancels the others.
+func GetHyperCubeDataContext(ctx context.Context, obj *enigma.GenericObject, sz enigma.Size, pagingFuncs ...PagingMethod) ([]*enigma.NxDataPage, *util.Result) {
 	rect := enigma.Rect{
 		Top:    0,
 		Left:   0,
@@ -87,53 +93,37 @@ func GetHyperCubeData(obj *enigma.GenericObject, sz enigma.Size, pagingFuncs ...
 		pages = Paging(rect)
 	}
 
-	type _Result struct {
-		Err      error
-		DataPage *enigma.NxDataPage
-	}
-
-	errArray := make([]*_Result, len(pages))
-	var wg sync.WaitGroup
+	dataPages := make([]*enigma.NxDataPage, len(pages))
+	g, gctx := errgroup.WithContext(ctx)
 	for i, page := range pages {
-		i := i
-		page := page
-		wg.Add(1)
-
-		go func() {
-			defer wg.Done()
-			_pages := make([]*enigma.NxPage, 0)
-			_pages = append(_pages, page)
-			_dataPages, err := obj.GetHyperCubeData(ConnCtx, "/qHyperCubeDef", _pages)
-			result := &_Result{
-				Err: err,
+		g.Go(func() error {
+			_dataPages, err := obj.GetHyperCubeData(gctx, "/qHyperCubeDef", []*enigma.NxPage{page})
+			if err != nil {
+				return util.Error(fmt.Sprintf("page[%d]", i), err)
 			}
-			if err == nil {
-				if len(_dataPages) > 0 {
-					result.DataPage = _dataPages[0]
-				} else {
-					result.DataPage = &enigma.NxDataPage{
-						Area: &rect,
-					}
+			if len(_dataPages) > 0 {
+				dataPages[i] = _dataPages[0]
+			} else {
+				dataPages[i] = &enigma.NxDataPage{
+					Area: &rect,
 				}
 			}
-			errArray[i] = result
-
-		}()
+			return nil
+		})
 	}
-	wg.Wait()
-
-	dataPages := make([]*enigma.NxDataPage, 0)
-	for i, result := range errArray {
-		if result.Err != nil {
-			return nil, util.Error(fmt.Sprintf("page[%d]", i), result.Err)
-		}
-		dataPages = append(dataPages, result.DataPage)
+	if err := g.Wait(); err != nil {
+		return nil, groupResult(err)
 	}
 
 	return dataPages, nil
 }
 
 func GetHyperCubePivotData(obj *enigma.GenericObject, sz enigma.Size) ([]*enigma.NxPivotPage, *util.Result) {
+	return GetHyperCubePivotDataContext(ConnCtx, obj, sz)
+}
+
+// GetHyperCubePivotDataContext gets pages concurrently, the first failed page cancels the others.
+func GetHyperCubePivotDataContext(ctx context.Context, obj *enigma.GenericObject, sz enigma.Size) ([]*enigma.NxPivotPage, *util.Result) {
 	rect := enigma.Rect{
 		Top:    0,
 		Left:   0,
@@ -142,47 +132,26 @@ func GetHyperCubePivotData(obj *enigma.GenericObject, sz enigma.Size) ([]*enigma
 	}
 	pages := PivotPaging(rect)
 
-	type _Result struct {
-		Err      error
-		DataPage *enigma.NxPivotPage
-	}
-
-	errArray := make([]*_Result, len(pages))
-	var wg sync.WaitGroup
+	dataPages := make([]*enigma.NxPivotPage, len(pages))
+	g, gctx := errgroup.WithContext(ctx)
 	for i, page := range pages {
-		i := i
-		page := page
-		wg.Add(1)
-
-		go func() {
-			defer wg.Done()
-			_pages := make([]*enigma.NxPage, 0)
-			_pages = append(_pages, page)
-			_dataPages, err := obj.GetHyperCubePivotData(ConnCtx, "/qHyperCubeDef", _pages)
-			result := &_Result{
-				Err: err,
+		g.Go(func() error {
+			_dataPages, err := obj.GetHyperCubePivotData(gctx, "/qHyperCubeDef", []*enigma.NxPage{page})
+			if err != nil {
+				return util.Error(fmt.Sprintf("page[%d]", i), err)
 			}
-			if err == nil {
-				if len(_dataPages) > 0 {
-					result.DataPage = _dataPages[0]
-				} else {
-					result.DataPage = &enigma.NxPivotPage{
-						Area: &rect,
-					}
+			if len(_dataPages) > 0 {
+				dataPages[i] = _dataPages[0]
+			} else {
+				dataPages[i] = &enigma.NxPivotPage{
+					Area: &rect,
 				}
 			}
-			errArray[i] = result
-
-		}()
+			return nil
+		})
 	}
-	wg.Wait()
-
-	dataPages := make([]*enigma.NxPivotPage, 0)
-	for i, result := range errArray {
-		if result.Err != nil {
-			return nil, util.Error(fmt.Sprintf("page[%d]", i), result.Err)
-		}
-		dataPages = append(dataPages, result.DataPage)
+	if err := g.Wait(); err != nil {
+		return nil, groupResult(err)
 	}
 
 	return dataPages, nil
@@ -200,7 +169,11 @@ func CapSize(sz *enigma.Size, cap enigma.Size) {
 // sz contains size cap when get hypercube data
 // if sz.Cx or sz.Cy is greater than 0, it sets upper limit of column/row to get
 func GetHyperCube(obj *enigma.GenericObject, sz enigma.Size) (*enigma.HyperCube, *util.Result) {
-	layout, err := obj.GetLayout(ConnCtx)
+	return GetHyperCubeContext(ConnCtx, obj, sz)
+}
+
+func GetHyperCubeContext(ctx context.Context, obj *enigma.GenericObject, sz enigma.Size) (*enigma.HyperCube, *util.Result) {
+	layout, err := obj.GetLayout(ctx)
 	if err != nil {
 		return nil, util.Error("GetLayout", err)
 	}
@@ -211,13 +184,13 @@ func GetHyperCube(obj *enigma.GenericObject, sz enigma.Size) (*enigma.HyperCube,
 		if cappedSize != nil && cappedSize.Cx > 0 && cappedSize.Cy > 0 {
 			CapSize(cappedSize, sz)
 			if cube.Mode == "P" || cube.Mode == "K" {
-				pivotPages, res := GetHyperCubePivotData(obj, *cappedSize)
+				pivotPages, res := GetHyperCubePivotDataContext(ctx, obj, *cappedSize)
 				if res != nil {
 					return nil, res.With("GetHyperCubePivotData")
 				}
 				cube.PivotDataPages = pivotPages
 			} else {
-				pages, res := GetHyperCubeData(obj, *cappedSize)
+				pages, res := GetHyperCubeDataContext(ctx, obj, *cappedSize)
 				if res != nil {
 					return nil, res.With("GetHyperCubeData")
 				}
@@ -0,0 +1,617 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/rs/zerolog"
+	"github.com/soderasen-au/go-common/loggers"
+	"github.com/soderasen-au/go-common/util"
+	"golang.org/x/sync/semaphore"
+)
+
+const (
+	DEFAULT_POOL_MAX_SESSIONS_PER_NODE int = 20
+	DEFAULT_POOL_MAX_IDLE_PER_KEY      int = 4
+	DEFAULT_POOL_IDLE_TIMEOUT_SEC      int = 300
+	DEFAULT_POOL_VALIDATE_TIMEOUT_SEC  int = 5
+	DEFAULT_POOL_RECONNECT_RETRIES     int = 1
+)
+
+// PoolKey identifies sessions that can be reused for each other.
+type PoolKey struct {
+	Node          string `json:"node" yaml:"node"`
+	UserDirectory string `json:"user_directory" yaml:"user_directory"`
+	UserId        string `json:"user_id" yaml:"user_id"`
+	AppId         string `json:"app_id" yaml:"app_id"`
+}
+
+// NewPoolKey uses scheme and host of `EngineURI` as the node.
+func NewPoolKey(cfg Config) PoolKey {
+	node := cfg.EngineURI
+	if u, err := url.Parse(cfg.EngineURI); err == nil && u.Host != "" {
+		node = u.Scheme + "://" + u.Host
+	}
+	return PoolKey{
+		Node:          node,
+		UserDirectory: cfg.UserDirectory,
+		UserId:        cfg.UserName,
+		AppId:         cfg.AppID,
+	}
+}
+
+type PoolConfig struct {
+	MaxSessionsPerNode int `json:"max_sessions_per_node,omitempty" yaml:"max_sessions_per_node,omitempty" bson:"max_sessions_per_node,omitempty"` // idle and lent sessions
+	MaxIdlePerKey      int `json:"max_idle_per_key,omitempty" yaml:"max_idle_per_key,omitempty" bson:"max_idle_per_key,omitempty"`
+	IdleTimeoutSec     int `json:"idle_timeout_sec,omitempty" yaml:"idle_timeout_sec,omitempty" bson:"idle_timeout_sec,omitempty"`
+	ValidateTimeoutSec int `json:"validate_timeout_sec,omitempty" yaml:"validate_timeout_sec,omitempty" bson:"validate_timeout_sec,omitempty"`
+	ReconnectRetries   int `json:"reconnect_retries,omitempty" yaml:"reconnect_retries,omitempty" bson:"reconnect_retries,omitempty"`
+}
+
+func DefaultPoolConfig() *PoolConfig {
+	return &PoolConfig{
+		MaxSessionsPerNode: DEFAULT_POOL_MAX_SESSIONS_PER_NODE,
+		MaxIdlePerKey:      DEFAULT_POOL_MAX_IDLE_PER_KEY,
+		IdleTimeoutSec:     DEFAULT_POOL_IDLE_TIMEOUT_SEC,
+		ValidateTimeoutSec: DEFAULT_POOL_VALIDATE_TIMEOUT_SEC,
+		ReconnectRetries:   DEFAULT_POOL_RECONNECT_RETRIES,
+	}
+}
+
+type PoolDialFunc func(ctx context.Context, cfg Config) (*Conn, error)
+
+type PoolStats struct {
+	Open map[string]int `json:"open"` // node => idle and lent sessions
+	Idle int            `json:"idle"`
+}
+
+// Pool keeps opened apps to lend them again to the same user,
+// idle sessions are validated before lending and closed after `IdleTimeoutSec`.
+type Pool struct {
+	Config PoolConfig
+	Dial   PoolDialFunc
+	Logger *zerolog.Logger
+
+	mu     sync.Mutex
+	idle   map[PoolKey][]*PooledSession
+	nodes  map[string]*semaphore.Weighted
+	open   map[string]int
+	closed bool
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+func NewPool(cfg PoolConfig) *Pool {
+	def := DefaultPoolConfig()
+	if cfg.MaxSessionsPerNode <= 0 {
+		cfg.MaxSessionsPerNode = def.MaxSessionsPerNode
+	}
+	if cfg.MaxIdlePerKey <= 0 {
+		cfg.MaxIdlePerKey = def.MaxIdlePerKey
+	}
+	if cfg.IdleTimeoutSec <= 0 {
+		cfg.IdleTimeoutSec = def.IdleTimeoutSec
+	}
+	if cfg.ValidateTimeoutSec <= 0 {
+		cfg.ValidateTimeoutSec = def.ValidateTimeoutSec
+	}
+	if cfg.ReconnectRetries < 0 {
+		cfg.ReconnectRetries = 0
+	}
+
+	p := &Pool{
+		Config: cfg,
+		Dial:   NewConnContext,
+		Logger: loggers.CoreDebugLogger,
+		idle:   make(map[PoolKey][]*PooledSession),
+		nodes:  make(map[string]*semaphore.Weighted),
+		open:   make(map[string]int),
+		done:   make(chan struct{}),
+	}
+	p.wg.Add(1)
+	go p.evictLoop()
+	return p
+}
+
+func (p *Pool) idleTimeout() time.Duration {
+	return time.Duration(p.Config.IdleTimeoutSec) * time.Second
+}
+
+func (p *Pool) validateTimeout() time.Duration {
+	return time.Duration(p.Config.ValidateTimeoutSec) * time.Second
+}
+
+// Get lends a session of app `cfg.AppID`, it reuses a valid idle session or opens a new one,
+// and waits for a free slot if the node has `MaxSessionsPerNode` sessions already.
+func (p *Pool) Get(ctx context.Context, cfg Config) (*PooledSession, *util.Result) {
+	if cfg.AppID == "" {
+		return nil, util.MsgError("PoolGet", "no app id")
+	}
+	key := NewPoolKey(cfg)
+
+	for {
+		s, res := p.popIdle(key)
+		if res != nil {
+			return nil, res
+		}
+		if s == nil {
+			break
+		}
+		if res := s.validate(ctx); res != nil {
+			p.Logger.Debug().Msgf("pool: drop invalid session of %s: %s", key.AppId, res.Error())
+			s.close()
+			continue
+		}
+		s.mu.Lock()
+		s.released = false
+		s.mu.Unlock()
+		s.lastUsed = time.Now()
+		return s, nil
+	}
+
+	if res := p.reserve(ctx, key.Node); res != nil {
+		return nil, res.With("Reserve")
+	}
+	s := &PooledSession{Key: key, pool: p, cfg: cfg}
+	if res := s.connect(ctx); res != nil {
+		p.unreserve(key.Node)
+		return nil, res
+	}
+	s.lastUsed = time.Now()
+	return s, nil
+}
+
+func (p *Pool) popIdle(key PoolKey) (*PooledSession, *util.Result) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, util.MsgError("PoolGet", "pool is closed")
+	}
+	sessions := p.idle[key]
+	if len(sessions) == 0 {
+		return nil, nil
+	}
+	s := sessions[len(sessions)-1]
+	p.idle[key] = sessions[:len(sessions)-1]
+	if len(p.idle[key]) == 0 {
+		delete(p.idle, key)
+	}
+	return s, nil
+}
+
+// reserve takes a session slot of node, idle sessions of other keys on the node are closed to make room.
+func (p *Pool) reserve(ctx context.Context, node string) *util.Result {
+	p.mu.Lock()
+	sem, ok := p.nodes[node]
+	if !ok {
+		sem = semaphore.NewWeighted(int64(p.Config.MaxSessionsPerNode))
+		p.nodes[node] = sem
+	}
+	p.mu.Unlock()
+
+	for !sem.TryAcquire(1) {
+		victim := p.oldestIdleOn(node)
+		if victim == nil {
+			if err := sem.Acquire(ctx, 1); err != nil {
+				return util.Error("WaitForSession", err)
+			}
+			break
+		}
+		victim.close()
+	}
+
+	p.mu.Lock()
+	p.open[node]++
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *Pool) unreserve(node string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.open[node]--
+	if p.open[node] <= 0 {
+		delete(p.open, node)
+	}
+	if sem, ok := p.nodes[node]; ok {
+		sem.Release(1)
+	}
+}
+
+func (p *Pool) oldestIdleOn(node string) *PooledSession {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var (
+		oldest    *PooledSession
+		oldestKey PoolKey
+		oldestIdx int
+	)
+	for key, sessions := range p.idle {
+		if key.Node != node {
+			continue
+		}
+		for i, s := range sessions {
+			if oldest == nil || s.lastUsed.Before(oldest.lastUsed) {
+				oldest, oldestKey, oldestIdx = s, key, i
+			}
+		}
+	}
+	if oldest != nil {
+		sessions := p.idle[oldestKey]
+		p.idle[oldestKey] = append(sessions[:oldestIdx:oldestIdx], sessions[oldestIdx+1:]...)
+		if len(p.idle[oldestKey]) == 0 {
+			delete(p.idle, oldestKey)
+		}
+	}
+	return oldest
+}
+
+// put returns s to idle sessions, returns false if s should be closed instead.
+func (p *Pool) put(s *PooledSession) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed || len(p.idle[s.Key]) >= p.Config.MaxIdlePerKey {
+		return false
+	}
+	s.lastUsed = time.Now()
+	p.idle[s.Key] = append(p.idle[s.Key], s)
+	return true
+}
+
+func (p *Pool) evictLoop() {
+	defer p.wg.Done()
+	interval := p.idleTimeout() / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.EvictIdle()
+		}
+	}
+}
+
+// EvictIdle closes sessions idle longer than `IdleTimeoutSec`.
+func (p *Pool) EvictIdle() {
+	expiry := time.Now().Add(-p.idleTimeout())
+	expired := make([]*PooledSession, 0)
+
+	p.mu.Lock()
+	for key, sessions := range p.idle {
+		kept := sessions[:0]
+		for _, s := range sessions {
+			if s.lastUsed.Before(expiry) {
+				expired = append(expired, s)
+			} else {
+				kept = append(kept, s)
+			}
+		}
+		if len(kept) == 0 {
+			delete(p.idle, key)
+		} else {
+			p.idle[key] = kept
+		}
+	}
+	p.mu.Unlock()
+
+	for _, s := range expired {
+		p.Logger.Debug().Msgf("pool: evict idle session of %s", s.Key.AppId)
+		s.close()
+	}
+}
+
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := PoolStats{Open: make(map[string]int)}
+	for node, n := range p.open {
+		stats.Open[node] = n
+	}
+	for _, sessions := range p.idle {
+		stats.Idle += len(sessions)
+	}
+	return stats
+}
+
+// Close closes idle sessions, lent sessions are closed when they are released.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.done)
+	idle := p.idle
+	p.idle = make(map[PoolKey][]*PooledSession)
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	for _, sessions := range idle {
+		for _, s := range sessions {
+			s.close()
+		}
+	}
+}
+
+type poolSelection struct {
+	BookmarkId string
+	StateName  string
+	Field      string
+	Values     []*enigma.FieldValue
+}
+
+// PooledSession is an opened app lent by Pool, it must be released by `Release` or `Close`.
+// Selections and bookmarks applied by its methods are re-applied if the session reconnects,
+// and cleared when it's released.
+type PooledSession struct {
+	Key PoolKey
+
+	pool       *Pool
+	cfg        Config
+	conn       *Conn
+	doc        *enigma.Doc
+	selections []poolSelection
+	lastUsed   time.Time
+	closed     bool
+	released   bool // returned by Release, the caller doesn't own it anymore
+	mu         sync.Mutex
+}
+
+func (s *PooledSession) Doc() *enigma.Doc {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.doc
+}
+
+func (s *PooledSession) Conn() *Conn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn
+}
+
+// Disconnected returns true if the socket is dropped or the app is closed by engine.
+func (s *PooledSession) Disconnected() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.disconnected()
+}
+
+func (s *PooledSession) disconnected() bool {
+	if s.conn == nil || s.doc == nil {
+		return true
+	}
+	select {
+	case <-s.conn.Global.Disconnected():
+		return true
+	case <-s.doc.Closed():
+		return true
+	default:
+		return false
+	}
+}
+
+// waitDisconnected gives the session a moment to notice a dropped socket after a failed request.
+func (s *PooledSession) waitDisconnected(d time.Duration) bool {
+	s.mu.Lock()
+	conn, doc := s.conn, s.doc
+	s.mu.Unlock()
+	if conn == nil || doc == nil {
+		return true
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-conn.Global.Disconnected():
+		return true
+	case <-doc.Closed():
+		return true
+	case <-t.C:
+		return false
+	}
+}
+
+func (s *PooledSession) connect(ctx context.Context) *util.Result {
+	conn, err := s.pool.Dial(ctx, s.cfg)
+	if err != nil {
+		return util.Error("Dial", err)
+	}
+	doc, err := conn.Global.OpenDoc(ctx, s.cfg.AppID, "", "", "", false)
+	if err != nil {
+		conn.Global.DisconnectFromServer()
+		return util.Error("OpenDoc", err)
+	}
+	s.mu.Lock()
+	s.conn, s.doc = conn, doc
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *PooledSession) validate(ctx context.Context) *util.Result {
+	if s.Disconnected() {
+		return util.MsgError("Validate", "disconnected")
+	}
+	vctx, cancel := context.WithTimeout(ctx, s.pool.validateTimeout())
+	defer cancel()
+	if _, err := s.Doc().GetAppLayout(vctx); err != nil {
+		return util.Error("GetAppLayout", err)
+	}
+	return nil
+}
+
+// Reconnect opens the app in a new session and re-applies selections and bookmarks.
+func (s *PooledSession) Reconnect(ctx context.Context) *util.Result {
+	s.mu.Lock()
+	old := s.conn
+	s.conn, s.doc = nil, nil
+	s.mu.Unlock()
+	if old != nil {
+		go old.Global.DisconnectFromServer()
+	}
+
+	if res := s.connect(ctx); res != nil {
+		return res.With("Reconnect")
+	}
+	s.mu.Lock()
+	selections := s.selections
+	s.mu.Unlock()
+	doc := s.Doc()
+	for i, sel := range selections {
+		if res := applyPoolSelection(ctx, doc, sel); res != nil {
+			return res.With(fmt.Sprintf("Reapply[%d]", i))
+		}
+	}
+	s.pool.Logger.Info().Msgf("pool: reconnected to %s, %d selections re-applied", s.Key.AppId, len(selections))
+	return nil
+}
+
+// Do calls fn with the app, if fn fails because the socket dropped,
+// it reconnects and calls fn again up to `ReconnectRetries` times.
+func (s *PooledSession) Do(ctx context.Context, fn func(ctx context.Context, doc *enigma.Doc) error) *util.Result {
+	for attempt := 0; ; attempt++ {
+		if s.Disconnected() {
+			if res := s.Reconnect(ctx); res != nil {
+				return res
+			}
+		}
+		err := fn(ctx, s.Doc())
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil || attempt >= s.pool.Config.ReconnectRetries || !s.waitDisconnected(100*time.Millisecond) {
+			return util.Error("Do", err)
+		}
+		s.pool.Logger.Warn().Msgf("pool: session of %s dropped: %s, reconnecting", s.Key.AppId, err.Error())
+	}
+}
+
+func applyPoolSelection(ctx context.Context, doc *enigma.Doc, sel poolSelection) *util.Result {
+	if sel.BookmarkId != "" {
+		ok, err := doc.ApplyBookmark(ctx, sel.BookmarkId)
+		if err != nil {
+			return util.Error("ApplyBookmark", err)
+		}
+		if !ok {
+			return util.MsgError("ApplyBookmark", "engine returned `Fail`")
+		}
+		return nil
+	}
+
+	field, err := doc.GetField(ctx, sel.Field, sel.StateName)
+	if err != nil {
+		return util.Error("GetField "+sel.Field, err)
+	}
+	ok, err := field.SelectValues(ctx, sel.Values, false, false)
+	if err != nil {
+		return util.Error("SelectValues "+sel.Field, err)
+	}
+	if !ok {
+		return util.MsgError("SelectValues "+sel.Field, "engine returned `Fail`")
+	}
+	return nil
+}
+
+// selectAndRecord applies sel and records it to re-apply after reconnecting.
+func (s *PooledSession) selectAndRecord(ctx context.Context, sel poolSelection) *util.Result {
+	res := s.Do(ctx, func(ctx context.Context, doc *enigma.Doc) error {
+		if res := applyPoolSelection(ctx, doc, sel); res != nil {
+			return res
+		}
+		return nil
+	})
+	if res != nil {
+		return res
+	}
+	s.mu.Lock()
+	s.selections = append(s.selections, sel)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *PooledSession) ApplyBookmark(ctx context.Context, bookmarkId string) *util.Result {
+	return s.selectAndRecord(ctx, poolSelection{BookmarkId: bookmarkId})
+}
+
+func (s *PooledSession) SelectValues(ctx context.Context, stateName, field string, values []*enigma.FieldValue) *util.Result {
+	if stateName == "" {
+		stateName = "$"
+	}
+	return s.selectAndRecord(ctx, poolSelection{StateName: stateName, Field: field, Values: values})
+}
+
+// ClearAll clears selections of all states and forgets selections to re-apply.
+func (s *PooledSession) ClearAll(ctx context.Context) *util.Result {
+	res := s.Do(ctx, func(ctx context.Context, doc *enigma.Doc) error {
+		return doc.ClearAll(ctx, false, "")
+	})
+	if res != nil {
+		return res.With("ClearAll")
+	}
+	s.mu.Lock()
+	s.selections = nil
+	s.mu.Unlock()
+	return nil
+}
+
+// Release returns the session to pool, selections of all states are cleared first.
+// Releasing a session again, or after Close, does nothing.
+func (s *PooledSession) Release() {
+	s.mu.Lock()
+	if s.closed || s.released {
+		s.mu.Unlock()
+		return
+	}
+	s.released = true
+	s.mu.Unlock()
+	if s.Disconnected() {
+		s.close()
+		return
+	}
+	// selections made on Doc() directly or by bookmarks aren't recorded, so the doc is always cleared
+	ctx, cancel := context.WithTimeout(context.Background(), s.pool.validateTimeout())
+	defer cancel()
+	if res := s.ClearAll(ctx); res != nil {
+		s.pool.Logger.Warn().Msgf("pool: can't clear selections of %s: %s", s.Key.AppId, res.Error())
+		s.close()
+		return
+	}
+	if !s.pool.put(s) {
+		s.close()
+	}
+}
+
+// Close closes the session instead of returning it to pool, it does nothing after Release.
+func (s *PooledSession) Close() {
+	s.mu.Lock()
+	released := s.released
+	s.mu.Unlock()
+	if released {
+		return
+	}
+	s.close()
+}
+
+func (s *PooledSession) close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	conn := s.conn
+	s.conn, s.doc = nil, nil
+	s.mu.Unlock()
+	if conn != nil {
+		conn.Global.DisconnectFromServer()
+	}
+	s.pool.unreserve(s.Key.Node)
+}
@@ -0,0 +1,320 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/soderasen-au/go-common/loggers"
+)
+
+// poolTestSocket answers the few engine methods used by Pool.
+type poolTestSocket struct {
+	in     chan []byte
+	closed chan struct{}
+	once   sync.Once
+	mu     sync.Mutex
+	calls  []string
+}
+
+func newPoolTestSocket() *poolTestSocket {
+	return &poolTestSocket{in: make(chan []byte, 16), closed: make(chan struct{})}
+}
+
+func (s *poolTestSocket) WriteMessage(_ int, data []byte) error {
+	var req struct {
+		Id     int    `json:"id"`
+		Method string `json:"method"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.calls = append(s.calls, req.Method)
+	s.mu.Unlock()
+
+	result := map[string]string{
+		"OpenDoc":       `{"qReturn":{"qType":"Doc","qHandle":1,"qGenericId":"app-1"}}`,
+		"GetAppLayout":  `{"qLayout":{"qTitle":"app"}}`,
+		"GetField":      `{"qReturn":{"qType":"Field","qHandle":2}}`,
+		"SelectValues":  `{"qReturn":true}`,
+		"ApplyBookmark": `{"qSuccess":true}`,
+		"ClearAll":      `{}`,
+	}[req.Method]
+	resp := fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":%s}`, req.Id, result)
+	if result == "" {
+		resp = fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"error":{"code":-32601,"message":"unknown method %s"}}`, req.Id, req.Method)
+	}
+	select {
+	case s.in <- []byte(resp):
+		return nil
+	case <-s.closed:
+		return errors.New("socket closed")
+	}
+}
+
+func (s *poolTestSocket) ReadMessage() (int, []byte, error) {
+	select {
+	case msg := <-s.in:
+		return 1, msg, nil
+	case <-s.closed:
+		return 0, nil, errors.New("socket closed")
+	}
+}
+
+func (s *poolTestSocket) Close() error {
+	s.once.Do(func() { close(s.closed) })
+	return nil
+}
+
+func (s *poolTestSocket) Calls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.calls...)
+}
+
+type poolTestEngine struct {
+	mu      sync.Mutex
+	sockets []*poolTestSocket
+}
+
+func (e *poolTestEngine) dial(ctx context.Context, cfg Config) (*Conn, error) {
+	sock := newPoolTestSocket()
+	e.mu.Lock()
+	e.sockets = append(e.sockets, sock)
+	e.mu.Unlock()
+	dialer := enigma.Dialer{CreateSocket: func(ctx context.Context, url string, header http.Header) (enigma.Socket, error) {
+		return sock, nil
+	}}
+	global, err := dialer.Dial(ctx, cfg.EngineURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{Global: global, Cfg: cfg}, nil
+}
+
+func (e *poolTestEngine) socket(i int) *poolTestSocket {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.sockets[i]
+}
+
+func (e *poolTestEngine) dials() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.sockets)
+}
+
+func newTestPool(cfg PoolConfig) (*Pool, *poolTestEngine) {
+	eng := &poolTestEngine{}
+	p := NewPool(cfg)
+	p.Dial = eng.dial
+	p.Logger = loggers.NullLogger
+	return p, eng
+}
+
+func testPoolConfig(app string) Config {
+	return Config{EngineURI: "wss://qs-node1:4747/app", UserDirectory: "CORP", UserName: "alice", AppID: app}
+}
+
+func TestNewPoolKey(t *testing.T) {
+	key := NewPoolKey(testPoolConfig("app-1"))
+	want := PoolKey{Node: "wss://qs-node1:4747", UserDirectory: "CORP", UserId: "alice", AppId: "app-1"}
+	if key != want {
+		t.Errorf("NewPoolKey = %+v, want %+v", key, want)
+	}
+}
+
+func TestPool_ReuseAndClearSelections(t *testing.T) {
+	p, eng := newTestPool(PoolConfig{})
+	defer p.Close()
+	ctx := context.Background()
+
+	s, res := p.Get(ctx, testPoolConfig("app-1"))
+	if res != nil {
+		t.Fatalf("Get: %s", res.Error())
+	}
+	if res := s.SelectValues(ctx, "", "Region", []*enigma.FieldValue{{Text: "EU"}}); res != nil {
+		t.Fatalf("SelectValues: %s", res.Error())
+	}
+	s.Release()
+
+	if stats := p.Stats(); stats.Idle != 1 || stats.Open["wss://qs-node1:4747"] != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	s2, res := p.Get(ctx, testPoolConfig("app-1"))
+	if res != nil {
+		t.Fatalf("Get: %s", res.Error())
+	}
+	defer s2.Release()
+	if s2 != s || eng.dials() != 1 {
+		t.Errorf("idle session should be reused, dials: %d", eng.dials())
+	}
+	want := []string{"OpenDoc", "GetField", "SelectValues", "ClearAll", "GetAppLayout"}
+	if calls := eng.socket(0).Calls(); fmt.Sprint(calls) != fmt.Sprint(want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestPool_ReleaseTwice(t *testing.T) {
+	p, eng := newTestPool(PoolConfig{})
+	defer p.Close()
+	ctx := context.Background()
+
+	s, res := p.Get(ctx, testPoolConfig("app-1"))
+	if res != nil {
+		t.Fatalf("Get: %s", res.Error())
+	}
+	s.Release()
+	s.Release()
+	s.Close()
+	if stats := p.Stats(); stats.Idle != 1 || stats.Open["wss://qs-node1:4747"] != 1 {
+		t.Errorf("session should be idle once, stats %+v", stats)
+	}
+
+	s1, res := p.Get(ctx, testPoolConfig("app-1"))
+	if res != nil {
+		t.Fatalf("Get: %s", res.Error())
+	}
+	defer s1.Release()
+	s2, res := p.Get(ctx, testPoolConfig("app-1"))
+	if res != nil {
+		t.Fatalf("Get: %s", res.Error())
+	}
+	defer s2.Release()
+	if s1 == s2 || eng.dials() != 2 {
+		t.Errorf("a session is lent twice, dials: %d", eng.dials())
+	}
+
+	closed, res := p.Get(ctx, testPoolConfig("app-2"))
+	if res != nil {
+		t.Fatalf("Get: %s", res.Error())
+	}
+	closed.Close()
+	closed.Release()
+	if stats := p.Stats(); stats.Idle != 0 {
+		t.Errorf("closed session should not be idle, stats %+v", stats)
+	}
+}
+
+func TestPool_ClearUnrecordedSelections(t *testing.T) {
+	p, eng := newTestPool(PoolConfig{})
+	defer p.Close()
+	ctx := context.Background()
+
+	s, res := p.Get(ctx, testPoolConfig("app-1"))
+	if res != nil {
+		t.Fatalf("Get: %s", res.Error())
+	}
+	if _, err := s.Doc().ApplyBookmark(ctx, "bm-1"); err != nil {
+		t.Fatalf("ApplyBookmark: %v", err)
+	}
+	s.Release()
+
+	want := []string{"OpenDoc", "ApplyBookmark", "ClearAll"}
+	if calls := eng.socket(0).Calls(); fmt.Sprint(calls) != fmt.Sprint(want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestPool_ReconnectReappliesSelections(t *testing.T) {
+	p, eng := newTestPool(PoolConfig{ReconnectRetries: 1})
+	defer p.Close()
+	ctx := context.Background()
+
+	s, res := p.Get(ctx, testPoolConfig("app-1"))
+	if res != nil {
+		t.Fatalf("Get: %s", res.Error())
+	}
+	defer s.Close()
+	if res := s.ApplyBookmark(ctx, "bm-1"); res != nil {
+		t.Fatalf("ApplyBookmark: %s", res.Error())
+	}
+	if res := s.SelectValues(ctx, "Compare", "Year", []*enigma.FieldValue{{Text: "2024"}}); res != nil {
+		t.Fatalf("SelectValues: %s", res.Error())
+	}
+
+	eng.socket(0).Close()
+	res = s.Do(ctx, func(ctx context.Context, doc *enigma.Doc) error {
+		_, err := doc.GetAppLayout(ctx)
+		return err
+	})
+	if res != nil {
+		t.Fatalf("Do: %s", res.Error())
+	}
+	if eng.dials() != 2 {
+		t.Fatalf("expected a reconnect, dials: %d", eng.dials())
+	}
+	want := []string{"OpenDoc", "ApplyBookmark", "GetField", "SelectValues", "GetAppLayout"}
+	if calls := eng.socket(1).Calls(); fmt.Sprint(calls) != fmt.Sprint(want) {
+		t.Errorf("calls after reconnect = %v, want %v", calls, want)
+	}
+}
+
+func TestPool_MaxSessionsPerNode(t *testing.T) {
+	p, eng := newTestPool(PoolConfig{MaxSessionsPerNode: 1})
+	defer p.Close()
+
+	s1, res := p.Get(context.Background(), testPoolConfig("app-1"))
+	if res != nil {
+		t.Fatalf("Get: %s", res.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, res := p.Get(ctx, testPoolConfig("app-2")); res == nil {
+		t.Fatal("Get should wait for a free session and time out")
+	}
+
+	// idle session of another app is closed to make room
+	s1.Release()
+	s2, res := p.Get(context.Background(), testPoolConfig("app-2"))
+	if res != nil {
+		t.Fatalf("Get: %s", res.Error())
+	}
+	defer s2.Release()
+	if stats := p.Stats(); stats.Idle != 0 || stats.Open["wss://qs-node1:4747"] != 1 || eng.dials() != 2 {
+		t.Errorf("unexpected stats %+v, dials %d", stats, eng.dials())
+	}
+}
+
+func TestPool_DropInvalidAndEvictIdle(t *testing.T) {
+	p, eng := newTestPool(PoolConfig{IdleTimeoutSec: 60})
+	defer p.Close()
+	ctx := context.Background()
+
+	s, res := p.Get(ctx, testPoolConfig("app-1"))
+	if res != nil {
+		t.Fatalf("Get: %s", res.Error())
+	}
+	s.Release()
+	eng.socket(0).Close()
+
+	s2, res := p.Get(ctx, testPoolConfig("app-1"))
+	if res != nil {
+		t.Fatalf("Get: %s", res.Error())
+	}
+	if s2 == s || eng.dials() != 2 {
+		t.Errorf("dropped session should not be reused, dials: %d", eng.dials())
+	}
+	s2.Release()
+
+	p.mu.Lock()
+	for _, sessions := range p.idle {
+		for _, s := range sessions {
+			s.lastUsed = time.Now().Add(-2 * time.Minute)
+		}
+	}
+	p.mu.Unlock()
+	p.EvictIdle()
+	if stats := p.Stats(); stats.Idle != 0 || len(stats.Open) != 0 {
+		t.Errorf("idle session should be evicted, stats %+v", stats)
+	}
+}
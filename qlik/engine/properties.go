@@ -1,7 +1,9 @@
 package engine
 
 import (
+	"context"
 	"encoding/json"
+	"strconv"
 
 	"github.com/qlik-oss/enigma-go/v4"
 	"github.com/rs/zerolog"
@@ -26,11 +28,85 @@ type ObjectPropeties struct {
 	ChildInfos []*ObjectPropeties `json:"qChildInfos"`
 }
 
+// VolatileProperties are paths of properties set by the engine or depending on the user, rather than defined
+// by app developers, in the syntax of DiffOptions.IgnorePaths. Only qMeta and top level properties are
+// volatile, properties of the same name nested in definitions are kept.
+var VolatileProperties = []string{
+	"/qMeta",
+	"/createdDate",
+	"/modifiedDate",
+	"/creationDate",
+	"/publishTime",
+	"/privileges",
+	"/qSelectionInfo",
+}
+
 func (p *ObjectPropeties) RemoveVolatileFields() {
 	p.Meta.CreatedDate = nil
 	p.Meta.ModifiedDate = nil
 }
 
+// RemoveVolatileObjectProperties removes VolatileProperties from p and its children,
+// unlike ObjectPropeties.RemoveVolatileFields which clears only dates of `Meta`.
+func RemoveVolatileObjectProperties(p *ObjectPropeties) *util.Result {
+	if p.Meta != nil {
+		p.Meta.CreatedDate = nil
+		p.Meta.ModifiedDate = nil
+		p.Meta.PublishTime = nil
+		p.Meta.Privileges = nil
+	}
+	prop, res := RemoveVolatileProperties(p.Properties)
+	if res != nil {
+		return res
+	}
+	p.Properties = prop
+	for _, c := range p.ChildInfos {
+		if c == nil {
+			continue
+		}
+		if res := RemoveVolatileObjectProperties(c); res != nil {
+			return res.With("child " + util.MaybeNil(c.Info).Id)
+		}
+	}
+	return nil
+}
+
+// RemoveVolatileProperties removes VolatileProperties from prop.
+func RemoveVolatileProperties(prop json.RawMessage) (json.RawMessage, *util.Result) {
+	if len(prop) == 0 {
+		return prop, nil
+	}
+	var v any
+	if err := json.Unmarshal(prop, &v); err != nil {
+		return nil, util.Error("ParseProperties", err)
+	}
+	(&DiffOptions{IgnorePaths: VolatileProperties}).removeIgnored("", v)
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return nil, util.Error("EncodeProperties", err)
+	}
+	return buf, nil
+}
+
+// removeIgnored removes members of v at paths ignored by opts, elements of arrays are matched by index.
+func (opts *DiffOptions) removeIgnored(p string, v any) {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, c := range t {
+			kp := p + "/" + escapePointer(k)
+			if opts.isIgnored(kp) {
+				delete(t, k)
+				continue
+			}
+			opts.removeIgnored(kp, c)
+		}
+	case []any:
+		for i, c := range t {
+			opts.removeIgnored(p+"/"+strconv.Itoa(i), c)
+		}
+	}
+}
+
 func (p *ObjectPropeties) GetChild(id string) (*ObjectPropeties, bool) {
 	if p.Info != nil && p.Info.Id == id {
 		return p, true
@@ -125,6 +201,10 @@ func GetTitle(parentInfo *enigma.NxInfo, obj *ObjectPropeties, logger *zerolog.L
 }
 
 func GetTitleEx(obj enigma.GenericObject, objLayout ObjectLayoutEx) (*string, *string, *util.Result) {
+	return GetTitleExContext(ConnCtx, obj, objLayout)
+}
+
+func GetTitleExContext(ctx context.Context, obj enigma.GenericObject, objLayout ObjectLayoutEx) (*string, *string, *util.Result) {
 	if objLayout.Title != "" {
 		return &objLayout.Title, nil, nil
 	}
@@ -132,7 +212,7 @@ func GetTitleEx(obj enigma.GenericObject, objLayout ObjectLayoutEx) (*string, *s
 	prop := ObjectPropeties{
 		Info: objLayout.Info,
 	}
-	rawProp, err := obj.GetPropertiesRaw(ConnCtx)
+	rawProp, err := obj.GetPropertiesRaw(ctx)
 	if err != nil {
 		return nil, nil, util.Error("GetPropertiesRaw", err)
 	}
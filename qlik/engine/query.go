@@ -0,0 +1,370 @@
+package engine
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/soderasen-au/go-common/util"
+)
+
+const (
+	QUERY_OBJECT_TYPE      = "table"
+	QUERY_SORT_DESC_PREFIX = "-"
+	QUERY_TAG              = "query"
+)
+
+// QueryDimension is a field or a master dimension, Master matches the title or the id of a master dimension.
+type QueryDimension struct {
+	Field        string `json:"field,omitempty" yaml:"field,omitempty"`
+	Master       string `json:"master,omitempty" yaml:"master,omitempty"`
+	Label        string `json:"label,omitempty" yaml:"label,omitempty"`
+	SuppressNull bool   `json:"suppress_null,omitempty" yaml:"suppress_null,omitempty"`
+}
+
+// QueryMeasure is an expression or a master measure, Master matches the title or the id of a master measure.
+type QueryMeasure struct {
+	Expr   string `json:"expr,omitempty" yaml:"expr,omitempty"`
+	Master string `json:"master,omitempty" yaml:"master,omitempty"`
+	Label  string `json:"label,omitempty" yaml:"label,omitempty"`
+}
+
+// Query is an ad-hoc straight hypercube computed by a session object.
+// SortBy holds column labels, prefixed by QUERY_SORT_DESC_PREFIX for descending order.
+type Query struct {
+	Title        string            `json:"title,omitempty" yaml:"title,omitempty"`
+	Dimensions   []*QueryDimension `json:"dimensions,omitempty" yaml:"dimensions,omitempty"`
+	Measures     []*QueryMeasure   `json:"measures,omitempty" yaml:"measures,omitempty"`
+	SortBy       []string          `json:"sort_by,omitempty" yaml:"sort_by,omitempty"`
+	SuppressZero bool              `json:"suppress_zero,omitempty" yaml:"suppress_zero,omitempty"`
+	SuppressNull bool              `json:"suppress_null,omitempty" yaml:"suppress_null,omitempty"`
+	State        string            `json:"state,omitempty" yaml:"state,omitempty"`
+	MaxRows      int               `json:"max_rows,omitempty" yaml:"max_rows,omitempty"`
+}
+
+type QueryCell struct {
+	Text   string   `json:"text"`
+	Num    *float64 `json:"num,omitempty"`
+	IsNull bool     `json:"is_null,omitempty"`
+}
+
+type QueryRow []QueryCell
+
+type QueryResult struct {
+	Columns []string   `json:"columns"`
+	Rows    []QueryRow `json:"rows"`
+}
+
+type queryProperties struct {
+	Info         *enigma.NxInfo       `json:"qInfo"`
+	HyperCubeDef *enigma.HyperCubeDef `json:"qHyperCubeDef"`
+	Title        string               `json:"title,omitempty"`
+}
+
+func NewQuery(title string) *Query {
+	return &Query{Title: title}
+}
+
+func (q *Query) Dimension(field string) *Query {
+	q.Dimensions = append(q.Dimensions, &QueryDimension{Field: field})
+	return q
+}
+
+func (q *Query) MasterDimension(title string) *Query {
+	q.Dimensions = append(q.Dimensions, &QueryDimension{Master: title})
+	return q
+}
+
+func (q *Query) Measure(expr, label string) *Query {
+	q.Measures = append(q.Measures, &QueryMeasure{Expr: expr, Label: label})
+	return q
+}
+
+func (q *Query) MasterMeasure(title string) *Query {
+	q.Measures = append(q.Measures, &QueryMeasure{Master: title})
+	return q
+}
+
+func (q *Query) OrderBy(labels ...string) *Query {
+	q.SortBy = append(q.SortBy, labels...)
+	return q
+}
+
+func (q *Query) InState(state string) *Query {
+	q.State = state
+	return q
+}
+
+func (d QueryDimension) label() string {
+	return cmp.Or(d.Label, d.Field, d.Master)
+}
+
+func (m QueryMeasure) label() string {
+	return cmp.Or(m.Label, m.Expr, m.Master)
+}
+
+// Columns returns labels of dimensions followed by labels of measures.
+func (q *Query) Columns() []string {
+	ret := make([]string, 0, len(q.Dimensions)+len(q.Measures))
+	for _, d := range q.Dimensions {
+		ret = append(ret, d.label())
+	}
+	for _, m := range q.Measures {
+		ret = append(ret, m.label())
+	}
+	return ret
+}
+
+// HyperCubeDef resolves master items of q and returns its hypercube definition.
+func (q *Query) HyperCubeDef(ctx context.Context, doc *enigma.Doc) (*enigma.HyperCubeDef, *util.Result) {
+	if len(q.Dimensions)+len(q.Measures) == 0 {
+		return nil, util.MsgError("HyperCubeDef", "query has no column")
+	}
+
+	var masterDims []*SessionDimensionLayout
+	var masterMeasures []*SessionMeasureLayout
+	var res *util.Result
+	def := &enigma.HyperCubeDef{
+		StateName:       q.State,
+		Mode:            "S",
+		SuppressZero:    q.SuppressZero,
+		SuppressMissing: q.SuppressNull,
+	}
+	for i, d := range q.Dimensions {
+		dim := &enigma.NxDimension{NullSuppression: d.SuppressNull || q.SuppressNull}
+		switch {
+		case d.Field != "":
+			dim.Def = &enigma.NxInlineDimensionDef{FieldDefs: []string{d.Field}}
+			if d.Label != "" {
+				dim.Def.FieldLabels = []string{d.Label}
+			}
+		case d.Master != "":
+			if masterDims == nil {
+				if masterDims, res = GetDimensionListContext(ctx, doc); res != nil {
+					return nil, res.With("GetDimensionList")
+				}
+			}
+			for _, m := range masterDims {
+				if m.Info != nil && (m.Info.Id == d.Master || (m.Meta != nil && util.MaybeNil(m.Meta.Title) == d.Master)) {
+					dim.LibraryId = m.Info.Id
+					break
+				}
+			}
+			if dim.LibraryId == "" {
+				return nil, util.MsgError("HyperCubeDef", fmt.Sprintf("master dimension `%s` not found", d.Master))
+			}
+			dim.Def = &enigma.NxInlineDimensionDef{}
+		default:
+			return nil, util.MsgError("HyperCubeDef", fmt.Sprintf("dimension[%d] has neither field nor master", i))
+		}
+		def.Dimensions = append(def.Dimensions, dim)
+	}
+	for i, m := range q.Measures {
+		msr := &enigma.NxMeasure{SortBy: &enigma.SortCriteria{}}
+		switch {
+		case m.Expr != "":
+			msr.Def = &enigma.NxInlineMeasureDef{Def: m.Expr, Label: m.label()}
+		case m.Master != "":
+			if masterMeasures == nil {
+				if masterMeasures, res = GetMeasureListContext(ctx, doc); res != nil {
+					return nil, res.With("GetMeasureList")
+				}
+			}
+			for _, mm := range masterMeasures {
+				if mm.Info != nil && (mm.Info.Id == m.Master || (mm.Meta != nil && util.MaybeNil(mm.Meta.Title) == m.Master)) {
+					msr.LibraryId = mm.Info.Id
+					break
+				}
+			}
+			if msr.LibraryId == "" {
+				return nil, util.MsgError("HyperCubeDef", fmt.Sprintf("master measure `%s` not found", m.Master))
+			}
+			msr.Def = &enigma.NxInlineMeasureDef{Label: m.Label}
+		default:
+			return nil, util.MsgError("HyperCubeDef", fmt.Sprintf("measure[%d] has neither expression nor master", i))
+		}
+		def.Measures = append(def.Measures, msr)
+	}
+
+	columns := q.Columns()
+	sorted := make(map[int]bool)
+	for _, s := range q.SortBy {
+		label, dir := strings.TrimPrefix(s, QUERY_SORT_DESC_PREFIX), 1
+		if label != s {
+			dir = -1
+		}
+		col := slices.Index(columns, label)
+		if col < 0 {
+			return nil, util.MsgError("HyperCubeDef", fmt.Sprintf("sort column `%s` not found", label))
+		}
+		if col < len(def.Dimensions) {
+			def.Dimensions[col].Def.SortCriterias = []*enigma.SortCriteria{{SortByNumeric: dir, SortByAscii: dir}}
+		} else {
+			def.Measures[col-len(def.Dimensions)].SortBy.SortByNumeric = dir
+		}
+		def.InterColumnSortOrder = append(def.InterColumnSortOrder, col)
+		sorted[col] = true
+	}
+	if len(def.InterColumnSortOrder) > 0 {
+		for col := range columns {
+			if !sorted[col] {
+				def.InterColumnSortOrder = append(def.InterColumnSortOrder, col)
+			}
+		}
+	}
+	return def, nil
+}
+
+// CreateObject creates a session object computing q, callers destroy it with DestroySessionObject.
+func (q *Query) CreateObject(doc *enigma.Doc) (*enigma.GenericObject, *util.Result) {
+	return q.CreateObjectContext(ConnCtx, doc)
+}
+
+func (q *Query) CreateObjectContext(ctx context.Context, doc *enigma.Doc) (*enigma.GenericObject, *util.Result) {
+	def, res := q.HyperCubeDef(ctx, doc)
+	if res != nil {
+		return nil, res.With("HyperCubeDef")
+	}
+	obj, err := doc.CreateSessionObjectRaw(ctx, &queryProperties{
+		Info:         &enigma.NxInfo{Type: QUERY_OBJECT_TYPE},
+		HyperCubeDef: def,
+		Title:        q.Title,
+	})
+	if err != nil {
+		return nil, util.Error("CreateSessionObject", err)
+	}
+	return obj, nil
+}
+
+// Run computes q in a session object destroyed afterwards and returns all its rows up to MaxRows.
+func (q *Query) Run(doc *enigma.Doc) (*QueryResult, *util.Result) {
+	return q.RunContext(ConnCtx, doc)
+}
+
+func (q *Query) RunContext(ctx context.Context, doc *enigma.Doc) (*QueryResult, *util.Result) {
+	obj, res := q.CreateObjectContext(ctx, doc)
+	if res != nil {
+		return nil, res.With("CreateObject")
+	}
+	// the session object is destroyed even if ctx is canceled
+	defer doc.DestroySessionObject(context.WithoutCancel(ctx), obj.GenericId)
+
+	layout, res := GetObjectLayoutExContext(ctx, obj)
+	if res != nil {
+		return nil, res.With("GetLayout")
+	}
+	if layout.HyperCube == nil || layout.HyperCube.Size == nil {
+		return nil, util.MsgError("GetLayout", "no hypercube in layout")
+	}
+	if layout.HyperCube.Error != nil {
+		return nil, util.MsgError("GetLayout", fmt.Sprintf("hypercube error %d", layout.HyperCube.Error.ErrorCode))
+	}
+
+	size := *layout.HyperCube.Size
+	if q.MaxRows > 0 {
+		size.Cy = util.Min(size.Cy, q.MaxRows)
+	}
+	ret := &QueryResult{Columns: q.Columns(), Rows: make([]QueryRow, 0, size.Cy)}
+	if size.Cy == 0 || size.Cx == 0 {
+		return ret, nil
+	}
+	pages, res := GetHyperCubeDataContext(ctx, obj, size, PivotPaging)
+	if res != nil {
+		return nil, res.With("GetHyperCubeData")
+	}
+	for _, page := range pages {
+		for _, cells := range page.Matrix {
+			if len(ret.Rows) >= size.Cy {
+				break
+			}
+			row := make(QueryRow, 0, len(cells))
+			for _, c := range cells {
+				cell := QueryCell{Text: c.Text, IsNull: c.IsNull}
+				if n := float64(c.Num); !math.IsNaN(n) && !c.IsNull {
+					cell.Num = &n
+				}
+				row = append(row, cell)
+			}
+			ret.Rows = append(ret.Rows, row)
+		}
+	}
+	return ret, nil
+}
+
+// Column returns the index of the column labelled label, or -1.
+func (r *QueryResult) Column(label string) int {
+	return slices.Index(r.Columns, label)
+}
+
+// ScanQueryRows maps rows of r to T, whose fields are tagged with column labels like `query:"Region"`.
+// string fields get the text of cells, numeric fields get their number.
+func ScanQueryRows[T any](r *QueryResult) ([]T, *util.Result) {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	if typ.Kind() != reflect.Struct {
+		return nil, util.MsgError("ScanQueryRows", typ.String()+" is not a struct")
+	}
+	fields := make(map[int]int)
+	for i := 0; i < typ.NumField(); i++ {
+		label, ok := typ.Field(i).Tag.Lookup(QUERY_TAG)
+		if !ok || !typ.Field(i).IsExported() {
+			continue
+		}
+		col := r.Column(label)
+		if col < 0 {
+			return nil, util.MsgError("ScanQueryRows", fmt.Sprintf("column `%s` of %s not found", label, typ.Field(i).Name))
+		}
+		fields[i] = col
+	}
+
+	ret := make([]T, 0, len(r.Rows))
+	for ri, row := range r.Rows {
+		var t T
+		v := reflect.ValueOf(&t).Elem()
+		for fi, col := range fields {
+			if col >= len(row) {
+				continue
+			}
+			if res := setQueryField(v.Field(fi), row[col]); res != nil {
+				return nil, res.With(fmt.Sprintf("row[%d].%s", ri, typ.Field(fi).Name))
+			}
+		}
+		ret = append(ret, t)
+	}
+	return ret, nil
+}
+
+func setQueryField(f reflect.Value, c QueryCell) *util.Result {
+	if f.Kind() == reflect.Pointer {
+		if c.IsNull || (f.Type().Elem().Kind() != reflect.String && c.Num == nil) {
+			return nil
+		}
+		f.Set(reflect.New(f.Type().Elem()))
+		f = f.Elem()
+	}
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(c.Text)
+	case reflect.Float32, reflect.Float64:
+		if c.Num != nil {
+			f.SetFloat(*c.Num)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if c.Num != nil {
+			f.SetInt(int64(*c.Num))
+		}
+	case reflect.Bool:
+		f.SetBool(!c.IsNull)
+	default:
+		if f.Type() == reflect.TypeOf(c) {
+			f.Set(reflect.ValueOf(c))
+			return nil
+		}
+		return util.MsgError("SetField", "unsupported type "+f.Type().String())
+	}
+	return nil
+}
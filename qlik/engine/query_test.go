@@ -0,0 +1,117 @@
+package engine_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/soderasen-au/go-common/util"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+	"github.com/soderasen-au/go-qlik/qlik/engine/enginetest"
+)
+
+func TestFake_Query(t *testing.T) {
+	srv, doc := enginetest.OpenDoc(t, enginetest.SalesFixture())
+
+	tests := []struct {
+		name    string
+		query   *engine.Query
+		columns string
+		rows    []string
+		wantErr bool
+	}{
+		{
+			name:    "masters sorted descending",
+			query:   engine.NewQuery("by region").MasterDimension("Region").MasterMeasure("Total Sales").OrderBy("-Total Sales"),
+			columns: "Region,Total Sales",
+			rows:    []string{"West,210", "East,140", "North,80"},
+		},
+		{
+			name:    "fields sorted ascending",
+			query:   engine.NewQuery("").Dimension("Region").Dimension("Product").Measure("Sum(Sales)", "Sales").OrderBy("Region", "Product"),
+			columns: "Region,Product,Sales",
+			rows:    []string{"East,Bikes,100", "East,Helmets,40", "North,Bikes,80", "West,Bikes,150", "West,Helmets,60"},
+		},
+		{
+			name:    "max rows",
+			query:   &engine.Query{Dimensions: []*engine.QueryDimension{{Field: "Year"}}, Measures: []*engine.QueryMeasure{{Expr: "Count(distinct Product)"}}, MaxRows: 1},
+			columns: "Year,Count(distinct Product)",
+			rows:    []string{"2023,2"},
+		},
+		{
+			name:    "unknown master",
+			query:   engine.NewQuery("").MasterDimension("Country"),
+			wantErr: true,
+		},
+		{
+			name:    "unknown sort column",
+			query:   engine.NewQuery("").Dimension("Region").OrderBy("-Sales"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ret, res := tt.query.Run(doc)
+			if tt.wantErr {
+				if res == nil {
+					t.Errorf("Run() = %s, want error", util.JsonStr(ret))
+				}
+				return
+			}
+			if res != nil {
+				t.Fatalf("Run: %v", res)
+			}
+			if got := strings.Join(ret.Columns, ","); got != tt.columns {
+				t.Errorf("columns = %s, want %s", got, tt.columns)
+			}
+			rows := make([]string, len(ret.Rows))
+			for i, row := range ret.Rows {
+				cells := make([]string, len(row))
+				for j, c := range row {
+					cells[j] = c.Text
+				}
+				rows[i] = strings.Join(cells, ",")
+			}
+			if strings.Join(rows, "|") != strings.Join(tt.rows, "|") {
+				t.Errorf("rows = %v, want %v", rows, tt.rows)
+			}
+		})
+	}
+
+	methods := strings.Join(srv.Methods(), ",")
+	if strings.Count(methods, "DestroySessionObject") != 3 {
+		t.Errorf("methods = %s", methods)
+	}
+}
+
+func TestScanQueryRows(t *testing.T) {
+	num := func(f float64) *float64 { return &f }
+	r := &engine.QueryResult{
+		Columns: []string{"Region", "Sales"},
+		Rows: []engine.QueryRow{
+			{{Text: "East", Num: num(1)}, {Text: "140", Num: num(140)}},
+			{{Text: "-", IsNull: true}, {Text: "-", IsNull: true}},
+		},
+	}
+	type sales struct {
+		Region string   `query:"Region"`
+		Sales  float64  `query:"Sales"`
+		Count  int      `query:"Sales"`
+		Ptr    *float64 `query:"Sales"`
+		Other  string
+	}
+	rows, res := engine.ScanQueryRows[sales](r)
+	if res != nil {
+		t.Fatalf("ScanQueryRows: %v", res)
+	}
+	if len(rows) != 2 || rows[0].Region != "East" || rows[0].Sales != 140 || rows[0].Count != 140 || *rows[0].Ptr != 140 || rows[1].Ptr != nil {
+		t.Errorf("rows = %s", util.JsonStr(rows))
+	}
+
+	type missing struct {
+		Year string `query:"Year"`
+	}
+	if _, res := engine.ScanQueryRows[missing](r); res == nil {
+		t.Errorf("ScanQueryRows[missing] want error")
+	}
+}
@@ -0,0 +1,61 @@
+package engine
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/soderasen-au/go-common/util"
+)
+
+// RateLimiter spaces engine calls evenly, it can be shared by walks and connections
+// to limit the load of all of them on an engine.
+type RateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// NewRateLimiter allows perSecond calls per second, nil if perSecond isn't positive.
+func NewRateLimiter(perSecond float64) *RateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &RateLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// Wait waits for the next call slot or until ctx is done, a nil limiter doesn't wait.
+func (l *RateLimiter) Wait(ctx context.Context) *util.Result {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	if d := at.Sub(now); d > 0 {
+		return sleepContext(ctx, d)
+	}
+	return ctxResult(ctx, "RateLimiter.Wait")
+}
+
+// Interceptor limits every request of a connection.
+func (l *RateLimiter) Interceptor(ctx context.Context, invocation *enigma.Invocation, next enigma.InterceptorContinuation) *enigma.InvocationResponse {
+	if res := l.Wait(ctx); res != nil {
+		return &enigma.InvocationResponse{Error: res}
+	}
+	return next(ctx, invocation)
+}
+
+// DialerHook adds the interceptor of l to d, assign it to `Config.DialerHook`.
+// Walks over docs of such connections are limited already, so l must not be their `WalkOptions.RateLimiter` too,
+// or each call would wait twice.
+func (l *RateLimiter) DialerHook(d *enigma.Dialer) {
+	d.Interceptors = append(d.Interceptors, l.Interceptor)
+}
@@ -0,0 +1,303 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"maps"
+	"reflect"
+	"strings"
+)
+
+// RawProperties is embedded by typed properties to keep the JSON they were decoded from.
+// Keys without a typed field, and typed fields left unchanged, are encoded back as they were read,
+// changed typed fields are merged into the JSON read, see `mergeProperty`,
+// so decoding and encoding properties doesn't lose anything the engine or an extension stored.
+type RawProperties struct {
+	raw map[string]json.RawMessage
+}
+
+func (p *RawProperties) rawProperties() *RawProperties {
+	return p
+}
+
+// Raw returns property key as read, or nil.
+func (p *RawProperties) Raw(key string) json.RawMessage {
+	return p.raw[key]
+}
+
+// SetRaw sets property key which has no typed field, a nil value removes it.
+func (p *RawProperties) SetRaw(key string, value json.RawMessage) {
+	if p.raw == nil {
+		p.raw = make(map[string]json.RawMessage)
+	}
+	if value == nil {
+		delete(p.raw, key)
+		return
+	}
+	p.raw[key] = value
+}
+
+type rawPropertiesHolder interface {
+	rawProperties() *RawProperties
+}
+
+var rawPropertiesType = reflect.TypeOf(RawProperties{})
+
+// eachProperty calls fn with json key and value of every tagged field of struct v,
+// including fields of embedded structs.
+func eachProperty(v reflect.Value, fn func(key string, f reflect.Value) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Type == rawPropertiesType {
+			continue
+		}
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct && sf.Tag.Get("json") == "" {
+			if err := eachProperty(v.Field(i), fn); err != nil {
+				return err
+			}
+			continue
+		}
+		key, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if !sf.IsExported() || key == "" || key == "-" {
+			continue
+		}
+		if err := fn(key, v.Field(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unmarshalProperties(data []byte, v rawPropertiesHolder) error {
+	raw := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*v.rawProperties() = RawProperties{raw: raw}
+	return eachProperty(reflect.ValueOf(v).Elem(), func(key string, f reflect.Value) error {
+		// a property of another type is kept as read and its field left unset
+		if b, ok := raw[key]; ok && json.Unmarshal(b, f.Addr().Interface()) != nil {
+			f.SetZero()
+		}
+		return nil
+	})
+}
+
+func marshalProperties(v rawPropertiesHolder) ([]byte, error) {
+	read := v.rawProperties().raw
+	out := make(map[string]json.RawMessage, len(read))
+	maps.Copy(out, read)
+	err := eachProperty(reflect.ValueOf(v).Elem(), func(key string, f reflect.Value) error {
+		buf, err := json.Marshal(f.Interface())
+		if err != nil {
+			return err
+		}
+		if b, ok := read[key]; ok {
+			n, typed := normalizeProperty(b, f.Type())
+			if bytes.Equal(buf, n) || (!typed && f.IsZero()) {
+				return nil
+			}
+			if typed && !f.IsZero() {
+				merged, err := mergeProperty(b, n, buf)
+				if err != nil {
+					return err
+				}
+				out[key] = merged
+				return nil
+			}
+		}
+		if f.IsZero() {
+			delete(out, key)
+		} else {
+			out[key] = buf
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(out)
+}
+
+// normalizeProperty returns b as typed t would encode it, to tell if a typed field was changed,
+// false if b isn't of type t.
+func normalizeProperty(b json.RawMessage, t reflect.Type) ([]byte, bool) {
+	v := reflect.New(t)
+	if err := json.Unmarshal(b, v.Interface()); err != nil {
+		return nil, false
+	}
+	buf, err := json.Marshal(v.Elem().Interface())
+	return buf, err == nil
+}
+
+// mergeProperty applies changes of a typed value to the JSON it was decoded from, so that keys without
+// a typed field are kept at any depth: read is the JSON as read, typed is read encoded by the typed field
+// before and changed is the typed field encoded now.
+func mergeProperty(read, typed, changed []byte) ([]byte, error) {
+	var r, t, c any
+	for _, v := range []struct {
+		b []byte
+		p *any
+	}{{read, &r}, {typed, &t}, {changed, &c}} {
+		d := json.NewDecoder(bytes.NewReader(v.b))
+		d.UseNumber()
+		if err := d.Decode(v.p); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(mergeValue(r, t, c))
+}
+
+// mergeValue merges objects by key and arrays by item, any other change replaces read.
+func mergeValue(read, typed, changed any) any {
+	switch c := changed.(type) {
+	case map[string]any:
+		r, rok := read.(map[string]any)
+		t, tok := typed.(map[string]any)
+		if !rok || !tok {
+			return changed
+		}
+		out := make(map[string]any, len(r))
+		for k, v := range r {
+			// keys of the typed value which are gone were cleared, the others have no typed field
+			if _, ok := t[k]; !ok {
+				out[k] = v
+			}
+		}
+		for k, v := range c {
+			if rv, ok := r[k]; ok {
+				if tv, ok := t[k]; ok {
+					out[k] = mergeValue(rv, tv, v)
+					continue
+				}
+			}
+			out[k] = v
+		}
+		return out
+	case []any:
+		r, rok := read.([]any)
+		t, tok := typed.([]any)
+		if !rok || !tok || len(r) != len(t) {
+			return changed
+		}
+		return mergeItems(r, t, c)
+	}
+	if reflect.DeepEqual(typed, changed) {
+		return read
+	}
+	return changed
+}
+
+// mergeItems matches each changed item with an item read: an unchanged item by value,
+// otherwise by `cId`, which typed values may not have, or by index.
+func mergeItems(read, typed, changed []any) []any {
+	out := make([]any, len(changed))
+	used := make([]bool, len(read))
+	matched := make([]bool, len(changed))
+	for i, c := range changed {
+		for j, t := range typed {
+			if !used[j] && reflect.DeepEqual(t, c) {
+				out[i], used[j], matched[i] = read[j], true, true
+				break
+			}
+		}
+	}
+	for i, c := range changed {
+		if matched[i] {
+			continue
+		}
+		j := -1
+		if id := itemCId(c); id != "" {
+			for k, r := range read {
+				if !used[k] && itemCId(r) == id {
+					j = k
+					break
+				}
+			}
+		} else if i < len(read) && !used[i] {
+			j = i
+		}
+		if j < 0 {
+			out[i] = c
+			continue
+		}
+		out[i], used[j] = mergeValue(read[j], typed[j], c), true
+	}
+	return out
+}
+
+// itemCId returns `cId` of an item or of its `qDef`, as kept by dimensions and measures.
+func itemCId(item any) string {
+	m, _ := item.(map[string]any)
+	if id, ok := m["cId"].(string); ok {
+		return id
+	}
+	def, _ := m["qDef"].(map[string]any)
+	id, _ := def["cId"].(string)
+	return id
+}
+
+// StringOrExpr is a property which is either a string or an expression like
+// `{"qStringExpression": {"qExpr": "=..."}}`.
+type StringOrExpr struct {
+	Text string
+	Expr string
+
+	valueExpr bool // `qValueExpression` rather than `qStringExpression`
+}
+
+func NewStringOrExpr(s string) *StringOrExpr {
+	return &StringOrExpr{Text: s}
+}
+
+// String returns the expression, or the text if it's not an expression.
+func (s *StringOrExpr) String() string {
+	if s == nil {
+		return ""
+	}
+	if s.Expr != "" {
+		return s.Expr
+	}
+	return s.Text
+}
+
+type stringExprJson struct {
+	StringExpression *struct {
+		Expr string `json:"qExpr"`
+	} `json:"qStringExpression,omitempty"`
+	ValueExpression *struct {
+		Expr string `json:"qExpr"`
+	} `json:"qValueExpression,omitempty"`
+}
+
+func (s *StringOrExpr) UnmarshalJSON(b []byte) error {
+	*s = StringOrExpr{}
+	if len(b) > 0 && b[0] != '{' {
+		return json.Unmarshal(b, &s.Text)
+	}
+	var e stringExprJson
+	if err := json.Unmarshal(b, &e); err != nil {
+		return err
+	}
+	if e.StringExpression != nil {
+		s.Expr = e.StringExpression.Expr
+	} else if e.ValueExpression != nil {
+		s.Expr = e.ValueExpression.Expr
+		s.valueExpr = true
+	}
+	return nil
+}
+
+func (s StringOrExpr) MarshalJSON() ([]byte, error) {
+	if s.Expr == "" {
+		return json.Marshal(s.Text)
+	}
+	expr := &struct {
+		Expr string `json:"qExpr"`
+	}{s.Expr}
+	if s.valueExpr {
+		return json.Marshal(stringExprJson{ValueExpression: expr})
+	}
+	return json.Marshal(stringExprJson{StringExpression: expr})
+}
@@ -0,0 +1,468 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/soderasen-au/go-common/loggers"
+	"github.com/soderasen-au/go-common/util"
+)
+
+const (
+	DEFAULT_ROUTER_REFRESH_INTERVAL_SEC int = 30
+	DEFAULT_ROUTER_HEALTH_TIMEOUT_SEC   int = 10
+	DEFAULT_ROUTER_FAILURE_THRESHOLD    int = 3
+	DEFAULT_ROUTER_COOLDOWN_SEC         int = 60
+)
+
+type NodeState string
+
+const (
+	NODE_STATE_UP        NodeState = "up"
+	NODE_STATE_DOWN      NodeState = "down"
+	NODE_STATE_HALF_OPEN NodeState = "half_open" // cooldown is over, the next pick is a trial
+)
+
+type RouterConfig struct {
+	RefreshIntervalSec int `json:"refresh_interval_sec,omitempty" yaml:"refresh_interval_sec,omitempty" bson:"refresh_interval_sec,omitempty"`
+	HealthTimeoutSec   int `json:"health_timeout_sec,omitempty" yaml:"health_timeout_sec,omitempty" bson:"health_timeout_sec,omitempty"`
+	FailureThreshold   int `json:"failure_threshold,omitempty" yaml:"failure_threshold,omitempty" bson:"failure_threshold,omitempty"` // consecutive failures to mark a node down
+	CooldownSec        int `json:"cooldown_sec,omitempty" yaml:"cooldown_sec,omitempty" bson:"cooldown_sec,omitempty"`                // how long a node stays down before a trial
+}
+
+func DefaultRouterConfig() *RouterConfig {
+	return &RouterConfig{
+		RefreshIntervalSec: DEFAULT_ROUTER_REFRESH_INTERVAL_SEC,
+		HealthTimeoutSec:   DEFAULT_ROUTER_HEALTH_TIMEOUT_SEC,
+		FailureThreshold:   DEFAULT_ROUTER_FAILURE_THRESHOLD,
+		CooldownSec:        DEFAULT_ROUTER_COOLDOWN_SEC,
+	}
+}
+
+type HealthFunc func(ctx context.Context, cfg Config) (*HealthInfo, *util.Result)
+
+// NodeStatus is a row of the routing table.
+type NodeStatus struct {
+	EngineURI   string      `json:"engine_uri" yaml:"engine_uri"`
+	Weight      int         `json:"weight" yaml:"weight"`
+	State       NodeState   `json:"state" yaml:"state"`
+	Load        float64     `json:"load" yaml:"load"` // active sessions per weight, -1 if health is unknown
+	Failures    int         `json:"failures" yaml:"failures"`
+	LastError   string      `json:"last_error,omitempty" yaml:"last_error,omitempty"`
+	DownUntil   *time.Time  `json:"down_until,omitempty" yaml:"down_until,omitempty"`
+	RefreshedAt *time.Time  `json:"refreshed_at,omitempty" yaml:"refreshed_at,omitempty"`
+	Health      *HealthInfo `json:"health,omitempty" yaml:"health,omitempty"`
+}
+
+type routerNode struct {
+	cfg         *Config
+	weight      int
+	client      *HttpClient
+	health      *HealthInfo
+	refreshedAt time.Time
+	failures    int
+	downUntil   time.Time
+	lastErr     string
+}
+
+func (n *routerNode) load() float64 {
+	if n.health == nil {
+		return -1
+	}
+	return float64(n.health.Session.Active) / float64(n.weight)
+}
+
+// ClusterRouter is a long-lived and thread-safe alternative of `Cluster.PickOneFor`.
+// It refreshes health info of all nodes in the background, and stops routing to a node
+// after `FailureThreshold` consecutive failures until `CooldownSec` has passed.
+type ClusterRouter struct {
+	Method string
+	Config RouterConfig
+	Health HealthFunc
+	Logger *zerolog.Logger
+
+	mu      sync.Mutex
+	nodes   []*routerNode
+	started bool
+	closed  bool
+	done    chan struct{}
+	wg      sync.WaitGroup
+	now     func() time.Time
+}
+
+func NewClusterRouter(c *Cluster, cfg RouterConfig) (*ClusterRouter, *util.Result) {
+	if c == nil || len(c.Nodes) == 0 {
+		return nil, util.MsgError("NewClusterRouter", "empty cluster")
+	}
+	def := DefaultRouterConfig()
+	if cfg.RefreshIntervalSec <= 0 {
+		cfg.RefreshIntervalSec = def.RefreshIntervalSec
+	}
+	if cfg.HealthTimeoutSec <= 0 {
+		cfg.HealthTimeoutSec = def.HealthTimeoutSec
+	}
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = def.FailureThreshold
+	}
+	if cfg.CooldownSec <= 0 {
+		cfg.CooldownSec = def.CooldownSec
+	}
+
+	r := &ClusterRouter{
+		Method: c.Method,
+		Config: cfg,
+		Logger: loggers.CoreDebugLogger,
+		nodes:  make([]*routerNode, 0, len(c.Nodes)),
+		done:   make(chan struct{}),
+		now:    time.Now,
+	}
+	if c.Logger != nil {
+		r.Logger = c.Logger
+	}
+	for i, node := range c.Nodes {
+		if node == nil {
+			return nil, util.MsgError("NewClusterRouter", fmt.Sprintf("node[%d] is nil", i))
+		}
+		weight := node.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		r.nodes = append(r.nodes, &routerNode{cfg: node, weight: weight})
+	}
+	return r, nil
+}
+
+// Start refreshes health info every `RefreshIntervalSec` until the router is closed.
+func (r *ClusterRouter) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.started || r.closed {
+		return
+	}
+	r.started = true
+	r.wg.Add(1)
+	go r.refreshLoop()
+}
+
+func (r *ClusterRouter) Close() {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+	r.closed = true
+	close(r.done)
+	r.mu.Unlock()
+	r.wg.Wait()
+}
+
+func (r *ClusterRouter) refreshLoop() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(time.Duration(r.Config.RefreshIntervalSec) * time.Second)
+	defer ticker.Stop()
+	for {
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			select {
+			case <-r.done:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		r.Refresh(ctx)
+		cancel()
+
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh polls `/healthcheck` of all nodes, a failed poll counts as a node failure.
+func (r *ClusterRouter) Refresh(ctx context.Context) {
+	r.mu.Lock()
+	nodes := append([]*routerNode{}, r.nodes...)
+	r.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, n := range nodes {
+		wg.Add(1)
+		go func(n *routerNode) {
+			defer wg.Done()
+			hctx, cancel := context.WithTimeout(ctx, time.Duration(r.Config.HealthTimeoutSec)*time.Second)
+			defer cancel()
+			info, res := r.getHealth(hctx, n)
+			if res != nil {
+				if ctx.Err() == nil {
+					r.failed(n, res.With("Refresh"))
+				}
+				return
+			}
+			r.mu.Lock()
+			n.health = info
+			n.refreshedAt = r.now()
+			r.succeeded(n)
+			r.mu.Unlock()
+		}(n)
+	}
+	wg.Wait()
+}
+
+func (r *ClusterRouter) getHealth(ctx context.Context, n *routerNode) (*HealthInfo, *util.Result) {
+	if r.Health != nil {
+		return r.Health(ctx, *n.cfg)
+	}
+	r.mu.Lock()
+	client := n.client
+	r.mu.Unlock()
+	if client == nil {
+		var res *util.Result
+		client, res = NewHttpClient(*n.cfg)
+		if res != nil {
+			return nil, res.With("NewHttpClient")
+		}
+		client.Logger = r.Logger
+		r.mu.Lock()
+		n.client = client
+		r.mu.Unlock()
+	}
+	return client.GetHealthInfoContext(ctx)
+}
+
+func (r *ClusterRouter) find(cfg *Config) *routerNode {
+	for _, n := range r.nodes {
+		if n.cfg == cfg || (cfg != nil && n.cfg.EngineURI == cfg.EngineURI) {
+			return n
+		}
+	}
+	return nil
+}
+
+// ReportSuccess closes the circuit of node `cfg` picked by this router.
+func (r *ClusterRouter) ReportSuccess(cfg *Config) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if n := r.find(cfg); n != nil {
+		r.succeeded(n)
+	}
+}
+
+// ReportFailure counts a failed connection to node `cfg` picked by this router.
+func (r *ClusterRouter) ReportFailure(cfg *Config, err error) {
+	r.mu.Lock()
+	n := r.find(cfg)
+	r.mu.Unlock()
+	if n != nil {
+		r.failed(n, err)
+	}
+}
+
+// succeeded must be called with r.mu locked.
+func (r *ClusterRouter) succeeded(n *routerNode) {
+	if n.failures >= r.Config.FailureThreshold {
+		r.Logger.Info().Msgf("router: node %s is up", n.cfg.EngineURI)
+	}
+	n.failures = 0
+	n.downUntil = time.Time{}
+	n.lastErr = ""
+}
+
+func (r *ClusterRouter) failed(n *routerNode, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n.failures++
+	if err != nil {
+		n.lastErr = err.Error()
+	}
+	if n.failures >= r.Config.FailureThreshold {
+		n.downUntil = r.now().Add(time.Duration(r.Config.CooldownSec) * time.Second)
+		r.Logger.Warn().Msgf("router: node %s is down until %s: %s", n.cfg.EngineURI, n.downUntil.Format(time.RFC3339), n.lastErr)
+	}
+}
+
+func (r *ClusterRouter) state(n *routerNode, now time.Time) NodeState {
+	if n.failures < r.Config.FailureThreshold {
+		return NODE_STATE_UP
+	}
+	if now.Before(n.downUntil) {
+		return NODE_STATE_DOWN
+	}
+	return NODE_STATE_HALF_OPEN
+}
+
+// available returns nodes which are not down, or all nodes if every node is down.
+func (r *ClusterRouter) available(now time.Time) []*routerNode {
+	ret := make([]*routerNode, 0, len(r.nodes))
+	for _, n := range r.nodes {
+		if r.state(n, now) != NODE_STATE_DOWN {
+			ret = append(ret, n)
+		}
+	}
+	if len(ret) == 0 {
+		return r.nodes
+	}
+	return ret
+}
+
+// PickOneFor picks a node by `Method` among nodes which are not down.
+func (r *ClusterRouter) PickOneFor(appid, uid string) *Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	nodes := r.available(now)
+	var ret *routerNode
+	switch r.Method {
+	case HashAppMethod:
+		ret = pickByHash(appid, nodes)
+	case HashUserMethod:
+		ret = pickByHash(uid, nodes)
+	case InMemAppMethod:
+		ret = pickInMemApp(appid, nodes)
+	case LeastLoadedMethod:
+		ret = pickLeastLoaded(nodes)
+	default:
+		ret = pickByWeight(nodes)
+	}
+
+	if r.state(ret, now) == NODE_STATE_HALF_OPEN {
+		// let only one trial through until it's reported
+		ret.downUntil = now.Add(time.Duration(r.Config.CooldownSec) * time.Second)
+	}
+	return ret.cfg
+}
+
+// Connect connects to app `appId` on a picked node and reports the result.
+func (r *ClusterRouter) Connect(ctx context.Context, appId, uid string) (*Conn, *util.Result) {
+	node := r.PickOneFor(appId, uid)
+	cfg := *node
+	cfg.AppID = appId
+	conn, err := NewConnContext(ctx, cfg)
+	if err != nil {
+		if ctx.Err() == nil {
+			r.ReportFailure(node, err)
+		}
+		return nil, util.Error("NewConn", err)
+	}
+	r.ReportSuccess(node)
+	return conn, nil
+}
+
+// RoutingTable returns the current state of all nodes.
+func (r *ClusterRouter) RoutingTable() []NodeStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	ret := make([]NodeStatus, 0, len(r.nodes))
+	for _, n := range r.nodes {
+		status := NodeStatus{
+			EngineURI: n.cfg.EngineURI,
+			Weight:    n.weight,
+			State:     r.state(n, now),
+			Load:      n.load(),
+			Failures:  n.failures,
+			LastError: n.lastErr,
+		}
+		if !n.downUntil.IsZero() {
+			status.DownUntil = util.Ptr(n.downUntil)
+		}
+		if !n.refreshedAt.IsZero() {
+			status.RefreshedAt = util.Ptr(n.refreshedAt)
+		}
+		if n.health != nil {
+			health := *n.health
+			status.Health = &health
+		}
+		ret = append(ret, status)
+	}
+	return ret
+}
+
+func pickByWeight(nodes []*routerNode) *routerNode {
+	total := 0
+	for _, n := range nodes {
+		total += n.weight
+	}
+	i := rand.Intn(total)
+	for _, n := range nodes {
+		if i < n.weight {
+			return n
+		}
+		i -= n.weight
+	}
+	return nodes[len(nodes)-1]
+}
+
+// pickByHash uses weighted rendezvous hashing, so only keys of a node going down are moved.
+func pickByHash(key string, nodes []*routerNode) *routerNode {
+	if key == "" {
+		return pickByWeight(nodes)
+	}
+	var ret *routerNode
+	best := math.Inf(-1)
+	for _, n := range nodes {
+		hasher := fnv.New64a()
+		_, _ = hasher.Write([]byte(key))
+		_, _ = hasher.Write([]byte(n.cfg.EngineURI))
+		x := (float64(hasher.Sum64()>>11) + 0.5) / float64(uint64(1)<<53) // (0, 1)
+		score := -float64(n.weight) / math.Log(x)
+		if score > best {
+			best, ret = score, n
+		}
+	}
+	return ret
+}
+
+func pickInMemApp(appid string, nodes []*routerNode) *routerNode {
+	found := make([]*routerNode, 0)
+	for _, n := range nodes {
+		if n.health == nil {
+			continue
+		}
+		for _, aid := range n.health.Apps.InMemoryDocs {
+			if aid == appid {
+				found = append(found, n)
+				break
+			}
+		}
+	}
+	if len(found) > 0 {
+		return pickLeastLoaded(found)
+	}
+	return pickLeastLoaded(nodes)
+}
+
+// pickLeastLoaded prefers nodes which are not saturated, then fewer active sessions per weight,
+// then more free memory per weight. Nodes without health info are picked only if no node has it.
+func pickLeastLoaded(nodes []*routerNode) *routerNode {
+	known := make([]*routerNode, 0, len(nodes))
+	for _, n := range nodes {
+		if n.health != nil {
+			known = append(known, n)
+		}
+	}
+	if len(known) == 0 {
+		return pickByWeight(nodes)
+	}
+	sort.SliceStable(known, func(i, j int) bool {
+		a, b := known[i], known[j]
+		if a.health.Saturated != b.health.Saturated {
+			return !a.health.Saturated
+		}
+		if a.load() != b.load() {
+			return a.load() < b.load()
+		}
+		return a.health.Mem.Free/float64(a.weight) > b.health.Mem.Free/float64(b.weight)
+	})
+	return known[0]
+}
@@ -0,0 +1,202 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/soderasen-au/go-common/loggers"
+	"github.com/soderasen-au/go-common/util"
+)
+
+type routerTestHealth struct {
+	mu   sync.Mutex
+	info map[string]*HealthInfo // engine uri => health, nil fails the poll
+}
+
+func (h *routerTestHealth) get(ctx context.Context, cfg Config) (*HealthInfo, *util.Result) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if info := h.info[cfg.EngineURI]; info != nil {
+		return info, nil
+	}
+	return nil, util.MsgError("healthcheck", "connection refused")
+}
+
+func newTestRouter(t *testing.T, method string, health map[string]*HealthInfo, nodes ...*Config) *ClusterRouter {
+	r, res := NewClusterRouter(&Cluster{Method: method, Nodes: nodes}, RouterConfig{FailureThreshold: 2, CooldownSec: 60})
+	if res != nil {
+		t.Fatalf("NewClusterRouter: %s", res.Error())
+	}
+	r.Health = (&routerTestHealth{info: health}).get
+	r.Logger = loggers.NullLogger
+	return r
+}
+
+func routerHealth(active int, free float64, saturated bool, apps ...string) *HealthInfo {
+	return &HealthInfo{
+		Mem:       MemHealthInfo{Free: free},
+		Session:   SessionHealthInfo{Active: active},
+		Apps:      AppsHealthInfo{InMemoryDocs: apps},
+		Saturated: saturated,
+	}
+}
+
+func TestClusterRouter_LeastLoaded(t *testing.T) {
+	n1 := &Config{EngineURI: "wss://n1/app"}
+	n2 := &Config{EngineURI: "wss://n2/app", Weight: 4}
+	n3 := &Config{EngineURI: "wss://n3/app"}
+	tests := []struct {
+		name   string
+		health map[string]*HealthInfo
+		want   *Config
+	}{
+		{"fewer sessions", map[string]*HealthInfo{n1.EngineURI: routerHealth(2, 100, false), n2.EngineURI: routerHealth(10, 100, false), n3.EngineURI: routerHealth(5, 100, false)}, n1},
+		{"weighted sessions", map[string]*HealthInfo{n1.EngineURI: routerHealth(3, 100, false), n2.EngineURI: routerHealth(8, 100, false), n3.EngineURI: routerHealth(5, 100, false)}, n2},
+		{"saturated", map[string]*HealthInfo{n1.EngineURI: routerHealth(0, 100, true), n2.EngineURI: routerHealth(40, 100, false), n3.EngineURI: routerHealth(20, 100, true)}, n2},
+		{"more free memory", map[string]*HealthInfo{n1.EngineURI: routerHealth(1, 100, false), n2.EngineURI: routerHealth(8, 100, false), n3.EngineURI: routerHealth(1, 900, false)}, n3},
+		{"skip failing node", map[string]*HealthInfo{n2.EngineURI: routerHealth(60, 100, false), n3.EngineURI: routerHealth(10, 100, false)}, n3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t, LeastLoadedMethod, tt.health, n1, n2, n3)
+			r.Refresh(context.Background())
+			if got := r.PickOneFor("app", "user"); got != tt.want {
+				t.Errorf("PickOneFor = %s, want %s", got.EngineURI, tt.want.EngineURI)
+			}
+		})
+	}
+}
+
+func TestClusterRouter_InMemApp(t *testing.T) {
+	n1 := &Config{EngineURI: "wss://n1/app"}
+	n2 := &Config{EngineURI: "wss://n2/app"}
+	r := newTestRouter(t, InMemAppMethod, map[string]*HealthInfo{
+		n1.EngineURI: routerHealth(1, 100, false),
+		n2.EngineURI: routerHealth(9, 100, false, "app-2"),
+	}, n1, n2)
+	r.Refresh(context.Background())
+	if got := r.PickOneFor("app-2", ""); got != n2 {
+		t.Errorf("app-2 should go to the node where it's in memory, got %s", got.EngineURI)
+	}
+	if got := r.PickOneFor("app-3", ""); got != n1 {
+		t.Errorf("app-3 should go to the least loaded node, got %s", got.EngineURI)
+	}
+}
+
+func TestClusterRouter_CircuitBreaker(t *testing.T) {
+	n1 := &Config{EngineURI: "wss://n1/app"}
+	n2 := &Config{EngineURI: "wss://n2/app"}
+	r := newTestRouter(t, LeastLoadedMethod, map[string]*HealthInfo{
+		n1.EngineURI: routerHealth(0, 100, false),
+		n2.EngineURI: routerHealth(5, 100, false),
+	}, n1, n2)
+	now := time.Now()
+	r.now = func() time.Time { return now }
+	r.Refresh(context.Background())
+
+	r.ReportFailure(n1, errors.New("dial timeout"))
+	if got := r.PickOneFor("app", ""); got != n1 {
+		t.Errorf("one failure should not mark the node down, got %s", got.EngineURI)
+	}
+	r.ReportFailure(n1, errors.New("dial timeout"))
+	if got := r.PickOneFor("app", ""); got != n2 {
+		t.Errorf("node n1 should be down, got %s", got.EngineURI)
+	}
+	table := r.RoutingTable()
+	if table[0].State != NODE_STATE_DOWN || table[0].Failures != 2 || table[0].LastError != "dial timeout" || table[0].DownUntil == nil {
+		t.Errorf("unexpected routing table %s", util.JsonStr(table[0]))
+	}
+
+	now = now.Add(61 * time.Second)
+	if state := r.RoutingTable()[0].State; state != NODE_STATE_HALF_OPEN {
+		t.Errorf("state after cooldown = %s", state)
+	}
+	if got := r.PickOneFor("app", ""); got != n1 {
+		t.Errorf("trial should go to n1, got %s", got.EngineURI)
+	}
+	if got := r.PickOneFor("app", ""); got != n2 {
+		t.Errorf("only one trial should go to n1 before it's reported, got %s", got.EngineURI)
+	}
+	r.ReportSuccess(n1)
+	if got := r.PickOneFor("app", ""); got != n1 {
+		t.Errorf("n1 should be up after the trial succeeded, got %s", got.EngineURI)
+	}
+}
+
+func TestClusterRouter_Hash(t *testing.T) {
+	nodes := []*Config{{EngineURI: "wss://n1/app"}, {EngineURI: "wss://n2/app"}, {EngineURI: "wss://n3/app"}}
+	health := make(map[string]*HealthInfo)
+	for _, n := range nodes {
+		health[n.EngineURI] = routerHealth(0, 100, false)
+	}
+	r := newTestRouter(t, HashAppMethod, health, nodes...)
+
+	apps := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l"}
+	picked := make(map[string]*Config)
+	for _, app := range apps {
+		picked[app] = r.PickOneFor(app, "")
+		if again := r.PickOneFor(app, ""); again != picked[app] {
+			t.Fatalf("hash_app is not stable for %s", app)
+		}
+	}
+
+	down := picked["a"]
+	for i := 0; i < r.Config.FailureThreshold; i++ {
+		r.ReportFailure(down, errors.New("refused"))
+	}
+	for _, app := range apps {
+		got := r.PickOneFor(app, "")
+		if got == down {
+			t.Errorf("%s is routed to a down node", app)
+		}
+		if picked[app] != down && got != picked[app] {
+			t.Errorf("%s moved from %s to %s", app, picked[app].EngineURI, got.EngineURI)
+		}
+	}
+}
+
+func TestClusterRouter_Weighted(t *testing.T) {
+	n1 := &Config{EngineURI: "wss://n1/app", Weight: 3}
+	n2 := &Config{EngineURI: "wss://n2/app"}
+	r := newTestRouter(t, RandomMethod, nil, n1, n2)
+	count := 0
+	for i := 0; i < 4000; i++ {
+		if r.PickOneFor("", "") == n1 {
+			count++
+		}
+	}
+	if count < 2700 || count > 3300 {
+		t.Errorf("n1 picked %d times of 4000, want about 3000", count)
+	}
+}
+
+func TestNewClusterRouter(t *testing.T) {
+	if _, res := NewClusterRouter(&Cluster{}, RouterConfig{}); res == nil {
+		t.Error("empty cluster should fail")
+	}
+	r, res := NewClusterRouter(&Cluster{Nodes: []*Config{{EngineURI: "wss://n1/app"}}}, RouterConfig{})
+	if res != nil {
+		t.Fatalf("NewClusterRouter: %s", res.Error())
+	}
+	if r.Config != *DefaultRouterConfig() {
+		t.Errorf("unexpected defaults %+v", r.Config)
+	}
+	r.Health = (&routerTestHealth{}).get
+	r.Logger = loggers.NullLogger
+	r.Start()
+	r.Close()
+	r.Close()
+}
+
+func TestNewConnFromCluster_LeastLoaded(t *testing.T) {
+	c := &Cluster{Method: LeastLoadedMethod, Nodes: []*Config{{EngineURI: "wss://n1/app"}, {EngineURI: "wss://n2/app"}}}
+	if _, res := NewConnFromClusterContext(context.Background(), c, "app"); res == nil {
+		t.Error("least_loaded without a router should fail")
+	}
+	if _, res := NewConnFromClusterContext(context.Background(), &Cluster{}, "app"); res == nil {
+		t.Error("empty cluster should fail")
+	}
+}
@@ -0,0 +1,368 @@
+package engine
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/soderasen-au/go-common/util"
+)
+
+const (
+	SCRIPT_TAB_PREFIX    = "///$tab "
+	SCRIPT_OVERRIDES_TAB = "Overrides" // section of variables added by Script.SetVariable
+
+	// modes of DoReloadEx
+	RELOAD_MODE_DEFAULT = 0
+	RELOAD_MODE_ABEND   = 1
+	RELOAD_MODE_IGNORE  = 2
+
+	DEFAULT_RELOAD_POLL_INTERVAL = time.Second
+)
+
+// ScriptSection is a tab of the load script, `Name` is empty for text before the first tab.
+type ScriptSection struct {
+	Name string `json:"name" yaml:"name"`
+	Body string `json:"body" yaml:"body"`
+}
+
+// Script is a load script split into sections, String() joins it back.
+type Script struct {
+	Sections []*ScriptSection `json:"sections" yaml:"sections"`
+	Newline  string           `json:"newline" yaml:"newline"`
+}
+
+// ParseScript splits script by `///$tab` lines.
+func ParseScript(script string) *Script {
+	s := &Script{Sections: make([]*ScriptSection, 0), Newline: "\n"}
+	if strings.Contains(script, "\r\n") {
+		s.Newline = "\r\n"
+	}
+	var cur *ScriptSection
+	for _, line := range strings.SplitAfter(script, "\n") {
+		if line == "" {
+			continue
+		}
+		if name, ok := strings.CutPrefix(strings.TrimRight(line, "\r\n"), SCRIPT_TAB_PREFIX); ok {
+			cur = &ScriptSection{Name: strings.TrimSpace(name)}
+			s.Sections = append(s.Sections, cur)
+			continue
+		}
+		if cur == nil {
+			cur = &ScriptSection{}
+			s.Sections = append(s.Sections, cur)
+		}
+		cur.Body += line
+	}
+	return s
+}
+
+func (s *Script) String() string {
+	var sb strings.Builder
+	for i, sec := range s.Sections {
+		if i > 0 || sec.Name != "" {
+			sb.WriteString(SCRIPT_TAB_PREFIX + sec.Name + s.Newline)
+		}
+		sb.WriteString(sec.Body)
+		if i < len(s.Sections)-1 && sec.Body != "" && !strings.HasSuffix(sec.Body, "\n") {
+			sb.WriteString(s.Newline)
+		}
+	}
+	return sb.String()
+}
+
+// Section returns the first section named name, or nil.
+func (s *Script) Section(name string) *ScriptSection {
+	for _, sec := range s.Sections {
+		if sec.Name == name {
+			return sec
+		}
+	}
+	return nil
+}
+
+// SetSection replaces body of section name, or appends it if there's none.
+func (s *Script) SetSection(name, body string) {
+	if sec := s.Section(name); sec != nil {
+		sec.Body = body
+		return
+	}
+	s.Sections = append(s.Sections, &ScriptSection{Name: name, Body: body})
+}
+
+// InsertSection inserts a section before index i.
+func (s *Script) InsertSection(i int, name, body string) {
+	i = max(0, min(i, len(s.Sections)))
+	s.Sections = append(s.Sections[:i], append([]*ScriptSection{{Name: name, Body: body}}, s.Sections[i:]...)...)
+}
+
+func (s *Script) RemoveSection(name string) bool {
+	for i, sec := range s.Sections {
+		if sec.Name == name {
+			s.Sections = append(s.Sections[:i], s.Sections[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// SetVariable replaces values of `SET|LET name = ...;` statements with value, which is script text.
+// If the script has no such statement, `SET name = value;` is added to section SCRIPT_OVERRIDES_TAB
+// at the beginning of the script. It returns the number of replaced statements.
+func (s *Script) SetVariable(name, value string) int {
+	re := regexp.MustCompile(`(?im)^([ \t]*)(SET|LET)([ \t]+)` + regexp.QuoteMeta(name) + `([ \t]*=[ \t]*)[^;]*;`)
+	count := 0
+	for _, sec := range s.Sections {
+		sec.Body = re.ReplaceAllStringFunc(sec.Body, func(m string) string {
+			count++
+			g := re.FindStringSubmatch(m)
+			return g[1] + g[2] + g[3] + name + g[4] + value + ";"
+		})
+	}
+	if count > 0 {
+		return count
+	}
+
+	stmt := "SET " + name + " = " + value + ";" + s.Newline
+	if sec := s.Section(SCRIPT_OVERRIDES_TAB); sec != nil {
+		sec.Body += stmt
+		return 0
+	}
+	i := 0
+	if len(s.Sections) > 0 && s.Sections[0].Name == "" {
+		i = 1
+	}
+	s.InsertSection(i, SCRIPT_OVERRIDES_TAB, stmt)
+	return 0
+}
+
+// ReplaceConnection replaces data connection from with to in `LIB CONNECT TO` statements
+// and `lib://` paths, it returns the number of replacements.
+func (s *Script) ReplaceConnection(from, to string) int {
+	q := regexp.QuoteMeta(from)
+	patterns := []*regexp.Regexp{
+		regexp.MustCompile(`(?i)(LIB[ \t]+CONNECT[ \t]+TO[ \t]*['"\[])` + q + `(['"\]])`),
+		regexp.MustCompile(`(?i)(lib://)` + q + `([/'"\]])`),
+	}
+	count := 0
+	for _, sec := range s.Sections {
+		for _, re := range patterns {
+			count += len(re.FindAllStringIndex(sec.Body, -1))
+			sec.Body = re.ReplaceAllString(sec.Body, "${1}"+strings.ReplaceAll(to, "$", "$$")+"${2}")
+		}
+	}
+	return count
+}
+
+// ScriptError is a syntax error found by CheckScript or an error of a reload.
+type ScriptError struct {
+	Code       string `json:"code,omitempty" yaml:"code,omitempty"` // EDC_ERROR, EDC_WARNING, ... or reload error type
+	Message    string `json:"message,omitempty" yaml:"message,omitempty"`
+	Statement  string `json:"statement,omitempty" yaml:"statement,omitempty"`
+	LineNumber int    `json:"line_number,omitempty" yaml:"line_number,omitempty"`
+	Section    string `json:"section,omitempty" yaml:"section,omitempty"`
+	Column     int    `json:"column,omitempty" yaml:"column,omitempty"`
+}
+
+func GetScript(doc *enigma.Doc) (*Script, *util.Result) {
+	return GetScriptContext(ConnCtx, doc)
+}
+
+func GetScriptContext(ctx context.Context, doc *enigma.Doc) (*Script, *util.Result) {
+	script, err := doc.GetScript(ctx)
+	if err != nil {
+		return nil, util.Error("GetScript", err)
+	}
+	return ParseScript(script), nil
+}
+
+func SetScript(doc *enigma.Doc, s *Script) *util.Result {
+	return SetScriptContext(ConnCtx, doc, s)
+}
+
+func SetScriptContext(ctx context.Context, doc *enigma.Doc, s *Script) *util.Result {
+	if err := doc.SetScript(ctx, s.String()); err != nil {
+		return util.Error("SetScript", err)
+	}
+	return nil
+}
+
+// CheckScript returns syntax errors of the script of doc, `LineNumber` is the line in `Section`.
+func CheckScript(doc *enigma.Doc) ([]*ScriptError, *util.Result) {
+	return CheckScriptContext(ConnCtx, doc)
+}
+
+func CheckScriptContext(ctx context.Context, doc *enigma.Doc) ([]*ScriptError, *util.Result) {
+	s, res := GetScriptContext(ctx, doc)
+	if res != nil {
+		return nil, res
+	}
+	syntaxErrors, err := doc.CheckScriptSyntax(ctx)
+	if err != nil {
+		return nil, util.Error("CheckScriptSyntax", err)
+	}
+	ret := make([]*ScriptError, 0, len(syntaxErrors))
+	for _, e := range syntaxErrors {
+		se := &ScriptError{Code: "EDC_ERROR", Message: "syntax error", LineNumber: e.LineInTab + 1, Column: e.ColInLine + 1}
+		if e.TabIx >= 0 && e.TabIx < len(s.Sections) {
+			sec := s.Sections[e.TabIx]
+			se.Section = sec.Name
+			if lines := strings.Split(sec.Body, "\n"); e.LineInTab < len(lines) {
+				se.Statement = strings.TrimRight(lines[e.LineInTab], "\r")
+			}
+		}
+		if e.SecondaryFailure {
+			se.Code = "EDC_WARNING"
+		}
+		ret = append(ret, se)
+	}
+	return ret, nil
+}
+
+type ReloadOptions struct {
+	Mode         int                                 `json:"mode" yaml:"mode"` // RELOAD_MODE_*
+	Partial      bool                                `json:"partial" yaml:"partial"`
+	Debug        bool                                `json:"debug" yaml:"debug"`
+	PollInterval time.Duration                       `json:"poll_interval" yaml:"poll_interval"`
+	Save         bool                                `json:"save" yaml:"save"` // save the app after a successful reload
+	OnProgress   func(progress *enigma.ProgressData) `json:"-" yaml:"-"`
+}
+
+func DefaultReloadOptions() *ReloadOptions {
+	return &ReloadOptions{
+		Mode:         RELOAD_MODE_DEFAULT,
+		PollInterval: DEFAULT_RELOAD_POLL_INTERVAL,
+		Save:         true,
+	}
+}
+
+type ReloadResult struct {
+	Success    bool           `json:"success" yaml:"success"`
+	LogFile    string         `json:"log_file,omitempty" yaml:"log_file,omitempty"`
+	Log        []string       `json:"log" yaml:"log"` // persistent progress messages
+	Errors     []*ScriptError `json:"errors,omitempty" yaml:"errors,omitempty"`
+	StartedAt  time.Time      `json:"started_at" yaml:"started_at"`
+	FinishedAt time.Time      `json:"finished_at" yaml:"finished_at"`
+	Canceled   bool           `json:"canceled,omitempty" yaml:"canceled,omitempty"`
+
+	EndedWithMemoryConstraint bool `json:"ended_with_memory_constraint,omitempty" yaml:"ended_with_memory_constraint,omitempty"`
+}
+
+func (r *ReloadResult) addProgress(p *enigma.ProgressData) {
+	for _, line := range strings.Split(p.PersistentProgress, "\n") {
+		if line = strings.TrimRight(line, "\r"); strings.TrimSpace(line) != "" {
+			r.Log = append(r.Log, line)
+		}
+	}
+	for _, e := range p.ErrorData {
+		if e != nil {
+			r.Errors = append(r.Errors, &ScriptError{Code: e.ErrorDataCode, Message: e.ErrorString, Statement: e.Line})
+		}
+	}
+}
+
+// ReloadDoc reloads doc with DoReloadEx, polling GetProgress of global every PollInterval
+// to collect the reload log and script errors. The reload is canceled when ctx is done.
+// A failed reload isn't an error, see `ReloadResult.Success`.
+func ReloadDoc(global *enigma.Global, doc *enigma.Doc, opts *ReloadOptions) (*ReloadResult, *util.Result) {
+	return ReloadDocContext(ConnCtx, global, doc, opts)
+}
+
+func ReloadDocContext(ctx context.Context, global *enigma.Global, doc *enigma.Doc, opts *ReloadOptions) (*ReloadResult, *util.Result) {
+	if opts == nil {
+		opts = DefaultReloadOptions()
+	}
+	interval := opts.PollInterval
+	if interval <= 0 {
+		interval = DEFAULT_RELOAD_POLL_INTERVAL
+	}
+
+	ret := &ReloadResult{Log: make([]string, 0), StartedAt: time.Now()}
+	reloadCtx, requestId := doc.WithReservedRequestID(context.WithoutCancel(ctx))
+	done := make(chan struct{})
+	var reload *enigma.DoReloadExResult
+	var reloadErr error
+	go func() {
+		defer close(done)
+		reload, reloadErr = doc.DoReloadEx(reloadCtx, &enigma.DoReloadExParams{Mode: opts.Mode, Partial: opts.Partial, Debug: opts.Debug})
+	}()
+
+	poll := func() {
+		p, err := global.GetProgress(context.WithoutCancel(ctx), requestId)
+		if err != nil || p == nil {
+			return
+		}
+		ret.addProgress(p)
+		if opts.OnProgress != nil {
+			opts.OnProgress(p)
+		}
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+wait:
+	for {
+		select {
+		case <-done:
+			break wait
+		case <-ticker.C:
+			poll()
+		case <-ctx.Done():
+			ret.Canceled = true
+			if err := global.CancelReload(context.WithoutCancel(ctx), "canceled"); err != nil {
+				return nil, util.Error("CancelReload", err)
+			}
+			<-done
+			break wait
+		}
+	}
+	poll()
+	ret.FinishedAt = time.Now()
+
+	if reloadErr != nil {
+		return nil, util.Error("DoReloadEx", reloadErr)
+	}
+	if reload != nil {
+		ret.Success = reload.Success && !ret.Canceled
+		ret.LogFile = reload.ScriptLogFile
+		ret.EndedWithMemoryConstraint = reload.EndedWithMemoryConstraint
+		if len(ret.Errors) == 0 && reload.FailureData != nil {
+			for _, e := range reload.FailureData.Errors {
+				ret.Errors = append(ret.Errors, &ScriptError{Code: e.Error, Message: e.Description, Statement: e.Line, LineNumber: e.LineNumber})
+			}
+		}
+	}
+	if ret.Success && opts.Save {
+		if err := doc.DoSave(ctx, ""); err != nil {
+			return ret, util.Error("DoSave", err)
+		}
+	}
+	return ret, nil
+}
+
+// Reload opens app appId, edits its script with edit if it's not nil and reloads it.
+// It works in desktop mode where there are no reload tasks.
+func (c *Conn) Reload(appId string, edit func(s *Script) *util.Result, opts *ReloadOptions) (*ReloadResult, *util.Result) {
+	return c.ReloadContext(ConnCtx, appId, edit, opts)
+}
+
+func (c *Conn) ReloadContext(ctx context.Context, appId string, edit func(s *Script) *util.Result, opts *ReloadOptions) (*ReloadResult, *util.Result) {
+	doc, err := c.Global.OpenDoc(ctx, appId, "", "", "", false)
+	if err != nil {
+		return nil, util.Error("OpenDoc", err)
+	}
+	if edit != nil {
+		s, res := GetScriptContext(ctx, doc)
+		if res != nil {
+			return nil, res
+		}
+		if res := edit(s); res != nil {
+			return nil, res.With("EditScript")
+		}
+		if res := SetScriptContext(ctx, doc, s); res != nil {
+			return nil, res
+		}
+	}
+	return ReloadDocContext(ctx, c.Global, doc, opts)
+}
@@ -0,0 +1,134 @@
+package engine_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/soderasen-au/go-common/util"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+	"github.com/soderasen-au/go-qlik/qlik/engine/enginetest"
+)
+
+func TestParseScript(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		sections []string
+	}{
+		{"empty", "", []string{}},
+		{"no tabs", "SET a=1;\nLOAD 1 AUTOGENERATE 1;\n", []string{""}},
+		{"tabs", "///$tab Main\r\nSET a=1;\r\n///$tab Data\r\nLOAD 1 AUTOGENERATE 1;", []string{"Main", "Data"}},
+		{"preamble", "// header\n///$tab Main\nSET a=1;\n", []string{"", "Main"}},
+		{"empty tab", "///$tab Main\n///$tab Data\nLOAD 1 AUTOGENERATE 1;\n", []string{"Main", "Data"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := engine.ParseScript(tt.script)
+			names := make([]string, len(s.Sections))
+			for i, sec := range s.Sections {
+				names[i] = sec.Name
+			}
+			if strings.Join(names, ",") != strings.Join(tt.sections, ",") || len(names) != len(tt.sections) {
+				t.Errorf("sections = %v, want %v", names, tt.sections)
+			}
+			if got := s.String(); got != tt.script {
+				t.Errorf("String() = %q, want %q", got, tt.script)
+			}
+		})
+	}
+}
+
+func TestScript_Edit(t *testing.T) {
+	script := "///$tab Main\r\nSET vEnv = 'dev';\r\n  LET vYear=Year(Today());\r\n///$tab Data\r\n" +
+		"LIB CONNECT TO 'DevDB';\r\nLOAD * FROM [lib://DevFiles/sales.qvd] (qvd);\r\nLOAD * FROM [lib://DevFilesOld/x.qvd] (qvd);\r\n"
+
+	s := engine.ParseScript(script)
+	if n := s.SetVariable("vEnv", "prod"); n != 1 {
+		t.Errorf("SetVariable(vEnv) = %d", n)
+	}
+	if n := s.SetVariable("vYear", "2024"); n != 1 {
+		t.Errorf("SetVariable(vYear) = %d", n)
+	}
+	if n := s.SetVariable("vNew", "1"); n != 0 {
+		t.Errorf("SetVariable(vNew) = %d", n)
+	}
+	if n := s.SetVariable("vNew2", "2"); n != 0 {
+		t.Errorf("SetVariable(vNew2) = %d", n)
+	}
+	if n := s.ReplaceConnection("DevDB", "ProdDB"); n != 1 {
+		t.Errorf("ReplaceConnection(DevDB) = %d", n)
+	}
+	if n := s.ReplaceConnection("DevFiles", "Prod$Files"); n != 1 {
+		t.Errorf("ReplaceConnection(DevFiles) = %d", n)
+	}
+	s.SetSection("Exit", "EXIT SCRIPT;")
+
+	want := "///$tab Overrides\r\nSET vNew = 1;\r\nSET vNew2 = 2;\r\n///$tab Main\r\nSET vEnv = prod;\r\n  LET vYear=2024;\r\n///$tab Data\r\n" +
+		"LIB CONNECT TO 'ProdDB';\r\nLOAD * FROM [lib://Prod$Files/sales.qvd] (qvd);\r\nLOAD * FROM [lib://DevFilesOld/x.qvd] (qvd);\r\n" +
+		"///$tab Exit\r\nEXIT SCRIPT;"
+	if got := s.String(); got != want {
+		t.Errorf("String() = %q\nwant %q", got, want)
+	}
+	if !s.RemoveSection("Overrides") || s.Section("Overrides") != nil || s.RemoveSection("Overrides") {
+		t.Errorf("RemoveSection(Overrides) failed")
+	}
+}
+
+func TestFake_Reload(t *testing.T) {
+	srv := enginetest.NewServer(enginetest.SalesFixture())
+	t.Cleanup(srv.Close)
+	conn, err := engine.NewConn(engine.Config{EngineURI: srv.URL, AuthMode: engine.AUTH_MODE_DESKTOP, ServerType: engine.ST_ON_PREM})
+	if err != nil {
+		t.Fatalf("NewConn: %v", err)
+	}
+	t.Cleanup(func() { conn.Global.DisconnectFromServer() })
+
+	opts := engine.DefaultReloadOptions()
+	opts.PollInterval = 10 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ret, res := conn.ReloadContext(ctx, "sales", func(s *engine.Script) *util.Result {
+		if s.Section("Sales") == nil {
+			return util.MsgError("Edit", "no Sales section")
+		}
+		s.SetVariable("ThousandSep", "' '")
+		s.SetSection("Check", "FAIL Unknown;\n")
+		return nil
+	}, opts)
+	if res != nil {
+		t.Fatalf("Reload: %v", res)
+	}
+	if ret.Success || len(ret.Errors) != 1 || ret.Errors[0].Statement != "FAIL Unknown;" || len(ret.Log) == 0 || ret.LogFile == "" {
+		t.Errorf("Reload() = %s", util.JsonStr(ret))
+	}
+
+	doc, err := conn.Global.GetActiveDoc(ctx)
+	if err != nil {
+		t.Fatalf("GetActiveDoc: %v", err)
+	}
+	s, res := engine.GetScriptContext(ctx, doc)
+	if res != nil {
+		t.Fatalf("GetScript: %v", res)
+	}
+	if !strings.Contains(s.Section("Main").Body, "SET ThousandSep=' ';") {
+		t.Errorf("script = %q", s.String())
+	}
+	s.RemoveSection("Check")
+	if res := engine.SetScriptContext(ctx, doc, s); res != nil {
+		t.Fatalf("SetScript: %v", res)
+	}
+	if errs, res := engine.CheckScriptContext(ctx, doc); res != nil || len(errs) != 0 {
+		t.Errorf("CheckScript() = %s, %v", util.JsonStr(errs), res)
+	}
+	ret, res = engine.ReloadDocContext(ctx, conn.Global, doc, opts)
+	if res != nil || !ret.Success || len(ret.Errors) != 0 {
+		t.Errorf("ReloadDoc() = %s, %v", util.JsonStr(ret), res)
+	}
+	methods := strings.Join(srv.Methods(), ",")
+	if strings.Count(methods, "DoReloadEx") != 2 || !strings.HasSuffix(methods, "GetProgress,DoSave") {
+		t.Errorf("methods = %s", methods)
+	}
+}
@@ -0,0 +1,215 @@
+package engine
+
+import (
+	"context"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/soderasen-au/go-common/util"
+)
+
+const (
+	DEFAULT_STATE_NAME = "$"
+)
+
+// SelectedValue is a selected value of a field, ElemNumber is only valid in the app it was captured from.
+type SelectedValue struct {
+	Text       string   `json:"text" yaml:"text"`
+	Num        *float64 `json:"num,omitempty" yaml:"num,omitempty"`
+	ElemNumber int      `json:"elem_number" yaml:"elem_number"`
+}
+
+type FieldSelection struct {
+	Field  string           `json:"field" yaml:"field"`
+	Locked bool             `json:"locked,omitempty" yaml:"locked,omitempty"`
+	Values []*SelectedValue `json:"values" yaml:"values"`
+}
+
+// StateSelections are the selections of a state in selection order.
+type StateSelections struct {
+	Name   string            `json:"name" yaml:"name"`
+	Fields []*FieldSelection `json:"fields" yaml:"fields"`
+}
+
+// SelectionState is the selections of the default state and all alternate states of an app.
+type SelectionState struct {
+	AppId      string             `json:"app_id" yaml:"app_id"`
+	CapturedAt time.Time          `json:"captured_at" yaml:"captured_at"`
+	States     []*StateSelections `json:"states" yaml:"states"`
+}
+
+// State returns selections of state name, or nil.
+func (s *SelectionState) State(name string) *StateSelections {
+	if name == "" {
+		name = DEFAULT_STATE_NAME
+	}
+	for _, st := range s.States {
+		if st.Name == name {
+			return st
+		}
+	}
+	return nil
+}
+
+func CaptureSelections(doc *enigma.Doc) (*SelectionState, *util.Result) {
+	return CaptureSelectionsContext(ConnCtx, doc)
+}
+
+// CaptureSelectionsContext captures all selected values of all states, including values of
+// selections too large to be listed by the selection object and selected values excluded by
+// selections of other fields.
+func CaptureSelectionsContext(ctx context.Context, doc *enigma.Doc) (*SelectionState, *util.Result) {
+	layout, err := doc.GetAppLayout(ctx)
+	if err != nil {
+		return nil, util.Error("GetAppLayout", err)
+	}
+	ret := &SelectionState{AppId: doc.GenericId, CapturedAt: time.Now(), States: make([]*StateSelections, 0)}
+	for _, name := range append([]string{DEFAULT_STATE_NAME}, layout.StateNames...) {
+		selObj, res := GetCurrentSelectionContext(ctx, doc, name)
+		if res != nil {
+			return nil, res.With("GetCurrentSelection " + name)
+		}
+		st := &StateSelections{Name: name, Fields: make([]*FieldSelection, 0)}
+		for _, sel := range selObj.Selections {
+			fs := &FieldSelection{Field: sel.Field, Locked: sel.Locked, Values: make([]*SelectedValue, 0, sel.SelectedCount)}
+			cells, res := GetFieldValuesContext(ctx, doc, name, sel.Field)
+			if res != nil {
+				return nil, res.With("GetFieldValues " + sel.Field)
+			}
+			for _, c := range cells {
+				switch c.State {
+				case "S", "L", "XS", "XL":
+				default:
+					continue
+				}
+				v := &SelectedValue{Text: c.Text, ElemNumber: c.ElemNumber}
+				if n := float64(c.Num); !math.IsNaN(n) {
+					v.Num = &n
+				}
+				fs.Values = append(fs.Values, v)
+			}
+			st.Fields = append(st.Fields, fs)
+		}
+		ret.States = append(ret.States, st)
+	}
+	return ret, nil
+}
+
+func ApplySelections(doc *enigma.Doc, state *SelectionState) *util.Result {
+	return ApplySelectionsContext(ConnCtx, doc, state)
+}
+
+// ApplySelectionsContext clears all selections, including locked ones, of states in state and re-applies them,
+// missing alternate states are added. Values are selected by element numbers in the app they were captured from
+// if the numbers still have the captured texts, which isn't true after a reload changed the field,
+// otherwise by numbers of numeric values and texts of others.
+func ApplySelectionsContext(ctx context.Context, doc *enigma.Doc, state *SelectionState) *util.Result {
+	layout, err := doc.GetAppLayout(ctx)
+	if err != nil {
+		return util.Error("GetAppLayout", err)
+	}
+	sameApp := state.AppId != "" && state.AppId == doc.GenericId
+	for _, st := range state.States {
+		if st.Name != DEFAULT_STATE_NAME && !slices.Contains(layout.StateNames, st.Name) {
+			if err := doc.AddAlternateState(ctx, st.Name); err != nil {
+				return util.Error("AddAlternateState "+st.Name, err)
+			}
+		}
+		if err := doc.ClearAll(ctx, true, st.Name); err != nil {
+			return util.Error("ClearAll "+st.Name, err)
+		}
+		for _, fs := range st.Fields {
+			if res := selectField(ctx, doc, st.Name, fs, sameApp); res != nil {
+				return res.With("Select " + fs.Field)
+			}
+		}
+		for _, fs := range st.Fields {
+			if !fs.Locked {
+				continue
+			}
+			field, err := doc.GetField(ctx, fs.Field, st.Name)
+			if err != nil {
+				return util.Error("GetField "+fs.Field, err)
+			}
+			if _, err := field.Lock(ctx); err != nil {
+				return util.Error("Lock "+fs.Field, err)
+			}
+		}
+	}
+	return nil
+}
+
+func selectField(ctx context.Context, doc *enigma.Doc, stateName string, fs *FieldSelection, byElemNumber bool) *util.Result {
+	if len(fs.Values) == 0 {
+		return nil
+	}
+	if byElemNumber {
+		cells, res := GetFieldValuesContext(ctx, doc, stateName, fs.Field)
+		if res != nil {
+			return res.With("GetFieldValues")
+		}
+		byElemNumber = sameElemTexts(fs.Values, cells)
+	}
+	if byElemNumber {
+		elems := make([]int, len(fs.Values))
+		for i, v := range fs.Values {
+			elems[i] = v.ElemNumber
+		}
+		obj, err := doc.CreateSessionObject(ctx, &enigma.GenericObjectProperties{
+			Info: &enigma.NxInfo{Type: "ListObject"},
+			ListObjectDef: &enigma.ListObjectDef{
+				StateName: stateName,
+				Def:       &enigma.NxInlineDimensionDef{FieldDefs: []string{fs.Field}},
+			},
+		})
+		if err != nil {
+			return util.Error("CreateSessionObject", err)
+		}
+		defer doc.DestroySessionObject(context.WithoutCancel(ctx), obj.GenericId)
+		ok, err := obj.SelectListObjectValues(ctx, "/qListObjectDef", elems, false, false)
+		if err != nil {
+			return util.Error("SelectListObjectValues", err)
+		}
+		if !ok {
+			return util.MsgError("SelectListObjectValues", "engine returned `Fail`")
+		}
+		return nil
+	}
+
+	values := make([]*enigma.FieldValue, len(fs.Values))
+	for i, v := range fs.Values {
+		values[i] = &enigma.FieldValue{Text: v.Text}
+		if v.Num != nil {
+			values[i].IsNumeric = true
+			values[i].Number = enigma.Float64(*v.Num)
+		}
+	}
+	field, err := doc.GetField(ctx, fs.Field, stateName)
+	if err != nil {
+		return util.Error("GetField", err)
+	}
+	ok, err := field.SelectValues(ctx, values, false, false)
+	if err != nil {
+		return util.Error("SelectValues", err)
+	}
+	if !ok {
+		return util.MsgError("SelectValues", "engine returned `Fail`")
+	}
+	return nil
+}
+
+// sameElemTexts tells if element numbers of all values have the texts of values in cells.
+func sameElemTexts(values []*SelectedValue, cells []*enigma.NxCell) bool {
+	texts := make(map[int]string, len(cells))
+	for _, c := range cells {
+		texts[c.ElemNumber] = c.Text
+	}
+	for _, v := range values {
+		if t, ok := texts[v.ElemNumber]; !ok || t != v.Text {
+			return false
+		}
+	}
+	return true
+}
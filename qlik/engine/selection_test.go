@@ -0,0 +1,125 @@
+package engine_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/soderasen-au/go-common/util"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+	"github.com/soderasen-au/go-qlik/qlik/engine/enginetest"
+)
+
+// selectionsString lists selections of all states like `$:Region=East|West,Year=2024(locked)`.
+func selectionsString(s *engine.SelectionState) string {
+	states := make([]string, 0, len(s.States))
+	for _, st := range s.States {
+		fields := make([]string, 0, len(st.Fields))
+		for _, fs := range st.Fields {
+			values := make([]string, 0, len(fs.Values))
+			for _, v := range fs.Values {
+				values = append(values, v.Text)
+			}
+			f := fs.Field + "=" + strings.Join(values, "|")
+			if fs.Locked {
+				f += "(locked)"
+			}
+			fields = append(fields, f)
+		}
+		states = append(states, st.Name+":"+strings.Join(fields, ","))
+	}
+	return strings.Join(states, " ")
+}
+
+func TestFake_Selections(t *testing.T) {
+	srv, doc := enginetest.OpenDoc(t, enginetest.SalesFixture())
+	ctx := engine.ConnCtx
+	selects := []struct {
+		state  string
+		field  string
+		values []*enigma.FieldValue
+	}{
+		{"", "Region", []*enigma.FieldValue{{Text: "East"}, {Text: "West"}}},
+		{"", "Year", []*enigma.FieldValue{{IsNumeric: true, Number: 2024}}},
+		{"Compare", "Product", []*enigma.FieldValue{{Text: "Bikes"}}},
+	}
+	for _, s := range selects {
+		field, err := doc.GetField(ctx, s.field, s.state)
+		if err != nil {
+			t.Fatalf("GetField(%s): %v", s.field, err)
+		}
+		if ok, err := field.SelectValues(ctx, s.values, false, false); err != nil || !ok {
+			t.Fatalf("SelectValues(%s): %v, %v", s.field, ok, err)
+		}
+		if s.field == "Year" {
+			if _, err := field.Lock(ctx); err != nil {
+				t.Fatalf("Lock: %v", err)
+			}
+		}
+	}
+
+	// Region and Year are related, East has no sales in 2024, so it's selected but excluded
+	cells, res := engine.GetFieldValues(doc, "", "Region")
+	if res != nil {
+		t.Fatalf("GetFieldValues: %v", res)
+	}
+	if len(cells) != 3 || cells[0].Text != "East" || cells[0].State != "XS" {
+		t.Fatalf("Region = %s", util.JsonStr(cells))
+	}
+
+	want := "$:Region=East|West,Year=2024(locked) Compare:Product=Bikes"
+	captured, res := engine.CaptureSelections(doc)
+	if res != nil {
+		t.Fatalf("CaptureSelections: %v", res)
+	}
+	if got := selectionsString(captured); got != want {
+		t.Errorf("CaptureSelections() = %s, want %s", got, want)
+	}
+	if year := captured.State("").Fields[1].Values[0]; year.Num == nil || *year.Num != 2024 {
+		t.Errorf("Year = %s", util.JsonStr(year))
+	}
+
+	buf, err := json.Marshal(captured)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var state engine.SelectionState
+	if err := json.Unmarshal(buf, &state); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	// same app, values are selected by element numbers
+	if err := doc.ClearAll(ctx, true, ""); err != nil {
+		t.Fatalf("ClearAll: %v", err)
+	}
+	if res := engine.ApplySelections(doc, &state); res != nil {
+		t.Fatalf("ApplySelections: %v", res)
+	}
+	if got, res := engine.CaptureSelections(doc); res != nil || selectionsString(got) != want {
+		t.Errorf("re-captured = %s, %v, want %s", selectionsString(got), res, want)
+	}
+
+	// element numbers changed by a reload, values are selected by texts
+	moved := state
+	moved.States = []*engine.StateSelections{{Name: engine.DEFAULT_STATE_NAME, Fields: []*engine.FieldSelection{
+		{Field: "Region", Values: []*engine.SelectedValue{{Text: "East", ElemNumber: 1}, {Text: "West", ElemNumber: 0}}},
+	}}}
+	if res := engine.ApplySelections(doc, &moved); res != nil {
+		t.Fatalf("ApplySelections(moved): %v", res)
+	}
+	if got, res := engine.CaptureSelections(doc); res != nil || !strings.HasPrefix(selectionsString(got), "$:Region=East|West ") {
+		t.Errorf("re-captured moved = %s, %v", selectionsString(got), res)
+	}
+
+	// another session of an app copy, values are selected by texts and numbers
+	other := enginetest.ConnectDoc(t, *srv.Config("sales").OnPrem)
+	state.AppId = "sales-copy"
+	if res := engine.ApplySelections(other, &state); res != nil {
+		t.Fatalf("ApplySelections(other): %v", res)
+	}
+	if got, res := engine.CaptureSelections(other); res != nil || selectionsString(got) != want {
+		t.Errorf("captured in other session = %s, %v, want %s", selectionsString(got), res, want)
+	}
+}
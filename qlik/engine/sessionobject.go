@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"context"
 	"encoding/json"
 
 	"github.com/qlik-oss/enigma-go/v4"
@@ -75,6 +76,10 @@ type (
 )
 
 func GetDimensionList(doc *enigma.Doc) ([]*SessionDimensionLayout, *util.Result) {
+	return GetDimensionListContext(ConnCtx, doc)
+}
+
+func GetDimensionListContext(ctx context.Context, doc *enigma.Doc) ([]*SessionDimensionLayout, *util.Result) {
 	prop := enigma.GenericObjectProperties{
 		Info: &enigma.NxInfo{Type: "DimensionList"},
 		DimensionListDef: &enigma.DimensionListDef{
@@ -82,11 +87,11 @@ func GetDimensionList(doc *enigma.Doc) ([]*SessionDimensionLayout, *util.Result)
 			Data: SessionDimListDefData,
 		},
 	}
-	obj, err := doc.CreateSessionObject(ConnCtx, &prop)
+	obj, err := doc.CreateSessionObject(ctx, &prop)
 	if err != nil {
 		return nil, util.Error("CreateSessionObject", err)
 	}
-	layoutBuf, err := obj.GetLayoutRaw(ConnCtx)
+	layoutBuf, err := obj.GetLayoutRaw(ctx)
 	if err != nil {
 		return nil, util.Error("GetLayoutRaw", err)
 	}
@@ -118,6 +123,10 @@ func GetDimensionList(doc *enigma.Doc) ([]*SessionDimensionLayout, *util.Result)
 }
 
 func GetMeasureList(doc *enigma.Doc) ([]*SessionMeasureLayout, *util.Result) {
+	return GetMeasureListContext(ConnCtx, doc)
+}
+
+func GetMeasureListContext(ctx context.Context, doc *enigma.Doc) ([]*SessionMeasureLayout, *util.Result) {
 	prop := enigma.GenericObjectProperties{
 		Info: &enigma.NxInfo{Type: "MeasureList"},
 		MeasureListDef: &enigma.MeasureListDef{
@@ -125,11 +134,11 @@ func GetMeasureList(doc *enigma.Doc) ([]*SessionMeasureLayout, *util.Result) {
 			Data: SessionMeasureListDefData,
 		},
 	}
-	obj, err := doc.CreateSessionObject(ConnCtx, &prop)
+	obj, err := doc.CreateSessionObject(ctx, &prop)
 	if err != nil {
 		return nil, util.Error("CreateSessionObject", err)
 	}
-	layoutBuf, err := obj.GetLayoutRaw(ConnCtx)
+	layoutBuf, err := obj.GetLayoutRaw(ctx)
 	if err != nil {
 		return nil, util.Error("GetLayoutRaw", err)
 	}
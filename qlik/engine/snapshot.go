@@ -2,6 +2,7 @@ package engine
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -21,25 +22,35 @@ type ObjectSnapshot struct {
 	Digest      string            `json:"digest,omitempty"`
 }
 
+// replaceAppId replaces appId in properties buf by `__appid__`, so that digests of copies of an app are equal.
+func replaceAppId(buf []byte, appId *string) []byte {
+	if util.MaybeNil(appId) == "" {
+		return buf
+	}
+	return bytes.ReplaceAll(buf, []byte(*appId), []byte("__appid__"))
+}
+
+// ObjSnapshoter snapshots properties and the hypercube of an object. Master dimensions and measures,
+// bookmarks and variables aren't GenericObjects, their snapshots have properties only.
 func ObjSnapshoter(e ObjWalkEntry) (*ObjWalkResult[ObjectSnapshot], *util.Result) {
 	if e.Logger == nil {
 		e.Logger = loggers.NullLogger
 	}
 	e.Logger.Trace().Msgf("snapshot at %s[%s/%s]", util.MaybeNil(e.AppId), e.Info.Type, e.Info.Id)
 
-	obj, err := GetObject(e.Doc, e.Info.Type, e.Info.Id)
+	obj, err := GetObjectContext(e.Context(), e.Doc, e.Info.Type, e.Info.Id)
 	if err != nil {
 		return nil, util.Error("GetObject", err)
 	}
 	if !HasMethodOn(obj, "GetPropertiesRaw") {
 		return nil, util.LogMsgError(e.Logger, "HasMethodOn", "GetPropertiesRaw")
 	}
-	prop, err := Invoke1Res1ErrOn(obj, "GetPropertiesRaw", ConnCtx)
+	prop, err := Invoke1Res1ErrOn(obj, "GetPropertiesRaw", e.Context())
 	if err != nil {
 		return nil, util.Error("Invoke1Res1ErrOn::GetPropertiesRaw", err)
 	}
 	buf := prop.Interface().(json.RawMessage)
-	buf = bytes.ReplaceAll(buf, []byte(util.MaybeNil(e.AppId)), []byte("__appid__"))
+	buf = replaceAppId(buf, e.AppId)
 	digest, res := crypto.SHA2656Hex(buf)
 	if res != nil {
 		return nil, res.With("SHA2656Hex")
@@ -52,13 +63,11 @@ func ObjSnapshoter(e ObjWalkEntry) (*ObjWalkResult[ObjectSnapshot], *util.Result
 	e.Logger.Trace().Msgf(" - Title: %s, Description: %s", util.MaybeNil(title), util.MaybeNil(desc))
 
 	var cube *enigma.HyperCube
-	genericObj, ok := obj.Interface().(*enigma.GenericObject)
-	if !ok || genericObj == nil {
-		return nil, util.MsgError("GetHyperCube", "invalid object object")
-	}
-	cube, res = GetHyperCube(genericObj, enigma.Size{Cx: -1, Cy: 100})
-	if res != nil {
-		return nil, res.With("GetHyperCube")
+	if genericObj, ok := obj.Interface().(*enigma.GenericObject); ok && genericObj != nil {
+		cube, res = GetHyperCubeContext(e.Context(), genericObj, enigma.Size{Cx: -1, Cy: 100})
+		if res != nil {
+			return nil, res.With("GetHyperCube")
+		}
 	}
 	if cube != nil && cube.Size != nil {
 		e.Logger.Trace().Msgf(" - [%s/%s] size: (%d, %d)", util.MaybeNil(title), util.MaybeNil(desc), cube.Size.Cy, cube.Size.Cx)
@@ -79,6 +88,10 @@ func ObjSnapshoter(e ObjWalkEntry) (*ObjWalkResult[ObjectSnapshot], *util.Result
 }
 
 func RecursiveGetSnapshots(doc *enigma.Doc, cfg MixedConfig, opts *WalkOptions, _logger *zerolog.Logger) (AppWalkResult[ObjectSnapshot], *util.Result) {
+	return RecursiveGetSnapshotsContext(ConnCtx, doc, cfg, opts, _logger)
+}
+
+func RecursiveGetSnapshotsContext(ctx context.Context, doc *enigma.Doc, cfg MixedConfig, opts *WalkOptions, _logger *zerolog.Logger) (AppWalkResult[ObjectSnapshot], *util.Result) {
 	walkers := make(ListWalkFuncMap[ObjectSnapshot])
 	walkers[ANY_LIST] = NewRecurObjWalkFunc(ObjSnapshoter)
 	appSnapshoter := AppWalker[ObjectSnapshot]{
@@ -86,9 +99,10 @@ func RecursiveGetSnapshots(doc *enigma.Doc, cfg MixedConfig, opts *WalkOptions,
 		Logger:  _logger,
 	}
 
-	return appSnapshoter.Walk(doc, cfg, opts)
+	return appSnapshoter.WalkContext(ctx, doc, cfg, opts)
 }
 
+// Diff returns the first difference of from and to, see SemanticDiff for all of them.
 func (from *ObjectSnapshot) Diff(to *ObjectSnapshot) (*util.Diff, *util.Result) {
 	diff, res := util.NewJsonDiff("Title", from.Title, to.Title)
 	if res != nil {
@@ -123,15 +137,15 @@ func (from *ObjectSnapshot) Diff(to *ObjectSnapshot) (*util.Diff, *util.Result)
 	return nil, nil
 }
 
+// HyperCubeDiff compares data pages of from and to, it returns nil if they are the same,
+// including when neither has a hypercube, e.g. snapshots of master items.
 func HyperCubeDiff(path string, from, to *enigma.HyperCube) (*util.Diff, *util.Result) {
 	d := util.Diff{
 		Path: path,
 	}
 
 	if from == nil && to == nil {
-		d.Type = util.DiffEq
-		d.Diff = "DiffEq"
-		return &d, nil
+		return nil, nil
 	}
 	if from == nil {
 		d.Type = util.DiffAdd
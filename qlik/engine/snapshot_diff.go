@@ -0,0 +1,779 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"path"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/soderasen-au/go-common/util"
+)
+
+const (
+	DEFAULT_DIFF_MAX_ROW_CHANGES = 1000
+)
+
+// DiffOptions controls SnapshotDiff.
+type DiffOptions struct {
+	// property paths not compared, e.g. `/qMetaDef/modifiedDate`. `*` matches a segment, `**` any segments.
+	// A path also ignores its children.
+	IgnorePaths   []string `json:"ignore_paths,omitempty" yaml:"ignore_paths,omitempty" bson:"ignore_paths,omitempty"`
+	AbsTolerance  float64  `json:"abs_tolerance,omitempty" yaml:"abs_tolerance,omitempty" bson:"abs_tolerance,omitempty"`
+	RelTolerance  float64  `json:"rel_tolerance,omitempty" yaml:"rel_tolerance,omitempty" bson:"rel_tolerance,omitempty"`       // relative to the larger absolute value
+	MaxRowChanges int      `json:"max_row_changes,omitempty" yaml:"max_row_changes,omitempty" bson:"max_row_changes,omitempty"` // rows listed per object, 0 means no limit
+}
+
+// DefaultDiffOptions ignores VolatileProperties.
+func DefaultDiffOptions() *DiffOptions {
+	return &DiffOptions{
+		IgnorePaths:   slices.Clone(VolatileProperties),
+		AbsTolerance:  1e-9,
+		MaxRowChanges: DEFAULT_DIFF_MAX_ROW_CHANGES,
+	}
+}
+
+type (
+	// PropertyChange is a changed property at a JSON pointer like `/qHyperCubeDef/qMeasures/[cId=abc]/qDef/qDef`,
+	// elements of arrays are identified by `cId`, `qInfo.qId` or `name` if possible, otherwise by index.
+	// Path `title` and `description` are the resolved title and description of the object.
+	PropertyChange struct {
+		Path string `json:"path" yaml:"path"`
+		Type string `json:"type" yaml:"type"` // util.DiffAdd, util.DiffDel or util.DiffMod
+		From any    `json:"from,omitempty" yaml:"from,omitempty"`
+		To   any    `json:"to,omitempty" yaml:"to,omitempty"`
+	}
+
+	CellChange struct {
+		Column string   `json:"column" yaml:"column"`
+		From   string   `json:"from" yaml:"from"`
+		To     string   `json:"to" yaml:"to"`
+		Delta  *float64 `json:"delta,omitempty" yaml:"delta,omitempty"` // To - From, if both are numbers
+	}
+
+	// RowChange is a changed row keyed by its dimension values, or by its row headers in pivot tables.
+	RowChange struct {
+		Key   []string      `json:"key" yaml:"key"`
+		Type  string        `json:"type" yaml:"type"`
+		From  []string      `json:"from,omitempty" yaml:"from,omitempty"` // cells of deleted row
+		To    []string      `json:"to,omitempty" yaml:"to,omitempty"`     // cells of added row
+		Cells []*CellChange `json:"cells,omitempty" yaml:"cells,omitempty"`
+	}
+
+	DataDiff struct {
+		FromMode  string       `json:"from_mode,omitempty" yaml:"from_mode,omitempty"`
+		ToMode    string       `json:"to_mode,omitempty" yaml:"to_mode,omitempty"`
+		FromSize  *enigma.Size `json:"from_size,omitempty" yaml:"from_size,omitempty"`
+		ToSize    *enigma.Size `json:"to_size,omitempty" yaml:"to_size,omitempty"`
+		Columns   []string     `json:"columns,omitempty" yaml:"columns,omitempty"`
+		Rows      []*RowChange `json:"rows,omitempty" yaml:"rows,omitempty"`
+		Truncated bool         `json:"truncated,omitempty" yaml:"truncated,omitempty"` // more than MaxRowChanges rows changed
+	}
+
+	ObjectDiffSummary struct {
+		Properties    int `json:"properties" yaml:"properties"`
+		RowsAdded     int `json:"rows_added" yaml:"rows_added"`
+		RowsDeleted   int `json:"rows_deleted" yaml:"rows_deleted"`
+		RowsModified  int `json:"rows_modified" yaml:"rows_modified"`
+		CellsModified int `json:"cells_modified" yaml:"cells_modified"`
+	}
+
+	ObjectDiff struct {
+		List       string            `json:"list" yaml:"list"`
+		Id         string            `json:"id" yaml:"id"`
+		Type       string            `json:"type" yaml:"type"`
+		Title      string            `json:"title,omitempty" yaml:"title,omitempty"`
+		SheetId    string            `json:"sheet_id,omitempty" yaml:"sheet_id,omitempty"`
+		SheetName  string            `json:"sheet_name,omitempty" yaml:"sheet_name,omitempty"`
+		Change     string            `json:"change" yaml:"change"` // util.DiffAdd, util.DiffDel or util.DiffMod
+		Properties []*PropertyChange `json:"properties,omitempty" yaml:"properties,omitempty"`
+		Data       *DataDiff         `json:"data,omitempty" yaml:"data,omitempty"`
+		Summary    ObjectDiffSummary `json:"summary" yaml:"summary"`
+	}
+
+	AppDiffSummary struct {
+		Added     int `json:"added" yaml:"added"`
+		Deleted   int `json:"deleted" yaml:"deleted"`
+		Modified  int `json:"modified" yaml:"modified"`
+		Unchanged int `json:"unchanged" yaml:"unchanged"`
+	}
+
+	// AppDiff lists changed objects of two app snapshots ordered by list, sheet and object id.
+	AppDiff struct {
+		Objects []*ObjectDiff  `json:"objects" yaml:"objects"`
+		Summary AppDiffSummary `json:"summary" yaml:"summary"`
+	}
+)
+
+// SnapshotDiff compares every object of from and to, unlike AppSnapshotDiff it doesn't stop at the first difference.
+func SnapshotDiff(from, to AppWalkResult[ObjectSnapshot], opts *DiffOptions) (*AppDiff, *util.Result) {
+	if opts == nil {
+		opts = DefaultDiffOptions()
+	}
+	ret := &AppDiff{Objects: make([]*ObjectDiff, 0)}
+
+	listNames := make(map[string]bool)
+	for name := range from {
+		listNames[name] = true
+	}
+	for name := range to {
+		listNames[name] = true
+	}
+	for listName := range listNames {
+		fromList := FlattenList(from[listName])
+		toList := FlattenList(to[listName])
+		for id, fromObj := range fromList {
+			toObj, ok := toList[id]
+			if !ok {
+				ret.Objects = append(ret.Objects, newObjectDiff(listName, fromObj, util.DiffDel))
+				ret.Summary.Deleted++
+				continue
+			}
+			objDiff, res := fromObj.Result.SemanticDiff(toObj.Result, opts)
+			if res != nil {
+				return nil, res.With(fmt.Sprintf("Obj[%s].SemanticDiff", id))
+			}
+			if objDiff == nil {
+				ret.Summary.Unchanged++
+				continue
+			}
+			d := newObjectDiff(listName, toObj, util.DiffMod)
+			d.Properties, d.Data, d.Summary = objDiff.Properties, objDiff.Data, objDiff.Summary
+			ret.Objects = append(ret.Objects, d)
+			ret.Summary.Modified++
+		}
+		for id, toObj := range toList {
+			if _, ok := fromList[id]; !ok {
+				ret.Objects = append(ret.Objects, newObjectDiff(listName, toObj, util.DiffAdd))
+				ret.Summary.Added++
+			}
+		}
+	}
+
+	sort.Slice(ret.Objects, func(i, j int) bool {
+		a, b := ret.Objects[i], ret.Objects[j]
+		if a.List != b.List {
+			return a.List < b.List
+		}
+		if a.SheetId != b.SheetId {
+			return a.SheetId < b.SheetId
+		}
+		return a.Id < b.Id
+	})
+	return ret, nil
+}
+
+func newObjectDiff(listName string, obj *ObjWalkResult[ObjectSnapshot], change string) *ObjectDiff {
+	d := &ObjectDiff{
+		List:      listName,
+		SheetId:   obj.SheetId,
+		SheetName: obj.SheetName,
+		Title:     util.MaybeNil(obj.ObjectTitle),
+		Change:    change,
+	}
+	if obj.Info != nil {
+		d.Id, d.Type = obj.Info.Id, obj.Info.Type
+	}
+	if d.Title == "" && obj.Result != nil {
+		d.Title = util.MaybeNil(obj.Result.Title)
+	}
+	return d
+}
+
+// SemanticDiff lists all changed properties and data rows from `from` to `to`, it returns nil if nothing changed.
+func (from *ObjectSnapshot) SemanticDiff(to *ObjectSnapshot, opts *DiffOptions) (*ObjectDiff, *util.Result) {
+	if opts == nil {
+		opts = DefaultDiffOptions()
+	}
+	if from == nil {
+		from = &ObjectSnapshot{}
+	}
+	if to == nil {
+		to = &ObjectSnapshot{}
+	}
+
+	d := &ObjectDiff{Change: util.DiffMod, Properties: make([]*PropertyChange, 0)}
+	if util.MaybeNil(from.Title) != util.MaybeNil(to.Title) {
+		d.Properties = append(d.Properties, &PropertyChange{Path: "title", Type: util.DiffMod, From: util.MaybeNil(from.Title), To: util.MaybeNil(to.Title)})
+	}
+	if util.MaybeNil(from.Description) != util.MaybeNil(to.Description) {
+		d.Properties = append(d.Properties, &PropertyChange{Path: "description", Type: util.DiffMod, From: util.MaybeNil(from.Description), To: util.MaybeNil(to.Description)})
+	}
+	props, res := DiffProperties(from.Properties, to.Properties, opts)
+	if res != nil {
+		return nil, res.With("DiffProperties")
+	}
+	d.Properties = append(d.Properties, props...)
+	d.Summary.Properties = len(d.Properties)
+
+	d.Data = diffHyperCubeData(from.HyperCube, to.HyperCube, measureIds(from.Properties), measureIds(to.Properties), opts)
+	if d.Data != nil {
+		for _, r := range d.Data.Rows {
+			switch r.Type {
+			case util.DiffAdd:
+				d.Summary.RowsAdded++
+			case util.DiffDel:
+				d.Summary.RowsDeleted++
+			default:
+				d.Summary.RowsModified++
+				d.Summary.CellsModified += len(r.Cells)
+			}
+		}
+		if opts.MaxRowChanges > 0 && len(d.Data.Rows) > opts.MaxRowChanges {
+			d.Data.Rows = d.Data.Rows[:opts.MaxRowChanges]
+			d.Data.Truncated = true
+		}
+	}
+
+	if len(d.Properties) == 0 && d.Data == nil {
+		return nil, nil
+	}
+	return d, nil
+}
+
+// DiffProperties lists changed leaves of JSON properties, paths matching `opts.IgnorePaths` are skipped.
+func DiffProperties(from, to json.RawMessage, opts *DiffOptions) ([]*PropertyChange, *util.Result) {
+	if opts == nil {
+		opts = DefaultDiffOptions()
+	}
+	var fromVal, toVal any
+	if len(from) > 0 {
+		if err := json.Unmarshal(from, &fromVal); err != nil {
+			return nil, util.Error("ParseFrom", err)
+		}
+	}
+	if len(to) > 0 {
+		if err := json.Unmarshal(to, &toVal); err != nil {
+			return nil, util.Error("ParseTo", err)
+		}
+	}
+	changes := make([]*PropertyChange, 0)
+	opts.diffValue("", fromVal, toVal, &changes)
+	return changes, nil
+}
+
+func (opts *DiffOptions) diffValue(p string, from, to any, changes *[]*PropertyChange) {
+	if opts.isIgnored(p) {
+		return
+	}
+	fromMap, fromIsMap := from.(map[string]any)
+	toMap, toIsMap := to.(map[string]any)
+	if fromIsMap && toIsMap {
+		keys := make([]string, 0, len(fromMap)+len(toMap))
+		for k := range fromMap {
+			keys = append(keys, k)
+		}
+		for k := range toMap {
+			if _, ok := fromMap[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			opts.diffMember(p+"/"+escapePointer(k), fromMap, toMap, k, changes)
+		}
+		return
+	}
+
+	fromArr, fromIsArr := from.([]any)
+	toArr, toIsArr := to.([]any)
+	if fromIsArr && toIsArr {
+		fromKeys, toKeys := arrayKeys(fromArr), arrayKeys(toArr)
+		if fromKeys == nil || toKeys == nil {
+			for i := 0; i < len(fromArr) || i < len(toArr); i++ {
+				ip := p + "/" + strconv.Itoa(i)
+				switch {
+				case i >= len(toArr):
+					opts.addChange(ip, util.DiffDel, fromArr[i], nil, changes)
+				case i >= len(fromArr):
+					opts.addChange(ip, util.DiffAdd, nil, toArr[i], changes)
+				default:
+					opts.diffValue(ip, fromArr[i], toArr[i], changes)
+				}
+			}
+			return
+		}
+		fromByKey := make(map[string]any, len(fromArr))
+		toByKey := make(map[string]any, len(toArr))
+		for i, k := range fromKeys {
+			fromByKey[k] = fromArr[i]
+		}
+		for i, k := range toKeys {
+			toByKey[k] = toArr[i]
+		}
+		for _, k := range fromKeys {
+			opts.diffMember(p+"/["+k+"]", fromByKey, toByKey, k, changes)
+		}
+		for _, k := range toKeys {
+			if _, ok := fromByKey[k]; !ok {
+				opts.addChange(p+"/["+k+"]", util.DiffAdd, nil, toByKey[k], changes)
+			}
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(from, to) {
+		opts.addChange(p, util.DiffMod, from, to, changes)
+	}
+}
+
+func (opts *DiffOptions) diffMember(p string, from, to map[string]any, k string, changes *[]*PropertyChange) {
+	f, fok := from[k]
+	t, tok := to[k]
+	switch {
+	case !tok:
+		opts.addChange(p, util.DiffDel, f, nil, changes)
+	case !fok:
+		opts.addChange(p, util.DiffAdd, nil, t, changes)
+	default:
+		opts.diffValue(p, f, t, changes)
+	}
+}
+
+func (opts *DiffOptions) addChange(p, typ string, from, to any, changes *[]*PropertyChange) {
+	if opts.isIgnored(p) {
+		return
+	}
+	*changes = append(*changes, &PropertyChange{Path: p, Type: typ, From: from, To: to})
+}
+
+func (opts *DiffOptions) isIgnored(p string) bool {
+	segments := strings.Split(strings.TrimPrefix(p, "/"), "/")
+	for _, pattern := range opts.IgnorePaths {
+		if matchPathPrefix(strings.Split(strings.TrimPrefix(pattern, "/"), "/"), segments) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPathPrefix reports whether pattern matches segments or their prefix.
+func matchPathPrefix(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return true
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchPathPrefix(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	// keyed elements like `[cId=x]` are compared literally
+	ok := pattern[0] == segments[0]
+	if !ok && !strings.HasPrefix(pattern[0], "[") {
+		ok, _ = path.Match(pattern[0], segments[0])
+	}
+	return ok && matchPathPrefix(pattern[1:], segments[1:])
+}
+
+func escapePointer(k string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(k, "~", "~0"), "/", "~1")
+}
+
+// arrayKeys identifies elements of arr, it returns nil if any element has no unique id.
+func arrayKeys(arr []any) []string {
+	if len(arr) == 0 {
+		return nil
+	}
+	keys := make([]string, len(arr))
+	seen := make(map[string]bool, len(arr))
+	for i, e := range arr {
+		m, ok := e.(map[string]any)
+		if !ok {
+			return nil
+		}
+		var key string
+		if id, ok := m["cId"].(string); ok && id != "" {
+			key = "cId=" + id
+		} else if def, ok := m["qDef"].(map[string]any); ok && def["cId"] != nil && def["cId"] != "" {
+			key = fmt.Sprintf("cId=%v", def["cId"])
+		} else if info, ok := m["qInfo"].(map[string]any); ok && info["qId"] != nil && info["qId"] != "" {
+			key = fmt.Sprintf("qId=%v", info["qId"])
+		} else if name, ok := m["name"].(string); ok && name != "" {
+			key = "name=" + name
+		} else {
+			return nil
+		}
+		if seen[key] {
+			return nil
+		}
+		seen[key] = true
+		keys[i] = key
+	}
+	return keys
+}
+
+// dataGrid is hypercube data keyed by row key and column id.
+type dataGrid struct {
+	columns []string          // column ids in order
+	names   map[string]string // column id => title
+	keys    [][]string
+	rows    map[string]map[string]gridCell
+}
+
+type gridCell struct {
+	text  string
+	num   float64
+	isNum bool
+}
+
+func newDataGrid() *dataGrid {
+	return &dataGrid{names: make(map[string]string), rows: make(map[string]map[string]gridCell)}
+}
+
+func (g *dataGrid) hasColumn(id string) bool {
+	_, ok := g.names[id]
+	return ok
+}
+
+func (g *dataGrid) addColumn(id, name string) {
+	if !g.hasColumn(id) {
+		g.columns = append(g.columns, id)
+		g.names[id] = name
+	}
+}
+
+// row returns the row of key, adding it if it's new.
+func (g *dataGrid) row(key []string) map[string]gridCell {
+	if row, ok := g.rows[strings.Join(key, "\x00")]; ok {
+		return row
+	}
+	return g.addRow(key)
+}
+
+// addRow adds a row, keys of duplicated rows get their occurrence number.
+func (g *dataGrid) addRow(key []string) map[string]gridCell {
+	k := strings.Join(key, "\x00")
+	for n := 2; ; n++ {
+		if _, ok := g.rows[k]; !ok {
+			break
+		}
+		k = strings.Join(key, "\x00") + "\x00#" + strconv.Itoa(n)
+		if n == 2 {
+			key = append(append([]string{}, key...), "#2")
+		} else {
+			key[len(key)-1] = "#" + strconv.Itoa(n)
+		}
+	}
+	row := make(map[string]gridCell)
+	g.rows[k] = row
+	g.keys = append(g.keys, key)
+	return row
+}
+
+func (g *dataGrid) values(key []string) []string {
+	row := g.rows[strings.Join(key, "\x00")]
+	ret := make([]string, len(g.columns))
+	for i, c := range g.columns {
+		ret[i] = row[c].text
+	}
+	return ret
+}
+
+func newGridCell(text string, num float64) gridCell {
+	return gridCell{text: text, num: num, isNum: !math.IsNaN(num) && !math.IsInf(num, 0)}
+}
+
+// measureIds returns `cId` of measures in hypercube properties `props`, in the order of qMeasureInfo of the layout.
+func measureIds(props json.RawMessage) []string {
+	if len(props) == 0 {
+		return nil
+	}
+	var p struct {
+		HyperCubeDef *struct {
+			Measures []*struct {
+				Def *struct {
+					CId string `json:"cId"`
+				} `json:"qDef"`
+			} `json:"qMeasures"`
+		} `json:"qHyperCubeDef"`
+	}
+	if err := json.Unmarshal(props, &p); err != nil || p.HyperCubeDef == nil {
+		return nil
+	}
+	ids := make([]string, len(p.HyperCubeDef.Measures))
+	for i, m := range p.HyperCubeDef.Measures {
+		if m != nil && m.Def != nil {
+			ids[i] = m.Def.CId
+		}
+	}
+	return ids
+}
+
+// hyperCubeGrid keys measure columns by `cId` in `ids`, or by title if a measure has none,
+// pages of a pivot cube are merged by their row headers.
+func hyperCubeGrid(cube *enigma.HyperCube, ids []string) *dataGrid {
+	g := newDataGrid()
+	if cube == nil {
+		return g
+	}
+	if cube.Mode == "P" || cube.Mode == "K" {
+		for _, page := range cube.PivotDataPages {
+			if page == nil {
+				continue
+			}
+			lefts := pivotLeaves(page.Left, nil, nil)
+			tops := pivotLeaves(page.Top, nil, nil)
+			for _, top := range tops {
+				label := strings.Join(top, " / ")
+				g.addColumn(label, label)
+			}
+			for r, left := range lefts {
+				if r >= len(page.Data) {
+					break
+				}
+				// pages split by columns have the same rows
+				row := g.row(left)
+				for c, v := range page.Data[r] {
+					if c < len(tops) && v != nil {
+						row[strings.Join(tops[c], " / ")] = newGridCell(v.Text, float64(v.Num))
+					}
+				}
+			}
+		}
+		return g
+	}
+
+	nd := len(cube.DimensionInfo)
+	columns := make([]string, len(cube.MeasureInfo))
+	for i, m := range cube.MeasureInfo {
+		id := "title=" + m.FallbackTitle
+		if i < len(ids) && ids[i] != "" {
+			id = "cId=" + ids[i]
+		}
+		base := id
+		for n := 2; g.hasColumn(id); n++ {
+			id = base + "#" + strconv.Itoa(n)
+		}
+		columns[i] = id
+		g.addColumn(id, m.FallbackTitle)
+	}
+	// pages may split rows by columns
+	cells := make(map[int]map[int]*enigma.NxCell)
+	rowIdx := make([]int, 0)
+	for _, page := range cube.DataPages {
+		if page == nil {
+			continue
+		}
+		top, left := 0, 0
+		if page.Area != nil {
+			top, left = page.Area.Top, page.Area.Left
+		}
+		for r, row := range page.Matrix {
+			if _, ok := cells[top+r]; !ok {
+				cells[top+r] = make(map[int]*enigma.NxCell)
+				rowIdx = append(rowIdx, top+r)
+			}
+			for c, cell := range row {
+				cells[top+r][left+c] = cell
+			}
+		}
+	}
+	sort.Ints(rowIdx)
+	for _, r := range rowIdx {
+		key := make([]string, nd)
+		for c := 0; c < nd; c++ {
+			if cell := cells[r][c]; cell != nil {
+				key[c] = cell.Text
+			}
+		}
+		row := g.addRow(key)
+		for c, cell := range cells[r] {
+			if c >= nd && c-nd < len(columns) && cell != nil {
+				row[columns[c-nd]] = newGridCell(cell.Text, float64(cell.Num))
+			}
+		}
+	}
+	return g
+}
+
+func pivotLeaves(nodes []*enigma.NxPivotDimensionCell, prefix []string, out [][]string) [][]string {
+	for _, n := range nodes {
+		if n == nil {
+			continue
+		}
+		p := append(append([]string{}, prefix...), n.Text)
+		if len(n.SubNodes) == 0 {
+			out = append(out, p)
+		} else {
+			out = pivotLeaves(n.SubNodes, p, out)
+		}
+	}
+	return out
+}
+
+func (opts *DiffOptions) cellEqual(a, b gridCell) bool {
+	if a.isNum && b.isNum {
+		delta := math.Abs(a.num - b.num)
+		if delta <= opts.AbsTolerance {
+			return true
+		}
+		return opts.RelTolerance > 0 && delta <= opts.RelTolerance*math.Max(math.Abs(a.num), math.Abs(b.num))
+	}
+	return a.text == b.text
+}
+
+// DiffHyperCubeData compares rows by their keys, so inserted or deleted rows don't change other rows,
+// it returns nil if data, size and mode are the same. Measures are matched by title, SemanticDiff matches
+// them by `cId` of the properties.
+func DiffHyperCubeData(from, to *enigma.HyperCube, opts *DiffOptions) *DataDiff {
+	return diffHyperCubeData(from, to, nil, nil, opts)
+}
+
+func diffHyperCubeData(from, to *enigma.HyperCube, fromIds, toIds []string, opts *DiffOptions) *DataDiff {
+	if opts == nil {
+		opts = DefaultDiffOptions()
+	}
+	if from == nil && to == nil {
+		return nil
+	}
+	d := &DataDiff{Rows: make([]*RowChange, 0)}
+	if from != nil {
+		d.FromMode, d.FromSize = from.Mode, from.Size
+	}
+	if to != nil {
+		d.ToMode, d.ToSize = to.Mode, to.Size
+	}
+
+	fromGrid, toGrid := hyperCubeGrid(from, fromIds), hyperCubeGrid(to, toIds)
+	// titles of `to` win
+	columns := newDataGrid()
+	for _, c := range toGrid.columns {
+		columns.addColumn(c, toGrid.names[c])
+	}
+	for _, c := range fromGrid.columns {
+		columns.addColumn(c, fromGrid.names[c])
+	}
+	for _, c := range columns.columns {
+		d.Columns = append(d.Columns, columns.names[c])
+	}
+
+	for _, key := range fromGrid.keys {
+		k := strings.Join(key, "\x00")
+		fromRow := fromGrid.rows[k]
+		toRow, ok := toGrid.rows[k]
+		if !ok {
+			d.Rows = append(d.Rows, &RowChange{Key: key, Type: util.DiffDel, From: fromGrid.values(key)})
+			continue
+		}
+		var cells []*CellChange
+		for _, c := range columns.columns {
+			fc, tc := fromRow[c], toRow[c]
+			if opts.cellEqual(fc, tc) {
+				continue
+			}
+			change := &CellChange{Column: columns.names[c], From: fc.text, To: tc.text}
+			if fc.isNum && tc.isNum {
+				change.Delta = util.Ptr(tc.num - fc.num)
+			}
+			cells = append(cells, change)
+		}
+		if len(cells) > 0 {
+			d.Rows = append(d.Rows, &RowChange{Key: key, Type: util.DiffMod, Cells: cells})
+		}
+	}
+	for _, key := range toGrid.keys {
+		if _, ok := fromGrid.rows[strings.Join(key, "\x00")]; !ok {
+			d.Rows = append(d.Rows, &RowChange{Key: key, Type: util.DiffAdd, To: toGrid.values(key)})
+		}
+	}
+
+	if len(d.Rows) == 0 && d.FromMode == d.ToMode && reflect.DeepEqual(d.FromSize, d.ToSize) {
+		return nil
+	}
+	return d
+}
+
+// WriteJSON writes d as indented JSON.
+func (d *AppDiff) WriteJSON(w io.Writer) *util.Result {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(d); err != nil {
+		return util.Error("EncodeAppDiff", err)
+	}
+	return nil
+}
+
+// WriteHTML writes d as a standalone HTML report.
+func (d *AppDiff) WriteHTML(w io.Writer, title string) *util.Result {
+	tmpl, err := template.New("diff").Funcs(template.FuncMap{
+		"json": func(v any) string {
+			if v == nil {
+				return ""
+			}
+			buf, err := json.Marshal(v)
+			if err != nil {
+				return fmt.Sprint(v)
+			}
+			return string(buf)
+		},
+		"join": strings.Join,
+	}).Parse(appDiffHtml)
+	if err != nil {
+		return util.Error("ParseTemplate", err)
+	}
+	if err := tmpl.Execute(w, map[string]any{"Title": title, "Diff": d}); err != nil {
+		return util.Error("ExecuteTemplate", err)
+	}
+	return nil
+}
+
+const appDiffHtml = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; margin: 24px; }
+table { border-collapse: collapse; margin: 8px 0 16px; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f4f4f4; }
+td.value { font-family: monospace; white-space: pre-wrap; word-break: break-all; max-width: 480px; }
+.add { color: #1a7f37; } .delete { color: #cf222e; } .modify { color: #9a6700; }
+h2 { border-bottom: 1px solid #ddd; padding-bottom: 4px; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<table>
+<tr><th>Added</th><th>Deleted</th><th>Modified</th><th>Unchanged</th></tr>
+<tr><td>{{.Diff.Summary.Added}}</td><td>{{.Diff.Summary.Deleted}}</td><td>{{.Diff.Summary.Modified}}</td><td>{{.Diff.Summary.Unchanged}}</td></tr>
+</table>
+{{range .Diff.Objects}}
+<h2 class="{{.Change}}">[{{.Change}}] {{.Type}}/{{.Id}}{{if .Title}} - {{.Title}}{{end}}</h2>
+<p>{{.List}}{{if .SheetName}} &middot; sheet: {{.SheetName}}{{end}} &middot;
+properties: {{.Summary.Properties}}, rows added: {{.Summary.RowsAdded}}, deleted: {{.Summary.RowsDeleted}},
+modified: {{.Summary.RowsModified}} ({{.Summary.CellsModified}} cells)</p>
+{{if .Properties}}
+<table>
+<tr><th>Path</th><th>Change</th><th>From</th><th>To</th></tr>
+{{range .Properties}}<tr><td>{{.Path}}</td><td class="{{.Type}}">{{.Type}}</td><td class="value">{{json .From}}</td><td class="value">{{json .To}}</td></tr>
+{{end}}</table>
+{{end}}
+{{with .Data}}
+{{if ne .FromMode .ToMode}}<p>Mode: {{.FromMode}} &rarr; {{.ToMode}}</p>{{end}}
+{{if .Rows}}
+<table>
+<tr><th>Key</th><th>Change</th><th>Column</th><th>From</th><th>To</th></tr>
+{{range .Rows}}{{$row := .}}{{if eq .Type "modify"}}{{range .Cells}}<tr><td>{{join $row.Key " | "}}</td><td class="modify">modify</td><td>{{.Column}}</td><td class="value">{{.From}}</td><td class="value">{{.To}}</td></tr>
+{{end}}{{else}}<tr><td>{{join .Key " | "}}</td><td class="{{.Type}}">{{.Type}}</td><td></td><td class="value">{{join .From " | "}}</td><td class="value">{{join .To " | "}}</td></tr>
+{{end}}{{end}}</table>
+{{if .Truncated}}<p>More rows changed, see the summary.</p>{{end}}
+{{end}}
+{{end}}
+{{end}}
+</body>
+</html>
+`
@@ -0,0 +1,383 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/soderasen-au/go-common/util"
+)
+
+func TestDiffProperties(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		want     []string // type path
+	}{
+		{
+			name: "nested",
+			from: `{"qInfo":{"qId":"a"},"title":"x","qMeta":{"title":"x"}}`,
+			to:   `{"qInfo":{"qId":"a"},"title":"y","qMeta":{"title":"y"}}`,
+			want: []string{"modify /title"},
+		},
+		{
+			name: "ignored volatile fields",
+			from: `{"modifiedDate":"1","a":{"modifiedDate":"1","b":1},"qMeta":{"createdDate":"1"}}`,
+			to:   `{"modifiedDate":"2","a":{"modifiedDate":"2","b":1},"qMeta":{"createdDate":"2"}}`,
+			want: []string{"modify /a/modifiedDate"},
+		},
+		{
+			name: "keyed array insert",
+			from: `{"qMeasures":[{"qDef":{"cId":"m1","qDef":"Sum(A)"}},{"qDef":{"cId":"m2","qDef":"Sum(B)"}}]}`,
+			to:   `{"qMeasures":[{"qDef":{"cId":"m0","qDef":"Sum(Z)"}},{"qDef":{"cId":"m1","qDef":"Sum(A)"}},{"qDef":{"cId":"m2","qDef":"Sum(C)"}}]}`,
+			want: []string{"modify /qMeasures/[cId=m2]/qDef/qDef", "add /qMeasures/[cId=m0]"},
+		},
+		{
+			name: "indexed array",
+			from: `{"colors":[1,2],"a/b":true}`,
+			to:   `{"colors":[1,3,4]}`,
+			want: []string{"delete /a~1b", "modify /colors/1", "add /colors/2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, res := DiffProperties(json.RawMessage(tt.from), json.RawMessage(tt.to), nil)
+			if res != nil {
+				t.Fatalf("DiffProperties: %v", res)
+			}
+			got := make([]string, 0)
+			for _, c := range changes {
+				got = append(got, c.Type+" "+c.Path)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("DiffProperties() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoveVolatileObjectProperties(t *testing.T) {
+	p := &ObjectPropeties{
+		Info:       &enigma.NxInfo{Id: "a"},
+		Meta:       &NxMeta{},
+		Properties: json.RawMessage(`{"qInfo":{"qId":"a"},"createdDate":"1","qMeta":{"title":"a"},"props":{"createdDate":"custom","privileges":["x"]}}`),
+		ChildInfos: []*ObjectPropeties{{Info: &enigma.NxInfo{Id: "b"}, Properties: json.RawMessage(`{"modifiedDate":"1","title":"b"}`)}},
+	}
+	if res := RemoveVolatileObjectProperties(p); res != nil {
+		t.Fatalf("RemoveVolatileObjectProperties: %v", res)
+	}
+	if got := string(p.Properties); got != `{"props":{"createdDate":"custom","privileges":["x"]},"qInfo":{"qId":"a"}}` {
+		t.Errorf("properties = %s", got)
+	}
+	if got := string(p.ChildInfos[0].Properties); got != `{"title":"b"}` {
+		t.Errorf("child properties = %s", got)
+	}
+
+	p.ChildInfos[0].Properties = json.RawMessage(`{"title":`)
+	if res := RemoveVolatileObjectProperties(p); res == nil {
+		t.Errorf("RemoveVolatileObjectProperties of invalid properties succeeded")
+	}
+
+	// the method clears only dates of meta
+	created := "1"
+	p = &ObjectPropeties{Meta: &NxMeta{CreatedDate: &created, ModifiedDate: &created}, Properties: json.RawMessage(`{"createdDate":"1"}`)}
+	p.RemoveVolatileFields()
+	if p.Meta.CreatedDate != nil || p.Meta.ModifiedDate != nil || string(p.Properties) != `{"createdDate":"1"}` {
+		t.Errorf("RemoveVolatileFields() = %s", util.JsonStr(p))
+	}
+}
+
+func TestDiffOptions_isIgnored(t *testing.T) {
+	opts := &DiffOptions{IgnorePaths: []string{"/qMeta", "**/modifiedDate", "/qHyperCubeDef/*/[cId=x]"}}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/qMeta", true},
+		{"/qMeta/title", true},
+		{"/qMetaDef", false},
+		{"/modifiedDate", true},
+		{"/a/b/modifiedDate", true},
+		{"/qHyperCubeDef/qMeasures/[cId=x]/qDef", true},
+		{"/qHyperCubeDef/qMeasures/[cId=y]/qDef", false},
+	}
+	for _, tt := range tests {
+		if got := opts.isIgnored(tt.path); got != tt.want {
+			t.Errorf("isIgnored(%s) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func straightCube(rows ...[]any) *enigma.HyperCube {
+	matrix := make([]enigma.NxCellRows, 0, len(rows))
+	for _, r := range rows {
+		cells := enigma.NxCellRows{
+			{Text: r[0].(string), Num: enigma.Float64(math.NaN())},
+			{Text: r[1].(string), Num: enigma.Float64(r[2].(float64))},
+		}
+		matrix = append(matrix, cells)
+	}
+	return &enigma.HyperCube{
+		Mode:          "S",
+		Size:          &enigma.Size{Cx: 2, Cy: len(rows)},
+		DimensionInfo: []*enigma.NxDimensionInfo{{FallbackTitle: "Region"}},
+		MeasureInfo:   []*enigma.NxMeasureInfo{{FallbackTitle: "Sales"}},
+		DataPages:     []*enigma.NxDataPage{{Matrix: matrix, Area: &enigma.Rect{Width: 2, Height: len(rows)}}},
+	}
+}
+
+func TestDiffHyperCubeData(t *testing.T) {
+	base := straightCube([]any{"East", "100", 100.0}, []any{"West", "200", 200.0})
+	tests := []struct {
+		name string
+		to   *enigma.HyperCube
+		opts *DiffOptions
+		want []string // type key cells
+	}{
+		{
+			name: "equal",
+			to:   straightCube([]any{"East", "100", 100.0}, []any{"West", "200", 200.0}),
+		},
+		{
+			name: "inserted row",
+			to:   straightCube([]any{"East", "100", 100.0}, []any{"North", "50", 50.0}, []any{"West", "200", 200.0}),
+			want: []string{"add North"},
+		},
+		{
+			name: "modified and deleted",
+			to:   straightCube([]any{"West", "210", 210.0}),
+			want: []string{"delete East", "modify West Sales:200>210"},
+		},
+		{
+			name: "within tolerance",
+			to:   straightCube([]any{"East", "100.5", 100.5}, []any{"West", "200", 200.0}),
+			opts: &DiffOptions{RelTolerance: 0.01},
+		},
+		{
+			name: "out of tolerance",
+			to:   straightCube([]any{"East", "100.5", 100.5}, []any{"West", "200", 200.0}),
+			opts: &DiffOptions{AbsTolerance: 0.1},
+			want: []string{"modify East Sales:100>100.5"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := DiffHyperCubeData(base, tt.to, tt.opts)
+			got := make([]string, 0)
+			if d != nil {
+				for _, r := range d.Rows {
+					s := r.Type + " " + strings.Join(r.Key, "|")
+					for _, c := range r.Cells {
+						s += " " + c.Column + ":" + c.From + ">" + c.To
+					}
+					got = append(got, s)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("DiffHyperCubeData() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffHyperCubeData_Pivot(t *testing.T) {
+	pivot := func(east2024 float64) *enigma.HyperCube {
+		return &enigma.HyperCube{
+			Mode: "P",
+			Size: &enigma.Size{Cx: 2, Cy: 1},
+			PivotDataPages: []*enigma.NxPivotPage{{
+				Left: []*enigma.NxPivotDimensionCell{{Text: "East"}},
+				Top:  []*enigma.NxPivotDimensionCell{{Text: "2023"}, {Text: "2024"}},
+				Data: []enigma.ArrayOfNxValuePoint{{
+					{Text: "1", Num: 1},
+					{Text: util.JsonStr(east2024), Num: enigma.Float64(east2024)},
+				}},
+			}},
+		}
+	}
+	d := DiffHyperCubeData(pivot(2), pivot(3), nil)
+	if d == nil || len(d.Rows) != 1 || len(d.Rows[0].Cells) != 1 || d.Rows[0].Cells[0].Column != "2024" || *d.Rows[0].Cells[0].Delta != 1 {
+		t.Errorf("DiffHyperCubeData() = %s", util.JsonStr(d))
+	}
+
+	// the same data in pages split by columns
+	split := &enigma.HyperCube{
+		Mode: "P",
+		Size: &enigma.Size{Cx: 2, Cy: 1},
+		PivotDataPages: []*enigma.NxPivotPage{
+			{
+				Left: []*enigma.NxPivotDimensionCell{{Text: "East"}},
+				Top:  []*enigma.NxPivotDimensionCell{{Text: "2023"}},
+				Data: []enigma.ArrayOfNxValuePoint{{{Text: "1", Num: 1}}},
+				Area: &enigma.Rect{Width: 1, Height: 1},
+			},
+			{
+				Left: []*enigma.NxPivotDimensionCell{{Text: "East"}},
+				Top:  []*enigma.NxPivotDimensionCell{{Text: "2024"}},
+				Data: []enigma.ArrayOfNxValuePoint{{{Text: "2", Num: 2}}},
+				Area: &enigma.Rect{Left: 1, Width: 1, Height: 1},
+			},
+		},
+	}
+	if d := DiffHyperCubeData(pivot(2), split, nil); d != nil {
+		t.Errorf("DiffHyperCubeData() of split pages = %s", util.JsonStr(d))
+	}
+}
+
+func TestDiffHyperCubeData_MeasureIds(t *testing.T) {
+	// cube has a row East and a measure per title, titled `title=value`
+	cube := func(measures ...string) *enigma.HyperCube {
+		c := &enigma.HyperCube{
+			Mode:          "S",
+			Size:          &enigma.Size{Cx: 1 + len(measures), Cy: 1},
+			DimensionInfo: []*enigma.NxDimensionInfo{{FallbackTitle: "Region"}},
+			DataPages:     []*enigma.NxDataPage{{Matrix: []enigma.NxCellRows{{{Text: "East", Num: enigma.Float64(math.NaN())}}}}},
+		}
+		for _, m := range measures {
+			title, value, _ := strings.Cut(m, "=")
+			num, _ := strconv.ParseFloat(value, 64)
+			c.MeasureInfo = append(c.MeasureInfo, &enigma.NxMeasureInfo{FallbackTitle: title})
+			c.DataPages[0].Matrix[0] = append(c.DataPages[0].Matrix[0], &enigma.NxCell{Text: value, Num: enigma.Float64(num)})
+		}
+		return c
+	}
+	tests := []struct {
+		name           string
+		from, to       *enigma.HyperCube
+		fromIds, toIds []string
+		want           string // column:from>to of changed cells
+	}{
+		{"reordered", cube("Sales=1", "Margin=2"), cube("Margin=2", "Sales=1"), []string{"s", "m"}, []string{"m", "s"}, ""},
+		{"renamed", cube("Sales=1"), cube("Revenue=1"), []string{"s"}, []string{"s"}, ""},
+		{"renamed and changed", cube("Sales=1"), cube("Revenue=2"), []string{"s"}, []string{"s"}, "Revenue:1>2"},
+		{"reordered by title", cube("Sales=1", "Margin=2"), cube("Margin=2", "Sales=1"), nil, nil, ""},
+		{"duplicated titles", cube("Sales=1", "Sales=2"), cube("Sales=1", "Sales=3"), nil, nil, "Sales:2>3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := diffHyperCubeData(tt.from, tt.to, tt.fromIds, tt.toIds, nil)
+			got := make([]string, 0)
+			if d != nil {
+				for _, r := range d.Rows {
+					for _, c := range r.Cells {
+						got = append(got, c.Column+":"+c.From+">"+c.To)
+					}
+				}
+			}
+			if strings.Join(got, ",") != tt.want {
+				t.Errorf("diffHyperCubeData() = %v, want %s", got, tt.want)
+			}
+		})
+	}
+
+	props := `{"qHyperCubeDef":{"qMeasures":[{"qDef":{"cId":"s","qDef":"Sum(Sales)"}},{"qDef":{"qDef":"Sum(Margin)"}}]}}`
+	if ids := measureIds(json.RawMessage(props)); strings.Join(ids, ",") != "s," {
+		t.Errorf("measureIds() = %v", ids)
+	}
+}
+
+func TestSnapshotDiff(t *testing.T) {
+	snapshot := func(title string, cube *enigma.HyperCube) *ObjectSnapshot {
+		return &ObjectSnapshot{Title: util.Ptr(title), Properties: json.RawMessage(`{"title":"` + title + `"}`), HyperCube: cube}
+	}
+	obj := func(id string, s *ObjectSnapshot) *ObjWalkResult[ObjectSnapshot] {
+		return &ObjWalkResult[ObjectSnapshot]{SheetId: "sheet", Info: &enigma.NxInfo{Id: id, Type: "table"}, Result: s}
+	}
+	from := AppWalkResult[ObjectSnapshot]{SHEET_LIST: ListWalkResult[ObjectSnapshot]{
+		"sheet": &ObjWalkResult[ObjectSnapshot]{
+			Info:   &enigma.NxInfo{Id: "sheet", Type: "sheet"},
+			Result: snapshot("Sheet", nil),
+			ChildResults: []*ObjWalkResult[ObjectSnapshot]{
+				obj("t1", snapshot("Sales", straightCube([]any{"East", "100", 100.0}))),
+				obj("t2", snapshot("Old", nil)),
+			},
+		},
+	}}
+	to := AppWalkResult[ObjectSnapshot]{SHEET_LIST: ListWalkResult[ObjectSnapshot]{
+		"sheet": &ObjWalkResult[ObjectSnapshot]{
+			Info:   &enigma.NxInfo{Id: "sheet", Type: "sheet"},
+			Result: snapshot("Sheet", nil),
+			ChildResults: []*ObjWalkResult[ObjectSnapshot]{
+				obj("t1", snapshot("Revenue", straightCube([]any{"East", "110", 110.0}, []any{"West", "5", 5.0}))),
+				obj("t3", snapshot("New", nil)),
+			},
+		},
+	}}
+
+	d, res := SnapshotDiff(from, to, nil)
+	if res != nil {
+		t.Fatalf("SnapshotDiff: %v", res)
+	}
+	if d.Summary != (AppDiffSummary{Added: 1, Deleted: 1, Modified: 1, Unchanged: 1}) {
+		t.Errorf("Summary = %+v", d.Summary)
+	}
+	if len(d.Objects) != 3 || d.Objects[0].Id != "t1" {
+		t.Fatalf("Objects = %s", util.JsonStr(d.Objects))
+	}
+	want := ObjectDiffSummary{Properties: 2, RowsAdded: 1, RowsModified: 1, CellsModified: 1}
+	if d.Objects[0].Summary != want {
+		t.Errorf("Objects[0].Summary = %+v, want %+v", d.Objects[0].Summary, want)
+	}
+
+	var buf bytes.Buffer
+	if res := d.WriteJSON(&buf); res != nil {
+		t.Fatalf("WriteJSON: %v", res)
+	}
+	var decoded AppDiff
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || decoded.Summary != d.Summary {
+		t.Errorf("WriteJSON() = %s, %v", buf.String(), err)
+	}
+	buf.Reset()
+	if res := d.WriteHTML(&buf, "v1 <> v2"); res != nil {
+		t.Fatalf("WriteHTML: %v", res)
+	}
+	for _, s := range []string{"v1 &lt;&gt; v2", "table/t1 - Revenue", "/title", "West"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("WriteHTML() doesn't contain %s", s)
+		}
+	}
+}
+
+func TestObjectSnapshot_DiffWithoutHyperCube(t *testing.T) {
+	if d, res := HyperCubeDiff("HyperCube", nil, nil); d != nil || res != nil {
+		t.Errorf("HyperCubeDiff(nil, nil) = %v, %v, want nil", d, res)
+	}
+	cube := straightCube([]any{"East", "100", 100.0})
+	if d, _ := HyperCubeDiff("HyperCube", nil, cube); d == nil || d.Type != util.DiffAdd {
+		t.Errorf("HyperCubeDiff(nil, cube) = %v", d)
+	}
+	if d, _ := HyperCubeDiff("HyperCube", cube, nil); d == nil || d.Type != util.DiffDel {
+		t.Errorf("HyperCubeDiff(cube, nil) = %v", d)
+	}
+
+	// master items have no hypercube, equal snapshots of them have no difference
+	measure := func() *ObjectSnapshot {
+		return &ObjectSnapshot{Title: util.Ptr("Sales"), Properties: json.RawMessage(`{"qMeasure":{"qDef":"Sum(Sales)"}}`)}
+	}
+	if d, res := measure().Diff(measure()); d != nil || res != nil {
+		t.Errorf("Diff() = %v, %v, want nil", d, res)
+	}
+}
+
+func TestReplaceAppId(t *testing.T) {
+	tests := []struct {
+		name  string
+		appId *string
+		want  string
+	}{
+		{"app id", util.Ptr("a1"), `{"url":"/app/__appid__"}`},
+		{"empty app id", util.Ptr(""), `{"url":"/app/a1"}`},
+		{"no app id", nil, `{"url":"/app/a1"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(replaceAppId([]byte(`{"url":"/app/a1"}`), tt.appId)); got != tt.want {
+				t.Errorf("replaceAppId() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,469 @@
+package engine
+
+import (
+	"cmp"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/soderasen-au/go-common/util"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	VARIABLE_FORMAT_YAML = "yaml"
+	VARIABLE_FORMAT_CSV  = "csv"
+
+	VARIABLE_CSV_TAG_SEPARATOR = ";"
+)
+
+// VariableCsvHeader are the columns of variable CSV files, only `name` and `definition` are required.
+var VariableCsvHeader = []string{"name", "definition", "comment", "tags"}
+
+// Variable is a variable of an app, variables are identified by name across apps.
+type Variable struct {
+	Id              string   `json:"id,omitempty" yaml:"id,omitempty"`
+	Name            string   `json:"name" yaml:"name"`
+	Definition      string   `json:"definition" yaml:"definition"`
+	Comment         string   `json:"comment,omitempty" yaml:"comment,omitempty"`
+	Tags            []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	IsScriptCreated bool     `json:"is_script_created,omitempty" yaml:"is_script_created,omitempty"`
+}
+
+type variableListData struct {
+	Name            string   `json:"name"`
+	Definition      string   `json:"definition"`
+	Comment         string   `json:"comment"`
+	Tags            []string `json:"tags"`
+	IsScriptCreated bool     `json:"isScriptCreated"`
+}
+
+var SessionVariableListDefData = []byte(`{"name": "/qName", "definition": "/qDefinition", "comment": "/qComment", "tags": "/tags", "isScriptCreated": "/qIsScriptCreated"}`)
+
+// GetVariables returns variables of doc ordered by name, reserved and config variables are excluded.
+func GetVariables(doc *enigma.Doc) ([]*Variable, *util.Result) {
+	return GetVariablesContext(ConnCtx, doc)
+}
+
+func GetVariablesContext(ctx context.Context, doc *enigma.Doc) ([]*Variable, *util.Result) {
+	prop := enigma.GenericObjectProperties{
+		Info: &enigma.NxInfo{Type: "VariableList"},
+		VariableListDef: &enigma.VariableListDef{
+			Type: "variable",
+			Data: SessionVariableListDefData,
+		},
+	}
+	obj, err := doc.CreateSessionObject(ctx, &prop)
+	if err != nil {
+		return nil, util.Error("CreateSessionObject", err)
+	}
+	// the session object is destroyed even if ctx is canceled
+	defer doc.DestroySessionObject(context.WithoutCancel(ctx), obj.GenericId)
+	layoutBuf, err := obj.GetLayoutRaw(ctx)
+	if err != nil {
+		return nil, util.Error("GetLayoutRaw", err)
+	}
+
+	var layout struct {
+		VariableList *struct {
+			Items []*enigma.NxVariableListItem `json:"qItems"`
+		} `json:"qVariableList"`
+	}
+	if err = json.Unmarshal(layoutBuf, &layout); err != nil {
+		return nil, util.Error("ParseLayout", err)
+	}
+	ret := make([]*Variable, 0)
+	if layout.VariableList == nil {
+		return ret, nil
+	}
+	for i, item := range layout.VariableList.Items {
+		var data variableListData
+		if len(item.Data) > 0 {
+			if err = json.Unmarshal(item.Data, &data); err != nil {
+				return nil, util.Errorf("ParseVariable[%d]: %s", i, err.Error())
+			}
+		}
+		v := &Variable{
+			Name:            cmp.Or(item.Name, data.Name),
+			Definition:      cmp.Or(item.Definition, data.Definition),
+			Comment:         cmp.Or(item.Description, data.Comment),
+			Tags:            data.Tags,
+			IsScriptCreated: item.IsScriptCreated || data.IsScriptCreated,
+		}
+		if item.Info != nil {
+			v.Id = item.Info.Id
+		}
+		ret = append(ret, v)
+	}
+	slices.SortFunc(ret, func(a, b *Variable) int { return strings.Compare(a.Name, b.Name) })
+	return ret, nil
+}
+
+// CreateVariable creates v in doc and returns its id.
+func CreateVariable(doc *enigma.Doc, v *Variable) (string, *util.Result) {
+	return CreateVariableContext(ConnCtx, doc, v)
+}
+
+func CreateVariableContext(ctx context.Context, doc *enigma.Doc, v *Variable) (string, *util.Result) {
+	if v.Name == "" {
+		return "", util.MsgError("CreateVariable", "variable without name")
+	}
+	props := map[string]any{
+		"qInfo":       &enigma.NxInfo{Id: v.Id, Type: "variable"},
+		"qName":       v.Name,
+		"qDefinition": v.Definition,
+		"qComment":    v.Comment,
+	}
+	if len(v.Tags) > 0 {
+		props["tags"] = v.Tags
+	}
+	obj, err := doc.CreateVariableExRaw(ctx, props)
+	if err != nil {
+		return "", util.Error("CreateVariableEx", err)
+	}
+	return obj.GenericId, nil
+}
+
+// updateVariableProperties calls update with properties of variable name and sets them back,
+// properties without a field in Variable are kept.
+func updateVariableProperties(ctx context.Context, doc *enigma.Doc, name string, update func(props map[string]any) *util.Result) *util.Result {
+	obj, err := doc.GetVariableByName(ctx, name)
+	if err != nil {
+		return util.Error("GetVariableByName", err)
+	}
+	raw, err := obj.GetPropertiesRaw(ctx)
+	if err != nil {
+		return util.Error("GetPropertiesRaw", err)
+	}
+	props := make(map[string]any)
+	if err = json.Unmarshal(raw, &props); err != nil {
+		return util.Error("ParseProperties", err)
+	}
+	if res := update(props); res != nil {
+		return res
+	}
+	if err = obj.SetPropertiesRaw(ctx, props); err != nil {
+		return util.Error("SetPropertiesRaw", err)
+	}
+	return nil
+}
+
+// UpdateVariable sets definition, comment and tags of variable v.Name.
+func UpdateVariable(doc *enigma.Doc, v *Variable) *util.Result {
+	return UpdateVariableContext(ConnCtx, doc, v)
+}
+
+func UpdateVariableContext(ctx context.Context, doc *enigma.Doc, v *Variable) *util.Result {
+	return updateVariableProperties(ctx, doc, v.Name, func(props map[string]any) *util.Result {
+		props["qDefinition"] = v.Definition
+		props["qComment"] = v.Comment
+		if len(v.Tags) > 0 {
+			props["tags"] = v.Tags
+		} else {
+			delete(props, "tags")
+		}
+		return nil
+	})
+}
+
+func RenameVariable(doc *enigma.Doc, name, newName string) *util.Result {
+	return RenameVariableContext(ConnCtx, doc, name, newName)
+}
+
+func RenameVariableContext(ctx context.Context, doc *enigma.Doc, name, newName string) *util.Result {
+	if newName == "" {
+		return util.MsgError("RenameVariable", "empty name")
+	}
+	if _, err := doc.GetVariableByName(ctx, newName); err == nil {
+		return util.MsgError("RenameVariable", fmt.Sprintf("variable %s already exists", newName))
+	}
+	return updateVariableProperties(ctx, doc, name, func(props map[string]any) *util.Result {
+		props["qName"] = newName
+		return nil
+	})
+}
+
+func DeleteVariable(doc *enigma.Doc, name string) *util.Result {
+	return DeleteVariableContext(ConnCtx, doc, name)
+}
+
+func DeleteVariableContext(ctx context.Context, doc *enigma.Doc, name string) *util.Result {
+	obj, err := doc.GetVariableByName(ctx, name)
+	if err != nil {
+		return util.Error("GetVariableByName", err)
+	}
+	ok, err := doc.DestroyVariableById(ctx, obj.GenericId)
+	if err != nil {
+		return util.Error("DestroyVariableById", err)
+	}
+	if !ok {
+		return util.MsgError("DestroyVariableById", fmt.Sprintf("variable %s not destroyed", name))
+	}
+	return nil
+}
+
+// MarkVariablesScriptCreated defines variables names with their current definitions by `SET` statements
+// of the load script, see `Script.SetVariable`. The engine reports them as script-created after the next reload.
+func MarkVariablesScriptCreated(doc *enigma.Doc, names ...string) *util.Result {
+	return MarkVariablesScriptCreatedContext(ConnCtx, doc, names...)
+}
+
+func MarkVariablesScriptCreatedContext(ctx context.Context, doc *enigma.Doc, names ...string) *util.Result {
+	script, res := GetScriptContext(ctx, doc)
+	if res != nil {
+		return res.With("GetScript")
+	}
+	for _, name := range names {
+		obj, err := doc.GetVariableByName(ctx, name)
+		if err != nil {
+			return util.Error("GetVariableByName", err)
+		}
+		props, err := obj.GetProperties(ctx)
+		if err != nil {
+			return util.Error("GetProperties", err)
+		}
+		if strings.Contains(props.Definition, ";") {
+			return util.MsgError("MarkVariablesScriptCreated", fmt.Sprintf("definition of %s can't be set by the script", name))
+		}
+		script.SetVariable(name, props.Definition)
+	}
+	if res = SetScriptContext(ctx, doc, script); res != nil {
+		return res.With("SetScript")
+	}
+	return nil
+}
+
+// ReadVariables reads variables in format VARIABLE_FORMAT_YAML, a list of `Variable`,
+// or VARIABLE_FORMAT_CSV with VariableCsvHeader columns in any order.
+func ReadVariables(r io.Reader, format string) ([]*Variable, *util.Result) {
+	var vars []*Variable
+	switch format {
+	case VARIABLE_FORMAT_YAML:
+		if err := yaml.NewDecoder(r).Decode(&vars); err != nil && err != io.EOF {
+			return nil, util.Error("DecodeYaml", err)
+		}
+	case VARIABLE_FORMAT_CSV:
+		records, err := csv.NewReader(r).ReadAll()
+		if err != nil {
+			return nil, util.Error("ReadCsv", err)
+		}
+		if len(records) == 0 {
+			return nil, util.MsgError("ReadCsv", "no header")
+		}
+		cols := make(map[string]int)
+		for i, h := range records[0] {
+			cols[strings.ToLower(strings.TrimSpace(h))] = i
+		}
+		if _, ok := cols["name"]; !ok {
+			return nil, util.MsgError("ReadCsv", "no name column")
+		}
+		if _, ok := cols["definition"]; !ok {
+			return nil, util.MsgError("ReadCsv", "no definition column")
+		}
+		cell := func(rec []string, col string) string {
+			if i, ok := cols[col]; ok && i < len(rec) {
+				return rec[i]
+			}
+			return ""
+		}
+		for _, rec := range records[1:] {
+			v := &Variable{Name: cell(rec, "name"), Definition: cell(rec, "definition"), Comment: cell(rec, "comment")}
+			for _, tag := range strings.Split(cell(rec, "tags"), VARIABLE_CSV_TAG_SEPARATOR) {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					v.Tags = append(v.Tags, tag)
+				}
+			}
+			vars = append(vars, v)
+		}
+	default:
+		return nil, util.MsgError("ReadVariables", fmt.Sprintf("unknown format `%s`", format))
+	}
+
+	names := make(map[string]bool)
+	for i, v := range vars {
+		if v == nil || v.Name == "" {
+			return nil, util.MsgError("ReadVariables", fmt.Sprintf("variable[%d] has no name", i))
+		}
+		if names[v.Name] {
+			return nil, util.MsgError("ReadVariables", fmt.Sprintf("duplicate variable %s", v.Name))
+		}
+		names[v.Name] = true
+	}
+	return vars, nil
+}
+
+// WriteVariables writes vars in format without ids, which differ between apps.
+func WriteVariables(w io.Writer, vars []*Variable, format string) *util.Result {
+	switch format {
+	case VARIABLE_FORMAT_YAML:
+		out := make([]Variable, 0, len(vars))
+		for _, v := range vars {
+			c := *v
+			c.Id = ""
+			out = append(out, c)
+		}
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(out); err != nil {
+			return util.Error("EncodeYaml", err)
+		}
+		if err := enc.Close(); err != nil {
+			return util.Error("EncodeYaml", err)
+		}
+	case VARIABLE_FORMAT_CSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(VariableCsvHeader); err != nil {
+			return util.Error("WriteCsv", err)
+		}
+		for _, v := range vars {
+			if err := cw.Write([]string{v.Name, v.Definition, v.Comment, strings.Join(v.Tags, VARIABLE_CSV_TAG_SEPARATOR)}); err != nil {
+				return util.Error("WriteCsv", err)
+			}
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return util.Error("WriteCsv", err)
+		}
+	default:
+		return util.MsgError("WriteVariables", fmt.Sprintf("unknown format `%s`", format))
+	}
+	return nil
+}
+
+// ExportVariables writes variables of doc in format, see `WriteVariables`.
+func ExportVariables(doc *enigma.Doc, w io.Writer, format string) *util.Result {
+	return ExportVariablesContext(ConnCtx, doc, w, format)
+}
+
+func ExportVariablesContext(ctx context.Context, doc *enigma.Doc, w io.Writer, format string) *util.Result {
+	vars, res := GetVariablesContext(ctx, doc)
+	if res != nil {
+		return res.With("GetVariables")
+	}
+	if res = WriteVariables(w, vars, format); res != nil {
+		return res.With("WriteVariables")
+	}
+	return nil
+}
+
+type (
+	// VariableChange is a variable to create (util.DiffAdd), update (util.DiffMod) or delete (util.DiffDel).
+	VariableChange struct {
+		Name   string    `json:"name" yaml:"name"`
+		Change string    `json:"change" yaml:"change"`
+		Fields []string  `json:"fields,omitempty" yaml:"fields,omitempty"` // changed fields of util.DiffMod
+		From   *Variable `json:"from,omitempty" yaml:"from,omitempty"`
+		To     *Variable `json:"to,omitempty" yaml:"to,omitempty"`
+	}
+
+	// VariableDiff lists changes from variables of an app to imported ones, ordered by name.
+	VariableDiff struct {
+		Changes   []*VariableChange `json:"changes" yaml:"changes"`
+		Unchanged int               `json:"unchanged" yaml:"unchanged"`
+	}
+
+	VariableImportOptions struct {
+		Prune  bool `json:"prune,omitempty" yaml:"prune,omitempty" bson:"prune,omitempty"`       // delete variables not imported, except script-created ones
+		DryRun bool `json:"dry_run,omitempty" yaml:"dry_run,omitempty" bson:"dry_run,omitempty"` // only return the diff
+	}
+)
+
+// DiffVariables compares variables from, usually of an app, with variables to by name.
+// Variables only in from are deleted if prune is set, script-created ones are recreated by reloads
+// and never deleted.
+func DiffVariables(from, to []*Variable, prune bool) *VariableDiff {
+	ret := &VariableDiff{Changes: make([]*VariableChange, 0)}
+	fromByName := make(map[string]*Variable, len(from))
+	for _, v := range from {
+		fromByName[v.Name] = v
+	}
+	toNames := make(map[string]bool, len(to))
+	for _, v := range to {
+		toNames[v.Name] = true
+		cur, ok := fromByName[v.Name]
+		if !ok {
+			ret.Changes = append(ret.Changes, &VariableChange{Name: v.Name, Change: util.DiffAdd, To: v})
+			continue
+		}
+		fields := make([]string, 0)
+		if cur.Definition != v.Definition {
+			fields = append(fields, "definition")
+		}
+		if cur.Comment != v.Comment {
+			fields = append(fields, "comment")
+		}
+		if !slices.Equal(cur.Tags, v.Tags) {
+			fields = append(fields, "tags")
+		}
+		if len(fields) == 0 {
+			ret.Unchanged++
+			continue
+		}
+		ret.Changes = append(ret.Changes, &VariableChange{Name: v.Name, Change: util.DiffMod, Fields: fields, From: cur, To: v})
+	}
+	if prune {
+		for _, v := range from {
+			if !toNames[v.Name] && !v.IsScriptCreated {
+				ret.Changes = append(ret.Changes, &VariableChange{Name: v.Name, Change: util.DiffDel, From: v})
+			}
+		}
+	}
+	slices.SortFunc(ret.Changes, func(a, b *VariableChange) int { return strings.Compare(a.Name, b.Name) })
+	return ret
+}
+
+// ApplyVariableDiff makes changes of diff to doc in order and stops at the first failure.
+// Definitions of script-created variables are reset by the next reload.
+func ApplyVariableDiff(doc *enigma.Doc, diff *VariableDiff) *util.Result {
+	return ApplyVariableDiffContext(ConnCtx, doc, diff)
+}
+
+func ApplyVariableDiffContext(ctx context.Context, doc *enigma.Doc, diff *VariableDiff) *util.Result {
+	for _, c := range diff.Changes {
+		var res *util.Result
+		switch c.Change {
+		case util.DiffAdd:
+			_, res = CreateVariableContext(ctx, doc, &Variable{Name: c.Name, Definition: c.To.Definition, Comment: c.To.Comment, Tags: c.To.Tags})
+		case util.DiffMod:
+			res = UpdateVariableContext(ctx, doc, c.To)
+		case util.DiffDel:
+			res = DeleteVariableContext(ctx, doc, c.Name)
+		default:
+			res = util.MsgError("ApplyVariableDiff", fmt.Sprintf("unknown change `%s`", c.Change))
+		}
+		if res != nil {
+			return res.With(c.Change + " " + c.Name)
+		}
+	}
+	return nil
+}
+
+// ImportVariables reads variables from r in format and applies the diff to variables of doc,
+// unless opts.DryRun. It returns the diff.
+func ImportVariables(doc *enigma.Doc, r io.Reader, format string, opts VariableImportOptions) (*VariableDiff, *util.Result) {
+	return ImportVariablesContext(ConnCtx, doc, r, format, opts)
+}
+
+func ImportVariablesContext(ctx context.Context, doc *enigma.Doc, r io.Reader, format string, opts VariableImportOptions) (*VariableDiff, *util.Result) {
+	vars, res := ReadVariables(r, format)
+	if res != nil {
+		return nil, res.With("ReadVariables")
+	}
+	cur, res := GetVariablesContext(ctx, doc)
+	if res != nil {
+		return nil, res.With("GetVariables")
+	}
+	diff := DiffVariables(cur, vars, opts.Prune)
+	if opts.DryRun {
+		return diff, nil
+	}
+	if res = ApplyVariableDiffContext(ctx, doc, diff); res != nil {
+		return diff, res.With("ApplyVariableDiff")
+	}
+	return diff, nil
+}
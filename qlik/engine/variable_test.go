@@ -0,0 +1,184 @@
+package engine_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/soderasen-au/go-common/util"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+	"github.com/soderasen-au/go-qlik/qlik/engine/enginetest"
+)
+
+func TestReadWriteVariables(t *testing.T) {
+	vars := []*engine.Variable{
+		{Id: "v1", Name: "vDb", Definition: "PROD_DB", Comment: "database, by env", Tags: []string{"env", "db"}},
+		{Name: "vThreshold", Definition: "=0.8"},
+	}
+	for _, format := range []string{engine.VARIABLE_FORMAT_YAML, engine.VARIABLE_FORMAT_CSV} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if res := engine.WriteVariables(&buf, vars, format); res != nil {
+				t.Fatalf("WriteVariables: %v", res)
+			}
+			if strings.Contains(buf.String(), "v1") {
+				t.Errorf("id written: %s", buf.String())
+			}
+			got, res := engine.ReadVariables(&buf, format)
+			if res != nil {
+				t.Fatalf("ReadVariables: %v", res)
+			}
+			if len(got) != 2 || got[0].Name != "vDb" || got[0].Comment != "database, by env" ||
+				!reflect.DeepEqual(got[0].Tags, vars[0].Tags) || got[1].Definition != "=0.8" || got[1].Tags != nil {
+				t.Errorf("variables = %s", util.JsonStr(got))
+			}
+		})
+	}
+
+	tests := []struct {
+		name   string
+		format string
+		input  string
+	}{
+		{"unknown format", "json", `[]`},
+		{"csv without definition", engine.VARIABLE_FORMAT_CSV, "name,comment\nvDb,x\n"},
+		{"csv without name", engine.VARIABLE_FORMAT_CSV, "definition,name\n1,\n"},
+		{"yaml duplicate", engine.VARIABLE_FORMAT_YAML, "- name: vDb\n  definition: a\n- name: vDb\n  definition: b\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, res := engine.ReadVariables(strings.NewReader(tt.input), tt.format); res == nil {
+				t.Errorf("ReadVariables succeeded")
+			}
+		})
+	}
+}
+
+func TestDiffVariables(t *testing.T) {
+	from := []*engine.Variable{
+		{Name: "vDb", Definition: "DEV_DB"},
+		{Name: "vSame", Definition: "1", Tags: []string{"a"}},
+		{Name: "vOld", Definition: "x"},
+		{Name: "vScript", Definition: "y", IsScriptCreated: true},
+	}
+	to := []*engine.Variable{
+		{Name: "vSame", Definition: "1", Tags: []string{"a"}},
+		{Name: "vDb", Definition: "PROD_DB", Comment: "db"},
+		{Name: "vNew", Definition: "2"},
+	}
+	tests := []struct {
+		name  string
+		prune bool
+		want  []string
+	}{
+		{"keep", false, []string{"vDb:mod:definition,comment", "vNew:add:"}},
+		{"prune", true, []string{"vDb:mod:definition,comment", "vNew:add:", "vOld:del:"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := engine.DiffVariables(from, to, tt.prune)
+			got := make([]string, 0)
+			for _, c := range diff.Changes {
+				got = append(got, c.Name+":"+c.Change+":"+strings.Join(c.Fields, ","))
+			}
+			want := make([]string, 0)
+			for _, w := range tt.want {
+				name, rest, _ := strings.Cut(w, ":")
+				change, fields, _ := strings.Cut(rest, ":")
+				want = append(want, name+":"+map[string]string{"add": util.DiffAdd, "mod": util.DiffMod, "del": util.DiffDel}[change]+":"+fields)
+			}
+			if !reflect.DeepEqual(got, want) || diff.Unchanged != 1 {
+				t.Errorf("changes = %v, unchanged = %d, want %v", got, diff.Unchanged, want)
+			}
+		})
+	}
+}
+
+func TestFake_Variables(t *testing.T) {
+	_, doc := enginetest.OpenDoc(t, enginetest.SalesFixture())
+	ctx := engine.ConnCtx
+
+	names := func() string {
+		vars, res := engine.GetVariables(doc)
+		if res != nil {
+			t.Fatalf("GetVariables: %v", res)
+		}
+		ret := make([]string, 0)
+		for _, v := range vars {
+			ret = append(ret, v.Name+"="+v.Definition)
+		}
+		return strings.Join(ret, ",")
+	}
+	if got := names(); got != "vCurrentYear==Max(Year),vMarginRate=0.25,vTitle=Sales Overview" {
+		t.Fatalf("variables = %s", got)
+	}
+
+	if _, res := engine.CreateVariable(doc, &engine.Variable{Name: "vDb", Definition: "DEV_DB", Tags: []string{"env"}}); res != nil {
+		t.Fatalf("CreateVariable: %v", res)
+	}
+	if res := engine.RenameVariable(doc, "vTitle", "vHeader"); res != nil {
+		t.Fatalf("RenameVariable: %v", res)
+	}
+	if res := engine.RenameVariable(doc, "vHeader", "vDb"); res == nil {
+		t.Errorf("RenameVariable to an existing name succeeded")
+	}
+	if res := engine.DeleteVariable(doc, "vCurrentYear"); res != nil {
+		t.Fatalf("DeleteVariable: %v", res)
+	}
+	if res := engine.DeleteVariable(doc, "vMissing"); res == nil {
+		t.Errorf("DeleteVariable of a missing variable succeeded")
+	}
+	if got := names(); got != "vDb=DEV_DB,vHeader=Sales Overview,vMarginRate=0.25" {
+		t.Errorf("variables = %s", got)
+	}
+
+	input := "name,definition,comment,tags\nvDb,PROD_DB,,env\nvThreshold,0.8,alert level,\n"
+	diff, res := engine.ImportVariables(doc, strings.NewReader(input), engine.VARIABLE_FORMAT_CSV, engine.VariableImportOptions{Prune: true, DryRun: true})
+	if res != nil {
+		t.Fatalf("ImportVariables: %v", res)
+	}
+	if len(diff.Changes) != 4 || diff.Unchanged != 0 {
+		t.Errorf("diff = %s", util.JsonStr(diff))
+	}
+	if got := names(); got != "vDb=DEV_DB,vHeader=Sales Overview,vMarginRate=0.25" {
+		t.Errorf("dry run changed variables: %s", got)
+	}
+	if _, res = engine.ImportVariables(doc, strings.NewReader(input), engine.VARIABLE_FORMAT_CSV, engine.VariableImportOptions{Prune: true}); res != nil {
+		t.Fatalf("ImportVariables: %v", res)
+	}
+	if got := names(); got != "vDb=PROD_DB,vThreshold=0.8" {
+		t.Errorf("variables = %s", got)
+	}
+	var buf bytes.Buffer
+	if res := engine.ExportVariables(doc, &buf, engine.VARIABLE_FORMAT_YAML); res != nil {
+		t.Fatalf("ExportVariables: %v", res)
+	}
+	if !strings.Contains(buf.String(), "comment: alert level") || !strings.Contains(buf.String(), "- env") {
+		t.Errorf("export = %s", buf.String())
+	}
+
+	if res := engine.MarkVariablesScriptCreated(doc, "vDb"); res != nil {
+		t.Fatalf("MarkVariablesScriptCreated: %v", res)
+	}
+	script, res := engine.GetScript(doc)
+	if res != nil {
+		t.Fatalf("GetScript: %v", res)
+	}
+	if sec := script.Section(engine.SCRIPT_OVERRIDES_TAB); sec == nil || !strings.Contains(sec.Body, "SET vDb = PROD_DB;") {
+		t.Errorf("script = %s", script)
+	}
+	if _, err := doc.DoReload(ctx, 0, false, false); err != nil {
+		t.Fatalf("DoReload: %v", err)
+	}
+	vars, res := engine.GetVariables(doc)
+	if res != nil {
+		t.Fatalf("GetVariables: %v", res)
+	}
+	for _, v := range vars {
+		if v.Name == "vDb" && !v.IsScriptCreated || v.Name == "vThreshold" && v.IsScriptCreated {
+			t.Errorf("variable = %s", util.JsonStr(v))
+		}
+	}
+}
@@ -0,0 +1,422 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/soderasen-au/go-common/util"
+)
+
+// VizProperties are typed properties of an object, see `ParseVizProperties`.
+type VizProperties interface {
+	GetInfo() *enigma.NxInfo
+	GetTitle() string
+	GetDescription() string
+	GetDimensions() []*enigma.NxDimension
+	GetMeasures() []*enigma.NxMeasure
+	// GetShowCondition returns the show condition, or the calculation condition of the hypercube.
+	GetShowCondition() string
+}
+
+// MetaDef is `qMetaDef` of properties, where sheets and master items keep their titles.
+type MetaDef struct {
+	RawProperties
+	Title       string   `json:"title,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+}
+
+func (p *MetaDef) UnmarshalJSON(b []byte) error { return unmarshalProperties(b, p) }
+func (p MetaDef) MarshalJSON() ([]byte, error)  { return marshalProperties(&p) }
+
+// VisualizationProperties are properties shared by objects, it's embedded by the typed properties
+// and used for objects of other types.
+type VisualizationProperties struct {
+	RawProperties
+	Info          *enigma.NxInfo       `json:"qInfo,omitempty"`
+	ExtendsId     string               `json:"qExtendsId,omitempty"`
+	MetaDef       *MetaDef             `json:"qMetaDef,omitempty"`
+	StateName     string               `json:"qStateName,omitempty"`
+	Visualization string               `json:"visualization,omitempty"`
+	Title         *StringOrExpr        `json:"title,omitempty"`
+	Subtitle      *StringOrExpr        `json:"subtitle,omitempty"`
+	Footnote      *StringOrExpr        `json:"footnote,omitempty"`
+	Description   *StringOrExpr        `json:"description,omitempty"`
+	ShowTitles    *bool                `json:"showTitles,omitempty"`
+	ShowCondition *StringOrExpr        `json:"showCondition,omitempty"`
+	HyperCubeDef  *enigma.HyperCubeDef `json:"qHyperCubeDef,omitempty"`
+}
+
+func (p *VisualizationProperties) UnmarshalJSON(b []byte) error { return unmarshalProperties(b, p) }
+func (p VisualizationProperties) MarshalJSON() ([]byte, error)  { return marshalProperties(&p) }
+
+func (p *VisualizationProperties) GetInfo() *enigma.NxInfo {
+	return p.Info
+}
+
+// GetTitle returns title of `qMetaDef` or `title`, like `GetTitle`.
+func (p *VisualizationProperties) GetTitle() string {
+	if p.MetaDef != nil && p.MetaDef.Title != "" {
+		return p.MetaDef.Title
+	}
+	return p.Title.String()
+}
+
+func (p *VisualizationProperties) GetDescription() string {
+	if p.MetaDef != nil && p.MetaDef.Description != "" {
+		return p.MetaDef.Description
+	}
+	return p.Description.String()
+}
+
+func (p *VisualizationProperties) GetDimensions() []*enigma.NxDimension {
+	if p.HyperCubeDef == nil {
+		return nil
+	}
+	return p.HyperCubeDef.Dimensions
+}
+
+func (p *VisualizationProperties) GetMeasures() []*enigma.NxMeasure {
+	if p.HyperCubeDef == nil {
+		return nil
+	}
+	return p.HyperCubeDef.Measures
+}
+
+func (p *VisualizationProperties) GetShowCondition() string {
+	if c := p.ShowCondition.String(); c != "" {
+		return c
+	}
+	if p.HyperCubeDef == nil {
+		return ""
+	}
+	if cc := p.HyperCubeDef.CalcCondition; cc != nil && cc.Cond != nil && cc.Cond.V != "" {
+		return cc.Cond.V
+	}
+	if p.HyperCubeDef.CalcCond != nil {
+		return p.HyperCubeDef.CalcCond.V
+	}
+	return ""
+}
+
+type SheetCellBounds struct {
+	Y      float64 `json:"y"`
+	X      float64 `json:"x"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+type SheetCell struct {
+	RawProperties
+	Name    string           `json:"name"`
+	Type    string           `json:"type"`
+	Col     *int             `json:"col,omitempty"`
+	Row     *int             `json:"row,omitempty"`
+	ColSpan *int             `json:"colspan,omitempty"`
+	RowSpan *int             `json:"rowspan,omitempty"`
+	Bounds  *SheetCellBounds `json:"bounds,omitempty"`
+}
+
+func (p *SheetCell) UnmarshalJSON(b []byte) error { return unmarshalProperties(b, p) }
+func (p SheetCell) MarshalJSON() ([]byte, error)  { return marshalProperties(&p) }
+
+type SheetProperties struct {
+	VisualizationProperties
+	Rank    *float64     `json:"rank,omitempty"`
+	Columns *int         `json:"columns,omitempty"` // grid size
+	Rows    *int         `json:"rows,omitempty"`
+	Cells   []*SheetCell `json:"cells,omitempty"`
+}
+
+func (p *SheetProperties) UnmarshalJSON(b []byte) error { return unmarshalProperties(b, p) }
+func (p SheetProperties) MarshalJSON() ([]byte, error)  { return marshalProperties(&p) }
+
+// CellIds returns ids of objects on the sheet in cell order.
+func (p *SheetProperties) CellIds() []string {
+	ids := make([]string, 0, len(p.Cells))
+	for _, c := range p.Cells {
+		ids = append(ids, c.Name)
+	}
+	return ids
+}
+
+type TableTotals struct {
+	RawProperties
+	Show     *bool  `json:"show,omitempty"`
+	Position string `json:"position,omitempty"`
+	Label    string `json:"label,omitempty"`
+}
+
+func (p *TableTotals) UnmarshalJSON(b []byte) error { return unmarshalProperties(b, p) }
+func (p TableTotals) MarshalJSON() ([]byte, error)  { return marshalProperties(&p) }
+
+// TableProperties are properties of `table` and `sn-table`.
+type TableProperties struct {
+	VisualizationProperties
+	Totals *TableTotals `json:"totals,omitempty"`
+}
+
+func (p *TableProperties) UnmarshalJSON(b []byte) error { return unmarshalProperties(b, p) }
+func (p TableProperties) MarshalJSON() ([]byte, error)  { return marshalProperties(&p) }
+
+// PivotTableProperties are properties of `pivot-table` and `sn-pivot-table`.
+type PivotTableProperties struct {
+	VisualizationProperties
+}
+
+func (p *PivotTableProperties) UnmarshalJSON(b []byte) error { return unmarshalProperties(b, p) }
+func (p PivotTableProperties) MarshalJSON() ([]byte, error)  { return marshalProperties(&p) }
+
+// LeftDimensions returns dimensions of rows, the others are dimensions of columns.
+func (p *PivotTableProperties) LeftDimensions() []*enigma.NxDimension {
+	dims := p.GetDimensions()
+	if p.HyperCubeDef == nil || p.HyperCubeDef.NoOfLeftDims == nil {
+		return dims
+	}
+	return dims[:min(max(*p.HyperCubeDef.NoOfLeftDims, 0), len(dims))]
+}
+
+type ContainerChild struct {
+	RawProperties
+	RefId             string        `json:"refId"`
+	Label             *StringOrExpr `json:"label,omitempty"`
+	IsMaster          bool          `json:"isMaster,omitempty"`
+	ExternalReference *MasterRef    `json:"externalReference,omitempty"`
+	ShowCondition     *StringOrExpr `json:"showCondition,omitempty"`
+	CId               string        `json:"cId,omitempty"`
+}
+
+func (p *ContainerChild) UnmarshalJSON(b []byte) error { return unmarshalProperties(b, p) }
+func (p ContainerChild) MarshalJSON() ([]byte, error)  { return marshalProperties(&p) }
+
+// MasterRef refers to a master visualization of a container child.
+type MasterRef struct {
+	MasterItemId string `json:"masterItemId,omitempty"`
+	ViewId       string `json:"viewId,omitempty"`
+	VisType      string `json:"visType,omitempty"`
+}
+
+// ContainerProperties are properties of `container` and `sn-tabbed-container`.
+type ContainerProperties struct {
+	VisualizationProperties
+	Children   []*ContainerChild `json:"children,omitempty"`
+	ShowTabs   *bool             `json:"showTabs,omitempty"`
+	DefaultTab string            `json:"defaultTab,omitempty"`
+}
+
+func (p *ContainerProperties) UnmarshalJSON(b []byte) error { return unmarshalProperties(b, p) }
+func (p ContainerProperties) MarshalJSON() ([]byte, error)  { return marshalProperties(&p) }
+
+func (p *ContainerProperties) Child(refId string) *ContainerChild {
+	for _, c := range p.Children {
+		if c.RefId == refId {
+			return c
+		}
+	}
+	return nil
+}
+
+// FilterPaneProperties are properties of `filterpane`, its fields are its `listbox` children.
+type FilterPaneProperties struct {
+	VisualizationProperties
+}
+
+func (p *FilterPaneProperties) UnmarshalJSON(b []byte) error { return unmarshalProperties(b, p) }
+func (p FilterPaneProperties) MarshalJSON() ([]byte, error)  { return marshalProperties(&p) }
+
+type ListboxProperties struct {
+	VisualizationProperties
+	ListObjectDef *enigma.ListObjectDef `json:"qListObjectDef,omitempty"`
+}
+
+func (p *ListboxProperties) UnmarshalJSON(b []byte) error { return unmarshalProperties(b, p) }
+func (p ListboxProperties) MarshalJSON() ([]byte, error)  { return marshalProperties(&p) }
+
+// GetDimensions returns the dimension of the list object.
+func (p *ListboxProperties) GetDimensions() []*enigma.NxDimension {
+	if p.ListObjectDef == nil {
+		return nil
+	}
+	return []*enigma.NxDimension{{LibraryId: p.ListObjectDef.LibraryId, Def: p.ListObjectDef.Def}}
+}
+
+type KpiProperties struct {
+	VisualizationProperties
+	ShowMeasureTitle *bool  `json:"showMeasureTitle,omitempty"`
+	TextAlign        string `json:"textAlign,omitempty"`
+}
+
+func (p *KpiProperties) UnmarshalJSON(b []byte) error { return unmarshalProperties(b, p) }
+func (p KpiProperties) MarshalJSON() ([]byte, error)  { return marshalProperties(&p) }
+
+type BarGrouping struct {
+	RawProperties
+	Grouping string `json:"grouping,omitempty"` // `grouped` or `stacked`
+}
+
+func (p *BarGrouping) UnmarshalJSON(b []byte) error { return unmarshalProperties(b, p) }
+func (p BarGrouping) MarshalJSON() ([]byte, error)  { return marshalProperties(&p) }
+
+// ChartProperties are properties of `barchart`, `linechart` and `combochart`.
+type ChartProperties struct {
+	VisualizationProperties
+	Orientation string       `json:"orientation,omitempty"`
+	BarGrouping *BarGrouping `json:"barGrouping,omitempty"`
+}
+
+func (p *ChartProperties) UnmarshalJSON(b []byte) error { return unmarshalProperties(b, p) }
+func (p ChartProperties) MarshalJSON() ([]byte, error)  { return marshalProperties(&p) }
+
+type TextImageProperties struct {
+	VisualizationProperties
+	Markdown string `json:"markdown,omitempty"`
+}
+
+func (p *TextImageProperties) UnmarshalJSON(b []byte) error { return unmarshalProperties(b, p) }
+func (p TextImageProperties) MarshalJSON() ([]byte, error)  { return marshalProperties(&p) }
+
+type ButtonStyle struct {
+	RawProperties
+	Label *StringOrExpr `json:"label,omitempty"`
+}
+
+func (p *ButtonStyle) UnmarshalJSON(b []byte) error { return unmarshalProperties(b, p) }
+func (p ButtonStyle) MarshalJSON() ([]byte, error)  { return marshalProperties(&p) }
+
+type ButtonAction struct {
+	RawProperties
+	ActionType string `json:"actionType"`
+	Bookmark   string `json:"bookmark,omitempty"`
+	Field      string `json:"field,omitempty"`
+	Value      string `json:"value,omitempty"`
+	Variable   string `json:"variable,omitempty"`
+	CId        string `json:"cId,omitempty"`
+}
+
+func (p *ButtonAction) UnmarshalJSON(b []byte) error { return unmarshalProperties(b, p) }
+func (p ButtonAction) MarshalJSON() ([]byte, error)  { return marshalProperties(&p) }
+
+type ButtonNavigation struct {
+	RawProperties
+	Action     string `json:"action,omitempty"`
+	Sheet      string `json:"sheet,omitempty"`
+	WebsiteUrl string `json:"websiteUrl,omitempty"`
+}
+
+func (p *ButtonNavigation) UnmarshalJSON(b []byte) error { return unmarshalProperties(b, p) }
+func (p ButtonNavigation) MarshalJSON() ([]byte, error)  { return marshalProperties(&p) }
+
+// ButtonProperties are properties of `action-button`.
+type ButtonProperties struct {
+	VisualizationProperties
+	Style      *ButtonStyle      `json:"style,omitempty"`
+	Actions    []*ButtonAction   `json:"actions,omitempty"`
+	Navigation *ButtonNavigation `json:"navigation,omitempty"`
+}
+
+func (p *ButtonProperties) UnmarshalJSON(b []byte) error { return unmarshalProperties(b, p) }
+func (p ButtonProperties) MarshalJSON() ([]byte, error)  { return marshalProperties(&p) }
+
+// GetTitle returns the title, or the label of the button.
+func (p *ButtonProperties) GetTitle() string {
+	if t := p.VisualizationProperties.GetTitle(); t != "" {
+		return t
+	}
+	if p.Style != nil {
+		return p.Style.Label.String()
+	}
+	return ""
+}
+
+var vizPropertiesTypes = map[string]func() VizProperties{
+	"sheet":               func() VizProperties { return &SheetProperties{} },
+	"table":               func() VizProperties { return &TableProperties{} },
+	"sn-table":            func() VizProperties { return &TableProperties{} },
+	"pivot-table":         func() VizProperties { return &PivotTableProperties{} },
+	"sn-pivot-table":      func() VizProperties { return &PivotTableProperties{} },
+	"container":           func() VizProperties { return &ContainerProperties{} },
+	"sn-tabbed-container": func() VizProperties { return &ContainerProperties{} },
+	"filterpane":          func() VizProperties { return &FilterPaneProperties{} },
+	"listbox":             func() VizProperties { return &ListboxProperties{} },
+	"kpi":                 func() VizProperties { return &KpiProperties{} },
+	"barchart":            func() VizProperties { return &ChartProperties{} },
+	"linechart":           func() VizProperties { return &ChartProperties{} },
+	"combochart":          func() VizProperties { return &ChartProperties{} },
+	"text-image":          func() VizProperties { return &TextImageProperties{} },
+	"action-button":       func() VizProperties { return &ButtonProperties{} },
+}
+
+// ParseVizProperties parses properties by their `qInfo.qType`,
+// properties of other types are parsed as `*VisualizationProperties`.
+func ParseVizProperties(raw json.RawMessage) (VizProperties, *util.Result) {
+	var head struct {
+		Info *enigma.NxInfo `json:"qInfo"`
+	}
+	if err := json.Unmarshal(raw, &head); err != nil {
+		return nil, util.Error("ParseProperties", err)
+	}
+	var props VizProperties = &VisualizationProperties{}
+	if head.Info != nil {
+		if newProps, ok := vizPropertiesTypes[head.Info.Type]; ok {
+			props = newProps()
+		}
+	}
+	if err := json.Unmarshal(raw, props); err != nil {
+		return nil, util.Error("ParseProperties", err)
+	}
+	return props, nil
+}
+
+// DecodeProperties decodes raw properties or `NxContainerEntry.Data` as T, e.g. `SheetProperties`.
+func DecodeProperties[T any](raw json.RawMessage) (*T, *util.Result) {
+	var v T
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, util.Error("DecodeProperties", err)
+	}
+	return &v, nil
+}
+
+// VizProperties parses p.Properties by p.Info.Type.
+func (p *ObjectPropeties) VizProperties() (VizProperties, *util.Result) {
+	props, res := ParseVizProperties(p.Properties)
+	if res != nil {
+		return nil, res.With("ParseVizProperties")
+	}
+	return props, nil
+}
+
+func GetVizProperties(obj *enigma.GenericObject) (VizProperties, *util.Result) {
+	return GetVizPropertiesContext(ConnCtx, obj)
+}
+
+func GetVizPropertiesContext(ctx context.Context, obj *enigma.GenericObject) (VizProperties, *util.Result) {
+	raw, err := obj.GetPropertiesRaw(ctx)
+	if err != nil {
+		return nil, util.Error("GetPropertiesRaw", err)
+	}
+	props, res := ParseVizProperties(raw)
+	if res != nil {
+		return nil, res.With("ParseVizProperties")
+	}
+	return props, nil
+}
+
+func SetVizProperties(obj *enigma.GenericObject, props VizProperties) *util.Result {
+	return SetVizPropertiesContext(ConnCtx, obj, props)
+}
+
+func SetVizPropertiesContext(ctx context.Context, obj *enigma.GenericObject, props VizProperties) *util.Result {
+	if info := props.GetInfo(); info != nil && info.Id != obj.GenericId {
+		return util.MsgError("SetVizProperties", fmt.Sprintf("properties of %s can't be set to %s", info.Id, obj.GenericId))
+	}
+	raw, err := json.Marshal(props)
+	if err != nil {
+		return util.Error("EncodeProperties", err)
+	}
+	if err = obj.SetPropertiesRaw(ctx, raw); err != nil {
+		return util.Error("SetPropertiesRaw", err)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package engine_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/soderasen-au/go-common/util"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+	"github.com/soderasen-au/go-qlik/qlik/engine/enginetest"
+)
+
+func TestParseVizProperties(t *testing.T) {
+	tests := []struct {
+		name       string
+		raw        string
+		wantType   string
+		title      string
+		dims, msrs int
+		condition  string
+	}{
+		{
+			name:     "table",
+			raw:      `{"qInfo":{"qId":"t1","qType":"table"},"title":{"qStringExpression":{"qExpr":"='Sales ' & Year"}},"totals":{"show":true,"position":"top","fontSize":12},"qHyperCubeDef":{"qDimensions":[{"qDef":{"qFieldDefs":["Region"],"cId":"a"}}],"qMeasures":[{"qDef":{"qDef":"Sum(Sales)"}}],"qCalcCondition":{"qCond":{"qv":"Count(Region)>1"}}},"extension":{"color":"red"}}`,
+			wantType: "*engine.TableProperties", title: "='Sales ' & Year", dims: 1, msrs: 1, condition: "Count(Region)>1",
+		},
+		{
+			name:     "sheet",
+			raw:      `{"qInfo":{"qId":"s1","qType":"sheet"},"qMetaDef":{"title":"Overview","owner":"me"},"rank":1.5,"cells":[{"name":"t1","type":"table","col":0,"row":0,"colspan":12,"rowspan":6,"bounds":{"y":0,"x":0,"width":50,"height":50}}],"showCondition":"=1"}`,
+			wantType: "*engine.SheetProperties", title: "Overview", condition: "=1",
+		},
+		{
+			name:     "sheet with text rank",
+			raw:      `{"qInfo":{"qId":"s2","qType":"sheet"},"title":"Draft","rank":"1"}`,
+			wantType: "*engine.SheetProperties", title: "Draft",
+		},
+		{
+			name:     "container",
+			raw:      `{"qInfo":{"qId":"c1","qType":"sn-tabbed-container"},"title":"KPIs","children":[{"refId":"k1","label":"Sales","showCondition":"=vShow","isMaster":false,"extra":1}]}`,
+			wantType: "*engine.ContainerProperties", title: "KPIs",
+		},
+		{
+			name:     "listbox",
+			raw:      `{"qInfo":{"qId":"l1","qType":"listbox"},"qListObjectDef":{"qDef":{"qFieldDefs":["Year"]}}}`,
+			wantType: "*engine.ListboxProperties", dims: 1,
+		},
+		{
+			name:     "button",
+			raw:      `{"qInfo":{"qId":"b1","qType":"action-button"},"style":{"label":"Go","font":{"size":10}},"actions":[{"actionType":"applyBookmark","bookmark":"bm1"}],"navigation":{"action":"goToSheet","sheet":"s1"}}`,
+			wantType: "*engine.ButtonProperties", title: "Go",
+		},
+		{
+			name:     "other type",
+			raw:      `{"qInfo":{"qId":"m1","qType":"map"},"title":"Map","layers":[{"type":"point"}],"rank":"not a number"}`,
+			wantType: "*engine.VisualizationProperties", title: "Map",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			props, res := engine.ParseVizProperties(json.RawMessage(tt.raw))
+			if res != nil {
+				t.Fatalf("ParseVizProperties: %v", res)
+			}
+			if got := reflect.TypeOf(props).String(); got != tt.wantType {
+				t.Errorf("type = %s, want %s", got, tt.wantType)
+			}
+			if props.GetTitle() != tt.title || len(props.GetDimensions()) != tt.dims || len(props.GetMeasures()) != tt.msrs || props.GetShowCondition() != tt.condition {
+				t.Errorf("title = %q, dims = %d, measures = %d, condition = %q", props.GetTitle(), len(props.GetDimensions()), len(props.GetMeasures()), props.GetShowCondition())
+			}
+
+			buf, err := json.Marshal(props)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			var want, got any
+			_ = json.Unmarshal([]byte(tt.raw), &want)
+			_ = json.Unmarshal(buf, &got)
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("round trip = %s", buf)
+			}
+		})
+	}
+}
+
+func TestVizProperties_Edit(t *testing.T) {
+	raw := `{"qInfo":{"qId":"c1","qType":"container"},"title":"KPIs","children":[{"refId":"k1","label":"Sales","cId":"x","extra":1}],"custom":true}`
+	props, res := engine.DecodeProperties[engine.ContainerProperties](json.RawMessage(raw))
+	if res != nil {
+		t.Fatalf("DecodeProperties: %v", res)
+	}
+	props.Title = &engine.StringOrExpr{Expr: "='KPIs ' & Only(Year)"}
+	props.Child("k1").ShowCondition = engine.NewStringOrExpr("=vShowSales")
+	props.ShowTabs = util.Ptr(true)
+	props.SetRaw("custom", nil)
+
+	buf, err := json.Marshal(props)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	want := `{"children":[{"cId":"x","extra":1,"label":"Sales","refId":"k1","showCondition":"=vShowSales"}],"qInfo":{"qId":"c1","qType":"container"},"showTabs":true,"title":{"qStringExpression":{"qExpr":"='KPIs ' \u0026 Only(Year)"}}}`
+	if string(buf) != want {
+		t.Errorf("edited = %s", buf)
+	}
+}
+
+func TestVizProperties_EditHyperCube(t *testing.T) {
+	raw := `{"qInfo":{"qId":"t1","qType":"table"},"qHyperCubeDef":{"qDimensions":[{"qDef":{"qFieldDefs":["Region"],"cId":"d1"}}],` +
+		`"qMeasures":[{"qDef":{"qDef":"Sum(Sales)","cId":"m1","numFormatFromTemplate":false},"qSortBy":{"qSortByNumeric":-1}},` +
+		`{"qDef":{"qDef":"Sum(Margin)","cId":"m2"}}],"customCubeKey":{"a":1}}}`
+	props, res := engine.DecodeProperties[engine.TableProperties](json.RawMessage(raw))
+	if res != nil {
+		t.Fatalf("DecodeProperties: %v", res)
+	}
+	cube := props.HyperCubeDef
+	cube.Dimensions[0].Def.FieldLabels = []string{"Sales Region"}
+	cube.Measures = append(cube.Measures[1:], &enigma.NxMeasure{Def: &enigma.NxInlineMeasureDef{Def: "Count(Region)"}})
+
+	buf, err := json.Marshal(props)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	want := `{"qInfo":{"qId":"t1","qType":"table"},"qHyperCubeDef":{"qDimensions":[{"qDef":{"qFieldDefs":["Region"],"qFieldLabels":["Sales Region"],"cId":"d1"}}],` +
+		`"qMeasures":[{"qDef":{"qDef":"Sum(Margin)","cId":"m2"}},{"qDef":{"qDef":"Count(Region)"}}],"customCubeKey":{"a":1}}}`
+	var wantV, gotV any
+	_ = json.Unmarshal([]byte(want), &wantV)
+	_ = json.Unmarshal(buf, &gotV)
+	if !reflect.DeepEqual(wantV, gotV) {
+		t.Errorf("edited = %s", buf)
+	}
+}
+
+func TestFake_VizProperties(t *testing.T) {
+	_, doc := enginetest.OpenDoc(t, enginetest.SalesFixture())
+	ctx := engine.ConnCtx
+	obj, err := doc.GetObject(ctx, "tbl-sales")
+	if err != nil {
+		t.Fatalf("GetObject: %v", err)
+	}
+	props, res := engine.GetVizProperties(obj)
+	if res != nil {
+		t.Fatalf("GetVizProperties: %v", res)
+	}
+	table, ok := props.(*engine.TableProperties)
+	if !ok {
+		t.Fatalf("props = %T", props)
+	}
+	dims := make([]string, 0)
+	for _, d := range table.GetDimensions() {
+		if d.LibraryId != "" {
+			dims = append(dims, "lib:"+d.LibraryId)
+		} else {
+			dims = append(dims, d.Def.FieldDefs...)
+		}
+	}
+	if got := strings.Join(dims, ","); got != "Region,lib:dim-product" || table.GetTitle() != "Sales by Region" {
+		t.Errorf("dimensions = %s, title = %s", got, table.GetTitle())
+	}
+
+	table.Title = engine.NewStringOrExpr("Sales by Region and Product")
+	table.Totals = &engine.TableTotals{Show: util.Ptr(true), Position: "bottom"}
+	if res := engine.SetVizProperties(obj, table); res != nil {
+		t.Fatalf("SetVizProperties: %v", res)
+	}
+	after, res := engine.GetVizProperties(obj)
+	if res != nil {
+		t.Fatalf("GetVizProperties: %v", res)
+	}
+	if after.GetTitle() != "Sales by Region and Product" || after.(*engine.TableProperties).Totals.Position != "bottom" ||
+		len(after.GetMeasures()) != 2 || after.GetMeasures()[1].LibraryId != "msr-margin" {
+		t.Errorf("after = %s", util.JsonStr(after))
+	}
+
+	other, err := doc.GetObject(ctx, "pvt-sales")
+	if err != nil {
+		t.Fatalf("GetObject: %v", err)
+	}
+	if res := engine.SetVizProperties(other, table); res == nil {
+		t.Errorf("SetVizProperties of another object succeeded")
+	}
+	pivot, res := engine.GetVizProperties(other)
+	if res != nil {
+		t.Fatalf("GetVizProperties: %v", res)
+	}
+	if left := pivot.(*engine.PivotTableProperties).LeftDimensions(); len(left) != 1 || left[0].Def.FieldDefs[0] != "Region" {
+		t.Errorf("left dimensions = %s", util.JsonStr(left))
+	}
+}
@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"runtime"
@@ -36,11 +37,23 @@ type (
 		OpendocRetries    int            `json:"opendoc_retries" yaml:"opendoc_retries"`
 		RetryDelay        int            `json:"retry_delay" yaml:"retry_delay"`
 		Filter            *FilterOptions `json:"filter" yaml:"filter"`
+		RateLimit         float64        `json:"rate_limit,omitempty" yaml:"rate_limit,omitempty"` // engine calls per second, 0 means unlimited
+
+		// RateLimiter limits engine calls of the walk, it's created from RateLimit if nil.
+		// A limiter used as `Config.DialerHook` limits every call of the connection, including calls of walkers,
+		// so walks over docs of that connection must leave RateLimiter and RateLimit unset.
+		RateLimiter *RateLimiter `json:"-" yaml:"-"`
+		// OnProgress is called after each item of an object list is walked.
+		OnProgress func(p WalkProgress) `json:"-" yaml:"-"`
+
+		errors *walkErrors // errors of objects of partial walks
 	}
 
 	ObjWalkEntry struct {
 		*WalkOptions
 
+		// Ctx is used for engine requests of the walk, ConnCtx if it's nil.
+		Ctx       context.Context
 		Config    *MixedConfig
 		AppId     *string
 		Doc       *enigma.Doc
@@ -59,6 +72,7 @@ type (
 		Info         *enigma.NxInfo      `json:"info,omitempty" yaml:"info,omitempty"`
 		Parent       *enigma.NxInfo      `json:"parent,omitempty" yaml:"parent,omitempty"`
 		Meta         *NxMeta             `json:"meta,omitempty" yaml:"meta,omitempty"`
+		Digest       string              `json:"digest,omitempty" yaml:"digest,omitempty"` // properties digest of incremental walks
 		Result       *T                  `json:"result,omitempty" yaml:"result,omitempty"`
 		ChildResults []*ObjWalkResult[T] `json:"child_results,omitempty" yaml:"child_results,omitempty"`
 	}
@@ -165,6 +179,30 @@ func WalkOptionsForHuge() *WalkOptions {
 	}
 }
 
+// wait waits for RateLimiter.
+func (o *WalkOptions) wait(ctx context.Context) *util.Result {
+	if o == nil {
+		return nil
+	}
+	return o.RateLimiter.Wait(ctx)
+}
+
+// recordError records res of object id, false if the walk isn't partial.
+func (o *WalkOptions) recordError(id string, res *util.Result) bool {
+	if o == nil || o.errors == nil {
+		return false
+	}
+	o.errors.add(id, res)
+	return true
+}
+
+func (e ObjWalkEntry) Context() context.Context {
+	if e.Ctx == nil {
+		return ConnCtx
+	}
+	return e.Ctx
+}
+
 func FlattenObject[T any](obj *ObjWalkResult[T], m ListWalkResult[T]) {
 	if obj == nil || obj.Info == nil {
 		return
@@ -199,13 +237,21 @@ func NewRecurObjWalkFuncSync[T any](walker ObjWalkFunc[T]) ObjWalkFunc[T] {
 }
 
 func (w *AppWalker[T]) Walk(doc *enigma.Doc, cfg MixedConfig, opts *WalkOptions) (AppWalkResult[T], *util.Result) {
-	return WalkApp(doc, cfg, opts, w.Walkers, w.Logger)
+	return w.WalkContext(ConnCtx, doc, cfg, opts)
+}
+
+func (w *AppWalker[T]) WalkContext(ctx context.Context, doc *enigma.Doc, cfg MixedConfig, opts *WalkOptions) (AppWalkResult[T], *util.Result) {
+	return WalkAppContext(ctx, doc, cfg, opts, w.Walkers, w.Logger)
 }
 
 func (w *AppWalker[T]) WalkSheets(doc *enigma.Doc, cfg MixedConfig, opts *WalkOptions, walker ObjWalkFunc[T]) (AppWalkResult[T], *util.Result) {
+	return w.WalkSheetsContext(ConnCtx, doc, cfg, opts, walker)
+}
+
+func (w *AppWalker[T]) WalkSheetsContext(ctx context.Context, doc *enigma.Doc, cfg MixedConfig, opts *WalkOptions, walker ObjWalkFunc[T]) (AppWalkResult[T], *util.Result) {
 	walkers := make(ListWalkFuncMap[T])
 	walkers[SHEET_LIST] = NewRecurObjWalkFunc(walker)
-	return WalkApp(doc, cfg, opts, walkers, w.Logger)
+	return WalkAppContext(ctx, doc, cfg, opts, walkers, w.Logger)
 }
 
 func (w *ObjWalker[T]) Walk(doc *enigma.Doc, info *enigma.NxInfo) (*ObjWalkResult[T], *util.Result) {
@@ -213,14 +259,34 @@ func (w *ObjWalker[T]) Walk(doc *enigma.Doc, info *enigma.NxInfo) (*ObjWalkResul
 }
 
 func WalkApp[T any](doc *enigma.Doc, cfg MixedConfig, opts *WalkOptions, walkers ListWalkFuncMap[T], _logger *zerolog.Logger) (AppWalkResult[T], *util.Result) {
+	return WalkAppContext(ConnCtx, doc, cfg, opts, walkers, _logger)
+}
+
+// WalkAppContext walks app with ctx, which is passed to walkers in `ObjWalkEntry.Ctx`.
+// Walking stops when ctx is done, also during the delay between retries.
+func WalkAppContext[T any](ctx context.Context, doc *enigma.Doc, cfg MixedConfig, opts *WalkOptions, walkers ListWalkFuncMap[T], _logger *zerolog.Logger) (AppWalkResult[T], *util.Result) {
+	appResult, res := walkAppContext(ctx, doc, cfg, opts, walkers, _logger)
+	if res != nil {
+		return nil, res
+	}
+	return appResult, nil
+}
+
+// walkAppContext returns results of objects walked so far even if it fails.
+func walkAppContext[T any](ctx context.Context, doc *enigma.Doc, cfg MixedConfig, opts *WalkOptions, walkers ListWalkFuncMap[T], _logger *zerolog.Logger) (AppWalkResult[T], *util.Result) {
 	if _logger == nil {
 		_logger = loggers.CoreDebugLogger
 	}
 	if opts == nil {
 		opts = DefaultWalkOptions()
 	}
+	walkOpts := *opts
+	opts = &walkOpts
+	if opts.RateLimiter == nil {
+		opts.RateLimiter = NewRateLimiter(opts.RateLimit)
+	}
 
-	app, err := doc.GetAppLayout(ConnCtx)
+	app, err := doc.GetAppLayout(ctx)
 	if err != nil {
 		return nil, util.Error("GetAppLayout", err)
 	}
@@ -233,7 +299,7 @@ func WalkApp[T any](doc *enigma.Doc, cfg MixedConfig, opts *WalkOptions, walkers
 		Logger()
 	logger.Info().Msg("start")
 
-	layout, res := GetSessionObjectLayout(doc)
+	layout, res := GetSessionObjectLayoutContext(ctx, doc)
 	if res != nil {
 		logger.Err(res).Msg("GetSessionObjectLayout")
 		return nil, res.With("GetSessionObjectLayout")
@@ -259,30 +325,39 @@ func WalkApp[T any](doc *enigma.Doc, cfg MixedConfig, opts *WalkOptions, walkers
 				logger.Debug().Msg("   - use default walker for any list")
 			}
 			if listField.Kind() != reflect.Ptr {
-				return nil, util.LogMsgError(&logger,
+				return appResult, util.LogMsgError(&logger,
 					"TranslateAppObjectList["+listName+"]", " - object list field is not a pointer")
 			}
 			if listField.IsNil() {
-				return nil, util.LogMsgError(&logger,
+				return appResult, util.LogMsgError(&logger,
 					"TranslateAppObjectList["+listName+"]", " - object list field is Nil")
 			}
 			itemsOfList := reflect.Indirect(listField).FieldByName("Items")
 			if itemsOfList.IsZero() {
-				return nil, util.LogMsgError(&logger,
+				return appResult, util.LogMsgError(&logger,
 					"TranslateAppObjectList["+listName+"]", " - object list has no `Items` field")
 			}
 			items, ok := itemsOfList.Interface().([]*NxContainerEntry)
 			if !ok {
-				return nil, util.LogMsgError(&logger,
+				return appResult, util.LogMsgError(&logger,
 					"TranslateAppObjectList["+listName+"]", " - `Items` field is not `[]*NxContainerEntry`")
 			}
 			logger.Info().Msgf("%s has %d items", listName, len(items))
 
 			errArray := make([]*util.Result, len(items))
 			listResult := make(ListWalkResult[T])
+			appResult[listName] = listResult
+			progress := func(i int, res *util.Result) {
+				if opts.OnProgress != nil {
+					opts.OnProgress(WalkProgress{List: listName, Done: i + 1, Total: len(items), Object: items[i].Info, Error: res})
+				}
+			}
 
 			var sheetId, sheetName string
 			for i, item := range items {
+				if res := ctxResult(ctx, "WalkApp"); res != nil {
+					return appResult, res.LogWith(&logger, fmt.Sprintf("%s[%d]", listName, i))
+				}
 				ilog := logger.With().
 					Str("list", listName).
 					Str("itemNo", fmt.Sprintf("%d/%d", i, len(items))).
@@ -294,17 +369,32 @@ func WalkApp[T any](doc *enigma.Doc, cfg MixedConfig, opts *WalkOptions, walkers
 				if item.Info.Type == "sheet" {
 					if opts.SkipPrivateSheets && item.Meta != nil && !item.Meta.Published {
 						ilog.Warn().Msgf("skip private sheet: %s", item.Info.Id)
+						progress(i, nil)
 						continue
 					}
-					sheetObj, err := doc.GetObject(ConnCtx, item.Info.Id)
+					if res := opts.wait(ctx); res != nil {
+						return appResult, res.LogWith(&ilog, "RateLimiter")
+					}
+					sheetObj, err := doc.GetObject(ctx, item.Info.Id)
 					if err != nil {
 						ilog.Error().Msgf("GetSheetObject error: %s", err.Error())
-						return nil, util.LogError(&logger, "GetSheetObject", err)
+						if res := util.Error("GetSheetObject", err); opts.recordError(item.Info.Id, res) {
+							progress(i, res)
+							continue
+						}
+						return appResult, util.LogError(&logger, "GetSheetObject", err)
+					}
+					if res := opts.wait(ctx); res != nil {
+						return appResult, res.LogWith(&ilog, "RateLimiter")
 					}
-					propertiesRaw, err := sheetObj.GetPropertiesRaw(ConnCtx)
+					propertiesRaw, err := sheetObj.GetPropertiesRaw(ctx)
 					if err != nil {
 						ilog.Error().Msgf("GetPropertiesRaw error: %s", err.Error())
-						return nil, util.LogError(&logger, "GetPropertiesRaw", err)
+						if res := util.Error("GetPropertiesRaw", err); opts.recordError(item.Info.Id, res) {
+							progress(i, res)
+							continue
+						}
+						return appResult, util.LogError(&logger, "GetPropertiesRaw", err)
 					}
 					prop := ObjectPropeties{
 						Info:       item.Info,
@@ -316,6 +406,7 @@ func WalkApp[T any](doc *enigma.Doc, cfg MixedConfig, opts *WalkOptions, walkers
 				}
 
 				entry := ObjWalkEntry{
+					Ctx:         ctx,
 					Config:      &cfg,
 					WalkOptions: opts,
 					AppId:       util.Ptr(appid),
@@ -338,15 +429,17 @@ func WalkApp[T any](doc *enigma.Doc, cfg MixedConfig, opts *WalkOptions, walkers
 					}
 
 					relog.Warn().Msgf("Try to reconnect to the doc after %ds", opts.RetryDelay)
-					time.Sleep(time.Duration(opts.RetryDelay) * time.Second)
-					conn, res := cfg.Connect()
+					if res := sleepContext(ctx, time.Duration(opts.RetryDelay)*time.Second); res != nil {
+						return appResult, res.LogWith(&relog, "WaitForRetry")
+					}
+					conn, res := cfg.ConnectContext(ctx)
 					if res != nil {
-						return nil, res.LogWith(&relog, "MixedConfig.Connect")
+						return appResult, res.LogWith(&relog, "MixedConfig.Connect")
 					}
 
 					var ver *enigma.NxEngineVersion
 					err = nil
-					ver, err = conn.Global.EngineVersion(ConnCtx)
+					ver, err = conn.Global.EngineVersion(ctx)
 					if err != nil {
 						relog.Info().Msgf("engine version error: %s", err.Error())
 					}
@@ -357,21 +450,24 @@ func WalkApp[T any](doc *enigma.Doc, cfg MixedConfig, opts *WalkOptions, walkers
 					relog.Info().Msgf("Opening app: %s", cfg.AppId)
 					err = nil
 					doc = nil
-					doc, err = conn.Global.OpenDoc(ConnCtx, cfg.AppId, "", "", "", false)
+					doc, err = conn.Global.OpenDoc(ctx, cfg.AppId, "", "", "", false)
 					if err != nil {
 						relog.Warn().Msgf("1st open doc error: %s, will reopen after 30 seconds", err.Error())
 
 						conn.Global.DisconnectFromServer()
-						time.Sleep(time.Duration(opts.RetryDelay) * time.Second)
-						doc, err = conn.Global.OpenDoc(ConnCtx, cfg.AppId, "", "", "", false)
+						if res := sleepContext(ctx, time.Duration(opts.RetryDelay)*time.Second); res != nil {
+							return appResult, res.LogWith(&relog, "WaitForReopen")
+						}
+						doc, err = conn.Global.OpenDoc(ctx, cfg.AppId, "", "", "", false)
 						if err != nil {
 							relog.Info().Msgf("2nd open doc error: %s", err.Error())
 							continue
 						}
-						//return nil, util.LogError(&logger, "OpenDoc", err)
+						//return appResult, util.LogError(&logger, "OpenDoc", err)
 					}
 
 					entry := ObjWalkEntry{
+						Ctx:         ctx,
 						Config:      &cfg,
 						WalkOptions: opts,
 						AppId:       util.Ptr(appid),
@@ -388,29 +484,39 @@ func WalkApp[T any](doc *enigma.Doc, cfg MixedConfig, opts *WalkOptions, walkers
 				}
 
 				//if res != nil {
-				//	return nil, res.LogWith(&ilog, "failed after 3 retries")
+				//	return appResult, res.LogWith(&ilog, "failed after 3 retries")
 				//}
 
+				if res != nil {
+					opts.recordError(item.Info.Id, res)
+				}
 				errArray[i] = res
 				listResult[item.Info.Id] = objRes
+				progress(i, res)
 			}
 
 			//for i, res := range errArray {
 			//	if res != nil {
-			//		return nil, res.LogWith(&logger, fmt.Sprintf("%s[%d]: %s/%s", listName, i, items[i].Info.Type, items[i].Info.Id))
+			//		return appResult, res.LogWith(&logger, fmt.Sprintf("%s[%d]: %s/%s", listName, i, items[i].Info.Type, items[i].Info.Id))
 			//	}
 			//}
-			appResult[listName] = listResult
 		}
 	}
 
 	return appResult, nil
 }
 
+// RecurWalkObject walks e and its children concurrently with `e.Ctx`,
+// unless errors are ignored, the first failed child cancels walking of its siblings.
+// Cancellation of `e.Ctx` is never ignored.
 func RecurWalkObject[T any](e ObjWalkEntry, walker ObjWalkFunc[T]) (*ObjWalkResult[T], *util.Result) {
 	if e.Logger == nil {
 		e.Logger = loggers.CoreDebugLogger
 	}
+	ctx := e.Context()
+	if res := ctxResult(ctx, "RecurWalkObject"); res != nil {
+		return nil, res
+	}
 	qid := e.Item.Info.Id
 	qtype := e.Item.Info.Type
 	logger := e.Logger.With().
@@ -459,8 +565,14 @@ func RecurWalkObject[T any](e ObjWalkEntry, walker ObjWalkFunc[T]) (*ObjWalkResu
 		ChildResults: make([]*ObjWalkResult[T], 0),
 	}
 
+	if res := e.wait(ctx); res != nil {
+		return nil, res
+	}
 	objResult, res := walker(e)
 	if res != nil {
+		if e.recordError(qid, res) {
+			return &emptyObjShot, nil
+		}
 		if e.IgnoreError {
 			logger.Warn().Msgf("%s: ignored error: %v ", "walker", res.Error())
 			return &emptyObjShot, nil
@@ -469,8 +581,14 @@ func RecurWalkObject[T any](e ObjWalkEntry, walker ObjWalkFunc[T]) (*ObjWalkResu
 	}
 
 	logger.Trace().Msg("GetChildInfos")
-	obj, err := GetObject(e.Doc, qtype, qid)
+	if res := e.wait(ctx); res != nil {
+		return nil, res
+	}
+	obj, err := GetObjectContext(ctx, e.Doc, qtype, qid)
 	if err != nil {
+		if e.recordError(qid, util.Error("GetObject", err)) {
+			return &emptyObjShot, nil
+		}
 		if e.IgnoreError {
 			logger.Warn().Msgf("%s: ignored error: %v ", "GetObject", err)
 			return &emptyObjShot, nil
@@ -482,8 +600,14 @@ func RecurWalkObject[T any](e ObjWalkEntry, walker ObjWalkFunc[T]) (*ObjWalkResu
 		return objResult, nil
 	}
 	logger.Trace().Msg("get child infos")
-	ret, err := Invoke1Res1ErrOn(obj, "GetChildInfos", ConnCtx)
+	if res := e.wait(ctx); res != nil {
+		return nil, res
+	}
+	ret, err := Invoke1Res1ErrOn(obj, "GetChildInfos", ctx)
 	if err != nil {
+		if e.recordError(qid, util.Error("GetChildInfos", err)) {
+			return &emptyObjShot, nil
+		}
 		if e.IgnoreError {
 			logger.Warn().Msgf("%s: ignored error: %v ", "GetChildInfos", err)
 			return &emptyObjShot, nil
@@ -496,22 +620,26 @@ func RecurWalkObject[T any](e ObjWalkEntry, walker ObjWalkFunc[T]) (*ObjWalkResu
 	var (
 		semaphores = semaphore.NewWeighted(int64(e.MaxWorkers))
 	)
+	cctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 	mutex := sync.RWMutex{}
 	childArray := make([]*ObjWalkResult[T], len(childrenInfos))
-	resArray := make([]*util.Result, len(childrenInfos))
+	var (
+		firstRes *util.Result
+		firstIdx int
+	)
 
 	for i, child := range childrenInfos {
 		clog := logger.With().Str(qid+"-child", fmt.Sprintf("%d/%d", i, len(childrenInfos))).Logger()
-		i := i
-		child := child
 
-		if err := semaphores.Acquire(ConnCtx, 1); err != nil {
+		if err := semaphores.Acquire(cctx, 1); err != nil {
 			clog.Error().Msgf("semaphore acquire error: %v", err)
 			break
 		}
 		go func(i int, child *enigma.NxInfo) {
 			defer semaphores.Release(1)
 			entry := ObjWalkEntry{
+				Ctx:         cctx,
 				Config:      e.Config,
 				WalkOptions: e.WalkOptions,
 				AppId:       e.AppId,
@@ -532,22 +660,27 @@ func RecurWalkObject[T any](e ObjWalkEntry, walker ObjWalkFunc[T]) (*ObjWalkResu
 
 			mutex.Lock()
 			defer mutex.Unlock()
-			resArray[i] = res
 			childArray[i] = childObjShot
+			if res != nil && firstRes == nil && !e.IgnoreError {
+				firstRes, firstIdx = res, i
+				cancel()
+			}
 		}(i, child)
 	}
 
-	if err := semaphores.Acquire(ConnCtx, int64(e.MaxWorkers)); err != nil {
+	// wait for started children even if walking is cancelled
+	if err := semaphores.Acquire(context.Background(), int64(e.MaxWorkers)); err != nil {
 		logger.Error().Msgf("last semaphore acquire error: %v", err)
 		if !e.IgnoreError {
 			return nil, util.Error("can't acquire last semaphore", err)
 		}
 	}
 
-	for i, res := range resArray {
-		if res != nil && !e.IgnoreError {
-			return nil, res.LogWith(&logger, fmt.Sprintf("child[%d]: (%s: %s)", i, childrenInfos[i].Id, childrenInfos[i].Type))
-		}
+	if firstRes != nil {
+		return nil, firstRes.LogWith(&logger, fmt.Sprintf("child[%d]: (%s: %s)", firstIdx, childrenInfos[firstIdx].Id, childrenInfos[firstIdx].Type))
+	}
+	if res := ctxResult(ctx, "RecurWalkObject"); res != nil {
+		return nil, res
 	}
 
 	objResult.ChildResults = childArray
@@ -558,6 +691,10 @@ func RecurWalkObjectSync[T any](e ObjWalkEntry, walker ObjWalkFunc[T]) (*ObjWalk
 	if e.Logger == nil {
 		e.Logger = loggers.CoreDebugLogger
 	}
+	ctx := e.Context()
+	if res := ctxResult(ctx, "RecurWalkObjectSync"); res != nil {
+		return nil, res
+	}
 	qid := e.Item.Info.Id
 	qtype := e.Item.Info.Type
 	logger := e.Logger.With().
@@ -600,8 +737,14 @@ func RecurWalkObjectSync[T any](e ObjWalkEntry, walker ObjWalkFunc[T]) (*ObjWalk
 		ChildResults: make([]*ObjWalkResult[T], 0),
 	}
 
+	if res := e.wait(ctx); res != nil {
+		return nil, res
+	}
 	objResult, res := walker(e)
 	if res != nil {
+		if e.recordError(qid, res) {
+			return &emptyObjShot, nil
+		}
 		if e.IgnoreError {
 			logger.Warn().Msgf("%s: ignored error: %v ", "walker", res.Error())
 			return &emptyObjShot, nil
@@ -610,8 +753,14 @@ func RecurWalkObjectSync[T any](e ObjWalkEntry, walker ObjWalkFunc[T]) (*ObjWalk
 	}
 
 	logger.Trace().Msg("GetChildInfos")
-	obj, err := GetObject(e.Doc, qtype, qid)
+	if res := e.wait(ctx); res != nil {
+		return nil, res
+	}
+	obj, err := GetObjectContext(ctx, e.Doc, qtype, qid)
 	if err != nil {
+		if e.recordError(qid, util.Error("GetObject", err)) {
+			return &emptyObjShot, nil
+		}
 		if e.IgnoreError {
 			logger.Warn().Msgf("%s: ignored error: %v ", "engine.GetObject", err)
 			return &emptyObjShot, nil
@@ -623,8 +772,14 @@ func RecurWalkObjectSync[T any](e ObjWalkEntry, walker ObjWalkFunc[T]) (*ObjWalk
 		return objResult, nil
 	}
 	logger.Trace().Msg("get child infos")
-	ret, err := Invoke1Res1ErrOn(obj, "GetChildInfos", ConnCtx)
+	if res := e.wait(ctx); res != nil {
+		return nil, res
+	}
+	ret, err := Invoke1Res1ErrOn(obj, "GetChildInfos", ctx)
 	if err != nil {
+		if e.recordError(qid, util.Error("GetChildInfos", err)) {
+			return &emptyObjShot, nil
+		}
 		if e.IgnoreError {
 			logger.Warn().Msgf("%s: ignored error: %v ", "engine.GetChildInfos", err)
 			return &emptyObjShot, nil
@@ -638,6 +793,7 @@ func RecurWalkObjectSync[T any](e ObjWalkEntry, walker ObjWalkFunc[T]) (*ObjWalk
 
 	for i, child := range childrenInfos {
 		entry := ObjWalkEntry{
+			Ctx:         ctx,
 			Config:      e.Config,
 			WalkOptions: e.WalkOptions,
 			AppId:       e.AppId,
@@ -0,0 +1,200 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/rs/zerolog"
+	"github.com/soderasen-au/go-common/crypto"
+	"github.com/soderasen-au/go-common/util"
+)
+
+// WalkChanges are ids of objects walked incrementally compared to the baseline.
+type WalkChanges struct {
+	Added   []string `json:"added" yaml:"added"`
+	Removed []string `json:"removed" yaml:"removed"`
+	Changed []string `json:"changed" yaml:"changed"`
+	Reused  []string `json:"reused" yaml:"reused"` // unchanged objects whose baseline results are reused
+}
+
+// IncrementalWalk walks only objects whose properties digest or modified date differ from the baseline,
+// results of the baseline are reused for others. Changes of data, e.g. by reloads, aren't detected.
+type IncrementalWalk[T any] struct {
+	baseline ListWalkResult[T]
+	mu       sync.Mutex
+	walked   map[string]bool
+	reused   map[string]bool
+	seen     map[string]bool // objects passed to the walker, including failed ones
+}
+
+func NewIncrementalWalk[T any](baseline AppWalkResult[T]) *IncrementalWalk[T] {
+	flat := make(ListWalkResult[T])
+	for _, list := range baseline {
+		for _, obj := range list {
+			FlattenObject(obj, flat)
+		}
+	}
+	return &IncrementalWalk[T]{
+		baseline: flat,
+		walked:   make(map[string]bool),
+		reused:   make(map[string]bool),
+		seen:     make(map[string]bool),
+	}
+}
+
+// Wrap returns walker which reuses the baseline result of unchanged objects,
+// results of walker get the properties digest and item meta to be compared by the next walk.
+func (w *IncrementalWalk[T]) Wrap(walker ObjWalkFunc[T]) ObjWalkFunc[T] {
+	return func(e ObjWalkEntry) (*ObjWalkResult[T], *util.Result) {
+		w.mu.Lock()
+		w.seen[e.Info.Id] = true
+		w.mu.Unlock()
+		_, digest, res := objectProperties(e)
+		if res != nil {
+			return nil, res.With("objectProperties")
+		}
+		var meta *NxMeta
+		if e.Item != nil && e.Item.Meta != nil && e.Item.Meta.ModifiedDate != nil {
+			meta = e.Item.Meta
+		}
+
+		id := e.Info.Id
+		if old, ok := w.baseline[id]; ok && old != nil && old.Digest == digest && sameModifiedDate(old.Meta, meta) {
+			cached := *old
+			cached.ChildResults = make([]*ObjWalkResult[T], 0)
+			w.mu.Lock()
+			w.reused[id] = true
+			w.mu.Unlock()
+			return &cached, nil
+		}
+
+		ret, res := walker(e)
+		if res != nil {
+			return nil, res
+		}
+		if ret != nil {
+			ret.Digest = digest
+			if ret.Meta == nil {
+				ret.Meta = meta
+			}
+		}
+		w.mu.Lock()
+		w.walked[id] = true
+		w.mu.Unlock()
+		return ret, nil
+	}
+}
+
+func (w *IncrementalWalk[T]) Changes(doc *enigma.Doc) (*WalkChanges, *util.Result) {
+	return w.ChangesContext(ConnCtx, doc)
+}
+
+// ChangesContext returns sorted ids of added, removed, changed and reused objects so far.
+// Baseline objects not passed to the walker, e.g. filtered out or skipped, are removed only if they're missing in doc.
+func (w *IncrementalWalk[T]) ChangesContext(ctx context.Context, doc *enigma.Doc) (*WalkChanges, *util.Result) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	ret := &WalkChanges{Added: make([]string, 0), Removed: make([]string, 0), Changed: make([]string, 0), Reused: make([]string, 0)}
+	for id := range w.walked {
+		if _, ok := w.baseline[id]; ok {
+			ret.Changed = append(ret.Changed, id)
+		} else {
+			ret.Added = append(ret.Added, id)
+		}
+	}
+	for id := range w.reused {
+		ret.Reused = append(ret.Reused, id)
+	}
+	for id, old := range w.baseline {
+		if w.seen[id] {
+			continue
+		}
+		qtype := ""
+		if old != nil && old.Info != nil {
+			qtype = old.Info.Type
+		}
+		_, exists, err := lookupObject(ctx, doc, qtype, id)
+		if err != nil {
+			return nil, util.Error("GetObject "+id, err)
+		}
+		if !exists {
+			ret.Removed = append(ret.Removed, id)
+		}
+	}
+	for _, ids := range [][]string{ret.Added, ret.Removed, ret.Changed, ret.Reused} {
+		sort.Strings(ids)
+	}
+	return ret, nil
+}
+
+// sameModifiedDate is true unless both have a modified date and they differ.
+func sameModifiedDate(old, cur *NxMeta) bool {
+	if old == nil || cur == nil || old.ModifiedDate == nil || cur.ModifiedDate == nil {
+		return true
+	}
+	return *old.ModifiedDate == *cur.ModifiedDate
+}
+
+// objectProperties returns properties of e with the app id replaced by `__appid__` and their digest.
+func objectProperties(e ObjWalkEntry) (json.RawMessage, string, *util.Result) {
+	obj, err := GetObjectContext(e.Context(), e.Doc, e.Info.Type, e.Info.Id)
+	if err != nil {
+		return nil, "", util.Error("GetObject", err)
+	}
+	if !HasMethodOn(obj, "GetPropertiesRaw") {
+		return nil, "", util.MsgError("HasMethodOn", "GetPropertiesRaw")
+	}
+	prop, err := Invoke1Res1ErrOn(obj, "GetPropertiesRaw", e.Context())
+	if err != nil {
+		return nil, "", util.Error("Invoke1Res1ErrOn::GetPropertiesRaw", err)
+	}
+	buf := prop.Interface().(json.RawMessage)
+	buf = replaceAppId(buf, e.AppId)
+	digest, res := crypto.SHA2656Hex(buf)
+	if res != nil {
+		return nil, "", res.With("SHA2656Hex")
+	}
+	return buf, digest, nil
+}
+
+func (w *AppWalker[T]) WalkSheetsIncremental(doc *enigma.Doc, cfg MixedConfig, opts *WalkOptions, walker ObjWalkFunc[T], baseline AppWalkResult[T]) (AppWalkResult[T], *WalkChanges, *util.Result) {
+	return w.WalkSheetsIncrementalContext(ConnCtx, doc, cfg, opts, walker, baseline)
+}
+
+// WalkSheetsIncrementalContext walks sheets like WalkSheetsContext, but only objects changed since baseline.
+func (w *AppWalker[T]) WalkSheetsIncrementalContext(ctx context.Context, doc *enigma.Doc, cfg MixedConfig, opts *WalkOptions, walker ObjWalkFunc[T], baseline AppWalkResult[T]) (AppWalkResult[T], *WalkChanges, *util.Result) {
+	inc := NewIncrementalWalk(baseline)
+	result, res := w.WalkSheetsContext(ctx, doc, cfg, opts, inc.Wrap(walker))
+	if res != nil {
+		return nil, nil, res
+	}
+	changes, res := inc.ChangesContext(ctx, doc)
+	if res != nil {
+		return nil, nil, res.With("Changes")
+	}
+	return result, changes, nil
+}
+
+func RecursiveGetSnapshotsIncremental(doc *enigma.Doc, cfg MixedConfig, opts *WalkOptions, baseline AppWalkResult[ObjectSnapshot], _logger *zerolog.Logger) (AppWalkResult[ObjectSnapshot], *WalkChanges, *util.Result) {
+	return RecursiveGetSnapshotsIncrementalContext(ConnCtx, doc, cfg, opts, baseline, _logger)
+}
+
+// RecursiveGetSnapshotsIncrementalContext takes snapshots of objects changed since baseline,
+// snapshots of baseline are reused for others.
+func RecursiveGetSnapshotsIncrementalContext(ctx context.Context, doc *enigma.Doc, cfg MixedConfig, opts *WalkOptions, baseline AppWalkResult[ObjectSnapshot], _logger *zerolog.Logger) (AppWalkResult[ObjectSnapshot], *WalkChanges, *util.Result) {
+	inc := NewIncrementalWalk(baseline)
+	walkers := make(ListWalkFuncMap[ObjectSnapshot])
+	walkers[ANY_LIST] = NewRecurObjWalkFunc(inc.Wrap(ObjSnapshoter))
+	result, res := WalkAppContext(ctx, doc, cfg, opts, walkers, _logger)
+	if res != nil {
+		return nil, nil, res
+	}
+	changes, res := inc.ChangesContext(ctx, doc)
+	if res != nil {
+		return nil, nil, res.With("Changes")
+	}
+	return result, changes, nil
+}
@@ -0,0 +1,119 @@
+package engine_test
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/soderasen-au/go-common/loggers"
+	"github.com/soderasen-au/go-common/util"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+	"github.com/soderasen-au/go-qlik/qlik/engine/enginetest"
+)
+
+func TestFake_WalkSheetsIncremental(t *testing.T) {
+	srv, doc := enginetest.OpenDoc(t, enginetest.SalesFixture())
+	ctx := engine.ConnCtx
+	mcfg := srv.Config("sales")
+	opts := engine.DefaultWalkOptions()
+	opts.SkipPrivateSheets = true
+	var calls atomic.Int32
+	fn := func(e engine.ObjWalkEntry) (*engine.ObjWalkResult[string], *util.Result) {
+		calls.Add(1)
+		return &engine.ObjWalkResult[string]{Info: e.Info, Result: util.Ptr(e.Info.Type)}, nil
+	}
+	walker := engine.AppWalker[string]{Logger: loggers.NullLogger}
+	changesString := func(c *engine.WalkChanges) string {
+		return "added:" + strings.Join(c.Added, ",") + " removed:" + strings.Join(c.Removed, ",") +
+			" changed:" + strings.Join(c.Changed, ",") + " reused:" + strings.Join(c.Reused, ",")
+	}
+
+	baseline, changes, res := walker.WalkSheetsIncremental(doc, mcfg, opts, fn, nil)
+	if res != nil {
+		t.Fatalf("WalkSheetsIncremental: %v", res)
+	}
+	if got := changesString(changes); got != "added:ctn-kpis,kpi-sales,pvt-sales,sheet-overview,tbl-sales removed: changed: reused:" || calls.Load() != 5 {
+		t.Errorf("first walk: %s, %d calls", got, calls.Load())
+	}
+	sheet := baseline[engine.SHEET_LIST]["sheet-overview"]
+	if sheet.Digest == "" || sheet.Meta == nil || util.MaybeNil(sheet.Meta.ModifiedDate) != "2024-05-01T10:00:00.000Z" {
+		t.Errorf("sheet = %s", util.JsonStr(sheet))
+	}
+
+	calls.Store(0)
+	result, changes, res := walker.WalkSheetsIncremental(doc, mcfg, opts, fn, baseline)
+	if res != nil {
+		t.Fatalf("WalkSheetsIncremental: %v", res)
+	}
+	if got := changesString(changes); got != "added: removed: changed: reused:ctn-kpis,kpi-sales,pvt-sales,sheet-overview,tbl-sales" || calls.Load() != 0 {
+		t.Errorf("unchanged walk: %s, %d calls", got, calls.Load())
+	}
+	if got := len(engine.FlattenList(result[engine.SHEET_LIST])); got != 5 {
+		t.Errorf("unchanged walk has %d objects", got)
+	}
+
+	kpi, err := doc.GetObject(ctx, "kpi-sales")
+	if err != nil {
+		t.Fatalf("GetObject: %v", err)
+	}
+	props, err := kpi.GetPropertiesRaw(ctx)
+	if err != nil {
+		t.Fatalf("GetPropertiesRaw: %v", err)
+	}
+	props = []byte(strings.Replace(string(props), "{", `{"footnote":"changed",`, 1))
+	if err := kpi.SetPropertiesRaw(ctx, props); err != nil {
+		t.Fatalf("SetPropertiesRaw: %v", err)
+	}
+	sheetObj, err := doc.GetObject(ctx, "sheet-overview")
+	if err != nil {
+		t.Fatalf("GetObject: %v", err)
+	}
+	if _, err := sheetObj.DestroyChild(ctx, "pvt-sales", nil); err != nil {
+		t.Fatalf("DestroyChild: %v", err)
+	}
+	if _, err := sheetObj.CreateChild(ctx, &enigma.GenericObjectProperties{Info: &enigma.NxInfo{Id: "txt-new", Type: "text-image"}}, nil); err != nil {
+		t.Fatalf("CreateChild: %v", err)
+	}
+	sheet.Meta = &engine.NxMeta{ModifiedDate: util.Ptr("2024-01-01T00:00:00.000Z")}
+
+	calls.Store(0)
+	result, changes, res = walker.WalkSheetsIncremental(doc, mcfg, opts, fn, baseline)
+	if res != nil {
+		t.Fatalf("WalkSheetsIncremental: %v", res)
+	}
+	if got := changesString(changes); got != "added:txt-new removed:pvt-sales changed:kpi-sales,sheet-overview reused:ctn-kpis,tbl-sales" || calls.Load() != 3 {
+		t.Errorf("changed walk: %s, %d calls", got, calls.Load())
+	}
+	if got := len(engine.FlattenList(result[engine.SHEET_LIST])); got != 5 {
+		t.Errorf("changed walk has %d objects", got)
+	}
+	if got := len(sheet.ChildResults); got != 3 {
+		t.Errorf("baseline sheet has %d children after walks", got)
+	}
+
+	// filtered out and failed objects aren't removed
+	filtered := engine.DefaultWalkOptions()
+	filtered.SkipPrivateSheets = true
+	filtered.Filter.ObjectBlackList = []string{"tbl-sales"}
+	filtered.Filter.BuildMap()
+	failing := func(e engine.ObjWalkEntry) (*engine.ObjWalkResult[string], *util.Result) {
+		if e.Info.Id == "kpi-sales" {
+			return nil, util.MsgError("walker", "failed")
+		}
+		return fn(e)
+	}
+	filtered.IgnoreError = true
+	props = []byte(strings.Replace(string(props), `"footnote":"changed"`, `"footnote":"changed again"`, 1))
+	if err := kpi.SetPropertiesRaw(ctx, props); err != nil {
+		t.Fatalf("SetPropertiesRaw: %v", err)
+	}
+	_, changes, res = walker.WalkSheetsIncremental(doc, mcfg, filtered, failing, result)
+	if res != nil {
+		t.Fatalf("WalkSheetsIncremental: %v", res)
+	}
+	if got := changesString(changes); got != "added: removed: changed: reused:ctn-kpis,sheet-overview,txt-new" {
+		t.Errorf("filtered walk: %s", got)
+	}
+}
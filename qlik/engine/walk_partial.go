@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"context"
+	"sync"
+
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/rs/zerolog"
+	"github.com/soderasen-au/go-common/util"
+)
+
+// WalkProgress is reported by `WalkOptions.OnProgress` after Done of Total items of List are walked.
+type WalkProgress struct {
+	List   string         `json:"list" yaml:"list"`
+	Done   int            `json:"done" yaml:"done"`
+	Total  int            `json:"total" yaml:"total"`
+	Object *enigma.NxInfo `json:"object" yaml:"object"` // the item just walked
+	Error  *util.Result   `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// WalkErrors are errors of a partial walk by object id, errors which stopped the walk have an empty id.
+type WalkErrors map[string]*util.Result
+
+type walkErrors struct {
+	mu   sync.Mutex
+	errs WalkErrors
+}
+
+func (w *walkErrors) add(id string, res *util.Result) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.errs[id] = res
+}
+
+func WalkAppPartial[T any](doc *enigma.Doc, cfg MixedConfig, opts *WalkOptions, walkers ListWalkFuncMap[T], _logger *zerolog.Logger) (AppWalkResult[T], WalkErrors) {
+	return WalkAppPartialContext(ConnCtx, doc, cfg, opts, walkers, _logger)
+}
+
+// WalkAppPartialContext walks app like WalkAppContext, but failed objects don't fail their parents or the walk.
+// Failed objects have empty results and their errors are returned, the result is never nil.
+func WalkAppPartialContext[T any](ctx context.Context, doc *enigma.Doc, cfg MixedConfig, opts *WalkOptions, walkers ListWalkFuncMap[T], _logger *zerolog.Logger) (AppWalkResult[T], WalkErrors) {
+	if opts == nil {
+		opts = DefaultWalkOptions()
+	}
+	partialOpts := *opts
+	partialOpts.errors = &walkErrors{errs: make(WalkErrors)}
+
+	appResult, res := walkAppContext(ctx, doc, cfg, &partialOpts, walkers, _logger)
+	if appResult == nil {
+		appResult = make(AppWalkResult[T])
+	}
+	errs := partialOpts.errors.errs
+	if res != nil {
+		errs[""] = res
+	}
+	return appResult, errs
+}
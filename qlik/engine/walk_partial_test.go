@@ -0,0 +1,92 @@
+package engine_test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/soderasen-au/go-common/loggers"
+	"github.com/soderasen-au/go-common/util"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+	"github.com/soderasen-au/go-qlik/qlik/engine/enginetest"
+)
+
+func TestRateLimiter(t *testing.T) {
+	if l := engine.NewRateLimiter(0); l != nil || l.Wait(context.Background()) != nil {
+		t.Errorf("NewRateLimiter(0) = %v", l)
+	}
+
+	l := engine.NewRateLimiter(100)
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		if res := l.Wait(context.Background()); res != nil {
+			t.Fatalf("Wait: %v", res)
+		}
+	}
+	if d := time.Since(start); d < 45*time.Millisecond {
+		t.Errorf("6 calls at 100/s took %v", d)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if res := engine.NewRateLimiter(1).Wait(ctx); res == nil {
+		t.Errorf("Wait with cancelled context succeeded")
+	}
+}
+
+func TestFake_WalkAppPartial(t *testing.T) {
+	srv := enginetest.NewServer(enginetest.SalesFixture())
+	t.Cleanup(srv.Close)
+	cfg := srv.Config("sales")
+	cfg.OnPrem.DialerHook = engine.NewRateLimiter(1000).DialerHook
+	doc := enginetest.ConnectDoc(t, *cfg.OnPrem)
+	opts := engine.DefaultWalkOptions()
+	opts.RateLimit = 1000
+	progress := make([]string, 0)
+	opts.OnProgress = func(p engine.WalkProgress) {
+		progress = append(progress, fmt.Sprintf("%s %d/%d %s %v", p.List, p.Done, p.Total, p.Object.Id, p.Error != nil))
+	}
+	walkers := engine.ListWalkFuncMap[string]{
+		engine.SHEET_LIST: engine.NewRecurObjWalkFunc(func(e engine.ObjWalkEntry) (*engine.ObjWalkResult[string], *util.Result) {
+			if e.Info.Id == "pvt-sales" || e.Info.Id == "sheet-draft" {
+				return nil, util.MsgError("walk", "broken "+e.Info.Id)
+			}
+			return &engine.ObjWalkResult[string]{Info: e.Info, Result: util.Ptr(e.Info.Type)}, nil
+		}),
+	}
+
+	result, errs := engine.WalkAppPartial(doc, cfg, opts, walkers, loggers.NullLogger)
+	failed := make([]string, 0)
+	for id := range errs {
+		failed = append(failed, id)
+	}
+	sort.Strings(failed)
+	if got := strings.Join(failed, ","); got != "pvt-sales,sheet-draft" {
+		t.Errorf("errors = %s", got)
+	}
+	ids := make([]string, 0)
+	for id, o := range engine.FlattenList(result[engine.SHEET_LIST]) {
+		if o.Result != nil && *o.Result != "" {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	if got := strings.Join(ids, ","); got != "ctn-kpis,kpi-sales,sheet-overview,tbl-sales" {
+		t.Errorf("walked = %s", got)
+	}
+	want := fmt.Sprintf("%[1]s 1/2 sheet-overview false; %[1]s 2/2 sheet-draft false", engine.SHEET_LIST)
+	if got := strings.Join(progress, "; "); got != want {
+		t.Errorf("progress = %s", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result, errs = engine.WalkAppPartialContext(ctx, doc, cfg, opts, walkers, loggers.NullLogger)
+	if result == nil || errs[""] == nil {
+		t.Errorf("cancelled walk = %v, %v", result, errs)
+	}
+}
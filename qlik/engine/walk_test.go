@@ -1,7 +1,10 @@
 package engine
 
 import (
+	"context"
 	"testing"
+
+	"github.com/qlik-oss/enigma-go/v4"
 )
 
 func TestWalkApp_1(t *testing.T) {
@@ -62,3 +65,21 @@ func TestWalkApp_1(t *testing.T) {
 	//}
 	//WalkApp(doc, mc, nil, walkers, logger)
 }
+
+func TestWalkOptions_Wait(t *testing.T) {
+	// Wait of a limiter fails with a cancelled context, so a failed wait shows the walk waited for it
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	opts := &WalkOptions{RateLimiter: NewRateLimiter(1)}
+	if res := opts.wait(ctx); res == nil {
+		t.Errorf("wait for limiter succeeded")
+	}
+	d := &enigma.Dialer{}
+	opts.RateLimiter.DialerHook(d)
+	if res := opts.wait(ctx); res == nil || len(d.Interceptors) != 1 {
+		t.Errorf("wait for limiter used as DialerHook = %v, it must wait for docs of other connections", res)
+	}
+	if res := (&WalkOptions{}).wait(ctx); res != nil {
+		t.Errorf("wait without limiter = %v", res)
+	}
+}
@@ -0,0 +1,105 @@
+package qrs
+
+import (
+	"encoding/json"
+
+	"github.com/soderasen-au/go-common/util"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+	"github.com/soderasen-au/go-qlik/qlik/rac"
+)
+
+const (
+	PRINTING_EXPORT_OBJECT_IMAGE = "/printing/export/object/image"
+	PRINTING_EXPORT_OBJECT_PDF   = "/printing/export/object/pdf"
+)
+
+type PrintingFieldSelection struct {
+	StateName string    `json:"stateName"`
+	FieldName string    `json:"fieldName"`
+	Values    []string  `json:"values"`
+	IsNumeric bool      `json:"isNumeric"`
+	Numbers   []float64 `json:"numbers,omitempty"`
+}
+
+type PrintingExportRequest struct {
+	Type       string                   `json:"type"`
+	ImageType  string                   `json:"imageType,omitempty"`
+	WidthPx    int                      `json:"widthPx"`
+	HeightPx   int                      `json:"heightPx"`
+	Dpi        int                      `json:"dpi"`
+	AppId      string                   `json:"appId"`
+	ObjectId   string                   `json:"objectId"`
+	Selections []PrintingFieldSelection `json:"selections,omitempty"`
+}
+
+type PrintingExportResponse struct {
+	ExportedUrl string `json:"exportedUrl"`
+}
+
+func NewPrintingExportRequest(req *engine.ObjectImageRequest) *PrintingExportRequest {
+	req = req.WithDefaults()
+	r := &PrintingExportRequest{
+		Type:     "image",
+		WidthPx:  req.Width,
+		HeightPx: req.Height,
+		Dpi:      req.Dpi,
+		AppId:    req.AppId,
+		ObjectId: req.ObjectId,
+	}
+	if req.Format == engine.IMAGE_FORMAT_PDF {
+		r.Type = "pdf"
+	} else {
+		r.ImageType = req.Format
+	}
+	if req.Selections == nil {
+		return r
+	}
+	for _, st := range req.Selections.States {
+		for _, f := range st.Fields {
+			s := PrintingFieldSelection{StateName: st.Name, FieldName: f.Field, Values: make([]string, 0, len(f.Values)), IsNumeric: len(f.Values) > 0}
+			for _, v := range f.Values {
+				s.Values = append(s.Values, v.Text)
+				if v.Num == nil {
+					s.IsNumeric = false
+				} else {
+					s.Numbers = append(s.Numbers, *v.Num)
+				}
+			}
+			if !s.IsNumeric {
+				s.Numbers = nil
+			}
+			r.Selections = append(r.Selections, s)
+		}
+	}
+	return r
+}
+
+// ExportObjectImage exports an object with the printing service and downloads the exported file.
+func (c *Client) ExportObjectImage(req *engine.ObjectImageRequest) ([]byte, *util.Result) {
+	if res := req.Validate(); res != nil {
+		return nil, res.With("ExportObjectImage")
+	}
+	body := NewPrintingExportRequest(req)
+	endpoint := PRINTING_EXPORT_OBJECT_IMAGE
+	if body.Type == "pdf" {
+		endpoint = PRINTING_EXPORT_OBJECT_PDF
+	}
+	buf, res := c.Post(rac.GetRootPath(endpoint), body)
+	if res != nil {
+		return nil, res.With("PostPrintingExport")
+	}
+	var resp PrintingExportResponse
+	if err := json.Unmarshal(buf, &resp); err != nil {
+		return nil, util.Error("ParsePrintingExport", err)
+	}
+	if resp.ExportedUrl == "" {
+		return nil, util.MsgError("ParsePrintingExport", "no exported url")
+	}
+
+	data, res := c.GetAppContent(resp.ExportedUrl)
+	if res != nil {
+		return nil, res.With("GetAppContent")
+	}
+	return data, nil
+}
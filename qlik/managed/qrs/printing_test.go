@@ -0,0 +1,90 @@
+package qrs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/soderasen-au/go-common/util"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+	"github.com/soderasen-au/go-qlik/qlik/rac"
+)
+
+func TestClient_ExportObjectImage(t *testing.T) {
+	var got PrintingExportRequest
+	mux := http.NewServeMux()
+	mux.HandleFunc("/qrs/about", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"buildVersion":"test"}`))
+	})
+	mux.HandleFunc("/printing/export/object/image", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method", http.StatusMethodNotAllowed)
+			return
+		}
+		var req PrintingExportRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.ObjectId == "missing" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		got = req
+		_, _ = w.Write([]byte(`{"exportedUrl":"/tempcontent/abc/chart.png?serverNodeId=node-1"}`))
+	})
+	mux.HandleFunc("/tempcontent/abc/chart.png", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("serverNodeId") != "node-1" {
+			http.Error(w, "node", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write([]byte("PNGDATA"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	client, res := NewClient(Config{Config: rac.Config{
+		BaseUrl:   srv.URL,
+		IsCloud:   util.Ptr(false),
+		APIPrefix: util.Ptr("qrs"),
+		Auth:      &rac.AuthConfig{Method: rac.AuthMethodAPIKey, Token: util.Ptr("token")},
+	}})
+	if res != nil {
+		t.Fatalf("NewClient: %v", res)
+	}
+
+	sel := &engine.SelectionState{States: []*engine.StateSelections{{Name: "$", Fields: []*engine.FieldSelection{
+		{Field: "Region", Values: []*engine.SelectedValue{{Text: "East"}}},
+		{Field: "Year", Values: []*engine.SelectedValue{{Text: "2024", Num: util.Ptr(2024.0)}}},
+	}}}}
+	tests := []struct {
+		name    string
+		req     engine.ObjectImageRequest
+		want    string
+		wantErr bool
+	}{
+		{"png", engine.ObjectImageRequest{AppId: "app", ObjectId: "chart", Selections: sel}, "PNGDATA", false},
+		{"missing object", engine.ObjectImageRequest{AppId: "app", ObjectId: "missing"}, "", true},
+		{"no object id", engine.ObjectImageRequest{AppId: "app"}, "", true},
+		{"bad format", engine.ObjectImageRequest{AppId: "app", ObjectId: "chart", Format: "gif"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, res := client.ExportObjectImage(&tt.req)
+			if (res != nil) != tt.wantErr {
+				t.Fatalf("ExportObjectImage() error = %v, wantErr %v", res, tt.wantErr)
+			}
+			if string(data) != tt.want {
+				t.Errorf("ExportObjectImage() = %q, want %q", data, tt.want)
+			}
+		})
+	}
+
+	if got.ImageType != "png" || got.WidthPx != engine.DEFAULT_IMAGE_WIDTH || len(got.Selections) != 2 ||
+		got.Selections[0].IsNumeric || !got.Selections[1].IsNumeric || got.Selections[1].Numbers[0] != 2024 {
+		t.Errorf("request = %s", util.JsonStr(got))
+	}
+}
@@ -0,0 +1,175 @@
+package qcs
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/soderasen-au/go-common/util"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+	"github.com/soderasen-au/go-qlik/qlik/rac"
+)
+
+const (
+	REPORT_TYPE_SENSE_IMAGE = "sense-image-1.0"
+
+	REPORT_STATUS_DONE    = "done"
+	REPORT_STATUS_FAILED  = "failed"
+	REPORT_STATUS_ABORTED = "aborted"
+
+	DEFAULT_REPORT_TIMEOUT = 5 * time.Minute
+)
+
+type ReportFieldValue struct {
+	Text      string `json:"text"`
+	Value     any    `json:"value"`
+	IsNumeric bool   `json:"isNumeric"`
+}
+
+type ReportFieldSelection struct {
+	FieldName        string             `json:"fieldName"`
+	Values           []ReportFieldValue `json:"values"`
+	DefaultIsNumeric bool               `json:"defaultIsNumeric"`
+}
+
+type ReportVisualization struct {
+	Id       string `json:"id"`
+	Type     string `json:"type"`
+	WidthPx  int    `json:"widthPx"`
+	HeightPx int    `json:"heightPx"`
+}
+
+type SenseImageTemplate struct {
+	AppId             string                            `json:"appId"`
+	Visualization     ReportVisualization               `json:"visualization"`
+	SelectionsByState map[string][]ReportFieldSelection `json:"selectionsByState,omitempty"`
+}
+
+type ReportImageOutput struct {
+	OutFormat string `json:"outFormat"`
+	OutDpi    int    `json:"outDpi"`
+}
+
+type ReportPdfOutput struct {
+	OutDpi int `json:"outDpi"`
+}
+
+type ReportOutput struct {
+	OutputId    string             `json:"outputId"`
+	Type        string             `json:"type"`
+	ImageOutput *ReportImageOutput `json:"imageOutput,omitempty"`
+	PdfOutput   *ReportPdfOutput   `json:"pdfOutput,omitempty"`
+}
+
+type ReportRequest struct {
+	Type               string              `json:"type"`
+	SenseImageTemplate *SenseImageTemplate `json:"senseImageTemplate,omitempty"`
+	Output             ReportOutput        `json:"output"`
+}
+
+type ReportResult struct {
+	OutputId string `json:"outputId"`
+	Location string `json:"location"`
+}
+
+type ReportStatus struct {
+	Status  string         `json:"status"`
+	Results []ReportResult `json:"results,omitempty"`
+}
+
+func (s ReportStatus) Finished() bool {
+	return s.Status == REPORT_STATUS_DONE || s.Status == REPORT_STATUS_FAILED || s.Status == REPORT_STATUS_ABORTED
+}
+
+func NewImageReportRequest(req *engine.ObjectImageRequest) *ReportRequest {
+	req = req.WithDefaults()
+	r := &ReportRequest{
+		Type: REPORT_TYPE_SENSE_IMAGE,
+		SenseImageTemplate: &SenseImageTemplate{
+			AppId:         req.AppId,
+			Visualization: ReportVisualization{Id: req.ObjectId, Type: "visualization", WidthPx: req.Width, HeightPx: req.Height},
+		},
+		Output: ReportOutput{OutputId: "image", Type: "image", ImageOutput: &ReportImageOutput{OutFormat: req.Format, OutDpi: req.Dpi}},
+	}
+	if req.Format == engine.IMAGE_FORMAT_PDF {
+		r.Output = ReportOutput{OutputId: "pdf", Type: "pdf", PdfOutput: &ReportPdfOutput{OutDpi: req.Dpi}}
+	}
+	if req.Selections == nil {
+		return r
+	}
+	r.SenseImageTemplate.SelectionsByState = make(map[string][]ReportFieldSelection)
+	for _, st := range req.Selections.States {
+		fields := make([]ReportFieldSelection, 0, len(st.Fields))
+		for _, f := range st.Fields {
+			s := ReportFieldSelection{FieldName: f.Field, Values: make([]ReportFieldValue, 0, len(f.Values))}
+			for _, v := range f.Values {
+				if v.Num != nil {
+					s.Values = append(s.Values, ReportFieldValue{Text: v.Text, Value: *v.Num, IsNumeric: true})
+				} else {
+					s.Values = append(s.Values, ReportFieldValue{Text: v.Text, Value: v.Text})
+				}
+			}
+			fields = append(fields, s)
+		}
+		r.SenseImageTemplate.SelectionsByState[st.Name] = fields
+	}
+	return r
+}
+
+// ExportObjectImage exports an object with the reports API, waits up to DEFAULT_REPORT_TIMEOUT
+// for the report and downloads it.
+func (c *Client) ExportObjectImage(req *engine.ObjectImageRequest) ([]byte, *util.Result) {
+	if res := req.Validate(); res != nil {
+		return nil, res.With("ExportObjectImage")
+	}
+	resp, _, res := c.client.Do(http.MethodPost, "/reports", NewImageReportRequest(req))
+	if res != nil {
+		return nil, res.With("PostReport")
+	}
+	statusPath := resp.Header.Get("Location")
+	if statusPath == "" {
+		return nil, util.MsgError("ParseReportResponse", "no status location")
+	}
+
+	status, res := c.WaitForReport(statusPath, nil)
+	if res != nil {
+		return nil, res.With("WaitForReport")
+	}
+	if status.Status != REPORT_STATUS_DONE || len(status.Results) == 0 {
+		return nil, util.MsgError("Report", "report "+status.Status)
+	}
+
+	_, data, res := c.GetRawUrl(status.Results[0].Location)
+	if res != nil {
+		return nil, res.With("DownloadReport")
+	}
+	return data, nil
+}
+
+// WaitForReport polls the report status at statusPath until it's finished, timeout defaults to DEFAULT_REPORT_TIMEOUT.
+func (c *Client) WaitForReport(statusPath string, timeout *time.Duration) (*ReportStatus, *util.Result) {
+	start := time.Now()
+	duration := DEFAULT_REPORT_TIMEOUT
+	if timeout != nil {
+		duration = *timeout
+	}
+
+	for time.Since(start) < duration {
+		_, buf, res := c.client.Do(http.MethodGet, rac.GetRootPath(statusPath), nil)
+		if res != nil {
+			return nil, res.With("GetReportStatus")
+		}
+
+		var status ReportStatus
+		if err := json.Unmarshal(buf, &status); err != nil {
+			return nil, util.Error("parse response", err)
+		}
+		if status.Finished() {
+			return &status, nil
+		}
+		time.Sleep(time.Second)
+	}
+
+	return nil, util.MsgError("WaitForReport", "time out")
+}
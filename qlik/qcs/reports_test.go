@@ -0,0 +1,85 @@
+package qcs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/soderasen-au/go-common/util"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+	"github.com/soderasen-au/go-qlik/qlik/rac"
+)
+
+func TestClient_ExportObjectImage(t *testing.T) {
+	var got ReportRequest
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	mux.HandleFunc("/api/v1/reports", func(w http.ResponseWriter, r *http.Request) {
+		var req ReportRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.SenseImageTemplate == nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if req.SenseImageTemplate.Visualization.Id == "chart" {
+			got = req
+		}
+		w.Header().Set("Location", "/api/v1/reports/"+req.SenseImageTemplate.Visualization.Id+"/status")
+		w.WriteHeader(http.StatusAccepted)
+	})
+	mux.HandleFunc("/api/v1/reports/chart/status", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"status":"done","results":[{"outputId":"image","location":"` + srv.URL + `/api/v1/temp-contents/chart"}]}`))
+	})
+	mux.HandleFunc("/api/v1/reports/broken/status", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"status":"failed"}`))
+	})
+	mux.HandleFunc("/api/v1/temp-contents/chart", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("PNGDATA"))
+	})
+
+	client, res := NewClient(rac.Config{
+		BaseUrl: srv.URL,
+		IsCloud: util.Ptr(true),
+		Auth:    &rac.AuthConfig{Method: rac.AuthMethodAPIKey, Token: util.Ptr("token")},
+	})
+	if res != nil {
+		t.Fatalf("NewClient: %v", res)
+	}
+
+	sel := &engine.SelectionState{States: []*engine.StateSelections{
+		{Name: "$", Fields: []*engine.FieldSelection{{Field: "Region", Values: []*engine.SelectedValue{{Text: "East"}}}}},
+		{Name: "Compare", Fields: []*engine.FieldSelection{{Field: "Year", Values: []*engine.SelectedValue{{Text: "2024", Num: util.Ptr(2024.0)}}}}},
+	}}
+	tests := []struct {
+		name    string
+		req     engine.ObjectImageRequest
+		want    string
+		wantErr bool
+	}{
+		{"png", engine.ObjectImageRequest{AppId: "app", ObjectId: "chart", Width: 400, Selections: sel}, "PNGDATA", false},
+		{"failed report", engine.ObjectImageRequest{AppId: "app", ObjectId: "broken"}, "", true},
+		{"no app id", engine.ObjectImageRequest{ObjectId: "chart"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, res := client.ExportObjectImage(&tt.req)
+			if (res != nil) != tt.wantErr {
+				t.Fatalf("ExportObjectImage() error = %v, wantErr %v", res, tt.wantErr)
+			}
+			if string(data) != tt.want {
+				t.Errorf("ExportObjectImage() = %q, want %q", data, tt.want)
+			}
+		})
+	}
+
+	tpl := got.SenseImageTemplate
+	if got.Type != REPORT_TYPE_SENSE_IMAGE || tpl.Visualization.WidthPx != 400 || tpl.Visualization.HeightPx != engine.DEFAULT_IMAGE_HEIGHT ||
+		got.Output.ImageOutput == nil || got.Output.ImageOutput.OutFormat != engine.IMAGE_FORMAT_PNG {
+		t.Errorf("request = %s", util.JsonStr(got))
+	}
+	if v := tpl.SelectionsByState["Compare"]; len(v) != 1 || !v[0].Values[0].IsNumeric || v[0].Values[0].Value != 2024.0 {
+		t.Errorf("selections = %s", util.JsonStr(tpl.SelectionsByState))
+	}
+}
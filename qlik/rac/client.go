@@ -27,6 +27,7 @@ type RestApiClient struct {
 	baseUrl *url.URL           `json:"-" yaml:"-" bson:"-"`
 	certs   *crypto.RsaKeyPair `json:"-" yaml:"-" bson:"-"`
 	client  *http.Client       `json:"-" yaml:"-" bson:"-"`
+	tls     *tls.Config        `json:"-" yaml:"-" bson:"-"`
 
 	csrfToken string `json:"-" yaml:"-" bson:"-"` //only Cloud uses this csrf
 }
@@ -91,8 +92,11 @@ func New(cfg Config) (*RestApiClient, *util.Result) {
 	if rac.Config.ExtraTlsConfig != nil {
 		rac.Config.ExtraTlsConfig.Apply(tlsConfig)
 	}
-	var transport *http.Transport
-	transport = &http.Transport{TLSClientConfig: tlsConfig}
+	rac.tls = tlsConfig
+	var transport http.RoundTripper = &http.Transport{TLSClientConfig: tlsConfig}
+	if cfg.WrapTransport != nil {
+		transport = cfg.WrapTransport(transport)
+	}
 	rac.client = &http.Client{
 		Transport: transport,
 		Timeout:   time.Duration(time.Duration(*rac.Config.TimeoutSec) * time.Second),
@@ -133,13 +137,9 @@ func (c *RestApiClient) initCertClient() (*RestApiClient, *util.Result) {
 	if res != nil {
 		return nil, res.With("Certs.NewTlsConfig")
 	}
-	transport, ok := c.client.Transport.(*http.Transport)
-	if !ok {
-		return nil, util.MsgError("http.Transport", "can't convert to transport")
-	}
-	transport.TLSClientConfig.Certificates = tlsCertsConfig.Certificates
-	transport.TLSClientConfig.RootCAs = tlsCertsConfig.RootCAs
-	c.client.Transport = transport
+	// c.tls is shared with the transport, which may be wrapped by Config.WrapTransport
+	c.tls.Certificates = tlsCertsConfig.Certificates
+	c.tls.RootCAs = tlsCertsConfig.RootCAs
 
 	return c, nil
 }
@@ -26,6 +26,10 @@ type Config struct {
 	ExtraHeaders   map[string]string `json:"extra_headers,omitempty" yaml:"extra_headers,omitempty" bson:"extra_headers,omitempty"`
 	LogFileName    *string           `json:"log_file_name,omitempty" yaml:"log_file_name,omitempty" bson:"log_file_name,omitempty"`
 	Cookie         http.CookieJar    `json:"-" yaml:"-" bson:"-"`
+
+	// WrapTransport wraps the http transport before the client authenticates, so requests sent by `New`,
+	// e.g. the cloud JWT session, pass through it too. See replay.Recorder.Transport.
+	WrapTransport func(http.RoundTripper) http.RoundTripper `json:"-" yaml:"-" bson:"-"`
 }
 
 func (c Config) IsForCloud() bool {
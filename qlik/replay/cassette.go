@@ -0,0 +1,206 @@
+// Package replay records engine (enigma websocket) and REST (QRS/QCS `http.Client`) traffic
+// into a Cassette with secrets scrubbed, and serves it back deterministically in tests.
+//
+// Record once against a real server:
+//
+//	rec := replay.NewRecorder(nil)
+//	cfg.DialerHook = rec.DialerHook
+//	racCfg.WrapTransport = rec.Transport
+//	... // create clients and run the code under test
+//	rec.Save("testdata/app.json")
+//
+// Then replay it without a server:
+//
+//	cassette, _ := replay.LoadCassette("testdata/app.json")
+//	p := replay.NewReplayer(cassette)
+//	cfg.DialerHook = p.DialerHook
+//	racCfg.WrapTransport = p.Transport
+//
+// Engine requests are matched on handle, method and params, HTTP requests on method, url and body.
+// Each recorded exchange and session is served once, anything else fails and is reported by Replayer.Misses.
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/soderasen-au/go-common/util"
+)
+
+const (
+	CASSETTE_VERSION = 1
+	SCRUBBED         = "<scrubbed>"
+	SCRUBBED_JWT     = "<jwt>"
+)
+
+type Cassette struct {
+	Version  int             `json:"version" yaml:"version"`
+	Sessions []*Session      `json:"sessions,omitempty" yaml:"sessions,omitempty"` // engine connections in dialing order
+	Http     []*HttpExchange `json:"http,omitempty" yaml:"http,omitempty"`
+}
+
+// Session is the traffic of an engine connection.
+type Session struct {
+	Url       string            `json:"url" yaml:"url"`
+	Greetings []json.RawMessage `json:"greetings,omitempty" yaml:"greetings,omitempty"` // notifications received before the first request, e.g. OnConnected
+	Exchanges []*RpcExchange    `json:"exchanges,omitempty" yaml:"exchanges,omitempty"`
+}
+
+type RpcExchange struct {
+	Handle        int               `json:"handle" yaml:"handle"`
+	Method        string            `json:"method" yaml:"method"`
+	Params        json.RawMessage   `json:"params,omitempty" yaml:"params,omitempty"`
+	Response      json.RawMessage   `json:"response" yaml:"response"`
+	Notifications []json.RawMessage `json:"notifications,omitempty" yaml:"notifications,omitempty"` // received after the response
+}
+
+type HttpExchange struct {
+	Method       string      `json:"method" yaml:"method"`
+	Url          string      `json:"url" yaml:"url"`
+	Body         string      `json:"body,omitempty" yaml:"body,omitempty"`
+	Status       int         `json:"status" yaml:"status"`
+	Header       http.Header `json:"header,omitempty" yaml:"header,omitempty"`
+	ResponseBody string      `json:"response_body,omitempty" yaml:"response_body,omitempty"`
+}
+
+// ScrubOptions defines what is removed from recorded traffic.
+type ScrubOptions struct {
+	Headers  []string         `json:"headers" yaml:"headers"` // header names, case-insensitive
+	Queries  []string         `json:"queries" yaml:"queries"` // query parameter names
+	Secrets  []string         `json:"secrets" yaml:"secrets"` // literal strings, e.g. passwords or API keys
+	Patterns []*regexp.Regexp `json:"-" yaml:"-"`             // matches are replaced with SCRUBBED
+	NoJWT    bool             `json:"no_jwt" yaml:"no_jwt"`   // keep JWTs
+}
+
+var jwtPattern = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+
+func DefaultScrubOptions() *ScrubOptions {
+	return &ScrubOptions{
+		Headers: []string{"Authorization", "Cookie", "Set-Cookie", "X-Qlik-Session", "X-Qlik-Csrf-Token", "Qlik-Csrf-Token"},
+		Queries: []string{"qlik-csrf-token", "qlikTicket", "api_key"},
+		Patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)((?:password|pwd)=)[^;"&\\]*`),
+			// JSON values, e.g. qPassword of connections in engine params and QRS/QCS bodies
+			regexp.MustCompile(`(?i)("(?:q?password|pwd|secret|client_secret|token|access_token|refresh_token)"\s*:\s*")[^"\\]*(?:\\.[^"\\]*)*`),
+		},
+	}
+}
+
+// String scrubs secrets, JWTs and patterns in s.
+func (o *ScrubOptions) String(s string) string {
+	for _, secret := range o.Secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, SCRUBBED)
+		}
+	}
+	if !o.NoJWT {
+		s = jwtPattern.ReplaceAllString(s, SCRUBBED_JWT)
+	}
+	for _, p := range o.Patterns {
+		if p.NumSubexp() > 0 {
+			s = p.ReplaceAllString(s, "${1}"+SCRUBBED)
+		} else {
+			s = p.ReplaceAllString(s, SCRUBBED)
+		}
+	}
+	return s
+}
+
+func (o *ScrubOptions) Json(buf []byte) json.RawMessage {
+	if len(buf) == 0 {
+		return nil
+	}
+	return json.RawMessage(o.String(string(buf)))
+}
+
+func (o *ScrubOptions) Header(h http.Header) http.Header {
+	ret := make(http.Header, len(h))
+	for k, values := range h {
+		scrubbed := false
+		for _, name := range o.Headers {
+			if strings.EqualFold(k, name) {
+				scrubbed = true
+				break
+			}
+		}
+		for _, v := range values {
+			if scrubbed {
+				ret.Add(k, SCRUBBED)
+			} else {
+				ret.Add(k, o.String(v))
+			}
+		}
+	}
+	return ret
+}
+
+func (o *ScrubOptions) Url(u *url.URL) string {
+	c := *u
+	c.User = nil
+	q := c.Query()
+	changed := false
+	for k := range q {
+		for _, name := range o.Queries {
+			if strings.EqualFold(k, name) {
+				q.Set(k, SCRUBBED)
+				changed = true
+			}
+		}
+	}
+	if changed {
+		c.RawQuery = q.Encode()
+	}
+	return o.String(c.String())
+}
+
+func parseUrl(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		return &url.URL{Path: s}
+	}
+	return u
+}
+
+// LoadCassette reads a cassette saved by Recorder.
+func LoadCassette(path string) (*Cassette, *util.Result) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, util.Error("ReadFile", err)
+	}
+	var c Cassette
+	if err := json.Unmarshal(buf, &c); err != nil {
+		return nil, util.Error("ParseCassette", err)
+	}
+	if c.Version != CASSETTE_VERSION {
+		return nil, util.Errorf("unsupported cassette version %d", c.Version)
+	}
+	return &c, nil
+}
+
+func (c *Cassette) Save(path string) *util.Result {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(c); err != nil {
+		return util.Error("EncodeCassette", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return util.Error("WriteFile", err)
+	}
+	return nil
+}
+
+// normalizeJson compacts buf so that matching ignores formatting.
+func normalizeJson(buf []byte) string {
+	var out bytes.Buffer
+	if err := json.Compact(&out, buf); err != nil {
+		return string(buf)
+	}
+	return out.String()
+}
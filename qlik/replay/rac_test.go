@@ -0,0 +1,176 @@
+package replay
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/soderasen-au/go-common/crypto"
+	"github.com/soderasen-au/go-common/util"
+
+	"github.com/soderasen-au/go-qlik/qlik"
+	"github.com/soderasen-au/go-qlik/qlik/managed/qrs"
+	"github.com/soderasen-au/go-qlik/qlik/qcs"
+	"github.com/soderasen-au/go-qlik/qlik/rac"
+)
+
+// testCerts writes a self-signed client certificate, its key and itself as the root CA.
+func testCerts(t *testing.T) *crypto.Certificates {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	dir := t.TempDir()
+	certs := crypto.NewCertificates(dir)
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	for file, buf := range map[string][]byte{certs.ClientFile: certPem, certs.ClientkeyFile: keyPem, certs.CAFile: certPem} {
+		if err := os.WriteFile(file, buf, 0600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	return certs
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRecordReplay_QrsClient(t *testing.T) {
+	clientCerts := 0
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+			clientCerts++
+		}
+		if r.URL.Path != "/qrs/about" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, `{"buildVersion":"14.5.2","databaseProvider":"Devart.Data.PostgreSql"}`)
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	srv.StartTLS()
+
+	cfg := qrs.Config{Config: rac.Config{
+		BaseUrl:        srv.URL,
+		APIPrefix:      util.Ptr("qrs"),
+		ExtraTlsConfig: &rac.ExtraTLSConfig{InsecureSkipVerify: true},
+		Auth: &rac.AuthConfig{
+			Method: rac.AuthMethodCert,
+			User:   &qlik.User{Id: "sa_api", Directory: "INTERNAL"},
+			Certs:  testCerts(t),
+		},
+	}}
+	rec := NewRecorder(nil)
+	cfg.WrapTransport = rec.Transport
+	if _, res := qrs.NewClient(cfg); res != nil {
+		t.Fatalf("NewClient: %v", res)
+	}
+	srv.Close()
+	if clientCerts != 1 {
+		t.Errorf("requests with client certificate = %d, want 1", clientCerts)
+	}
+
+	p := NewReplayer(rec.Cassette())
+	cfg.WrapTransport = p.Transport
+	c, res := qrs.NewClient(cfg)
+	if res != nil {
+		t.Fatalf("replayed NewClient: %v", res)
+	}
+	if about, res := c.About(); res == nil {
+		t.Errorf("About() is recorded once, replaying it again should fail: %s", util.JsonStr(about))
+	}
+	if misses := p.Misses(); len(misses) != 1 || !strings.HasPrefix(misses[0], "GET "+srv.URL+"/qrs/about?") {
+		t.Errorf("Misses() = %v", misses)
+	}
+}
+
+func TestRecordReplay_QcsClient(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login/jwt-session":
+			if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer eyJ") {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "_session", Value: "secret-session"})
+		case "/api/v1/csrf-token":
+			w.Header().Set("qlik-csrf-token", "secret-csrf")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	cfg := rac.Config{
+		BaseUrl:        srv.URL,
+		IsCloud:        util.Ptr(true),
+		ExtraTlsConfig: &rac.ExtraTLSConfig{InsecureSkipVerify: true},
+		Auth: &rac.AuthConfig{
+			Method: rac.AuthMethodJWT,
+			Certs:  testCerts(t),
+			CloudJwt: &rac.CloudJwtConfig{
+				KeyId:            "key",
+				Issuer:           "tenant.example.com",
+				WebIntegrationID: "web-integration",
+				UserName:         "test",
+				UserEmail:        "test@example.com",
+				UserSub:          "sub",
+			},
+		},
+	}
+	rec := NewRecorder(nil)
+	cfg.WrapTransport = func(next http.RoundTripper) http.RoundTripper {
+		// the session is started on the default port of the host, send it to srv
+		return rec.Transport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			req.URL.Host = srv.Listener.Addr().String()
+			return next.RoundTrip(req)
+		}))
+	}
+	if _, res := qcs.NewClient(cfg); res != nil {
+		t.Fatalf("NewClient: %v", res)
+	}
+	srv.Close()
+
+	cassette := rec.Cassette()
+	if len(cassette.Http) != 2 {
+		t.Fatalf("cassette = %s", util.JsonStr(cassette))
+	}
+	if s := util.JsonStr(cassette); strings.Contains(s, "secret-") {
+		t.Errorf("secret is not scrubbed: %s", s)
+	}
+
+	p := NewReplayer(cassette)
+	cfg.WrapTransport = p.Transport
+	if _, res := qcs.NewClient(cfg); res != nil {
+		t.Fatalf("replayed NewClient: %v", res)
+	}
+	if misses := p.Misses(); len(misses) != 0 {
+		t.Errorf("Misses() = %v", misses)
+	}
+}
@@ -0,0 +1,208 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/soderasen-au/go-common/util"
+)
+
+// rpcMessage is a JSON-RPC request, response or notification of the engine.
+type rpcMessage struct {
+	Id     *int            `json:"id,omitempty"`
+	Handle int             `json:"handle"`
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// Recorder collects traffic of engine connections and http clients it's hooked into.
+type Recorder struct {
+	Scrub *ScrubOptions
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+// NewRecorder creates a Recorder, scrub defaults to DefaultScrubOptions.
+func NewRecorder(scrub *ScrubOptions) *Recorder {
+	if scrub == nil {
+		scrub = DefaultScrubOptions()
+	}
+	return &Recorder{Scrub: scrub, cassette: Cassette{Version: CASSETTE_VERSION}}
+}
+
+// DialerHook records the connection dialed with d, assign it to `engine.Config.DialerHook`.
+func (r *Recorder) DialerHook(d *enigma.Dialer) {
+	create := d.CreateSocket
+	if create == nil {
+		// same as the default of enigma
+		wsDialer := websocket.Dialer{Proxy: http.ProxyFromEnvironment, TLSClientConfig: d.TLSClientConfig, Jar: d.Jar}
+		create = func(ctx context.Context, url string, header http.Header) (enigma.Socket, error) {
+			conn, _, err := wsDialer.DialContext(ctx, url, header)
+			if err != nil {
+				return nil, err
+			}
+			return conn, nil
+		}
+	}
+	d.CreateSocket = func(ctx context.Context, url string, header http.Header) (enigma.Socket, error) {
+		socket, err := create(ctx, url, header)
+		if err != nil {
+			return nil, err
+		}
+		return &recordingSocket{Socket: socket, conn: r.newConn(url)}, nil
+	}
+}
+
+// Transport records requests sent through next, nil means `http.DefaultTransport`.
+func (r *Recorder) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &recordingTransport{r: r, next: next}
+}
+
+// Cassette returns a copy of traffic recorded so far.
+func (r *Recorder) Cassette() *Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := Cassette{Version: r.cassette.Version}
+	for _, s := range r.cassette.Sessions {
+		sc := *s
+		sc.Exchanges = append([]*RpcExchange{}, s.Exchanges...)
+		sc.Greetings = append([]json.RawMessage{}, s.Greetings...)
+		c.Sessions = append(c.Sessions, &sc)
+	}
+	c.Http = append([]*HttpExchange{}, r.cassette.Http...)
+	return &c
+}
+
+func (r *Recorder) Save(path string) *util.Result {
+	return r.Cassette().Save(path)
+}
+
+func (r *Recorder) newConn(url string) *connRecorder {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := &Session{Url: r.Scrub.Url(parseUrl(url))}
+	r.cassette.Sessions = append(r.cassette.Sessions, s)
+	return &connRecorder{r: r, session: s, pending: make(map[int]*RpcExchange)}
+}
+
+// connRecorder pairs requests and responses of a connection by id.
+type connRecorder struct {
+	r       *Recorder
+	session *Session
+	pending map[int]*RpcExchange
+	last    *RpcExchange
+}
+
+func (l *connRecorder) sent(message []byte) {
+	var req rpcMessage
+	if err := json.Unmarshal(message, &req); err != nil || req.Id == nil {
+		return
+	}
+	l.r.mu.Lock()
+	defer l.r.mu.Unlock()
+	l.pending[*req.Id] = &RpcExchange{Handle: req.Handle, Method: req.Method, Params: l.r.Scrub.Json(req.Params)}
+}
+
+func (l *connRecorder) received(message []byte) {
+	var resp rpcMessage
+	if err := json.Unmarshal(message, &resp); err != nil {
+		return
+	}
+	l.r.mu.Lock()
+	defer l.r.mu.Unlock()
+	scrubbed := l.r.Scrub.Json(message)
+	if resp.Id == nil {
+		if l.last == nil {
+			l.session.Greetings = append(l.session.Greetings, scrubbed)
+		} else {
+			l.last.Notifications = append(l.last.Notifications, scrubbed)
+		}
+		return
+	}
+	e, ok := l.pending[*resp.Id]
+	if !ok {
+		return
+	}
+	delete(l.pending, *resp.Id)
+	e.Response = scrubbed
+	l.session.Exchanges = append(l.session.Exchanges, e)
+	l.last = e
+}
+
+type recordingSocket struct {
+	enigma.Socket
+	conn *connRecorder
+}
+
+func (s *recordingSocket) WriteMessage(messageType int, data []byte) error {
+	s.conn.sent(data)
+	return s.Socket.WriteMessage(messageType, data)
+}
+
+func (s *recordingSocket) ReadMessage() (int, []byte, error) {
+	t, data, err := s.Socket.ReadMessage()
+	if err == nil {
+		s.conn.received(data)
+	}
+	return t, data, err
+}
+
+type recordingTransport struct {
+	r    *Recorder
+	next http.RoundTripper
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// a RoundTripper must not modify req, the body is read from a clone
+	req = req.Clone(req.Context())
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := readBody(&resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	scrub := t.r.Scrub
+	e := &HttpExchange{
+		Method:       req.Method,
+		Url:          scrub.Url(req.URL),
+		Body:         scrub.String(string(body)),
+		Status:       resp.StatusCode,
+		Header:       scrub.Header(resp.Header),
+		ResponseBody: scrub.String(string(respBody)),
+	}
+	t.r.mu.Lock()
+	t.r.cassette.Http = append(t.r.cassette.Http, e)
+	t.r.mu.Unlock()
+	return resp, nil
+}
+
+// readBody reads and replaces *body so that it can be read again.
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+	buf, err := io.ReadAll(*body)
+	(*body).Close()
+	if err != nil {
+		return nil, err
+	}
+	*body = io.NopCloser(bytes.NewReader(buf))
+	return buf, nil
+}
@@ -0,0 +1,211 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/qlik-oss/enigma-go/v4"
+)
+
+// ERR_NOT_RECORDED is the JSON-RPC error code returned for requests missing in the cassette.
+const ERR_NOT_RECORDED = -32099
+
+// Replayer serves traffic of a Cassette, the i-th dialed connection replays the i-th Session.
+type Replayer struct {
+	Scrub *ScrubOptions // applied to requests before matching, must be the options used when recording
+
+	mu       sync.Mutex
+	cassette *Cassette
+	dials    int
+	httpUsed map[int]bool
+	misses   []string
+}
+
+func NewReplayer(c *Cassette) *Replayer {
+	return &Replayer{Scrub: DefaultScrubOptions(), cassette: c, httpUsed: make(map[int]bool)}
+}
+
+// DialerHook makes connections dialed with d replay the cassette, assign it to `engine.Config.DialerHook`.
+func (p *Replayer) DialerHook(d *enigma.Dialer) {
+	d.CreateSocket = func(ctx context.Context, url string, header http.Header) (enigma.Socket, error) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.dials >= len(p.cassette.Sessions) {
+			p.misses = append(p.misses, "dial "+url)
+			return nil, fmt.Errorf("replay: dial #%d to %s is not recorded, cassette has %d engine sessions",
+				p.dials+1, url, len(p.cassette.Sessions))
+		}
+		s := p.cassette.Sessions[p.dials]
+		p.dials++
+		return newReplaySocket(p, s), nil
+	}
+}
+
+// Transport serves recorded http responses, each exchange is used once. The next transport is never called,
+// the parameter only makes Transport assignable to `rac.Config.WrapTransport` like Recorder.Transport.
+func (p *Replayer) Transport(_ http.RoundTripper) http.RoundTripper {
+	return &replayTransport{p: p}
+}
+
+// Misses returns requests which were not found in the cassette.
+func (p *Replayer) Misses() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string{}, p.misses...)
+}
+
+func (p *Replayer) miss(s string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.misses = append(p.misses, s)
+}
+
+type replaySocket struct {
+	p       *Replayer
+	session *Session
+	used    map[int]bool
+	out     chan []byte
+	mu      sync.Mutex
+	closed  chan struct{}
+	once    sync.Once
+}
+
+func newReplaySocket(p *Replayer, s *Session) *replaySocket {
+	sock := &replaySocket{
+		p:       p,
+		session: s,
+		used:    make(map[int]bool),
+		out:     make(chan []byte, len(s.Greetings)+64),
+		closed:  make(chan struct{}),
+	}
+	for _, g := range s.Greetings {
+		sock.out <- g
+	}
+	return sock
+}
+
+func (s *replaySocket) WriteMessage(_ int, data []byte) error {
+	var req rpcMessage
+	if err := json.Unmarshal(data, &req); err != nil {
+		return err
+	}
+	if req.Id == nil {
+		return nil
+	}
+
+	messages := make([][]byte, 0, 1)
+	e := s.match(req)
+	if e == nil {
+		desc := fmt.Sprintf("%d.%s(%s)", req.Handle, req.Method, normalizeJson(req.Params))
+		s.p.miss(desc)
+		resp, _ := json.Marshal(map[string]any{
+			"jsonrpc": "2.0",
+			"id":      *req.Id,
+			"error":   map[string]any{"code": ERR_NOT_RECORDED, "parameter": desc, "message": "Request is not recorded"},
+		})
+		messages = append(messages, resp)
+	} else {
+		var resp map[string]json.RawMessage
+		if err := json.Unmarshal(e.Response, &resp); err != nil {
+			return err
+		}
+		resp["id"], _ = json.Marshal(*req.Id)
+		buf, err := json.Marshal(resp)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, buf)
+		for _, n := range e.Notifications {
+			messages = append(messages, n)
+		}
+	}
+
+	for _, m := range messages {
+		select {
+		case s.out <- m:
+		case <-s.closed:
+			return errors.New("socket closed")
+		}
+	}
+	return nil
+}
+
+// match finds the first unused exchange with the handle, method and params of req.
+func (s *replaySocket) match(req rpcMessage) *RpcExchange {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	params := normalizeJson(s.p.Scrub.Json(req.Params))
+	for i, e := range s.session.Exchanges {
+		if !s.used[i] && e.Handle == req.Handle && e.Method == req.Method && normalizeJson(e.Params) == params {
+			s.used[i] = true
+			return e
+		}
+	}
+	return nil
+}
+
+func (s *replaySocket) ReadMessage() (int, []byte, error) {
+	select {
+	case m := <-s.out:
+		return websocket.TextMessage, m, nil
+	case <-s.closed:
+		return 0, nil, errors.New("socket closed")
+	}
+}
+
+func (s *replaySocket) Close() error {
+	s.once.Do(func() { close(s.closed) })
+	return nil
+}
+
+type replayTransport struct {
+	p *Replayer
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	p := t.p
+	url := p.Scrub.Url(req.URL)
+	reqBody := p.Scrub.String(string(body))
+
+	p.mu.Lock()
+	var found *HttpExchange
+	for i, e := range p.cassette.Http {
+		if !p.httpUsed[i] && e.Method == req.Method && e.Url == url && e.Body == reqBody {
+			p.httpUsed[i] = true
+			found = e
+			break
+		}
+	}
+	p.mu.Unlock()
+
+	if found == nil {
+		p.miss(req.Method + " " + url)
+		return nil, fmt.Errorf("replay: %s %s is not recorded", req.Method, url)
+	}
+	header := found.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", found.Status, http.StatusText(found.Status)),
+		StatusCode:    found.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader([]byte(found.ResponseBody))),
+		ContentLength: int64(len(found.ResponseBody)),
+		Request:       req,
+	}, nil
+}
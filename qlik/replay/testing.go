@@ -0,0 +1,63 @@
+package replay
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/qlik-oss/enigma-go/v4"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+	"github.com/soderasen-au/go-qlik/qlik/engine/enginetest"
+)
+
+// RECORD_ENV set to a non-empty value makes OpenDoc record cassettes instead of replaying them.
+const RECORD_ENV = "QLIK_REPLAY_RECORD"
+
+// OpenDoc opens the first app of fixture f in a new session replaying cassette `path`, the test fails
+// if a request is missing in the cassette. With RECORD_ENV set, f is served by enginetest and the
+// session is recorded into path when the test ends.
+func OpenDoc(t testing.TB, f *enginetest.Fixture, path string) *enigma.Doc {
+	t.Helper()
+	if f == nil || len(f.Apps) == 0 {
+		t.Fatalf("OpenDoc: fixture has no app")
+	}
+	appId := f.Apps[0].Id
+
+	if os.Getenv(RECORD_ENV) != "" {
+		srv := enginetest.NewServer(f)
+		t.Cleanup(srv.Close)
+		cfg := *srv.Config(appId).OnPrem
+		rec := NewRecorder(nil)
+		cfg.DialerHook = rec.DialerHook
+		// cleanups run last in first out, so this one saves after the session is closed
+		t.Cleanup(func() {
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Errorf("MkdirAll: %v", err)
+				return
+			}
+			if res := rec.Save(path); res != nil {
+				t.Errorf("Save(%s): %v", path, res)
+			}
+		})
+		return enginetest.ConnectDoc(t, cfg)
+	}
+
+	cassette, res := LoadCassette(path)
+	if res != nil {
+		t.Fatalf("LoadCassette(%s): %v, set %s=1 to record it", path, res, RECORD_ENV)
+	}
+	p := NewReplayer(cassette)
+	t.Cleanup(func() {
+		if misses := p.Misses(); len(misses) != 0 {
+			t.Errorf("requests missing in %s: %v, set %s=1 to record it again", path, misses, RECORD_ENV)
+		}
+	})
+	return enginetest.ConnectDoc(t, engine.Config{
+		EngineURI:  "ws://replay",
+		AppID:      appId,
+		AuthMode:   engine.AUTH_MODE_DESKTOP,
+		ServerType: engine.ST_ON_PREM,
+		DialerHook: p.DialerHook,
+	})
+}
@@ -0,0 +1,251 @@
+// Package snapshot persists app snapshots taken by `engine.RecursiveGetSnapshots` as baselines
+// for regression testing. Snapshots are gzipped JSON files laid out as
+//
+//	<root>/<app id>/<bookmark id or _>/<timestamp>.json.gz
+//
+// and referred to by a file path or `<app id>[/<bookmark id>][@<timestamp prefix>]`,
+// which resolves to the latest matching snapshot.
+package snapshot
+
+import (
+	"cmp"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/rs/zerolog"
+	"github.com/soderasen-au/go-common/util"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+)
+
+const (
+	SNAPSHOT_VERSION = 1
+	SNAPSHOT_EXT     = ".json.gz"
+	NO_BOOKMARK      = "_"
+	TIMESTAMP_FORMAT = "20060102T150405.000Z"
+)
+
+type Snapshot struct {
+	Version       int                                         `json:"version" yaml:"version"`
+	AppId         string                                      `json:"app_id" yaml:"app_id"`
+	AppTitle      string                                      `json:"app_title,omitempty" yaml:"app_title,omitempty"`
+	BookmarkId    string                                      `json:"bookmark_id,omitempty" yaml:"bookmark_id,omitempty"`
+	BookmarkTitle string                                      `json:"bookmark_title,omitempty" yaml:"bookmark_title,omitempty"`
+	TakenAt       time.Time                                   `json:"taken_at" yaml:"taken_at"`
+	Objects       engine.AppWalkResult[engine.ObjectSnapshot] `json:"objects" yaml:"objects"`
+}
+
+// Entry is a snapshot file in a Store.
+type Entry struct {
+	AppId    string    `json:"app_id" yaml:"app_id"`
+	Bookmark string    `json:"bookmark" yaml:"bookmark"` // bookmark id or NO_BOOKMARK
+	TakenAt  time.Time `json:"taken_at" yaml:"taken_at"`
+	Path     string    `json:"path" yaml:"path"`
+}
+
+// Take connects with cfg, applies its bookmark and snapshots all objects of the app.
+func Take(ctx context.Context, cfg engine.MixedConfig, opts *engine.WalkOptions, logger *zerolog.Logger) (*Snapshot, *util.Result) {
+	conn, res := cfg.ConnectContext(ctx)
+	if res != nil {
+		return nil, res.With("Connect")
+	}
+	defer conn.Global.DisconnectFromServer()
+	doc, err := conn.Global.OpenDoc(ctx, cfg.AppId, "", "", "", false)
+	if err != nil {
+		return nil, util.Error("OpenDoc", err)
+	}
+	return TakeDoc(ctx, doc, cfg, opts, logger)
+}
+
+// TakeDoc snapshots doc after applying the bookmark of cfg. With a bookmark, objects are not retried
+// on a new connection, which wouldn't have its selections, so `opts.OpendocRetries` is ignored.
+func TakeDoc(ctx context.Context, doc *enigma.Doc, cfg engine.MixedConfig, opts *engine.WalkOptions, logger *zerolog.Logger) (*Snapshot, *util.Result) {
+	layout, err := doc.GetAppLayout(ctx)
+	if err != nil {
+		return nil, util.Error("GetAppLayout", err)
+	}
+	bmId, res := cfg.ApplyBookmarkContext(ctx, doc)
+	if res != nil {
+		return nil, res.With("ApplyBookmark")
+	}
+	if bmId != "" {
+		walkOpts := *cmp.Or(opts, engine.DefaultWalkOptions())
+		walkOpts.OpendocRetries = 0
+		opts = &walkOpts
+	}
+	objects, res := engine.RecursiveGetSnapshotsContext(ctx, doc, cfg, opts, logger)
+	if res != nil {
+		return nil, res.With("RecursiveGetSnapshots")
+	}
+
+	appId := cfg.AppId
+	if appId == "" {
+		appId = layout.FileName
+	}
+	return &Snapshot{
+		Version:       SNAPSHOT_VERSION,
+		AppId:         appId,
+		AppTitle:      layout.Title,
+		BookmarkId:    bmId,
+		BookmarkTitle: util.MaybeNil(cfg.BmTitle),
+		TakenAt:       time.Now().UTC(),
+		Objects:       objects,
+	}, nil
+}
+
+// Diff compares objects of s and to.
+func (s *Snapshot) Diff(to *Snapshot, opts *engine.DiffOptions) (*engine.AppDiff, *util.Result) {
+	return engine.SnapshotDiff(s.Objects, to.Objects, opts)
+}
+
+func Save(path string, s *Snapshot) *util.Result {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return util.Error("MkdirAll", err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return util.Error("CreateFile", err)
+	}
+	zw := gzip.NewWriter(f)
+	if err := json.NewEncoder(zw).Encode(s); err != nil {
+		f.Close()
+		return util.Error("EncodeSnapshot", err)
+	}
+	if err := zw.Close(); err != nil {
+		f.Close()
+		return util.Error("CloseGzip", err)
+	}
+	if err := f.Close(); err != nil {
+		return util.Error("CloseFile", err)
+	}
+	return nil
+}
+
+func Load(path string) (*Snapshot, *util.Result) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, util.Error("OpenFile", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, util.Error("GzipReader", err)
+	}
+	defer zr.Close()
+	var s Snapshot
+	if err := json.NewDecoder(zr).Decode(&s); err != nil {
+		return nil, util.Error("DecodeSnapshot", err)
+	}
+	if s.Version != SNAPSHOT_VERSION {
+		return nil, util.Errorf("unsupported snapshot version %d", s.Version)
+	}
+	return &s, nil
+}
+
+// Store keeps snapshots under Root.
+type Store struct {
+	Root string `json:"root" yaml:"root"`
+}
+
+func NewStore(root string) *Store {
+	return &Store{Root: root}
+}
+
+var unsafePathChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+func pathKey(s string) string {
+	if s == "" {
+		return NO_BOOKMARK
+	}
+	return unsafePathChars.ReplaceAllString(s, "_")
+}
+
+// Save writes s into the store and returns its entry.
+func (st *Store) Save(s *Snapshot) (*Entry, *util.Result) {
+	if s.AppId == "" {
+		return nil, util.MsgError("Save", "snapshot has no app id")
+	}
+	e := &Entry{AppId: s.AppId, Bookmark: pathKey(s.BookmarkId), TakenAt: s.TakenAt.UTC()}
+	e.Path = filepath.Join(st.Root, pathKey(s.AppId), e.Bookmark, e.TakenAt.Format(TIMESTAMP_FORMAT)+SNAPSHOT_EXT)
+	if res := Save(e.Path, s); res != nil {
+		return nil, res.With("Save " + e.Path)
+	}
+	return e, nil
+}
+
+// List returns snapshots of an app with bookmark, "" means without bookmark, oldest first.
+func (st *Store) List(appId, bookmark string) ([]*Entry, *util.Result) {
+	dir := filepath.Join(st.Root, pathKey(appId), pathKey(bookmark))
+	files, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []*Entry{}, nil
+	}
+	if err != nil {
+		return nil, util.Error("ReadDir", err)
+	}
+	entries := make([]*Entry, 0, len(files))
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), SNAPSHOT_EXT) {
+			continue
+		}
+		ts, err := time.Parse(TIMESTAMP_FORMAT, strings.TrimSuffix(f.Name(), SNAPSHOT_EXT))
+		if err != nil {
+			continue
+		}
+		entries = append(entries, &Entry{AppId: appId, Bookmark: pathKey(bookmark), TakenAt: ts, Path: filepath.Join(dir, f.Name())})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].TakenAt.Before(entries[j].TakenAt) })
+	return entries, nil
+}
+
+// Latest returns the latest snapshot of an app with bookmark, or nil if there's none.
+func (st *Store) Latest(appId, bookmark string) (*Entry, *util.Result) {
+	entries, res := st.List(appId, bookmark)
+	if res != nil {
+		return nil, res
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	return entries[len(entries)-1], nil
+}
+
+// Find resolves ref, which is a file path or `<app id>[/<bookmark id>][@<timestamp prefix>]`.
+func (st *Store) Find(ref string) (*Entry, *util.Result) {
+	if info, err := os.Stat(ref); err == nil && !info.IsDir() {
+		return &Entry{Path: ref}, nil
+	}
+	key, ts, _ := strings.Cut(ref, "@")
+	appId, bookmark, _ := strings.Cut(key, "/")
+	if appId == "" {
+		return nil, util.MsgError("Find", "invalid snapshot reference "+ref)
+	}
+	entries, res := st.List(appId, bookmark)
+	if res != nil {
+		return nil, res.With("List")
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if strings.HasPrefix(entries[i].TakenAt.Format(TIMESTAMP_FORMAT), ts) {
+			return entries[i], nil
+		}
+	}
+	return nil, util.MsgError("Find", fmt.Sprintf("no snapshot found for %s in %s", ref, st.Root))
+}
+
+// Load loads the snapshot of ref, see Find.
+func (st *Store) Load(ref string) (*Snapshot, *util.Result) {
+	e, res := st.Find(ref)
+	if res != nil {
+		return nil, res
+	}
+	return Load(e.Path)
+}
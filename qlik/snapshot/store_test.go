@@ -0,0 +1,110 @@
+package snapshot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/soderasen-au/go-common/loggers"
+	"github.com/soderasen-au/go-common/util"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+	"github.com/soderasen-au/go-qlik/qlik/engine/enginetest"
+)
+
+func TestTake(t *testing.T) {
+	srv := enginetest.NewServer(enginetest.SalesFixture())
+	t.Cleanup(srv.Close)
+	cfg := srv.Config("sales")
+	cfg.BmTitle = util.Ptr("East")
+	opts := engine.DefaultWalkOptions()
+	opts.OpendocRetries = 0
+	s, res := Take(engine.ConnCtx, cfg, opts, loggers.NullLogger)
+	if res != nil {
+		t.Fatalf("Take: %v", res)
+	}
+	if s.AppId != "sales" || s.BookmarkId != "bm-east" {
+		t.Errorf("Take() = %s/%s", s.AppId, s.BookmarkId)
+	}
+	for listName, list := range s.Objects {
+		for id, obj := range list {
+			if obj == nil || obj.Result == nil {
+				t.Errorf("%s[%s] has no snapshot", listName, id)
+			}
+		}
+	}
+	objects := engine.FlattenList(s.Objects[engine.SHEET_LIST])
+	tbl, ok := objects["tbl-sales"]
+	if !ok || tbl.Result.HyperCube == nil || tbl.Result.HyperCube.Size.Cy == 0 {
+		t.Fatalf("tbl-sales = %s", util.JsonStr(tbl))
+	}
+
+	cfg.BmTitle = util.Ptr("missing")
+	if _, res := Take(engine.ConnCtx, cfg, opts, loggers.NullLogger); res == nil {
+		t.Errorf("Take() with missing bookmark should fail")
+	}
+}
+
+func TestStore(t *testing.T) {
+	st := NewStore(t.TempDir())
+	snapshot := func(ts time.Time, title string) *Snapshot {
+		return &Snapshot{
+			Version:    SNAPSHOT_VERSION,
+			AppId:      "app/1",
+			BookmarkId: "bm",
+			TakenAt:    ts,
+			Objects: engine.AppWalkResult[engine.ObjectSnapshot]{engine.SHEET_LIST: {
+				"obj": {Info: &enigma.NxInfo{Id: "obj", Type: "table"}, Result: &engine.ObjectSnapshot{Title: util.Ptr(title)}},
+			}},
+		}
+	}
+	t1 := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	t2 := t1.Add(24 * time.Hour)
+	for _, s := range []*Snapshot{snapshot(t2, "new"), snapshot(t1, "old")} {
+		if _, res := st.Save(s); res != nil {
+			t.Fatalf("Save: %v", res)
+		}
+	}
+
+	entries, res := st.List("app/1", "bm")
+	if res != nil || len(entries) != 2 || !entries[0].TakenAt.Equal(t1) {
+		t.Fatalf("List() = %s, %v", util.JsonStr(entries), res)
+	}
+	if entries, _ := st.List("app/1", ""); len(entries) != 0 {
+		t.Errorf("List(no bookmark) = %s", util.JsonStr(entries))
+	}
+
+	tests := []struct {
+		ref   string
+		title string
+	}{
+		{"app_1/bm", "new"},
+		{"app_1/bm@20260102", "old"},
+		{entries[0].Path, "old"},
+		{"app_1", ""},
+		{"app_1/bm@2025", ""},
+	}
+	for _, tt := range tests {
+		s, res := st.Load(tt.ref)
+		if tt.title == "" {
+			if res == nil {
+				t.Errorf("Load(%s) should fail", tt.ref)
+			}
+			continue
+		}
+		if res != nil {
+			t.Errorf("Load(%s): %v", tt.ref, res)
+			continue
+		}
+		if got := util.MaybeNil(s.Objects[engine.SHEET_LIST]["obj"].Result.Title); got != tt.title {
+			t.Errorf("Load(%s) title = %s, want %s", tt.ref, got, tt.title)
+		}
+	}
+
+	from, _ := st.Load("app_1/bm@20260102")
+	to, _ := st.Load("app_1/bm")
+	d, res := from.Diff(to, nil)
+	if res != nil || d.Summary.Modified != 1 {
+		t.Errorf("Diff() = %s, %v", util.JsonStr(d), res)
+	}
+}
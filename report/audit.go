@@ -2,56 +2,311 @@ package report
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/qlik-oss/enigma-go/v4"
 	"github.com/soderasen-au/go-common/util"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+)
+
+const (
+	AUDIT_FORMAT_CSV   string = "csv"
+	AUDIT_FORMAT_JSONL string = "jsonl"
+
+	AUDIT_CMD_PRINT   string = "print"
+	AUDIT_CMD_DELIVER string = "deliver"
+
+	auditBackupTimeFormat string = "20060102T150405"
+	auditListSep          string = ";"
 )
 
 type AuditRecord struct {
-	Timestamp       time.Time
-	UserDir         string
-	UserId          string
-	IpAddr          string
-	AppId           string
-	Cmd             string
-	Ids             []string
-	ReportFileName  string
-	ReportFileSize  int
-	ReportTotalRows int
+	Timestamp       time.Time `json:"timestamp"`
+	UserDir         string    `json:"user_dir,omitempty"`
+	UserId          string    `json:"user_id,omitempty"`
+	IpAddr          string    `json:"ip_addr,omitempty"`
+	AppId           string    `json:"app_id,omitempty"`
+	Cmd             string    `json:"cmd,omitempty"`
+	Ids             []string  `json:"ids,omitempty"`
+	ReportFileName  string    `json:"file_name,omitempty"`
+	ReportFileSize  int       `json:"file_size,omitempty"`
+	ReportTotalRows int       `json:"total_rows,omitempty"`
+	Format          string    `json:"format,omitempty"`
+	DurationMs      int64     `json:"duration_ms,omitempty"`
+	Selections      []string  `json:"selections,omitempty"`       // e.g. `Region: EU, US`, alternate states are prefixed `[state] `
+	DeliveryTargets []string  `json:"delivery_targets,omitempty"` // `<sink>:<target>`
+	DeliveryStatus  string    `json:"delivery_status,omitempty"`
+	Error           string    `json:"error,omitempty"`
+}
+
+var auditCSVColumns = []string{
+	"Timestamp", "UserDir", "UserId", "IpAddr", "AppId", "Cmd", "Ids", "FileName", "FileSize", "TotalRows",
+	"Format", "DurationMs", "Selections", "DeliveryTargets", "DeliveryStatus", "Error",
 }
 
+// legacyAuditCSVColumns is the header of csv files of older versions, whose lines have no AppId
+// and ids formatted as `[a b]`, see legacyAuditLine.
+var legacyAuditCSVColumns = auditCSVColumns[:10]
+
 func (f AuditRecord) GetCSVLine() []string {
 	return []string{
 		f.Timestamp.Format(time.RFC3339),
 		f.UserDir,
 		f.UserId,
 		f.IpAddr,
+		f.AppId,
 		f.Cmd,
-		fmt.Sprintf("%v", f.Ids),
+		strings.Join(f.Ids, auditListSep),
 		f.ReportFileName,
 		fmt.Sprintf("%d", f.ReportFileSize),
 		fmt.Sprintf("%d", f.ReportTotalRows),
+		f.Format,
+		fmt.Sprintf("%d", f.DurationMs),
+		strings.Join(f.Selections, auditListSep),
+		strings.Join(f.DeliveryTargets, auditListSep),
+		f.DeliveryStatus,
+		f.Error,
 	}
 }
+
 func GetCSVHeader() string {
-	return fmt.Sprintf("%v,%v,%v,%v,%v,%v,%v,%v,%v,%v\n", "Timestamp", "UserDir", "UserId", "IpAddr", "AppId", "Cmd", "Ids", "FileName", "FileSize", "TotalRows")
+	return strings.Join(auditCSVColumns, ",") + "\n"
+}
+
+// parseAuditCSVLine maps a csv line to record by column names of header, so that files with fewer columns can be read.
+func parseAuditCSVLine(header map[string]int, line []string) AuditRecord {
+	get := func(col string) string {
+		if i, ok := header[col]; ok && i < len(line) {
+			return line[i]
+		}
+		return ""
+	}
+	split := func(col string) []string {
+		if v := get(col); v != "" {
+			return strings.Split(v, auditListSep)
+		}
+		return nil
+	}
+	r := AuditRecord{
+		UserDir:         get("UserDir"),
+		UserId:          get("UserId"),
+		IpAddr:          get("IpAddr"),
+		AppId:           get("AppId"),
+		Cmd:             get("Cmd"),
+		Ids:             split("Ids"),
+		ReportFileName:  get("FileName"),
+		Format:          get("Format"),
+		Selections:      split("Selections"),
+		DeliveryTargets: split("DeliveryTargets"),
+		DeliveryStatus:  get("DeliveryStatus"),
+		Error:           get("Error"),
+	}
+	r.Timestamp, _ = time.Parse(time.RFC3339, get("Timestamp"))
+	r.ReportFileSize, _ = strconv.Atoi(get("FileSize"))
+	r.ReportTotalRows, _ = strconv.Atoi(get("TotalRows"))
+	r.DurationMs, _ = strconv.ParseInt(get("DurationMs"), 10, 64)
+	return r
+}
+
+// legacyAuditLine maps a line written by older versions under legacyAuditCSVColumns.
+func legacyAuditLine(line []string) AuditRecord {
+	cols := slices.Delete(slices.Clone(legacyAuditCSVColumns), 4, 5) // AppId
+	header := make(map[string]int, len(cols))
+	for i, col := range cols {
+		header[col] = i
+	}
+	r := parseAuditCSVLine(header, line)
+	r.Ids = strings.Fields(strings.Trim(line[header["Ids"]], "[]"))
+	return r
+}
+
+// IAuditEncoder writes and reads records of one audit file format.
+type IAuditEncoder interface {
+	FileExt() string
+	WriteHeader(w io.Writer) error
+	Encode(w io.Writer, r AuditRecord) error
+	// Decode calls fn for each record in r until fn returns false
+	Decode(r io.Reader, fn func(AuditRecord) bool) error
+}
+
+type CsvAuditEncoder struct{}
+
+func (e CsvAuditEncoder) FileExt() string {
+	return AUDIT_FORMAT_CSV
+}
+
+func (e CsvAuditEncoder) WriteHeader(w io.Writer) error {
+	_, err := io.WriteString(w, GetCSVHeader())
+	return err
+}
+
+func (e CsvAuditEncoder) Encode(w io.Writer, r AuditRecord) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(r.GetCSVLine()); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (e CsvAuditEncoder) Decode(r io.Reader, fn func(AuditRecord) bool) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	first, err := cr.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	header := make(map[string]int)
+	for i, col := range first {
+		header[strings.TrimSpace(col)] = i
+	}
+	legacy := slices.Equal(first, legacyAuditCSVColumns)
+	for {
+		line, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		r := parseAuditCSVLine(header, line)
+		if legacy && len(line) == len(legacyAuditCSVColumns)-1 {
+			r = legacyAuditLine(line)
+		}
+		if !fn(r) {
+			return nil
+		}
+	}
+}
+
+type JsonlAuditEncoder struct{}
+
+func (e JsonlAuditEncoder) FileExt() string {
+	return AUDIT_FORMAT_JSONL
+}
+
+func (e JsonlAuditEncoder) WriteHeader(w io.Writer) error {
+	return nil
+}
+
+func (e JsonlAuditEncoder) Encode(w io.Writer, r AuditRecord) error {
+	buf, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(buf, '\n'))
+	return err
+}
+
+func (e JsonlAuditEncoder) Decode(r io.Reader, fn func(AuditRecord) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var rec AuditRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return err
+		}
+		if !fn(rec) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+func NewAuditEncoder(format string) (IAuditEncoder, *util.Result) {
+	switch strings.ToLower(format) {
+	case "", AUDIT_FORMAT_CSV:
+		return CsvAuditEncoder{}, nil
+	case AUDIT_FORMAT_JSONL, "json":
+		return JsonlAuditEncoder{}, nil
+	default:
+		return nil, util.MsgError("NewAuditEncoder", fmt.Sprintf("unsupported audit format '%s'", format))
+	}
+}
+
+// AuditLogConfig configures audit file and its rotation.
+// When the file exceeds `MaxSizeMB` or a new `RotateHours` period starts (aligned to UTC, e.g. 24 for daily),
+// it's renamed to `<name>-<rotation time>.<ext>` and a new file is started. 0 disables each rotation;
+// `MaxBackups` limits the number of rotated files kept, 0 keeps all of them.
+type AuditLogConfig struct {
+	FileName    string `json:"file_name" yaml:"file_name" bson:"file_name"`
+	Format      string `json:"format,omitempty" yaml:"format,omitempty" bson:"format,omitempty"` // "csv"(default), "jsonl"
+	MaxSizeMB   int    `json:"max_size_mb,omitempty" yaml:"max_size_mb,omitempty" bson:"max_size_mb,omitempty"`
+	RotateHours int    `json:"rotate_hours,omitempty" yaml:"rotate_hours,omitempty" bson:"rotate_hours,omitempty"`
+	MaxBackups  int    `json:"max_backups,omitempty" yaml:"max_backups,omitempty" bson:"max_backups,omitempty"`
+}
+
+// AuditFilter selects records in Query, zero values match all.
+type AuditFilter struct {
+	UserDir string    `json:"user_dir,omitempty" yaml:"user_dir,omitempty"`
+	UserId  string    `json:"user_id,omitempty" yaml:"user_id,omitempty"`
+	AppId   string    `json:"app_id,omitempty" yaml:"app_id,omitempty"`
+	Cmd     string    `json:"cmd,omitempty" yaml:"cmd,omitempty"`
+	From    time.Time `json:"from,omitempty" yaml:"from,omitempty"` // inclusive
+	To      time.Time `json:"to,omitempty" yaml:"to,omitempty"`     // exclusive
+	Limit   int       `json:"limit,omitempty" yaml:"limit,omitempty"`
+}
+
+func (f AuditFilter) Match(r AuditRecord) bool {
+	if f.UserDir != "" && !strings.EqualFold(f.UserDir, r.UserDir) {
+		return false
+	}
+	if f.UserId != "" && !strings.EqualFold(f.UserId, r.UserId) {
+		return false
+	}
+	if f.AppId != "" && f.AppId != r.AppId {
+		return false
+	}
+	if f.Cmd != "" && f.Cmd != r.Cmd {
+		return false
+	}
+	if !f.From.IsZero() && r.Timestamp.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !r.Timestamp.Before(f.To) {
+		return false
+	}
+	return true
 }
 
 type AuditLog struct {
+	Config   AuditLogConfig
 	fileName string
 	fd       *os.File
-	writer   *csv.Writer
+	encoder  IAuditEncoder
+	size     int64
+	period   time.Time
+	now      func() time.Time
 	mu       sync.Mutex
 }
 
 func (audit *AuditLog) Close() {
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
 	if audit.fd != nil {
 		audit.fd.Close()
+		audit.fd = nil
 	}
 }
 
@@ -59,48 +314,351 @@ func (audit *AuditLog) Record(r AuditRecord) *util.Result {
 	audit.mu.Lock()
 	defer audit.mu.Unlock()
 
-	err := audit.writer.Write(r.GetCSVLine())
+	if audit.fd == nil {
+		return util.MsgError("Record", "audit log is not opened")
+	}
+	if r.Timestamp.IsZero() {
+		r.Timestamp = audit.now()
+	}
+
+	var buf bytes.Buffer
+	if err := audit.encoder.Encode(&buf, r); err != nil {
+		return util.Error("EncodeRecord", err)
+	}
+	// a failed rotation is reported, the record is still written if the current file is open
+	var rotateRes *util.Result
+	if audit.shouldRotate(int64(buf.Len())) {
+		if rotateRes = audit.rotate(); rotateRes != nil {
+			rotateRes = rotateRes.With("Rotate")
+			if audit.fd == nil {
+				return rotateRes
+			}
+		}
+	}
+
+	n, err := audit.fd.Write(buf.Bytes())
+	audit.size += int64(n)
 	if err != nil {
 		return util.Error("WriteRecord", err)
 	}
-	return nil
+	return rotateRes
 }
 
-func (audit *AuditLog) OpenFile(fn string) *util.Result {
-	f, err := os.OpenFile(fn, os.O_RDWR|os.O_CREATE, os.ModePerm)
+func (audit *AuditLog) shouldRotate(n int64) bool {
+	if audit.Config.MaxSizeMB > 0 && audit.size > 0 && audit.size+n > int64(audit.Config.MaxSizeMB)*1024*1024 {
+		return true
+	}
+	if audit.Config.RotateHours > 0 && audit.currentPeriod().After(audit.period) {
+		return true
+	}
+	return false
+}
+
+func (audit *AuditLog) currentPeriod() time.Time {
+	return audit.now().UTC().Truncate(time.Duration(audit.Config.RotateHours) * time.Hour)
+}
+
+// rotate renames current file to a backup and opens a new one, caller must hold the lock.
+func (audit *AuditLog) rotate() *util.Result {
+	if err := audit.fd.Close(); err != nil {
+		return util.Error("CloseFile", err)
+	}
+	audit.fd = nil
+
+	if err := os.Rename(audit.fileName, audit.backupName(audit.fileName)); err != nil {
+		// keep auditing into the current file
+		if res := audit.OpenFile(audit.fileName); res != nil {
+			return res.With("RenameFile: " + err.Error())
+		}
+		return util.Error("RenameFile", err)
+	}
+
+	if res := audit.OpenFile(audit.fileName); res != nil {
+		return res
+	}
+	return audit.removeOldBackups()
+}
+
+// backupName returns a file name not used yet to back up fn.
+func (audit *AuditLog) backupName(fn string) string {
+	ext := filepath.Ext(fn)
+	base := strings.TrimSuffix(fn, ext)
+	backup := fmt.Sprintf("%s-%s%s", base, audit.now().UTC().Format(auditBackupTimeFormat), ext)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(backup); os.IsNotExist(err) {
+			return backup
+		}
+		backup = fmt.Sprintf("%s-%s.%d%s", base, audit.now().UTC().Format(auditBackupTimeFormat), i, ext)
+	}
+}
+
+// backupStaleFile moves fn to a backup if it starts with another header than the encoder writes,
+// e.g. csv of older versions with fewer columns, so that new records are never appended under it.
+func (audit *AuditLog) backupStaleFile(fn string) *util.Result {
+	var header bytes.Buffer
+	if err := audit.encoder.WriteHeader(&header); err != nil {
+		return util.Error("WriteHeader", err)
+	}
+	if header.Len() == 0 {
+		return nil
+	}
+	f, err := os.Open(fn)
+	if os.IsNotExist(err) {
+		return nil
+	}
 	if err != nil {
 		return util.Error("OpenFile", err)
 	}
+	first := make([]byte, header.Len())
+	n, err := io.ReadFull(f, first)
+	f.Close()
+	if n == 0 || bytes.Equal(first, header.Bytes()) {
+		return nil
+	}
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return util.Error("ReadHeader", err)
+	}
+	if err := os.Rename(fn, audit.backupName(fn)); err != nil {
+		return util.Error("RenameFile", err)
+	}
+	return nil
+}
+
+// backupFiles returns rotated files, oldest first
+func (audit *AuditLog) backupFiles() ([]string, *util.Result) {
+	ext := filepath.Ext(audit.fileName)
+	base := strings.TrimSuffix(audit.fileName, ext)
+	matches, err := filepath.Glob(base + "-*" + ext)
+	if err != nil {
+		return nil, util.Error("Glob", err)
+	}
+	prefix := filepath.Base(base) + "-"
+	backups := make([]string, 0, len(matches))
+	for _, m := range matches {
+		ts := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(m), prefix), ext)
+		if i := strings.Index(ts, "."); i > 0 {
+			ts = ts[:i]
+		}
+		if _, err := time.Parse(auditBackupTimeFormat, ts); err == nil {
+			backups = append(backups, m)
+		}
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
 
-	f.Seek(0, 0)
-	scanner := bufio.NewScanner(audit.fd)
-	ok := scanner.Scan()
-	if err := scanner.Err(); !ok && err != nil {
-		return util.Error("Scan", err)
+func (audit *AuditLog) removeOldBackups() *util.Result {
+	if audit.Config.MaxBackups <= 0 {
+		return nil
+	}
+	backups, res := audit.backupFiles()
+	if res != nil {
+		return res
+	}
+	for len(backups) > audit.Config.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return util.Error("RemoveBackup", err)
+		}
+		backups = backups[1:]
 	}
-	firstLine := strings.TrimSpace(scanner.Text())
-	if firstLine == "" {
-		f.Seek(0, 0)
-		_, err := f.WriteString(GetCSVHeader())
+	return nil
+}
+
+// Files returns rotated files and current file, oldest first.
+func (audit *AuditLog) Files() ([]string, *util.Result) {
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+	backups, res := audit.backupFiles()
+	if res != nil {
+		return nil, res
+	}
+	return append(backups, audit.fileName), nil
+}
+
+// Query returns records matching filter from rotated files and current file in the order they were recorded.
+func (audit *AuditLog) Query(filter AuditFilter) ([]AuditRecord, *util.Result) {
+	files, res := audit.Files()
+	if res != nil {
+		return nil, res.With("Files")
+	}
+
+	records := make([]AuditRecord, 0)
+	for _, fn := range files {
+		if !filter.From.IsZero() && fn != audit.fileName {
+			// a backup only contains records before its rotation time
+			if fi, err := os.Stat(fn); err == nil && fi.ModTime().Before(filter.From) {
+				continue
+			}
+		}
+		done := false
+		err := audit.decodeFile(fn, func(r AuditRecord) bool {
+			if filter.Match(r) {
+				records = append(records, r)
+			}
+			done = filter.Limit > 0 && len(records) >= filter.Limit
+			return !done
+		})
 		if err != nil {
+			return nil, util.Error("Decode "+fn, err)
+		}
+		if done {
+			break
+		}
+	}
+	return records, nil
+}
+
+func (audit *AuditLog) decodeFile(fn string, cb func(AuditRecord) bool) error {
+	// current file is appended by Record, hold the lock to never read a partial record
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+	f, err := os.Open(fn)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return audit.encoder.Decode(f, cb)
+}
+
+func (audit *AuditLog) OpenFile(fn string) *util.Result {
+	if audit.encoder == nil {
+		encoder, res := NewAuditEncoder(audit.Config.Format)
+		if res != nil {
+			return res
+		}
+		audit.encoder = encoder
+	}
+	if audit.now == nil {
+		audit.now = time.Now
+	}
+
+	if dir := filepath.Dir(fn); dir != "" {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return util.Error("MkdirAll", err)
+		}
+	}
+	if res := audit.backupStaleFile(fn); res != nil {
+		return res.With("BackupStaleFile")
+	}
+	f, err := os.OpenFile(fn, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return util.Error("OpenFile", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return util.Error("Stat", err)
+	}
+	if fi.Size() == 0 {
+		if err = audit.encoder.WriteHeader(f); err != nil {
+			f.Close()
 			return util.Error("WriteHeader", err)
 		}
+		fi, _ = f.Stat()
 	}
-	f.Seek(0, 2) //to the end of file
 
 	audit.fileName = fn
 	audit.fd = f
-	audit.writer = csv.NewWriter(audit.fd)
+	audit.size = fi.Size()
+	if audit.Config.RotateHours > 0 {
+		audit.period = fi.ModTime().UTC().Truncate(time.Duration(audit.Config.RotateHours) * time.Hour)
+		if fi.Size() == 0 || audit.period.After(audit.currentPeriod()) {
+			audit.period = audit.currentPeriod()
+		}
+	}
 
 	return nil
 }
 
+// NewAuditLog opens a csv audit log without rotation, `.jsonl` file is written as JSON lines.
 func NewAuditLog(fn string) (*AuditLog, *util.Result) {
-	auditLog := &AuditLog{}
-	res := auditLog.OpenFile(fn)
+	cfg := AuditLogConfig{FileName: fn, Format: AUDIT_FORMAT_CSV}
+	if ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(fn), ".")); ext == AUDIT_FORMAT_JSONL {
+		cfg.Format = AUDIT_FORMAT_JSONL
+	}
+	return NewAuditLogWithConfig(cfg)
+}
+
+func NewAuditLogWithConfig(cfg AuditLogConfig) (*AuditLog, *util.Result) {
+	if cfg.FileName == "" {
+		return nil, util.MsgError("NewAuditLog", "no audit file name")
+	}
+	auditLog := &AuditLog{Config: cfg}
+	res := auditLog.OpenFile(cfg.FileName)
 	if res != nil {
 		return nil, res.With("OpenFile")
 	}
 
 	return auditLog, nil
 }
+
+// NewPrintAuditRecord creates the audit record of printing r, current selections are read from `r.Doc`,
+// so it should be created before selections are changed.
+func NewPrintAuditRecord(r Report, rr *ReportResult, started time.Time, printRes *util.Result) AuditRecord {
+	rec := AuditRecord{
+		Timestamp:  time.Now(),
+		AppId:      r.AppId,
+		Cmd:        AUDIT_CMD_PRINT,
+		Ids:        []string{util.MaybeNil(r.ID)},
+		DurationMs: time.Since(started).Milliseconds(),
+		Selections: auditSelections(r.Doc, r.SelectedStates),
+	}
+	if r.OutputFormat != nil {
+		rec.Format = string(*r.OutputFormat)
+	}
+	if rr != nil {
+		rec.ReportFileName = util.MaybeNil(rr.ReportFile)
+		rec.ReportTotalRows = rr.PrintedRows
+		if fi, err := os.Stat(rec.ReportFileName); err == nil {
+			rec.ReportFileSize = int(fi.Size())
+		}
+		failed := false
+		for _, dr := range rr.Deliveries {
+			rec.DeliveryTargets = append(rec.DeliveryTargets, fmt.Sprintf("%s:%s", dr.Sink, dr.Target))
+			failed = failed || dr.Result != nil
+		}
+		if len(rr.Deliveries) > 0 {
+			rec.DeliveryStatus = DELIVERY_STATUS_DELIVERED
+			if failed {
+				rec.DeliveryStatus = DELIVERY_STATUS_FAILED
+			}
+		}
+	}
+	if printRes != nil {
+		rec.Error = printRes.Error()
+	}
+	return rec
+}
+
+// auditSelections lists current selections of default state and states in selectedStates.
+func auditSelections(doc *enigma.Doc, selectedStates map[string]int) []string {
+	if doc == nil {
+		return nil
+	}
+	states := []string{"$"}
+	for state := range selectedStates {
+		if state != "$" {
+			states = append(states, state)
+		}
+	}
+	sort.Strings(states[1:])
+
+	selections := make([]string, 0)
+	for _, state := range states {
+		selObj, res := engine.GetCurrentSelection(doc, state)
+		if res != nil || selObj == nil {
+			continue
+		}
+		for _, item := range selObj.Selections {
+			sel := fmt.Sprintf("%s: %s", item.Field, item.Selected)
+			if state != "$" {
+				sel = fmt.Sprintf("[%s] %s", state, sel)
+			}
+			selections = append(selections, sel)
+		}
+	}
+	return selections
+}
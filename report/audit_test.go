@@ -0,0 +1,322 @@
+package report
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/soderasen-au/go-common/util"
+)
+
+func testAuditRecord(ts time.Time, user, app string) AuditRecord {
+	return AuditRecord{
+		Timestamp:       ts,
+		UserDir:         "CORP",
+		UserId:          user,
+		IpAddr:          "10.0.0.1",
+		AppId:           app,
+		Cmd:             AUDIT_CMD_PRINT,
+		Ids:             []string{"r1", "r2"},
+		ReportFileName:  "/out/sales.pdf",
+		ReportFileSize:  1024,
+		ReportTotalRows: 42,
+		Format:          string(REPORT_FORMAT_PDF),
+		DurationMs:      1500,
+		Selections:      []string{"Region: EU, US", "[Compare] Year: 2024"},
+		DeliveryTargets: []string{"email:alice@example.com"},
+		DeliveryStatus:  DELIVERY_STATUS_DELIVERED,
+		Error:           "",
+	}
+}
+
+func TestAuditRecord_GetCSVLine(t *testing.T) {
+	header := strings.Split(strings.TrimSpace(GetCSVHeader()), ",")
+	line := testAuditRecord(time.Now(), "alice", "app-1").GetCSVLine()
+	if len(line) != len(header) {
+		t.Fatalf("csv line has %d columns, header has %d", len(line), len(header))
+	}
+	for i, col := range header {
+		if col == "AppId" && line[i] != "app-1" {
+			t.Errorf("AppId column = %s", line[i])
+		}
+	}
+}
+
+func TestAuditLog_RecordAndQuery(t *testing.T) {
+	for _, format := range []string{AUDIT_FORMAT_CSV, AUDIT_FORMAT_JSONL} {
+		t.Run(format, func(t *testing.T) {
+			fn := filepath.Join(t.TempDir(), "audit."+format)
+			audit, res := NewAuditLog(fn)
+			if res != nil {
+				t.Fatalf("NewAuditLog: %s", res.Error())
+			}
+
+			base := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+			want := testAuditRecord(base, "alice", "app-1")
+			records := []AuditRecord{
+				want,
+				testAuditRecord(base.Add(time.Hour), "bob", "app-1"),
+				testAuditRecord(base.Add(2*time.Hour), "alice", "app-2"),
+			}
+			records[2].Error = "Print | -1 | engine, \"closed\""
+			for _, r := range records {
+				if res := audit.Record(r); res != nil {
+					t.Fatalf("Record: %s", res.Error())
+				}
+			}
+			audit.Close()
+
+			// reopen appends without another header
+			audit, res = NewAuditLog(fn)
+			if res != nil {
+				t.Fatalf("reopen: %s", res.Error())
+			}
+			defer audit.Close()
+			if res := audit.Record(testAuditRecord(base.Add(3*time.Hour), "carol", "app-1")); res != nil {
+				t.Fatalf("Record: %s", res.Error())
+			}
+
+			all, res := audit.Query(AuditFilter{})
+			if res != nil {
+				t.Fatalf("Query: %s", res.Error())
+			}
+			if len(all) != 4 {
+				t.Fatalf("expected 4 records, got %d", len(all))
+			}
+			if !all[0].Timestamp.Equal(want.Timestamp) {
+				t.Errorf("timestamp = %v, want %v", all[0].Timestamp, want.Timestamp)
+			}
+			all[0].Timestamp = want.Timestamp
+			if !reflect.DeepEqual(all[0], want) {
+				t.Errorf("decoded record = %+v\nwant %+v", all[0], want)
+			}
+			if all[2].Error != records[2].Error {
+				t.Errorf("error = %q, want %q", all[2].Error, records[2].Error)
+			}
+
+			tests := []struct {
+				name   string
+				filter AuditFilter
+				want   int
+			}{
+				{"by user", AuditFilter{UserId: "ALICE"}, 2},
+				{"by app", AuditFilter{AppId: "app-1"}, 3},
+				{"by user and app", AuditFilter{UserId: "alice", AppId: "app-1"}, 1},
+				{"time range", AuditFilter{From: base.Add(time.Hour), To: base.Add(3 * time.Hour)}, 2},
+				{"limit", AuditFilter{AppId: "app-1", Limit: 2}, 2},
+				{"no match", AuditFilter{Cmd: AUDIT_CMD_DELIVER}, 0},
+			}
+			for _, tt := range tests {
+				got, res := audit.Query(tt.filter)
+				if res != nil {
+					t.Fatalf("%s: Query: %s", tt.name, res.Error())
+				}
+				if len(got) != tt.want {
+					t.Errorf("%s: got %d records, want %d", tt.name, len(got), tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestAuditLog_RotateBySize(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "audit.jsonl")
+	audit, res := NewAuditLogWithConfig(AuditLogConfig{FileName: fn, Format: AUDIT_FORMAT_JSONL, MaxSizeMB: 1, MaxBackups: 2})
+	if res != nil {
+		t.Fatalf("NewAuditLogWithConfig: %s", res.Error())
+	}
+	defer audit.Close()
+
+	clock := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	audit.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+
+	big := strings.Repeat("x", 400*1024)
+	for i := 0; i < 10; i++ {
+		r := testAuditRecord(time.Time{}, "alice", "app-1")
+		r.Error = big
+		if res := audit.Record(r); res != nil {
+			t.Fatalf("Record %d: %s", i, res.Error())
+		}
+	}
+
+	files, res := audit.Files()
+	if res != nil {
+		t.Fatalf("Files: %s", res.Error())
+	}
+	if len(files) != 3 {
+		t.Fatalf("expected 2 backups and current file, got %v", files)
+	}
+	for _, f := range files {
+		fi, err := os.Stat(f)
+		if err != nil {
+			t.Fatalf("Stat: %v", err)
+		}
+		if fi.Size() > 1024*1024 {
+			t.Errorf("%s exceeds max size: %d", f, fi.Size())
+		}
+	}
+
+	// 2 records per file, oldest backups are removed
+	got, res := audit.Query(AuditFilter{})
+	if res != nil {
+		t.Fatalf("Query: %s", res.Error())
+	}
+	if len(got) != 6 {
+		t.Errorf("expected 6 records kept, got %d", len(got))
+	}
+}
+
+func TestAuditLog_RotateRenameFailure(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "audit.jsonl")
+	clock := time.Date(2025, 3, 1, 22, 0, 0, 0, time.UTC)
+	audit := &AuditLog{Config: AuditLogConfig{FileName: fn, Format: AUDIT_FORMAT_JSONL, RotateHours: 24}, now: func() time.Time { return clock }}
+	if res := audit.OpenFile(fn); res != nil {
+		t.Fatalf("OpenFile: %s", res.Error())
+	}
+	defer audit.Close()
+
+	if res := audit.Record(testAuditRecord(time.Time{}, "alice", "app-1")); res != nil {
+		t.Fatalf("Record: %s", res.Error())
+	}
+	// the file to rename is gone, so rotation fails
+	if err := os.Remove(fn); err != nil {
+		t.Fatal(err)
+	}
+	clock = clock.Add(3 * time.Hour)
+	if res := audit.Record(testAuditRecord(time.Time{}, "bob", "app-1")); res == nil {
+		t.Error("expected rotation error")
+	}
+	clock = clock.Add(time.Hour)
+	if res := audit.Record(testAuditRecord(time.Time{}, "carol", "app-1")); res != nil {
+		t.Fatalf("Record after failed rotation: %s", res.Error())
+	}
+
+	got, res := audit.Query(AuditFilter{})
+	if res != nil {
+		t.Fatalf("Query: %s", res.Error())
+	}
+	if len(got) != 2 || got[0].UserId != "bob" || got[1].UserId != "carol" {
+		t.Errorf("unexpected records after failed rotation: %+v", got)
+	}
+}
+
+func TestAuditLog_RotateByTime(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "audit.csv")
+	clock := time.Date(2025, 3, 1, 22, 0, 0, 0, time.UTC)
+	audit := &AuditLog{Config: AuditLogConfig{FileName: fn, RotateHours: 24}, now: func() time.Time { return clock }}
+	if res := audit.OpenFile(fn); res != nil {
+		t.Fatalf("OpenFile: %s", res.Error())
+	}
+	defer audit.Close()
+
+	record := func(user string) {
+		if res := audit.Record(testAuditRecord(time.Time{}, user, "app-1")); res != nil {
+			t.Fatalf("Record: %s", res.Error())
+		}
+	}
+	record("alice")
+	clock = clock.Add(time.Hour)
+	record("bob")
+	clock = clock.Add(2 * time.Hour) // next day
+	record("carol")
+
+	files, res := audit.Files()
+	if res != nil {
+		t.Fatalf("Files: %s", res.Error())
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 1 backup and current file, got %v", files)
+	}
+	if want := filepath.Join(filepath.Dir(fn), "audit-20250302T010000.csv"); files[0] != want {
+		t.Errorf("backup = %s, want %s", files[0], want)
+	}
+
+	got, res := audit.Query(AuditFilter{From: time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)})
+	if res != nil {
+		t.Fatalf("Query: %s", res.Error())
+	}
+	if len(got) != 1 || got[0].UserId != "carol" {
+		t.Errorf("unexpected records of 2025-03-02: %+v", got)
+	}
+	buf, _ := os.ReadFile(fn)
+	if !strings.HasPrefix(string(buf), GetCSVHeader()) {
+		t.Error("rotated csv file should start with header")
+	}
+}
+
+func TestAuditLog_LegacyFile(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "audit.csv")
+	// written by older versions: the header has AppId but lines don't
+	legacy := "Timestamp,UserDir,UserId,IpAddr,AppId,Cmd,Ids,FileName,FileSize,TotalRows\n" +
+		"2024-01-02T03:04:05Z,CORP,alice,10.0.0.1,print,[r1 r2],/out/a.xlsx,10,2\n"
+	if err := os.WriteFile(fn, []byte(legacy), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	audit, res := NewAuditLog(fn)
+	if res != nil {
+		t.Fatalf("NewAuditLog: %s", res.Error())
+	}
+	defer audit.Close()
+	rec := AuditRecord{UserId: "alice", AppId: "app-2", Cmd: AUDIT_CMD_PRINT, Format: "pdf", DurationMs: 1500,
+		Selections: []string{"Region: EU"}, DeliveryTargets: []string{"folder:/drop"}, DeliveryStatus: DELIVERY_STATUS_DELIVERED, Error: "none"}
+	if res := audit.Record(rec); res != nil {
+		t.Fatalf("Record: %s", res.Error())
+	}
+
+	files, res := audit.Files()
+	if res != nil || len(files) != 2 {
+		t.Fatalf("Files() = %v, %v", files, res)
+	}
+	buf, err := os.ReadFile(fn)
+	if err != nil || !strings.HasPrefix(string(buf), GetCSVHeader()) {
+		t.Errorf("current file = %s, %v", buf, err)
+	}
+	got, res := audit.Query(AuditFilter{UserId: "alice"})
+	if res != nil {
+		t.Fatalf("Query: %s", res.Error())
+	}
+	if len(got) != 2 {
+		t.Fatalf("records = %+v", got)
+	}
+	if g := got[0]; g.AppId != "" || g.Cmd != AUDIT_CMD_PRINT || !reflect.DeepEqual(g.Ids, []string{"r1", "r2"}) ||
+		g.ReportFileName != "/out/a.xlsx" || g.ReportFileSize != 10 || g.ReportTotalRows != 2 {
+		t.Errorf("legacy record = %+v", g)
+	}
+	rec.Timestamp = got[1].Timestamp
+	if !reflect.DeepEqual(got[1], rec) {
+		t.Errorf("record = %+v, want %+v", got[1], rec)
+	}
+}
+
+func TestNewPrintAuditRecord(t *testing.T) {
+	fn, content := writeTestReportFile(t)
+	r := Report{ID: util.Ptr("r1"), AppId: "app-1", OutputFormat: util.Ptr(REPORT_FORMAT_CSV)}
+	rr := &ReportResult{
+		ID:          "r1",
+		ReportFile:  &fn,
+		PrintedRows: 2,
+		Deliveries: []*DeliveryResult{
+			{Sink: DELIVERY_FOLDER, Target: "/drop/sales.csv"},
+			{Sink: DELIVERY_S3, Target: "s3://b/sales.csv", Result: util.MsgError("PutObject", "403")},
+		},
+	}
+	rec := NewPrintAuditRecord(r, rr, time.Now().Add(-time.Second), util.MsgError("Deliver", "failed"))
+	if rec.Cmd != AUDIT_CMD_PRINT || rec.Format != "csv" || rec.ReportFileSize != len(content) {
+		t.Errorf("unexpected record: %+v", rec)
+	}
+	if rec.DurationMs < 1000 {
+		t.Errorf("duration = %d ms", rec.DurationMs)
+	}
+	if len(rec.DeliveryTargets) != 2 || rec.DeliveryStatus != DELIVERY_STATUS_FAILED {
+		t.Errorf("unexpected delivery: %v %s", rec.DeliveryTargets, rec.DeliveryStatus)
+	}
+	if !strings.Contains(rec.Error, "failed") {
+		t.Errorf("error = %s", rec.Error)
+	}
+}
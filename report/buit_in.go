@@ -1,12 +1,20 @@
 package report
 
-import "github.com/soderasen-au/go-common/util"
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/soderasen-au/go-common/util"
+)
 
 type BuiltInReportPrinter struct {
 	ExcelPrinter       *ExcelReportPrinter
 	ExcelPagingPrinter *ExcelPagingPrinter
 	CsvPrinter         *CsvReportPrinter
 	PdfPrinter         *PdfReportPrinter
+	AuditLog           *AuditLog // optional, records prints and deliveries
 }
 
 func NewBuiltInReportPrinter() *BuiltInReportPrinter {
@@ -39,10 +47,31 @@ func (p *BuiltInReportPrinter) Print(r Report) *util.Result {
 	if r.OutputFormat == nil {
 		r.OutputFormat = util.Ptr(REPORT_FORMAT_XLSX)
 	}
+	if r.Delivery != nil {
+		if res := r.Delivery.Validate(); res != nil {
+			return res.With("ValidateDelivery")
+		}
+	}
 
 	p.ExcelPrinter.R = r
 	p.CsvPrinter.R = r
 	p.PdfPrinter.R = r
+	started := time.Now()
+	res := p.print(r)
+	if res == nil && r.Delivery != nil {
+		res = p.deliver(r)
+	}
+
+	if p.AuditLog != nil {
+		rr, _ := p.GetReportResult(util.MaybeNil(r.ID))
+		if auditRes := p.AuditLog.Record(NewPrintAuditRecord(r, rr, started, res)); auditRes != nil && rr != nil && rr.Logger != nil {
+			rr.Logger.Error().Msgf("audit print failed: %s", auditRes.Error())
+		}
+	}
+	return res
+}
+
+func (p *BuiltInReportPrinter) print(r Report) *util.Result {
 	if r.OutputFormat.IsExcel() {
 		return p.ExcelPrinter.Print(r)
 	} else if r.OutputFormat.IsPagedExcel() {
@@ -55,3 +84,26 @@ func (p *BuiltInReportPrinter) Print(r Report) *util.Result {
 		return util.MsgError("Print", "built_in printer doesn't support output format: "+string(*r.OutputFormat))
 	}
 }
+
+func (p *BuiltInReportPrinter) deliver(r Report) *util.Result {
+	rr, res := p.GetReportResult(util.MaybeNil(r.ID))
+	if res != nil {
+		return res.With("Deliver")
+	}
+	ctx := r.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	rr.Deliveries = r.Delivery.DeliverContext(ctx, r, rr, p.AuditLog)
+
+	failed := make([]string, 0)
+	for _, dr := range rr.Deliveries {
+		if dr.Result != nil {
+			failed = append(failed, fmt.Sprintf("%s[%s]", dr.Sink, dr.Target))
+		}
+	}
+	if len(failed) > 0 {
+		return util.MsgError("Deliver", "failed to deliver to "+strings.Join(failed, ", "))
+	}
+	return nil
+}
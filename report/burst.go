@@ -0,0 +1,329 @@
+package report
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/rs/zerolog"
+	"github.com/soderasen-au/go-common/loggers"
+	"github.com/soderasen-au/go-common/util"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+)
+
+const (
+	BURST_PLACEHOLDER_VALUE string = "{{value}}"
+	BURST_PLACEHOLDER_FIELD string = "{{field}}"
+	BURST_PLACEHOLDER_INDEX string = "{{index}}"
+
+	DEFAULT_BURST_DELIMITER string = "|"
+)
+
+// states of a field value which can be selected when bursting: optional, selected, locked and alternative
+var burstableStates = map[string]bool{"O": true, "S": true, "L": true, "A": true}
+
+// BurstConfig splits one report into one report per value of `Field`.
+//
+// Values are taken from, in order of precedence:
+//   - `Values`
+//   - `ValuesExpr` evaluated in each doc and split by `Delimiter`, e.g. `=Concat(DISTINCT [Sales Rep], '|')`
+//   - all possible values of `Field` under current selection of each doc
+//
+// `NameTemplate` supports `{{value}}`, `{{field}}` and `{{index}}` (1-based),
+// e.g. `Sales_{{value}}.pdf`; the extension of the output format is optional.
+type BurstConfig struct {
+	Field        string   `json:"field" yaml:"field" bson:"field"`
+	StateName    string   `json:"state_name,omitempty" yaml:"state_name,omitempty" bson:"state_name,omitempty"`
+	Values       []string `json:"values,omitempty" yaml:"values,omitempty" bson:"values,omitempty"`
+	ValuesExpr   string   `json:"values_expr,omitempty" yaml:"values_expr,omitempty" bson:"values_expr,omitempty"`
+	Delimiter    string   `json:"delimiter,omitempty" yaml:"delimiter,omitempty" bson:"delimiter,omitempty"`
+	NameTemplate string   `json:"name_template,omitempty" yaml:"name_template,omitempty" bson:"name_template,omitempty"`
+}
+
+func (c BurstConfig) Validate() *util.Result {
+	if c.Field == "" {
+		return util.MsgError("ValidateBurst", "no burst field")
+	}
+	return nil
+}
+
+type BurstResult struct {
+	Value        string        `json:"value" yaml:"value"`
+	ReportResult *ReportResult `json:"report_result,omitempty" yaml:"report_result,omitempty"`
+	Result       *util.Result  `json:"result,omitempty" yaml:"result,omitempty"`
+}
+
+// ReportBurster prints one report per burst value.
+// Selections are made on the report doc, so each doc in `Docs` must be opened in its own engine session;
+// bursting runs in parallel with one worker per doc. If `Docs` is empty, `Report.Doc` is used.
+// Docs may hold different apps or different selections: burst values are the union of values of all docs
+// and each value is printed by a doc having it, while `Values` are printed by any doc.
+// The burst field is cleared after each report, any selection made on it before bursting is lost.
+type ReportBurster struct {
+	Config     BurstConfig
+	Docs       []*enigma.Doc
+	NewPrinter func() IReportPrinter
+	Logger     *zerolog.Logger
+}
+
+func NewReportBurster(cfg BurstConfig, docs ...*enigma.Doc) *ReportBurster {
+	return &ReportBurster{
+		Config: cfg,
+		Docs:   docs,
+		NewPrinter: func() IReportPrinter {
+			return NewBuiltInReportPrinter()
+		},
+		Logger: loggers.CoreDebugLogger,
+	}
+}
+
+// Burst prints r once per burst value and returns results in the order of values.
+// Failure of a single value is recorded in its BurstResult and doesn't stop the others.
+func (b *ReportBurster) Burst(r Report) ([]*BurstResult, *util.Result) {
+	if res := b.Config.Validate(); res != nil {
+		return nil, res
+	}
+	docs := b.Docs
+	if len(docs) == 0 {
+		if r.Doc == nil {
+			return nil, util.MsgError("Burst", "invalid engine connection")
+		}
+		docs = []*enigma.Doc{r.Doc}
+	}
+	logger := b.Logger
+	if logger == nil {
+		logger = loggers.NullLogger
+	}
+	stateName := b.Config.StateName
+	if stateName == "" {
+		stateName = "$"
+	}
+
+	values, res := b.burstValues(docs, stateName)
+	if res != nil {
+		return nil, res.With("BurstValues")
+	}
+	logger.Info().Msgf("bursting %d reports on field [%s]", len(values), b.Config.Field)
+
+	if r.ID == nil {
+		r.ID = util.Ptr(fmt.Sprintf("%s-%s", r.AppId, time.Now().Format("20060102150405")))
+	}
+	if r.OutputFormat == nil {
+		r.OutputFormat = util.Ptr(REPORT_FORMAT_XLSX)
+	}
+
+	names := b.burstReportNames(r, values)
+	results := make([]*BurstResult, len(values))
+	var mu sync.Mutex
+	claimed := make([]bool, len(values))
+	// next claims the first value not printed yet that doc `d` has, or returns -1
+	next := func(d int) int {
+		mu.Lock()
+		defer mu.Unlock()
+		for i, v := range values {
+			if !claimed[i] && v.in(d) {
+				claimed[i] = true
+				return i
+			}
+		}
+		return -1
+	}
+
+	var wg sync.WaitGroup
+	for d, doc := range docs {
+		wg.Add(1)
+		go func(d int, doc *enigma.Doc) {
+			defer wg.Done()
+			printer := b.NewPrinter()
+			for i := next(d); i >= 0; i = next(d) {
+				results[i] = b.burstOne(doc, printer, r, stateName, values[i].FieldValue, i, names[i])
+				if results[i].Result != nil {
+					logger.Error().Msgf("burst [%s] failed: %s", results[i].Value, results[i].Result.Error())
+				}
+			}
+		}(d, doc)
+	}
+	wg.Wait()
+
+	return results, nil
+}
+
+func (b *ReportBurster) burstOne(doc *enigma.Doc, printer IReportPrinter, r Report, stateName string, value *enigma.FieldValue, index int, name string) *BurstResult {
+	ret := &BurstResult{Value: value.Text}
+
+	field, err := doc.GetField(engine.ConnCtx, b.Config.Field, stateName)
+	if err != nil {
+		ret.Result = util.Error("GetField", err)
+		return ret
+	}
+	ok, err := field.SelectValues(engine.ConnCtx, []*enigma.FieldValue{value}, false, false)
+	if err != nil {
+		ret.Result = util.Error("SelectValues", err)
+		return ret
+	}
+	if !ok {
+		ret.Result = util.MsgError("SelectValues", "engine returned `Fail`")
+		return ret
+	}
+	defer field.Clear(engine.ConnCtx)
+
+	br := r
+	br.Doc = doc
+	br.ID = util.Ptr(fmt.Sprintf("%s-%d", *r.ID, index+1))
+	br.Name = util.Ptr(name)
+	br.SelectedStates = make(map[string]int)
+	for state, n := range r.SelectedStates {
+		br.SelectedStates[state] = n
+	}
+	br.SelectedStates[stateName] = br.SelectedStates[stateName] + 1
+
+	printRes := printer.Print(br)
+	ret.ReportResult, _ = printer.GetReportResult(*br.ID)
+	if printRes != nil {
+		ret.Result = printRes.With("Print")
+	}
+	return ret
+}
+
+// burstValue is a value to burst and indices of docs having it, nil `docs` means all docs.
+type burstValue struct {
+	*enigma.FieldValue
+	docs map[int]bool
+}
+
+func (v *burstValue) in(doc int) bool {
+	return v.docs == nil || v.docs[doc]
+}
+
+// burstValues merges values of all docs by text in order of docs.
+func (b *ReportBurster) burstValues(docs []*enigma.Doc, stateName string) ([]*burstValue, *util.Result) {
+	if len(b.Config.Values) > 0 {
+		values := make([]*burstValue, 0, len(b.Config.Values))
+		for _, v := range textFieldValues(b.Config.Values) {
+			values = append(values, &burstValue{FieldValue: v})
+		}
+		return values, nil
+	}
+
+	values := make([]*burstValue, 0)
+	byText := make(map[string]*burstValue)
+	for d, doc := range docs {
+		docValues, res := b.docBurstValues(doc, stateName)
+		if res != nil {
+			return nil, res.With(fmt.Sprintf("Docs[%d]", d))
+		}
+		for _, v := range docValues {
+			bv, ok := byText[v.Text]
+			if !ok {
+				bv = &burstValue{FieldValue: v, docs: make(map[int]bool)}
+				byText[v.Text] = bv
+				values = append(values, bv)
+			}
+			bv.docs[d] = true
+		}
+	}
+	return values, nil
+}
+
+func (b *ReportBurster) docBurstValues(doc *enigma.Doc, stateName string) ([]*enigma.FieldValue, *util.Result) {
+	if b.Config.ValuesExpr != "" {
+		text, res := evaluateText(doc, b.Config.ValuesExpr, nil)
+		if res != nil {
+			return nil, res.With("ValuesExpr")
+		}
+		delim := b.Config.Delimiter
+		if delim == "" {
+			delim = DEFAULT_BURST_DELIMITER
+		}
+		return textFieldValues(splitBurstValues(text, delim)), nil
+	}
+
+	cells, res := engine.GetFieldValues(doc, stateName, b.Config.Field)
+	if res != nil {
+		return nil, res.With("GetFieldValues")
+	}
+	return possibleFieldValues(cells), nil
+}
+
+func textFieldValues(texts []string) []*enigma.FieldValue {
+	values := make([]*enigma.FieldValue, 0, len(texts))
+	for _, t := range texts {
+		values = append(values, &enigma.FieldValue{Text: t})
+	}
+	return values
+}
+
+// possibleFieldValues keeps selectable cells, numeric values are selected by number so that dates and duals match.
+// Engine sends `NaN` as `qNum` of pure text values.
+func possibleFieldValues(cells []*enigma.NxCell) []*enigma.FieldValue {
+	values := make([]*enigma.FieldValue, 0, len(cells))
+	for _, c := range cells {
+		if c == nil || !burstableStates[c.State] {
+			continue
+		}
+		fv := &enigma.FieldValue{Text: c.Text}
+		if num := float64(c.Num); !math.IsNaN(num) && !math.IsInf(num, 0) {
+			fv.IsNumeric = true
+			fv.Number = c.Num
+		}
+		values = append(values, fv)
+	}
+	return values
+}
+
+// splitBurstValues splits text by delim, trims spaces and removes empty and duplicated values.
+func splitBurstValues(text, delim string) []string {
+	values := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, v := range strings.Split(text, delim) {
+		v = strings.TrimSpace(v)
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		values = append(values, v)
+	}
+	return values
+}
+
+// burstReportNames renders report names of all values. Distinct values may render the same file name,
+// e.g. `A/B` and `A_B`, or names differing only in case on case-insensitive file systems,
+// so a colliding name gets the 1-based index of its value appended instead of overwriting an earlier report.
+func (b *ReportBurster) burstReportNames(r Report, values []*burstValue) []string {
+	ext := r.OutputFormat.FileExtension()
+	names := make([]string, len(values))
+	used := make(map[string]bool)
+	for i, v := range values {
+		base := burstReportName(b.Config.NameTemplate, util.MaybeNil(r.Name), b.Config.Field, v.Text, i, ext)
+		name := base
+		for n := i + 1; used[strings.ToLower(name)]; n++ {
+			name = fmt.Sprintf("%s_%d", base, n)
+		}
+		used[strings.ToLower(name)] = true
+		names[i] = name
+	}
+	return names
+}
+
+var burstNameReplacer = strings.NewReplacer("/", "_", "\\", "_", ":", "_", "*", "_", "?", "_", "\"", "_", "<", "_", ">", "_", "|", "_")
+
+// burstReportName renders the report name of a burst value, the extension is removed as printers append it.
+func burstReportName(tmpl, reportName, field, value string, index int, ext string) string {
+	if tmpl == "" {
+		tmpl = BURST_PLACEHOLDER_VALUE
+		if reportName != "" {
+			tmpl = reportName + "_" + BURST_PLACEHOLDER_VALUE
+		}
+	}
+	name := strings.NewReplacer(
+		BURST_PLACEHOLDER_VALUE, burstNameReplacer.Replace(value),
+		BURST_PLACEHOLDER_FIELD, burstNameReplacer.Replace(field),
+		BURST_PLACEHOLDER_INDEX, strconv.Itoa(index+1),
+	).Replace(tmpl)
+	return strings.TrimSuffix(name, "."+ext)
+}
@@ -0,0 +1,166 @@
+package report
+
+import (
+	"encoding/csv"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/soderasen-au/go-common/loggers"
+	"github.com/soderasen-au/go-common/util"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+	"github.com/soderasen-au/go-qlik/qlik/engine/enginetest"
+)
+
+func TestBurstReportName(t *testing.T) {
+	tests := []struct {
+		name       string
+		tmpl       string
+		reportName string
+		value      string
+		index      int
+		ext        string
+		want       string
+	}{
+		{"template with ext", "Sales_{{value}}.pdf", "", "Alice", 0, "pdf", "Sales_Alice"},
+		{"template without ext", "Sales_{{value}}", "", "Bob", 1, "xlsx", "Sales_Bob"},
+		{"field and index", "{{field}}-{{index}}-{{value}}", "", "Carol", 2, "csv", "Rep-3-Carol"},
+		{"default with report name", "", "Monthly", "Dave", 0, "pdf", "Monthly_Dave"},
+		{"default without report name", "", "", "Eve", 0, "pdf", "Eve"},
+		{"unsafe value", "Sales_{{value}}.pdf", "", "A/B: C?", 0, "pdf", "Sales_A_B_ C_"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := burstReportName(tt.tmpl, tt.reportName, "Rep", tt.value, tt.index, tt.ext); got != tt.want {
+				t.Errorf("burstReportName() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitBurstValues(t *testing.T) {
+	got := splitBurstValues(" Alice | Bob||Alice|Carol ", "|")
+	want := []string{"Alice", "Bob", "Carol"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("splitBurstValues() = %v, want %v", got, want)
+	}
+}
+
+func TestPossibleFieldValues(t *testing.T) {
+	cells := []*enigma.NxCell{
+		{Text: "Alice", Num: enigma.Float64(math.NaN()), State: "O"},
+		{Text: "Bob", Num: enigma.Float64(math.NaN()), State: "X"},
+		{Text: "2024-01-31", Num: 45322, State: "S"},
+		{Text: "Carol", Num: enigma.Float64(math.NaN()), State: "A"},
+		nil,
+	}
+	got := possibleFieldValues(cells)
+	if len(got) != 3 {
+		t.Fatalf("expected 3 values, got %d", len(got))
+	}
+	if got[0].Text != "Alice" || got[0].IsNumeric {
+		t.Errorf("unexpected text value: %+v", got[0])
+	}
+	if got[1].Text != "2024-01-31" || !got[1].IsNumeric || got[1].Number != 45322 {
+		t.Errorf("unexpected numeric value: %+v", got[1])
+	}
+	if got[2].Text != "Carol" {
+		t.Errorf("unexpected alternative value: %+v", got[2])
+	}
+}
+
+func TestReportBurster_Validate(t *testing.T) {
+	if _, res := NewReportBurster(BurstConfig{}).Burst(Report{}); res == nil {
+		t.Error("expected error without burst field")
+	}
+	if _, res := NewReportBurster(BurstConfig{Field: "Rep"}).Burst(Report{}); res == nil {
+		t.Error("expected error without doc")
+	}
+}
+
+func TestReportBurster_Fake(t *testing.T) {
+	srv, doc := enginetest.OpenDoc(t, enginetest.SalesFixture())
+	other := enginetest.ConnectDoc(t, *srv.Config("sales").OnPrem)
+	// possible values differ by doc, so each value can only be printed by one of them
+	for doc, regions := range map[*enigma.Doc][]string{doc: {"East", "West"}, other: {"North"}} {
+		field, err := doc.GetField(engine.ConnCtx, "Region", "")
+		if err != nil {
+			t.Fatalf("GetField: %v", err)
+		}
+		if _, err := field.SelectValues(engine.ConnCtx, textFieldValues(regions), false, false); err != nil {
+			t.Fatalf("SelectValues: %v", err)
+		}
+	}
+
+	r := fakeReport(t, REPORT_FORMAT_CSV)
+	r.Target = TARGET_QUERIES
+	r.Queries = []*engine.Query{engine.NewQuery("sales").Dimension("Region").Dimension("Product").Measure("Sum(Sales)", "Sales")}
+	b := NewReportBurster(BurstConfig{Field: "Region", NameTemplate: "sales_{{value}}"}, doc, other)
+	b.NewPrinter = func() IReportPrinter { return NewCsvReportPrinter() }
+	b.Logger = loggers.NullLogger
+	results, res := b.Burst(r)
+	if res != nil {
+		t.Fatalf("Burst: %v", res)
+	}
+
+	want := []struct {
+		value string
+		rows  int
+	}{{"East", 2}, {"West", 2}, {"North", 1}}
+	if len(results) != len(want) {
+		t.Fatalf("results = %s", util.JsonStr(results))
+	}
+	for i, br := range results {
+		if br.Value != want[i].value || br.Result != nil || br.ReportResult == nil {
+			t.Fatalf("results[%d] = %s", i, util.JsonStr(br))
+		}
+		file := util.MaybeNil(br.ReportResult.ReportFile)
+		if filepath.Base(file) != "sales_"+br.Value+".csv" {
+			t.Errorf("report file = %s", file)
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		records, err := csv.NewReader(f).ReadAll()
+		f.Close()
+		if err != nil {
+			t.Fatalf("ReadAll: %v", err)
+		}
+		if len(records) != want[i].rows+1 {
+			t.Errorf("%s records = %v", br.Value, records)
+		}
+		for _, rec := range records[1:] {
+			if rec[0] != br.Value {
+				t.Errorf("%s records = %v", br.Value, records)
+				break
+			}
+		}
+	}
+
+	for _, doc := range []*enigma.Doc{doc, other} {
+		if sel, res := engine.GetCurrentSelection(doc, ""); res != nil || len(sel.Selections) != 0 {
+			t.Errorf("selections after burst = %s, %v", util.JsonStr(sel), res)
+		}
+	}
+}
+
+func TestReportBurster_burstReportNames(t *testing.T) {
+	b := NewReportBurster(BurstConfig{Field: "Rep", NameTemplate: "Sales_{{value}}"})
+	r := Report{OutputFormat: util.Ptr(REPORT_FORMAT_PDF)}
+	values := []*burstValue{
+		{FieldValue: &enigma.FieldValue{Text: "A/B"}},
+		{FieldValue: &enigma.FieldValue{Text: "A_B"}},
+		{FieldValue: &enigma.FieldValue{Text: "alice"}},
+		{FieldValue: &enigma.FieldValue{Text: "Alice"}},
+	}
+	got := b.burstReportNames(r, values)
+	want := []string{"Sales_A_B", "Sales_A_B_2", "Sales_alice", "Sales_Alice_4"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("burstReportNames() = %v, want %v", got, want)
+	}
+}
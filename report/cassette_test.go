@@ -0,0 +1,84 @@
+package report
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/soderasen-au/go-common/util"
+	"github.com/xuri/excelize/v2"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine/enginetest"
+	"github.com/soderasen-au/go-qlik/qlik/replay"
+)
+
+// reportText returns lines of a csv report, or `sheet!a,b,c` lines of every sheet of an xlsx report.
+func reportText(t *testing.T, file string) string {
+	t.Helper()
+	if filepath.Ext(file) != ".xlsx" {
+		buf, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("ReadFile: %v", err)
+		}
+		return string(buf)
+	}
+	xlsx, err := excelize.OpenFile(file)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	defer xlsx.Close()
+	var sb strings.Builder
+	for _, sheet := range xlsx.GetSheetList() {
+		rows, err := xlsx.GetRows(sheet)
+		if err != nil {
+			t.Fatalf("GetRows: %v", err)
+		}
+		for _, row := range rows {
+			sb.WriteString(sheet + "!" + strings.Join(row, ",") + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// TestReportPrinter_Cassette prints reports replaying sessions recorded from the fake engine,
+// run with QLIK_REPLAY_RECORD=1 to record them again after changing the requests of a printer.
+func TestReportPrinter_Cassette(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  ReportFormat
+		ids     []string
+		printer func() IReportPrinter
+		want    []string
+	}{
+		{"csv", REPORT_FORMAT_CSV, []string{"tbl-sales"}, func() IReportPrinter { return NewCsvReportPrinter() },
+			[]string{"Region,Product,Sales,Margin\n", "East,Bikes,100,25\n", "West,Helmets,60,15\n"}},
+		{"xlsx", REPORT_FORMAT_XLSX, []string{"tbl-sales", "pvt-sales"}, func() IReportPrinter { return NewExcelReportPrinter() },
+			[]string{"Sales by Region!Region,Product,Sales,Margin\n", "Sales by Region!West,Bikes,150,37.5\n", "Sales by Year!West,-,210\n"}},
+		{"paged_xlsx", REPORT_FORMAT_PAGED_XLSX, []string{"tbl-sales"}, func() IReportPrinter { return NewExcelPagingPrinter(DefaultExcelPagingConfig()) },
+			[]string{"page-1!East,Helmets,40,10\n", "page-2!West,Bikes,150,37.5\n", "page-3!West,Helmets,60,15\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := replay.OpenDoc(t, enginetest.SalesFixture(), filepath.Join("testdata", "cassettes", "printer_"+tt.name+".json"))
+			r := docReport(t, doc, tt.format, tt.ids...)
+			if tt.format == REPORT_FORMAT_PAGED_XLSX {
+				r.PaginationConfig = &PaginationConfig{RowsPerPage: 2}
+			}
+			p := tt.printer()
+			if res := p.Print(r); res != nil {
+				t.Fatalf("Print: %v", res)
+			}
+			result, res := p.GetReportResult(*r.ID)
+			if res != nil {
+				t.Fatalf("GetReportResult: %v", res)
+			}
+			got := reportText(t, util.MaybeNil(result.ReportFile))
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("no %q in:\n%s", want, got)
+				}
+			}
+		})
+	}
+}
@@ -276,11 +276,17 @@ func (p *CsvReportPrinter) printObject() *util.Result {
 	return p.printStackObject()
 }
 
-func (p *CsvReportPrinter) Print(r Report) *util.Result {
+func (p *CsvReportPrinter) Print(r Report) (res *util.Result) {
 	if !r.IsValid() {
 		return util.MsgError("Print", "invalid report")
 	}
 
+	closeQueries, res := r.openQueries()
+	if res != nil {
+		return res.With("openQueries")
+	}
+	defer closeQueries()
+
 	if !r.OutputFormat.IsCsv() {
 		return util.MsgError("OutputFormat", "CsvReportPrinter only support csv format")
 	}
@@ -298,10 +304,19 @@ func (p *CsvReportPrinter) Print(r Report) *util.Result {
 		return util.MsgError("CheckDoc", "doc is not opened")
 	}
 	p.Doc = r.Doc
+	// counters of the previous report, the printer is reused by ReportBurster
+	p.ColCnt, p.RowCnt = 0, 0
 
-	ofs, err := os.OpenFile(util.MaybeNil(rResult.ReportFile), os.O_WRONLY|os.O_CREATE, 0755)
+	// protection is resolved first, so that no plain file is written if it fails
+	prot, res := resolveProtection(r)
+	if res != nil {
+		return res.LogWith(&logger, "resolveProtection")
+	}
+
+	plainFile := util.MaybeNil(rResult.ReportFile)
+	ofs, err := os.OpenFile(plainFile, os.O_WRONLY|os.O_CREATE, 0755)
 	if err != nil {
-		return util.Error("OpenFile: "+util.MaybeNil(rResult.ReportFile), err)
+		return util.Error("OpenFile: "+plainFile, err)
 	}
 	p.Writer = csv.NewWriter(ofs)
 	if r.OutputFormat.IsTsv() {
@@ -311,6 +326,10 @@ func (p *CsvReportPrinter) Print(r Report) *util.Result {
 		if ofs != nil {
 			ofs.Close()
 		}
+		// a plain file of a protected report is removed on any failure
+		if res != nil && prot != nil {
+			os.Remove(plainFile)
+		}
 	}()
 
 	r.Target = strings.ToLower(r.Target)
@@ -329,10 +348,18 @@ func (p *CsvReportPrinter) Print(r Report) *util.Result {
 
 	p.Writer.Flush()
 	err = ofs.Close()
-	if res != nil {
+	ofs = nil
+	if err != nil {
 		return util.Error("Close", err)
 	}
-	ofs = nil
+
+	if prot != nil {
+		encFile, res := EncryptFile(plainFile, prot.Password, prot.EnvelopeWorkFactor)
+		if res != nil {
+			return res.LogWith(&logger, "EncryptFile")
+		}
+		rResult.ReportFile = &encFile
+	}
 
 	logger.Info().Msgf("report is saved as [%s]", *rResult.ReportFile)
 
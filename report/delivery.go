@@ -0,0 +1,358 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/rs/zerolog"
+	"github.com/soderasen-au/go-common/loggers"
+	"github.com/soderasen-au/go-common/util"
+)
+
+const (
+	DELIVERY_EMAIL  string = "email"
+	DELIVERY_SFTP   string = "sftp"
+	DELIVERY_FOLDER string = "folder"
+	DELIVERY_S3     string = "s3"
+
+	DELIVERY_STATUS_DELIVERED string = "delivered"
+	DELIVERY_STATUS_FAILED    string = "failed"
+
+	DEFAULT_DELIVERY_MAX_ATTEMPTS int = 3
+	DEFAULT_DELIVERY_INTERVAL_SEC int = 5
+)
+
+// Delivery distributes the printed report file, each configured sink is delivered independently.
+//
+// Text settings (email subject/body/recipients, remote paths and object keys) are go templates
+// executed with DeliveryTemplateData, e.g. `/reports/{{.AppId}}/{{.FileName}}`.
+// A path or key ending with `/` is treated as a directory and the report file name is appended.
+type Delivery struct {
+	Email  *EmailDelivery  `json:"email,omitempty" yaml:"email,omitempty" bson:"email,omitempty"`
+	SFTP   *SFTPDelivery   `json:"sftp,omitempty" yaml:"sftp,omitempty" bson:"sftp,omitempty"`
+	Folder *FolderDelivery `json:"folder,omitempty" yaml:"folder,omitempty" bson:"folder,omitempty"`
+	S3     *S3Delivery     `json:"s3,omitempty" yaml:"s3,omitempty" bson:"s3,omitempty"`
+	Retry  *DeliveryRetry  `json:"retry,omitempty" yaml:"retry,omitempty" bson:"retry,omitempty"`
+}
+
+// DeliveryRetry waits `IntervalSec * Backoff^n` seconds before the n-th retry.
+type DeliveryRetry struct {
+	MaxAttempts int     `json:"max_attempts,omitempty" yaml:"max_attempts,omitempty" bson:"max_attempts,omitempty"`
+	IntervalSec int     `json:"interval_sec,omitempty" yaml:"interval_sec,omitempty" bson:"interval_sec,omitempty"`
+	Backoff     float64 `json:"backoff,omitempty" yaml:"backoff,omitempty" bson:"backoff,omitempty"`
+}
+
+func DefaultDeliveryRetry() *DeliveryRetry {
+	return &DeliveryRetry{
+		MaxAttempts: DEFAULT_DELIVERY_MAX_ATTEMPTS,
+		IntervalSec: DEFAULT_DELIVERY_INTERVAL_SEC,
+		Backoff:     2,
+	}
+}
+
+func (r DeliveryRetry) wait(attempt int) time.Duration {
+	backoff := r.Backoff
+	if backoff < 1 {
+		backoff = 1
+	}
+	d := float64(r.IntervalSec) * float64(time.Second)
+	for i := 1; i < attempt; i++ {
+		d *= backoff
+	}
+	return time.Duration(d)
+}
+
+type DeliveryResult struct {
+	Sink     string       `json:"sink" yaml:"sink" bson:"sink"`
+	Target   string       `json:"target,omitempty" yaml:"target,omitempty" bson:"target,omitempty"`
+	Attempts int          `json:"attempts" yaml:"attempts" bson:"attempts"`
+	Result   *util.Result `json:"result,omitempty" yaml:"result,omitempty" bson:"result,omitempty"`
+}
+
+func (d DeliveryResult) Status() string {
+	if d.Result != nil {
+		return DELIVERY_STATUS_FAILED
+	}
+	return DELIVERY_STATUS_DELIVERED
+}
+
+// DeliveryTemplateData is available to all delivery templates.
+type DeliveryTemplateData struct {
+	ReportID    string
+	ReportName  string
+	AppId       string
+	Format      string
+	FileName    string
+	FilePath    string
+	PrintedRows int
+	Timestamp   time.Time
+}
+
+// deliveryEnv is what a sink needs to deliver one report file
+type deliveryEnv struct {
+	File   string
+	Data   DeliveryTemplateData
+	Doc    *enigma.Doc
+	Logger *zerolog.Logger
+}
+
+type IDeliverySink interface {
+	Name() string
+	// Deliver returns the delivery target even if it fails, so that it can be audited.
+	Deliver(env *deliveryEnv) (string, *util.Result)
+}
+
+func (d Delivery) Validate() *util.Result {
+	if d.Email != nil {
+		if res := d.Email.Validate(); res != nil {
+			return res.With(DELIVERY_EMAIL)
+		}
+	}
+	if d.SFTP != nil {
+		if res := d.SFTP.Validate(); res != nil {
+			return res.With(DELIVERY_SFTP)
+		}
+	}
+	if d.Folder != nil {
+		if res := d.Folder.Validate(); res != nil {
+			return res.With(DELIVERY_FOLDER)
+		}
+	}
+	if d.S3 != nil {
+		if res := d.S3.Validate(); res != nil {
+			return res.With(DELIVERY_S3)
+		}
+	}
+	return nil
+}
+
+func (d Delivery) Sinks() []IDeliverySink {
+	sinks := make([]IDeliverySink, 0)
+	if d.Email != nil {
+		sinks = append(sinks, d.Email)
+	}
+	if d.SFTP != nil {
+		sinks = append(sinks, d.SFTP)
+	}
+	if d.Folder != nil {
+		sinks = append(sinks, d.Folder)
+	}
+	if d.S3 != nil {
+		sinks = append(sinks, d.S3)
+	}
+	return sinks
+}
+
+// Deliver sends the report file of rr to all sinks and records each delivery in audit if it's not nil.
+func (d Delivery) Deliver(r Report, rr *ReportResult, audit *AuditLog) []*DeliveryResult {
+	return d.DeliverContext(context.Background(), r, rr, audit)
+}
+
+// DeliverContext is Deliver whose waits between retries stop when ctx is done,
+// the last failure of a sink is then returned with the error of ctx.
+func (d Delivery) DeliverContext(ctx context.Context, r Report, rr *ReportResult, audit *AuditLog) []*DeliveryResult {
+	logger := loggers.NullLogger
+	if rr != nil && rr.Logger != nil {
+		logger = rr.Logger
+	}
+	if rr == nil || rr.ReportFile == nil {
+		return []*DeliveryResult{{Sink: "all", Result: util.MsgError("Deliver", "no report file")}}
+	}
+
+	file := *rr.ReportFile
+	env := &deliveryEnv{
+		File: file,
+		Data: DeliveryTemplateData{
+			ReportID:    util.MaybeNil(r.ID),
+			ReportName:  util.MaybeNil(r.Name),
+			AppId:       r.AppId,
+			FileName:    filepath.Base(file),
+			FilePath:    file,
+			PrintedRows: rr.PrintedRows,
+			Timestamp:   time.Now(),
+		},
+		Doc:    r.Doc,
+		Logger: logger,
+	}
+	if r.OutputFormat != nil {
+		env.Data.Format = string(*r.OutputFormat)
+	}
+
+	retry := d.Retry
+	if retry == nil {
+		retry = DefaultDeliveryRetry()
+	}
+
+	results := make([]*DeliveryResult, 0)
+	for _, sink := range d.Sinks() {
+		dr := deliverWithRetry(ctx, sink, env, *retry)
+		if dr.Result != nil {
+			logger.Error().Msgf("deliver %s to [%s] failed after %d attempts: %s", dr.Sink, dr.Target, dr.Attempts, dr.Result.Error())
+		} else {
+			logger.Info().Msgf("delivered %s to [%s]", dr.Sink, dr.Target)
+		}
+		if audit != nil {
+			if res := audit.Record(newDeliveryAuditRecord(r, rr, dr)); res != nil {
+				logger.Error().Msgf("audit delivery failed: %s", res.Error())
+			}
+		}
+		results = append(results, dr)
+	}
+	return results
+}
+
+func deliverWithRetry(ctx context.Context, sink IDeliverySink, env *deliveryEnv, retry DeliveryRetry) *DeliveryResult {
+	maxAttempts := retry.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	dr := &DeliveryResult{Sink: sink.Name()}
+	for dr.Attempts < maxAttempts {
+		if dr.Attempts > 0 {
+			wait := retry.wait(dr.Attempts)
+			env.Logger.Warn().Msgf("deliver %s attempt %d failed: %s, retry in %v", dr.Sink, dr.Attempts, dr.Result.Error(), wait)
+			if res := sleepContext(ctx, wait); res != nil {
+				dr.Result = util.MsgError("Retry", fmt.Sprintf("%s, last attempt: %s", res.Error(), dr.Result.Error()))
+				break
+			}
+		}
+		dr.Attempts++
+		dr.Target, dr.Result = sink.Deliver(env)
+		if dr.Result == nil {
+			break
+		}
+	}
+	return dr
+}
+
+func sleepContext(ctx context.Context, d time.Duration) *util.Result {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return util.Error("Sleep", ctx.Err())
+	case <-t.C:
+		return nil
+	}
+}
+
+func newDeliveryAuditRecord(r Report, rr *ReportResult, dr *DeliveryResult) AuditRecord {
+	rec := AuditRecord{
+		Timestamp:       time.Now(),
+		AppId:           r.AppId,
+		Cmd:             AUDIT_CMD_DELIVER,
+		Ids:             []string{util.MaybeNil(r.ID)},
+		ReportFileName:  util.MaybeNil(rr.ReportFile),
+		ReportTotalRows: rr.PrintedRows,
+		DeliveryTargets: []string{fmt.Sprintf("%s:%s", dr.Sink, dr.Target)},
+		DeliveryStatus:  dr.Status(),
+	}
+	if r.OutputFormat != nil {
+		rec.Format = string(*r.OutputFormat)
+	}
+	if fi, err := os.Stat(rec.ReportFileName); err == nil {
+		rec.ReportFileSize = int(fi.Size())
+	}
+	if dr.Result != nil {
+		rec.Error = dr.Result.Error()
+	}
+	return rec
+}
+
+func renderTemplate(name, text string, data DeliveryTemplateData) (string, *util.Result) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", util.Error("ParseTemplate "+name, err)
+	}
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, data); err != nil {
+		return "", util.Error("ExecuteTemplate "+name, err)
+	}
+	return buf.String(), nil
+}
+
+// renderTargetPath renders path template, appends file name if path is empty or ends with a separator.
+func renderTargetPath(name, text string, data DeliveryTemplateData) (string, *util.Result) {
+	p, res := renderTemplate(name, text, data)
+	if res != nil {
+		return "", res
+	}
+	if p == "" || strings.HasSuffix(p, "/") || strings.HasSuffix(p, "\\") {
+		p += data.FileName
+	}
+	return p, nil
+}
+
+// FolderDelivery copies report file to a local or mounted network folder.
+// File is written to a temporary file in the target folder first and then renamed,
+// so that consumers watching the folder never see a partial file.
+type FolderDelivery struct {
+	Path string `json:"path" yaml:"path" bson:"path"`
+}
+
+func (d FolderDelivery) Validate() *util.Result {
+	if d.Path == "" {
+		return util.MsgError("Validate", "no folder path")
+	}
+	return nil
+}
+
+func (d FolderDelivery) Name() string {
+	return DELIVERY_FOLDER
+}
+
+func (d FolderDelivery) Deliver(env *deliveryEnv) (string, *util.Result) {
+	target, res := renderTargetPath("path", d.Path, env.Data)
+	if res != nil {
+		return "", res
+	}
+	if fi, err := os.Stat(target); err == nil && fi.IsDir() {
+		target = filepath.Join(target, env.Data.FileName)
+	}
+	return target, copyFileAtomic(env.File, target)
+}
+
+func copyFileAtomic(src, dst string) *util.Result {
+	in, err := os.Open(src)
+	if err != nil {
+		return util.Error("OpenSource", err)
+	}
+	defer in.Close()
+
+	dir := filepath.Dir(dst)
+	if err = os.MkdirAll(dir, os.ModePerm); err != nil {
+		return util.Error("MkdirAll", err)
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(dst)+"-*.part")
+	if err != nil {
+		return util.Error("CreateTemp", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		return util.Error("Copy", err)
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return util.Error("Sync", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return util.Error("CloseTemp", err)
+	}
+	if err = os.Rename(tmp.Name(), dst); err != nil {
+		return util.Error("Rename", err)
+	}
+	return nil
+}
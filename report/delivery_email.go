@@ -0,0 +1,316 @@
+package report
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/soderasen-au/go-common/util"
+)
+
+const (
+	SMTP_SECURITY_STARTTLS string = "starttls"
+	SMTP_SECURITY_TLS      string = "tls"
+	SMTP_SECURITY_NONE     string = "none"
+)
+
+// EmailDelivery sends report file as attachment by SMTP.
+//
+// `Subject`, `Body` and recipients are templates, a recipient which renders to a text starting with `=`
+// is evaluated by engine against current selection and may return several addresses separated by `;` or `,`,
+// e.g. `=Only([Manager Email])` when bursting.
+type EmailDelivery struct {
+	Host               string   `json:"host" yaml:"host" bson:"host"`
+	Port               int      `json:"port,omitempty" yaml:"port,omitempty" bson:"port,omitempty"`
+	Security           string   `json:"security,omitempty" yaml:"security,omitempty" bson:"security,omitempty"` // "starttls"(default), "tls", "none"
+	InsecureSkipVerify bool     `json:"insecure_skip_verify,omitempty" yaml:"insecure_skip_verify,omitempty" bson:"insecure_skip_verify,omitempty"`
+	Username           string   `json:"username,omitempty" yaml:"username,omitempty" bson:"username,omitempty"`
+	Password           string   `json:"password,omitempty" yaml:"password,omitempty" bson:"password,omitempty"`
+	From               string   `json:"from" yaml:"from" bson:"from"`
+	To                 []string `json:"to,omitempty" yaml:"to,omitempty" bson:"to,omitempty"`
+	Cc                 []string `json:"cc,omitempty" yaml:"cc,omitempty" bson:"cc,omitempty"`
+	Bcc                []string `json:"bcc,omitempty" yaml:"bcc,omitempty" bson:"bcc,omitempty"`
+	Subject            string   `json:"subject,omitempty" yaml:"subject,omitempty" bson:"subject,omitempty"`
+	Body               string   `json:"body,omitempty" yaml:"body,omitempty" bson:"body,omitempty"`
+	HTML               bool     `json:"html,omitempty" yaml:"html,omitempty" bson:"html,omitempty"`
+}
+
+func (d EmailDelivery) Validate() *util.Result {
+	if d.Host == "" {
+		return util.MsgError("Validate", "no smtp host")
+	}
+	if d.From == "" {
+		return util.MsgError("Validate", "no sender")
+	}
+	if len(d.To)+len(d.Cc)+len(d.Bcc) == 0 {
+		return util.MsgError("Validate", "no recipient")
+	}
+	switch strings.ToLower(d.Security) {
+	case "", SMTP_SECURITY_STARTTLS, SMTP_SECURITY_TLS, SMTP_SECURITY_NONE:
+	default:
+		return util.MsgError("Validate", fmt.Sprintf("invalid smtp security '%s'", d.Security))
+	}
+	return nil
+}
+
+func (d EmailDelivery) Name() string {
+	return DELIVERY_EMAIL
+}
+
+func (d EmailDelivery) security() string {
+	if d.Security == "" {
+		return SMTP_SECURITY_STARTTLS
+	}
+	return strings.ToLower(d.Security)
+}
+
+func (d EmailDelivery) addr() string {
+	port := d.Port
+	if port == 0 {
+		switch d.security() {
+		case SMTP_SECURITY_TLS:
+			port = 465
+		case SMTP_SECURITY_NONE:
+			port = 25
+		default:
+			port = 587
+		}
+	}
+	return net.JoinHostPort(d.Host, strconv.Itoa(port))
+}
+
+func (d EmailDelivery) Deliver(env *deliveryEnv) (string, *util.Result) {
+	to, res := d.resolveRecipients(env, d.To)
+	if res != nil {
+		return "", res.With("To")
+	}
+	cc, res := d.resolveRecipients(env, d.Cc)
+	if res != nil {
+		return "", res.With("Cc")
+	}
+	bcc, res := d.resolveRecipients(env, d.Bcc)
+	if res != nil {
+		return "", res.With("Bcc")
+	}
+	rcpts := append(append(append([]string{}, to...), cc...), bcc...)
+	target := strings.Join(rcpts, ";")
+	if len(rcpts) == 0 {
+		return target, util.MsgError("Recipients", "no recipient resolved")
+	}
+
+	subject, res := renderTemplate("subject", d.Subject, env.Data)
+	if res != nil {
+		return target, res
+	}
+	body, res := renderTemplate("body", d.Body, env.Data)
+	if res != nil {
+		return target, res
+	}
+	msg, res := buildMimeMessage(d.From, to, cc, subject, body, d.HTML, env.File)
+	if res != nil {
+		return target, res.With("BuildMessage")
+	}
+
+	if res = d.send(rcpts, msg); res != nil {
+		return target, res.With("SendMail")
+	}
+	return target, nil
+}
+
+func (d EmailDelivery) resolveRecipients(env *deliveryEnv, tmpls []string) ([]string, *util.Result) {
+	rcpts := make([]string, 0)
+	for i, tmpl := range tmpls {
+		text, res := renderTemplate(fmt.Sprintf("recipient-%d", i), tmpl, env.Data)
+		if res != nil {
+			return nil, res
+		}
+		text, res = evaluateText(env.Doc, text, nil)
+		if res != nil {
+			return nil, res.With(tmpl)
+		}
+		for _, addr := range strings.FieldsFunc(text, func(r rune) bool { return r == ';' || r == ',' }) {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				rcpts = append(rcpts, addr)
+			}
+		}
+	}
+	return rcpts, nil
+}
+
+func (d EmailDelivery) send(rcpts []string, msg []byte) *util.Result {
+	tlsCfg := &tls.Config{ServerName: d.Host, InsecureSkipVerify: d.InsecureSkipVerify}
+
+	var c *smtp.Client
+	if d.security() == SMTP_SECURITY_TLS {
+		conn, err := tls.Dial("tcp", d.addr(), tlsCfg)
+		if err != nil {
+			return util.Error("DialTLS", err)
+		}
+		if c, err = smtp.NewClient(conn, d.Host); err != nil {
+			conn.Close()
+			return util.Error("NewClient", err)
+		}
+	} else {
+		var err error
+		if c, err = smtp.Dial(d.addr()); err != nil {
+			return util.Error("Dial", err)
+		}
+	}
+	defer c.Close()
+
+	if d.security() == SMTP_SECURITY_STARTTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return util.MsgError("StartTLS", "server doesn't support STARTTLS")
+		}
+		if err := c.StartTLS(tlsCfg); err != nil {
+			return util.Error("StartTLS", err)
+		}
+	}
+
+	if d.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", d.Username, d.Password, d.Host)); err != nil {
+			return util.Error("Auth", err)
+		}
+	}
+
+	from, err := mail.ParseAddress(d.From)
+	if err != nil {
+		return util.Error("ParseFrom", err)
+	}
+	if err = c.Mail(from.Address); err != nil {
+		return util.Error("Mail", err)
+	}
+	for _, rcpt := range rcpts {
+		addr, err := mail.ParseAddress(rcpt)
+		if err != nil {
+			return util.Error("ParseRecipient", err)
+		}
+		if err = c.Rcpt(addr.Address); err != nil {
+			return util.Error("Rcpt "+addr.Address, err)
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return util.Error("Data", err)
+	}
+	if _, err = w.Write(msg); err != nil {
+		return util.Error("WriteData", err)
+	}
+	if err = w.Close(); err != nil {
+		return util.Error("CloseData", err)
+	}
+	if err = c.Quit(); err != nil {
+		return util.Error("Quit", err)
+	}
+	return nil
+}
+
+// buildMimeMessage builds a multipart/mixed message with body and file as attachment, Bcc is not included.
+func buildMimeMessage(from string, to, cc []string, subject, body string, html bool, file string) ([]byte, *util.Result) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, util.Error("ReadFile", err)
+	}
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	header := textproto.MIMEHeader{}
+	header.Set("From", from)
+	if len(to) > 0 {
+		header.Set("To", strings.Join(to, ", "))
+	}
+	if len(cc) > 0 {
+		header.Set("Cc", strings.Join(cc, ", "))
+	}
+	header.Set("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header.Set("Date", time.Now().Format(time.RFC1123Z))
+	header.Set("Message-ID", newMessageId(from))
+	header.Set("MIME-Version", "1.0")
+	header.Set("Content-Type", fmt.Sprintf("multipart/mixed; boundary=%s", mw.Boundary()))
+
+	var msg bytes.Buffer
+	for _, k := range []string{"From", "To", "Cc", "Subject", "Date", "Message-ID", "MIME-Version", "Content-Type"} {
+		if v := header.Get(k); v != "" {
+			fmt.Fprintf(&msg, "%s: %s\r\n", k, v)
+		}
+	}
+	msg.WriteString("\r\n")
+
+	bodyType := "text/plain"
+	if html {
+		bodyType = "text/html"
+	}
+	bodyPart, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {bodyType + "; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, util.Error("CreateBodyPart", err)
+	}
+	qp := quotedprintable.NewWriter(bodyPart)
+	if _, err = qp.Write([]byte(body)); err != nil {
+		return nil, util.Error("WriteBody", err)
+	}
+	if err = qp.Close(); err != nil {
+		return nil, util.Error("CloseBody", err)
+	}
+
+	fileName := filepath.Base(file)
+	contentType := mime.TypeByExtension(filepath.Ext(fileName))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	attachPart, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {mime.FormatMediaType(contentType, map[string]string{"name": fileName})},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": fileName})},
+	})
+	if err != nil {
+		return nil, util.Error("CreateAttachmentPart", err)
+	}
+	encoded := base64.StdEncoding.EncodeToString(content)
+	for len(encoded) > 76 {
+		if _, err = attachPart.Write([]byte(encoded[:76] + "\r\n")); err != nil {
+			return nil, util.Error("WriteAttachment", err)
+		}
+		encoded = encoded[76:]
+	}
+	if _, err = attachPart.Write([]byte(encoded + "\r\n")); err != nil {
+		return nil, util.Error("WriteAttachment", err)
+	}
+	if err = mw.Close(); err != nil {
+		return nil, util.Error("CloseMultipart", err)
+	}
+
+	msg.Write(buf.Bytes())
+	return msg.Bytes(), nil
+}
+
+func newMessageId(from string) string {
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if i := strings.LastIndex(addr.Address, "@"); i >= 0 {
+			domain = addr.Address[i+1:]
+		}
+	}
+	b := make([]byte, 12)
+	rand.Read(b)
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(b), domain)
+}
@@ -0,0 +1,245 @@
+package report
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/soderasen-au/go-common/util"
+)
+
+const (
+	DEFAULT_S3_REGION string = "us-east-1"
+
+	sigV4Algorithm  string = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat string = "20060102T150405Z"
+)
+
+// S3Delivery PUTs report file to an S3 compatible object storage (AWS S3, MinIO, Ceph ...)
+// signed with AWS signature version 4.
+// Objects are addressed path style (`<endpoint>/<bucket>/<key>`) unless `VirtualHostStyle` is set.
+type S3Delivery struct {
+	Endpoint         string `json:"endpoint" yaml:"endpoint" bson:"endpoint"` // e.g. https://s3.eu-west-1.amazonaws.com, http://minio:9000
+	Region           string `json:"region,omitempty" yaml:"region,omitempty" bson:"region,omitempty"`
+	Bucket           string `json:"bucket" yaml:"bucket" bson:"bucket"`
+	Key              string `json:"key,omitempty" yaml:"key,omitempty" bson:"key,omitempty"`
+	AccessKey        string `json:"access_key" yaml:"access_key" bson:"access_key"`
+	SecretKey        string `json:"secret_key" yaml:"secret_key" bson:"secret_key"`
+	SessionToken     string `json:"session_token,omitempty" yaml:"session_token,omitempty" bson:"session_token,omitempty"`
+	VirtualHostStyle bool   `json:"virtual_host_style,omitempty" yaml:"virtual_host_style,omitempty" bson:"virtual_host_style,omitempty"`
+	ContentType      string `json:"content_type,omitempty" yaml:"content_type,omitempty" bson:"content_type,omitempty"`
+	TimeoutSec       int    `json:"timeout_sec,omitempty" yaml:"timeout_sec,omitempty" bson:"timeout_sec,omitempty"`
+}
+
+func (d S3Delivery) Validate() *util.Result {
+	if d.Endpoint == "" {
+		return util.MsgError("Validate", "no s3 endpoint")
+	}
+	if _, err := url.Parse(d.Endpoint); err != nil {
+		return util.Error("ParseEndpoint", err)
+	}
+	if d.Bucket == "" {
+		return util.MsgError("Validate", "no s3 bucket")
+	}
+	if d.AccessKey == "" || d.SecretKey == "" {
+		return util.MsgError("Validate", "no s3 credentials")
+	}
+	return nil
+}
+
+func (d S3Delivery) Name() string {
+	return DELIVERY_S3
+}
+
+func (d S3Delivery) region() string {
+	if d.Region == "" {
+		return DEFAULT_S3_REGION
+	}
+	return d.Region
+}
+
+func (d S3Delivery) objectURL(key string) (*url.URL, *util.Result) {
+	u, err := url.Parse(d.Endpoint)
+	if err != nil {
+		return nil, util.Error("ParseEndpoint", err)
+	}
+	key = strings.TrimPrefix(key, "/")
+	if d.VirtualHostStyle {
+		u.Host = d.Bucket + "." + u.Host
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + key
+	} else {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + d.Bucket + "/" + key
+	}
+	// send the path exactly as it's signed
+	u.RawPath = sigV4EscapePath(u.Path)
+	return u, nil
+}
+
+func (d S3Delivery) Deliver(env *deliveryEnv) (string, *util.Result) {
+	key, res := renderTargetPath("key", d.Key, env.Data)
+	if res != nil {
+		return "", res
+	}
+	target := fmt.Sprintf("s3://%s/%s", d.Bucket, strings.TrimPrefix(key, "/"))
+
+	u, res := d.objectURL(key)
+	if res != nil {
+		return target, res
+	}
+
+	payloadHash, size, res := fileSha256(env.File)
+	if res != nil {
+		return target, res
+	}
+	f, err := os.Open(env.File)
+	if err != nil {
+		return target, util.Error("OpenSource", err)
+	}
+	defer f.Close()
+
+	req, err := http.NewRequest(http.MethodPut, u.String(), f)
+	if err != nil {
+		return target, util.Error("NewRequest", err)
+	}
+	req.ContentLength = size
+	contentType := d.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(env.File))
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if d.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", d.SessionToken)
+	}
+	signV4(req, payloadHash, d.AccessKey, d.SecretKey, d.region(), "s3", time.Now())
+
+	client := &http.Client{Timeout: 5 * time.Minute}
+	if d.TimeoutSec > 0 {
+		client.Timeout = time.Duration(d.TimeoutSec) * time.Second
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return target, util.Error("PutObject", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return target, util.MsgError("PutObject", fmt.Sprintf("%s: %s", resp.Status, string(body)))
+	}
+	return target, nil
+}
+
+func fileSha256(file string) (string, int64, *util.Result) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", 0, util.Error("OpenSource", err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, util.Error("HashSource", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// signV4 signs req with AWS signature version 4, all headers set on req are signed.
+func signV4(req *http.Request, payloadHash, accessKey, secretKey, region, service string, t time.Time) {
+	amzDate := t.UTC().Format(sigV4TimeFormat)
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.Join(v, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + strings.TrimSpace(headers[k]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		sigV4EscapePath(req.URL.Path),
+		sigV4CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	crHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{sigV4Algorithm, amzDate, scope, hex.EncodeToString(crHash[:])}, "\n")
+
+	key := hmacSha256([]byte("AWS4"+secretKey), date)
+	key = hmacSha256(key, region)
+	key = hmacSha256(key, service)
+	key = hmacSha256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// sigV4Escape URI-encodes every byte except unreserved characters, and `/` unless encodeSlash
+func sigV4Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sigV4EscapePath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	return sigV4Escape(p, false)
+}
+
+func sigV4CanonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0)
+	for _, k := range keys {
+		vals := append([]string{}, q[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			parts = append(parts, sigV4Escape(k, true)+"="+sigV4Escape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
@@ -0,0 +1,174 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/soderasen-au/go-common/util"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SFTPDelivery uploads report file over SFTP.
+// File is uploaded as `<path>.part` and renamed when complete.
+//
+// Server is verified by `HostKey` (a line in authorized_keys format) or `KnownHostsFile`,
+// verification can only be skipped explicitly by `InsecureIgnoreHostKey`.
+type SFTPDelivery struct {
+	Host                  string `json:"host" yaml:"host" bson:"host"`
+	Port                  int    `json:"port,omitempty" yaml:"port,omitempty" bson:"port,omitempty"`
+	Username              string `json:"username" yaml:"username" bson:"username"`
+	Password              string `json:"password,omitempty" yaml:"password,omitempty" bson:"password,omitempty"`
+	PrivateKeyFile        string `json:"private_key_file,omitempty" yaml:"private_key_file,omitempty" bson:"private_key_file,omitempty"`
+	PrivateKeyPassphrase  string `json:"private_key_passphrase,omitempty" yaml:"private_key_passphrase,omitempty" bson:"private_key_passphrase,omitempty"`
+	HostKey               string `json:"host_key,omitempty" yaml:"host_key,omitempty" bson:"host_key,omitempty"`
+	KnownHostsFile        string `json:"known_hosts_file,omitempty" yaml:"known_hosts_file,omitempty" bson:"known_hosts_file,omitempty"`
+	InsecureIgnoreHostKey bool   `json:"insecure_ignore_host_key,omitempty" yaml:"insecure_ignore_host_key,omitempty" bson:"insecure_ignore_host_key,omitempty"`
+	Path                  string `json:"path,omitempty" yaml:"path,omitempty" bson:"path,omitempty"`
+	TimeoutSec            int    `json:"timeout_sec,omitempty" yaml:"timeout_sec,omitempty" bson:"timeout_sec,omitempty"`
+}
+
+func (d SFTPDelivery) Validate() *util.Result {
+	if d.Host == "" {
+		return util.MsgError("Validate", "no sftp host")
+	}
+	if d.Username == "" {
+		return util.MsgError("Validate", "no sftp user")
+	}
+	if d.Password == "" && d.PrivateKeyFile == "" {
+		return util.MsgError("Validate", "no sftp password or private key")
+	}
+	if d.HostKey == "" && d.KnownHostsFile == "" && !d.InsecureIgnoreHostKey {
+		return util.MsgError("Validate", "no host key to verify sftp server")
+	}
+	return nil
+}
+
+func (d SFTPDelivery) Name() string {
+	return DELIVERY_SFTP
+}
+
+func (d SFTPDelivery) addr() string {
+	port := d.Port
+	if port == 0 {
+		port = 22
+	}
+	return net.JoinHostPort(d.Host, strconv.Itoa(port))
+}
+
+func (d SFTPDelivery) clientConfig() (*ssh.ClientConfig, *util.Result) {
+	cfg := &ssh.ClientConfig{
+		User:    d.Username,
+		Timeout: 30 * time.Second,
+	}
+	if d.TimeoutSec > 0 {
+		cfg.Timeout = time.Duration(d.TimeoutSec) * time.Second
+	}
+
+	if d.PrivateKeyFile != "" {
+		pem, err := os.ReadFile(d.PrivateKeyFile)
+		if err != nil {
+			return nil, util.Error("ReadPrivateKey", err)
+		}
+		var signer ssh.Signer
+		if d.PrivateKeyPassphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(pem, []byte(d.PrivateKeyPassphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(pem)
+		}
+		if err != nil {
+			return nil, util.Error("ParsePrivateKey", err)
+		}
+		cfg.Auth = append(cfg.Auth, ssh.PublicKeys(signer))
+	}
+	if d.Password != "" {
+		cfg.Auth = append(cfg.Auth, ssh.Password(d.Password))
+	}
+
+	switch {
+	case d.HostKey != "":
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(d.HostKey))
+		if err != nil {
+			return nil, util.Error("ParseHostKey", err)
+		}
+		cfg.HostKeyCallback = ssh.FixedHostKey(key)
+	case d.KnownHostsFile != "":
+		cb, err := knownhosts.New(d.KnownHostsFile)
+		if err != nil {
+			return nil, util.Error("KnownHosts", err)
+		}
+		cfg.HostKeyCallback = cb
+	case d.InsecureIgnoreHostKey:
+		cfg.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+	default:
+		return nil, util.MsgError("HostKey", "no host key to verify sftp server")
+	}
+	return cfg, nil
+}
+
+func (d SFTPDelivery) Deliver(env *deliveryEnv) (string, *util.Result) {
+	remotePath, res := renderTargetPath("path", d.Path, env.Data)
+	if res != nil {
+		return "", res
+	}
+	target := fmt.Sprintf("%s@%s:%s", d.Username, d.addr(), remotePath)
+
+	cfg, res := d.clientConfig()
+	if res != nil {
+		return target, res
+	}
+	conn, err := ssh.Dial("tcp", d.addr(), cfg)
+	if err != nil {
+		return target, util.Error("DialSSH", err)
+	}
+	defer conn.Close()
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		return target, util.Error("NewSFTPClient", err)
+	}
+	defer client.Close()
+
+	if dir := path.Dir(remotePath); dir != "." && dir != "/" {
+		if err = client.MkdirAll(dir); err != nil {
+			return target, util.Error("MkdirAll", err)
+		}
+	}
+
+	in, err := os.Open(env.File)
+	if err != nil {
+		return target, util.Error("OpenSource", err)
+	}
+	defer in.Close()
+
+	tmpPath := remotePath + ".part"
+	out, err := client.Create(tmpPath)
+	if err != nil {
+		return target, util.Error("CreateRemote", err)
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		client.Remove(tmpPath)
+		return target, util.Error("Upload", err)
+	}
+	if err = out.Close(); err != nil {
+		client.Remove(tmpPath)
+		return target, util.Error("CloseRemote", err)
+	}
+
+	if err = client.PosixRename(tmpPath, remotePath); err != nil {
+		// server without posix-rename extension: plain rename fails if target exists
+		client.Remove(remotePath)
+		if err = client.Rename(tmpPath, remotePath); err != nil {
+			client.Remove(tmpPath)
+			return target, util.Error("Rename", err)
+		}
+	}
+	return target, nil
+}
@@ -217,22 +217,13 @@ func (p *ExcelReportPrinter) printCustomHeaders(doc *enigma.Doc, headers []Custo
 			return nil, util.Error("CoordinatesToCellName", err)
 		}
 		cellLogger.Debug().Msgf("print text cell: %s", header.Text)
-		if text := strings.TrimSpace(header.Text); strings.HasPrefix(text, "=") {
-			dual, err := doc.EvaluateEx(engine.ConnCtx, header.Text)
-			if err != nil {
-				cellLogger.Err(err).Msg("EvaluateEx")
-				return nil, util.Error("EvaluateEx", err)
-			}
-
-			text = dual.Text
-			if text == "" && dual.IsNumeric {
-				text = fmt.Sprintf("%v", dual.Number)
-			}
-			cellLogger.Debug().Msgf("Evaluate: %s => %v, text: %s", header.Text, dual, text)
-			excel.SetCellStr(sheet, textCellName, text)
-		} else {
-			excel.SetCellStr(sheet, textCellName, header.Text)
+		text, res := evaluateText(doc, header.Text, header.Eval)
+		if res != nil {
+			cellLogger.Err(res).Msg("evaluateText")
+			return nil, res.With("evaluateText")
 		}
+		cellLogger.Debug().Msgf("Evaluate: %s => %s", header.Text, text)
+		excel.SetCellStr(sheet, textCellName, text)
 	}
 
 	resRect.Height = len(headers)
@@ -279,22 +270,13 @@ func (p *ExcelReportPrinter) printLegends(doc *enigma.Doc, legends []Legend, she
 			return nil, util.Error("CoordinatesToCellName", err)
 		}
 		cellLogger.Debug().Msgf("print legend text cell: %s", legend.Text)
-		if text := strings.TrimSpace(legend.Text); strings.HasPrefix(text, "=") {
-			dual, err := doc.EvaluateEx(engine.ConnCtx, legend.Text)
-			if err != nil {
-				cellLogger.Err(err).Msg("EvaluateEx")
-				return nil, util.Error("EvaluateEx", err)
-			}
-
-			text = dual.Text
-			if text == "" && dual.IsNumeric {
-				text = fmt.Sprintf("%v", dual.Number)
-			}
-			cellLogger.Debug().Msgf("Evaluate: %s => %v, text: %s", legend.Text, dual, text)
-			excel.SetCellStr(sheet, textCellName, text)
-		} else {
-			excel.SetCellStr(sheet, textCellName, legend.Text)
+		text, res := evaluateText(doc, legend.Text, legend.Eval)
+		if res != nil {
+			cellLogger.Err(res).Msg("evaluateText")
+			return nil, res.With("evaluateText")
 		}
+		cellLogger.Debug().Msgf("Evaluate: %s => %s", legend.Text, text)
+		excel.SetCellStr(sheet, textCellName, text)
 	}
 
 	resRect.Height = len(legends)
@@ -331,22 +313,13 @@ func (p *ExcelReportPrinter) printCustomFooters(doc *enigma.Doc, footers []Custo
 			return nil, util.Error("CoordinatesToCellName", err)
 		}
 		cellLogger.Debug().Msgf("print text cell: %s", footer.Text)
-		if text := strings.TrimSpace(footer.Text); strings.HasPrefix(text, "=") {
-			dual, err := doc.EvaluateEx(engine.ConnCtx, footer.Text)
-			if err != nil {
-				cellLogger.Err(err).Msg("EvaluateEx")
-				return nil, util.Error("EvaluateEx", err)
-			}
-
-			text = dual.Text
-			if text == "" && dual.IsNumeric {
-				text = fmt.Sprintf("%v", dual.Number)
-			}
-			cellLogger.Debug().Msgf("Evaluate: %s => %v, text: %s", footer.Text, dual, text)
-			excel.SetCellStr(sheet, textCellName, text)
-		} else {
-			excel.SetCellStr(sheet, textCellName, footer.Text)
+		text, res := evaluateText(doc, footer.Text, footer.Eval)
+		if res != nil {
+			cellLogger.Err(res).Msg("evaluateText")
+			return nil, res.With("evaluateText")
 		}
+		cellLogger.Debug().Msgf("Evaluate: %s => %s", footer.Text, text)
+		excel.SetCellStr(sheet, textCellName, text)
 	}
 
 	resRect.Height = len(footers)
@@ -941,7 +914,7 @@ func shouldShowChild(doc *enigma.Doc, info *engine.ContainerChildInfo, logger *z
 	return txt != "" && txt != "false" && txt != "0"
 }
 
-func (p *ExcelReportPrinter) printContainer(doc *enigma.Doc, r Report, objId string, obj *enigma.GenericObject, objLayout *engine.ObjectLayoutEx, rect enigma.Rect, excel *excelize.File, _logger *zerolog.Logger) (*enigma.Rect, *util.Result) {
+func (p *ExcelReportPrinter) printContainer(doc *enigma.Doc, r Report, images objectImages, objId string, obj *enigma.GenericObject, objLayout *engine.ObjectLayoutEx, rect enigma.Rect, excel *excelize.File, _logger *zerolog.Logger) (*enigma.Rect, *util.Result) {
 	_logger.Info().Msg("print container")
 	if objLayout.ChildList == nil || len(objLayout.ChildList.Items) == 0 {
 		_logger.Warn().Msg("container has no child")
@@ -1051,7 +1024,7 @@ func (p *ExcelReportPrinter) printContainer(doc *enigma.Doc, r Report, objId str
 			return nil, util.MsgError("LookupChildList", errmsg)
 		}
 
-		childResRectPtr, res := p.printObject(doc, r, child.ID, *sheetName, childOffset, excel, &clogger)
+		childResRectPtr, res := p.printObject(doc, r, images, child.ID, *sheetName, childOffset, excel, &clogger)
 		if res != nil {
 			clogger.Err(res).Msg("PrintChildObject")
 			return nil, res.With("PrintChildObject")
@@ -1812,7 +1785,7 @@ func (p *ExcelReportPrinter) printPivotLeftCell(excel *excelize.File, sheet stri
 
 // rect [in] rect.Top, rect.Left set the start offset posistion of the table;
 // rect* [out] rect.Top, rect.Left, rect.Width, rect.Height to indicate result table area;
-func (p *ExcelReportPrinter) printObject(doc *enigma.Doc, r Report, objId, useSheetName string, rect enigma.Rect, excel *excelize.File, _logger *zerolog.Logger) (*enigma.Rect, *util.Result) {
+func (p *ExcelReportPrinter) printObject(doc *enigma.Doc, r Report, images objectImages, objId, useSheetName string, rect enigma.Rect, excel *excelize.File, _logger *zerolog.Logger) (*enigma.Rect, *util.Result) {
 	obj, err := doc.GetObject(engine.ConnCtx, objId)
 	if err != nil {
 		_logger.Err(err).Msg("GetObject failed")
@@ -1830,22 +1803,64 @@ func (p *ExcelReportPrinter) printObject(doc *enigma.Doc, r Report, objId, useSh
 		return nil, res.With("GetObjectLayoutEx")
 	}
 
-	if objLayout.Info.Type == "container" || objLayout.Info.Type == "sn-tabbed-container" {
-		return p.printContainer(doc, r, objId, obj, objLayout, rect, excel, _logger)
+	sheetCount := len(excel.GetSheetList())
+	var resRect *enigma.Rect
+	isContainer := objLayout.Info.Type == "container" || objLayout.Info.Type == "sn-tabbed-container"
+	if isContainer {
+		resRect, res = p.printContainer(doc, r, images, objId, obj, objLayout, rect, excel, _logger)
+	} else if objLayout.HyperCube != nil && (objLayout.HyperCube.Mode == "P" || objLayout.HyperCube.Mode == "K") {
+		resRect, res = p.printPivotObject(doc, r, objId, useSheetName, objLayout, rect, excel, _logger)
+	} else {
+		resRect, res = p.printStackObject(doc, r, objId, useSheetName, objLayout, rect, excel, _logger)
 	}
-
-	if objLayout.HyperCube != nil && objLayout.HyperCube.Mode == "P" {
-		return p.printPivotObject(doc, r, objId, useSheetName, objLayout, rect, excel, _logger)
+	if res != nil || len(images[objId]) == 0 {
+		return resRect, res
 	}
 
-	if objLayout.HyperCube != nil && objLayout.HyperCube.Mode == "K" {
-		return p.printPivotObject(doc, r, objId, useSheetName, objLayout, rect, excel, _logger)
+	// containers always print into a new sheet, the first one added by this object
+	sheetName := useSheetName
+	if sheets := excel.GetSheetList(); (sheetName == "" || isContainer) && len(sheets) > sheetCount {
+		sheetName = sheets[sheetCount]
 	}
+	if res = p.printImages(images[objId], sheetName, *resRect, excel, _logger); res != nil {
+		return nil, res.With("printImages")
+	}
+	return resRect, nil
+}
 
-	return p.printStackObject(doc, r, objId, useSheetName, objLayout, rect, excel, _logger)
+// printImages places images to the right of table rect, one below another.
+func (p *ExcelReportPrinter) printImages(images []exportedImage, sheet string, rect enigma.Rect, excel *excelize.File, _logger *zerolog.Logger) *util.Result {
+	if sheet == "" {
+		_logger.Warn().Msg("no excel sheet to print images")
+		return nil
+	}
+	col := max(rect.Left, 1) + rect.Width + 1
+	row := max(rect.Top, 1)
+	for _, img := range images {
+		cell, err := excelize.CoordinatesToCellName(col, row)
+		if err != nil {
+			return util.Error("CoordinatesToCellName", err)
+		}
+		ext := "." + img.Format
+		if img.Format == engine.IMAGE_FORMAT_JPEG {
+			ext = ".jpg"
+		}
+		err = excel.AddPictureFromBytes(sheet, cell, &excelize.Picture{
+			Extension: ext,
+			File:      img.Data,
+			Format:    &excelize.GraphicOptions{AltText: img.ObjectId, LockAspectRatio: true},
+		})
+		if err != nil {
+			_logger.Err(err).Msgf("AddPicture %s", img.ObjectId)
+			return util.Error("AddPictureFromBytes", err)
+		}
+		// default row height is 20 pixels
+		row += img.Height/20 + 2
+	}
+	return nil
 }
 
-func (p *ExcelReportPrinter) printObjects(doc *enigma.Doc, r Report, excel *excelize.File, _logger *zerolog.Logger) *util.Result {
+func (p *ExcelReportPrinter) printObjects(doc *enigma.Doc, r Report, images objectImages, excel *excelize.File, _logger *zerolog.Logger) *util.Result {
 	osz := len(r.TargetIDs)
 	if osz < 1 {
 		_logger.Warn().Msg("no object to print")
@@ -1855,7 +1870,7 @@ func (p *ExcelReportPrinter) printObjects(doc *enigma.Doc, r Report, excel *exce
 	var res *util.Result
 	for _, objId := range r.TargetIDs {
 		rect := *r.OutputOffset
-		_, res = p.printObject(doc, r, objId, "", rect, excel, _logger)
+		_, res = p.printObject(doc, r, images, objId, "", rect, excel, _logger)
 		if res != nil {
 			_logger.Err(res).Msg("printObject")
 			return res.With("printObject")
@@ -1866,7 +1881,7 @@ func (p *ExcelReportPrinter) printObjects(doc *enigma.Doc, r Report, excel *exce
 	return nil
 }
 
-func (p *ExcelReportPrinter) printSheet(doc *enigma.Doc, r Report, excel *excelize.File, _logger *zerolog.Logger) *util.Result {
+func (p *ExcelReportPrinter) printSheet(doc *enigma.Doc, r Report, images objectImages, excel *excelize.File, _logger *zerolog.Logger) *util.Result {
 	if len(r.TargetIDs) != 1 {
 		_logger.Warn().Msg("invalid sheet id")
 		return nil
@@ -1889,7 +1904,7 @@ func (p *ExcelReportPrinter) printSheet(doc *enigma.Doc, r Report, excel *exceli
 	var res *util.Result
 	for _, child := range children {
 		rect := *r.OutputOffset
-		_, res = p.printObject(doc, r, child.Id, "", rect, excel, &logger)
+		_, res = p.printObject(doc, r, images, child.Id, "", rect, excel, &logger)
 		if res != nil {
 			logger.Err(res).Msg("printObject")
 			return res.With("printObject")
@@ -1904,6 +1919,12 @@ func (p *ExcelReportPrinter) Print(r Report) *util.Result {
 		return util.MsgError("Print", "invalid report")
 	}
 
+	closeQueries, res := r.openQueries()
+	if res != nil {
+		return res.With("openQueries")
+	}
+	defer closeQueries()
+
 	rResult, res := NewReportResult(r)
 	if res != nil {
 		return res.With("NewReportResult")
@@ -1915,6 +1936,16 @@ func (p *ExcelReportPrinter) Print(r Report) *util.Result {
 		return util.MsgError("CheckDoc", "doc is not opened")
 	}
 
+	images, res := r.exportImages(&logger)
+	if res != nil {
+		return res.With("exportImages")
+	}
+
+	prot, res := resolveProtection(r)
+	if res != nil {
+		return res.LogWith(&logger, "resolveProtection")
+	}
+
 	var f *excelize.File
 	if r.IsSub {
 		logger.Info().Msgf("this is sub report, try to open existing one")
@@ -1925,7 +1956,11 @@ func (p *ExcelReportPrinter) Print(r Report) *util.Result {
 		}
 		if ok {
 			logger.Info().Msgf("%s exists, appending sub report to it", *rResult.ReportFile)
-			f, err = excelize.OpenFile(*rResult.ReportFile)
+			if prot != nil {
+				f, err = excelize.OpenFile(*rResult.ReportFile, excelize.Options{Password: prot.Password})
+			} else {
+				f, err = excelize.OpenFile(*rResult.ReportFile)
+			}
 			if err != nil {
 				logger.Err(err).Msgf("couldn't open existing report: %s", *rResult.ReportFile)
 				return util.Error("OpenExcelFile", err)
@@ -1948,13 +1983,13 @@ func (p *ExcelReportPrinter) Print(r Report) *util.Result {
 	}
 	r.Target = strings.ToLower(r.Target)
 	if r.Target == TARGET_OBJECTS {
-		res = p.printObjects(r.Doc, r, f, &logger)
+		res = p.printObjects(r.Doc, r, images, f, &logger)
 		if res != nil {
 			logger.Err(res).Msg("printObject")
 			return res.With("printObjects")
 		}
 	} else if r.Target == TARGET_SHEET {
-		res = p.printSheet(r.Doc, r, f, &logger)
+		res = p.printSheet(r.Doc, r, images, f, &logger)
 		if res != nil {
 			logger.Err(res).Msg("printSheet")
 			return res.With("printSheet")
@@ -1967,7 +2002,7 @@ func (p *ExcelReportPrinter) Print(r Report) *util.Result {
 	logger.Info().Msgf("report is printed")
 
 	f.DeleteSheet("Sheet1")
-	if err := f.SaveAs(*rResult.ReportFile); err != nil {
+	if err := saveWorkbook(f, *rResult.ReportFile, prot); err != nil {
 		res = util.Error("SaveWorkBook", err)
 		logger.Err(res).Msg("SaveWorkBook")
 		return res
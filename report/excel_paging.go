@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"os"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -797,14 +798,8 @@ func (p *ExcelPagingPrinter) printCustomHeaders(colCount int, sheet string, rect
 	for hi, header := range p.report.Headers {
 		// Evaluate text value
 		textVal := header.Text
-		if text := strings.TrimSpace(header.Text); strings.HasPrefix(text, "=") {
-			dual, err := p.doc.EvaluateEx(engine.ConnCtx, header.Text)
-			if err == nil {
-				textVal = dual.Text
-				if textVal == "" && dual.IsNumeric {
-					textVal = fmt.Sprintf("%v", dual.Number)
-				}
-			}
+		if text, res := evaluateText(p.doc, header.Text, header.Eval); res == nil {
+			textVal = text
 		}
 
 		// Merge all columns in this row into one cell
@@ -850,14 +845,8 @@ func (p *ExcelPagingPrinter) printCustomFooters(colCount int, sheet string, rect
 	for fi, footer := range p.report.Footers {
 		// Evaluate text value
 		textVal := footer.Text
-		if text := strings.TrimSpace(footer.Text); strings.HasPrefix(text, "=") {
-			dual, err := p.doc.EvaluateEx(engine.ConnCtx, footer.Text)
-			if err == nil {
-				textVal = dual.Text
-				if textVal == "" && dual.IsNumeric {
-					textVal = fmt.Sprintf("%v", dual.Number)
-				}
-			}
+		if text, res := evaluateText(p.doc, footer.Text, footer.Eval); res == nil {
+			textVal = text
 		}
 
 		// Merge all columns in this row into one cell
@@ -908,14 +897,8 @@ func (p *ExcelPagingPrinter) printLegends(colCount int, sheet string, rect enigm
 	for li, legend := range p.report.Legends {
 		// Evaluate text value
 		textVal := legend.Text
-		if text := strings.TrimSpace(legend.Text); strings.HasPrefix(text, "=") {
-			dual, err := p.doc.EvaluateEx(engine.ConnCtx, legend.Text)
-			if err == nil {
-				textVal = dual.Text
-				if textVal == "" && dual.IsNumeric {
-					textVal = fmt.Sprintf("%v", dual.Number)
-				}
-			}
+		if text, res := evaluateText(p.doc, legend.Text, legend.Eval); res == nil {
+			textVal = text
 		}
 
 		// Merge all columns in this row into one cell
@@ -1237,6 +1220,15 @@ func (p *ExcelPagingPrinter) Print(r Report) *util.Result {
 	if !r.IsValid() {
 		return util.MsgError("Print", "invalid report")
 	}
+	if len(r.Images) > 0 {
+		return util.MsgError("Print", "images aren't supported by paged excel reports")
+	}
+
+	closeQueries, res := r.openQueries()
+	if res != nil {
+		return res.With("openQueries")
+	}
+	defer closeQueries()
 
 	if r.Name != nil {
 		p.Config.ReportTitle = *r.Name
@@ -1278,6 +1270,11 @@ func (p *ExcelPagingPrinter) Print(r Report) *util.Result {
 		return util.MsgError("CheckDoc", "doc is not opened")
 	}
 
+	prot, res := resolveProtection(r)
+	if res != nil {
+		return res.LogWith(&logger, "resolveProtection")
+	}
+
 	// Initialize execution context
 	p.report = r
 	p.doc = r.Doc
@@ -1466,23 +1463,46 @@ func (p *ExcelPagingPrinter) Print(r Report) *util.Result {
 		logger.Warn().Msgf("DeleteSheet Sheet1: %v", err)
 	}
 
-	if err := p.excel.SaveAs(*rResult.ReportFile); err != nil {
+	convertToPDF := r.PaginationConfig != nil && r.PaginationConfig.ConverToPDF
+	// LibreOffice can't open encrypted workbook, so it's protected after conversion
+	saveProt := prot
+	if convertToPDF {
+		saveProt = nil
+	}
+	if err := saveWorkbook(p.excel, *rResult.ReportFile, saveProt); err != nil {
 		return util.Error("SaveWorkBook", err)
 	}
 	logger.Info().Msgf("report saved as [%s]", *rResult.ReportFile)
 
-	if r.PaginationConfig != nil && r.PaginationConfig.ConverToPDF {
-		res := p.convertExcelToPDF(rResult)
+	if convertToPDF {
+		xlsxFile := *rResult.ReportFile
+		res := p.convertExcelToPDF(rResult, prot)
+		// the unprotected workbook is protected by password, or removed if it can't be:
+		// conversion failed or protection has an owner password only, which workbooks don't support
+		if prot != nil && (res != nil || prot.Password == "") {
+			if err := os.Remove(xlsxFile); err != nil && res == nil {
+				return util.Error("RemoveWorkBook", err)
+			}
+		} else if prot != nil {
+			if err := saveWorkbook(p.excel, xlsxFile, prot); err != nil {
+				os.Remove(xlsxFile)
+				return util.Error("ProtectWorkBook", err)
+			}
+		}
 		if res != nil {
 			return res.With("ConvertExcelToPDF")
 		}
+		if prot != nil {
+			logger.Info().Msgf("converted pdf [%s] is protected", *rResult.ReportFile)
+		}
 	}
 	// Store report result
 	p.ReportResults[util.MaybeNil(r.ID)] = rResult
 	return nil
 }
 
-func (p *ExcelPagingPrinter) convertExcelToPDF(rResult *ReportResult) *util.Result {
+// convertExcelToPDF converts the report file to PDF with passwords and permissions of prot, if any.
+func (p *ExcelPagingPrinter) convertExcelToPDF(rResult *ReportResult, prot *ReportProtection) *util.Result {
 	logger := rResult.Logger.With().Str("report", rResult.ID).Str("driver", "excel_to_pdf").Logger()
 	logger.Info().Msgf("converting excel to pdf: %s", *rResult.ReportFile)
 
@@ -1494,6 +1514,7 @@ func (p *ExcelPagingPrinter) convertExcelToPDF(rResult *ReportResult) *util.Resu
 	excel2PDFConfig := ExcelToPDFTaskConfig{
 		InputExcelPath: *rResult.ReportFile,
 		OutputPDFPath:  pdfFilePath,
+		Protection:     prot,
 		Logger:         &logger,
 	}
 
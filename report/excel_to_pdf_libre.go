@@ -25,6 +25,9 @@ type ExcelToPDFTaskConfig struct {
 	// Export options (limited compared to Windows COM)
 	// Note: Page setup, margins, orientation are embedded in Excel file - LibreOffice respects them
 
+	// Protection sets passwords and permissions of the PDF
+	Protection *ReportProtection `json:"-" yaml:"-" bson:"-"`
+
 	// Logger
 	Logger *zerolog.Logger `json:"-" yaml:"-" bson:"-"`
 }
@@ -274,8 +277,18 @@ func (l *LibreExcel2PDF) executeConversion(ctx context.Context, config ExcelToPD
 	logger.Debug().
 		Str("bin", l.libreOfficeBin).
 		Strs("args", args).
+		Bool("protected", config.Protection.IsEnabled()).
 		Msg("executing LibreOffice command")
 
+	// set after logging so that passwords aren't logged
+	if config.Protection.IsEnabled() {
+		filter, res := config.Protection.libreOfficePdfFilter()
+		if res != nil {
+			return res.With("libreOfficePdfFilter")
+		}
+		args[3] = "pdf:calc_pdf_Export:" + filter
+	}
+
 	// Create command with context for timeout/cancellation support
 	cmd := exec.CommandContext(ctx, l.libreOfficeBin, args...)
 
@@ -0,0 +1,244 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/soderasen-au/go-common/loggers"
+	"github.com/soderasen-au/go-common/util"
+	"github.com/xuri/excelize/v2"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+	"github.com/soderasen-au/go-qlik/qlik/engine/enginetest"
+)
+
+// fakeReport prints objects `ids` of a new session of the sales fixture.
+func fakeReport(t *testing.T, format ReportFormat, ids ...string) Report {
+	t.Helper()
+	_, doc := enginetest.OpenDoc(t, enginetest.SalesFixture())
+	return docReport(t, doc, format, ids...)
+}
+
+// docReport prints objects `ids` of doc of the sales fixture.
+func docReport(t *testing.T, doc *enigma.Doc, format ReportFormat, ids ...string) Report {
+	return Report{
+		ID:           util.Ptr("fake-" + string(format)),
+		Doc:          doc,
+		AppId:        "sales",
+		Target:       TARGET_OBJECTS,
+		TargetIDs:    ids,
+		OutputFormat: util.Ptr(format),
+		OutputFolder: util.Ptr(t.TempDir()),
+		Logger:       loggers.NullLogger,
+	}
+}
+
+func TestCsvReportPrinter_Fake(t *testing.T) {
+	r := fakeReport(t, REPORT_FORMAT_CSV, "tbl-sales")
+	p := NewCsvReportPrinter()
+	if res := p.Print(r); res != nil {
+		t.Fatalf("Print: %v", res)
+	}
+
+	f, err := os.Open(util.MaybeNil(p.ReportResults[*r.ID].ReportFile))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if len(records) != 6 {
+		t.Fatalf("records = %v", records)
+	}
+	wantHeader := []string{"Region", "Product", "Sales", "Margin"}
+	for i, h := range wantHeader {
+		if records[0][i] != h {
+			t.Errorf("header = %v, want %v", records[0], wantHeader)
+			break
+		}
+	}
+	if records[4][0] != "West" || records[4][2] != "150" {
+		t.Errorf("records[4] = %v", records[4])
+	}
+}
+
+func TestCsvReportPrinter_FakeProtected(t *testing.T) {
+	r := fakeReport(t, REPORT_FORMAT_CSV, "tbl-sales")
+	r.Protection = &ReportProtection{Password: "s3cret", EnvelopeWorkFactor: 10}
+	p := NewCsvReportPrinter()
+	if res := p.Print(r); res != nil {
+		t.Fatalf("Print: %v", res)
+	}
+	files, _ := os.ReadDir(*r.OutputFolder)
+	if len(files) != 1 || files[0].Name() != *r.ID+".csv.age" {
+		t.Errorf("files = %v, want only the envelope", files)
+	}
+
+	// no plain file is written if the password can't be resolved
+	r = fakeReport(t, REPORT_FORMAT_CSV, "tbl-sales")
+	r.Protection = &ReportProtection{Password: "=''"}
+	if res := p.Print(r); res == nil {
+		t.Fatal("Print with an empty password succeeded")
+	}
+	if files, _ := os.ReadDir(*r.OutputFolder); len(files) != 0 {
+		t.Errorf("files = %v, want none", files)
+	}
+}
+
+func TestExcelReportPrinter_Fake(t *testing.T) {
+	r := fakeReport(t, REPORT_FORMAT_XLSX, "tbl-sales", "pvt-sales")
+	p := NewExcelReportPrinter()
+	if res := p.Print(r); res != nil {
+		t.Fatalf("Print: %v", res)
+	}
+
+	file := util.MaybeNil(p.ReportResults[*r.ID].ReportFile)
+	if filepath.Ext(file) != ".xlsx" {
+		t.Errorf("report file = %s", file)
+	}
+	xlsx, err := excelize.OpenFile(file)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	defer xlsx.Close()
+	if n := len(xlsx.GetSheetList()); n < 2 {
+		t.Errorf("sheets = %v", xlsx.GetSheetList())
+	}
+}
+
+func TestCsvReportPrinter_FakeQuery(t *testing.T) {
+	r := fakeReport(t, REPORT_FORMAT_CSV)
+	r.Target = TARGET_QUERIES
+	r.Queries = []*engine.Query{engine.NewQuery("by product").Dimension("Product").MasterMeasure("Total Sales").OrderBy("-Total Sales")}
+	if res := r.Validate(); res != nil {
+		t.Fatalf("Validate: %v", res)
+	}
+	p := NewCsvReportPrinter()
+	if res := p.Print(r); res != nil {
+		t.Fatalf("Print: %v", res)
+	}
+
+	f, err := os.Open(util.MaybeNil(p.ReportResults[*r.ID].ReportFile))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if len(records) != 3 || records[0][0] != "Product" || records[0][1] != "Total Sales" || records[1][0] != "Bikes" || records[1][1] != "330" {
+		t.Errorf("records = %v", records)
+	}
+}
+
+func TestExcelReportPrinter_FakeHeaders(t *testing.T) {
+	r := fakeReport(t, REPORT_FORMAT_XLSX, "tbl-sales")
+	r.Headers = []CustomHeader{
+		{Label: "Total", Text: "=Sum(Sales)"},
+		{Label: "Summary", Text: "Sales $(=Sum(Sales)) in $(=Max(Year))"},
+	}
+	r.Legends = []Legend{{Label: "Margin", Text: "$(=vMarginRate)"}}
+	p := NewExcelReportPrinter()
+	if res := p.Print(r); res != nil {
+		t.Fatalf("Print: %v", res)
+	}
+
+	xlsx, err := excelize.OpenFile(util.MaybeNil(p.ReportResults[*r.ID].ReportFile))
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	defer xlsx.Close()
+	rows, err := xlsx.GetRows(xlsx.GetSheetList()[0])
+	if err != nil {
+		t.Fatalf("GetRows: %v", err)
+	}
+	found := make(map[string]bool)
+	for _, row := range rows {
+		for _, cell := range row {
+			found[cell] = true
+		}
+	}
+	for _, want := range []string{"430", "Sales 430 in 2024", "0.25"} {
+		if !found[want] {
+			t.Errorf("no %q in %v", want, rows)
+		}
+	}
+}
+
+func TestPdfReportPrinter_Fake(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		ids    []string
+	}{
+		{"objects", TARGET_OBJECTS, []string{"tbl-sales", "pvt-sales", "ctn-kpis"}},
+		{"sheet", TARGET_SHEET, []string{"sheet-overview"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := fakeReport(t, REPORT_FORMAT_PDF, tt.ids...)
+			r.Target = tt.target
+			p := NewPdfReportPrinter()
+			if res := p.Print(r); res != nil {
+				t.Fatalf("Print: %v", res)
+			}
+
+			buf, err := os.ReadFile(util.MaybeNil(p.ReportResults[*r.ID].ReportFile))
+			if err != nil {
+				t.Fatalf("ReadFile: %v", err)
+			}
+			if !bytes.HasPrefix(buf, []byte("%PDF-")) || bytes.Count(buf, []byte("/Type /Page\n")) < 1 {
+				t.Errorf("not a pdf: %.64q", buf)
+			}
+		})
+	}
+}
+
+func TestExcelPagingPrinter_Fake(t *testing.T) {
+	r := fakeReport(t, REPORT_FORMAT_PAGED_XLSX, "tbl-sales")
+	r.PaginationConfig = &PaginationConfig{RowsPerPage: 2, ShowSubtotals: true, ShowGrandTotals: true}
+	p := NewExcelPagingPrinter(DefaultExcelPagingConfig())
+	if res := p.Print(r); res != nil {
+		t.Fatalf("Print: %v", res)
+	}
+
+	xlsx, err := excelize.OpenFile(util.MaybeNil(p.ReportResults[*r.ID].ReportFile))
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	defer xlsx.Close()
+	if sheets := xlsx.GetSheetList(); len(sheets) != 3 || sheets[2] != "page-3" {
+		t.Fatalf("sheets = %v", sheets)
+	}
+	tests := []struct {
+		sheet string
+		want  string
+	}{
+		{"page-1", "Grand Total,,430,107.5"},
+		{"page-1", "East,Helmets,40,10"},
+		{"page-2", "West,Bikes,150,37.5"},
+		{"page-3", "Total Records Found 5"},
+		{"page-3", "West,Helmets,60,15"},
+	}
+	for _, tt := range tests {
+		rows, err := xlsx.GetRows(tt.sheet)
+		if err != nil {
+			t.Fatalf("GetRows: %v", err)
+		}
+		found := false
+		for _, row := range rows {
+			found = found || strings.Join(row, ",") == tt.want
+		}
+		if !found {
+			t.Errorf("no %q in %s: %q", tt.want, tt.sheet, rows)
+		}
+	}
+}
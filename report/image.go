@@ -0,0 +1,91 @@
+package report
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog"
+	"github.com/soderasen-au/go-common/util"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+)
+
+// ReportImage is an image of object ObjectId printed next to the printed object Anchor,
+// which defaults to ObjectId itself.
+type ReportImage struct {
+	ObjectId string `json:"object_id" yaml:"object_id" bson:"object_id"`
+	Anchor   string `json:"anchor,omitempty" yaml:"anchor,omitempty" bson:"anchor,omitempty"`
+	Width    int    `json:"width,omitempty" yaml:"width,omitempty" bson:"width,omitempty"`    // pixels
+	Height   int    `json:"height,omitempty" yaml:"height,omitempty" bson:"height,omitempty"` // pixels
+	Format   string `json:"format,omitempty" yaml:"format,omitempty" bson:"format,omitempty"` // `png` or `jpeg`
+}
+
+func (i ReportImage) AnchorId() string {
+	if i.Anchor != "" {
+		return i.Anchor
+	}
+	return i.ObjectId
+}
+
+type exportedImage struct {
+	ReportImage
+	Data []byte
+}
+
+// objectImages are exported images by anchor.
+type objectImages map[string][]exportedImage
+
+// excel and gofpdf embed only raster images
+func (i ReportImage) Validate() *util.Result {
+	if i.ObjectId == "" {
+		return util.MsgError("ValidateImage", "no object id")
+	}
+	switch i.Format {
+	case "", engine.IMAGE_FORMAT_PNG, engine.IMAGE_FORMAT_JPEG:
+		return nil
+	}
+	return util.MsgError("ValidateImage", fmt.Sprintf("image format `%s` is not supported", i.Format))
+}
+
+// exportImages exports `r.Images` in current selections of `r.Doc`, grouped by anchor.
+func (r Report) exportImages(logger *zerolog.Logger) (objectImages, *util.Result) {
+	if len(r.Images) == 0 {
+		return nil, nil
+	}
+	if r.ImageExporter == nil {
+		return nil, util.MsgError("exportImages", "report has images but no image exporter")
+	}
+	selections, res := engine.CaptureSelections(r.Doc)
+	if res != nil {
+		return nil, res.LogWith(logger, "CaptureSelections")
+	}
+
+	images := make(objectImages)
+	for _, img := range r.Images {
+		if res := img.Validate(); res != nil {
+			return nil, res.LogWith(logger, img.ObjectId)
+		}
+		req := engine.ObjectImageRequest{
+			AppId:      r.AppId,
+			ObjectId:   img.ObjectId,
+			Format:     img.Format,
+			Width:      img.Width,
+			Height:     img.Height,
+			Selections: selections,
+		}
+		full := req.WithDefaults()
+		exported := exportedImage{ReportImage: ReportImage{
+			ObjectId: img.ObjectId,
+			Anchor:   img.Anchor,
+			Width:    full.Width,
+			Height:   full.Height,
+			Format:   full.Format,
+		}}
+		exported.Data, res = r.ImageExporter.ExportObjectImage(full)
+		if res != nil {
+			return nil, res.LogWith(logger, "ExportObjectImage: "+img.ObjectId)
+		}
+		logger.Info().Msgf("exported image of %s: %d bytes", img.ObjectId, len(exported.Data))
+		images[img.AnchorId()] = append(images[img.AnchorId()], exported)
+	}
+	return images, nil
+}
@@ -0,0 +1,139 @@
+package report
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/soderasen-au/go-common/util"
+	"github.com/xuri/excelize/v2"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+)
+
+type stubImageExporter struct {
+	requests []*engine.ObjectImageRequest
+}
+
+func (e *stubImageExporter) ExportObjectImage(req *engine.ObjectImageRequest) ([]byte, *util.Result) {
+	e.requests = append(e.requests, req)
+	img := image.NewRGBA(image.Rect(0, 0, req.Width, req.Height))
+	for x := 0; x < req.Width; x++ {
+		img.Set(x, req.Height/2, color.Black)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, util.Error("Encode", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func TestReport_Images(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		images  []ReportImage
+		wantErr bool
+	}{
+		{"anchored to itself", "tbl-sales", []ReportImage{{ObjectId: "tbl-sales", Width: 200, Height: 100}}, false},
+		{"anchored to table", "tbl-sales", []ReportImage{{ObjectId: "kpi-sales", Anchor: "tbl-sales"}}, false},
+		{"anchored to container", "ctn-kpis", []ReportImage{{ObjectId: "ctn-kpis"}}, false},
+		{"anchored to container child", "ctn-kpis", []ReportImage{{ObjectId: "tbl-sales", Anchor: "kpi-sales"}}, false},
+		{"pdf image", "tbl-sales", []ReportImage{{ObjectId: "tbl-sales", Format: engine.IMAGE_FORMAT_PDF}}, true},
+	}
+	for _, format := range []ReportFormat{REPORT_FORMAT_XLSX, REPORT_FORMAT_PDF} {
+		for _, tt := range tests {
+			t.Run(string(format)+"/"+tt.name, func(t *testing.T) {
+				r := fakeReport(t, format, tt.target)
+				field, err := r.Doc.GetField(engine.ConnCtx, "Region", "")
+				if err != nil {
+					t.Fatalf("GetField: %v", err)
+				}
+				if _, err := field.Select(engine.ConnCtx, "East", false, 0); err != nil {
+					t.Fatalf("Select: %v", err)
+				}
+
+				// labels of container children are printed in the row above them
+				r.OutputOffset = &enigma.Rect{Top: 2, Left: 1}
+				exporter := &stubImageExporter{}
+				r.Images = tt.images
+				r.ImageExporter = exporter
+				var printer IReportPrinter = NewExcelReportPrinter()
+				if format == REPORT_FORMAT_PDF {
+					printer = NewPdfReportPrinter()
+				}
+				res := printer.Print(r)
+				if (res != nil) != tt.wantErr {
+					t.Fatalf("Print() error = %v, wantErr %v", res, tt.wantErr)
+				}
+				if tt.wantErr {
+					return
+				}
+
+				if len(exporter.requests) != 1 {
+					t.Fatalf("requests = %s", util.JsonStr(exporter.requests))
+				}
+				req := exporter.requests[0]
+				if req.AppId != "sales" || req.ObjectId != tt.images[0].ObjectId || req.Format != engine.IMAGE_FORMAT_PNG ||
+					req.Selections == nil || req.Selections.State("").Fields[0].Field != "Region" {
+					t.Errorf("request = %s", util.JsonStr(req))
+				}
+
+				result, res := printer.GetReportResult(*r.ID)
+				if res != nil {
+					t.Fatalf("GetReportResult: %v", res)
+				}
+				if format == REPORT_FORMAT_PDF {
+					data, err := os.ReadFile(*result.ReportFile)
+					if err != nil {
+						t.Fatalf("ReadFile: %v", err)
+					}
+					if !strings.Contains(string(data), "/Subtype /Image") {
+						t.Errorf("pdf has no image")
+					}
+					return
+				}
+
+				xlsx, err := excelize.OpenFile(*result.ReportFile)
+				if err != nil {
+					t.Fatalf("OpenFile: %v", err)
+				}
+				defer xlsx.Close()
+				cells := make([]string, 0)
+				for _, sheet := range xlsx.GetSheetList() {
+					sheetCells, err := xlsx.GetPictureCells(sheet)
+					if err != nil {
+						t.Fatalf("GetPictureCells: %v", err)
+					}
+					cells = append(cells, sheetCells...)
+				}
+				if len(cells) != 1 {
+					t.Errorf("picture cells = %v", cells)
+				}
+			})
+		}
+	}
+}
+
+func TestReport_ImagesNotSupported(t *testing.T) {
+	images := []ReportImage{{ObjectId: "tbl-sales"}}
+	for _, format := range []ReportFormat{REPORT_FORMAT_CSV, REPORT_FORMAT_PAGED_XLSX} {
+		r := fakeReport(t, format, "tbl-sales")
+		r.Images = images
+		if res := r.Validate(); res == nil {
+			t.Errorf("Validate(%s) with images succeeded", format)
+		}
+	}
+
+	r := fakeReport(t, REPORT_FORMAT_PAGED_XLSX, "tbl-sales")
+	r.Images = images
+	r.ImageExporter = &stubImageExporter{}
+	if res := NewExcelPagingPrinter(DefaultExcelPagingConfig()).Print(r); res == nil {
+		t.Errorf("paged excel Print() with images succeeded")
+	}
+}
@@ -1,6 +1,7 @@
 package report
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"math"
@@ -505,17 +506,10 @@ func (p *PdfReportPrinter) printCustomHeaders(doc *enigma.Doc, headers []CustomH
 			p.pdf.SetX(PDF_MARGIN_LEFT + float64(offset.Left))
 		}
 
-		text := header.Text
-		if t := strings.TrimSpace(text); strings.HasPrefix(t, "=") {
-			dual, err := doc.EvaluateEx(engine.ConnCtx, header.Text)
-			if err != nil {
-				logger.Err(err).Msg("EvaluateEx")
-				return util.Error("EvaluateEx", err)
-			}
-			text = dual.Text
-			if text == "" && dual.IsNumeric {
-				text = fmt.Sprintf("%v", dual.Number)
-			}
+		text, res := evaluateText(doc, header.Text, header.Eval)
+		if res != nil {
+			logger.Err(res).Msg("evaluateText")
+			return res.With("evaluateText")
 		}
 
 		p.pdf.SetFont("Arial", "B", PDF_FONT_SIZE)
@@ -558,17 +552,10 @@ func (p *PdfReportPrinter) printCustomFooters(doc *enigma.Doc, footers []CustomH
 			p.pdf.SetX(PDF_MARGIN_LEFT + float64(offset.Left))
 		}
 
-		text := footer.Text
-		if t := strings.TrimSpace(text); strings.HasPrefix(t, "=") {
-			dual, err := doc.EvaluateEx(engine.ConnCtx, footer.Text)
-			if err != nil {
-				logger.Err(err).Msg("EvaluateEx")
-				return util.Error("EvaluateEx", err)
-			}
-			text = dual.Text
-			if text == "" && dual.IsNumeric {
-				text = fmt.Sprintf("%v", dual.Number)
-			}
+		text, res := evaluateText(doc, footer.Text, footer.Eval)
+		if res != nil {
+			logger.Err(res).Msg("evaluateText")
+			return res.With("evaluateText")
 		}
 
 		p.pdf.SetFont("Arial", "B", PDF_FONT_SIZE)
@@ -618,17 +605,10 @@ func (p *PdfReportPrinter) printLegends(doc *enigma.Doc, legends []Legend, table
 
 		p.pdf.SetX(startX)
 
-		text := legend.Text
-		if t := strings.TrimSpace(text); strings.HasPrefix(t, "=") {
-			dual, err := doc.EvaluateEx(engine.ConnCtx, legend.Text)
-			if err != nil {
-				logger.Err(err).Msg("EvaluateEx")
-				return util.Error("EvaluateEx", err)
-			}
-			text = dual.Text
-			if text == "" && dual.IsNumeric {
-				text = fmt.Sprintf("%v", dual.Number)
-			}
+		text, res := evaluateText(doc, legend.Text, legend.Eval)
+		if res != nil {
+			logger.Err(res).Msg("evaluateText")
+			return res.With("evaluateText")
 		}
 
 		p.pdf.SetFont("Arial", "B", PDF_FONT_SIZE)
@@ -661,7 +641,7 @@ func (p *PdfReportPrinter) printSheetHeader(r Report, doc *enigma.Doc, logger *z
 }
 
 // Print container object (object with children)
-func (p *PdfReportPrinter) printContainer(r Report, objId string, logger *zerolog.Logger) *util.Result {
+func (p *PdfReportPrinter) printContainer(r Report, images objectImages, objId string, logger *zerolog.Logger) *util.Result {
 	logger.Info().Msgf("printing container object: %s", objId)
 
 	obj, err := r.Doc.GetObject(engine.ConnCtx, objId)
@@ -728,7 +708,7 @@ func (p *PdfReportPrinter) printContainer(r Report, objId string, logger *zerolo
 
 		// Print child object
 		childLogger := logger.With().Int("child", ci).Str("id", childID).Logger()
-		if res := p.printObject(r, childID, &childLogger); res != nil {
+		if res := p.printObject(r, images, childID, &childLogger); res != nil {
 			logger.Err(res).Msgf("failed to print child %s", childID)
 			return res.With("printObject")
 		}
@@ -743,7 +723,7 @@ func (p *PdfReportPrinter) printContainer(r Report, objId string, logger *zerolo
 }
 
 // Print object (dispatcher for different object types)
-func (p *PdfReportPrinter) printObject(r Report, objId string, logger *zerolog.Logger) *util.Result {
+func (p *PdfReportPrinter) printObject(r Report, images objectImages, objId string, logger *zerolog.Logger) *util.Result {
 	obj, err := r.Doc.GetObject(engine.ConnCtx, objId)
 	if err != nil {
 		return util.Error("GetObject", err)
@@ -759,21 +739,43 @@ func (p *PdfReportPrinter) printObject(r Report, objId string, logger *zerolog.L
 
 	// Container objects
 	if objLayout.Info.Type == "container" {
-		return p.printContainer(r, objId, logger)
-	}
-
-	// Pivot tables - full support
-	if objLayout.HyperCube != nil && (objLayout.HyperCube.Mode == "P" || objLayout.HyperCube.Mode == "K") {
+		res = p.printContainer(r, images, objId, logger)
+	} else if objLayout.HyperCube != nil && (objLayout.HyperCube.Mode == "P" || objLayout.HyperCube.Mode == "K") {
 		logger.Info().Msg("Printing pivot table")
-		return p.printPivotObject(r, objId, obj, objLayout, logger)
+		res = p.printPivotObject(r, objId, obj, objLayout, logger)
+	} else {
+		// Standard stack objects
+		res = p.printStackObject(r, objId, logger)
 	}
+	if res != nil {
+		return res
+	}
+
+	return p.printImages(images[objId], logger)
+}
 
-	// Standard stack objects
-	return p.printStackObject(r, objId, logger)
+// Print images below the current object, scaled down to the page width
+func (p *PdfReportPrinter) printImages(images []exportedImage, logger *zerolog.Logger) *util.Result {
+	maxWidth := p.pageWidth - PDF_MARGIN_LEFT - PDF_MARGIN_RIGHT
+	for i, img := range images {
+		name := fmt.Sprintf("%s-%d", img.ObjectId, i)
+		opts := gofpdf.ImageOptions{ImageType: img.Format}
+		p.pdf.RegisterImageOptionsReader(name, opts, bytes.NewReader(img.Data))
+
+		// pixels at 96 dpi to mm
+		width := min(float64(img.Width)*25.4/96, maxWidth)
+		p.pdf.Ln(3)
+		p.pdf.ImageOptions(name, PDF_MARGIN_LEFT, -1, width, 0, true, opts, 0, "")
+		if err := p.pdf.Error(); err != nil {
+			logger.Err(err).Msgf("failed to print image of %s", img.ObjectId)
+			return util.Error("ImageOptions", err)
+		}
+	}
+	return nil
 }
 
 // Print multiple objects
-func (p *PdfReportPrinter) printObjects(r Report, logger *zerolog.Logger) *util.Result {
+func (p *PdfReportPrinter) printObjects(r Report, images objectImages, logger *zerolog.Logger) *util.Result {
 	if len(r.TargetIDs) < 1 {
 		logger.Warn().Msg("no objects to print")
 		return nil
@@ -781,7 +783,7 @@ func (p *PdfReportPrinter) printObjects(r Report, logger *zerolog.Logger) *util.
 
 	for i, objId := range r.TargetIDs {
 		objLogger := logger.With().Int("object", i).Str("id", objId).Logger()
-		if res := p.printObject(r, objId, &objLogger); res != nil {
+		if res := p.printObject(r, images, objId, &objLogger); res != nil {
 			objLogger.Err(res).Msg("printObject failed")
 			return res.With("printObject")
 		}
@@ -796,7 +798,7 @@ func (p *PdfReportPrinter) printObjects(r Report, logger *zerolog.Logger) *util.
 }
 
 // Print entire sheet
-func (p *PdfReportPrinter) printSheet(r Report, logger *zerolog.Logger) *util.Result {
+func (p *PdfReportPrinter) printSheet(r Report, images objectImages, logger *zerolog.Logger) *util.Result {
 	if len(r.TargetIDs) != 1 {
 		return util.MsgError("printSheet", "exactly one sheet ID required")
 	}
@@ -816,7 +818,7 @@ func (p *PdfReportPrinter) printSheet(r Report, logger *zerolog.Logger) *util.Re
 
 	for i, child := range children {
 		childLogger := logger.With().Int("child", i).Str("id", child.Id).Logger()
-		if res := p.printObject(r, child.Id, &childLogger); res != nil {
+		if res := p.printObject(r, images, child.Id, &childLogger); res != nil {
 			childLogger.Err(res).Msg("printObject failed")
 			return res.With("printObject")
 		}
@@ -986,6 +988,12 @@ func (p *PdfReportPrinter) Print(r Report) *util.Result {
 		return util.MsgError("Print", "invalid report")
 	}
 
+	closeQueries, res := r.openQueries()
+	if res != nil {
+		return res.With("openQueries")
+	}
+	defer closeQueries()
+
 	rResult, res := NewReportResult(r)
 	if res != nil {
 		return res.With("NewReportResult")
@@ -997,6 +1005,11 @@ func (p *PdfReportPrinter) Print(r Report) *util.Result {
 		return util.MsgError("CheckDoc", "doc is not opened")
 	}
 
+	images, res := r.exportImages(&logger)
+	if res != nil {
+		return res.With("exportImages")
+	}
+
 	// Determine PDF orientation and page dimensions
 	orientation := "L" // default landscape
 	if r.OutputPDFOrientation != nil && *r.OutputPDFOrientation == PDF_ORIENTATION_PORTRAIT {
@@ -1029,9 +1042,9 @@ func (p *PdfReportPrinter) Print(r Report) *util.Result {
 		if len(r.TargetIDs) < 1 {
 			return util.MsgError("Print", "no target objects specified")
 		}
-		res = p.printObjects(r, &logger)
+		res = p.printObjects(r, images, &logger)
 	} else if r.Target == TARGET_SHEET {
-		res = p.printSheet(r, &logger)
+		res = p.printSheet(r, images, &logger)
 	} else {
 		return util.MsgError("Print", fmt.Sprintf("PDF printer does not support target '%s'", r.Target))
 	}
@@ -1041,6 +1054,14 @@ func (p *PdfReportPrinter) Print(r Report) *util.Result {
 		return res
 	}
 
+	prot, res := resolveProtection(r)
+	if res != nil {
+		return res.LogWith(&logger, "resolveProtection")
+	}
+	if prot != nil {
+		p.pdf.SetProtection(prot.PdfPermissionFlag(), prot.Password, prot.OwnerPassword)
+	}
+
 	// Save PDF
 	err := p.pdf.OutputFileAndClose(*rResult.ReportFile)
 	if err != nil {
@@ -0,0 +1,270 @@
+package report
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/jung-kurt/gofpdf"
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/soderasen-au/go-common/util"
+	"github.com/xuri/excelize/v2"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+)
+
+const (
+	PROTECT_PERM_PRINT       string = "print"
+	PROTECT_PERM_MODIFY      string = "modify"
+	PROTECT_PERM_COPY        string = "copy"
+	PROTECT_PERM_ANNOT_FORMS string = "annot_forms"
+
+	// ENVELOPE_FILE_EXT is appended to files which can't carry a password themselves (csv, tsv),
+	// they are wrapped in an age envelope (https://age-encryption.org) using scrypt passphrase.
+	ENVELOPE_FILE_EXT string = "age"
+
+	// DEFAULT_ENVELOPE_WORK_FACTOR is the scrypt work factor of age envelopes, it's age's default.
+	DEFAULT_ENVELOPE_WORK_FACTOR = 18
+)
+
+var (
+	pdfPermissionFlags = map[string]byte{
+		PROTECT_PERM_PRINT:       gofpdf.CnProtectPrint,
+		PROTECT_PERM_MODIFY:      gofpdf.CnProtectModify,
+		PROTECT_PERM_COPY:        gofpdf.CnProtectCopy,
+		PROTECT_PERM_ANNOT_FORMS: gofpdf.CnProtectAnnotForms,
+	}
+)
+
+// ReportProtection protects report file at rest.
+//   - xlsx: workbook is encrypted with `Password` as open password
+//   - pdf: `Password` is the user password, `OwnerPassword` and `Permissions` control full access
+//   - csv/tsv: file is wrapped in an age envelope encrypted with `Password`, `.age` is appended to file name
+//
+// Only PDF can be protected by `OwnerPassword` alone, other formats need `Password`.
+//
+// `Password` and `OwnerPassword` starting with `=` are evaluated by engine against current selection,
+// so that it can be derived per recipient, e.g. `=Only([Employee Id]) & '-' & Year(Today())`
+type ReportProtection struct {
+	Password      string   `json:"password,omitempty" yaml:"password,omitempty" bson:"password,omitempty"`
+	OwnerPassword string   `json:"owner_password,omitempty" yaml:"owner_password,omitempty" bson:"owner_password,omitempty"` // only for PDF
+	Permissions   []string `json:"permissions,omitempty" yaml:"permissions,omitempty" bson:"permissions,omitempty"`          // only for PDF, values: "print", "modify", "copy", "annot_forms"
+	// scrypt work factor of csv/tsv envelopes, DEFAULT_ENVELOPE_WORK_FACTOR if 0
+	EnvelopeWorkFactor int `json:"envelope_work_factor,omitempty" yaml:"envelope_work_factor,omitempty" bson:"envelope_work_factor,omitempty"`
+}
+
+func (p *ReportProtection) IsEnabled() bool {
+	return p != nil && (p.Password != "" || p.OwnerPassword != "")
+}
+
+// Validate checks permissions, and that protection of a report which isn't a PDF has `Password`.
+func (p ReportProtection) Validate(pdf bool) *util.Result {
+	if !pdf && p.Password == "" && p.OwnerPassword != "" {
+		return util.MsgError("ValidateProtection", "owner password alone protects only PDF reports, password is required")
+	}
+	if p.EnvelopeWorkFactor < 0 || p.EnvelopeWorkFactor > 30 {
+		return util.MsgError("ValidateProtection", fmt.Sprintf("invalid envelope work factor %d", p.EnvelopeWorkFactor))
+	}
+	for _, perm := range p.Permissions {
+		if _, ok := pdfPermissionFlags[strings.ToLower(perm)]; !ok {
+			return util.MsgError("ValidateProtection", fmt.Sprintf("invalid permission '%s'", perm))
+		}
+	}
+	return nil
+}
+
+// PdfPermissionFlag translates `Permissions` to gofpdf action flag
+func (p ReportProtection) PdfPermissionFlag() byte {
+	var flag byte
+	for _, perm := range p.Permissions {
+		flag |= pdfPermissionFlags[strings.ToLower(perm)]
+	}
+	return flag
+}
+
+// Resolve returns a copy with passwords evaluated against current selection of doc.
+func (p ReportProtection) Resolve(doc *enigma.Doc) (*ReportProtection, *util.Result) {
+	ret := p
+	var res *util.Result
+	ret.Password, res = evaluateText(doc, p.Password, nil)
+	if res != nil {
+		return nil, res.With("Password")
+	}
+	ret.OwnerPassword, res = evaluateText(doc, p.OwnerPassword, nil)
+	if res != nil {
+		return nil, res.With("OwnerPassword")
+	}
+	if p.Password != "" && ret.Password == "" {
+		return nil, util.MsgError("Password", "password expression evaluated to empty string")
+	}
+	return &ret, nil
+}
+
+// evaluateText evaluates text by engine if it starts with `=` or has `$(=...)` templates,
+// otherwise returns text as is, see engine.EvaluateTemplate.
+func evaluateText(doc *enigma.Doc, text string, opts *engine.EvalOptions) (string, *util.Result) {
+	if t := strings.TrimSpace(text); !strings.HasPrefix(t, "=") && !strings.Contains(t, "$(=") {
+		return text, nil
+	}
+	if doc == nil {
+		return "", util.MsgError("EvaluateEx", "doc is not opened")
+	}
+	ret, res := engine.EvaluateTemplateContext(engine.ConnCtx, doc, text, opts)
+	if res != nil {
+		return "", res.With("EvaluateTemplate")
+	}
+	return ret, nil
+}
+
+// resolveProtection evaluates report protection, returns nil if report is not protected.
+func resolveProtection(r Report) (*ReportProtection, *util.Result) {
+	if !r.Protection.IsEnabled() {
+		return nil, nil
+	}
+	if res := r.Protection.Validate(r.IsPdfOutput()); res != nil {
+		return nil, res
+	}
+	return r.Protection.Resolve(r.Doc)
+}
+
+type libreFilterOption struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// libreOfficePdfFilter returns options of LibreOffice `calc_pdf_Export` filter protecting a PDF
+// like the PDF printer does, a random owner password is used if it's not given.
+func (p ReportProtection) libreOfficePdfFilter() (string, *util.Result) {
+	owner := p.OwnerPassword
+	if owner == "" {
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			return "", util.Error("RandomOwnerPassword", err)
+		}
+		owner = hex.EncodeToString(buf)
+	}
+	hasPerm := func(perm string) bool {
+		return slices.ContainsFunc(p.Permissions, func(s string) bool { return strings.EqualFold(s, perm) })
+	}
+	printing, changes := "0", "0" // Printing: 2 is high resolution, Changes: 3 is comments and forms, 4 is any but page extraction
+	if hasPerm(PROTECT_PERM_PRINT) {
+		printing = "2"
+	}
+	switch {
+	case hasPerm(PROTECT_PERM_MODIFY):
+		changes = "4"
+	case hasPerm(PROTECT_PERM_ANNOT_FORMS):
+		changes = "3"
+	}
+	opts := map[string]libreFilterOption{
+		"RestrictPermissions":    {"boolean", "true"},
+		"PermissionPassword":     {"string", owner},
+		"Printing":               {"long", printing},
+		"Changes":                {"long", changes},
+		"EnableCopyingOfContent": {"boolean", strconv.FormatBool(hasPerm(PROTECT_PERM_COPY))},
+	}
+	if p.Password != "" {
+		opts["EncryptFile"] = libreFilterOption{"boolean", "true"}
+		opts["DocumentOpenPassword"] = libreFilterOption{"string", p.Password}
+	}
+	buf, err := json.Marshal(opts)
+	if err != nil {
+		return "", util.Error("EncodeFilterOptions", err)
+	}
+	return string(buf), nil
+}
+
+// saveWorkbook saves excel file with open password if protection is given.
+func saveWorkbook(f *excelize.File, fn string, prot *ReportProtection) error {
+	if prot == nil || prot.Password == "" {
+		return f.SaveAs(fn)
+	}
+	return f.SaveAs(fn, excelize.Options{Password: prot.Password})
+}
+
+// EncryptFile wraps file in an age envelope as `file.age` and removes the plain file,
+// workFactor is the scrypt work factor, DEFAULT_ENVELOPE_WORK_FACTOR if 0.
+// On failure neither the plain file nor a partial envelope is left.
+func EncryptFile(file, password string, workFactor int) (encFile string, res *util.Result) {
+	defer func() {
+		if res != nil {
+			os.Remove(file)
+		}
+	}()
+	if password == "" {
+		return "", util.MsgError("EncryptFile", "empty password")
+	}
+	recipient, err := age.NewScryptRecipient(password)
+	if err != nil {
+		return "", util.Error("NewScryptRecipient", err)
+	}
+	recipient.SetWorkFactor(cmp.Or(workFactor, DEFAULT_ENVELOPE_WORK_FACTOR))
+
+	plain, err := os.Open(file)
+	if err != nil {
+		return "", util.Error("OpenPlainFile", err)
+	}
+	defer plain.Close()
+
+	encFile = fmt.Sprintf("%s.%s", file, ENVELOPE_FILE_EXT)
+	enc, err := os.OpenFile(encFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", util.Error("OpenEnvelopeFile", err)
+	}
+	defer func() {
+		enc.Close()
+		if res != nil {
+			os.Remove(encFile)
+		}
+	}()
+
+	w, err := age.Encrypt(enc, recipient)
+	if err != nil {
+		return "", util.Error("age.Encrypt", err)
+	}
+	if _, err = io.Copy(w, plain); err != nil {
+		return "", util.Error("Copy", err)
+	}
+	if err = w.Close(); err != nil {
+		return "", util.Error("CloseEnvelope", err)
+	}
+	if err = enc.Close(); err != nil {
+		return "", util.Error("CloseEnvelopeFile", err)
+	}
+
+	plain.Close()
+	if err = os.Remove(file); err != nil {
+		return "", util.Error("RemovePlainFile", err)
+	}
+	return encFile, nil
+}
+
+// DecryptFile reads content of an age envelope created by EncryptFile.
+func DecryptFile(file, password string) ([]byte, *util.Result) {
+	identity, err := age.NewScryptIdentity(password)
+	if err != nil {
+		return nil, util.Error("NewScryptIdentity", err)
+	}
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		return nil, util.Error("ReadFile", err)
+	}
+	r, err := age.Decrypt(bytes.NewReader(buf), identity)
+	if err != nil {
+		return nil, util.Error("age.Decrypt", err)
+	}
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		return nil, util.Error("ReadAll", err)
+	}
+	return plain, nil
+}
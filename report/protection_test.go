@@ -0,0 +1,198 @@
+package report
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestReportProtection_PdfPermissionFlag(t *testing.T) {
+	tests := []struct {
+		name  string
+		perms []string
+		want  byte
+	}{
+		{"none", nil, 0},
+		{"print", []string{"print"}, gofpdf.CnProtectPrint},
+		{"print copy", []string{"print", "COPY"}, gofpdf.CnProtectPrint | gofpdf.CnProtectCopy},
+		{"all", []string{"print", "modify", "copy", "annot_forms"}, gofpdf.CnProtectPrint | gofpdf.CnProtectModify | gofpdf.CnProtectCopy | gofpdf.CnProtectAnnotForms},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := ReportProtection{Password: "pwd", Permissions: tt.perms}
+			if res := p.Validate(true); res != nil {
+				t.Fatalf("Validate: %s", res.Error())
+			}
+			if got := p.PdfPermissionFlag(); got != tt.want {
+				t.Errorf("PdfPermissionFlag() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	invalid := ReportProtection{Password: "pwd", Permissions: []string{"print", "share"}}
+	if res := invalid.Validate(true); res == nil {
+		t.Error("expected invalid permission error")
+	}
+}
+
+func TestReportProtection_Resolve(t *testing.T) {
+	p := ReportProtection{Password: "static", OwnerPassword: "owner"}
+	resolved, res := p.Resolve(nil)
+	if res != nil {
+		t.Fatalf("Resolve: %s", res.Error())
+	}
+	if resolved.Password != "static" || resolved.OwnerPassword != "owner" {
+		t.Errorf("unexpected resolved protection: %+v", resolved)
+	}
+
+	expr := ReportProtection{Password: "=Only(Rep)"}
+	if _, res := expr.Resolve(nil); res == nil {
+		t.Error("expected error when evaluating expression without doc")
+	}
+
+	var nilProt *ReportProtection
+	if nilProt.IsEnabled() {
+		t.Error("nil protection should not be enabled")
+	}
+}
+
+func TestSaveWorkbook_Password(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "protected.xlsx")
+	f := excelize.NewFile()
+	if err := f.SetCellStr("Sheet1", "A1", "salary"); err != nil {
+		t.Fatalf("SetCellStr: %v", err)
+	}
+	if err := saveWorkbook(f, fn, &ReportProtection{Password: "s3cret"}); err != nil {
+		t.Fatalf("saveWorkbook: %v", err)
+	}
+
+	if _, err := excelize.OpenFile(fn); err == nil {
+		t.Error("expected error opening protected workbook without password")
+	}
+
+	pf, err := excelize.OpenFile(fn, excelize.Options{Password: "s3cret"})
+	if err != nil {
+		t.Fatalf("OpenFile with password: %v", err)
+	}
+	defer pf.Close()
+	v, err := pf.GetCellValue("Sheet1", "A1")
+	if err != nil {
+		t.Fatalf("GetCellValue: %v", err)
+	}
+	if v != "salary" {
+		t.Errorf("A1 = %s, want salary", v)
+	}
+}
+
+func TestEncryptFile(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "report.csv")
+	content := []byte("name,salary\nalice,100\n")
+	if err := os.WriteFile(fn, content, 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	encFile, res := EncryptFile(fn, "s3cret", 10)
+	if res != nil {
+		t.Fatalf("EncryptFile: %s", res.Error())
+	}
+	if encFile != fn+".age" {
+		t.Errorf("encrypted file = %s, want %s.age", encFile, fn)
+	}
+	if _, err := os.Stat(fn); !os.IsNotExist(err) {
+		t.Error("plain file should be removed")
+	}
+
+	if _, res := DecryptFile(encFile, "wrong"); res == nil {
+		t.Error("expected error decrypting with wrong password")
+	}
+	plain, res := DecryptFile(encFile, "s3cret")
+	if res != nil {
+		t.Fatalf("DecryptFile: %s", res.Error())
+	}
+	if string(plain) != string(content) {
+		t.Errorf("decrypted = %q, want %q", plain, content)
+	}
+}
+
+func TestEncryptFile_Failure(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "report.csv")
+	if err := os.WriteFile(fn, []byte("name,salary\n"), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	// the envelope can't be created where a directory is
+	if err := os.Mkdir(fn+".age", 0700); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	if _, res := EncryptFile(fn, "s3cret", 10); res == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := os.Stat(fn); !os.IsNotExist(err) {
+		t.Error("plain file should be removed on failure")
+	}
+}
+
+func TestReportProtection_Validate(t *testing.T) {
+	csv, paged := REPORT_FORMAT_CSV, REPORT_FORMAT_PAGED_XLSX
+	tests := []struct {
+		name    string
+		report  Report
+		wantErr bool
+	}{
+		{"csv with password", Report{OutputFormat: &csv, Protection: &ReportProtection{Password: "pwd"}}, false},
+		{"csv with owner password only", Report{OutputFormat: &csv, Protection: &ReportProtection{OwnerPassword: "owner"}}, true},
+		{"paged excel with owner password only", Report{OutputFormat: &paged, Protection: &ReportProtection{OwnerPassword: "owner"}}, true},
+		{"paged excel to pdf with owner password only", Report{OutputFormat: &paged, PaginationConfig: &PaginationConfig{ConverToPDF: true},
+			Protection: &ReportProtection{OwnerPassword: "owner"}}, false},
+		{"invalid work factor", Report{OutputFormat: &csv, Protection: &ReportProtection{Password: "pwd", EnvelopeWorkFactor: 64}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, res := resolveProtection(tt.report); (res != nil) != tt.wantErr {
+				t.Errorf("resolveProtection() error = %v, wantErr %v", res, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReportProtection_LibreOfficePdfFilter(t *testing.T) {
+	tests := []struct {
+		name string
+		prot ReportProtection
+		want map[string]string
+	}{
+		{"user password", ReportProtection{Password: "pwd", OwnerPassword: "owner", Permissions: []string{"print", "copy"}},
+			map[string]string{"EncryptFile": "true", "DocumentOpenPassword": "pwd", "PermissionPassword": "owner", "Printing": "2", "Changes": "0", "EnableCopyingOfContent": "true"}},
+		{"owner password only", ReportProtection{OwnerPassword: "owner", Permissions: []string{"annot_forms"}},
+			map[string]string{"PermissionPassword": "owner", "Printing": "0", "Changes": "3", "EnableCopyingOfContent": "false"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, res := tt.prot.libreOfficePdfFilter()
+			if res != nil {
+				t.Fatalf("libreOfficePdfFilter: %v", res)
+			}
+			var opts map[string]libreFilterOption
+			if err := json.Unmarshal([]byte(filter), &opts); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			for k, v := range tt.want {
+				if opts[k].Value != v {
+					t.Errorf("%s = %q, want %q", k, opts[k].Value, v)
+				}
+			}
+			if _, ok := opts["DocumentOpenPassword"]; ok != (tt.prot.Password != "") {
+				t.Errorf("filter = %s", filter)
+			}
+		})
+	}
+
+	random, _ := ReportProtection{Password: "pwd"}.libreOfficePdfFilter()
+	if !strings.Contains(random, `"PermissionPassword":{"type":"string","value":"`) || strings.Contains(random, `"PermissionPassword":{"type":"string","value":""}`) {
+		t.Errorf("filter without owner password = %s", random)
+	}
+}
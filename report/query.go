@@ -0,0 +1,42 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/soderasen-au/go-common/util"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+)
+
+// openQueries creates session objects of `Queries` and retargets r to them when `Target` is `queries`,
+// close destroys the session objects.
+func (r *Report) openQueries() (close func(), res *util.Result) {
+	close = func() {}
+	if strings.ToLower(r.Target) != TARGET_QUERIES {
+		return close, nil
+	}
+	if r.Doc == nil {
+		return close, util.MsgError("CheckDoc", "doc is not opened")
+	}
+	if len(r.Queries) < 1 {
+		return close, util.MsgError("CheckTarget", "no query in Report")
+	}
+
+	ids := make([]string, 0, len(r.Queries))
+	close = func() {
+		for _, id := range ids {
+			r.Doc.DestroySessionObject(engine.ConnCtx, id)
+		}
+	}
+	for i, q := range r.Queries {
+		obj, res := q.CreateObjectContext(engine.ConnCtx, r.Doc)
+		if res != nil {
+			close()
+			return func() {}, res.With(fmt.Sprintf("query[%d]", i))
+		}
+		ids = append(ids, obj.GenericId)
+	}
+	r.Target, r.TargetIDs = TARGET_OBJECTS, ids
+	return close, nil
+}
@@ -1,6 +1,7 @@
 package report
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 	"strings"
@@ -10,6 +11,8 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/soderasen-au/go-common/loggers"
 	"github.com/soderasen-au/go-common/util"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
 )
 
 type ReportFormat string
@@ -23,6 +26,7 @@ const (
 
 	TARGET_OBJECTS string = "objects"
 	TARGET_SHEET   string = "sheet"
+	TARGET_QUERIES string = "queries"
 
 	DRIVER_SENSE    string = "sense"
 	DRIVER_BUILT_IN string = "built_in"
@@ -84,14 +88,18 @@ type IReportPrinter interface {
 	GetReportResult(id string) (*ReportResult, *util.Result)
 }
 
+// CustomHeader prints Label and Text, which is evaluated if it starts with `=` or has `$(=...)` templates.
 type CustomHeader struct {
-	Label string `json:"label,omitempty"`
-	Text  string `json:"text,omitempty"`
+	Label string              `json:"label,omitempty"`
+	Text  string              `json:"text,omitempty"`
+	Eval  *engine.EvalOptions `json:"eval,omitempty"`
 }
 
+// Legend prints Label and Text, which is evaluated like CustomHeader.
 type Legend struct {
-	Label string `json:"label,omitempty"`
-	Text  string `json:"text,omitempty"`
+	Label string              `json:"label,omitempty"`
+	Text  string              `json:"text,omitempty"`
+	Eval  *engine.EvalOptions `json:"eval,omitempty"`
 }
 
 type ColumnHeaderFormat struct {
@@ -146,15 +154,17 @@ type Report struct {
 	IsSub bool    `json:"is_sub,omitempty" yaml:"is_sub,omitempty" bson:"is_sub,omitempty"`
 
 	// report target
-	// `Target` can be `objects` or `sheet`
+	// `Target` can be `objects`, `sheet` or `queries`
 	// `TargetIDs` contains either:
 	//  - array of object ids, when `Target` is `objects`
 	//  - or TargetIDs[0] = sheetID, when `Target` is `sheet`
-	Doc            *enigma.Doc    `json:"-,omitempty" yaml:"-,omitempty" bson:"-,omitempty"` // not for end user;
-	SelectedStates map[string]int `json:"-,omitempty" yaml:"-,omitempty" bson:"-,omitempty"` // not for end user; used to track the order of selection for each state, which is needed when printing current selection in report
-	AppId          string         `json:"app_id,omitempty" yaml:"app_id,omitempty" bson:"app_id,omitempty"`
-	Target         string         `json:"target,omitempty" yaml:"target,omitempty" bson:"target,omitempty"`
-	TargetIDs      []string       `json:"target_ids,omitempty" yaml:"target_ids,omitempty" bson:"target_ids,omitempty"`
+	// `Queries` are printed as objects when `Target` is `queries`
+	Doc            *enigma.Doc     `json:"-" yaml:"-" bson:"-"` // not for end user;
+	SelectedStates map[string]int  `json:"-" yaml:"-" bson:"-"` // not for end user; used to track the order of selection for each state, which is needed when printing current selection in report
+	AppId          string          `json:"app_id,omitempty" yaml:"app_id,omitempty" bson:"app_id,omitempty"`
+	Target         string          `json:"target,omitempty" yaml:"target,omitempty" bson:"target,omitempty"`
+	TargetIDs      []string        `json:"target_ids,omitempty" yaml:"target_ids,omitempty" bson:"target_ids,omitempty"`
+	Queries        []*engine.Query `json:"queries,omitempty" yaml:"queries,omitempty" bson:"queries,omitempty"`
 
 	// layout
 	Headers                []CustomHeader                `json:"headers,omitempty" yaml:"headers,omitempty" bson:"headers,omitempty"`
@@ -173,6 +183,13 @@ type Report struct {
 	RowHeight              *float64                      `json:"row_height,omitempty" yaml:"row_height,omitempty" bson:"row_height,omitempty"`
 	TableWrapText          bool                          `json:"table_wrap_text,omitempty" yaml:"table_wrap_text,omitempty" bson:"table_wrap_text,omitempty"`
 
+	// images of objects, exported by `ImageExporter` in current selections, only for excel and PDF
+	Images        []ReportImage              `json:"images,omitempty" yaml:"images,omitempty" bson:"images,omitempty"`
+	ImageExporter engine.ObjectImageExporter `json:"-" yaml:"-" bson:"-"` // not for end user;
+
+	// Ctx cancels waits between delivery retries, nil means never cancelled
+	Ctx context.Context `json:"-" yaml:"-" bson:"-"` // not for end user;
+
 	// output
 	Driver               *string           `json:"driver,omitempty" yaml:"driver,omitempty" bson:"driver,omitempty"`
 	OutputFormat         *ReportFormat     `json:"output_format,omitempty" yaml:"output_format,omitempty" bson:"output_format,omitempty"`
@@ -180,6 +197,8 @@ type Report struct {
 	OutputOffset         *enigma.Rect      `json:"output_offset,omitempty" yaml:"output_offset,omitempty" bson:"output_offset,omitempty"`
 	OutputPDFOrientation *string           `json:"output_pdf_orientation,omitempty" yaml:"output_pdf_orientation,omitempty" bson:"output_pdf_orientation,omitempty"`
 	PaginationConfig     *PaginationConfig `json:"pagination_config,omitempty" yaml:"pagination_config,omitempty" bson:"pagination_config,omitempty"`
+	Protection           *ReportProtection `json:"protection,omitempty" yaml:"protection,omitempty" bson:"protection,omitempty"`
+	Delivery             *Delivery         `json:"delivery,omitempty" yaml:"delivery,omitempty" bson:"delivery,omitempty"`
 
 	// logging
 	LogFolder *string         `json:"log_folder,omitempty" yaml:"log_folder,omitempty" bson:"log_folder,omitempty"`
@@ -211,9 +230,21 @@ func (r Report) IsValid() bool {
 		return false
 	}
 
+	if r.Target == TARGET_QUERIES && len(r.Queries) < 1 {
+		return false
+	}
+
 	return true
 }
 
+// IsPdfOutput tells if the report file is a PDF, including paged excel converted to PDF.
+func (r Report) IsPdfOutput() bool {
+	if r.OutputFormat == nil {
+		return false
+	}
+	return r.OutputFormat.IsPdf() || (r.OutputFormat.IsPagedExcel() && r.PaginationConfig != nil && r.PaginationConfig.ConverToPDF)
+}
+
 func (r *Report) Validate() *util.Result {
 	if r.Doc == nil {
 		return util.MsgError("ValidateReport", "invalid engine connection")
@@ -237,8 +268,12 @@ func (r *Report) Validate() *util.Result {
 		if len(r.TargetIDs) < 1 {
 			return util.MsgError("ValidateReport", "no object in Report")
 		}
+	case TARGET_QUERIES:
+		if len(r.Queries) < 1 {
+			return util.MsgError("ValidateReport", "no query in Report")
+		}
 	default:
-		return util.MsgError("ValidateReport", "invalid target, support only `sheet` and `objects`")
+		return util.MsgError("ValidateReport", "invalid target, support only `sheet`, `objects` and `queries`")
 	}
 
 	if r.OutputFormat == nil {
@@ -269,16 +304,33 @@ func (r *Report) Validate() *util.Result {
 		}
 	}
 
+	if r.Protection != nil {
+		if res := r.Protection.Validate(r.IsPdfOutput()); res != nil {
+			return res.With("ValidateReport")
+		}
+	}
+
+	if len(r.Images) > 0 && !r.OutputFormat.IsExcel() && !r.OutputFormat.IsPdf() {
+		return util.MsgError("ValidateReport", fmt.Sprintf("images aren't supported by %s reports", *r.OutputFormat))
+	}
+
+	if r.Delivery != nil {
+		if res := r.Delivery.Validate(); res != nil {
+			return res.With("ValidateReport")
+		}
+	}
+
 	return nil
 }
 
 type ReportResult struct {
-	ID          string          `json:"id,omitempty" yaml:"id,omitempty"`
-	Result      *util.Result    `json:"result,omitempty" yaml:"result,omitempty" bson:"result,omitempty"`
-	ReportFile  *string         `json:"report_file,omitempty" yaml:"report_file,omitempty" bson:"report_file,omitempty"`
-	LogFile     *string         `json:"log_file,omitempty" yaml:"log_file,omitempty" bson:"log_file,omitempty"`
-	Logger      *zerolog.Logger `json:"-,omitempty" yaml:"-,omitempty" bson:"-"`
-	PrintedRows int             `json:"printed_rows,omitempty" yaml:"printed_rows,omitempty"`
+	ID          string            `json:"id,omitempty" yaml:"id,omitempty"`
+	Result      *util.Result      `json:"result,omitempty" yaml:"result,omitempty" bson:"result,omitempty"`
+	ReportFile  *string           `json:"report_file,omitempty" yaml:"report_file,omitempty" bson:"report_file,omitempty"`
+	LogFile     *string           `json:"log_file,omitempty" yaml:"log_file,omitempty" bson:"log_file,omitempty"`
+	Logger      *zerolog.Logger   `json:"-" yaml:"-" bson:"-"`
+	PrintedRows int               `json:"printed_rows,omitempty" yaml:"printed_rows,omitempty"`
+	Deliveries  []*DeliveryResult `json:"deliveries,omitempty" yaml:"deliveries,omitempty" bson:"deliveries,omitempty"`
 }
 
 func NewReportResult(r Report) (*ReportResult, *util.Result) {
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/soderasen-au/go-common/util"
+)
+
+const QLIK_USER_HEADER = "X-Qlik-User"
+
+// Handler serves:
+//
+//	POST /reports            submit a JobRequest, returns 202 with the queued Job
+//	GET  /reports            list jobs of the caller
+//	GET  /reports/{id}       job status
+//	GET  /reports/{id}/file  download the report file of a succeeded job
+//
+// The caller identity is read from `X-Qlik-User` header (`UserDirectory=<dir>; UserId=<id>`),
+// authentication is expected to be done by a proxy or middleware in front of it.
+// Requests without a UserId are rejected with 401.
+// Callers only see their own jobs, jobs of other users are not found.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /reports", s.handleSubmit)
+	mux.HandleFunc("GET /reports", s.handleList)
+	mux.HandleFunc("GET /reports/{id}", s.handleGet)
+	mux.HandleFunc("GET /reports/{id}/file", s.handleFile)
+	return requireQlikUser(mux)
+}
+
+// requireQlikUser rejects requests without a UserId in `X-Qlik-User` header,
+// otherwise anonymous callers would share their jobs.
+func requireQlikUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, userId := parseQlikUser(r.Header.Get(QLIK_USER_HEADER)); userId == "" {
+			writeError(w, http.StatusUnauthorized, util.MsgError("QlikUser", "missing UserId in "+QLIK_USER_HEADER+" header"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	var req JobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, util.Error("DecodeRequest", err))
+		return
+	}
+	if res := s.validate(req); res != nil {
+		writeError(w, http.StatusBadRequest, res)
+		return
+	}
+
+	userDir, userId := parseQlikUser(r.Header.Get(QLIK_USER_HEADER))
+	ipAddr, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ipAddr = r.RemoteAddr
+	}
+	job, res := s.Submit(req, userDir, userId, ipAddr)
+	if res != nil {
+		writeError(w, http.StatusServiceUnavailable, res)
+		return
+	}
+	w.Header().Set("Location", "/reports/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	userDir, userId := parseQlikUser(r.Header.Get(QLIK_USER_HEADER))
+	writeJSON(w, http.StatusOK, s.UserJobs(userDir, userId))
+}
+
+// callerJob returns the job of path value `id` if the caller submitted it.
+func (s *Server) callerJob(r *http.Request) (*Job, bool) {
+	job, ok := s.GetJob(r.PathValue("id"))
+	if !ok {
+		return nil, false
+	}
+	userDir, userId := parseQlikUser(r.Header.Get(QLIK_USER_HEADER))
+	if !job.ownedBy(userDir, userId) {
+		return nil, false
+	}
+	return job, true
+}
+
+func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.callerJob(r)
+	if !ok {
+		writeError(w, http.StatusNotFound, util.MsgError("GetJob", "job not found"))
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (s *Server) handleFile(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.callerJob(r)
+	if !ok {
+		writeError(w, http.StatusNotFound, util.MsgError("GetFile", "job not found"))
+		return
+	}
+	if !job.Status.IsDone() {
+		writeError(w, http.StatusConflict, util.MsgError("GetFile", "job is "+string(job.Status)))
+		return
+	}
+	if job.file == "" {
+		writeError(w, http.StatusConflict, util.MsgError("GetFile", "job has no report file: "+job.Error))
+		return
+	}
+
+	f, err := os.Open(job.file)
+	if err != nil {
+		writeError(w, http.StatusGone, util.Error("OpenFile", err))
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, util.Error("StatFile", err))
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", job.FileName))
+	http.ServeContent(w, r, job.FileName, fi.ModTime(), f)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, res *util.Result) {
+	writeJSON(w, code, map[string]string{"error": res.Error()})
+}
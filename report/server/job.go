@@ -0,0 +1,187 @@
+package server
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/soderasen-au/go-common/util"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+	"github.com/soderasen-au/go-qlik/report"
+)
+
+type JobStatus string
+
+const (
+	JOB_STATUS_QUEUED    JobStatus = "queued"
+	JOB_STATUS_RUNNING   JobStatus = "running"
+	JOB_STATUS_SUCCEEDED JobStatus = "succeeded"
+	JOB_STATUS_FAILED    JobStatus = "failed"
+)
+
+func (s JobStatus) IsDone() bool {
+	return s == JOB_STATUS_SUCCEEDED || s == JOB_STATUS_FAILED
+}
+
+type Selection struct {
+	Field     string   `json:"field" yaml:"field"`
+	Values    []string `json:"values" yaml:"values"`
+	StateName string   `json:"state_name,omitempty" yaml:"state_name,omitempty"`
+}
+
+// JobRequest is a Report with the selection state to print it in.
+// Bookmark is applied first, then selections in order.
+// `id`, `output_folder` and `log_folder` of the report are decided by server, and so is `delivery`:
+// requests choose one of Config.Deliveries by `delivery_name`.
+// Report files are named by job id, `name` only names the downloaded file.
+type JobRequest struct {
+	report.Report
+	BookmarkId    string      `json:"bookmark_id,omitempty" yaml:"bookmark_id,omitempty"`
+	BookmarkTitle string      `json:"bookmark_title,omitempty" yaml:"bookmark_title,omitempty"`
+	Selections    []Selection `json:"selections,omitempty" yaml:"selections,omitempty"`
+	DeliveryName  string      `json:"delivery_name,omitempty" yaml:"delivery_name,omitempty"`
+}
+
+func (req JobRequest) Validate() *util.Result {
+	if req.AppId == "" {
+		return util.MsgError("ValidateRequest", "no app id")
+	}
+	switch strings.ToLower(req.Target) {
+	case report.TARGET_SHEET:
+		if len(req.TargetIDs) != 1 {
+			return util.MsgError("ValidateRequest", "supports only 1 sheet per report")
+		}
+	case report.TARGET_OBJECTS:
+		if len(req.TargetIDs) < 1 {
+			return util.MsgError("ValidateRequest", "no object in report")
+		}
+	case report.TARGET_QUERIES:
+		if len(req.Queries) < 1 {
+			return util.MsgError("ValidateRequest", "no query in report")
+		}
+		for i, q := range req.Queries {
+			if q == nil || len(q.Dimensions)+len(q.Measures) < 1 {
+				return util.MsgError("ValidateRequest", fmt.Sprintf("query %d has no column", i))
+			}
+		}
+	default:
+		return util.MsgError("ValidateRequest", "invalid target, support only `sheet`, `objects` and `queries`")
+	}
+	if req.OutputFormat != nil && !req.OutputFormat.IsValid() {
+		return util.MsgError("ValidateRequest", fmt.Sprintf("invalid output format '%s'", *req.OutputFormat))
+	}
+	if req.Driver != nil && *req.Driver != "" && *req.Driver != report.DRIVER_BUILT_IN {
+		return util.MsgError("ValidateRequest", "only built_in driver is supported")
+	}
+	for i, sel := range req.Selections {
+		if sel.Field == "" {
+			return util.MsgError("ValidateRequest", fmt.Sprintf("selection %d has no field", i))
+		}
+	}
+	if req.Protection != nil {
+		if res := req.Protection.Validate(req.IsPdfOutput()); res != nil {
+			return res.With("ValidateRequest")
+		}
+	}
+	if req.Delivery != nil {
+		// paths, key files and mail servers are read and written by the server, so clients can't set them
+		return util.MsgError("ValidateRequest", "delivery can't be set by request, use `delivery_name`")
+	}
+	return nil
+}
+
+// Job is the state of one report request, it's what the API returns.
+type Job struct {
+	ID          string                   `json:"id"`
+	Status      JobStatus                `json:"status"`
+	AppId       string                   `json:"app_id"`
+	Format      string                   `json:"format"`
+	UserDir     string                   `json:"user_dir,omitempty"`
+	UserId      string                   `json:"user_id,omitempty"`
+	CreatedAt   time.Time                `json:"created_at"`
+	StartedAt   *time.Time               `json:"started_at,omitempty"`
+	FinishedAt  *time.Time               `json:"finished_at,omitempty"`
+	FileName    string                   `json:"file_name,omitempty"`
+	PrintedRows int                      `json:"printed_rows,omitempty"`
+	Deliveries  []*report.DeliveryResult `json:"deliveries,omitempty"`
+	Error       string                   `json:"error,omitempty"`
+
+	request JobRequest
+	file    string
+	ipAddr  string
+}
+
+// ownedBy tells if the job was submitted by the user, user directories are case-insensitive as in Qlik Sense.
+func (j *Job) ownedBy(userDir, userId string) bool {
+	return strings.EqualFold(j.UserDir, userDir) && j.UserId == userId
+}
+
+// downloadName is the requested report name with the file extension, or the name of the report file.
+func (j *Job) downloadName() string {
+	name := util.MaybeNil(j.request.Name)
+	if name == "" {
+		return filepath.Base(j.file)
+	}
+	name = strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+	return name + filepath.Ext(j.file)
+}
+
+// applySelectionState applies bookmark and selections of req on doc,
+// returns number of selections per state for printing current selections.
+func applySelectionState(doc *enigma.Doc, req JobRequest) (map[string]int, *util.Result) {
+	selectedStates := map[string]int{"$": 0}
+
+	bmId, res := engine.ApplyBookmark(doc, req.BookmarkId, req.BookmarkTitle)
+	if res != nil {
+		return nil, res.With("ApplyBookmark")
+	}
+	if bmId != "" {
+		selectedStates["$"]++
+	}
+
+	for _, sel := range req.Selections {
+		stateName := sel.StateName
+		if stateName == "" {
+			stateName = "$"
+		}
+		field, err := doc.GetField(engine.ConnCtx, sel.Field, stateName)
+		if err != nil {
+			return nil, util.Error("GetField "+sel.Field, err)
+		}
+		values := make([]*enigma.FieldValue, 0, len(sel.Values))
+		for _, v := range sel.Values {
+			values = append(values, &enigma.FieldValue{Text: v})
+		}
+		ok, err := field.SelectValues(engine.ConnCtx, values, false, false)
+		if err != nil {
+			return nil, util.Error("SelectValues "+sel.Field, err)
+		}
+		if !ok {
+			return nil, util.MsgError("SelectValues "+sel.Field, "engine returned `Fail`")
+		}
+		selectedStates[stateName]++
+	}
+
+	return selectedStates, nil
+}
+
+// parseQlikUser parses `UserDirectory=<dir>; UserId=<id>` as in `X-Qlik-User` header
+func parseQlikUser(header string) (string, string) {
+	var dir, id string
+	for _, part := range strings.Split(header, ";") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(k)) {
+		case "userdirectory":
+			dir = strings.TrimSpace(v)
+		case "userid":
+			id = strings.TrimSpace(v)
+		}
+	}
+	return dir, id
+}
@@ -0,0 +1,361 @@
+package server
+
+import (
+	"context"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/rs/zerolog"
+	"github.com/soderasen-au/go-common/loggers"
+	"github.com/soderasen-au/go-common/util"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine"
+	"github.com/soderasen-au/go-qlik/report"
+)
+
+const (
+	DEFAULT_MAX_CONCURRENT     int = 2
+	DEFAULT_QUEUE_SIZE         int = 100
+	DEFAULT_JOB_RETENTION_MINS int = 24 * 60
+)
+
+type Config struct {
+	Engine           engine.MixedConfig     `json:"engine" yaml:"engine" bson:"engine"` // `app_id` is replaced by app of each request
+	OutputFolder     string                 `json:"output_folder" yaml:"output_folder" bson:"output_folder"`
+	LogFolder        string                 `json:"log_folder,omitempty" yaml:"log_folder,omitempty" bson:"log_folder,omitempty"` // default OutputFolder
+	MaxConcurrent    int                    `json:"max_concurrent,omitempty" yaml:"max_concurrent,omitempty" bson:"max_concurrent,omitempty"`
+	QueueSize        int                    `json:"queue_size,omitempty" yaml:"queue_size,omitempty" bson:"queue_size,omitempty"`
+	JobRetentionMins int                    `json:"job_retention_mins,omitempty" yaml:"job_retention_mins,omitempty" bson:"job_retention_mins,omitempty"` // finished jobs are forgotten after it, files are kept
+	AuditLog         *report.AuditLogConfig `json:"audit_log,omitempty" yaml:"audit_log,omitempty" bson:"audit_log,omitempty"`
+
+	// Deliveries are the only delivery targets of jobs, a request chooses one by `delivery_name`.
+	Deliveries map[string]*report.Delivery `json:"deliveries,omitempty" yaml:"deliveries,omitempty" bson:"deliveries,omitempty"`
+}
+
+// Connector opens app in a new engine session, the returned func closes the session.
+type Connector func(appId string) (*enigma.Doc, func(), *util.Result)
+
+// MixedConfigConnector connects to engine by mc with app id of each job.
+func MixedConfigConnector(mc engine.MixedConfig) Connector {
+	return func(appId string) (*enigma.Doc, func(), *util.Result) {
+		cfg := mc
+		cfg.AppId = appId
+		conn, res := cfg.Connect()
+		if res != nil {
+			return nil, nil, res.With("Connect")
+		}
+		doc, err := conn.Global.OpenDoc(engine.ConnCtx, appId, "", "", "", false)
+		if err != nil {
+			conn.Global.DisconnectFromServer()
+			return nil, nil, util.Error("OpenDoc", err)
+		}
+		return doc, conn.Global.DisconnectFromServer, nil
+	}
+}
+
+// Server runs report jobs in a queue with at most `MaxConcurrent` jobs printing at the same time,
+// every job opens its own engine session so that selections don't interfere.
+type Server struct {
+	Config     Config
+	Connect    Connector
+	NewPrinter func() report.IReportPrinter
+	Logger     *zerolog.Logger
+
+	audit   *report.AuditLog
+	jobs    map[string]*Job
+	mu      sync.RWMutex
+	queue   chan *Job
+	wg      sync.WaitGroup
+	started bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+func New(cfg Config) (*Server, *util.Result) {
+	if cfg.OutputFolder == "" {
+		return nil, util.MsgError("NewServer", "no output folder")
+	}
+	if err := os.MkdirAll(cfg.OutputFolder, os.ModePerm); err != nil {
+		return nil, util.Error("MkdirOutputFolder", err)
+	}
+	if cfg.LogFolder == "" {
+		cfg.LogFolder = cfg.OutputFolder
+	}
+	if cfg.MaxConcurrent <= 0 {
+		cfg.MaxConcurrent = DEFAULT_MAX_CONCURRENT
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DEFAULT_QUEUE_SIZE
+	}
+	if cfg.JobRetentionMins <= 0 {
+		cfg.JobRetentionMins = DEFAULT_JOB_RETENTION_MINS
+	}
+	for name, d := range cfg.Deliveries {
+		if d == nil {
+			return nil, util.MsgError("NewServer", "no delivery "+name)
+		}
+		if res := d.Validate(); res != nil {
+			return nil, res.With("ValidateDelivery " + name)
+		}
+	}
+
+	s := &Server{
+		Config:  cfg,
+		Connect: MixedConfigConnector(cfg.Engine),
+		NewPrinter: func() report.IReportPrinter {
+			return report.NewBuiltInReportPrinter()
+		},
+		Logger: loggers.CoreDebugLogger,
+		jobs:   make(map[string]*Job),
+		queue:  make(chan *Job, cfg.QueueSize),
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+
+	if cfg.AuditLog != nil {
+		audit, res := report.NewAuditLogWithConfig(*cfg.AuditLog)
+		if res != nil {
+			return nil, res.With("NewAuditLog")
+		}
+		s.audit = audit
+	}
+
+	return s, nil
+}
+
+// Start starts workers, `Connect`, `NewPrinter` and `Logger` must not be changed after it.
+// It does nothing once the server is closed.
+func (s *Server) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// a closed server can't be restarted
+	if s.started || s.queue == nil {
+		return
+	}
+	s.started = true
+	q := s.queue
+	for i := 0; i < s.Config.MaxConcurrent; i++ {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			for job := range q {
+				s.run(job)
+			}
+		}()
+	}
+}
+
+// Close stops accepting jobs, cancels waits between delivery retries,
+// waits for queued jobs to finish and closes audit log.
+func (s *Server) Close() {
+	s.mu.Lock()
+	if s.queue != nil {
+		close(s.queue)
+		s.queue = nil
+	}
+	s.mu.Unlock()
+	s.cancel()
+	s.wg.Wait()
+	if s.audit != nil {
+		s.audit.Close()
+	}
+}
+
+func (s *Server) AuditLog() *report.AuditLog {
+	return s.audit
+}
+
+// Submit queues req, it fails if req is invalid or queue is full.
+func (s *Server) Submit(req JobRequest, userDir, userId, ipAddr string) (*Job, *util.Result) {
+	if res := s.validate(req); res != nil {
+		return nil, res
+	}
+
+	job := &Job{
+		ID:        uuid.NewString(),
+		Status:    JOB_STATUS_QUEUED,
+		AppId:     req.AppId,
+		Format:    string(report.REPORT_FORMAT_XLSX),
+		UserDir:   userDir,
+		UserId:    userId,
+		CreatedAt: time.Now(),
+		request:   req,
+		ipAddr:    ipAddr,
+	}
+	if req.OutputFormat != nil {
+		job.Format = string(*req.OutputFormat)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.queue == nil {
+		return nil, util.MsgError("Submit", "server is closed")
+	}
+	s.purgeJobs()
+	select {
+	case s.queue <- job:
+	default:
+		return nil, util.MsgError("Submit", "job queue is full")
+	}
+	s.jobs[job.ID] = job
+	ret := *job
+	return &ret, nil
+}
+
+// validate checks req and that the delivery it chooses is configured.
+func (s *Server) validate(req JobRequest) *util.Result {
+	if res := req.Validate(); res != nil {
+		return res
+	}
+	if _, ok := s.Config.Deliveries[req.DeliveryName]; req.DeliveryName != "" && !ok {
+		return util.MsgError("ValidateRequest", "unknown delivery "+req.DeliveryName)
+	}
+	return nil
+}
+
+// purgeJobs forgets finished jobs older than retention, caller must hold the lock.
+func (s *Server) purgeJobs() {
+	expiry := time.Now().Add(-time.Duration(s.Config.JobRetentionMins) * time.Minute)
+	for id, job := range s.jobs {
+		if job.Status.IsDone() && job.FinishedAt != nil && job.FinishedAt.Before(expiry) {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+// GetJob returns a copy of job.
+func (s *Server) GetJob(id string) (*Job, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, false
+	}
+	ret := *job
+	return &ret, true
+}
+
+// Jobs returns copies of all jobs, oldest first.
+func (s *Server) Jobs() []*Job {
+	return s.jobsWhere(func(*Job) bool { return true })
+}
+
+// UserJobs returns copies of jobs submitted by the user, oldest first.
+func (s *Server) UserJobs(userDir, userId string) []*Job {
+	return s.jobsWhere(func(job *Job) bool { return job.ownedBy(userDir, userId) })
+}
+
+func (s *Server) jobsWhere(filter func(job *Job) bool) []*Job {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		if !filter(job) {
+			continue
+		}
+		ret := *job
+		jobs = append(jobs, &ret)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+	return jobs
+}
+
+func (s *Server) updateJob(id string, update func(job *Job)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job, ok := s.jobs[id]; ok {
+		update(job)
+	}
+}
+
+func (s *Server) run(job *Job) {
+	started := time.Now()
+	s.updateJob(job.ID, func(j *Job) {
+		j.Status = JOB_STATUS_RUNNING
+		j.StartedAt = &started
+	})
+	s.Logger.Info().Msgf("job %s: printing app %s", job.ID, job.AppId)
+
+	rr, res := s.print(job, started)
+
+	finished := time.Now()
+	s.updateJob(job.ID, func(j *Job) {
+		j.FinishedAt = &finished
+		if rr != nil {
+			j.PrintedRows = rr.PrintedRows
+			j.Deliveries = rr.Deliveries
+			if rr.ReportFile != nil && res == nil {
+				j.file = *rr.ReportFile
+				j.FileName = j.downloadName()
+			}
+		}
+		if res != nil {
+			j.Status = JOB_STATUS_FAILED
+			j.Error = res.Error()
+		} else {
+			j.Status = JOB_STATUS_SUCCEEDED
+		}
+	})
+	if res != nil {
+		s.Logger.Error().Msgf("job %s failed: %s", job.ID, res.Error())
+	} else {
+		s.Logger.Info().Msgf("job %s finished in %v", job.ID, finished.Sub(started))
+	}
+}
+
+func (s *Server) print(job *Job, started time.Time) (*report.ReportResult, *util.Result) {
+	r := job.request.Report
+	r.ID = util.Ptr(job.ID)
+	// files are named by job id so that jobs of the same name don't overwrite each other,
+	// the requested name is only used to download the file
+	r.Name = nil
+	r.OutputFolder = util.Ptr(s.Config.OutputFolder)
+	r.LogFolder = util.Ptr(s.Config.LogFolder)
+	r.Ctx = s.ctx
+	if job.request.DeliveryName != "" {
+		r.Delivery = s.Config.Deliveries[job.request.DeliveryName]
+	}
+	if r.OutputFormat == nil {
+		r.OutputFormat = util.Ptr(report.REPORT_FORMAT_XLSX)
+	}
+
+	doc, closeSession, res := s.Connect(job.AppId)
+	if res != nil {
+		s.recordAudit(job, r, nil, started, res)
+		return nil, res.With("Connect")
+	}
+	defer closeSession()
+	r.Doc = doc
+
+	r.SelectedStates, res = applySelectionState(doc, job.request)
+	if res != nil {
+		s.recordAudit(job, r, nil, started, res)
+		return nil, res.With("ApplySelectionState")
+	}
+	if res = r.Validate(); res != nil {
+		s.recordAudit(job, r, nil, started, res)
+		return nil, res
+	}
+
+	printer := s.NewPrinter()
+	res = printer.Print(r)
+	rr, _ := printer.GetReportResult(job.ID)
+	s.recordAudit(job, r, rr, started, res)
+	return rr, res
+}
+
+func (s *Server) recordAudit(job *Job, r report.Report, rr *report.ReportResult, started time.Time, printRes *util.Result) {
+	if s.audit == nil {
+		return
+	}
+	rec := report.NewPrintAuditRecord(r, rr, started, printRes)
+	rec.UserDir = job.UserDir
+	rec.UserId = job.UserId
+	rec.IpAddr = job.ipAddr
+	if res := s.audit.Record(rec); res != nil {
+		s.Logger.Error().Msgf("job %s: audit failed: %s", job.ID, res.Error())
+	}
+}
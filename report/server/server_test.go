@@ -0,0 +1,301 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qlik-oss/enigma-go/v4"
+	"github.com/soderasen-au/go-common/loggers"
+	"github.com/soderasen-au/go-common/util"
+
+	"github.com/soderasen-au/go-qlik/qlik/engine/enginetest"
+	"github.com/soderasen-au/go-qlik/report"
+)
+
+// newTestServer prints apps of the sales fixture of a fake engine, connecting waits for release if it isn't nil.
+func newTestServer(t *testing.T, cfg Config, release chan struct{}) *Server {
+	t.Helper()
+	srv := enginetest.NewServer(enginetest.SalesFixture())
+	t.Cleanup(srv.Close)
+	cfg.Engine = srv.Config("sales")
+	cfg.OutputFolder = t.TempDir()
+	s, res := New(cfg)
+	if res != nil {
+		t.Fatalf("New: %s", res.Error())
+	}
+	s.Logger = loggers.NullLogger
+	connect := s.Connect
+	s.Connect = func(appId string) (*enigma.Doc, func(), *util.Result) {
+		if release != nil {
+			<-release
+		}
+		return connect(appId)
+	}
+	return s
+}
+
+func postReport(t *testing.T, url string, body string) (*http.Response, Job) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url+"/reports", bytes.NewBufferString(body))
+	req.Header.Set(QLIK_USER_HEADER, testUser)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	defer resp.Body.Close()
+	var job Job
+	json.NewDecoder(resp.Body).Decode(&job)
+	return resp, job
+}
+
+func getAs(t *testing.T, url, user string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set(QLIK_USER_HEADER, user)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	return resp
+}
+
+const testUser = "UserDirectory=CORP; UserId=alice"
+
+func waitJob(t *testing.T, s *Server, id string) *Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, ok := s.GetJob(id)
+		if !ok {
+			t.Fatalf("job %s not found", id)
+		}
+		if job.Status.IsDone() {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s not done in time", id)
+	return nil
+}
+
+func TestServer_SubmitAndDownload(t *testing.T) {
+	drop := t.TempDir()
+	s := newTestServer(t, Config{Deliveries: map[string]*report.Delivery{"drop": {Folder: &report.FolderDelivery{Path: drop}}}}, nil)
+	s.Start()
+	defer s.Close()
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	resp, job := postReport(t, ts.URL, `{"app_id":"sales","target":"objects","target_ids":["tbl-sales"],"output_format":"csv","delivery_name":"drop"}`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	if job.ID == "" || resp.Header.Get("Location") != "/reports/"+job.ID {
+		t.Fatalf("unexpected job %+v, location %s", job, resp.Header.Get("Location"))
+	}
+	if job.UserDir != "CORP" || job.UserId != "alice" || job.Format != "csv" {
+		t.Errorf("unexpected job %+v", job)
+	}
+
+	done := waitJob(t, s, job.ID)
+	if done.Status != JOB_STATUS_SUCCEEDED || done.PrintedRows != 5 || done.FileName != job.ID+".csv" {
+		t.Fatalf("unexpected finished job %+v", done)
+	}
+	if len(done.Deliveries) != 1 || done.Deliveries[0].Result != nil {
+		t.Errorf("deliveries = %s", util.JsonStr(done.Deliveries))
+	}
+	if _, err := os.Stat(filepath.Join(drop, done.FileName)); err != nil {
+		t.Errorf("not delivered: %v", err)
+	}
+
+	resp = getAs(t, ts.URL+"/reports/"+job.ID+"/file", testUser)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(string(body), "Region,Product,Sales,Margin\n") {
+		t.Errorf("file: status %d, body %q", resp.StatusCode, body)
+	}
+	if cd := resp.Header.Get("Content-Disposition"); cd != `attachment; filename="`+job.ID+`.csv"` {
+		t.Errorf("Content-Disposition = %s", cd)
+	}
+
+	resp, job = postReport(t, ts.URL, `{"app_id":"sales","target":"queries","queries":[{"title":"q","dimensions":[{"field":"Product"}],"measures":[{"expr":"Sum(Sales)","label":"Sales"}]}],"output_format":"csv"}`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("queries: status = %d", resp.StatusCode)
+	}
+	if done = waitJob(t, s, job.ID); done.Status != JOB_STATUS_SUCCEEDED || done.PrintedRows == 0 {
+		t.Errorf("queries job: %+v", done)
+	}
+
+	_, job = postReport(t, ts.URL, `{"app_id":"sales","target":"objects","target_ids":["missing"],"output_format":"csv"}`)
+	if done = waitJob(t, s, job.ID); done.Status != JOB_STATUS_FAILED || done.Error == "" || done.FileName != "" {
+		t.Errorf("print failure: %+v", done)
+	}
+}
+
+func TestServer_UserScopeAndNames(t *testing.T) {
+	s := newTestServer(t, Config{}, nil)
+	s.Start()
+	defer s.Close()
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	body := `{"app_id":"sales","name":"Sales","target":"objects","target_ids":["tbl-sales"],"output_format":"csv"}`
+	_, first := postReport(t, ts.URL, body)
+	_, second := postReport(t, ts.URL, body)
+	first, second = *waitJob(t, s, first.ID), *waitJob(t, s, second.ID)
+	if first.Status != JOB_STATUS_SUCCEEDED || second.Status != JOB_STATUS_SUCCEEDED {
+		t.Fatalf("unexpected jobs %+v, %+v", first, second)
+	}
+	if first.file == second.file || filepath.Base(first.file) != first.ID+".csv" {
+		t.Errorf("jobs of the same name share file %s", first.file)
+	}
+	resp := getAs(t, ts.URL+"/reports/"+first.ID+"/file", testUser)
+	resp.Body.Close()
+	if cd := resp.Header.Get("Content-Disposition"); resp.StatusCode != http.StatusOK || cd != `attachment; filename="Sales.csv"` {
+		t.Errorf("file: status %d, Content-Disposition %s", resp.StatusCode, cd)
+	}
+
+	bob := "UserDirectory=CORP; UserId=bob"
+	for _, path := range []string{"/reports/" + first.ID, "/reports/" + first.ID + "/file"} {
+		if resp := getAs(t, ts.URL+path, bob); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s of another user: status = %d, want 404", path, resp.StatusCode)
+		}
+	}
+	var jobs []Job
+	resp = getAs(t, ts.URL+"/reports", bob)
+	json.NewDecoder(resp.Body).Decode(&jobs)
+	resp.Body.Close()
+	if len(jobs) != 0 {
+		t.Errorf("another user lists %d jobs", len(jobs))
+	}
+	resp = getAs(t, ts.URL+"/reports", "UserDirectory=corp; UserId=alice")
+	json.NewDecoder(resp.Body).Decode(&jobs)
+	resp.Body.Close()
+	if len(jobs) != 2 {
+		t.Errorf("owner lists %d jobs, want 2", len(jobs))
+	}
+}
+
+func TestServer_Errors(t *testing.T) {
+	release := make(chan struct{})
+	auditFile := filepath.Join(t.TempDir(), "audit.jsonl")
+	s := newTestServer(t, Config{MaxConcurrent: 1, QueueSize: 1, AuditLog: &report.AuditLogConfig{FileName: auditFile}}, release)
+	s.Start()
+	defer s.Close()
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"bad json", `{`, http.StatusBadRequest},
+		{"no app", `{"target":"sheet","target_ids":["s1"]}`, http.StatusBadRequest},
+		{"bad target", `{"app_id":"a","target":"story","target_ids":["s1"]}`, http.StatusBadRequest},
+		{"no query", `{"app_id":"a","target":"queries"}`, http.StatusBadRequest},
+		{"empty query", `{"app_id":"a","target":"queries","queries":[{"title":"q"}]}`, http.StatusBadRequest},
+		{"bad format", `{"app_id":"a","target":"sheet","target_ids":["s1"],"output_format":"doc"}`, http.StatusBadRequest},
+		{"selection without field", `{"app_id":"a","target":"sheet","target_ids":["s1"],"selections":[{"values":["x"]}]}`, http.StatusBadRequest},
+		{"delivery", `{"app_id":"a","target":"sheet","target_ids":["s1"],"delivery":{"folder":{"path":"/etc"}}}`, http.StatusBadRequest},
+		{"unknown delivery", `{"app_id":"a","target":"sheet","target_ids":["s1"],"delivery_name":"drop"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if resp, _ := postReport(t, ts.URL, tt.body); resp.StatusCode != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, resp.StatusCode, tt.want)
+		}
+	}
+
+	if resp := getAs(t, ts.URL+"/reports/nope", testUser); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown job should be 404")
+	}
+	for _, user := range []string{"", "UserDirectory=CORP"} {
+		if resp := getAs(t, ts.URL+"/reports", user); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("list without UserId %q: status = %d, want 401", user, resp.StatusCode)
+		}
+	}
+	if resp, err := http.Post(ts.URL+"/reports", "application/json", strings.NewReader(`{}`)); err != nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("submit without UserId should be 401")
+	}
+
+	// 1st job is connecting and blocked, 2nd fills the queue, 3rd is rejected
+	valid := `{"app_id":"missing","target":"sheet","target_ids":["s1"]}`
+	_, running := postReport(t, ts.URL, valid)
+	for {
+		if job, _ := s.GetJob(running.ID); job.Status == JOB_STATUS_RUNNING {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	_, queued := postReport(t, ts.URL, valid)
+	if resp, _ := postReport(t, ts.URL, valid); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("full queue: status = %d", resp.StatusCode)
+	}
+	if resp := getAs(t, ts.URL+"/reports/"+running.ID+"/file", testUser); resp.StatusCode != http.StatusConflict {
+		t.Errorf("file of running job should be 409")
+	}
+
+	close(release)
+	if job := waitJob(t, s, running.ID); job.Status != JOB_STATUS_FAILED || job.Error == "" {
+		t.Errorf("connect failure: %+v", job)
+	}
+	if job := waitJob(t, s, queued.ID); job.Status != JOB_STATUS_FAILED || job.Error == "" {
+		t.Errorf("connect failure: %+v", job)
+	}
+	if resp := getAs(t, ts.URL+"/reports/"+running.ID+"/file", testUser); resp.StatusCode != http.StatusConflict {
+		t.Errorf("file of failed job should be 409")
+	}
+	if jobs := s.Jobs(); len(jobs) != 2 || jobs[0].ID != running.ID {
+		t.Errorf("unexpected jobs %+v", jobs)
+	}
+
+	records, res := s.AuditLog().Query(report.AuditFilter{AppId: "missing"})
+	if res != nil {
+		t.Fatalf("Query: %s", res.Error())
+	}
+	if len(records) != 2 || records[0].UserId != "alice" || records[0].IpAddr != "127.0.0.1" || records[0].Error == "" {
+		t.Errorf("unexpected audit records %+v", records)
+	}
+}
+
+func TestServer_StartAfterClose(t *testing.T) {
+	s := newTestServer(t, Config{MaxConcurrent: 1, QueueSize: 1}, nil)
+	s.Close()
+	s.Start()
+	done := make(chan struct{})
+	go func() {
+		s.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close hangs after Start on a closed server")
+	}
+}
+
+func TestParseQlikUser(t *testing.T) {
+	tests := []struct {
+		header  string
+		dir, id string
+	}{
+		{"UserDirectory=CORP; UserId=alice", "CORP", "alice"},
+		{"userid=bob;userdirectory=EXT", "EXT", "bob"},
+		{"", "", ""},
+		{"garbage", "", ""},
+	}
+	for _, tt := range tests {
+		dir, id := parseQlikUser(tt.header)
+		if dir != tt.dir || id != tt.id {
+			t.Errorf("parseQlikUser(%q) = %s, %s", tt.header, dir, id)
+		}
+	}
+}